@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// aliases are the commands defined by `alias name command; command...`, they are expanded before the builtin
+// ones, so the short forms like `n` or `c` can be defined again to what gdb or delve mean by them
+var aliases = map[string]string{}
+
+// maxAliasDepth bounds how many aliases an alias is expanded through, the recursive ones fail beyond it
+const maxAliasDepth = 16
+
+// AddAlias defines name as the commands separated by `;`
+func AddAlias(name string, commands string) error {
+	if name == "alias" || name == "unalias" {
+		return fmt.Errorf("`%s` can't be an alias", name)
+	}
+	if strings.TrimSpace(strings.Replace(commands, ";", "", -1)) == "" {
+		return fmt.Errorf("alias `%s` has no command", name)
+	}
+	aliases[name] = commands
+	return nil
+}
+
+// RemoveAlias removes the alias name
+func RemoveAlias(name string) error {
+	if _, ok := aliases[name]; !ok {
+		return fmt.Errorf("can't find alias `%s`", name)
+	}
+	delete(aliases, name)
+	return nil
+}
+
+// expandAlias returns the commands input runs, the args following an alias are appended to the last command of it
+func expandAlias(input string) ([]string, error) {
+	return expandAliasDepth(input, 0)
+}
+
+func expandAliasDepth(input string, depth int) ([]string, error) {
+	sps := strings.SplitN(input, " ", 2)
+	commands, ok := aliases[sps[0]]
+	if !ok {
+		return []string{input}, nil
+	}
+	if depth == maxAliasDepth {
+		return nil, fmt.Errorf("alias `%s` is expanded recursively", sps[0])
+	}
+	parts := make([]string, 0)
+	for _, part := range strings.Split(commands, ";") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(sps) == 2 {
+		parts[len(parts)-1] += " " + sps[1]
+	}
+	expanded := make([]string, 0)
+	for _, part := range parts {
+		// an alias expands to itself like `alias n next`, or to the builtin command of the same name
+		if strings.SplitN(part, " ", 2)[0] == sps[0] {
+			expanded = append(expanded, part)
+			continue
+		}
+		cmds, err := expandAliasDepth(part, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, cmds...)
+	}
+	return expanded, nil
+}
+
+func printAliases() {
+	if len(aliases) == 0 {
+		fmt.Fprintf(stdout, "%s\n", "there is no alias")
+		return
+	}
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(stdout, "%s = %s\n", name, aliases[name])
+	}
+}
@@ -0,0 +1,158 @@
+// Package api is the json-rpc api of `godbg --headless`, the arguments and the replies of the methods of
+// the service ServiceName are shared by the server and the client
+package api
+
+// Version is the version of the api, the methods of another version are served by another service
+const Version = 1
+
+// ServiceName is the service of the methods like `GodbgV1.CreateBreakpoint`
+const ServiceName = "GodbgV1"
+
+type Breakpoint struct {
+	Id       int
+	File     string
+	Line     int
+	Pc       uint64
+	Cond     string
+	Disabled bool
+}
+
+// State is where the debuggee stops after a command, Exited is set if it has gone
+type State struct {
+	Exited     bool
+	ExitStatus int
+	Reason     string
+	Pc         uint64
+	File       string
+	Line       int
+	Function   string
+	// GoroutineId runs on the thread stopping, 0 if it is unknown
+	GoroutineId uint64
+	// Traces are the logs of the tracepoints hit on the way
+	Traces []string
+}
+
+type Goroutine struct {
+	Id     uint64
+	Status string
+	// Location is the user code where the goroutine is like `file:line function`
+	Location string
+	// Thread runs the goroutine, 0 if it is not running
+	Thread int
+}
+
+type Stackframe struct {
+	Function string
+	File     string
+	Line     int
+	Pc       uint64
+}
+
+type Variable struct {
+	Name     string
+	Type     string
+	Value    string
+	Shadowed bool
+}
+
+// Scope selects the frame of the goroutine, the goroutine 0 is the current one
+type Scope struct {
+	GoroutineId uint64
+	Frame       int
+}
+
+type GetVersionIn struct{}
+
+type GetVersionOut struct {
+	APIVersion int
+}
+
+type CreateBreakpointIn struct {
+	// Loc is like `file.go:line` or a function name
+	Loc  string
+	Cond string
+}
+
+type CreateBreakpointOut struct {
+	Breakpoint Breakpoint
+}
+
+type ListBreakpointsIn struct{}
+
+type ListBreakpointsOut struct {
+	Breakpoints []Breakpoint
+}
+
+type ClearBreakpointIn struct {
+	Id int
+}
+
+type ClearBreakpointOut struct {
+	Breakpoint Breakpoint
+}
+
+// the names of the commands
+const (
+	Continue = "continue"
+	Next     = "next"
+	Step     = "step"
+	StepOut  = "stepout"
+)
+
+type CommandIn struct {
+	Name string
+}
+
+type CommandOut struct {
+	State State
+}
+
+type ListGoroutinesIn struct{}
+
+type ListGoroutinesOut struct {
+	Goroutines []Goroutine
+}
+
+type StacktraceIn struct {
+	GoroutineId uint64
+	// Depth bounds the frames, 0 is unbounded
+	Depth int
+}
+
+type StacktraceOut struct {
+	Frames []Stackframe
+}
+
+type EvalIn struct {
+	Scope Scope
+	Expr  string
+}
+
+type EvalOut struct {
+	Value string
+}
+
+type ListLocalsIn struct {
+	Scope Scope
+}
+
+type ListLocalsOut struct {
+	Variables []Variable
+}
+
+// ExecIn runs a command of the prompt, its output is replied
+type ExecIn struct {
+	Line string
+}
+
+type ExecOut struct {
+	Stdout string
+	Stderr string
+}
+
+// DetachIn ends the session, the debuggee is killed if Kill is set or it is started by godbg
+type DetachIn struct {
+	Kill bool
+}
+
+type DetachOut struct{}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"strings"
+)
+
+// lvalue is where a value is assigned, it is in the memory at addr unless reg is not empty
+type lvalue struct {
+	typ dwarf.Type
+	addr uint64
+	reg string
+}
+
+// resolveType skips the typedefs of typ
+func resolveType(typ dwarf.Type) dwarf.Type {
+	for {
+		t, ok := typ.(*dwarf.TypedefType)
+		if !ok {
+			return typ
+		}
+		typ = t.Type
+	}
+}
+
+// evalLvalue finds the place of a variable, a field of a struct like `p.x`, an element like `a[i]`, or
+// a dereference like `*p`. The fields of a pointer to struct are selected through it as go does. The names
+// which are not local are the package variables of the function selected, or `pkg.name`
+func evalLvalue(node ast.Expr) (*lvalue, error) {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return evalLvalue(n.X)
+	case *ast.Ident:
+		entry, addr, err := findVariable(n.Name)
+		if _, ok := err.(*NotFoundVariableErr); ok {
+			// the variable moved to the heap is `&name`, which points to it
+			if !strings.HasPrefix(n.Name, "&") {
+				if x, e := evalLvalue(&ast.Ident{Name: "&" + n.Name}); e == nil {
+					return derefLvalue(x)
+				}
+			}
+			if x, ok := packageLvalue(n.Name); ok {
+				return x, nil
+			}
+			return nil, err
+		}
+		if err != nil {
+			if _, ok := err.(*UnsupportVariableErr); !ok || entry == nil {
+				return nil, err
+			}
+			// a variable in a register of the innermost frame is assigned to the register
+			frame, e := selectedFrame()
+			if e != nil {
+				return nil, e
+			}
+			pieces, e := variablePieces(entry, frame, 0)
+			if e != nil || len(pieces) != 1 || !pieces[0].inReg || pieces[0].reg >= len(dwarfRegisters) {
+				return nil, err
+			}
+			if curFrame != 0 {
+				return nil, fmt.Errorf("%s is in a register of frame 0, it can't be assigned in frame %d", n.Name, curFrame)
+			}
+			typ, err := bi.variableType(entry)
+			if err != nil {
+				return nil, err
+			}
+			return &lvalue{typ: typ, reg: dwarfRegisters[pieces[0].reg]}, nil
+		}
+		typ, err := bi.variableType(entry)
+		if err != nil {
+			return nil, err
+		}
+		return &lvalue{typ: typ, addr: addr}, nil
+	case *ast.StarExpr:
+		x, err := evalLvalue(n.X)
+		if err != nil {
+			return nil, err
+		}
+		return derefLvalue(x)
+	case *ast.SelectorExpr:
+		x, err := evalLvalue(n.X)
+		if _, ok := err.(*NotFoundVariableErr); ok {
+			if pkg, ok := n.X.(*ast.Ident); ok {
+				if x, ok := packageLvalue(pkg.Name + "." + n.Sel.Name); ok {
+					return x, nil
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := resolveType(x.typ).(*dwarf.PtrType); ok {
+			if x, err = derefLvalue(x); err != nil {
+				return nil, err
+			}
+		}
+		st, ok := resolveType(x.typ).(*dwarf.StructType)
+		if !ok || x.reg != "" {
+			return nil, fmt.Errorf("%s has no field %s", x.typ.String(), n.Sel.Name)
+		}
+		for _, f := range st.Field {
+			if f.Name == n.Sel.Name {
+				return &lvalue{typ: f.Type, addr: x.addr + uint64(f.ByteOffset)}, nil
+			}
+		}
+		return nil, fmt.Errorf("%s has no field %s", x.typ.String(), n.Sel.Name)
+	case *ast.IndexExpr:
+		x, err := evalLvalue(n.X)
+		if err != nil {
+			return nil, err
+		}
+		v, err := evalNode(n.Index)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := mapType(x.typ); ok {
+			return indexMap(x, v)
+		}
+		i, ok := constant.Int64Val(v)
+		if v.Kind() != constant.Int || !ok {
+			return nil, fmt.Errorf("the index should be an integer, not %s", v.String())
+		}
+		return indexLvalue(x, i)
+	case *ast.CallExpr:
+		// `(T)(x)` asserts the interface x, the functions are not called
+		t, ok := n.Fun.(*ast.ParenExpr)
+		if !ok || len(n.Args) != 1 {
+			return nil, fmt.Errorf("not support calling %s", types.ExprString(n.Fun))
+		}
+		x, err := evalLvalue(n.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		return assertLvalue(x, types.ExprString(t.X))
+	}
+	return nil, fmt.Errorf("not support the place %T", node)
+}
+
+// assertLvalue returns the value of the interface x if its dynamic type is `name`. The names without
+// the package are of the package of the function selected
+func assertLvalue(x *lvalue, name string) (*lvalue, error) {
+	t, ok := resolveType(x.typ).(*dwarf.StructType)
+	if !ok || (t.StructName != "runtime.eface" && t.StructName != "runtime.iface") {
+		return nil, fmt.Errorf("%s is not an interface", dwarfTypeName(x.typ))
+	}
+	if x.reg != "" {
+		return nil, fmt.Errorf("can't assert %s in the register %s", dwarfTypeName(x.typ), x.reg)
+	}
+	typ, data, err := interfaceWords(t, x.addr)
+	if err != nil {
+		return nil, err
+	}
+	if typ == 0 {
+		return nil, fmt.Errorf("interface conversion: interface is nil, not %s", name)
+	}
+	dynamic, err := bi.dynamicType(typ)
+	if err != nil {
+		return nil, err
+	}
+	if actual := dwarfTypeName(dynamic); actual != name && actual != qualifiedTypeName(name) {
+		return nil, fmt.Errorf("interface conversion: interface is %s, not %s", actual, name)
+	}
+	if isPointerShaped(dynamic) {
+		// the value is the data word
+		return &lvalue{typ: dynamic, addr: x.addr + 8}, nil
+	}
+	return &lvalue{typ: dynamic, addr: data}, nil
+}
+
+// qualifiedTypeName adds the package of the function selected to the type name like `T` or `*T`
+func qualifiedTypeName(name string) string {
+	base := strings.TrimLeft(name, "*")
+	frame, err := selectedFrame()
+	if err != nil || strings.Contains(base, ".") {
+		return name
+	}
+	return name[:len(name) - len(base)] + packageName(frame.fn.name) + "." + base
+}
+
+// packageLvalue finds the package variable `pkg.name`, or `name` of the package of the function selected
+func packageLvalue(name string) (*lvalue, bool) {
+	pv, ok := bi.packageVar(name)
+	if !ok && !strings.Contains(name, ".") {
+		frame, err := selectedFrame()
+		if err != nil {
+			return nil, false
+		}
+		pv, ok = bi.packageVar(packageName(frame.fn.name) + "." + name)
+	}
+	if !ok {
+		return nil, false
+	}
+	typ, err := bi.variableType(pv.entry)
+	if err != nil {
+		return nil, false
+	}
+	return &lvalue{typ: typ, addr: pv.addr}, true
+}
+
+// packageName returns the package path of the function like `github.com/a/b.(*T).f`
+func packageName(fn string) string {
+	i := strings.LastIndex(fn, "/") + 1
+	if j := strings.Index(fn[i:], "."); j >= 0 {
+		return fn[:i + j]
+	}
+	return fn
+}
+
+// indexLvalue returns the element i of an array, a pointer to array or a slice
+func indexLvalue(x *lvalue, i int64) (*lvalue, error) {
+	if _, ok := resolveType(x.typ).(*dwarf.PtrType); ok {
+		p, err := derefLvalue(x)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := resolveType(p.typ).(*dwarf.ArrayType); !ok {
+			return nil, fmt.Errorf("can't index %s", x.typ.String())
+		}
+		x = p
+	}
+	if x.reg != "" {
+		return nil, fmt.Errorf("can't index %s in the register %s", x.typ.String(), x.reg)
+	}
+	var (
+		elem dwarf.Type
+		base uint64
+		length int64
+	)
+	switch t := resolveType(x.typ).(type) {
+	case *dwarf.ArrayType:
+		elem, base, length = t.Type, x.addr, t.Count
+	case *dwarf.StructType:
+		// a slice is struct { array *T; len int; cap int }
+		array, ok := resolveType(t.Field[0].Type).(*dwarf.PtrType)
+		if !isSliceType(t) || !ok {
+			return nil, fmt.Errorf("can't index %s", x.typ.String())
+		}
+		header := make([]byte, 16)
+		if _, err := ptracePeekData(cmd.Process.Pid, uintptr(x.addr), header); err != nil {
+			return nil, err
+		}
+		elem = array.Type
+		base, length = binary.LittleEndian.Uint64(header), int64(binary.LittleEndian.Uint64(header[8:]))
+	default:
+		return nil, fmt.Errorf("can't index %s", x.typ.String())
+	}
+	if i < 0 || i >= length {
+		return nil, fmt.Errorf("index out of range [%d] with length %d", i, length)
+	}
+	return &lvalue{typ: elem, addr: base + uint64(i * elem.Size())}, nil
+}
+
+// derefLvalue returns the place which the pointer x points to
+func derefLvalue(x *lvalue) (*lvalue, error) {
+	pt, ok := resolveType(x.typ).(*dwarf.PtrType)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a pointer", x.typ.String())
+	}
+	addr, err := x.load()
+	if err != nil {
+		return nil, err
+	}
+	if addr == 0 {
+		return nil, fmt.Errorf("nil pointer dereference")
+	}
+	return &lvalue{typ: pt.Type, addr: addr}, nil
+}
+
+// load reads the word of an lvalue whose size is 8 at most
+func (l *lvalue) load() (uint64, error) {
+	if l.reg != "" {
+		regs, err := getRegisters()
+		if err != nil {
+			return 0, err
+		}
+		r, err := findRegister(l.reg)
+		if err != nil {
+			return 0, err
+		}
+		return *r.field(&regs), nil
+	}
+	mem := make([]byte, 8)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(l.addr), mem[:l.typ.Size()]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(mem), nil
+}
+
+// store writes the memory of the value, a register is written with the value extended to 64 bits
+func (l *lvalue) store(mem []byte) error {
+	if l.reg == "" {
+		return WriteMemory(l.addr, mem)
+	}
+	word := make([]byte, 8)
+	copy(word, mem)
+	return SetRegister(l.reg, binary.LittleEndian.Uint64(word))
+}
+
+// Assign evaluates `lvalue = expr` and writes the value converted to the type of lvalue. The numbers, bools,
+// pointers and strings are supported, a pointer is assigned by `&name`, `nil` or an address, and the bytes
+// of a new string are allocated by calling runtime.mallocgc in the debuggee
+func (bp *BP) Assign(expr string) (string, error) {
+	if cmd.Process == nil {
+		return "", NoProcessRuning
+	}
+	if replaying() {
+		return "", ReplayReadOnlyErr
+	}
+	i := strings.Index(expr, "=")
+	if i < 0 {
+		return "", fmt.Errorf("`%s` is not an assignment", expr)
+	}
+	left, right := strings.TrimSpace(expr[:i]), strings.TrimSpace(expr[i+1:])
+	lnode, err := parser.ParseExpr(left)
+	if err != nil {
+		return "", err
+	}
+	rnode, err := parser.ParseExpr(right)
+	if err != nil {
+		return "", err
+	}
+	l, err := evalLvalue(lnode)
+	if err != nil {
+		return "", err
+	}
+
+	typ := resolveType(l.typ)
+	var mem []byte
+	switch t := typ.(type) {
+	case *dwarf.PtrType:
+		addr, err := pointerValue(rnode)
+		if err != nil {
+			return "", err
+		}
+		mem = make([]byte, 8)
+		binary.LittleEndian.PutUint64(mem, addr)
+	case *dwarf.StructType:
+		if !isStringType(t) {
+			return "", fmt.Errorf("not support assigning the struct %s", l.typ.String())
+		}
+		v, err := evalNode(rnode)
+		if err != nil {
+			return "", err
+		}
+		if v.Kind() != constant.String {
+			return "", fmt.Errorf("can't assign %s to %s %s", v.String(), left, l.typ.String())
+		}
+		s := constant.StringVal(v)
+		// the stack may move while calling, so the place is found again
+		frame := curFrame
+		data, err := bp.allocBytes([]byte(s))
+		curFrame = frame
+		if err != nil {
+			return "", err
+		}
+		if l, err = evalLvalue(lnode); err != nil {
+			return "", err
+		}
+		mem = make([]byte, 16)
+		binary.LittleEndian.PutUint64(mem, data)
+		binary.LittleEndian.PutUint64(mem[8:], uint64(len(s)))
+	default:
+		v, err := evalNode(rnode)
+		if err != nil {
+			return "", err
+		}
+		if mem, err = encodeBasicValue(typ, v); err != nil {
+			return "", fmt.Errorf("can't assign %s to %s %s: %v", v.String(), left, l.typ.String(), err)
+		}
+	}
+	if err = l.store(mem); err != nil {
+		return "", err
+	}
+	return l.format()
+}
+
+// pointerValue evaluates the address assigned to a pointer
+func pointerValue(node ast.Expr) (uint64, error) {
+	if ident, ok := node.(*ast.Ident); ok && ident.Name == "nil" {
+		return 0, nil
+	}
+	if u, ok := node.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		x, err := evalLvalue(u.X)
+		if err != nil {
+			return 0, err
+		}
+		if x.reg != "" {
+			return 0, fmt.Errorf("a variable in the register %s has no address", x.reg)
+		}
+		return x.addr, nil
+	}
+	v, err := evalNode(node)
+	if err != nil {
+		return 0, err
+	}
+	addr, ok := constant.Uint64Val(v)
+	if v.Kind() != constant.Int || !ok {
+		return 0, fmt.Errorf("the address should be an integer, not %s", v.String())
+	}
+	return addr, nil
+}
+
+// encodeBasicValue converts v to the memory of a number or bool of typ, it fails if v overflows typ
+func encodeBasicValue(typ dwarf.Type, v constant.Value) ([]byte, error) {
+	size := typ.Size()
+	mem := make([]byte, 8)
+	switch typ.(type) {
+	case *dwarf.IntType:
+		x, ok := constant.Int64Val(constant.ToInt(v))
+		if !ok || (size < 8 && (x < -(1 << uint(size * 8 - 1)) || x >= 1 << uint(size * 8 - 1))) {
+			return nil, fmt.Errorf("overflow")
+		}
+		binary.LittleEndian.PutUint64(mem, uint64(x))
+	case *dwarf.UintType:
+		x, ok := constant.Uint64Val(constant.ToInt(v))
+		if !ok || (size < 8 && x >= 1 << uint(size * 8)) {
+			return nil, fmt.Errorf("overflow")
+		}
+		binary.LittleEndian.PutUint64(mem, x)
+	case *dwarf.BoolType:
+		if v.Kind() != constant.Bool {
+			return nil, fmt.Errorf("not bool")
+		}
+		if constant.BoolVal(v) {
+			mem[0] = 1
+		}
+	case *dwarf.FloatType:
+		if !isNumber(v) {
+			return nil, fmt.Errorf("not a number")
+		}
+		f, _ := constant.Float64Val(constant.ToFloat(v))
+		if size == 4 {
+			binary.LittleEndian.PutUint32(mem, math.Float32bits(float32(f)))
+		} else {
+			binary.LittleEndian.PutUint64(mem, math.Float64bits(f))
+		}
+	default:
+		return nil, fmt.Errorf("not support the type")
+	}
+	return mem[:size], nil
+}
+
+// allocBytes copies data to the memory allocated by runtime.mallocgc(len(data), nil, false) in the debuggee,
+// the memory without pointers is kept by the variable assigned
+func (bp *BP) allocBytes(data []byte) (uint64, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	f, err := bi.findFunctionByName("runtime.mallocgc")
+	if err != nil {
+		return 0, err
+	}
+	_, results, err := bp.callFunction(f, []uint64{uint64(len(data)), 0, 0})
+	if err != nil {
+		return 0, err
+	}
+	// the pointer returned is in rax by the register ABI
+	addr := results.Rax
+	if addr == 0 {
+		return 0, fmt.Errorf("runtime.mallocgc returns nil for %d bytes", len(data))
+	}
+	return addr, WriteMemory(addr, data)
+}
+
+// value loads the value of the lvalue, a pointer is the address it points to
+func (l *lvalue) value() (constant.Value, error) {
+	typ := resolveType(l.typ)
+	if _, ok := typ.(*dwarf.PtrType); ok || l.reg != "" {
+		word, err := l.load()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return constant.MakeUint64(word), nil
+		}
+		mem := make([]byte, 8)
+		binary.LittleEndian.PutUint64(mem, word)
+		return decodeValue(typ, mem[:typ.Size()])
+	}
+	return loadValue(typ, l.addr)
+}
+
+// format renders the value of the lvalue after assigning
+func (l *lvalue) format() (string, error) {
+	typ := resolveType(l.typ)
+	if _, ok := typ.(*dwarf.PtrType); ok || l.reg != "" {
+		word, err := l.load()
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return fmt.Sprintf("%#x", word), nil
+		}
+		mem := make([]byte, 8)
+		binary.LittleEndian.PutUint64(mem, word)
+		return formatBasicValue(typ, mem[:typ.Size()]), nil
+	}
+	if isString(typ) {
+		return newPrinter().format(typ, l.addr)
+	}
+	v, err := loadValue(typ, l.addr)
+	if err != nil {
+		return "", err
+	}
+	return formatValue(v), nil
+}
@@ -2,22 +2,53 @@ package main
 
 import (
 	"bytes"
-	"compress/zlib"
+	"context"
+	"crypto/sha256"
 	"debug/dwarf"
 	"debug/elf"
+	"debug/gosym"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"github.com/chainhelen/godbg/log"
 	"go.uber.org/zap"
 	"golang.org/x/arch/x86/x86asm"
 	"io"
+	"os"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type CompileUnit struct {
+	name string
 	functions []*Function
+	// lowpc is the base address of the location lists, addrBase is where the addresses of the unit
+	// begin in .debug_addr
+	lowpc uint64
+	addrBase uint64
+	// language is DW_AT_language, the units of cgo and libgcc are C or assembly
+	language int64
+	// optimized is the unit compiled without -N, which DW_AT_producer tells
+	optimized bool
+	// entry is the unit in .debug_info and ranges are the pcs of its code, they are read by analyze. The children
+	// and the line table are parsed on the first use, loaded and linesLoaded tell whether they are
+	entry *dwarf.Entry
+	ranges [][2]uint64
+	loaded bool
+	linesLoaded bool
+	// packageVars and lines are what the unit adds to BI, unitSize and linesSize estimate their bytes. They are
+	// taken out by unloadCompileUnit, used is when the unit is looked up the last time. The lines are sorted by
+	// the addresses, the rows at the same address are in the order of the line table
+	packageVars []*PackageVar
+	lines []*dwarf.LineEntry
+	unitSize int64
+	linesSize int64
+	used uint64
 }
 
 type Function struct {
@@ -27,125 +58,351 @@ type Function struct {
 	frameBase []byte
 	declFile int64
 	external bool
+	// optimized is of the compile unit, the lines and the variables of the optimized code may be inaccurate
+	optimized bool
 
 	variables []*dwarf.Entry
+	// scopes are the lexical blocks where the variables are declared, the others are in the whole function
+	scopes map[dwarf.Offset]*Scope
 	cu *CompileUnit
 }
 
+// Scope is a lexical block of a function, depth is 1 for the blocks in the body and grows with the nesting
+type Scope struct {
+	ranges [][2]uint64
+	depth int
+}
+
+// PackageVar is a variable of a package, which lives at a fixed address
+type PackageVar struct {
+	name string
+	addr uint64
+	entry *dwarf.Entry
+}
+
+// AttrGoRuntimeType is DW_AT_go_runtime_type, the offset of the runtime._type of a go type from runtime.types
+const AttrGoRuntimeType dwarf.Attr = 0x2904
+
+// AttrGoElem is DW_AT_go_elem, the element type of the channels, the maps, the slices and the arrays
+const AttrGoElem dwarf.Attr = 0x2902
+
+// BI is the debug info of a binary, its methods are safe for the concurrent use. What analyze indexes, the compile
+// units, the files, the symbols and the frames, is not changed after it. The units are loaded and dropped by the
+// lookups holding mu, the methods like lineEntries which need it held say so
 type BI struct {
+	// Sources, Statements, Functions, PackageVars, Types and RuntimeTypes have the compile units loaded so far,
+	// they are looked up by the methods loading the units needed, which hold mu
 	Sources map[string]map[int][]*dwarf.LineEntry
+	// Statements indexes the line entries which begin a statement by the pc
+	Statements map[uint64]*dwarf.LineEntry
 	Functions []*Function
 	CompileUnits []*CompileUnit
 	FramesInformation []*VirtualUnwindFrameInformation
+	DwarfData *dwarf.Data
+	PackageVars map[string]*PackageVar
+	// Types indexes the named types by the name like `runtime.g`
+	Types map[string]dwarf.Offset
+	// RuntimeTypes indexes the types by the offset of their runtime._type from TypesAddr
+	RuntimeTypes map[uint64]dwarf.Offset
+	// TypesAddr is the address of runtime.types, where the runtime._type of the types are
+	TypesAddr uint64
+	// buildVersion is runtime.buildVersion in the data of the executable file, like TypesAddr it is not read again
+	// from the cached index
+	buildVersion string
+	// LocLists is .debug_loclists of dwarf 5, or .debug_loc of the older versions if LocListsV5 is false, it is
+	// read by locLists on the first use.
+	// DebugAddr is .debug_addr, where the location lists of dwarf 5 find the addresses by the indexes
+	LocLists []byte
+	LocListsV5 bool
+	DebugAddr []byte
+	// Checksum of the executable file, restarting analyzes it again if it changes. modTime, size and buildID tell
+	// the file changed without reading it, see changed. The sources modified after modTime are stale
+	Checksum [sha256.Size]byte
+	modTime int64
+	size int64
+	buildID string
+	// file is the executable mapped, where the sections are read
+	file *mappedFile
+	// sections and segments are the headers of the executable file
+	sections []Section
+	segments []Segment
+	// funcIndex finds the compile unit of a function by the name, fileIndex finds the ones whose line tables
+	// have the file
+	funcIndex map[string]*CompileUnit
+	fileIndex map[string][]*CompileUnit
+	// funcNames are the names of funcIndex sorted, functionsByName has the functions loaded. Functions and the
+	// functions of a compile unit are sorted by lowpc
+	funcNames []string
+	functionsByName map[string]*Function
+	// unitRanges are the ranges of the compile units sorted by lowpc
+	unitRanges []unitRange
+	// files are the files of fileIndex sorted, suffixIndex finds them by the suffixes of their paths
+	files []string
+	suffixIndex map[string][]string
+	// strings has the names of the functions and the variables and the paths of the files, so each is kept once
+	strings *stringTable
+	// resident is the bytes of the units loaded, which trimUnits keeps within dwarfBudget. useClock counts the
+	// lookups of the units and evictions the units dropped
+	resident int64
+	useClock uint64
+	evictions int
+	// goVersion is the go building the binary, the layouts of the runtime and the ABI are chosen by it
+	goVersion goVersion
+	// gOffset is where the TLS of a thread keeps the g running on it from fs_base, see tlsGOffset
+	gOffset int64
+	// symTable is .gopclntab of the binary without DWARF, symbolLines are the rows of the functions found in it
+	symTable *gosym.Table
+	symbolLines map[*Function][]*dwarf.LineEntry
+	// mu guards the units loaded and what they are merged into, and the cache of the types in DwarfData
+	mu sync.Mutex
 }
 
+type unitRange struct {
+	lowpc uint64
+	highpc uint64
+	cu *CompileUnit
+}
 
-func analyze(execfile string) (*BI, error) {
-	var (
-		elffile *elf.File
-		err error
-		dwarfData *dwarf.Data
-		bi *BI
-	)
-	if elffile, err = elf.Open(execfile); err != nil {
-		return nil, err
-	}
-	defer elffile.Close()
 
-	// just check
-	if _, err = openInfoSection(elffile); err != nil {
-		return nil, err
+func fileChecksum(filename string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(filename)
+	if err != nil {
+		return sum, err
 	}
-
-	if _, err = openLineSection(elffile); err != nil {
-		return nil, err
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return sum, err
 	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
 
-	// parse
-	bi = &BI{Sources: make(map[string]map[int][]*dwarf.LineEntry)}
-	if dwarfData, err = elffile.DWARF(); err != nil {
-		return nil, err
+// changed tells whether execfile is not the one analyzed. The same mtime and size are the same file, the build ID
+// of the rebuilt one is compared then, and the checksum only for the files without a build ID
+func (bi *BI)changed(execfile string) (bool, error) {
+	info, err := os.Stat(execfile)
+	if err != nil {
+		return false, err
 	}
-	if err = bi.ParseLineAndInfoSection(dwarfData); err != nil {
-		return nil, err
+	if info.ModTime().UnixNano() == bi.modTime && info.Size() == bi.size {
+		return false, nil
 	}
-	if err = bi.ParseFrameSection(elffile); err != nil {
-		return nil, err
+	if bi.buildID != "" {
+		file, err := mapFile(execfile)
+		if err != nil {
+			return false, err
+		}
+		defer file.close()
+		if id := buildID(file); id != "" {
+			return id != bi.buildID, nil
+		}
 	}
+	checksum, err := fileChecksum(execfile)
+	if err != nil {
+		return false, err
+	}
+	return checksum != bi.Checksum, nil
+}
 
-	// debug source log
-	for file, mp := range bi.Sources {
-		for line, lineEntryArray := range mp {
-			for _, lineEntry := range lineEntryArray {
-				logger.Debug("bi.sources",
-					zap.String("file", file), zap.Int("line", line), zap.Uint64("addr", lineEntry.Address))
-			}
-		}
+// Close unmaps the executable file of bi. The data of the sections, the frames and the functions are the slices of
+// the mapping, so bi is not used after it
+func (bi *BI)Close() error {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if bi.file == nil {
+		return nil
 	}
-	// debug frame log
-	for i, v := range bi.FramesInformation {
-		if v.CIE != nil {
-			logger.Debug("bi.frames", zap.Int("index", i), zap.String("cie", v.CIE.String()))
-		} else if v.FDE != nil {
-			logger.Debug("bi.frames", zap.Int("index", i), zap.String("fde", v.FDE.String()))
-		} else {
-			logger.Error("find frame both cie/pde == nil")
+	err := bi.file.close()
+	bi.file = nil
+	bi.DwarfData, bi.LocLists, bi.DebugAddr, bi.FramesInformation = nil, nil, nil, nil
+	bi.symTable, bi.symbolLines = nil, nil
+	return err
+}
+
+// replaceBi makes newBi the binary of the current target, the old one is closed
+func replaceBi(newBi *BI) {
+	if bi != nil && bi != newBi {
+		if err := bi.Close(); err != nil {
+			dwarfLogger.Warn("close the binary", zap.Error(err))
 		}
 	}
+	bi = newBi
+}
 
-	return bi, nil
+// staleSource tells whether the source filename of the binary is modified after the binary is built, then its lines
+// may not be where the line table says
+func (bi *BI)staleSource(filename string) bool {
+	info, err := os.Stat(substitutePath(filename))
+	return err == nil && bi.modTime != 0 && info.ModTime().UnixNano() > bi.modTime
 }
 
-func openInfoSection(elffile *elf.File) ([]byte, error) {
-	var (
-		debugInfoBytes []byte
-		err error
-	)
-	infoSection := elffile.Section(".debug_info")
-	if infoSection == nil {
-		infoSection = elffile.Section(".zdebug_info")
-	}
-	if infoSection == nil {
-		return nil, errors.New("Can't not find .debug_info or .zdebug_info")
+// loadProgress is told how many compile units are parsed of total while analyzing, it is called in order
+type loadProgress func(done int, total int)
+
+func analyze(execfile string) (*BI, error) {
+	return analyzeContext(context.Background(), execfile, nil)
+}
+
+// analyzeContext is analyze which returns the error of ctx once it is done, like canceling the attaching to a huge
+// binary. progress is told the headers of the units parsed, nil tells nothing
+func analyzeContext(ctx context.Context, execfile string, progress loadProgress) (*BI, error) {
+	file, err := mapFile(execfile)
+	if err != nil {
+		return nil, err
 	}
-	// please note that Data() returns uncompressed data if compressed
-	if debugInfoBytes, err = infoSection.Data(); err != nil {
+	bi, err := analyzeFile(ctx, execfile, file, progress)
+	if err != nil {
+		file.close()
 		return nil, err
 	}
-	return debugInfoBytes, nil
+	return bi, nil
 }
 
-func openLineSection(elffile *elf.File)([]byte, error) {
+// analyzeFile parses the mapping of execfile, the BI returned owns it
+func analyzeFile(ctx context.Context, execfile string, file *mappedFile, progress loadProgress) (*BI, error) {
 	var (
-		debugLineMapTableBytes []byte
 		err error
+		dwarfData *dwarf.Data
+		bi *BI
+		start = time.Now()
 	)
-	lineSection := elffile.Section(".debug_line")
-	if lineSection == nil {
-		lineSection = elffile.Section(".zdebug_line")
+	defer observe("analyze", start)
+
+	// -ldflags=-w or -s strips the debug sections, then the functions and the lines are read from .gopclntab
+	noDwarf := checkDebugSection(file, "info") != nil || checkDebugSection(file, "line") != nil
+
+	// parse
+	bi = &BI{Sources: make(map[string]map[int][]*dwarf.LineEntry), Statements: make(map[uint64]*dwarf.LineEntry),
+		PackageVars: make(map[string]*PackageVar), Types: make(map[string]dwarf.Offset),
+		RuntimeTypes: make(map[uint64]dwarf.Offset), funcIndex: make(map[string]*CompileUnit),
+		fileIndex: make(map[string][]*CompileUnit), functionsByName: make(map[string]*Function),
+		suffixIndex: make(map[string][]string), file: file, strings: newStringTable()}
+	bi.Checksum = sha256.Sum256(file.data)
+	bi.modTime, bi.size, bi.buildID = file.modTime, int64(len(file.data)), buildID(file)
+	bi.loadSections(file)
+	cached := false
+	if noDwarf {
+		if err = bi.loadSymbolTable(file); err != nil {
+			return nil, err
+		}
+		if err = bi.parseEhFrameSection(file); err != nil {
+			return nil, err
+		}
+	} else {
+		if dwarfData, err = file.dwarf(); err != nil {
+			return nil, err
+		}
+		bi.DwarfData = dwarfData
+		// the index cached of the same binary skips reading the headers of the units and the symbols
+		cached = indexCache && bi.loadIndexCache(execfile, file)
+		if !cached {
+			if err = bi.ParseLineAndInfoSection(ctx, dwarfData, progress); err != nil {
+				return nil, err
+			}
+		} else if progress != nil {
+			progress(len(bi.CompileUnits), len(bi.CompileUnits))
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err = bi.ParseFrameSection(file); err != nil {
+			return nil, err
+		}
+	}
+	// the arguments in the registers are described by the location lists, which are read by locLists
+	bi.LocListsV5 = file.hasSection(".debug_loclists") || file.hasSection(".zdebug_loclists")
+	if bi.DebugAddr, err = file.section(".debug_addr"); err != nil {
+		return nil, err
 	}
-	if lineSection == nil {
-		return nil, errors.New("Can't not find .debug_line or .zdebug_line")
+	// the programs without the symbol table can't tell the types of interfaces, TypesAddr is in the cached index
+	if !cached {
+		var (
+			tlsg uint64
+			hasTlsg bool
+		)
+		if symbols, err := file.symbols(); err == nil {
+			for _, sym := range symbols {
+				switch sym.Name {
+				case "runtime.types":
+					bi.TypesAddr = sym.Value
+				case "runtime.buildVersion":
+					bi.buildVersion = readBuildVersion(file, sym.Value)
+				case "runtime.tlsg":
+					tlsg, hasTlsg = sym.Value, true
+				}
+			}
+			bi.indexSymbols(symbols)
+		}
+		bi.gOffset = tlsGOffset(file, tlsg, hasTlsg)
+		if indexCache && !noDwarf {
+			if err = bi.saveIndexCache(execfile, file); err != nil {
+				dwarfLogger.Warn("save index cache", zap.String("execfile", execfile), zap.Error(err))
+			}
+		}
 	}
-	// please note that Data() returns uncompressed data if compressed
-	if debugLineMapTableBytes, err = lineSection.Data(); err != nil{
+	bi.detectGoVersion()
+	if err = bi.checkGoVersion(); err != nil {
 		return nil, err
 	}
-	return debugLineMapTableBytes, nil
+
+	// debug frame log
+	if log.Tracing(dwarfLogger) {
+		for i, v := range bi.FramesInformation {
+			if v.CIE != nil {
+				log.Trace(dwarfLogger, "bi.frames", zap.Int("index", i), zap.Stringer("cie", v.CIE))
+			} else if v.FDE != nil {
+				log.Trace(dwarfLogger, "bi.frames", zap.Int("index", i), zap.Stringer("fde", v.FDE))
+			} else {
+				dwarfLogger.Error("find frame both cie/pde == nil")
+			}
+		}
+	}
+
+	dwarfLogger.Info("analyze", log.Event("analyze"), zap.String("execfile", execfile),
+		zap.Int("sources", len(bi.fileIndex)), zap.Int("compile_units", len(bi.CompileUnits)),
+		zap.Int("functions", len(bi.funcIndex)), zap.Stringer("go", bi.goVersion), zap.Bool("index_cache", cached),
+		zap.Bool("dwarf", !noDwarf), log.Duration(time.Since(start)))
+	if noDwarf {
+		printNoDwarf(execfile)
+	}
+	return bi, nil
+}
+
+// checkDebugSection tells whether there is .debug_name or .zdebug_name, the data is not read
+func checkDebugSection(file *mappedFile, name string) error {
+	if !file.hasSection(".debug_" + name) && !file.hasSection(".zdebug_" + name) {
+		return fmt.Errorf("Can't not find .debug_%s or .zdebug_%s", name, name)
+	}
+	return nil
+}
+
+// locLists returns .debug_loclists, or .debug_loc of the older versions, which is inflated on the first use
+func (bi *BI)locLists() []byte {
+	if bi.LocLists == nil && bi.file != nil {
+		name := ".debug_loc"
+		if bi.LocListsV5 {
+			name = ".debug_loclists"
+		}
+		data, err := bi.file.section(name)
+		logLoadErr(err)
+		bi.LocLists = data
+	}
+	return bi.LocLists
 }
 
-func (bi *BI)ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
+// ParseLineAndInfoSection records the compile units with their ranges and the files of their line tables only,
+// the children and the line table of a unit are parsed when it is used first. The headers of the units are read
+// by parseUnits, which stops when ctx is done
+func (bi *BI)ParseLineAndInfoSection(ctx context.Context, dwarfData *dwarf.Data, progress loadProgress) error {
 	var (
 		curEntry *dwarf.Entry
 		curCompileUnit *CompileUnit
-		curFunction *Function
 		err error
-		ranges [][2]uint64
-		lineReader *dwarf.LineReader
-		lineEntry *dwarf.LineEntry
-		curSubProgramEntry *dwarf.Entry
-		curCompileUnitEntry *dwarf.Entry
 		dwarfReader *dwarf.Reader
+		trace = log.Tracing(dwarfLogger)
+		skipped = make(map[dwarf.Tag]int)
 	)
 	dwarfReader = dwarfData.Reader()
 	for {
@@ -155,71 +412,388 @@ func (bi *BI)ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 		if curEntry == nil {
 			break
 		}
+		// the partial units are parsed with the units importing them, the others like the type units are skipped
+		if curEntry.Tag != dwarf.TagCompileUnit {
+			skipped[curEntry.Tag]++
+			dwarfReader.SkipChildren()
+			continue
+		}
 
+		curCompileUnit = newCompileUnit(curEntry)
+		bi.CompileUnits = append(bi.CompileUnits, curCompileUnit)
 
-		if curEntry.Tag == dwarf.TagCompileUnit {
-			curCompileUnit = &CompileUnit{}
-			bi.CompileUnits = append(bi.CompileUnits, curCompileUnit)
+		if trace {
+			traceEntry("TagCompileUnit", curEntry)
+		}
+		dwarfReader.SkipChildren()
+	}
+	for tag, n := range skipped {
+		if tag == dwarf.TagPartialUnit {
+			dwarfLogger.Debug("partial units", zap.Int("count", n))
+		} else {
+			dwarfLogger.Warn("skip the units", zap.String("tag", tag.String()), zap.Int("count", n))
+		}
+	}
 
-			fields := curEntry.Field
-			logger.Debug("|================= START ===========================|")
-			for _, field := range fields {
-				// for debug log
-				logger.Debug("TagCompileUnit",
-					zap.String("Attr", field.Attr.String()),
-					zap.String("Val", fmt.Sprintf("%v", field.Val)),
-					zap.String("Class", fmt.Sprintf("%s", field.Class)))
+	// each unit writes its own ranges and files only
+	files := make([][]string, len(bi.CompileUnits))
+	err = parseUnits(ctx, len(bi.CompileUnits), progress, func(i int) error {
+		var err error
+		cu := bi.CompileUnits[i]
+		// LowPc(Attr) + Ranges(Attr) = HighPc, (* Data)Ranges return [LowPc, HightPc]
+		if cu.ranges, err = dwarfData.Ranges(cu.entry); err != nil {
+			return err
+		}
+		// the header of the line table has the files, the rows are read by loadLineTable
+		lineReader, err := dwarfData.LineReader(cu.entry)
+		if err != nil || lineReader == nil {
+			return err
+		}
+		for _, file := range lineReader.Files() {
+			if file != nil {
+				files[i] = append(files[i], file.Name)
 			}
-			logger.Debug("|================== END ============================|")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	bi.indexUnits(files)
+	return nil
+}
 
-			// LowPc(Attr) + Ranges(Attr) = HighPc, (* Data)Ranges return [LowPc, HightPc]
-			/*if ranges, err = dwarfData.Ranges(curEntry); err != nil {
-				return nil, err
-			}
+func newCompileUnit(entry *dwarf.Entry) *CompileUnit {
+	cu := &CompileUnit{entry: entry}
+	cu.name, _ = entry.Val(dwarf.AttrName).(string)
+	cu.lowpc, _ = entry.Val(dwarf.AttrLowpc).(uint64)
+	if addrBase, ok := entry.Val(dwarf.AttrAddrBase).(int64); ok {
+		cu.addrBase = uint64(addrBase)
+	}
+	cu.language, _ = entry.Val(dwarf.AttrLanguage).(int64)
+	producer, _ := entry.Val(dwarf.AttrProducer).(string)
+	cu.optimized = optimizedProducer(producer)
+	return cu
+}
 
-			if ranges != nil && len(ranges) >= 1{
-				lowPc := ranges[0][0]
-				hightPc := ranges[0][1]
+// optimizedProducer tells whether the flags in DW_AT_producer optimize the code, like `Go cmd/compile go1.22.3;
+// regabi` without -N, or `GNU C17 12.2.0 -g -O2` recorded by -grecord-gcc-switches. The producers without the
+// flags are not
+func optimizedProducer(producer string) bool {
+	if strings.HasPrefix(producer, "Go cmd/compile ") {
+		i := strings.Index(producer, ";")
+		if i < 0 {
+			return true
+		}
+		for _, flag := range strings.Fields(producer[i+1:]) {
+			if flag == "-N" {
+				return false
 			}
-			*/
-			_ = ranges
+		}
+		return true
+	}
+	optimized := false
+	for _, flag := range strings.Fields(producer) {
+		if strings.HasPrefix(flag, "-O") {
+			optimized = flag != "-O0"
+		}
+	}
+	return optimized
+}
 
+// DW_LANG_Go is the DW_AT_language of the units of go
+const DW_LANG_Go = 0x16
 
-			if lineReader, err = dwarfData.LineReader(curEntry); err != nil {
-				return err
+// isGo tells whether cu is written in go, the unit without DW_AT_language is taken as go like the old linkers
+func (cu *CompileUnit) isGo() bool {
+	return cu.language == 0 || cu.language == DW_LANG_Go
+}
+
+// indexUnits indexes the compile units by the files of their line tables, files[i] of the unit i, and by the ranges
+func (bi *BI)indexUnits(files [][]string) {
+	for i, cu := range bi.CompileUnits {
+		for _, file := range files[i] {
+			file = bi.strings.intern(file)
+			units := bi.fileIndex[file]
+			if len(units) == 0 || units[len(units) - 1] != cu {
+				bi.fileIndex[file] = append(units, cu)
+			}
+		}
+		for _, r := range cu.ranges {
+			bi.unitRanges = append(bi.unitRanges, unitRange{lowpc: r[0], highpc: r[1], cu: cu})
+		}
+	}
+	sort.Slice(bi.unitRanges, func(i, j int) bool { return bi.unitRanges[i].lowpc < bi.unitRanges[j].lowpc })
+	bi.indexSources()
+}
+
+// indexSources sorts the files of the line tables and indexes them by the suffixes after the slashes,
+// `/a/b/c.go` is found by `c.go`, `b/c.go` and `a/b/c.go`
+func (bi *BI)indexSources() {
+	bi.files = make([]string, 0, len(bi.fileIndex))
+	for file := range bi.fileIndex {
+		bi.files = append(bi.files, file)
+	}
+	sort.Strings(bi.files)
+	for _, file := range bi.files {
+		for i := len(file) - 2; i >= 0; i-- {
+			if file[i] == '/' {
+				bi.suffixIndex[file[i + 1:]] = append(bi.suffixIndex[file[i + 1:]], file)
 			}
-			lineEntry = &dwarf.LineEntry{}
-			cuname, _ := curEntry.Val(dwarf.AttrName).(string)
+		}
+	}
+}
+
+// sourcesWithSuffix returns the files ending with `/` and suffix in order
+func (bi *BI)sourcesWithSuffix(suffix string) []string {
+	return bi.suffixIndex[suffix]
+}
+
+// parseUnits calls parse with 0 to n-1 in GOMAXPROCS goroutines, parse of a unit must not change what the others
+// read. The first error by the order is returned, or the error of ctx if it is done before all of them are parsed.
+// progress is told the units parsed under mu, so it is called in order
+func parseUnits(ctx context.Context, n int, progress loadProgress, parse func(i int) error) error {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		next = int64(-1)
+		done = 0
+		errs = make([]error, n)
+		workers = runtime.GOMAXPROCS(0)
+	)
+	if workers > n {
+		workers = n
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 			for {
-				if err = lineReader.Next(lineEntry); err != nil && err != io.EOF{
-					return err
+				if ctx.Err() != nil {
+					return
 				}
-				if err == io.EOF {
-					err = nil
-					break
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
 				}
-				logger.Debug("cu:" + cuname, zap.Any("lineEntry", lineEntry))
-				if lineEntry.File != nil {
-					if bi.Sources[lineEntry.File.Name] == nil {
-						bi.Sources[lineEntry.File.Name] = make(map[int][]*dwarf.LineEntry)
-					}
-					copyLineEntry := &dwarf.LineEntry{}
-					*copyLineEntry = *lineEntry
-					bi.Sources[lineEntry.File.Name][lineEntry.Line] = append(bi.Sources[lineEntry.File.Name][lineEntry.Line], copyLineEntry)
+				errs[i] = parse(i)
+				if progress != nil {
+					mu.Lock()
+					done++
+					progress(done, n)
+					mu.Unlock()
 				}
 			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexSymbols finds the compile units of the functions in the symbol table by their addresses
+func (bi *BI)indexSymbols(symbols []elf.Symbol) {
+	for _, sym := range symbols {
+		if elf.ST_TYPE(sym.Info) != elf.STT_FUNC {
+			continue
+		}
+		if cu := bi.compileUnitIncludePc(sym.Value); cu != nil {
+			name := bi.strings.intern(sym.Name)
+			if _, ok := bi.funcIndex[name]; !ok {
+				bi.funcNames = append(bi.funcNames, name)
+			}
+			bi.funcIndex[name] = cu
+		}
+	}
+	sort.Strings(bi.funcNames)
+}
+
+// compileUnitIncludePc returns the compile unit whose ranges have pc, nil if there is none
+func (bi *BI)compileUnitIncludePc(pc uint64) *CompileUnit {
+	i := sort.Search(len(bi.unitRanges), func(i int) bool { return bi.unitRanges[i].lowpc > pc }) - 1
+	if i >= 0 && pc < bi.unitRanges[i].highpc {
+		return bi.unitRanges[i].cu
+	}
+	return nil
+}
+
+// parsedUnit is what parseCompileUnit finds in the children of a compile unit, it is merged into BI by
+// loadCompileUnit or loadAll
+type parsedUnit struct {
+	functions []*Function
+	packageVars []*PackageVar
+	// types keeps the first offset of a name like BI.Types
+	types map[string]dwarf.Offset
+	runtimeTypes map[uint64]dwarf.Offset
+}
+
+// loadCompileUnit parses the functions, the variables and the types in the children of cu once, the unit failing
+// to parse is parsed again by the next lookup
+func (bi *BI)loadCompileUnit(cu *CompileUnit) error {
+	bi.touch(cu)
+	if cu.loaded {
+		return nil
+	}
+	unit, err := parseCompileUnit(bi.DwarfData, cu)
+	if err != nil {
+		return err
+	}
+	bi.mergeCompileUnit(cu, unit)
+	cu.loaded = true
+	bi.trimUnits(cu)
+	return nil
+}
+
+func (bi *BI)mergeCompileUnit(cu *CompileUnit, unit *parsedUnit) {
+	// the first one of a name is found like the order of .debug_info
+	for _, f := range unit.functions {
+		f.name = bi.strings.intern(f.name)
+		if _, ok := bi.functionsByName[f.name]; !ok && f.name != "" {
+			bi.functionsByName[f.name] = f
+		}
+	}
+	sort.SliceStable(unit.functions, func(i, j int) bool { return unit.functions[i].lowpc < unit.functions[j].lowpc })
+	cu.functions = unit.functions
+	bi.Functions = mergeFunctions(bi.Functions, unit.functions)
+	for _, pv := range unit.packageVars {
+		pv.name = bi.strings.intern(pv.name)
+		bi.PackageVars[pv.name] = pv
+	}
+	cu.packageVars = unit.packageVars
+	cu.unitSize = unit.size()
+	bi.resident += cu.unitSize
+	for name, off := range unit.types {
+		if _, ok := bi.Types[name]; !ok {
+			bi.Types[name] = off
+		}
+	}
+	for typ, off := range unit.runtimeTypes {
+		bi.RuntimeTypes[typ] = off
+	}
+}
+
+// traceEntry logs the attributes of the entry at TraceLevel, the values are formatted only when they are written
+func traceEntry(tag string, entry *dwarf.Entry) {
+	log.Trace(dwarfLogger, "|================= START ===========================|")
+	for _, field := range entry.Field {
+		log.Trace(dwarfLogger, tag, zap.Stringer("Attr", field.Attr), zap.Any("Val", field.Val),
+			zap.Stringer("Class", field.Class))
+	}
+	log.Trace(dwarfLogger, "|================== END ============================|")
+}
+
+// parseCompileUnit reads the children of cu by its own reader, it changes nothing but the result so the units
+// are parsed at the same time. The partial units imported by DW_TAG_imported_unit, like the ones of dwz or gcc
+// for the C objects, are parsed as the children of cu, each of them once
+func parseCompileUnit(dwarfData *dwarf.Data, cu *CompileUnit) (*parsedUnit, error) {
+	var (
+		unit = &parsedUnit{types: make(map[string]dwarf.Offset), runtimeTypes: make(map[uint64]dwarf.Offset)}
+		pending = []dwarf.Offset{cu.entry.Offset}
+		parsed = map[dwarf.Offset]bool{cu.entry.Offset: true}
+	)
+	for len(pending) > 0 {
+		imports, err := parseUnitChildren(dwarfData, pending[0], cu, unit)
+		if err != nil {
+			return nil, err
+		}
+		pending = pending[1:]
+		for _, off := range imports {
+			if !parsed[off] {
+				parsed[off] = true
+				pending = append(pending, off)
+			}
+		}
+	}
+	return unit, nil
+}
 
-			curCompileUnitEntry = curEntry
+// parseUnitChildren adds the children of the unit at off to unit as the ones of cu, and returns the units they
+// import. The import which is not a partial unit is skipped with a warning
+func parseUnitChildren(dwarfData *dwarf.Data, off dwarf.Offset, cu *CompileUnit, unit *parsedUnit) ([]dwarf.Offset, error) {
+	var (
+		curEntry *dwarf.Entry
+		curFunction *Function
+		// functionDepth is the depth of curFunction, the entries deeper than it are in its body
+		functionDepth int
+		err error
+		dwarfReader = dwarfData.Reader()
+		imports []dwarf.Offset
+		// the tags of the entries whose children are being read, and the lexical blocks among them
+		parents = []dwarf.Tag{dwarf.TagCompileUnit}
+		blocks []*Scope
+		trace = log.Tracing(dwarfLogger)
+	)
+	// the unit itself is read by ParseLineAndInfoSection already
+	dwarfReader.Seek(off)
+	curEntry, err = dwarfReader.Next()
+	if off != cu.entry.Offset && (err != nil || curEntry == nil || curEntry.Offset != off ||
+		curEntry.Tag != dwarf.TagPartialUnit) {
+		dwarfLogger.Warn("skip the import which is not a partial unit", zap.String("cu", cu.name),
+			zap.Uint32("offset", uint32(off)), zap.Error(err))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !curEntry.Children {
+		return nil, nil
+	}
+	parents[0] = curEntry.Tag
+	for len(parents) > 0 {
+		if curEntry, err = dwarfReader.Next(); err != nil{
+			return nil, err
+		}
+		if curEntry == nil {
+			break
+		}
+		// the entry of tag 0 ends the children
+		if curEntry.Tag == 0 {
+			if n := len(parents); n > 0 {
+				if parents[n - 1] == dwarf.TagLexDwarfBlock {
+					blocks = blocks[:len(blocks) - 1]
+				}
+				parents = parents[:n - 1]
+			}
+			continue
+		}
+		if curEntry.Tag == dwarf.TagImportedUnit {
+			if imported, ok := curEntry.Val(dwarf.AttrImport).(dwarf.Offset); ok {
+				imports = append(imports, imported)
+			}
+		}
+		depth := len(parents)
+		if depth <= functionDepth {
+			curFunction = nil
+		}
+		if curEntry.Children {
+			parents = append(parents, curEntry.Tag)
+			if curEntry.Tag == dwarf.TagLexDwarfBlock {
+				blockRanges, _ := dwarfData.Ranges(curEntry)
+				blocks = append(blocks, &Scope{ranges: blockRanges, depth: len(blocks) + 1})
+			}
 		}
 
 		if curEntry.Tag == dwarf.TagSubprogram {
+			// the declarations and the abstract instances of the inlined functions have no code, the children of
+			// them are not the variables of any function
+			if !hasCode(curEntry) {
+				curFunction = nil
+				continue
+			}
 			curFunction = &Function{}
-			curCompileUnit.functions = append(curCompileUnit.functions, curFunction)
-			curFunction.cu = curCompileUnit
-			bi.Functions = append(bi.Functions, curFunction)
+			functionDepth = depth
+			curFunction.cu = cu
+			curFunction.optimized = cu.optimized
 
 			fields := curEntry.Field
-			logger.Debug("|================= START ===========================|")
+			highpcOffset := int64(-1)
 			for _, field := range fields {
 				switch field.Attr {
 				case dwarf.AttrName:
@@ -231,8 +805,12 @@ func (bi *BI)ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 						curFunction.lowpc = val
 					}
 				case dwarf.AttrHighpc:
-					if val, ok := field.Val.(uint64); ok {
+					// class address is the pc itself, since dwarf4 class constant is the offset from lowpc
+					switch val := field.Val.(type) {
+					case uint64:
 						curFunction.highpc = val
+					case int64:
+						highpcOffset = val
 					}
 				case dwarf.AttrFrameBase:
 					if val, ok := field.Val.([]byte); ok {
@@ -246,18 +824,30 @@ func (bi *BI)ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 					if val, ok := field.Val.(bool); ok {
 						curFunction.external = val
 					}
-				default:
-					logger.Debug("analyze:TagSubprogram unknow attr", zap.Any("field",field))
 				}
-				// for debug log
-				logger.Debug("TagSubprogram",
-					zap.String("Attr", field.Attr.String()),
-					zap.String("Val", fmt.Sprintf("%v", field.Val)),
-					zap.String("Class", fmt.Sprintf("%s", field.Class)))
 			}
-			logger.Debug("|================== END ============================|")
-
-			curSubProgramEntry = curEntry
+			if trace {
+				traceEntry("TagSubprogram", curEntry)
+			}
+			if highpcOffset >= 0 {
+				curFunction.highpc = curFunction.lowpc + uint64(highpcOffset)
+			}
+			if _, ok := curEntry.Val(dwarf.AttrLowpc).(uint64); !ok {
+				// gcc puts the code of DW_AT_ranges out of order, the first range is where it is entered
+				if ranges, err := dwarfData.Ranges(curEntry); err == nil && len(ranges) > 0 {
+					curFunction.lowpc, curFunction.highpc = ranges[0][0], ranges[0][1]
+				}
+			}
+			if curFunction.name == "" {
+				curFunction.name = originName(dwarfData, curEntry)
+			}
+			if curFunction.highpc <= curFunction.lowpc {
+				dwarfLogger.Debug("skip the function without code", zap.String("cu", cu.name),
+					zap.String("function", curFunction.name), zap.Uint32("offset", uint32(curEntry.Offset)))
+				curFunction = nil
+				continue
+			}
+			unit.functions = append(unit.functions, curFunction)
 		}
 
 		/*curEntry.Tag == dwarf.TagArrayType ||
@@ -267,77 +857,488 @@ func (bi *BI)ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 		curEntry.Tag == dwarf.TagConstType ||
 		curEntry.Tag == dwarf.TagPointerType ||
 		curEntry.Tag == dwarf.TagStringType */
-		if	curEntry.Tag == dwarf.TagVariable {
+		if typ, ok := curEntry.Val(AttrGoRuntimeType).(uint64); ok {
+			unit.runtimeTypes[typ] = curEntry.Offset
+		}
+		if curEntry.Tag == dwarf.TagStructType || curEntry.Tag == dwarf.TagTypedef || curEntry.Tag == dwarf.TagBaseType {
+			if name, ok := curEntry.Val(dwarf.AttrName).(string); ok {
+				if _, ok = unit.types[name]; !ok {
+					unit.types[name] = curEntry.Offset
+				}
+			}
+		}
+
+		// the package variables are at the addresses of DW_OP_addr, the static variables of C in the functions are
+		// their locals
+		if location, ok := curEntry.Val(dwarf.AttrLocation).([]byte); ok && curEntry.Tag == dwarf.TagVariable &&
+			depth == 1 && len(location) == 9 && location[0] == DW_OP_addr {
+			name, _ := curEntry.Val(dwarf.AttrName).(string)
+			addr := binary.LittleEndian.Uint64(location[1:])
+			unit.packageVars = append(unit.packageVars, &PackageVar{name: name, addr: addr, entry: curEntry})
+			continue
+		}
+
+		if	curFunction != nil && (curEntry.Tag == dwarf.TagVariable || curEntry.Tag == dwarf.TagFormalParameter) {
 			curFunction.variables = append(curFunction.variables, curEntry)
-			logger.Debug("|================= START ===========================|")
-			fields := curEntry.Field
-			for _, field := range fields {
-				logger.Debug(curEntry.Tag.GoString(),
-					zap.String("Attr", field.Attr.String()),
-					zap.String("Val", fmt.Sprintf("%v", field.Val)),
-					zap.String("Class", fmt.Sprintf("%s", field.Class)))
+			if len(blocks) > 0 {
+				if curFunction.scopes == nil {
+					curFunction.scopes = make(map[dwarf.Offset]*Scope)
+				}
+				curFunction.scopes[curEntry.Offset] = blocks[len(blocks) - 1]
+			}
+			if trace {
+				traceEntry(curEntry.Tag.GoString(), curEntry)
 			}
-			logger.Debug("|================== END ============================|")
 		}
 	}
+	return imports, nil
+}
 
-	_ = curSubProgramEntry
-	_ = curCompileUnitEntry
+// hasCode tells whether the subprogram is the code of a function, not a declaration or an abstract instance
+func hasCode(entry *dwarf.Entry) bool {
+	if declaration, _ := entry.Val(dwarf.AttrDeclaration).(bool); declaration {
+		return false
+	}
+	return entry.Val(dwarf.AttrLowpc) != nil || entry.Val(dwarf.AttrRanges) != nil
+}
+
+// originName is the name of the subprogram without DW_AT_name, which is on its abstract origin or its declaration
+func originName(dwarfData *dwarf.Data, entry *dwarf.Entry) string {
+	r := dwarfData.Reader()
+	for i := 0; i < 4 && entry != nil; i++ {
+		if name, ok := entry.Val(dwarf.AttrName).(string); ok {
+			return name
+		}
+		off, ok := entry.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if off, ok = entry.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				return ""
+			}
+		}
+		r.Seek(off)
+		if entry, _ = r.Next(); entry == nil || entry.Offset != off {
+			return ""
+		}
+	}
+	return ""
+}
+
+// loadLineTable adds the rows of the line table of cu to Sources and Statements once, like loadCompileUnit
+func (bi *BI)loadLineTable(cu *CompileUnit) error {
+	bi.touch(cu)
+	if cu.linesLoaded {
+		return nil
+	}
+	lineEntries, err := parseLineTable(bi.DwarfData, cu)
+	if err != nil {
+		return err
+	}
+	bi.mergeLineTable(cu, lineEntries)
+	cu.linesLoaded = true
+	bi.trimUnits(cu)
 	return nil
 }
 
-// not considered inline function
-func (bi *BI)findFunctionIncludePc(pc uint64) (*Function, error) {
-	for _, f := range bi.Functions {
-		if f.lowpc <= pc && pc < f.highpc {
-			return f, nil
+// mergeFunctions merges the functions a and b sorted by lowpc, the ones of a are before the ones of b with the same lowpc
+func mergeFunctions(a []*Function, b []*Function) []*Function {
+	merged := make([]*Function, 0, len(a) + len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if b[0].lowpc < a[0].lowpc {
+			merged, b = append(merged, b[0]), b[1:]
+		} else {
+			merged, a = append(merged, a[0]), a[1:]
 		}
 	}
-	return nil, &NotFoundFuncErr{pc: pc}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+func (bi *BI)mergeLineTable(cu *CompileUnit, lineEntries []*dwarf.LineEntry) {
+	// the rows share the files of their line table, each file is interned once
+	var file *dwarf.LineFile
+	for _, lineEntry := range lineEntries {
+		if lineEntry.File != file {
+			file = lineEntry.File
+			file.Name = bi.strings.intern(file.Name)
+		}
+		if bi.Sources[lineEntry.File.Name] == nil {
+			bi.Sources[lineEntry.File.Name] = make(map[int][]*dwarf.LineEntry)
+		}
+		bi.Sources[lineEntry.File.Name][lineEntry.Line] = append(bi.Sources[lineEntry.File.Name][lineEntry.Line], lineEntry)
+		if _, ok := bi.Statements[lineEntry.Address]; lineEntry.IsStmt && !ok {
+			bi.Statements[lineEntry.Address] = lineEntry
+		}
+	}
+	sort.SliceStable(lineEntries, func(i, j int) bool { return lineEntries[i].Address < lineEntries[j].Address })
+	cu.lines = lineEntries
+	cu.linesSize = linesSize(lineEntries)
+	bi.resident += cu.linesSize
 }
 
-func (bi *BI)ParseFrameSection(elffile *elf.File) error {
+// parseLineTable returns the rows of the line table of cu which have the files, in order
+func parseLineTable(dwarfData *dwarf.Data, cu *CompileUnit) ([]*dwarf.LineEntry, error) {
 	var (
 		err error
-		frameSection *elf.Section
-		frameData []byte
-		frameInfo *VirtualUnwindFrameInformation
+		lineReader *dwarf.LineReader
+		lineEntry = &dwarf.LineEntry{}
+		lineEntries []*dwarf.LineEntry
+		trace = log.Tracing(dwarfLogger)
 	)
-	frameSection = elffile.Section(".debug_frame")
-	if frameSection == nil {
-		frameSection = elffile.Section(".zdebug_frame")
-		sectionData := func(s *elf.Section) ([]byte, error) {
-			b, err := s.Data()
-			if err != nil && uint64(len(b)) < s.Size {
-				return nil, err
+	// the compile unit has no DW_AT_stmt_list, so there is no line table to record
+	if lineReader, err = dwarfData.LineReader(cu.entry); err != nil || lineReader == nil {
+		return nil, err
+	}
+	for {
+		if err = lineReader.Next(lineEntry); err != nil && err != io.EOF{
+			return nil, err
+		}
+		if err == io.EOF {
+			break
+		}
+		if trace {
+			log.Trace(dwarfLogger, "cu:" + cu.name, zap.Any("lineEntry", lineEntry))
+		}
+		if lineEntry.File != nil {
+			copyLineEntry := &dwarf.LineEntry{}
+			*copyLineEntry = *lineEntry
+			lineEntries = append(lineEntries, copyLineEntry)
+		}
+	}
+	return lineEntries, nil
+}
+
+// loadCompileUnitIncludePc parses the children and the line table of the compile unit of pc
+func (bi *BI)loadCompileUnitIncludePc(pc uint64) (*CompileUnit, error) {
+	cu := bi.compileUnitIncludePc(pc)
+	if cu == nil {
+		return nil, nil
+	}
+	if err := bi.loadCompileUnit(cu); err != nil {
+		return nil, err
+	}
+	return cu, bi.loadLineTable(cu)
+}
+
+// loadAll parses every compile unit, for the ones iterating all the functions or the package variables.
+// The units not loaded yet are parsed by parseUnits, then merged by the order of the units. They are beyond
+// dwarfBudget until the next unit is loaded, so the callers see all of them
+func (bi *BI)loadAll() error {
+	var (
+		units = make([]*parsedUnit, len(bi.CompileUnits))
+		lines = make([][]*dwarf.LineEntry, len(bi.CompileUnits))
+	)
+	err := parseUnits(context.Background(), len(bi.CompileUnits), nil, func(i int) error {
+		var err error
+		cu := bi.CompileUnits[i]
+		if !cu.loaded {
+			if units[i], err = parseCompileUnit(bi.DwarfData, cu); err != nil {
+				return err
 			}
+		}
+		if !cu.linesLoaded {
+			lines[i], err = parseLineTable(bi.DwarfData, cu)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for i, cu := range bi.CompileUnits {
+		if !cu.loaded {
+			bi.mergeCompileUnit(cu, units[i])
+			cu.loaded = true
+		}
+		if !cu.linesLoaded {
+			bi.mergeLineTable(cu, lines[i])
+			cu.linesLoaded = true
+		}
+	}
+	return nil
+}
 
-			if len(b) >= 12 && string(b[:4]) == "ZLIB" {
-				dlen := binary.BigEndian.Uint64(b[4:12])
-				dbuf := make([]byte, dlen)
-				r, err := zlib.NewReader(bytes.NewBuffer(b[12:]))
-				if err != nil {
-					return nil, err
-				}
-				if _, err := io.ReadFull(r, dbuf); err != nil {
-					return nil, err
-				}
-				if err := r.Close(); err != nil {
-					return nil, err
+// logLoadErr logs the error of the lazy loading where the lookup can't return it
+func logLoadErr(err error) {
+	if err != nil {
+		dwarfLogger.Error("load compile unit", zap.Error(err))
+	}
+}
+
+// lineEntries returns the line entries of filename by the lines, the line tables having it are loaded first.
+// mu is held, the lines may grow once it is released
+func (bi *BI)lineEntries(filename string) map[int][]*dwarf.LineEntry {
+	for _, cu := range bi.fileIndex[filename] {
+		logLoadErr(bi.loadLineTable(cu))
+	}
+	return bi.Sources[filename]
+}
+
+// sourceFiles returns the files of all the line tables in order, which are known without loading them
+func (bi *BI)sourceFiles() []string {
+	return bi.files
+}
+
+// statement returns the line entry beginning a statement at pc
+func (bi *BI)statement(pc uint64) (*dwarf.LineEntry, bool) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if bi.symTable != nil {
+		return bi.symbolStatement(pc)
+	}
+	if _, err := bi.loadCompileUnitIncludePc(pc); err != nil {
+		logLoadErr(err)
+	}
+	lineEntry, ok := bi.Statements[pc]
+	return lineEntry, ok
+}
+
+// packageVar returns the package variable name like `runtime.allgs`, which is in the compile unit of its package
+func (bi *BI)packageVar(name string) (*PackageVar, bool) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if pv, ok := bi.PackageVars[name]; ok {
+		return pv, true
+	}
+	pkg := packageName(name)
+	for _, cu := range bi.CompileUnits {
+		if cu.name == pkg {
+			logLoadErr(bi.loadCompileUnit(cu))
+		}
+	}
+	pv, ok := bi.PackageVars[name]
+	return pv, ok
+}
+
+// typeOffset returns the named type like `runtime.g`, the compile units are loaded in order until it is found
+func (bi *BI)typeOffset(name string) (dwarf.Offset, bool) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	off, ok := bi.Types[name]
+	for _, cu := range bi.CompileUnits {
+		if ok {
+			break
+		}
+		if !cu.loaded {
+			logLoadErr(bi.loadCompileUnit(cu))
+			off, ok = bi.Types[name]
+		}
+	}
+	return off, ok
+}
+
+// runtimeTypeOffset returns the type whose runtime._type is at typ from TypesAddr, like typeOffset
+func (bi *BI)runtimeTypeOffset(typ uint64) (dwarf.Offset, bool) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	off, ok := bi.RuntimeTypes[typ]
+	for _, cu := range bi.CompileUnits {
+		if ok {
+			break
+		}
+		if !cu.loaded {
+			logLoadErr(bi.loadCompileUnit(cu))
+			off, ok = bi.RuntimeTypes[typ]
+		}
+	}
+	return off, ok
+}
+
+// dwarfType reads the type at off, DwarfData caches the types read without a lock
+func (bi *BI)dwarfType(off dwarf.Offset) (dwarf.Type, error) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if err := bi.requireDwarf("the types"); err != nil {
+		return nil, err
+	}
+	return bi.DwarfData.Type(off)
+}
+
+// packageVarNames loads all the compile units and returns the names of the package variables in order
+func (bi *BI)packageVarNames() ([]string, error) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if err := bi.loadAll(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(bi.PackageVars))
+	for name := range bi.PackageVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// compileUnitFunctions loads cu and returns its functions sorted by lowpc
+func (bi *BI)compileUnitFunctions(cu *CompileUnit) ([]*Function, error) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if err := bi.loadCompileUnit(cu); err != nil {
+		return nil, err
+	}
+	return cu.functions, nil
+}
+
+// functionNames returns the names of the functions in order, they are in the symbol table without loading
+// the compile units, which are loaded only if there is no symbol table
+func (bi *BI)functionNames() []string {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if len(bi.funcIndex) > 0 {
+		return bi.funcNames
+	}
+	logLoadErr(bi.loadAll())
+	names := make([]string, 0, len(bi.functionsByName))
+	for name := range bi.functionsByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// optimizedFunction tells whether the function name is optimized, by its compile unit if it is not loaded yet
+func (bi *BI)optimizedFunction(name string) bool {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if f, ok := bi.functionsByName[name]; ok {
+		return f.optimized
+	}
+	if cu, ok := bi.funcIndex[name]; ok {
+		return cu.optimized
+	}
+	return false
+}
+
+// not considered inline function
+func (bi *BI)findFunctionIncludePc(pc uint64) (*Function, error) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	cu, err := bi.loadCompileUnitIncludePc(pc)
+	if err != nil {
+		return nil, err
+	}
+	if cu != nil {
+		functions := cu.functions
+		i := sort.Search(len(functions), func(i int) bool { return functions[i].lowpc > pc }) - 1
+		if i >= 0 && pc < functions[i].highpc {
+			return functions[i], nil
+		}
+	}
+	return nil, &NotFoundFuncErr{pc: pc}
+}
+
+// findFunctionByName loads the compile unit of name in the symbol table, all of them without the symbol table
+func (bi *BI)findFunctionByName(name string) (*Function, error) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if f, ok := bi.functionsByName[name]; ok {
+		bi.touch(f.cu)
+		return f, nil
+	}
+	if cu, ok := bi.funcIndex[name]; ok {
+		if err := bi.loadCompileUnit(cu); err != nil {
+			return nil, err
+		}
+	} else if len(bi.funcIndex) == 0 {
+		if err := bi.loadAll(); err != nil {
+			return nil, err
+		}
+	}
+	if f, ok := bi.functionsByName[name]; ok {
+		return f, nil
+	}
+	return nil, &NotFoundFuncNameErr{name: name}
+}
+
+// allPCsBetween returns the pcs of the statements in [begin, end) in order, except the ones of filename:lineno
+func (bi *BI)allPCsBetween(begin uint64, end uint64, filename string, lineno int) []uint64 {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	pcs := make([]uint64, 0)
+	if bi.symTable != nil {
+		if f, ok := bi.functionIncludePcLocked(begin); ok {
+			for _, lineEntry := range bi.symbolLinesOf(f) {
+				if lineEntry.Address >= begin && lineEntry.Address < end &&
+					(lineEntry.File.Name != filename || lineEntry.Line != lineno) {
+					pcs = append(pcs, lineEntry.Address)
 				}
-				b = dbuf
 			}
-			return b, nil
 		}
-		if frameData, err = sectionData(frameSection); err != nil {
-			return err
+		return pcs
+	}
+	cu, err := bi.loadCompileUnitIncludePc(begin)
+	if err != nil {
+		logLoadErr(err)
+	}
+	if cu == nil {
+		return pcs
+	}
+	// the rows of [begin, end) are found in the sorted rows of the unit, the statement of a pc is the one in
+	// Statements, the first of the rows at it
+	lines := cu.lines
+	for i := sort.Search(len(lines), func(i int) bool { return lines[i].Address >= begin }); i < len(lines) && lines[i].Address < end; i++ {
+		pc := lines[i].Address
+		if len(pcs) > 0 && pcs[len(pcs) - 1] == pc {
+			continue
 		}
-	} else {
-		if frameData, err = frameSection.Data(); err != nil {
-			return err
+		lineEntry, ok := bi.Statements[pc]
+		if !ok || (lineEntry.File.Name == filename && lineEntry.Line == lineno) {
+			continue
+		}
+		pcs = append(pcs, pc)
+	}
+	return pcs
+}
+
+// firstPcAfterPrologue returns the pc marked by prologue_end in the line table, the prologue checks
+// the stack and sets up the frame, so the arguments are not readable before it.
+// Without the mark, it is the first statement of another line than the entry
+func (bi *BI)firstPcAfterPrologue(f *Function) uint64 {
+	var (
+		prologueEnd uint64
+		stmt uint64
+	)
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	_, entryLine, _ := bi.pcTofileLineLocked(f.lowpc)
+	// the prologue of go is at the line of the declaration of the function
+	if bi.symTable != nil {
+		for _, lineEntry := range bi.symbolLinesOf(f) {
+			if lineEntry.Line != entryLine {
+				return lineEntry.Address
+			}
 		}
+		return f.lowpc
 	}
-	if frameSection == nil {
+	logLoadErr(bi.loadLineTable(f.cu))
+	// the rows of the function are in the line table of its unit, after the ones of the lower addresses
+	lines := f.cu.lines
+	for i := sort.Search(len(lines), func(i int) bool { return lines[i].Address > f.lowpc }); i < len(lines) && lines[i].Address < f.highpc; i++ {
+		lineEntry := lines[i]
+		if lineEntry.PrologueEnd && prologueEnd == 0 {
+			prologueEnd = lineEntry.Address
+		}
+		if lineEntry.IsStmt && lineEntry.Line != entryLine && stmt == 0 {
+			stmt = lineEntry.Address
+		}
+	}
+	if prologueEnd != 0 {
+		return prologueEnd
+	}
+	if stmt != 0 {
+		return stmt
+	}
+	return f.lowpc
+}
+
+func (bi *BI)ParseFrameSection(file *mappedFile) error {
+	var (
+		err error
+		frameData []byte
+		frameInfo *VirtualUnwindFrameInformation
+	)
+	if frameData, err = file.section(".debug_frame"); err != nil {
+		return err
+	}
+	if frameData == nil {
 		return errors.New("can'tt find the .debug_frame or .zdebug_frame")
 	}
 
@@ -361,10 +1362,64 @@ func (bi *BI)ParseFrameSection(elffile *elf.File) error {
 			frameInfo.FDE.CIE = curCIE
 		}
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	return bi.parseEhFrameSection(file)
+}
+
+// parseEhFrameSection adds the FDEs in .eh_frame of the functions not in .debug_frame, the go linker writes only
+// the go functions in .debug_frame and gcc writes the C ones of cgo and libgcc in .eh_frame
+func (bi *BI)parseEhFrameSection(file *mappedFile) error {
+	s := file.lookupSection(".eh_frame")
+	if s == nil {
+		return nil
+	}
+	data, err := file.section(".eh_frame")
+	if err != nil || data == nil {
+		return err
+	}
+	infos, err := parseEhFrame(data, s.addr)
+	if err != nil {
+		// the go functions are still unwound by .debug_frame
+		dwarfLogger.Warn("skip .eh_frame", zap.Error(err))
+		return nil
+	}
+	covered := make([][2]uint64, 0, len(bi.FramesInformation))
+	for _, frameInfo := range bi.FramesInformation {
+		if frameInfo.FDE != nil {
+			covered = append(covered, [2]uint64{frameInfo.FDE.begin, frameInfo.FDE.begin + frameInfo.FDE.size})
+		}
+	}
+	sort.Slice(covered, func(i, j int) bool { return covered[i][0] < covered[j][0] })
+	for _, frameInfo := range infos {
+		if fde := frameInfo.FDE; fde != nil {
+			if fde.size == 0 || overlapsRanges(covered, fde.begin, fde.begin + fde.size) {
+				continue
+			}
+		}
+		bi.FramesInformation = append(bi.FramesInformation, frameInfo)
+	}
+	return nil
+}
+
+// overlapsRanges tells whether [begin, end) overlaps one of ranges, which are sorted and don't overlap each other.
+// The function beginning where another one ends is not in it
+func overlapsRanges(ranges [][2]uint64, begin uint64, end uint64) bool {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i][0] >= end })
+	return i > 0 && ranges[i - 1][1] > begin
 }
 
 func (bi *BI) findFrameInformation (pc uint64) (*Frame, error) {
+	regs, err := getRegisters()
+	if err != nil {
+		return nil, err
+	}
+	return bi.unwindFrame(pc, regs.Rsp, regs.Rbp)
+}
+
+// unwindFrame executes the cfa instructions of the function at pc, whose rsp and rbp are given
+func (bi *BI) unwindFrame(pc uint64, rsp uint64, rbp uint64) (*Frame, error) {
 	var fde *FrameDescriptionEntry
 	for index, frameInfo := range bi.FramesInformation {
 		if frameInfo.FDE != nil {
@@ -374,7 +1429,7 @@ func (bi *BI) findFrameInformation (pc uint64) (*Frame, error) {
 				if fde == nil {
 					fde = frameInfo.FDE
 
-					logger.Debug("findFrameInfomation", zap.Int("index", index))
+					log.Trace(dwarfLogger, "findFrameInfomation", zap.Int("index", index))
 				} else {
 					return nil, fmt.Errorf("dumplicate fde")
 				}
@@ -382,6 +1437,9 @@ func (bi *BI) findFrameInformation (pc uint64) (*Frame, error) {
 		}
 	}
 	if fde == nil {
+		if bi.symTable != nil {
+			return bi.framePointerFrame(pc, rsp, rbp)
+		}
 		return nil, fmt.Errorf("not find the frame cover pc = %d", pc)
 	}
 
@@ -391,35 +1449,26 @@ func (bi *BI) findFrameInformation (pc uint64) (*Frame, error) {
 	}
 
 	frame := &Frame{cie: cie, cfa : &DWRule{}, regsRule: make(map[uint64]DWRule)}
-	logger.Debug("========================= cie start\n")
+	log.Trace(dwarfLogger, "========================= cie start\n")
 	if err := execCIEInstructions(frame, bytes.NewBuffer(cie.initial_instructions)); err != nil {
 		return nil, err
 	}
 	frame.loc = fde.begin
 	frame.address = pc
-	logger.Debug("========================= cie end\n")
+	log.Trace(dwarfLogger, "========================= cie end\n")
 
-	logger.Debug("========================= fde.instructions start \n")
+	log.Trace(dwarfLogger, "========================= fde.instructions start \n")
 	if err := execFDEInstructions(frame, bytes.NewBuffer(fde.instructions)); err != nil {
 		return nil, err
 	}
-	logger.Debug("========================= fde.instructions end \n")
-
-	var (
-		regs syscall.PtraceRegs
-		err error
-	)
-	if regs, err  = getRegisters(); err != nil {
-		return nil, err
-	}
+	log.Trace(dwarfLogger, "========================= fde.instructions end \n")
 
 	frame.regs = make([]uint64, 17)
-	frame.regs[16] = regs.PC()
-	frame.regs[7] = regs.Rsp
-	frame.regs[6] = regs.Rbp
+	frame.regs[16] = pc
+	frame.regs[7] = rsp
+	frame.regs[6] = rbp
 
-	logger.Debug("findFrameInformation",
-		zap.Any("regs", regs),
+	log.Trace(dwarfLogger, "findFrameInformation",
 		zap.Uint64("16", frame.regs[16]),
 		zap.Uint64("07", frame.regs[7]),
 		zap.Uint64("06", frame.regs[6]),
@@ -437,14 +1486,14 @@ func (bi *BI) findFrameInformation (pc uint64) (*Frame, error) {
 		reg := frame.regs[frame.cfa.reg]
 		framebase = reg + uint64(frame.cfa.offset)
 
-		logger.Debug("findFrameInformation",
+		log.Trace(dwarfLogger, "findFrameInformation",
 			zap.Uint64("frame.frambebase", frame.framebase),
 			zap.Int64("offset", frame.cfa.offset),
 			zap.Uint64("framebase", framebase))
 	/*case RuleOffset:
 		addr := frame.cfa.offset
 		buf := make([]byte, 8)
-		if _ ,err := syscall.PtracePeekData(cmd.Process.Pid, uintptr(addr), buf); err !=nil{
+		if _ ,err := ptracePeekData(cmd.Process.Pid, uintptr(addr), buf); err !=nil{
 			return nil, err
 		}
 		v := binary.LittleEndian.Uint64(buf)
@@ -482,17 +1531,29 @@ func (b *BI) locToPc(loc string) (uint64, error){
 }
 
 func (b *BI) fileLineToPc(filename string, lineno int) (uint64, error) {
-	if b.Sources[filename] == nil || b.Sources[filename][lineno] == nil || len(b.Sources[filename][lineno]) == 0{
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.symTable != nil {
+		return b.symbolLineToPc(filename, lineno)
+	}
+	lines := b.lineEntries(filename)
+	if lines == nil || len(lines[lineno]) == 0{
 		return 0, NotFoundSourceLineErr
 	}
-	return b.Sources[filename][lineno][0].Address, nil
+	return lines[lineno][0].Address, nil
 }
 
 func (b *BI) fileLineToPcForBreakPoint(filename string, lineno int) (uint64, error) {
-	if b.Sources[filename] == nil || b.Sources[filename][lineno] == nil || len(b.Sources[filename][lineno]) == 0{
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.symTable != nil {
+		return b.symbolLineToPc(filename, lineno)
+	}
+	lines := b.lineEntries(filename)
+	if lines == nil || len(lines[lineno]) == 0{
 		return 0, NotFoundSourceLineErr
 	}
-	lineEntryArray := b.Sources[filename][lineno]
+	lineEntryArray := lines[lineno]
 	for _, v := range lineEntryArray {
 		if v.PrologueEnd {
 			return v.Address, nil
@@ -527,59 +1588,54 @@ func (b *BI) getCurFileLineByPtracePc() (string, int, error ){
 }
 
 func (b *BI) pcTofileLine(pc uint64)(string, int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pcTofileLineLocked(pc)
+}
+
+// pcTofileLineLocked is pcTofileLine with mu held
+func (b *BI) pcTofileLineLocked(pc uint64)(string, int, error) {
+	if b.symTable != nil {
+		filename, lineno, fn := b.symTable.PCToLine(pc)
+		if fn == nil {
+			return "", 0, &NotFoundFuncErr{pc: pc}
+		}
+		return filename, lineno, nil
+	}
 	if b.Sources == nil {
 		return "", 0, errors.New("no sources file")
 	}
-
-	type Rs struct {
-		pc uint64
-		existedPc bool
-		filename string
-		lineno int
+	cu, err := b.loadCompileUnitIncludePc(pc)
+	if err != nil {
+		return "", 0, err
+	}
+	// gcc writes the rows of the views at the same pc, like the line of the function and the first statement, the
+	// first one of them is the statement like Statements
+	if lineEntry, ok := b.Statements[pc]; ok {
+		return lineEntry.File.Name, lineEntry.Line, nil
+	}
+	if cu == nil {
+		return "", 0, nil
 	}
 
-	rangeMin := &Rs{}
-	rangeMax := &Rs{}
-
-
-	for filename, filenameMp := range b.Sources {
-		for lineno, lineEntryArray := range filenameMp {
-			for _, lineEntry := range lineEntryArray {
-				if lineEntry.Address == pc {
-					return filename, lineno, nil
-				}
-				if lineEntry.Address <= pc && (!rangeMin.existedPc || lineEntry.Address > rangeMin.pc) {
-					rangeMin.pc = lineEntry.Address
-					rangeMin.existedPc = true
-					rangeMin.filename = filename
-					rangeMin.lineno = lineno
-				}
-				if pc < lineEntry.Address && (!rangeMax.existedPc || lineEntry.Address < rangeMax.pc) {
-					rangeMax.pc = lineEntry.Address
-					rangeMax.existedPc = true
-					rangeMax.filename = filename
-					rangeMax.lineno = lineno
-				}
-			}
+	// the row in effect at pc is the last one at or before it which doesn't end a sequence, another sequence may
+	// begin where one ends
+	lines := cu.lines
+	i := sort.Search(len(lines), func(i int) bool { return lines[i].Address > pc })
+	if i == 0 {
+		return "", 0, nil
+	}
+	lineEntry := lines[i - 1]
+	for j := i - 1; j >= 0 && lines[j].Address == lineEntry.Address; j-- {
+		if !lines[j].EndSequence {
+			lineEntry = lines[j]
+			break
 		}
 	}
-
-	return rangeMin.filename, rangeMin.lineno, nil
+	return lineEntry.File.Name, lineEntry.Line, nil
 }
 
 func (bi *BI)getSingleMemInst(pc uint64) (x86asm.Inst, error){
-	var (
-		mem []byte
-		err error
-		inst x86asm.Inst
-	)
-
-	mem = make([]byte, 100)
-	if _, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(pc), mem); err != nil {
-		return x86asm.Inst{}, err
-	}
-	if inst ,err = x86asm.Decode(mem, 64); err != nil {
-		return x86asm.Inst{}, err
-	}
-	return inst, nil
+	_, inst, err := disassembleInst(pc)
+	return inst, err
 }
\ No newline at end of file
@@ -1,25 +1,106 @@
 package main
 
 import (
+	"debug/dwarf"
 	"errors"
 	"fmt"
+	"go/parser"
+	"github.com/chainhelen/godbg/log"
 	"go.uber.org/zap"
 	"golang.org/x/arch/x86/x86asm"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 type BInfo struct {
+	// id of user breakpoint, it never changes after the breakpoint is set. internal breakpoint is 0
+	id int
 	original []byte
 	filename string
 	lineno int
 	pc uint64
 	kind BPKIND
+	// disabled breakpoint keeps the original instruction in memory until it is enabled
+	disabled bool
+	// hardware breakpoint uses the debug register DR<hwIndex> instead of int3, original is nil
+	hardware bool
+	hwIndex int
+	// watchpoint is a hardware breakpoint on the memory of a variable, pc is 0
+	watch *WatchInfo
+	// cond is a go expression, the debuggee only stops at the breakpoint when it is true
+	cond string
+	// hits counts how many times the debuggee reaches the breakpoint
+	hits int
+	hitCond *HitCondition
+	// ignore is the number of the next hits which don't stop the debuggee
+	ignore int
+	// temporary breakpoint is cleared after the debuggee stops at it once
+	temporary bool
+	// fn is the function of a function breakpoint, restarting finds the pc by it
+	fn string
+	// tracepoint logs the hits and the debuggee goes on, traceArgs logs the arguments of the function too
+	trace bool
+	traceArgs bool
+	// commands are run by the debugger every time the debuggee stops at the breakpoint
+	commands []string
+}
+
+// HitCondition compares the hits of the breakpoint with n, `%` stops every n hits
+type HitCondition struct {
+	op string
+	n int
+}
+
+func (h *HitCondition) match(hits int) bool {
+	switch h.op {
+	case ">":
+		return hits > h.n
+	case ">=":
+		return hits >= h.n
+	case "<":
+		return hits < h.n
+	case "<=":
+		return hits <= h.n
+	case "==":
+		return hits == h.n
+	case "!=":
+		return hits != h.n
+	case "%":
+		return hits % h.n == 0
+	}
+	return false
+}
+
+func (h *HitCondition) String() string {
+	return fmt.Sprintf("%s %d", h.op, h.n)
+}
+
+type WatchInfo struct {
+	name string
+	addr uint64
+	size int64
+	// stop on read and write, otherwise only on write
+	readable bool
+	typ dwarf.Type
+	// the memory when the watchpoint is set or hit last time
+	old []byte
 }
 
 type BP struct {
 	infos []*BInfo
+	lastId int
+	// pendingSignal is delivered to signalThread when the debuggee continues
+	pendingSignal syscall.Signal
+	signalThread int
+	// eventThread reports the last stop, it steps over its breakpoint even if another thread is current
+	eventThread int
+	// stepStops are the pcs where next stops, which have the user breakpoints already. Resume stops at them
+	// even if the conditions of the breakpoints are false
+	stepStops map[uint64]bool
 }
 
 type BPKIND uint64
@@ -27,6 +108,15 @@ type BPKIND uint64
 const (
 	USERBPTYPE BPKIND = 1
 	INTERNALBPTYPE BPKIND = 2
+	// PANICBPTYPE is on the functions of panics and fatal errors, the debuggee stops at them
+	PANICBPTYPE BPKIND = 3
+)
+
+// DR0-DR3 hold the addresses, DR6 tells which one is hit, DR7 enables them
+const (
+	maxHardwareBreakPoints = 4
+	dr6Index = 6
+	dr7Index = 7
 )
 
 func (b *BPKIND)String() string{
@@ -36,6 +126,9 @@ func (b *BPKIND)String() string{
 	if *b == INTERNALBPTYPE {
 		return "INTERNALBPTYPE"
 	}
+	if *b == PANICBPTYPE {
+		return "PANICBPTYPE"
+	}
 	return "unknown"
 }
 
@@ -52,12 +145,17 @@ func (bp *BP)setPcBreakPoint(pc uint64) ([]byte, error){
 	}
 
 	original := make([]byte, 1)
-	_, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(pc), original)
+	_, err = ptracePeekData(cmd.Process.Pid, uintptr(pc), original)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = syscall.PtracePokeData(cmd.Process.Pid, uintptr(pc), []byte{0xCC})
+	// the gdb server of rr keeps the breakpoints itself
+	if replay != nil {
+		err = replay.setBreakPoint(pc)
+	} else {
+		_, err = writeMemory(cmd.Process.Pid, uintptr(pc), []byte{0xCC})
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -80,14 +178,27 @@ func (bp *BP)SetInternalBreakPoint(pc uint64) (*BInfo, error)  {
 }
 
 func (bp* BP)SetFileLineBreakPoint(filename string, lineno int) (*BInfo, error) {
-	logger.Debug("SetFileLineBreakPoint", zap.String("filename", filename), zap.Int("lineno", lineno))
+	return bp.setFileLineBreakPoint(filename, lineno, false)
+}
+
+func (bp* BP)SetFileLineHardwareBreakPoint(filename string, lineno int) (*BInfo, error) {
+	return bp.setFileLineBreakPoint(filename, lineno, true)
+}
+
+func (bp* BP)setFileLineBreakPoint(filename string, lineno int, hardware bool) (*BInfo, error) {
+	defer observe("breakpoint", time.Now())
+	logger.Debug("SetFileLineBreakPoint", zap.String("filename", filename), zap.Int("lineno", lineno), zap.Bool("hardware", hardware))
 	curDir, err := os.Getwd()
 	if err != nil {
 		logger.Error("SetFileLineBreakPoint:GetWd", zap.Error(err), zap.Int(filename, lineno))
 		return nil, err
 	}
 
-	fullfilename := path.Join(curDir, filename)
+	fullfilename := filename
+	if !path.IsAbs(filename) {
+		fullfilename = path.Join(curDir, filename)
+	}
+	fullfilename = unsubstitutePath(fullfilename)
 	pc, err := bi.fileLineToPcForBreakPoint(fullfilename, lineno)
 	if err != nil {
 		logger.Error("SetFileLineBreakPoint:fileLineToPc",
@@ -100,43 +211,318 @@ func (bp* BP)SetFileLineBreakPoint(filename string, lineno int) (*BInfo, error)
 		zap.String("fullfilename", fullfilename),
 		zap.Int("lineno", lineno))
 
+	return bp.setUserBreakPoint(pc, filename, lineno, hardware)
+}
+
+// SetFunctionBreakPoint sets the breakpoint after the prologue of the function `name`,
+// where the arguments have been prepared
+func (bp* BP)SetFunctionBreakPoint(name string, hardware bool) (*BInfo, error) {
+	defer observe("breakpoint", time.Now())
+	f, err := bi.findFunctionByName(name)
+	if err != nil {
+		return nil, err
+	}
+	pc := bi.firstPcAfterPrologue(f)
+	filename, lineno, err := bi.pcTofileLine(pc)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("SetFunctionBreakPoint",
+		zap.String("name", name),
+		zap.Uint64("pc", pc),
+		zap.String("filename", filename),
+		zap.Int("lineno", lineno))
+	info, err := bp.setUserBreakPoint(pc, filename, lineno, hardware)
+	if err != nil {
+		return nil, err
+	}
+	info.fn = name
+	return info, nil
+}
+
+func (bp* BP)setUserBreakPoint(pc uint64, filename string, lineno int, hardware bool) (*BInfo, error) {
 	var (
 		info *BInfo
 		original []byte
+		err error
 	)
+	if hardware {
+		if info, err = bp.setPcHardwareBreakPoint(pc); err != nil {
+			logger.Error("SetFileLineBreakPoint:hardware",
+				zap.Error(err),
+				zap.String("filename", filename),
+				zap.Int("lineno", lineno))
+			return nil, err
+		}
+		bp.lastId++
+		info.id = bp.lastId
+		info.filename = filename
+		info.lineno = lineno
+		logBreakPoint("breakpoint.set", info)
+		warnBreakPoint(pc)
+		return info, nil
+	}
 	if original, err = bp.setPcBreakPoint(pc); err != nil{
 		logger.Error("SetFileLineBreakPoint",
 			zap.Error(err),
 			zap.Int("Pid", cmd.Process.Pid),
-			zap.String("fullfilename", fullfilename),
+			zap.String("filename", filename),
 			zap.Int("lineno", lineno))
 		return nil, err
 	}
-	info = &BInfo{original: original, filename: filename, lineno: lineno, pc: pc, kind: USERBPTYPE}
+	bp.lastId++
+	info = &BInfo{id: bp.lastId, original: original, filename: filename, lineno: lineno, pc: pc, kind: USERBPTYPE}
 	bp.infos = append(bp.infos, info)
+	logBreakPoint("breakpoint.set", info)
+	warnBreakPoint(pc)
 
 	return info, err
 }
 
+// warnBreakPoint warns if the source of the breakpoint at pc is newer than the binary, it may never hit where
+// the line is now. The breakpoint in the optimized function may hit where the line is not
+func warnBreakPoint(pc uint64) {
+	if filename, _, err := bi.pcTofileLine(pc); err == nil && bi.staleSource(filename) {
+		printStaleSource(filename)
+	}
+	if f, err := bi.findFunctionIncludePc(pc); err == nil && f.optimized {
+		printOptimized(f.name)
+	}
+}
+
+// logBreakPoint logs the event of the user breakpoint
+func logBreakPoint(event string, info *BInfo) {
+	logger.Info(event, log.Event(event), log.BreakpointID(info.id), log.PC(info.pc),
+		zap.String("filename", info.filename), zap.Int("lineno", info.lineno), zap.Bool("hardware", info.hardware))
+}
+
+// Continue resumes every thread, the pending signal is delivered to its thread
 func (bp *BP)Continue() error {
-	return syscall.PtraceCont(cmd.Process.Pid, 0)
+	sig := bp.pendingSignal
+	bp.pendingSignal = 0
+	// the recorded signals are delivered again by rr
+	if replaying() {
+		sig = 0
+	}
+	if stopsProcess {
+		return ptraceCont(cmd.Process.Pid, int(sig))
+	}
+	for _, tid := range targetThreads() {
+		s := 0
+		if tid == bp.signalThread {
+			s = int(sig)
+		}
+		// the thread is killed by the exit of another one which has been resumed, wait4 reports it
+		if err := ptraceCont(tid, s); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+	return nil
 }
 
+// continueThread resumes the current thread only while the others are running
+func (bp *BP) continueThread() error {
+	sig := bp.pendingSignal
+	bp.pendingSignal = 0
+	if replaying() || bp.signalThread != currentThread() {
+		sig = 0
+	}
+	return ptraceCont(currentThread(), int(sig))
+}
+
+// findBreakPoint returns the int3 breakpoint at pc
 func (bp *BP) findBreakPoint(pc uint64) (*BInfo , bool) {
 	for _, v := range bp.infos {
-		if v.pc == pc {
+		if v.pc == pc && !v.disabled && !v.hardware {
 			return v, true
 		}
 	}
 	return nil, false
 }
 
+// findHardwareBreakPoint returns the hardware breakpoint at pc, it traps before the instruction
+// so the pc is not moved like int3
+func (bp *BP) findHardwareBreakPoint(pc uint64) (*BInfo, bool) {
+	for _, v := range bp.infos {
+		if v.pc == pc && !v.disabled && v.hardware && v.watch == nil {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (bp *BP) freeHardwareIndex() (int, error) {
+	used := make([]bool, maxHardwareBreakPoints)
+	for _, v := range bp.infos {
+		if v.hardware {
+			used[v.hwIndex] = true
+		}
+	}
+	for i, u := range used {
+		if !u {
+			return i, nil
+		}
+	}
+	return 0, NoHardwareBreakPointErr
+}
+
+func (bp *BP) setPcHardwareBreakPoint(pc uint64) (*BInfo, error) {
+	for _, v := range bp.infos {
+		if v.pc == pc {
+			return nil, HasExistedBreakPointErr
+		}
+	}
+	index, err := bp.freeHardwareIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &BInfo{pc: pc, kind: USERBPTYPE, hardware: true, hwIndex: index}
+	if err := bp.enableBreakPoint(info); err != nil {
+		return nil, err
+	}
+	bp.infos = append(bp.infos, info)
+	return info, nil
+}
+
+// SetWatchPoint stops the debuggee after the variable `name` is written, or read if readable is true
+func (bp *BP) SetWatchPoint(name string, readable bool) (*BInfo, error) {
+	var (
+		entry *dwarf.Entry
+		addr uint64
+		typ dwarf.Type
+		index int
+		err error
+	)
+	if entry, addr, err = findVariable(name); err != nil {
+		return nil, err
+	}
+	if typ, err = bi.variableType(entry); err != nil {
+		return nil, err
+	}
+	// LEN of DR7 can only be 1, 2, 4 or 8 bytes, and the address must be aligned to it
+	size := typ.Size()
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("can't watch %s of %d bytes, the size should be 1, 2, 4 or 8", name, size)
+	}
+	if addr % uint64(size) != 0 {
+		return nil, fmt.Errorf("can't watch %s at unaligned address 0x%x", name, addr)
+	}
+	for _, v := range bp.infos {
+		if v.watch != nil && v.watch.addr == addr {
+			return nil, HasExistedBreakPointErr
+		}
+	}
+	if index, err = bp.freeHardwareIndex(); err != nil {
+		return nil, err
+	}
+
+	old := make([]byte, size)
+	if _, err = ptracePeekData(cmd.Process.Pid, uintptr(addr), old); err != nil {
+		return nil, err
+	}
+	info := &BInfo{kind: USERBPTYPE, hardware: true, hwIndex: index,
+		watch: &WatchInfo{name: name, addr: addr, size: size, readable: readable, typ: typ, old: old}}
+	if err = bp.enableBreakPoint(info); err != nil {
+		return nil, err
+	}
+	bp.lastId++
+	info.id = bp.lastId
+	bp.infos = append(bp.infos, info)
+	return info, nil
+}
+
+// hitWatchPoint returns the watchpoint which stops the debuggee with its last and current memory
+func (bp *BP) hitWatchPoint() (*BInfo, []byte, error) {
+	// there is no debug register through the gdb server
+	if replay != nil {
+		return nil, nil, nil
+	}
+	dr6, err := ptraceGetDebugReg(currentThread(), dr6Index)
+	if err != nil || dr6 & 0xf == 0 {
+		return nil, nil, err
+	}
+	// the processor never clears DR6
+	if err = ptraceSetDebugReg(currentThread(), dr6Index, 0); err != nil {
+		return nil, nil, err
+	}
+	for _, v := range bp.infos {
+		if v.watch == nil || v.disabled || dr6 & (1 << uint(v.hwIndex)) == 0 {
+			continue
+		}
+		cur := make([]byte, v.watch.size)
+		if _, err = ptracePeekData(cmd.Process.Pid, uintptr(v.watch.addr), cur); err != nil {
+			return nil, nil, err
+		}
+		old := v.watch.old
+		v.watch.old = cur
+		return v, old, nil
+	}
+	return nil, nil, nil
+}
+
+// hardwareBreakPointControl returns the address and R/W<n>, LEN<n> of DR7 for info
+func hardwareBreakPointControl(info *BInfo) (uint64, uint64) {
+	if info.watch == nil {
+		// break on instruction execution
+		return info.pc, 0
+	}
+	// 01 break on data writes, 11 on data reads or writes
+	rw := uint64(1)
+	if info.watch.readable {
+		rw = 3
+	}
+	var length uint64
+	switch info.watch.size {
+	case 2:
+		length = 1
+	case 4:
+		length = 3
+	case 8:
+		length = 2
+	}
+	return info.watch.addr, rw | length << 2
+}
+
+// debug registers belong to every thread, L<n> of DR7 is bit 2n, R/W<n> and LEN<n> are bits 16+4n to 19+4n
+func setHardwareBreakPoint(info *BInfo, enable bool) error {
+	addr, control := hardwareBreakPointControl(info)
+	for _, tid := range targetThreads() {
+		if enable {
+			if err := ptraceSetDebugReg(tid, info.hwIndex, addr); err != nil {
+				return err
+			}
+		}
+		dr7, err := ptraceGetDebugReg(tid, dr7Index)
+		if err != nil {
+			return err
+		}
+		dr7 &^= 0xf << (16 + uint(info.hwIndex)*4)
+		if enable {
+			dr7 |= control << (16 + uint(info.hwIndex)*4)
+			dr7 |= 1 << (uint(info.hwIndex) * 2)
+		} else {
+			dr7 &^= 1 << (uint(info.hwIndex) * 2)
+		}
+		if err = ptraceSetDebugReg(tid, dr7Index, dr7); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (bp *BP)enableBreakPoint (info *BInfo) error {
 	if info == nil {
 		return errors.New("enableBreakPoint breakpointinfo is null")
 	}
 	logger.Debug("enableBreakPoint", zap.Uint64("pc", info.pc))
-	if _, err := syscall.PtracePokeData(cmd.Process.Pid, uintptr(info.pc), []byte{0xCC}); err != nil {
+	if info.hardware {
+		return setHardwareBreakPoint(info, true)
+	}
+	if replay != nil {
+		return replay.setBreakPoint(info.pc)
+	}
+	if _, err := writeMemory(cmd.Process.Pid, uintptr(info.pc), []byte{0xCC}); err != nil {
 		return err
 	}
 	return nil
@@ -147,14 +533,22 @@ func (bp *BP)disableBreakPoint(info *BInfo) error {
 		return errors.New("disableBreakPoint breakpointinfo is null")
 	}
 	logger.Debug("disableBreakPoint", zap.Uint64("pc", info.pc))
-	if _, err := syscall.PtracePokeData(cmd.Process.Pid, uintptr(info.pc), info.original); err != nil {
+	if info.hardware {
+		return setHardwareBreakPoint(info, false)
+	}
+	if replay != nil {
+		return replay.clearBreakPoint(info.pc)
+	}
+	if _, err := writeMemory(cmd.Process.Pid, uintptr(info.pc), info.original); err != nil {
 		return err
 	}
 	return nil
 }
 
 /* version 2 */
-func (bp *BP)singleStepInstructionWithBreakpointCheck_v2() error {
+// singleStepInstructionWithBreakpointCheck_v2 executes the original instruction of the breakpoint at pc,
+// the event is not nil only if the process exits meanwhile
+func (bp *BP)singleStepInstructionWithBreakpointCheck_v2() (*StopEvent, error) {
 	var (
 		pc uint64
 		err error
@@ -163,36 +557,23 @@ func (bp *BP)singleStepInstructionWithBreakpointCheck_v2() error {
 	)
 
 	if pc, err = getPtracePc(); err != nil {
-		return err
+		return nil, err
 	}
-	pc = pc - 1
-	if info, ok = bp.findBreakPoint(pc); !ok {
-		return nil
+	if info, ok = bp.findHardwareBreakPoint(pc); !ok {
+		if info, ok = bp.findBreakPoint(pc); !ok {
+			return nil, nil
+		}
 	}
 	if err = bp.disableBreakPoint(info); err !=nil {
-		return  err
-	}
-	defer bp.enableBreakPoint(info)
-
-	if err = setPcRegister(pc); err != nil {
-		return err
-	}
-
-	if err = syscall.PtraceSingleStep(cmd.Process.Pid); err != nil {
-		return err
-	}
-	var s syscall.WaitStatus
-	if _, err = syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil); err != nil {
-		return err
-	}
-	if s.Exited() {
-		return nil
-	}
-	if s.StopSignal() == syscall.SIGTRAP {
-		return nil
+		return nil, err
 	}
+	defer func() {
+		if cmd.Process != nil {
+			bp.enableBreakPoint(info)
+		}
+	}()
 
-	return fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal())
+	return bp.singleStep()
 }
 
 func (bp *BP)singleStepInstructionWithBreakpointCheck() (bool, error) {
@@ -236,12 +617,12 @@ func (bp *BP)singleStepInstructionWithBreakpointCheck() (bool, error) {
 		return true, err
 	}
 
-	if err := syscall.PtraceCont(cmd.Process.Pid, 0); err != nil {
+	if err := ptraceCont(cmd.Process.Pid, 0); err != nil {
 		return true, err
 	}
 
 	var s syscall.WaitStatus
-	if _, err = syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil); err != nil {
+	if _, err = wait4(cmd.Process.Pid, &s); err != nil {
 		return true, err
 	}
 	status := (syscall.WaitStatus)(s)
@@ -265,6 +646,20 @@ func (bp *BP)singleStepInstructionWithBreakpointCheck() (bool, error) {
 	return true, nil
 }
 
+// removeInternalBreakPoint restores the original instruction of info and clears it,
+// info may have been dropped since the debuggee executes another program
+func (bp *BP) removeInternalBreakPoint(info *BInfo) {
+	for _, v := range bp.infos {
+		if v == info {
+			if cmd.Process != nil {
+				bp.disableBreakPoint(info)
+			}
+			bp.clearInternalBreakPoint(info.pc)
+			return
+		}
+	}
+}
+
 func (bp *BP)clearInternalBreakPoint(pc uint64) {
 	infos := make([]*BInfo, 0, len(bp.infos))
 	for _, v := range bp.infos {
@@ -275,16 +670,248 @@ func (bp *BP)clearInternalBreakPoint(pc uint64) {
 	bp.infos = infos
 }
 
-func (bp *BP)SetBpWhenRestart() error {
+// SetBpWhenRestart sets the breakpoints in the new process, their locations are resolved again
+// since the executable file may be rebuilt. The breakpoints which can't be resolved are disabled and returned,
+// the ones on panics are set again
+func (bp *BP)SetBpWhenRestart() ([]*BInfo, error) {
+	// the variables of a watchpoint don't exist in the new process,
+	// and the temporary breakpoints have been hit or given up by the old one
+	infos := make([]*BInfo, 0, len(bp.infos))
+	for _, v := range bp.infos {
+		if v.kind == USERBPTYPE && v.watch == nil && !v.temporary {
+			infos = append(infos, v)
+		}
+	}
+	bp.infos = infos
+
+	unresolved := make([]*BInfo, 0)
 	for _, v := range bp.infos {
-		if v.kind == INTERNALBPTYPE {
-			bp.clearInternalBreakPoint(v.pc)
+		if err := bp.resolveBreakPoint(v); err != nil {
+			logger.Error("SetBpWhenRestart:resolve", zap.Error(err), zap.Int("id", v.id))
+			v.disabled = true
+			unresolved = append(unresolved, v)
+			continue
 		}
-		if v.kind == USERBPTYPE {
+		if !v.disabled {
 			if err := bp.enableBreakPoint(v); err != nil {
-				return err
+				return unresolved, err
 			}
 		}
 	}
+	return unresolved, bp.SetPanicBreakPoints()
+}
+
+// resolveBreakPoint finds the pc of the breakpoint by its function or filename:lineno,
+// and reads the original instruction there
+func (bp *BP) resolveBreakPoint(info *BInfo) error {
+	defer observe("breakpoint", time.Now())
+	var (
+		pc uint64
+		err error
+	)
+	if info.fn != "" {
+		f, err := bi.findFunctionByName(info.fn)
+		if err != nil {
+			return err
+		}
+		pc = bi.firstPcAfterPrologue(f)
+		if info.filename, info.lineno, err = bi.pcTofileLine(pc); err != nil {
+			return err
+		}
+	} else {
+		curDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		// the absolute paths are kept like SetFileLineBreakPoint does
+		fullfilename := info.filename
+		if !path.IsAbs(fullfilename) {
+			fullfilename = path.Join(curDir, fullfilename)
+		}
+		if pc, err = bi.fileLineToPcForBreakPoint(unsubstitutePath(fullfilename), info.lineno); err != nil {
+			return err
+		}
+	}
+	info.pc = pc
+	if info.hardware {
+		return nil
+	}
+	original := make([]byte, 1)
+	if _, err = ptracePeekData(cmd.Process.Pid, uintptr(pc), original); err != nil {
+		return err
+	}
+	info.original = original
+	return nil
+}
+
+func (bp *BP) findUserBreakPoint(id int) (int, *BInfo, error) {
+	for i, v := range bp.infos {
+		if v.kind == USERBPTYPE && v.id == id {
+			return i, v, nil
+		}
+	}
+	return 0, nil, &NotFoundBreakPointErr{id: id}
+}
+
+// List returns user breakpoints ordered by id
+func (bp *BP) List() []*BInfo {
+	infos := make([]*BInfo, 0, len(bp.infos))
+	for _, v := range bp.infos {
+		if v.kind == USERBPTYPE {
+			infos = append(infos, v)
+		}
+	}
+	return infos
+}
+
+func (bp *BP) Disable(id int) (*BInfo, error) {
+	_, info, err := bp.findUserBreakPoint(id)
+	if err != nil {
+		return nil, err
+	}
+	if info.disabled {
+		return info, nil
+	}
+	if err = bp.disableBreakPoint(info); err != nil {
+		return nil, err
+	}
+	info.disabled = true
+	return info, nil
+}
+
+func (bp *BP) Enable(id int) (*BInfo, error) {
+	_, info, err := bp.findUserBreakPoint(id)
+	if err != nil {
+		return nil, err
+	}
+	if !info.disabled {
+		return info, nil
+	}
+	if err = bp.enableBreakPoint(info); err != nil {
+		return nil, err
+	}
+	info.disabled = false
+	return info, nil
+}
+
+// Condition sets the condition of the breakpoint id, the empty cond removes it
+func (bp *BP) Condition(id int, cond string) (*BInfo, error) {
+	_, info, err := bp.findUserBreakPoint(id)
+	if err != nil {
+		return nil, err
+	}
+	if cond != "" {
+		if _, err = parser.ParseExpr(cond); err != nil {
+			return nil, err
+		}
+	}
+	info.cond = cond
+	return info, nil
+}
+
+// Commands sets the debugger commands separated by `;` run when the debuggee stops at the breakpoint id,
+// the empty script removes them
+func (bp *BP) Commands(id int, script string) (*BInfo, error) {
+	_, info, err := bp.findUserBreakPoint(id)
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]string, 0)
+	for _, c := range strings.Split(script, ";") {
+		if c = strings.TrimSpace(c); c != "" {
+			commands = append(commands, c)
+		}
+	}
+	info.commands = commands
+	return info, nil
+}
+
+// HitCondition sets the condition on the hits of the breakpoint id like `> 3`, `== 2`, `% 2`,
+// the empty cond removes it
+func (bp *BP) HitCondition(id int, cond string) (*BInfo, error) {
+	_, info, err := bp.findUserBreakPoint(id)
+	if err != nil {
+		return nil, err
+	}
+	cond = strings.TrimSpace(cond)
+	if cond == "" {
+		info.hitCond = nil
+		return info, nil
+	}
+	for _, op := range []string{">=", "<=", "==", "!=", ">", "<", "%"} {
+		if !strings.HasPrefix(cond, op) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(cond[len(op):]))
+		if err != nil {
+			return nil, err
+		}
+		if op == "%" && n <= 0 {
+			return nil, fmt.Errorf("hitcount %% %d should be > 0", n)
+		}
+		info.hitCond = &HitCondition{op: op, n: n}
+		return info, nil
+	}
+	return nil, fmt.Errorf("invalid hitcount condition `%s`", cond)
+}
+
+// Ignore makes the next count hits of the breakpoint id not stop the debuggee
+func (bp *BP) Ignore(id int, count int) (*BInfo, error) {
+	_, info, err := bp.findUserBreakPoint(id)
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("ignore count %d should be >= 0", count)
+	}
+	info.ignore = count
+	return info, nil
+}
+
+// shouldStop counts the hit of the user breakpoint and decides whether the debuggee stops there,
+// the ignore count only decreases when the conditions are true
+func (bp *BP) shouldStop(info *BInfo) (bool, error) {
+	info.hits++
+	if info.hitCond != nil && !info.hitCond.match(info.hits) {
+		return false, nil
+	}
+	if info.cond != "" {
+		stop, err := evalCondition(info.cond)
+		if err != nil {
+			return true, fmt.Errorf("breakpoint %d condition `%s`: %v", info.id, info.cond, err)
+		}
+		if !stop {
+			return false, nil
+		}
+	}
+	if info.ignore > 0 {
+		info.ignore--
+		return false, nil
+	}
+	return true, nil
+}
+
+func (bp *BP) Clear(id int) (*BInfo, error) {
+	i, info, err := bp.findUserBreakPoint(id)
+	if err != nil {
+		return nil, err
+	}
+	// nothing to restore in the memory of an exited process
+	if cmd.Process != nil {
+		if _, err = bp.Disable(id); err != nil {
+			return nil, err
+		}
+	}
+	bp.infos = append(bp.infos[:i], bp.infos[i+1:]...)
+	logBreakPoint("breakpoint.clear", info)
+	return info, nil
+}
+
+func (bp *BP) ClearAll() error {
+	for _, v := range bp.List() {
+		if _, err := bp.Clear(v.id); err != nil {
+			return err
+		}
+	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"github.com/chainhelen/godbg/log"
+	"unsafe"
+)
+
+// dwarfBudget caps the bytes of the functions, the variables and the line tables parsed from the compile units by
+// `config max-dwarf-memory 512M`. The least recently used units are dropped beyond it and parsed again when they
+// are looked up, 0 keeps all of them
+var dwarfBudget int64
+
+// SetDwarfBudget changes dwarfBudget by the size like 512M, the units beyond it are dropped at once
+func SetDwarfBudget(value string) (int64, error) {
+	n, err := log.ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("the value of max-dwarf-memory should be a size like 512M or 0, not `%s`", value)
+	}
+	dwarfBudget = n
+	if bi != nil {
+		bi.mu.Lock()
+		bi.trimUnits(nil)
+		bi.mu.Unlock()
+	}
+	return n, nil
+}
+
+// formatSize prints the bytes like ParseSize reads them, by the largest unit dividing them
+func formatSize(n int64) string {
+	for _, u := range []struct {
+		unit   int64
+		suffix string
+	}{{1 << 30, "G"}, {1 << 20, "M"}, {1 << 10, "K"}} {
+		if n > 0 && n%u.unit == 0 {
+			return fmt.Sprintf("%d%s", n/u.unit, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+func entrySize(e *dwarf.Entry) int64 {
+	return int64(unsafe.Sizeof(*e)) + int64(len(e.Field))*int64(unsafe.Sizeof(dwarf.Field{}))
+}
+
+// size estimates what the functions and the package variables of the unit keep, the types are offsets which are
+// kept after the unit is dropped
+func (unit *parsedUnit) size() int64 {
+	var n int64
+	for _, f := range unit.functions {
+		n += int64(unsafe.Sizeof(*f)) + int64(len(f.frameBase))
+		for _, v := range f.variables {
+			n += entrySize(v)
+		}
+		n += int64(len(f.scopes)) * int64(unsafe.Sizeof(Scope{}))
+	}
+	for _, pv := range unit.packageVars {
+		n += int64(unsafe.Sizeof(*pv)) + entrySize(pv.entry)
+	}
+	return n
+}
+
+// linesSize is the rows and the pointers to them in Sources and Statements
+func linesSize(lineEntries []*dwarf.LineEntry) int64 {
+	return int64(len(lineEntries)) * int64(unsafe.Sizeof(dwarf.LineEntry{})+2*unsafe.Sizeof(uintptr(0)))
+}
+
+// touch marks cu used just now, trimUnits drops the unit used the earliest first
+func (bi *BI) touch(cu *CompileUnit) {
+	bi.useClock++
+	cu.used = bi.useClock
+}
+
+// trimUnits drops the least recently used units until the resident ones are within dwarfBudget, keep is the one
+// being loaded which is never dropped
+func (bi *BI) trimUnits(keep *CompileUnit) {
+	for dwarfBudget > 0 && bi.resident > dwarfBudget {
+		var lru *CompileUnit
+		for _, cu := range bi.CompileUnits {
+			if cu != keep && cu.unitSize+cu.linesSize > 0 && (lru == nil || cu.used < lru.used) {
+				lru = cu
+			}
+		}
+		if lru == nil {
+			return
+		}
+		bi.unloadCompileUnit(lru)
+	}
+}
+
+// unloadCompileUnit takes the functions, the package variables and the line entries of cu out of the indexes, the
+// ones looked up already are not changed
+func (bi *BI) unloadCompileUnit(cu *CompileUnit) {
+	if cu.loaded {
+		functions := make([]*Function, 0, len(bi.Functions))
+		for _, f := range bi.Functions {
+			if f.cu != cu {
+				functions = append(functions, f)
+			}
+		}
+		bi.Functions = functions
+		for _, f := range cu.functions {
+			if bi.functionsByName[f.name] == f {
+				delete(bi.functionsByName, f.name)
+			}
+		}
+		for _, pv := range cu.packageVars {
+			if bi.PackageVars[pv.name] == pv {
+				delete(bi.PackageVars, pv.name)
+			}
+		}
+		cu.functions, cu.packageVars, cu.loaded = nil, nil, false
+	}
+	if cu.linesLoaded {
+		for _, lineEntry := range cu.lines {
+			bi.unloadLineEntry(lineEntry)
+		}
+		cu.lines, cu.linesLoaded = nil, false
+	}
+	bi.resident -= cu.unitSize + cu.linesSize
+	cu.unitSize, cu.linesSize = 0, 0
+	bi.evictions++
+}
+
+func (bi *BI) unloadLineEntry(lineEntry *dwarf.LineEntry) {
+	if bi.Statements[lineEntry.Address] == lineEntry {
+		delete(bi.Statements, lineEntry.Address)
+	}
+	lines := bi.Sources[lineEntry.File.Name]
+	entries := lines[lineEntry.Line]
+	for i, e := range entries {
+		if e == lineEntry {
+			entries = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(entries) > 0 {
+		lines[lineEntry.Line] = entries
+		return
+	}
+	delete(lines, lineEntry.Line)
+	if len(lines) == 0 {
+		delete(bi.Sources, lineEntry.File.Name)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"strings"
+	"syscall"
+)
+
+// the values of R12 when runtime.debugCallV2 stops by int3, see runtime/asm_amd64.s
+const (
+	debugCallFrameReady = 0
+	debugCallReturned = 1
+	debugCallPanicked = 2
+	debugCallRejected = 8
+	debugCallRestore = 16
+)
+
+var NotSupportDebugCallErr = errors.New("can't find runtime.debugCallV2, the debuggee doesn't support calling functions")
+
+// CallFunction calls `fn(args...)` on the goroutine where the debuggee stops. runtime.debugCallV2 opens a frame
+// for the call on the goroutine stack and tells the debugger what to do next by int3 with the state in R12.
+// The arguments are passed in the registers of the go register ABI, so only integers and bools are supported.
+// The breakpoints are removed during the call, and all registers are restored after it
+func (bp *BP) CallFunction(expr string) (*Function, []string, error) {
+	if replaying() {
+		return nil, nil, ReplayReadOnlyErr
+	}
+	if bi.goVersion.abi0 {
+		return nil, nil, fmt.Errorf("the binary is built by %s, calling the functions needs the register ABI of go1.17", bi.goVersion)
+	}
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	call, ok := node.(*ast.CallExpr)
+	if !ok {
+		return nil, nil, fmt.Errorf("`%s` is not a function call", expr)
+	}
+	name, err := functionName(call.Fun)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := bi.findFunctionByName(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	args, err := callArguments(f, call.Args)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, _, err := bp.callFunction(f, args)
+	return f, values, err
+}
+
+// callFunction calls f with the words of the integer registers, the results are rendered by returnValues.
+// The registers when f returns are returned too, the callers inside godbg read the results from them
+func (bp *BP) callFunction(f *Function, args []uint64) ([]string, PtraceRegs, error) {
+	var results PtraceRegs
+	dispatch, err := bi.findFunctionByName("runtime.debugCallV2")
+	if err != nil {
+		return nil, results, NotSupportDebugCallErr
+	}
+	if curGoroutine != nil {
+		return nil, results, &NotRunningGoroutineErr{id: curGoroutine.id}
+	}
+	regs, err := getRegisters()
+	if err != nil {
+		return nil, results, err
+	}
+	fpregs, err := ptraceGetFpRegs(currentThread())
+	if err != nil {
+		return nil, results, err
+	}
+	var values []string
+	err = bp.withoutBreakPoints(func() error {
+		values, results, err = bp.debugCall(f, dispatch, args, regs, fpregs)
+		return err
+	})
+	return values, results, err
+}
+
+// functionName returns the name of fn like `main.add`, the package main can be omitted
+func functionName(fn ast.Expr) (string, error) {
+	switch n := fn.(type) {
+	case *ast.Ident:
+		return "main." + n.Name, nil
+	case *ast.SelectorExpr:
+		if pkg, ok := n.X.(*ast.Ident); ok {
+			return pkg.Name + "." + n.Sel.Name, nil
+		}
+	}
+	return "", fmt.Errorf("not support calling %T", fn)
+}
+
+// callArguments evaluates the arguments and converts them to the words of the integer registers
+func callArguments(f *Function, exprs []ast.Expr) ([]uint64, error) {
+	params := make([]*dwarf.Entry, 0)
+	for _, fv := range f.variables {
+		if fv.Tag != dwarf.TagFormalParameter {
+			continue
+		}
+		if isResult, _ := fv.Val(dwarf.AttrVarParam).(bool); !isResult {
+			params = append(params, fv)
+		}
+	}
+	if len(params) != len(exprs) {
+		return nil, fmt.Errorf("%s needs %d arguments, but %d are given", f.name, len(params), len(exprs))
+	}
+
+	args := make([]uint64, 0, len(params))
+	for i, param := range params {
+		name, _ := param.Val(dwarf.AttrName).(string)
+		typ, err := bi.variableType(param)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			if t, ok := typ.(*dwarf.TypedefType); ok {
+				typ = t.Type
+				continue
+			}
+			break
+		}
+		v, err := evalNode(exprs[i])
+		if err != nil {
+			return nil, err
+		}
+		switch typ.(type) {
+		case *dwarf.IntType:
+			x, ok := constant.Int64Val(constant.ToInt(v))
+			if !ok {
+				return nil, fmt.Errorf("argument %s %s can't be %s", name, typ.String(), v.String())
+			}
+			args = append(args, uint64(x))
+		case *dwarf.UintType:
+			x, ok := constant.Uint64Val(constant.ToInt(v))
+			if !ok {
+				return nil, fmt.Errorf("argument %s %s can't be %s", name, typ.String(), v.String())
+			}
+			args = append(args, x)
+		case *dwarf.BoolType:
+			if v.Kind() != constant.Bool {
+				return nil, fmt.Errorf("argument %s %s can't be %s", name, typ.String(), v.String())
+			}
+			if constant.BoolVal(v) {
+				args = append(args, 1)
+			} else {
+				args = append(args, 0)
+			}
+		default:
+			return nil, fmt.Errorf("not support the argument %s %s of %s", name, typ.String(), f.name)
+		}
+	}
+	if len(args) > 9 {
+		return nil, fmt.Errorf("%s has too many arguments for the registers", f.name)
+	}
+	return args, nil
+}
+
+func writeWord(addr uint64, word uint64) error {
+	mem := make([]byte, 8)
+	binary.LittleEndian.PutUint64(mem, word)
+	return WriteMemory(addr, mem)
+}
+
+// debugCall pushes pc as if the current instruction calls runtime.debugCallV2, then follows its stops
+// until the registers can be restored. The arguments spill to the frame, which is 8 bytes for each.
+// The registers at the stop where f returns are returned with the rendered results
+func (bp *BP) debugCall(f *Function, dispatch *Function, args []uint64, regs PtraceRegs, fpregs []byte) ([]string, PtraceRegs, error) {
+	var results PtraceRegs
+	sp := regs.Rsp - 8
+	if err := writeWord(sp, regs.PC()); err != nil {
+		return nil, results, err
+	}
+	if err := writeWord(sp - 16, uint64(len(args) * 8)); err != nil {
+		return nil, results, err
+	}
+	cur := regs
+	cur.Rsp = sp
+	cur.SetPC(dispatch.lowpc)
+	if err := ptraceSetRegs(currentThread(), &cur); err != nil {
+		return nil, results, err
+	}
+
+	var (
+		values []string
+		callErr error
+	)
+	// the other threads run during the call, the stops of the current thread are followed
+	if err := bp.Continue(); err != nil {
+		return nil, results, err
+	}
+	for {
+		var s syscall.WaitStatus
+		wpid, err := bp.waitThread(&s)
+		if err != nil {
+			return nil, results, err
+		}
+		if ev := exitEvent(wpid, s); ev != nil {
+			return nil, results, fmt.Errorf("the process has gone while calling %s", f.name)
+		}
+		sig := s.StopSignal()
+		if wpid != currentThread() {
+			if sig == syscall.SIGTRAP || !signalHandling(sig).pass {
+				sig = 0
+			}
+			if err = ptraceCont(wpid, int(sig)); err != nil {
+				return nil, results, err
+			}
+			continue
+		}
+		if sig != syscall.SIGTRAP {
+			bp.keepSignal(sig)
+			if err = bp.continueThread(); err != nil {
+				return nil, results, err
+			}
+			continue
+		}
+		if cur, err = getRegisters(); err != nil {
+			return nil, results, err
+		}
+
+		switch cur.R12 {
+		case debugCallFrameReady:
+			// the function returns to the int3 of the frame
+			intRegs := []*uint64{&cur.Rax, &cur.Rbx, &cur.Rcx, &cur.Rdi, &cur.Rsi, &cur.R8, &cur.R9, &cur.R10, &cur.R11}
+			for i, arg := range args {
+				*intRegs[i] = arg
+			}
+			cur.Rdx = 0
+			cur.Rsp -= 8
+			if err = writeWord(cur.Rsp, cur.PC()); err != nil {
+				return nil, results, err
+			}
+			cur.SetPC(f.lowpc)
+			if err = ptraceSetRegs(currentThread(), &cur); err != nil {
+				return nil, results, err
+			}
+		case debugCallReturned:
+			results = cur
+			values, callErr = returnValues(f)
+		case debugCallPanicked:
+			callErr = fmt.Errorf("%s panics", f.name)
+		case debugCallRejected:
+			// the reason is a string at the top of the stack
+			reason, err := readString(cur.Rsp)
+			if err != nil {
+				return nil, results, err
+			}
+			callErr = fmt.Errorf("can't call %s: %s", f.name, reason)
+		case debugCallRestore:
+			// the failure of the call is reported after the debuggee gets back
+			if err = bp.restoreAfterDebugCall(regs, fpregs, cur); err != nil {
+				return nil, results, err
+			}
+			if err = bp.stopThreads(currentThread()); err != nil {
+				return nil, results, err
+			}
+			return values, results, callErr
+		default:
+			return nil, results, fmt.Errorf("the debuggee stops at %#x unexpectedly while calling %s", cur.PC(), f.name)
+		}
+		if err = bp.continueThread(); err != nil {
+			return nil, results, err
+		}
+	}
+}
+
+// restoreAfterDebugCall restores the registers except pc and sp, which may be moved with the goroutine stack,
+// then the restoring code of runtime.debugCallV2 returns to the pc pushed
+func (bp *BP) restoreAfterDebugCall(regs PtraceRegs, fpregs []byte, cur PtraceRegs) error {
+	restore := regs
+	restore.Rsp = cur.Rsp
+	restore.SetPC(cur.PC())
+	if err := ptraceSetRegs(currentThread(), &restore); err != nil {
+		return err
+	}
+	if err := ptraceSetFpRegs(currentThread(), fpregs); err != nil {
+		return err
+	}
+	for i := 0; i < 64; i++ {
+		if ev, err := bp.singleStep(); err != nil {
+			return err
+		} else if ev != nil {
+			return fmt.Errorf("the process has gone while returning from the call")
+		}
+		pc, err := getPtracePc()
+		if err != nil {
+			return err
+		}
+		if pc == regs.PC() {
+			return nil
+		}
+	}
+	return errors.New("can't return from runtime.debugCallV2")
+}
+
+// readString reads the string header at addr and its data, the string longer than max-string-len is rejected
+// before its data is read
+func readString(addr uint64) (string, error) {
+	header := make([]byte, 16)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), header); err != nil {
+		return "", err
+	}
+	n := int64(binary.LittleEndian.Uint64(header[8:]))
+	if n < 0 || n > int64(loadConfig.maxStringLen) {
+		return "", fmt.Errorf("the length %d of the string at %#x should be from 0 to max-string-len %d", n, addr, loadConfig.maxStringLen)
+	}
+	s, _, err := loadString(binary.LittleEndian.Uint64(header), n, int(n))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(s), nil
+}
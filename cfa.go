@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"github.com/chainhelen/godbg/log"
 	"go.uber.org/zap"
 )
 
@@ -98,28 +99,56 @@ func execSingleInstruction(frame *Frame, buf *bytes.Buffer) error {
 	}
 
 	switch byte {
+	case DW_CFA_offset:
+		if byte, err = buf.ReadByte(); err != nil {
+			return err
+		}
+		reg := uint64(byte & low_6_offset)
+		offset, _, _ := DecodeULEB128(buf)
+		frame.regsRule[reg] = DWRule{offset: int64(offset) * frame.cie.data_alignment_factor, rule: RuleOffset}
+	case DW_CFA_undefined, DW_CFA_same_value:
+		reg, _, _ := DecodeULEB128(buf)
+		frame.regsRule[reg] = DWRule{rule: RuleUndefined}
+	case DW_CFA_def_cfa_offset:
+		offset, _, _ := DecodeULEB128(buf)
+		frame.cfa.offset = int64(offset)
+		log.Trace(dwarfLogger, fmt.Sprintf( "DW_CFA_def_cfa_offset, offset %d\n", offset))
+	// gcc remembers the rules before the epilogue in the middle of the function, and restores them after it
+	case DW_CFA_remember_state:
+		regsRule := make(map[uint64]DWRule, len(frame.regsRule))
+		for reg, rule := range frame.regsRule {
+			regsRule[reg] = rule
+		}
+		frame.remembered = append(frame.remembered, frameState{cfa: *frame.cfa, regsRule: regsRule})
+	case DW_CFA_restore_state:
+		n := len(frame.remembered)
+		if n == 0 {
+			return fmt.Errorf("DW_CFA_restore_state without DW_CFA_remember_state")
+		}
+		*frame.cfa, frame.regsRule = frame.remembered[n - 1].cfa, frame.remembered[n - 1].regsRule
+		frame.remembered = frame.remembered[:n - 1]
 	case DW_CFA_offset_extended:
 		reg, _, _ := DecodeULEB128(buf)
 		offset,_, _ := DecodeULEB128(buf)
 		frame.regsRule[reg] = DWRule{offset: int64(offset) * frame.cie.data_alignment_factor, rule: RuleOffset}
-		logger.Debug(fmt.Sprintf("DW_CFA_offset_extended, reg %d, offset %d, dwrule.offset %d\n", reg, offset, frame.regsRule[reg].offset))
+		log.Trace(dwarfLogger, fmt.Sprintf("DW_CFA_offset_extended, reg %d, offset %d, dwrule.offset %d\n", reg, offset, frame.regsRule[reg].offset))
 	case DW_CFA_def_cfa:
 		frame.cfa.reg, _, _ = DecodeULEB128(buf)
 		offset, _, _ := DecodeULEB128(buf)
 		frame.cfa.offset = int64(offset)
 		frame.cfa.rule = RuleCFA
-		logger.Debug(fmt.Sprintf( "DW_CFA_def_cfa, reg %d, offset %d\n", frame.cfa.reg, frame.cfa.offset))
+		log.Trace(dwarfLogger, fmt.Sprintf( "DW_CFA_def_cfa, reg %d, offset %d\n", frame.cfa.reg, frame.cfa.offset))
 	case DW_CFA_def_cfa_register:
 		reg, _, _ := DecodeULEB128(buf)
 		frame.cfa.reg = reg
-		frame.cfa.rule = RuleUndefined
-		logger.Debug(fmt.Sprintf( "DW_CFA_def_cfa_register, cfa.reg %d, cfa.offset %d\n", reg, frame.cfa.offset))
+		frame.cfa.rule = RuleCFA
+		log.Trace(dwarfLogger, fmt.Sprintf( "DW_CFA_def_cfa_register, cfa.reg %d, cfa.offset %d\n", reg, frame.cfa.offset))
 	case DW_CFA_def_cfa_offset_sf:
 		offset, _ , _:= DecodeSLEB128(buf)
 		t := offset
 		offset *= frame.cie.data_alignment_factor
 		frame.cfa.offset = offset
-		logger.Debug(fmt.Sprintf( "DW_CFA_def_cfa_offset_sf, offset *= frame.data_aligment_factor, %d = %d * %d\n",
+		log.Trace(dwarfLogger, fmt.Sprintf( "DW_CFA_def_cfa_offset_sf, offset *= frame.data_aligment_factor, %d = %d * %d\n",
 			offset, t, frame.cie.data_alignment_factor))
 	case DW_CFA_advance_loc:
 		if byte, err = buf.ReadByte(); err != nil {
@@ -127,19 +156,24 @@ func execSingleInstruction(frame *Frame, buf *bytes.Buffer) error {
 		}
 		delta := byte & low_6_offset
 		frame.loc += uint64(delta) * frame.cie.code_alignment_factor
-		logger.Debug(fmt.Sprintf( "DW_CFA_advance_loc, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
+		log.Trace(dwarfLogger, fmt.Sprintf( "DW_CFA_advance_loc, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
 	case DW_CFA_advance_loc1:
 		delta, err := buf.ReadByte()
 		if err != nil {
 			return err
 		}
 		frame.loc += uint64(delta) * frame.cie.code_alignment_factor
-		logger.Debug(fmt.Sprintf( "DW_CFA_advance_loc1, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
+		log.Trace(dwarfLogger, fmt.Sprintf( "DW_CFA_advance_loc1, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
 	case DW_CFA_advance_loc2:
 		var delta uint16
 		binary.Read(buf, binary.LittleEndian, &delta)
 		frame.loc += uint64(delta) * frame.cie.code_alignment_factor
-		logger.Debug(fmt.Sprintf( "DW_CFA_advance_loc2, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
+		log.Trace(dwarfLogger, fmt.Sprintf( "DW_CFA_advance_loc2, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
+	case DW_CFA_advance_loc4:
+		var delta uint32
+		binary.Read(buf, binary.LittleEndian, &delta)
+		frame.loc += uint64(delta) * frame.cie.code_alignment_factor
+		log.Trace(dwarfLogger, fmt.Sprintf( "DW_CFA_advance_loc4, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
 	case DW_CFA_restore:
 		if byte, err = buf.ReadByte(); err != nil {
 			return err
@@ -149,7 +183,7 @@ func execSingleInstruction(frame *Frame, buf *bytes.Buffer) error {
  	case DW_CFA_nop:
 		return nil
 	default:
-		logger.Error("execInstructions unknown byte", zap.Uint8("DW_CFA",byte))
+		dwarfLogger.Error("execInstructions unknown byte", zap.Uint8("DW_CFA",byte))
 		return fmt.Errorf("execInstructions unknown byte %v",byte)
 	}
 	return nil
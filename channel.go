@@ -0,0 +1,163 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"go/parser"
+	"strings"
+)
+
+// Channel is read from runtime.hchan of the debuggee. The type `chan T` is *hchan<T> { qcount; dataqsiz;
+// buf; ...; recvx; recvq; sendq; ... }, the elements are a ring in buf from recvx, and T is DW_AT_go_elem of
+// `chan T`. The goroutines blocked on the channel are in the lists of sudog<T> of recvq and sendq
+type Channel struct {
+	addr uint64
+	typ *dwarf.TypedefType
+	hchan *dwarf.StructType
+	elem dwarf.Type
+	qcount uint64
+	dataqsiz uint64
+	buf uint64
+	recvx uint64
+	closed bool
+}
+
+// ChannelWaiter is a goroutine blocked on a channel, elem is the value sent or where the value received goes
+type ChannelWaiter struct {
+	g *Goroutine
+	elem uint64
+}
+
+// loadChannel reads the runtime.hchan at addr whose type is td
+func loadChannel(td *dwarf.TypedefType, addr uint64) (*Channel, error) {
+	hchan, ok := derefStructType(td.Type, 1)
+	if !ok {
+		return nil, fmt.Errorf("not support the channel layout %s", td.Type.String())
+	}
+	mem := make([]byte, hchan.Size())
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+		return nil, err
+	}
+	c := &Channel{addr: addr, typ: td, hchan: hchan}
+	var closed uint64
+	for _, f := range []struct {
+		path string
+		val *uint64
+	}{{"qcount", &c.qcount}, {"dataqsiz", &c.dataqsiz}, {"buf", &c.buf}, {"recvx", &c.recvx}, {"closed", &closed}} {
+		var err error
+		if *f.val, err = readField(hchan, mem, f.path); err != nil {
+			return nil, err
+		}
+	}
+	c.closed = closed != 0
+	var err error
+	if c.elem, err = bi.elemType(td.Name); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// element returns the address of the element i in the buffer, 0 is the next one received
+func (c *Channel) element(i uint64) uint64 {
+	return c.buf + (c.recvx + i) % c.dataqsiz * uint64(c.elem.Size())
+}
+
+// waiters walks the sudogs in the queue recvq or sendq
+func (c *Channel) waiters(queue string) ([]*ChannelWaiter, error) {
+	off, qType, err := fieldOffset(c.hchan, queue + ".first")
+	if err != nil {
+		return nil, err
+	}
+	sudog, ok := derefStructType(qType, 1)
+	if !ok {
+		return nil, fmt.Errorf("not support the queue %s of %s", queue, c.hchan.StructName)
+	}
+	gType, err := bi.structType("runtime.g")
+	if err != nil {
+		return nil, err
+	}
+	mType, err := bi.structType("runtime.m")
+	if err != nil {
+		return nil, err
+	}
+	addr, err := readWord(c.addr + uint64(off))
+	if err != nil {
+		return nil, err
+	}
+	waiters := make([]*ChannelWaiter, 0)
+	for addr != 0 && len(waiters) < loadConfig.maxArrayValues {
+		mem := make([]byte, sudog.Size())
+		if _, err = ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+			return nil, err
+		}
+		var g, elem uint64
+		for _, f := range []struct {
+			path string
+			val *uint64
+		}{{"g", &g}, {"elem", &elem}, {"next", &addr}} {
+			if *f.val, err = readField(sudog, mem, f.path); err != nil {
+				return nil, err
+			}
+		}
+		w := &ChannelWaiter{elem: elem}
+		if w.g, err = loadGoroutine(g, gType, mType); err != nil {
+			return nil, err
+		}
+		waiters = append(waiters, w)
+	}
+	return waiters, nil
+}
+
+// ChannelState shows the channel expr, its buffer and the goroutines blocked receiving from and sending to it
+func ChannelState(expr string) ([]string, error) {
+	if cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	l, err := evalLvalue(node)
+	if err != nil {
+		return nil, err
+	}
+	td, ok := l.typ.(*dwarf.TypedefType)
+	if !ok || !strings.HasPrefix(td.Name, "chan ") {
+		return nil, fmt.Errorf("%s is %s, not a channel", expr, dwarfTypeName(l.typ))
+	}
+	addr, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+	if addr == 0 {
+		return []string{fmt.Sprintf("%s nil", td.Name)}, nil
+	}
+	c, err := loadChannel(td, addr)
+	if err != nil {
+		return nil, err
+	}
+	state := ""
+	if c.closed {
+		state = ", closed"
+	}
+	p := newPrinter()
+	lines := []string{fmt.Sprintf("%s len %d, cap %d%s", td.Name, c.qcount, c.dataqsiz, state),
+		fmt.Sprintf("buffer: %s", p.formatBuffer(c))}
+	for _, queue := range []string{"recvq", "sendq"} {
+		waiters, err := c.waiters(queue)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range waiters {
+			action := "receiving"
+			if queue == "sendq" {
+				action = "sending"
+				if w.elem != 0 {
+					action += " " + p.formatValueOrErr(c.elem, w.elem)
+				}
+			}
+			lines = append(lines, fmt.Sprintf("goroutine %d is blocked %s at %s", w.g.id, action, pcLocation(w.g.UserLocation())))
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Checkpoint is a stopped fork of the debuggee, which never runs. Restarting from it runs another fork of it,
+// so it can be restarted many times
+type Checkpoint struct {
+	id int
+	pid int
+	pc uint64
+	filename string
+	lineno int
+}
+
+var (
+	checkpoints []*Checkpoint
+	lastCheckpointId int
+)
+
+// withoutBreakPoints runs fn while the int3 of the breakpoints are removed from the memory
+func (bp *BP) withoutBreakPoints(fn func() error) error {
+	removed := make([]*BInfo, 0)
+	defer func() {
+		if cmd.Process != nil {
+			for _, info := range removed {
+				bp.enableBreakPoint(info)
+			}
+		}
+	}()
+	for _, info := range bp.infos {
+		if info.hardware || info.disabled {
+			continue
+		}
+		if err := bp.disableBreakPoint(info); err != nil {
+			return err
+		}
+		removed = append(removed, info)
+	}
+	return fn()
+}
+
+// NewCheckpoint forks the debuggee at the current pc, the checkpoint has no breakpoint in its memory
+func (bp *BP) NewCheckpoint() (*Checkpoint, error) {
+	if core != nil {
+		return nil, CoreReadOnlyErr
+	}
+	if replay != nil {
+		return nil, replay.unsupportedErr()
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	filename, lineno, err := bi.pcTofileLine(pc)
+	if err != nil {
+		return nil, err
+	}
+	var pid int
+	err = bp.withoutBreakPoints(func() error {
+		pid, err = ptraceFork(cmd.Process.Pid)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	lastCheckpointId++
+	c := &Checkpoint{id: lastCheckpointId, pid: pid, pc: pc, filename: filename, lineno: lineno}
+	checkpoints = append(checkpoints, c)
+	return c, nil
+}
+
+// RestartCheckpoint kills the debuggee and goes on with a new fork of the checkpoint,
+// where the breakpoints are set again
+func (bp *BP) RestartCheckpoint(id int) (*Checkpoint, error) {
+	var c *Checkpoint
+	for _, v := range checkpoints {
+		if v.id == id {
+			c = v
+		}
+	}
+	if c == nil {
+		return nil, fmt.Errorf("can't find checkpoint %d", id)
+	}
+	pid, err := ptraceFork(c.pid)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.Process != nil {
+		if attached {
+			if _, err = detach(false); err != nil {
+				return nil, err
+			}
+		} else {
+			killProcess()
+		}
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Process = p
+	threads = nil
+	curThread = 0
+	curGoroutine = nil
+	curFrame = 0
+	attached = false
+	bp.pendingSignal = 0
+
+	for _, info := range bp.infos {
+		if info.kind == USERBPTYPE && !info.disabled {
+			if err = bp.enableBreakPoint(info); err != nil {
+				return c, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// clearCheckpoints kills the processes of all checkpoints
+func clearCheckpoints() {
+	for _, c := range checkpoints {
+		syscall.Kill(c.pid, syscall.SIGKILL)
+		var s syscall.WaitStatus
+		syscall.Wait4(c.pid, &s, waitOptions, nil)
+	}
+	checkpoints = nil
+}
@@ -0,0 +1,127 @@
+// Package client drives `godbg --headless` by its json-rpc api
+package client
+
+import (
+	"fmt"
+	"github.com/chainhelen/godbg/api"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+)
+
+type Client struct {
+	c *rpc.Client
+}
+
+// New connects to the server listening at addr, whose api version should be api.Version
+func New(addr string) (*Client, error) {
+	c, err := jsonrpc.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{c}
+	version, err := client.GetVersion()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if version != api.Version {
+		c.Close()
+		return nil, fmt.Errorf("the api version of the server is %d, not %d", version, api.Version)
+	}
+	return client, nil
+}
+
+func (c *Client) call(method string, in interface{}, out interface{}) error {
+	return c.c.Call(api.ServiceName+"."+method, in, out)
+}
+
+func (c *Client) Close() error {
+	return c.c.Close()
+}
+
+func (c *Client) GetVersion() (int, error) {
+	var out api.GetVersionOut
+	err := c.call("GetVersion", api.GetVersionIn{}, &out)
+	return out.APIVersion, err
+}
+
+// CreateBreakpoint sets the breakpoint at loc like `file.go:line` or a function name, it stops if cond is true
+func (c *Client) CreateBreakpoint(loc string, cond string) (*api.Breakpoint, error) {
+	var out api.CreateBreakpointOut
+	err := c.call("CreateBreakpoint", api.CreateBreakpointIn{Loc: loc, Cond: cond}, &out)
+	return &out.Breakpoint, err
+}
+
+func (c *Client) ListBreakpoints() ([]api.Breakpoint, error) {
+	var out api.ListBreakpointsOut
+	err := c.call("ListBreakpoints", api.ListBreakpointsIn{}, &out)
+	return out.Breakpoints, err
+}
+
+func (c *Client) ClearBreakpoint(id int) (*api.Breakpoint, error) {
+	var out api.ClearBreakpointOut
+	err := c.call("ClearBreakpoint", api.ClearBreakpointIn{Id: id}, &out)
+	return &out.Breakpoint, err
+}
+
+// Command resumes the debuggee by the command name like api.Continue, and waits for it to stop
+func (c *Client) Command(name string) (*api.State, error) {
+	var out api.CommandOut
+	err := c.call("Command", api.CommandIn{Name: name}, &out)
+	return &out.State, err
+}
+
+func (c *Client) Continue() (*api.State, error) {
+	return c.Command(api.Continue)
+}
+
+func (c *Client) Next() (*api.State, error) {
+	return c.Command(api.Next)
+}
+
+func (c *Client) Step() (*api.State, error) {
+	return c.Command(api.Step)
+}
+
+func (c *Client) StepOut() (*api.State, error) {
+	return c.Command(api.StepOut)
+}
+
+func (c *Client) ListGoroutines() ([]api.Goroutine, error) {
+	var out api.ListGoroutinesOut
+	err := c.call("ListGoroutines", api.ListGoroutinesIn{}, &out)
+	return out.Goroutines, err
+}
+
+// Stacktrace unwinds depth frames of the goroutine at most, 0 is the current goroutine
+func (c *Client) Stacktrace(goroutineId uint64, depth int) ([]api.Stackframe, error) {
+	var out api.StacktraceOut
+	err := c.call("Stacktrace", api.StacktraceIn{GoroutineId: goroutineId, Depth: depth}, &out)
+	return out.Frames, err
+}
+
+// Eval renders the expression in the scope like print does
+func (c *Client) Eval(scope api.Scope, expr string) (string, error) {
+	var out api.EvalOut
+	err := c.call("Eval", api.EvalIn{Scope: scope, Expr: expr}, &out)
+	return out.Value, err
+}
+
+func (c *Client) ListLocals(scope api.Scope) ([]api.Variable, error) {
+	var out api.ListLocalsOut
+	err := c.call("ListLocals", api.ListLocalsIn{Scope: scope}, &out)
+	return out.Variables, err
+}
+
+// Exec runs a command of the prompt like `bt` and returns what it prints
+func (c *Client) Exec(line string) (string, string, error) {
+	var out api.ExecOut
+	err := c.call("Exec", api.ExecIn{Line: line}, &out)
+	return out.Stdout, out.Stderr, err
+}
+
+// Detach ends the session, the server stops after replying
+func (c *Client) Detach(kill bool) error {
+	var out api.DetachOut
+	return c.call("Detach", api.DetachIn{Kill: kill}, &out)
+}
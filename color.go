@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// colorMode is `auto`, `on` or `off`, auto colors the output only if stdout is a terminal and NO_COLOR is not set.
+// --no-color turns it off
+var colorMode = "auto"
+
+// the colors of the output
+const (
+	colorReset    = "\x1b[0m"
+	colorHeadline = "\x1b[1m"
+	colorKeyword  = "\x1b[35m"
+	colorType     = "\x1b[33m"
+	colorString   = "\x1b[32m"
+	colorNumber   = "\x1b[36m"
+	colorComment  = "\x1b[90m"
+	colorCurrent  = "\x1b[1;33m"
+	colorBreak    = "\x1b[31m"
+)
+
+// builtinTypes are the predeclared types colored like the named ones
+var builtinTypes = map[string]bool{
+	"bool": true, "byte": true, "complex64": true, "complex128": true, "error": true, "float32": true, "float64": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true, "rune": true, "string": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+}
+
+// SetColorMode changes colorMode by `config color`
+func SetColorMode(mode string) error {
+	if mode != "auto" && mode != "on" && mode != "off" {
+		return fmt.Errorf("unknown color mode `%s`, expect auto, on or off", mode)
+	}
+	colorMode = mode
+	return nil
+}
+
+func useColor() bool {
+	switch colorMode {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	w := stdout
+	if t, ok := w.(*transcriptWriter); ok {
+		w = t.w
+	}
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	_, _, ok = windowSize(f)
+	return ok
+}
+
+// colorize wraps s in color, s is as it is without colors
+func colorize(s string, color string) string {
+	if s == "" || !useColor() {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// printHeadline prints a line telling why the debuggee stops
+func printHeadline(format string, args ...interface{}) {
+	fmt.Fprintf(stdout, "%s\n", colorize(fmt.Sprintf(format, args...), colorHeadline))
+}
+
+// highlightSource colors a line of the go source
+func highlightSource(src string) string {
+	return highlight(src, false)
+}
+
+// highlightValue colors a value printed, the qualified names like `main.point` in it are the types
+func highlightValue(src string) string {
+	return highlight(src, true)
+}
+
+// highlight colors the keywords, the types, the strings, the numbers and the comments in src
+func highlight(src string, qualified bool) string {
+	if src == "" || !useColor() {
+		return src
+	}
+	type scanned struct {
+		off int
+		tok token.Token
+		lit string
+	}
+	var (
+		s       scanner.Scanner
+		tokens  []scanned
+		content = []byte(src)
+	)
+	s.Init(token.NewFileSet().AddFile("", -1, len(content)), content, func(token.Position, string) {}, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		tokens = append(tokens, scanned{int(pos) - 1, tok, lit})
+	}
+
+	var sb strings.Builder
+	last := 0
+	paint := func(begin int, end int, color string) {
+		if begin < last || end > len(src) {
+			return
+		}
+		sb.WriteString(src[last:begin] + color + src[begin:end] + colorReset)
+		last = end
+	}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.tok == token.STRING || t.tok == token.CHAR:
+			paint(t.off, t.off+len(t.lit), colorString)
+		case t.tok == token.INT || t.tok == token.FLOAT || t.tok == token.IMAG:
+			paint(t.off, t.off+len(t.lit), colorNumber)
+		case t.tok == token.COMMENT:
+			paint(t.off, t.off+len(t.lit), colorComment)
+		case t.tok.IsKeyword():
+			paint(t.off, t.off+len(t.tok.String()), colorKeyword)
+		case qualified && t.tok == token.IDENT && i+2 < len(tokens) && tokens[i+1].tok == token.PERIOD && tokens[i+2].tok == token.IDENT &&
+			tokens[i+1].off == t.off+len(t.lit) && tokens[i+2].off == tokens[i+1].off+1:
+			paint(t.off, tokens[i+2].off+len(tokens[i+2].lit), colorType)
+			i += 2
+		case t.tok == token.IDENT && builtinTypes[t.lit]:
+			paint(t.off, t.off+len(t.lit), colorType)
+		}
+	}
+	sb.WriteString(src[last:])
+	return sb.String()
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// LoadConfig bounds the values loaded from the debuggee, so the huge ones are shown in part
+type LoadConfig struct {
+	// maxStringLen is the bytes of a string read and shown, the evaluator loads the strings in full up to
+	// maxMemoryLength
+	maxStringLen int
+	// maxArrayValues is the elements of an array, a slice, a map or a channel shown
+	maxArrayValues int
+	// maxStructDepth is how deep the structs, arrays, slices, maps and channels are nested in the value shown
+	maxStructDepth int
+	// followPointers is how many pointers are followed from the value shown, the others show the addresses
+	followPointers int
+}
+
+var loadConfig = defaultLoadConfig()
+
+func defaultLoadConfig() LoadConfig {
+	return LoadConfig{maxStringLen: 256, maxArrayValues: 64, maxStructDepth: 10, followPointers: 10}
+}
+
+// fullLoadConfig loads the values in full, the cycles of the pointers are still detected and the strings are
+// read up to maxMemoryLength
+func fullLoadConfig() LoadConfig {
+	return LoadConfig{maxStringLen: maxMemoryLength, maxArrayValues: math.MaxInt32, maxStructDepth: math.MaxInt32, followPointers: math.MaxInt32}
+}
+
+// loadConfigNames are the names of the fields of LoadConfig used by `config`, in order
+var loadConfigNames = []string{"max-string-len", "max-array-values", "max-struct-depth", "follow-pointers"}
+
+func (c *LoadConfig) field(name string) (*int, error) {
+	switch name {
+	case "max-string-len":
+		return &c.maxStringLen, nil
+	case "max-array-values":
+		return &c.maxArrayValues, nil
+	case "max-struct-depth":
+		return &c.maxStructDepth, nil
+	case "follow-pointers":
+		return &c.followPointers, nil
+	}
+	return nil, fmt.Errorf("unknown config `%s`, expect max-string-len, max-array-values, max-struct-depth, follow-pointers, number-format, source-list-size, max-dwarf-memory, color or substitute-path", name)
+}
+
+// numberFormat is the verb the integers are shown in, `d` unless `config number-format` changes it
+var numberFormat byte = 'd'
+
+// numberFormats are the names of the verbs of numberFormat
+var numberFormats = map[string]byte{"dec": 'd', "hex": 'x', "bin": 'b', "oct": 'o', "char": 'c'}
+
+// numberFormatName returns the name of the verb
+func numberFormatName(verb byte) string {
+	for name, v := range numberFormats {
+		if v == verb {
+			return name
+		}
+	}
+	return string(verb)
+}
+
+// SetNumberFormat changes numberFormat by the name, dec, hex, bin, oct or char
+func SetNumberFormat(name string) error {
+	verb, ok := numberFormats[name]
+	if !ok {
+		return fmt.Errorf("unknown number format `%s`, expect dec, hex, bin, oct or char", name)
+	}
+	numberFormat = verb
+	return nil
+}
+
+// LoadConfigs shows the fields of loadConfig like `name = value`, and numberFormat
+func LoadConfigs() []string {
+	configs := make([]string, 0, len(loadConfigNames) + 1)
+	for _, name := range loadConfigNames {
+		v, _ := loadConfig.field(name)
+		configs = append(configs, fmt.Sprintf("%s = %d", name, *v))
+	}
+	configs = append(configs, fmt.Sprintf("number-format = %s", numberFormatName(numberFormat)))
+	configs = append(configs, fmt.Sprintf("source-list-size = %d", sourceListSize))
+	configs = append(configs, fmt.Sprintf("max-dwarf-memory = %s", formatSize(dwarfBudget)))
+	configs = append(configs, fmt.Sprintf("color = %s", colorMode))
+	for _, r := range substitutePaths {
+		configs = append(configs, fmt.Sprintf("substitute-path = %s => %s", r.From, r.To))
+	}
+	return configs
+}
+
+// SetLoadConfig changes the field `name` of loadConfig, the values are the numbers not less than 0
+func SetLoadConfig(name string, value string) (int, error) {
+	v, err := loadConfig.field(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("the value of %s should be a number not less than 0, not `%s`", name, value)
+	}
+	if v == &loadConfig.maxStringLen && n > maxMemoryLength {
+		return 0, fmt.Errorf("the value of max-string-len should be not more than %d, not `%s`", maxMemoryLength, value)
+	}
+	*v = n
+	return n, nil
+}
+
+// sourceListSize is how many lines are listed before and after the line where the debuggee stops
+var sourceListSize = 6
+
+// SetSourceListSize changes sourceListSize, the value is a number greater than 0
+func SetSourceListSize(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("the value of source-list-size should be a number greater than 0, not `%s`", value)
+	}
+	sourceListSize = n
+	return n, nil
+}
+
+// substitutePathRule maps the directory From where the binary is built to To on this machine
+type substitutePathRule struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// substitutePaths are the rules by `config substitute-path from to`, they are tried in order
+var substitutePaths []substitutePathRule
+
+// AddSubstitutePath adds the rule from => to, it replaces the one of the same from
+func AddSubstitutePath(from string, to string) error {
+	from, to = path.Clean(from), path.Clean(to)
+	if !path.IsAbs(from) || !path.IsAbs(to) {
+		return fmt.Errorf("the paths of substitute-path should be absolute, not `%s` and `%s`", from, to)
+	}
+	for i, r := range substitutePaths {
+		if r.From == from {
+			substitutePaths[i].To = to
+			return nil
+		}
+	}
+	substitutePaths = append(substitutePaths, substitutePathRule{From: from, To: to})
+	return nil
+}
+
+// RemoveSubstitutePath removes the rule of from
+func RemoveSubstitutePath(from string) error {
+	from = path.Clean(from)
+	for i, r := range substitutePaths {
+		if r.From == from {
+			substitutePaths = append(substitutePaths[:i:i], substitutePaths[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("can't find substitute-path `%s`", from)
+}
+
+// replacePathPrefix replaces the directory from at the beginning of filename with to
+func replacePathPrefix(filename string, from string, to string) (string, bool) {
+	if filename == from {
+		return to, true
+	}
+	if strings.HasPrefix(filename, from+"/") {
+		return to + filename[len(from):], true
+	}
+	return filename, false
+}
+
+// substitutePath maps the source in the binary to the file on this machine, which is read to list it
+func substitutePath(filename string) string {
+	for _, r := range substitutePaths {
+		if f, ok := replacePathPrefix(filename, r.From, r.To); ok {
+			return f
+		}
+	}
+	return filename
+}
+
+// unsubstitutePath maps the file on this machine input by the user back to the source in the binary
+func unsubstitutePath(filename string) string {
+	for _, r := range substitutePaths {
+		if f, ok := replacePathPrefix(filename, r.To, r.From); ok {
+			return f
+		}
+	}
+	return filename
+}
+
+// fileConfig is the content of the config file, what is missing in the file keeps the default
+type fileConfig struct {
+	MaxStringLen   int               `yaml:"max-string-len"`
+	MaxArrayValues int               `yaml:"max-array-values"`
+	MaxStructDepth int               `yaml:"max-struct-depth"`
+	FollowPointers int               `yaml:"follow-pointers"`
+	NumberFormat   string            `yaml:"number-format"`
+	SourceListSize int               `yaml:"source-list-size"`
+	MaxDwarfMemory string            `yaml:"max-dwarf-memory,omitempty"`
+	Color          string               `yaml:"color"`
+	Formats        map[string]string    `yaml:"formats,omitempty"`
+	Aliases        map[string]string    `yaml:"aliases,omitempty"`
+	SubstitutePath []substitutePathRule `yaml:"substitute-path,omitempty"`
+}
+
+// configFile is $XDG_CONFIG_HOME/godbg/config.yml, ~/.config/godbg/config.yml without XDG_CONFIG_HOME
+func configFile() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = path.Join(home, ".config")
+	}
+	return path.Join(dir, "godbg", "config.yml"), nil
+}
+
+func currentFileConfig() fileConfig {
+	c := fileConfig{
+		MaxStringLen:   loadConfig.maxStringLen,
+		MaxArrayValues: loadConfig.maxArrayValues,
+		MaxStructDepth: loadConfig.maxStructDepth,
+		FollowPointers: loadConfig.followPointers,
+		NumberFormat:   numberFormatName(numberFormat),
+		SourceListSize: sourceListSize,
+		Color:          colorMode,
+		Formats:        make(map[string]string),
+		Aliases:        make(map[string]string),
+	}
+	// the default 0 is not written, like the formats and the aliases empty
+	if dwarfBudget > 0 {
+		c.MaxDwarfMemory = formatSize(dwarfBudget)
+	}
+	for name, r := range formatters {
+		c.Formats[name] = r.kind
+	}
+	for name, commands := range aliases {
+		c.Aliases[name] = commands
+	}
+	c.SubstitutePath = append(c.SubstitutePath, substitutePaths...)
+	return c
+}
+
+// apply sets the values of c by the setters of `config` and `alias`, so they are checked the same way
+func (c fileConfig) apply() error {
+	for i, v := range []int{c.MaxStringLen, c.MaxArrayValues, c.MaxStructDepth, c.FollowPointers} {
+		if _, err := SetLoadConfig(loadConfigNames[i], strconv.Itoa(v)); err != nil {
+			return err
+		}
+	}
+	if err := SetNumberFormat(c.NumberFormat); err != nil {
+		return err
+	}
+	if _, err := SetSourceListSize(strconv.Itoa(c.SourceListSize)); err != nil {
+		return err
+	}
+	if c.MaxDwarfMemory != "" {
+		if _, err := SetDwarfBudget(c.MaxDwarfMemory); err != nil {
+			return err
+		}
+	}
+	if err := SetColorMode(c.Color); err != nil {
+		return err
+	}
+	for name, kind := range c.Formats {
+		if err := SetFormatter(name, kind); err != nil {
+			return err
+		}
+	}
+	for name, commands := range c.Aliases {
+		if err := AddAlias(name, commands); err != nil {
+			return err
+		}
+	}
+	for _, r := range c.SubstitutePath {
+		if err := AddSubstitutePath(r.From, r.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadConfigFile applies the config file if it exists, the unknown keys are errors
+func LoadConfigFile() error {
+	filename, err := configFile()
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// the formats, the aliases and the substitute-path rules in the file are added to the current ones
+	c := currentFileConfig()
+	c.Formats, c.Aliases, c.SubstitutePath = nil, nil, nil
+	if err = yaml.UnmarshalStrict(content, &c); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if err = c.apply(); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return nil
+}
+
+// SaveConfigFile writes the current config to the config file and returns its name
+func SaveConfigFile() (string, error) {
+	filename, err := configFile()
+	if err != nil {
+		return "", err
+	}
+	content, err := yaml.Marshal(currentFileConfig())
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		return "", err
+	}
+	return filename, ioutil.WriteFile(filename, content, 0644)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+var CoreReadOnlyErr = errors.New("the core file can't be resumed or changed")
+
+// core is not nil in the postmortem mode of `godbg core`, the memory and the registers are read from
+// the core file instead of ptrace
+var core *coreFile
+
+// coreThread is a thread of the process dumped, fpregs is the fxsave area
+type coreThread struct {
+	tid int
+	regs PtraceRegs
+	fpregs []byte
+}
+
+// coreFile is the elf core file dumped by the kernel. The pages which are not dumped, like the text
+// and the read-only data mapped from the executable, are read from the executable, exe is the one mapped by bi
+type coreFile struct {
+	f *elf.File
+	exe *elf.File
+	threads []*coreThread
+	pid int
+	// signal is the signal killing the process, the first thread received it
+	signal syscall.Signal
+}
+
+// openCore opens corefile dumped by execfile, which bi is analyzed from already. The returned cmd has no process of its own, its pid is the
+// one of the process dumped
+func openCore(execfile string, corefile string) (*exec.Cmd, error) {
+	f, err := elf.Open(corefile)
+	if err != nil {
+		return nil, err
+	}
+	if f.Type != elf.ET_CORE {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a core file", corefile)
+	}
+	if bi == nil || bi.file == nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is not analyzed", execfile)
+	}
+	if bi.file.elf == nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is not ELF, the core files of linux are read with the ELF executables", execfile)
+	}
+	c := &coreFile{f: f, exe: bi.file.elf}
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		data, err := ioutil.ReadAll(prog.Open())
+		if err == nil {
+			err = c.readNotes(data)
+		}
+		if err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	if len(c.threads) == 0 {
+		c.close()
+		return nil, fmt.Errorf("there is no thread in %s", corefile)
+	}
+	if c.pid == 0 {
+		c.pid = c.threads[0].tid
+	}
+
+	core = c
+	// the thread receiving the signal is the current one, the process is the first of threads
+	threads, curThread = nil, 0
+	if len(c.threads) > 1 {
+		threads = []int{c.pid}
+		for _, t := range c.threads {
+			if t.tid != c.pid {
+				threads = append(threads, t.tid)
+			}
+		}
+	}
+	if c.threads[0].tid != c.pid {
+		curThread = c.threads[0].tid
+	}
+	return &exec.Cmd{Path: execfile, Process: &os.Process{Pid: c.pid}}, nil
+}
+
+// readNotes reads the notes of a PT_NOTE segment, each one is namesz, descsz, type, then the name
+// and the desc aligned to 4 bytes
+func (c *coreFile) readNotes(data []byte) error {
+	align := func(n uint32) int { return int((n + 3) &^ 3) }
+	for len(data) >= 12 {
+		namesz := binary.LittleEndian.Uint32(data)
+		descsz := binary.LittleEndian.Uint32(data[4:])
+		typ := binary.LittleEndian.Uint32(data[8:])
+		data = data[12:]
+		if len(data) < align(namesz)+int(descsz) {
+			return errors.New("the note of the core file is truncated")
+		}
+		name := strings.TrimSuffix(string(data[:namesz]), "\x00")
+		desc := data[align(namesz) : align(namesz)+int(descsz)]
+		next := align(namesz) + align(descsz)
+		if next > len(data) {
+			next = len(data)
+		}
+		data = data[next:]
+		if err := c.readNote(name, typ, desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// thread returns the thread tid of the core file
+func (c *coreFile) thread(tid int) (*coreThread, error) {
+	for _, t := range c.threads {
+		if t.tid == tid {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("there is no thread %d in the core file", tid)
+}
+
+func (c *coreFile) readRegisters(tid int, regs *PtraceRegs) error {
+	t, err := c.thread(tid)
+	if err != nil {
+		return err
+	}
+	*regs = t.regs
+	return nil
+}
+
+func (c *coreFile) readFpRegisters(tid int) ([]byte, error) {
+	t, err := c.thread(tid)
+	if err != nil {
+		return nil, err
+	}
+	if t.fpregs == nil {
+		return nil, fmt.Errorf("there is no fp register of thread %d in the core file", tid)
+	}
+	return append([]byte(nil), t.fpregs...), nil
+}
+
+// readMemory reads out from addr, it stops at the first byte which is neither in the core file
+// nor in the executable
+func (c *coreFile) readMemory(addr uintptr, out []byte) (int, error) {
+	n := 0
+	for n < len(out) {
+		m := c.readSegment(c.f, uint64(addr)+uint64(n), out[n:])
+		if m == 0 {
+			m = c.readSegment(c.exe, uint64(addr)+uint64(n), out[n:])
+		}
+		if m == 0 {
+			return n, syscall.EIO
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// readSegment reads out from addr in the PT_LOAD segment of f including it, only the part in the file
+func (c *coreFile) readSegment(f *elf.File, addr uint64, out []byte) int {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || addr < prog.Vaddr || addr >= prog.Vaddr+prog.Filesz {
+			continue
+		}
+		size := prog.Vaddr + prog.Filesz - addr
+		if size > uint64(len(out)) {
+			size = uint64(len(out))
+		}
+		n, _ := prog.ReadAt(out[:size], int64(addr-prog.Vaddr))
+		return n
+	}
+	return 0
+}
+
+func (c *coreFile) close() {
+	c.f.Close()
+}
+
+// closeCore closes the core file, the debuggee has gone
+func closeCore() {
+	core.close()
+	core = nil
+	threads, curThread, curGoroutine, curFrame = nil, 0, nil, 0
+	cmd.Process = nil
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"debug/dwarf"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dapRequest is a request of the debug adapter protocol, the arguments are decoded by the command
+type dapRequest struct {
+	Seq int `json:"seq"`
+	Type string `json:"type"`
+	Command string `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq int `json:"seq"`
+	Type string `json:"type"`
+	RequestSeq int `json:"request_seq"`
+	Success bool `json:"success"`
+	Command string `json:"command"`
+	Message string `json:"message,omitempty"`
+	Body interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq int `json:"seq"`
+	Type string `json:"type"`
+	Event string `json:"event"`
+	Body interface{} `json:"body,omitempty"`
+}
+
+// dapFrame is the frame index of the goroutine, which a frame id of stackTrace refers to
+type dapFrame struct {
+	goroutine uint64
+	index int
+}
+
+// dapScope is the variables with the tag in the frame, which a variables reference refers to
+type dapScope struct {
+	frame int
+	tag dwarf.Tag
+}
+
+// dapSession serves a client of the debug adapter protocol. The requests are handled one by one on the
+// thread tracing the debuggee, a client waits for the events of the debuggee stopping after resuming it
+type dapSession struct {
+	r *bufio.Reader
+	w io.Writer
+	// mu guards w and seq, the output of the debuggee is sent by another goroutine
+	mu sync.Mutex
+	seq int
+	// breakpoints are set by setBreakpoints for the sources, and by setFunctionBreakpoints for ""
+	breakpoints map[string][]*BInfo
+	// frames and scopes are referred by their index + 1 until the debuggee is resumed
+	frames []dapFrame
+	scopes []dapScope
+	stopOnEntry bool
+	// progressReporting is true if the client supports the progress events, analyzing reports them
+	progressReporting bool
+}
+
+// runDap serves the debug adapter protocol on stdin and stdout, or on the first client connecting to addr
+func runDap(addr string) error {
+	if addr == "" {
+		return serveDap(os.Stdin, os.Stdout)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	fmt.Fprintf(stderr, "dap server listening at %s\n", l.Addr())
+	conn, err := l.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return serveDap(conn, conn)
+}
+
+// serveDap handles the requests from r until the client disconnects
+func serveDap(r io.Reader, w io.Writer) error {
+	s := &dapSession{r: bufio.NewReader(r), w: w, breakpoints: make(map[string][]*BInfo)}
+	// the messages of godbg are shown in the console of the client
+	savedOut, savedErr := stdout, stderr
+	stdout, stderr = &dapOutput{s, "console"}, &dapOutput{s, "stderr"}
+	defer func() { stdout, stderr = savedOut, savedErr }()
+	for {
+		req, err := s.readRequest()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if req.Command == "disconnect" {
+			err := releaseDebuggee()
+			s.respond(req, nil, err)
+			return err
+		}
+		s.handle(req)
+	}
+}
+
+// readRequest reads a message like `Content-Length: n\r\n\r\n{...}`
+func (s *dapSession) readRequest() (*dapRequest, error) {
+	length := -1
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if v := strings.TrimPrefix(line, "Content-Length:"); v != line {
+			if length, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+				return nil, fmt.Errorf("invalid header `%s`", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("the message has no Content-Length")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.r, body); err != nil {
+		return nil, err
+	}
+	req := &dapRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *dapSession) send(msg interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	switch m := msg.(type) {
+	case *dapResponse:
+		m.Seq = s.seq
+	case *dapEvent:
+		m.Seq = s.seq
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		rpcLogger.Error(err.Error())
+		return
+	}
+	fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (s *dapSession) respond(req *dapRequest, body interface{}, err error) {
+	resp := &dapResponse{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	s.send(resp)
+}
+
+func (s *dapSession) event(name string, body interface{}) {
+	s.send(&dapEvent{Type: "event", Event: name, Body: body})
+}
+
+// dapOutput sends what is written as the output events of the category
+type dapOutput struct {
+	s *dapSession
+	category string
+}
+
+func (o *dapOutput) Write(p []byte) (int, error) {
+	o.s.event("output", map[string]interface{}{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
+
+// handle runs the request, the ones resuming the debuggee send the events after the response
+func (s *dapSession) handle(req *dapRequest) {
+	var (
+		body interface{}
+		err error
+		resume func() (*StopEvent, error)
+	)
+	switch req.Command {
+	case "initialize":
+		var args struct {
+			SupportsProgressReporting bool `json:"supportsProgressReporting"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		s.progressReporting = args.SupportsProgressReporting
+		body = map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints": true,
+			"supportsConditionalBreakpoints": true,
+			"supportsHitConditionalBreakpoints": true,
+			"supportsEvaluateForHovers": true,
+		}
+	case "launch":
+		err = s.launch(req.Arguments)
+	case "attach":
+		err = s.attach(req.Arguments)
+	case "setBreakpoints":
+		body, err = s.setBreakpoints(req.Arguments)
+	case "setFunctionBreakpoints":
+		body, err = s.setFunctionBreakpoints(req.Arguments)
+	case "setExceptionBreakpoints":
+		body = map[string]interface{}{}
+	case "configurationDone":
+		if !s.stopOnEntry {
+			resume = bp.Resume
+		}
+	case "threads":
+		body, err = s.threads()
+	case "stackTrace":
+		body, err = s.stackTrace(req.Arguments)
+	case "scopes":
+		body, err = s.scopeList(req.Arguments)
+	case "variables":
+		body, err = s.variables(req.Arguments)
+	case "evaluate":
+		body, err = s.evaluate(req.Arguments)
+	case "continue":
+		body, resume = map[string]interface{}{"allThreadsContinued": true}, bp.Resume
+	case "next":
+		resume = bp.Next
+	case "stepIn":
+		resume = bp.Step
+	case "stepOut":
+		resume = bp.StepOut
+	default:
+		err = fmt.Errorf("not support the request %s", req.Command)
+	}
+	if resume != nil && (cmd == nil || cmd.Process == nil) {
+		resume, err = nil, NoProcessRuning
+	}
+	s.respond(req, body, err)
+	if req.Command == "initialize" {
+		s.event("initialized", nil)
+	}
+	if req.Command == "configurationDone" && s.stopOnEntry && cmd != nil && cmd.Process != nil {
+		s.event("stopped", map[string]interface{}{"reason": "entry", "threadId": currentGoroutineId(), "allThreadsStopped": true})
+	}
+	if resume != nil {
+		s.resume(resume)
+	}
+}
+
+// launch builds the program if it is a go file, and runs it with the args. The output of the debuggee
+// is sent as the output events
+func (s *dapSession) launch(arguments json.RawMessage) error {
+	var args struct {
+		Program string `json:"program"`
+		Args []string `json:"args"`
+		StopOnEntry bool `json:"stopOnEntry"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+	program, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	execfile = program
+	if filepath.Ext(program) == ".go" {
+		if execfile, err = build(program); err != nil {
+			return fmt.Errorf("can't build %s: %v", program, err)
+		}
+		sourcefile = program
+	}
+	newBi, err := s.analyze(execfile)
+	if err != nil {
+		return err
+	}
+	replaceBi(newBi)
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	// runexec gives the debuggee os.Stdout and os.Stderr
+	savedOut, savedErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	execargs = args.Args
+	cmd, err = runexec(execfile, execargs)
+	os.Stdout, os.Stderr = savedOut, savedErr
+	w.Close()
+	if err != nil {
+		r.Close()
+		return err
+	}
+	go func() {
+		defer r.Close()
+		io.Copy(&dapOutput{s, "stdout"}, r)
+	}()
+	s.stopOnEntry = args.StopOnEntry
+	return bp.SetPanicBreakPoints()
+}
+
+// attach traces the running process, which stops until configurationDone
+func (s *dapSession) attach(arguments json.RawMessage) error {
+	var args struct {
+		ProcessId int `json:"processId"`
+		StopOnEntry bool `json:"stopOnEntry"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+	exefile, err := processExecutable(args.ProcessId)
+	if err != nil {
+		return err
+	}
+	newBi, err := s.analyze(exefile)
+	if err != nil {
+		return err
+	}
+	replaceBi(newBi)
+	if cmd, execfile, err = attach(args.ProcessId); err != nil {
+		return err
+	}
+	s.stopOnEntry = args.StopOnEntry
+	return bp.SetPanicBreakPoints()
+}
+
+// analyze sends the progress of the units parsed to the client between progressStart and progressEnd
+func (s *dapSession) analyze(exefile string) (*BI, error) {
+	if !s.progressReporting {
+		return analyze(exefile)
+	}
+	id := "analyze"
+	s.event("progressStart", map[string]interface{}{"progressId": id, "title": "load the debug info of " +
+		filepath.Base(exefile), "percentage": 0})
+	defer s.event("progressEnd", map[string]interface{}{"progressId": id})
+	return analyzeContext(context.Background(), exefile, everyPercent(func(done int, total int, percent int) {
+		s.event("progressUpdate", map[string]interface{}{"progressId": id, "percentage": percent,
+			"message": fmt.Sprintf("%d/%d compile units", done, total)})
+	}))
+}
+
+// dapBreakpoint is the breakpoint of the arguments of setBreakpoints and setFunctionBreakpoints
+type dapBreakpoint struct {
+	Line int `json:"line"`
+	Name string `json:"name"`
+	Condition string `json:"condition"`
+	HitCondition string `json:"hitCondition"`
+}
+
+// setBreakpoints replaces the breakpoints of the source by the lines
+func (s *dapSession) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []dapBreakpoint `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	return s.replaceBreakpoints(args.Source.Path, args.Breakpoints, func(b dapBreakpoint) (*BInfo, error) {
+		return bp.SetFileLineBreakPoint(args.Source.Path, b.Line)
+	})
+}
+
+// setFunctionBreakpoints replaces the breakpoints of the functions by the names
+func (s *dapSession) setFunctionBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Breakpoints []dapBreakpoint `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	return s.replaceBreakpoints("", args.Breakpoints, func(b dapBreakpoint) (*BInfo, error) {
+		return bp.SetFunctionBreakPoint(b.Name, false)
+	})
+}
+
+// replaceBreakpoints clears the breakpoints set for key and sets the new ones. The ones which can't be set
+// are not verified, with the reason
+func (s *dapSession) replaceBreakpoints(key string, bps []dapBreakpoint, set func(dapBreakpoint) (*BInfo, error)) (interface{}, error) {
+	for _, info := range s.breakpoints[key] {
+		if _, err := bp.Clear(info.id); err != nil {
+			return nil, err
+		}
+	}
+	s.breakpoints[key] = nil
+	results := make([]map[string]interface{}, 0, len(bps))
+	for _, b := range bps {
+		info, err := set(b)
+		if err == nil && b.Condition != "" {
+			_, err = bp.Condition(info.id, b.Condition)
+		}
+		if err == nil && b.HitCondition != "" {
+			_, err = bp.HitCondition(info.id, b.HitCondition)
+		}
+		if err != nil {
+			if info != nil {
+				bp.Clear(info.id)
+			}
+			results = append(results, map[string]interface{}{"verified": false, "line": b.Line, "message": err.Error()})
+			continue
+		}
+		s.breakpoints[key] = append(s.breakpoints[key], info)
+		results = append(results, map[string]interface{}{"id": info.id, "verified": true, "line": info.lineno,
+			"source": dapSource(info.filename)})
+	}
+	return map[string]interface{}{"breakpoints": results}, nil
+}
+
+func dapSource(filename string) map[string]interface{} {
+	return map[string]interface{}{"name": filepath.Base(filename), "path": substitutePath(filename)}
+}
+
+// threads are the goroutines of the debuggee
+func (s *dapSession) threads() (interface{}, error) {
+	threads := make([]map[string]interface{}, 0)
+	if cmd == nil || cmd.Process == nil {
+		return map[string]interface{}{"threads": threads}, nil
+	}
+	gs, err := Goroutines()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range gs {
+		threads = append(threads, map[string]interface{}{"id": g.id, "name": fmt.Sprintf("goroutine %d %s", g.id, pcLocation(g.UserLocation()))})
+	}
+	return map[string]interface{}{"threads": threads}, nil
+}
+
+// switchGoroutine selects the goroutine id unless it is the current one
+func switchGoroutine(id uint64) error {
+	if id == 0 || id == currentGoroutineId() {
+		return nil
+	}
+	_, err := SwitchGoroutine(id)
+	return err
+}
+
+func (s *dapSession) stackTrace(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		ThreadId uint64 `json:"threadId"`
+		StartFrame int `json:"startFrame"`
+		Levels int `json:"levels"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	if cmd == nil || cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	if err := switchGoroutine(args.ThreadId); err != nil {
+		return nil, err
+	}
+	frames, err := Stacktrace()
+	if err != nil {
+		return nil, err
+	}
+	total := len(frames)
+	if args.StartFrame > total {
+		args.StartFrame = total
+	}
+	frames = frames[args.StartFrame:]
+	if args.Levels > 0 && args.Levels < len(frames) {
+		frames = frames[:args.Levels]
+	}
+	goroutine := currentGoroutineId()
+	stackFrames := make([]map[string]interface{}, 0, len(frames))
+	for _, f := range frames {
+		s.frames = append(s.frames, dapFrame{goroutine, f.index})
+		stackFrames = append(stackFrames, map[string]interface{}{"id": len(s.frames), "name": f.fn.name,
+			"source": dapSource(f.filename), "line": f.lineno, "column": 1})
+	}
+	return map[string]interface{}{"stackFrames": stackFrames, "totalFrames": total}, nil
+}
+
+// selectFrame selects the frame of the frame id
+func (s *dapSession) selectFrame(id int) error {
+	if id <= 0 || id > len(s.frames) {
+		return fmt.Errorf("can't find frame %d", id)
+	}
+	f := s.frames[id - 1]
+	if err := switchGoroutine(f.goroutine); err != nil {
+		return err
+	}
+	_, err := SelectFrame(f.index)
+	return err
+}
+
+func (s *dapSession) scopeList(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		FrameId int `json:"frameId"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	if args.FrameId <= 0 || args.FrameId > len(s.frames) {
+		return nil, fmt.Errorf("can't find frame %d", args.FrameId)
+	}
+	scopes := make([]map[string]interface{}, 0, 2)
+	for _, scope := range []struct {
+		name string
+		tag dwarf.Tag
+	}{{"Arguments", dwarf.TagFormalParameter}, {"Locals", dwarf.TagVariable}} {
+		s.scopes = append(s.scopes, dapScope{args.FrameId, scope.tag})
+		scopes = append(scopes, map[string]interface{}{"name": scope.name, "variablesReference": len(s.scopes), "expensive": false})
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+// variables are the variables of a scope, their values are rendered by the printer in full
+func (s *dapSession) variables(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	if args.VariablesReference <= 0 || args.VariablesReference > len(s.scopes) {
+		return nil, fmt.Errorf("can't find variables %d", args.VariablesReference)
+	}
+	scope := s.scopes[args.VariablesReference - 1]
+	if err := s.selectFrame(scope.frame); err != nil {
+		return nil, err
+	}
+	vars, err := FrameVariables(scope.tag, nil)
+	if err != nil {
+		return nil, err
+	}
+	variables := make([]map[string]interface{}, 0, len(vars))
+	for _, v := range vars {
+		name := v.name
+		if v.shadowed {
+			name += " (shadowed)"
+		}
+		variables = append(variables, map[string]interface{}{"name": name, "value": v.value, "type": v.typeName, "variablesReference": 0})
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+// evaluate renders the expression in the frame like print does
+func (s *dapSession) evaluate(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Expression string `json:"expression"`
+		FrameId int `json:"frameId"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	if cmd == nil || cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	if args.FrameId != 0 {
+		if err := s.selectFrame(args.FrameId); err != nil {
+			return nil, err
+		}
+	}
+	value, err := formatExpr(args.Expression)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"result": value, "variablesReference": 0}, nil
+}
+
+// dapStopReasons are the reasons of the stopped events
+var dapStopReasons = map[StopReason]string{
+	StopBreakPoint: "breakpoint",
+	StopWatchPoint: "data breakpoint",
+	StopStep: "step",
+	StopSignal: "exception",
+	StopPanic: "exception",
+}
+
+// resume runs the debuggee by f and sends the events of where it stops, or the exited and terminated ones.
+// The frames and the scopes referred before are forgotten
+func (s *dapSession) resume(f func() (*StopEvent, error)) {
+	s.frames, s.scopes = nil, nil
+	ev, err := f()
+	if err != nil {
+		s.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+		if ev == nil {
+			return
+		}
+	}
+	for _, trace := range ev.traces {
+		s.event("output", map[string]interface{}{"category": "console", "output": trace + "\n"})
+	}
+	switch ev.reason {
+	case StopExited, StopKilled:
+		s.event("exited", map[string]interface{}{"exitCode": ev.status})
+		s.event("terminated", nil)
+		return
+	}
+	reason, ok := dapStopReasons[ev.reason]
+	if !ok {
+		reason = "pause"
+	}
+	body := map[string]interface{}{"reason": reason, "threadId": currentGoroutineId(), "allThreadsStopped": true}
+	switch ev.reason {
+	case StopPanic:
+		body["text"] = ev.panic
+	case StopSignal:
+		body["text"] = ev.signal.String()
+	case StopBreakPoint:
+		if ev.info != nil && ev.info.kind == USERBPTYPE {
+			body["hitBreakpointIds"] = []int{ev.info.id}
+		}
+	}
+	s.event("stopped", body)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"debug/macho"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/chainhelen/godbg/log"
+	"go.uber.org/zap"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var NoDebugserverFoundErr = errors.New("can't find debugserver, install the command line tools by " +
+	"`xcode-select --install` or set GODBG_DEBUGSERVER to it")
+
+// debugserverPaths are where the command line tools and Xcode put debugserver of lldb
+var debugserverPaths = []string{
+	"/Library/Developer/CommandLineTools/Library/PrivateFrameworks/LLDB.framework/Versions/A/Resources/debugserver",
+	"/Applications/Xcode.app/Contents/SharedFrameworks/LLDB.framework/Resources/debugserver",
+}
+
+// findDebugserver returns GODBG_DEBUGSERVER, or the first debugserver found in PATH or debugserverPaths
+func findDebugserver() (string, error) {
+	if p := os.Getenv("GODBG_DEBUGSERVER"); p != "" {
+		return p, nil
+	}
+	if p, err := exec.LookPath("debugserver"); err == nil {
+		return p, nil
+	}
+	for _, p := range debugserverPaths {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", NoDebugserverFoundErr
+}
+
+// launchDebugserver starts execfile with args under debugserver, the debuggee stops at its first instruction.
+// ASLR is disabled, godbg reads the binary at the addresses it is linked at
+func launchDebugserver(execfile string, args []string) (*exec.Cmd, error) {
+	cmd, err := startDebugserver(execfile, append([]string{"--disable-aslr", "--", execfile}, args...))
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("start", log.Event("process.start"), log.Pid(cmd.Process.Pid), zap.String("execfile", execfile),
+		zap.String("backend", "debugserver"))
+	return cmd, nil
+}
+
+// attachDebugserver attaches to the running process pid by debugserver, which stops every thread of it
+func attachDebugserver(pid int) (*exec.Cmd, string, error) {
+	exefile, err := processExecutable(pid)
+	if err != nil {
+		return nil, "", err
+	}
+	cmd, err := startDebugserver(exefile, []string{"--attach=" + strconv.Itoa(pid)})
+	if err != nil {
+		return nil, "", err
+	}
+	logger.Info("attach", log.Event("process.attach"), log.Pid(pid), zap.String("exefile", exefile),
+		zap.String("backend", "debugserver"))
+	attached = true
+	return cmd, exefile, nil
+}
+
+// startDebugserver runs debugserver with args at a free port of the loopback, then connects to it like
+// rrReplay does to rr
+func startDebugserver(execfile string, args []string) (*exec.Cmd, error) {
+	path, err := findDebugserver()
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	server := exec.Command(path, append([]string{addr}, args...)...)
+	server.Stdin = os.Stdin
+	server.Stdout = os.Stdout
+	server.Stderr = os.Stderr
+	server.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = server.Start(); err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		server.Process.Kill()
+		server.Wait()
+		return nil, err
+	}
+	return connectDebugserver(conn, execfile, server)
+}
+
+// connectDebugserver makes replay the client of debugserver on conn, whose `g` packets are read by
+// qRegisterInfo. The returned cmd has the process of the debuggee told by qProcessInfo
+func connectDebugserver(conn net.Conn, execfile string, server *exec.Cmd) (*exec.Cmd, error) {
+	g := &gdbConn{conn: conn, rd: bufio.NewReader(conn), server: server}
+	fail := func(err error) (*exec.Cmd, error) {
+		g.close()
+		return nil, err
+	}
+	if err := g.handshake(); err != nil {
+		return fail(err)
+	}
+	if err := g.loadRegisterInfo(); err != nil {
+		return fail(err)
+	}
+	reply, err := g.exec("qProcessInfo")
+	if err != nil {
+		return fail(err)
+	}
+	pid := int64(0)
+	for _, field := range strings.Split(reply, ";") {
+		if strings.HasPrefix(field, "pid:") {
+			pid, _ = strconv.ParseInt(field[len("pid:"):], 16, 64)
+		}
+	}
+	if pid <= 0 {
+		return fail(fmt.Errorf("invalid reply `%s` of qProcessInfo", reply))
+	}
+	if err = checkLinkAddress(g, execfile); err != nil {
+		return fail(err)
+	}
+	replay = g
+	return &exec.Cmd{Path: execfile, Process: &os.Process{Pid: int(pid)}}, nil
+}
+
+// checkLinkAddress fails if the Mach-O header of execfile is not at the address of __TEXT, like the process
+// started with ASLR before attaching. The binaries which are not Mach-O are not checked
+func checkLinkAddress(g *gdbConn, execfile string) error {
+	f, err := macho.Open(execfile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	text := f.Segment("__TEXT")
+	if text == nil {
+		return nil
+	}
+	magic := make([]byte, 4)
+	if _, err = g.readMemory(uintptr(text.Addr), magic); err != nil || binary.LittleEndian.Uint32(magic) != macho.Magic64 {
+		return fmt.Errorf("%s is not loaded at %#x, the process may be started with ASLR, godbg reads the binaries "+
+			"at the addresses they are linked at, start it by godbg", execfile, text.Addr)
+	}
+	return nil
+}
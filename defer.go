@@ -0,0 +1,326 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/arch/x86/x86asm"
+	"strconv"
+	"strings"
+)
+
+// DeferredCall is a runtime._defer of the goroutine which is not run yet
+type DeferredCall struct {
+	// fn is the function deferred, the compiler wraps `defer f(args)` into a closure deferwrap calling f
+	fn *Function
+	// sp is the stack pointer of the function executing the defer statement, pc is where it executes it
+	sp uint64
+	pc uint64
+	filename string
+	lineno int
+	// args are `name = value` of the arguments saved in the closure, nil if they are unknown
+	args []string
+}
+
+func (d *DeferredCall) String() string {
+	name := "?"
+	if d.fn != nil {
+		name = d.fn.name
+	}
+	args := "..."
+	if d.args != nil {
+		args = strings.Join(d.args, ", ")
+	}
+	return fmt.Sprintf("%s(%s) at %s:%d", name, args, d.filename, d.lineno)
+}
+
+// currentGoroutineAddr returns the runtime.g selected or running on the current thread
+func currentGoroutineAddr() (uint64, error) {
+	if curGoroutine != nil {
+		return curGoroutine.addr, nil
+	}
+	addr, err := threadGoroutine(currentThread())
+	if err != nil {
+		return 0, err
+	}
+	if addr == 0 {
+		return 0, fmt.Errorf("thread %d is not running any goroutine", currentThread())
+	}
+	return addr, nil
+}
+
+// Defers reads the chain g._defer of the goroutine selected, the latest deferred call is the first.
+// The programs are built with -N, so the defers are never open-coded and all of them are in the chain
+func Defers() ([]*DeferredCall, error) {
+	if cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	gType, err := bi.structType("runtime.g")
+	if err != nil {
+		return nil, err
+	}
+	dType, err := bi.structType("runtime._defer")
+	if err != nil {
+		return nil, err
+	}
+	g, err := currentGoroutineAddr()
+	if err != nil {
+		return nil, err
+	}
+	off, _, err := fieldOffset(gType, "_defer")
+	if err != nil {
+		return nil, err
+	}
+	addr, err := readWord(g + uint64(off))
+	if err != nil {
+		return nil, err
+	}
+
+	defers := make([]*DeferredCall, 0)
+	for addr != 0 && len(defers) < maxStackDepth {
+		mem := make([]byte, dType.Size())
+		if _, err = ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+			return nil, err
+		}
+		var sp, pc, fn uint64
+		for _, f := range []struct {
+			path string
+			val *uint64
+		}{{"sp", &sp}, {"pc", &pc}, {"fn", &fn}, {"link", &addr}} {
+			if *f.val, err = readField(dType, mem, f.path); err != nil {
+				return nil, err
+			}
+		}
+		d := &DeferredCall{sp: sp, pc: pc}
+		// pc is the return address of runtime.deferproc
+		if d.filename, d.lineno, err = bi.pcTofileLine(pc - 1); err != nil {
+			return nil, err
+		}
+		if fn != 0 {
+			if err = loadDeferredFunction(d, fn); err != nil {
+				return nil, err
+			}
+		}
+		defers = append(defers, d)
+	}
+	return defers, nil
+}
+
+// FrameDefers returns the deferred calls of the frame selected
+func FrameDefers() ([]*DeferredCall, error) {
+	frame, err := selectedFrame()
+	if err != nil {
+		return nil, err
+	}
+	defers, err := Defers()
+	if err != nil {
+		return nil, err
+	}
+	return deferredBy(defers, frame), nil
+}
+
+// deferredBy picks the calls deferred by the function of frame, whose sp is recorded in _defer
+func deferredBy(defers []*DeferredCall, frame *Stackframe) []*DeferredCall {
+	picked := make([]*DeferredCall, 0)
+	for _, d := range defers {
+		if d.sp == frame.regs.Rsp {
+			picked = append(picked, d)
+		}
+	}
+	return picked
+}
+
+// loadDeferredFunction finds the function of the closure fn. The wrapper deferwrap is emulated until it
+// calls the function deferred, the arguments are the registers of the call by the register ABI of go
+func loadDeferredFunction(d *DeferredCall, fn uint64) error {
+	code, err := readWord(fn)
+	if err != nil {
+		return err
+	}
+	wrapper, err := bi.findFunctionIncludePc(code)
+	if err != nil {
+		return err
+	}
+	d.fn = wrapper
+	if bi.goVersion.abi0 {
+		// the arguments of ABI0 are copied after the _defer, which are unknown
+		return nil
+	}
+	if !strings.Contains(wrapper.name, ".deferwrap") {
+		// a function literal without arguments
+		d.args = []string{}
+		return nil
+	}
+	target, regs, err := emulateDeferWrap(wrapper, fn)
+	if err != nil || target == nil {
+		return err
+	}
+	d.fn = target
+	d.args = registerArguments(target, regs)
+	return nil
+}
+
+// abiIntRegs are the integer registers of the arguments in order
+var abiIntRegs = []x86asm.Reg{x86asm.RAX, x86asm.RBX, x86asm.RCX, x86asm.RDI, x86asm.RSI, x86asm.R8, x86asm.R9, x86asm.R10, x86asm.R11}
+
+// fullReg returns the 64 bits register of r, like RAX of EAX
+func fullReg(r x86asm.Reg) (x86asm.Reg, bool) {
+	switch {
+	case r >= x86asm.RAX && r <= x86asm.R15:
+		return r, true
+	case r >= x86asm.EAX && r <= x86asm.R15L:
+		return x86asm.RAX + (r - x86asm.EAX), true
+	}
+	return 0, false
+}
+
+// emulateDeferWrap follows the moves of the wrapper from the closure ctx, where the captured values are,
+// the immediates and the stack, until the call. The values unknown are not in the registers returned
+func emulateDeferWrap(wrapper *Function, ctx uint64) (*Function, map[x86asm.Reg]uint64, error) {
+	regs := map[x86asm.Reg]uint64{x86asm.RDX: ctx}
+	stack := map[int64]uint64{}
+	for pc := wrapper.lowpc; pc < wrapper.highpc; {
+		_, inst, err := disassembleInst(pc)
+		if err != nil {
+			return nil, nil, err
+		}
+		next := pc + uint64(inst.Len)
+		pc = next
+		switch inst.Op {
+		case x86asm.CALL:
+			rel, ok := inst.Args[0].(x86asm.Rel)
+			if !ok {
+				return nil, nil, nil
+			}
+			f, err := bi.findFunctionIncludePc(uint64(int64(next) + int64(rel)))
+			if err != nil || strings.HasPrefix(f.name, "runtime.morestack") {
+				return nil, nil, nil
+			}
+			return f, regs, nil
+		case x86asm.MOV, x86asm.LEA, x86asm.XOR:
+		default:
+			continue
+		}
+
+		var (
+			value uint64
+			known bool
+		)
+		switch src := inst.Args[1].(type) {
+		case x86asm.Imm:
+			value, known = uint64(src), true
+		case x86asm.Reg:
+			if r, ok := fullReg(src); ok {
+				value, known = regs[r]
+				if inst.Op == x86asm.XOR && src == inst.Args[0] {
+					value, known = 0, true
+				}
+			}
+		case x86asm.Mem:
+			switch {
+			case inst.Op == x86asm.LEA && src.Base == x86asm.RIP:
+				value, known = uint64(int64(next) + src.Disp), true
+			case inst.Op == x86asm.LEA:
+			case src.Base == x86asm.RSP:
+				value, known = stack[src.Disp]
+			case src.Index == 0:
+				if base, ok := regs[src.Base]; ok {
+					if w, err := readWord(uint64(int64(base) + src.Disp)); err == nil {
+						value, known = w, true
+					}
+				}
+			}
+		}
+		// the 32 bits moves clear the upper half
+		if known && (inst.MemBytes == 4 || inst.DataSize == 32) {
+			value &= 0xffffffff
+		}
+		switch dst := inst.Args[0].(type) {
+		case x86asm.Reg:
+			r, ok := fullReg(dst)
+			if !ok {
+				continue
+			}
+			if known && (inst.Op != x86asm.XOR || dst == inst.Args[1]) {
+				regs[r] = value
+			} else {
+				delete(regs, r)
+			}
+		case x86asm.Mem:
+			if dst.Base != x86asm.RSP {
+				continue
+			}
+			if known {
+				stack[dst.Disp] = value
+			} else {
+				delete(stack, dst.Disp)
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// registerArguments shows the arguments of f passed in regs, like returnValues does for the results
+func registerArguments(f *Function, regs map[x86asm.Reg]uint64) []string {
+	args := make([]string, 0)
+	intRegs := abiIntRegs
+	next := func() (uint64, bool) {
+		if len(intRegs) == 0 {
+			return 0, false
+		}
+		v, ok := regs[intRegs[0]]
+		intRegs = intRegs[1:]
+		return v, ok
+	}
+	for _, fv := range f.variables {
+		if fv.Tag != dwarf.TagFormalParameter {
+			continue
+		}
+		if isResult, _ := fv.Val(dwarf.AttrVarParam).(bool); isResult {
+			continue
+		}
+		name, _ := fv.Val(dwarf.AttrName).(string)
+		typ, err := bi.variableType(fv)
+		if err != nil {
+			return args
+		}
+		for {
+			if t, ok := typ.(*dwarf.TypedefType); ok {
+				typ = t.Type
+				continue
+			}
+			break
+		}
+		value := "?"
+		switch t := typ.(type) {
+		case *dwarf.IntType, *dwarf.UintType, *dwarf.BoolType:
+			if v, ok := next(); ok {
+				mem := make([]byte, 8)
+				binary.LittleEndian.PutUint64(mem, v)
+				value = formatBasicValue(typ, mem[:typ.Size()])
+			}
+		case *dwarf.PtrType:
+			if v, ok := next(); ok {
+				value = fmt.Sprintf("%#x", v)
+			}
+		case *dwarf.StructType:
+			if t.StructName != "string" {
+				// the layout of the other structs in the registers is not supported
+				return append(args, fmt.Sprintf("%s = ?", name))
+			}
+			ptr, ok1 := next()
+			n, ok2 := next()
+			if ok1 && ok2 {
+				if s, more, err := loadString(ptr, int64(n), loadConfig.maxStringLen); err == nil && more > 0 {
+					value = fmt.Sprintf("%q...+%d more", s, more)
+				} else if err == nil {
+					value = strconv.Quote(s)
+				}
+			}
+		default:
+			return append(args, fmt.Sprintf("%s = ?", name))
+		}
+		args = append(args, fmt.Sprintf("%s = %s", name, value))
+	}
+	return args
+}
@@ -1,15 +1,56 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"golang.org/x/arch/x86/x86asm"
+	"io/ioutil"
 	"os"
-	"path"
+	"strconv"
 	"strings"
-	"syscall"
 )
 
+// disassembleFlavor is the syntax of the instructions, intel or gnu, by `set disassemble-flavor`
+var disassembleFlavor = "intel"
+
+// stepiWindow is how many instructions are shown before and after the pc by stepi
+const stepiWindow = 3
+
+// SetDisassembleFlavor changes disassembleFlavor
+func SetDisassembleFlavor(flavor string) error {
+	if flavor != "intel" && flavor != "gnu" {
+		return fmt.Errorf("disassemble-flavor should be intel or gnu, not %s", flavor)
+	}
+	disassembleFlavor = flavor
+	return nil
+}
+
+// instSyntax prints inst at pc by disassembleFlavor, the targets are named by the functions
+func instSyntax(inst x86asm.Inst, pc uint64) string {
+	if disassembleFlavor == "gnu" {
+		return x86asm.GNUSyntax(inst, pc, symbolName)
+	}
+	return x86asm.IntelSyntax(inst, pc, symbolName)
+}
+
+// sourceLines returns the lines of the source, nil if it can't be read
+func sourceLines(filename string) []string {
+	content, err := ioutil.ReadFile(substitutePath(filename))
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(content), "\n")
+}
+
+// sourceLineText returns the line lineno of lines without the indents
+func sourceLineText(lines []string, lineno int) string {
+	if lineno <= 0 || lineno > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[lineno-1])
+}
+
 func disassemble(lowpc uint64, highpc uint64) (map[uint64]bool, [][]byte, []uint64,[]x86asm.Inst, error) {
 	if highpc - lowpc <= 0 {
 		return nil, nil, nil, nil, fmt.Errorf("[disassemble] invalid input: lowpc %d highpc %d", lowpc, highpc)
@@ -24,7 +65,7 @@ func disassemble(lowpc uint64, highpc uint64) (map[uint64]bool, [][]byte, []uint
 		pcMap map[uint64]bool
 		curMem []byte
 	)
-	if n, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(lowpc), mem); err != nil {
+	if n, err = ptracePeekData(cmd.Process.Pid, uintptr(lowpc), mem); err != nil {
 		return nil, nil, nil, nil, err
 	}
 	mem = mem[:n]
@@ -67,6 +108,83 @@ func disassemble(lowpc uint64, highpc uint64) (map[uint64]bool, [][]byte, []uint
 	return pcMap, memSlice, pcs, asmInsts, nil
 }
 
+// disassembleInst decodes the instruction at pc, the int3 of breakpoints are replaced by the original bytes
+func disassembleInst(pc uint64) ([]byte, x86asm.Inst, error) {
+	mem := make([]byte, 16)
+	n, err := ptracePeekData(cmd.Process.Pid, uintptr(pc), mem)
+	if err != nil {
+		return nil, x86asm.Inst{}, err
+	}
+	mem = mem[:n]
+	for _, info := range bp.infos {
+		if info.original != nil && pc <= info.pc && info.pc < pc + uint64(len(mem)) {
+			copy(mem[info.pc - pc:], info.original)
+		}
+	}
+	inst, err := x86asm.Decode(mem, 64)
+	if err != nil {
+		return nil, x86asm.Inst{}, err
+	}
+	return mem[:inst.Len], inst, nil
+}
+
+// listInstructionByPtracePc shows where stepi stops, the source line and stepiWindow instructions around the pc
+// in the function
+func listInstructionByPtracePc() error {
+	pc, err := getPtracePc()
+	if err != nil {
+		return err
+	}
+	mem, inst, err := disassembleInst(pc)
+	if err != nil {
+		return err
+	}
+	filename, lineno, err := bi.pcTofileLine(pc)
+	if err != nil {
+		return err
+	}
+	fname := "?"
+	f, ferr := bi.findFunctionIncludePc(pc)
+	if ferr == nil {
+		fname = f.name
+	}
+	fmt.Fprintf(stdout,"current process pc = %d\n", pc)
+	fmt.Fprintf(stdout,"%s at %s:%d\n", fname, tryCuttingFilename(filename), lineno)
+	if text := sourceLineText(sourceLines(filename), lineno); text != "" {
+		fmt.Fprintf(stdout, "%d:\t%s\n", lineno, highlightSource(text))
+	}
+
+	var (
+		mems  [][]byte
+		pcs   []uint64
+		insts []x86asm.Inst
+	)
+	if ferr == nil {
+		_, mems, pcs, insts, err = disassemble(f.lowpc, f.highpc)
+	}
+	cur := -1
+	for i := range pcs {
+		if pcs[i] == pc {
+			cur = i
+		}
+	}
+	// the pc is not at an instruction decoded from the beginning of the function
+	if err != nil || cur < 0 {
+		fmt.Fprintf(stdout,"===> %-7d %-20x %s\n", pc, mem, instSyntax(inst, pc))
+		return nil
+	}
+	for i := cur - stepiWindow; i <= cur+stepiWindow; i++ {
+		if i < 0 || i >= len(pcs) {
+			continue
+		}
+		mark := "     "
+		if i == cur {
+			mark = "===> "
+		}
+		fmt.Fprintf(stdout, "%s%-7d %-20x %s\n", mark, pcs[i], mems[i], instSyntax(insts[i], pcs[i]))
+	}
+	return nil
+}
 
 func tryCuttingFilename(filename string) string {
 	var (
@@ -83,49 +201,125 @@ func tryCuttingFilename(filename string) string {
 	return filename
 }
 
-func listDisassembleByPtracePc() error {
-	var (
-		pc uint64
-		pcs []uint64
-		amsInsts []x86asm.Inst
-		err error
-		filename string
-		lineno int
-		f *Function
-		mems [][]byte
-		pcBpMap map[uint64]bool
-	)
+// disassembleRange returns the addresses `disassemble [locspec|-range a,b]` shows, the function of the frame
+// selected without args, or the function where locspec is
+func disassembleRange(args []string) (uint64, uint64, error) {
+	if len(args) == 2 && args[0] == "-range" {
+		sps := strings.Split(args[1], ",")
+		if len(sps) != 2 {
+			return 0, 0, fmt.Errorf("wrong range `%s`, expect like 0x4b6300,0x4b6340", args[1])
+		}
+		lowpc, err1 := strconv.ParseUint(sps[0], 0, 64)
+		highpc, err2 := strconv.ParseUint(sps[1], 0, 64)
+		if err1 != nil || err2 != nil || lowpc >= highpc {
+			return 0, 0, fmt.Errorf("wrong range `%s`, expect like 0x4b6300,0x4b6340", args[1])
+		}
+		return lowpc, highpc, nil
+	}
+	if len(args) > 1 {
+		return 0, 0, errors.New("expect a location or -range a,b")
+	}
+	var pc uint64
+	switch {
+	case len(args) == 0:
+		frame, err := selectedFrame()
+		if err != nil {
+			return 0, 0, err
+		}
+		pc = frame.pc
+	case strings.HasPrefix(args[0], "*"):
+		var err error
+		if pc, err = strconv.ParseUint(args[0][1:], 0, 64); err != nil {
+			return 0, 0, fmt.Errorf("wrong address `%s`", args[0][1:])
+		}
+	default:
+		filename, lineno, err := parseListLoc(args[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		if pc, err = bi.fileLineToPc(filename, lineno); err != nil {
+			return 0, 0, err
+		}
+	}
+	f, err := bi.findFunctionIncludePc(pc)
+	if err != nil {
+		return 0, 0, err
+	}
+	return f.lowpc, f.highpc, nil
+}
 
-	if pc, err = getPtracePc(); err != nil {
-		return err
+// symbolName names the address by the function including it, for the call and the jump targets
+func symbolName(addr uint64) (string, uint64) {
+	f, err := bi.findFunctionIncludePc(addr)
+	if err != nil {
+		return "", 0
 	}
-	if f, err = bi.findFunctionIncludePc(pc); err != nil {
-		return err
+	return f.name, f.lowpc
+}
+
+// branchTarget returns `; fn+0x12` for the relative jumps into the middle of a function, the ones to the
+// beginning are named by the syntax already
+func branchTarget(inst x86asm.Inst, pc uint64) string {
+	for _, arg := range inst.Args {
+		rel, ok := arg.(x86asm.Rel)
+		if !ok {
+			continue
+		}
+		target := pc + uint64(inst.Len) + uint64(int64(rel))
+		if name, base := symbolName(target); name != "" && target != base {
+			return fmt.Sprintf("  ; %s+%#x", name, target-base)
+		}
 	}
-	if pcBpMap, mems, pcs, amsInsts, err = disassemble(f.lowpc, f.highpc); err != nil {
+	return ""
+}
+
+// listDisassemble prints the instructions in [lowpc, highpc) with the addresses, the offsets in the functions and
+// the bytes, the source line is printed before its instructions. `=>` marks the pc of the frame selected and `*`
+// the breakpoints
+func listDisassemble(lowpc uint64, highpc uint64) error {
+	breaks, mems, pcs, insts, err := disassemble(lowpc, highpc)
+	if err != nil {
 		return err
 	}
-	out := make([]string, 0, len(amsInsts))
-
-	fmt.Fprintf(stdout,"current process pc = %d\n", pc)
-	for i, amsInst := range amsInsts {
-		curpc := pcs[i]
-		if filename, lineno, err = bi.pcTofileLine(curpc); err != nil {
-			return err
+	current := uint64(0)
+	if frame, err := selectedFrame(); err == nil {
+		current = frame.pc
+	}
+	var (
+		fn       *Function
+		filename string
+		lineno   int
+		sources  = make(map[string][]string)
+	)
+	for i, inst := range insts {
+		pc := pcs[i]
+		if f, err := bi.findFunctionIncludePc(pc); err == nil && f != fn {
+			fn = f
+			fmt.Fprintf(stdout, "%s:\n", f.name)
+		}
+		if file, line, err := bi.pcTofileLine(pc); err == nil && (file != filename || line != lineno) {
+			filename, lineno = file, line
+			if _, ok := sources[file]; !ok {
+				sources[file] = sourceLines(file)
+			}
+			fmt.Fprintf(stdout, "%s:%d\t%s\n", tryCuttingFilename(file), line, highlightSource(sourceLineText(sources[file], line)))
 		}
 
-		bpFlag := " "
-		if pcBpMap[curpc] {
-			bpFlag ="."
+		mark := "  "
+		if pc <= current && current < pc+uint64(inst.Len) {
+			mark = "=>"
 		}
-		if i < len(pcs) - 1 && pcs[i] <= pc && pc < pcs[i + 1] {
-			bpFlag += "===> "
+		if breaks[pc] {
+			mark += "*"
 		} else {
-			bpFlag += "     "
+			mark += " "
 		}
-
-		out = append(out, fmt.Sprintf("%s%s:%-7d %-7d %-20x %s\n",bpFlag, path.Base(filename), lineno, curpc, mems[i], amsInst.String()))
+		offset := ""
+		if fn != nil && fn.lowpc <= pc && pc < fn.highpc {
+			offset = fmt.Sprintf("<+%d>", pc-fn.lowpc)
+		}
+		fmt.Fprintf(stdout, "%s %#x %-7s %-20x %s%s\n", mark, pc, offset, mems[i],
+			instSyntax(inst, pc), branchTarget(inst, pc))
 	}
-	fmt.Fprintln(stdout, strings.Join(out, ""))
 	return nil
-}
\ No newline at end of file
+}
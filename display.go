@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+)
+
+// Display is an expression shown every time the debuggee stops
+type Display struct {
+	id int
+	expr string
+}
+
+// displays are shown in the order they are added by `display`
+var (
+	displays []*Display
+	lastDisplayId int
+)
+
+// String evaluates the expression of the display where the debuggee stops, the errors are shown as the values
+func (d *Display) String() string {
+	value, err := formatExpr(d.expr)
+	if err != nil {
+		value = fmt.Sprintf("<%v>", err)
+	}
+	return fmt.Sprintf("%d: %s = %s", d.id, d.expr, value)
+}
+
+// AddDisplay adds the expression shown every time the debuggee stops
+func AddDisplay(expr string) (*Display, error) {
+	if _, err := parser.ParseExpr(expr); err != nil {
+		return nil, err
+	}
+	lastDisplayId++
+	d := &Display{id: lastDisplayId, expr: expr}
+	displays = append(displays, d)
+	return d, nil
+}
+
+// RemoveDisplay removes the display whose id is id
+func RemoveDisplay(id int) (*Display, error) {
+	for i, d := range displays {
+		if d.id == id {
+			displays = append(displays[:i:i], displays[i+1:]...)
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("can't find display %d", id)
+}
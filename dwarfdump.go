@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dumpDwarf prints the debug info of `dump-dwarf info|line|frame [filter]`. filter is a function or a compile unit,
+// all of them are printed without it
+func dumpDwarf(kind string, filter string) error {
+	if bi == nil {
+		return NoProcessRuning
+	}
+	if err := bi.requireDwarf("the debug sections"); err != nil {
+		return err
+	}
+	switch kind {
+	case "info":
+		return dumpDwarfInfo(filter)
+	case "line":
+		return dumpDwarfLine(filter)
+	case "frame":
+		return dumpDwarfFrame(filter)
+	}
+	return fmt.Errorf("unknown dump-dwarf `%s`, expect info, line or frame", kind)
+}
+
+func notFoundDumpFilter(filter string) error {
+	return fmt.Errorf("can't find the function or the compile unit `%s`", filter)
+}
+
+// dumpDwarfInfo prints the DIEs of the function or the compile unit filter with their children, indented by
+// the depth
+func dumpDwarfInfo(filter string) error {
+	var (
+		r        = bi.DwarfData.Reader()
+		printing = filter == ""
+		found    = false
+		depth    = 0
+		top      = 0
+	)
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			depth--
+			if filter != "" && printing && depth == top {
+				printing = false
+			}
+			continue
+		}
+		if !printing && (e.Tag == dwarf.TagCompileUnit || e.Tag == dwarf.TagSubprogram) && e.Val(dwarf.AttrName) == filter {
+			printing, found, top = true, true, depth
+		}
+		if printing {
+			printDie(e, depth-top)
+		}
+		if e.Children {
+			depth++
+		} else if filter != "" && printing && depth == top {
+			printing = false
+		}
+	}
+	if filter != "" && !found {
+		return notFoundDumpFilter(filter)
+	}
+	return nil
+}
+
+func printDie(e *dwarf.Entry, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(stdout, "%s<%#x> %s\n", indent, e.Offset, e.Tag)
+	for _, field := range e.Field {
+		fmt.Fprintf(stdout, "%s    %s %s\n", indent, field.Attr, dieValue(field))
+	}
+}
+
+func dieValue(field dwarf.Field) string {
+	switch v := field.Val.(type) {
+	case []byte:
+		return fmt.Sprintf("[% x]", v)
+	case dwarf.Offset:
+		return fmt.Sprintf("<%#x>", uint64(v))
+	case uint64:
+		if field.Class == dwarf.ClassAddress {
+			return fmt.Sprintf("%#x", v)
+		}
+	}
+	return fmt.Sprintf("%v", field.Val)
+}
+
+// dumpDwarfLine prints the rows of the line table of the compile unit filter, or the rows in the function filter
+func dumpDwarfLine(filter string) error {
+	var (
+		cus  []*dwarf.Entry
+		low  uint64
+		high = ^uint64(0)
+		r    = bi.DwarfData.Reader()
+	)
+	if f, err := bi.findFunctionByName(filter); filter != "" && err == nil {
+		cu, err := r.SeekPC(f.lowpc)
+		if err != nil {
+			return err
+		}
+		cus, low, high = []*dwarf.Entry{cu}, f.lowpc, f.highpc
+	} else {
+		for {
+			e, err := r.Next()
+			if err != nil {
+				return err
+			}
+			if e == nil {
+				break
+			}
+			if e.Tag == dwarf.TagCompileUnit && (filter == "" || e.Val(dwarf.AttrName) == filter) {
+				cus = append(cus, e)
+			}
+			r.SkipChildren()
+		}
+		if len(cus) == 0 {
+			return notFoundDumpFilter(filter)
+		}
+	}
+
+	for _, cu := range cus {
+		lr, err := bi.DwarfData.LineReader(cu)
+		if err != nil {
+			return err
+		}
+		if lr == nil {
+			continue
+		}
+		fmt.Fprintf(stdout, "%s\n", cu.Val(dwarf.AttrName))
+		var entry dwarf.LineEntry
+		for {
+			if err = lr.Next(&entry); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			if entry.Address < low || entry.Address >= high {
+				continue
+			}
+			flags := ""
+			if entry.IsStmt {
+				flags += " stmt"
+			}
+			if entry.PrologueEnd {
+				flags += " prologue_end"
+			}
+			if entry.EndSequence {
+				flags += " end_sequence"
+			}
+			filename := ""
+			if entry.File != nil {
+				filename = substitutePath(entry.File.Name)
+			}
+			fmt.Fprintf(stdout, "    %#x %s:%d%s\n", entry.Address, filename, entry.Line, flags)
+		}
+	}
+	return nil
+}
+
+// dumpDwarfFrame prints the FDEs of the function filter, or of the functions of the compile unit filter, with the
+// cfa instructions decoded
+func dumpDwarfFrame(filter string) error {
+	var functions []*Function
+	if filter != "" {
+		if f, err := bi.findFunctionByName(filter); err == nil {
+			functions = []*Function{f}
+		} else if cu := findCompileUnitByName(filter); cu != nil {
+			var err error
+			if functions, err = bi.compileUnitFunctions(cu); err != nil {
+				return err
+			}
+		} else {
+			return notFoundDumpFilter(filter)
+		}
+	}
+	included := func(fde *FrameDescriptionEntry) bool {
+		if filter == "" {
+			return true
+		}
+		for _, f := range functions {
+			if fde.begin <= f.lowpc && f.lowpc < fde.begin+fde.size {
+				return true
+			}
+		}
+		return false
+	}
+	for _, info := range bi.FramesInformation {
+		if info == nil || info.FDE == nil || !included(info.FDE) {
+			continue
+		}
+		fde := info.FDE
+		name := ""
+		if f, err := bi.findFunctionIncludePc(fde.begin); err == nil {
+			name = " " + f.name
+		}
+		fmt.Fprintf(stdout, "FDE %#x-%#x%s length %d\n", fde.begin, fde.begin+fde.size, name, fde.length)
+		if fde.CIE != nil {
+			fmt.Fprintf(stdout, "    CIE version %d code_alignment_factor %d data_alignment_factor %d return_address_register %d\n",
+				fde.CIE.version, fde.CIE.code_alignment_factor, fde.CIE.data_alignment_factor, fde.CIE.return_address_register)
+		}
+		for _, ins := range cfaInstructions(fde.instructions, fde.CIE, fde.begin) {
+			fmt.Fprintf(stdout, "    %s\n", ins)
+		}
+	}
+	return nil
+}
+
+func findCompileUnitByName(name string) *CompileUnit {
+	for _, cu := range bi.CompileUnits {
+		if cu.name == name {
+			return cu
+		}
+	}
+	return nil
+}
+
+// cfaInstructions decodes the cfa instructions like execSingleInstruction reads them, loc is where the
+// instructions begin. The unknown one ends the decoding, the nops are skipped
+func cfaInstructions(instructions []byte, cie *CommonInformationEntry, loc uint64) []string {
+	var (
+		buf       = bytes.NewBuffer(instructions)
+		lines     = make([]string, 0)
+		codeAlign = uint64(1)
+		dataAlign = int64(1)
+	)
+	if cie != nil {
+		codeAlign, dataAlign = cie.code_alignment_factor, cie.data_alignment_factor
+	}
+	advance := func(name string, delta uint64) {
+		loc += delta * codeAlign
+		lines = append(lines, fmt.Sprintf("%s %d to %#x", name, delta*codeAlign, loc))
+	}
+	for buf.Len() > 0 {
+		op, _ := buf.ReadByte()
+		switch op & high_2_bits {
+		case DW_CFA_advance_loc:
+			advance("DW_CFA_advance_loc", uint64(op&low_6_offset))
+			continue
+		case DW_CFA_offset:
+			offset, _, _ := DecodeULEB128(buf)
+			lines = append(lines, fmt.Sprintf("DW_CFA_offset r%d at cfa%+d", op&low_6_offset, int64(offset)*dataAlign))
+			continue
+		case DW_CFA_restore:
+			lines = append(lines, fmt.Sprintf("DW_CFA_restore r%d", op&low_6_offset))
+			continue
+		}
+		switch op {
+		case DW_CFA_nop:
+			// the padding of the entry
+		case DW_CFA_advance_loc1:
+			delta, _ := buf.ReadByte()
+			advance("DW_CFA_advance_loc1", uint64(delta))
+		case DW_CFA_advance_loc2:
+			var delta uint16
+			binary.Read(buf, binary.LittleEndian, &delta)
+			advance("DW_CFA_advance_loc2", uint64(delta))
+		case DW_CFA_advance_loc4:
+			var delta uint32
+			binary.Read(buf, binary.LittleEndian, &delta)
+			advance("DW_CFA_advance_loc4", uint64(delta))
+		case DW_CFA_offset_extended:
+			reg, _, _ := DecodeULEB128(buf)
+			offset, _, _ := DecodeULEB128(buf)
+			lines = append(lines, fmt.Sprintf("DW_CFA_offset_extended r%d at cfa%+d", reg, int64(offset)*dataAlign))
+		case DW_CFA_def_cfa:
+			reg, _, _ := DecodeULEB128(buf)
+			offset, _, _ := DecodeULEB128(buf)
+			lines = append(lines, fmt.Sprintf("DW_CFA_def_cfa r%d%+d", reg, offset))
+		case DW_CFA_def_cfa_register:
+			reg, _, _ := DecodeULEB128(buf)
+			lines = append(lines, fmt.Sprintf("DW_CFA_def_cfa_register r%d", reg))
+		case DW_CFA_def_cfa_offset:
+			offset, _, _ := DecodeULEB128(buf)
+			lines = append(lines, fmt.Sprintf("DW_CFA_def_cfa_offset %d", offset))
+		case DW_CFA_def_cfa_offset_sf:
+			offset, _, _ := DecodeSLEB128(buf)
+			lines = append(lines, fmt.Sprintf("DW_CFA_def_cfa_offset_sf %d", offset*dataAlign))
+		default:
+			lines = append(lines, fmt.Sprintf("DW_CFA_%#x [% x]", op, buf.Bytes()))
+			return lines
+		}
+	}
+	return lines
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"strings"
+)
+
+// Section is a section of the executable file, Size is the one uncompressed and FileSize is the one in the file
+type Section struct {
+	Name     string
+	Addr     uint64
+	Size     uint64
+	FileSize uint64
+	Flags    elf.SectionFlag
+	// Compressed is true for the sections with SHF_COMPRESSED and the .zdebug ones by zlib
+	Compressed bool
+}
+
+// Segment is a program header of the executable file, the loadable ones are mapped at Vaddr. Name is the one of
+// the segment of Mach-O like __TEXT, it is empty for ELF
+type Segment struct {
+	Name   string
+	Type   elf.ProgType
+	Offset uint64
+	Vaddr  uint64
+	Memsz  uint64
+	Filesz uint64
+	Flags  elf.ProgFlag
+}
+
+// Sections returns the sections of the executable file in order
+func (bi *BI) Sections() []Section {
+	return bi.sections
+}
+
+// Segments returns the program headers of the executable file in order
+func (bi *BI) Segments() []Segment {
+	return bi.segments
+}
+
+func (bi *BI) loadSections(file *mappedFile) {
+	bi.segments = file.segments()
+	if file.macho != nil {
+		bi.loadMachoSections(file.macho)
+		return
+	}
+	for _, s := range file.elf.Sections {
+		if s.Type == elf.SHT_NULL {
+			continue
+		}
+		bi.sections = append(bi.sections, Section{Name: s.Name, Addr: s.Addr, Size: s.Size, FileSize: s.FileSize,
+			Flags: s.Flags, Compressed: s.Flags&elf.SHF_COMPRESSED != 0 || strings.HasPrefix(s.Name, ".zdebug")})
+	}
+}
+
+// loadMachoSections names the sections of Mach-O like `__TEXT,__text` since the segments may have the same ones.
+// The flags of ELF are told by the protection of the segment and the attributes of the section
+func (bi *BI) loadMachoSections(f *macho.File) {
+	for _, s := range f.Sections {
+		var flags elf.SectionFlag
+		if seg := f.Segment(s.Seg); seg != nil && seg.Memsz > 0 {
+			flags |= elf.SHF_ALLOC
+			if seg.Prot&machoProtWrite != 0 {
+				flags |= elf.SHF_WRITE
+			}
+		}
+		if s.Flags&(machoPureCode|machoSomeCode) != 0 {
+			flags |= elf.SHF_EXECINSTR
+		}
+		size := s.Size
+		if typ := s.Flags & machoSectionType; typ == machoZerofill || typ == machoGbZerofill || typ == machoTlsZerofill {
+			size = 0
+		}
+		bi.sections = append(bi.sections, Section{Name: s.Seg + "," + s.Name, Addr: s.Addr, Size: s.Size,
+			FileSize: size, Flags: flags, Compressed: strings.HasPrefix(s.Name, "__zdebug")})
+	}
+}
+
+// sectionFlags are the flags like readelf, W is writable, A is allocated, X is executable and C is compressed
+func sectionFlags(s Section) string {
+	flags := ""
+	if s.Flags&elf.SHF_WRITE != 0 {
+		flags += "W"
+	}
+	if s.Flags&elf.SHF_ALLOC != 0 {
+		flags += "A"
+	}
+	if s.Flags&elf.SHF_EXECINSTR != 0 {
+		flags += "X"
+	}
+	if s.Compressed {
+		flags += "C"
+	}
+	return flags
+}
+
+func segmentFlags(p Segment) string {
+	flags := []byte("   ")
+	if p.Flags&elf.PF_R != 0 {
+		flags[0] = 'R'
+	}
+	if p.Flags&elf.PF_W != 0 {
+		flags[1] = 'W'
+	}
+	if p.Flags&elf.PF_X != 0 {
+		flags[2] = 'E'
+	}
+	return string(flags)
+}
+
+func printSections() {
+	fmt.Fprintf(stdout, "%-4s %-24s %-18s %-10s %-10s %s\n", "Nr", "Name", "Address", "Size", "FileSize", "Flags")
+	for i, s := range bi.Sections() {
+		line := fmt.Sprintf("%-4d %-24s %#-18x %#-10x %#-10x %s", i+1, s.Name, s.Addr, s.Size, s.FileSize, sectionFlags(s))
+		fmt.Fprintf(stdout, "%s\n", strings.TrimRight(line, " "))
+	}
+}
+
+func printSegments() {
+	fmt.Fprintf(stdout, "%-14s %-10s %-18s %-10s %-10s %s\n", "Type", "Offset", "VirtAddr", "MemSize", "FileSize", "Flags")
+	for _, p := range bi.Segments() {
+		typ := strings.TrimPrefix(p.Type.String(), "PT_")
+		if p.Name != "" {
+			typ = p.Name
+		}
+		line := fmt.Sprintf("%-14s %#-10x %#-18x %#-10x %#-10x %s", typ, p.Offset, p.Vaddr, p.Memsz, p.Filesz,
+			segmentFlags(p))
+		fmt.Fprintf(stdout, "%s\n", strings.TrimRight(line, " "))
+	}
+}
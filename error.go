@@ -1,13 +1,17 @@
 package main
 
 import (
+	"debug/dwarf"
 	"errors"
 	"fmt"
+	"strings"
+	"syscall"
 )
 
 var NotFoundSourceLineErr = errors.New("cant't find this source line")
 var HasExistedBreakPointErr = errors.New("this breakpoint has existed")
 var NoProcessRuning = errors.New("there is no process running")
+var NoHardwareBreakPointErr = errors.New("all 4 hardware breakpoints are used")
 
 type NotFoundFuncErr struct {
 	pc uint64
@@ -17,8 +21,66 @@ func (e *NotFoundFuncErr) Error() string {
 	return fmt.Sprintf("findFunctionIncludePc can't find function by pc:%d", e.pc)
 }
 
+type NotFoundFuncNameErr struct {
+	name string
+}
+
+func (e *NotFoundFuncNameErr) Error() string {
+	return fmt.Sprintf("can't find function %s", e.name)
+}
+
+type NotFoundBreakPointErr struct {
+	id int
+}
+
+func (e *NotFoundBreakPointErr) Error() string {
+	return fmt.Sprintf("can't find breakpoint %d", e.id)
+}
+
+// NotRunningGoroutineErr is returned when the registers of the goroutine selected are changed, it is not on any thread
+type NotRunningGoroutineErr struct {
+	id uint64
+}
+
+func (e *NotRunningGoroutineErr) Error() string {
+	return fmt.Sprintf("goroutine %d is not running on any thread", e.id)
+}
+
+type NotFoundVariableErr struct {
+	name string
+}
+
+func (e *NotFoundVariableErr) Error() string {
+	return fmt.Sprintf("can't find variable %s", e.name)
+}
+
+type UnsupportGoVersionErr struct {
+	version goVersion
+}
+
+func (e *UnsupportGoVersionErr) Error() string {
+	return fmt.Sprintf("the binary is built by %s, godbg supports %s and newer", e.version, minGoVersion)
+}
+
+// NoDwarfErr is returned by what reads the debug info of the binary built by -ldflags=-w or -s
+type NoDwarfErr struct {
+	what string
+}
+
+func (e *NoDwarfErr) Error() string {
+	return fmt.Sprintf("%s are unavailable, the binary has no DWARF, rebuild it without -ldflags=-w or -s", e.what)
+}
+
+type UnsupportVariableErr struct {
+	entry *dwarf.Entry
+}
+
+func (e *UnsupportVariableErr) Error() string {
+	return fmt.Sprintf("not support dwarf variable %#v", e.entry)
+}
+
 func printHelper() {
-	fmt.Fprintf(stderr, "%s\n", "Usage:\n\tJust like `godbg debug ./main.go`.\n\tThe `main.go` is the file which you want debug.")
+	fmt.Fprintf(stderr, "%s\n", "Usage:\n\tJust like `godbg debug ./main.go [args...]` or `godbg debug [./pkg] [args...]`.\n\tThe `main.go` or the package is what you want debug, it is built without optimizations, `args` are passed to it.\n\tOr `godbg replay ./main.go [args...]`, it is recorded by rr and replayed, which can run backwards.\n\tOr `godbg dap [addr]`, the editors drive it by the debug adapter protocol on stdio or the tcp addr.\n\tAdd `--headless --listen=addr` to debug or replay, the json-rpc api is served at addr instead of the prompt.\n\tAdd `--init ~/.godbgrc` or `-x commands.txt` before main.go, the commands in the files run before the prompt.\n\tThe defaults like the load limits and the aliases are read from ~/.config/godbg/config.yml, `config -save` writes it.\n\tThe output is colored on the terminal, add `--no-color` or set NO_COLOR to turn it off.\n\tAdd `--json`, the breakpoints, the states, the frames, the goroutines, the locals and the values are printed as json.\n\tAdd `--tui`, the source, the disassembly, the goroutines and the stack are drawn above the prompt on every stop.\n\tAdd `--log[=dwarf,proc,rpc]`, the components log to stderr at debug, `--log-level=trace`, `--log-format=logfmt` and `--log-output=file:/path` change them.\n\tThe log file is rotated beyond `--log-max-size=10M`, `--log-backups=3` old ones are kept.\n\tThe index of the debug info is cached in ~/.cache/godbg/index by the build ID, add `--no-index-cache` to parse it every time.\n\tAdd `--profile cpu.out`, the cpu of the session is profiled into cpu.out for `go tool pprof`.\n\tOr `godbg gdbserver :1234 ./main.go [args...]`, gdb connects to it by `target remote :1234`.\n\tOr `godbg remote host:1234 ./prog`, the executable `prog` runs under the gdb server at host:1234, like `qemu-x86_64 -g 1234`.\n\tOr `godbg trace [--exit] [--pid N | ./main.go] regexp [args...]`, the calls of the functions matching regexp are logged, with the returns too by --exit.\n\tOr `godbg core ./prog core`, the core file dumped by `prog` is inspected after it crashes.\n\tOr `godbg attach pid [--exe path]`, the running process is debugged, its binary is /proc/<pid>/exe by default.\n\tOr `godbg exec ./prog -- -flag val args...`, the binary built already runs with the args after `--` and the environment of godbg.\n\tOr `godbg test [./pkg] [-- -test.run TestFoo]`, the test binary of the package is built and debugged.")
 }
 
 func printUnsupportCmd(cmd string) {
@@ -33,6 +95,21 @@ func printNotFoundSourceLineErr(place string) {
 	fmt.Fprintf(stderr, "can't find this source line %s\n", place)
 }
 
+func printStaleSource(filename string) {
+	fmt.Fprintf(stderr, "warning: %s is modified after the binary is built, the lines may not match\n", substitutePath(filename))
+}
+
+// printOptimized warns the breakpoints and the values in the optimized function name
+func printOptimized(name string) {
+	fmt.Fprintf(stderr, "warning: %s is optimized, the value may be inaccurate, compile with -gcflags=all='-N -l'\n", name)
+}
+
+// printNoDwarf tells what can't work after the binary without DWARF is analyzed
+func printNoDwarf(execfile string) {
+	fmt.Fprintf(stderr, "warning: %s has no DWARF, the functions, the lines and the frames are read from .gopclntab and the frame pointers. `%s` are unavailable, rebuild it without -ldflags=-w or -s\n",
+		execfile, strings.Join(noDwarfCommands, "`, `"))
+}
+
 func printErr(err error) {
 	fmt.Fprintf(stderr,"%s\n", err.Error())
 }
@@ -44,4 +121,12 @@ func printNoProcessErr() {
 func printExit0(opid int) {
 	fmt.Fprintf(stderr,"Process %d has exited with status 0\n", opid)
 
+}
+
+func printExit(opid int, status int) {
+	fmt.Fprintf(stderr,"Process %d has exited with status %d\n", opid, status)
+}
+
+func printKilled(opid int, sig syscall.Signal) {
+	fmt.Fprintf(stderr,"Process %d has been killed by signal %s\n", opid, sig)
 }
\ No newline at end of file
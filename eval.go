@@ -0,0 +1,372 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"math"
+)
+
+// evalExpr evaluates the go expression `expr` with the variables where the debuggee stops. The identifiers
+// are the locals, the arguments and the package variables, which are selected, indexed and dereferenced
+// like `p.x`, `a[i]` and `*p`, the interfaces are asserted like `(T)(x)`. The values are numbers, bools and strings, the pointers are their addresses
+// and `&x` is the address of x
+func evalExpr(expr string) (constant.Value, error) {
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return evalNode(node)
+}
+
+// evalCondition evaluates the condition of a breakpoint, it must be a bool
+func evalCondition(cond string) (bool, error) {
+	v, err := evalExpr(cond)
+	if err != nil {
+		return false, err
+	}
+	if v.Kind() != constant.Bool {
+		return false, fmt.Errorf("condition `%s` is %s, not bool", cond, v.String())
+	}
+	return constant.BoolVal(v), nil
+}
+
+func evalNode(node ast.Expr) (constant.Value, error) {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return evalNode(n.X)
+	case *ast.BasicLit:
+		v := constant.MakeFromLiteral(n.Value, n.Kind, 0)
+		if v.Kind() == constant.Unknown {
+			return nil, fmt.Errorf("invalid literal %s", n.Value)
+		}
+		return v, nil
+	case *ast.Ident:
+		switch n.Name {
+		case "true":
+			return constant.MakeBool(true), nil
+		case "false":
+			return constant.MakeBool(false), nil
+		case "nil":
+			return constant.MakeUint64(0), nil
+		}
+		return loadVariableValue(n.Name)
+	case *ast.SelectorExpr, *ast.StarExpr, *ast.CallExpr:
+		l, err := evalLvalue(n)
+		if err != nil {
+			return nil, err
+		}
+		return l.value()
+	case *ast.IndexExpr:
+		return evalIndex(n)
+	case *ast.UnaryExpr:
+		if n.Op == token.AND {
+			l, err := evalLvalue(n.X)
+			if err != nil {
+				return nil, err
+			}
+			if l.reg != "" {
+				return nil, fmt.Errorf("a variable in the register %s has no address", l.reg)
+			}
+			return constant.MakeUint64(l.addr), nil
+		}
+		x, err := evalNode(n.X)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case token.NOT:
+			if x.Kind() != constant.Bool {
+				return nil, fmt.Errorf("operator ! not defined on %s", x.String())
+			}
+		case token.ADD, token.SUB:
+			if !isNumber(x) {
+				return nil, fmt.Errorf("operator %s not defined on %s", n.Op, x.String())
+			}
+		case token.XOR:
+			if x.Kind() != constant.Int {
+				return nil, fmt.Errorf("operator %s not defined on %s", n.Op, x.String())
+			}
+		default:
+			return nil, fmt.Errorf("not support operator %s", n.Op)
+		}
+		return constant.UnaryOp(n.Op, x, 0), nil
+	case *ast.BinaryExpr:
+		return evalBinary(n)
+	}
+	return nil, fmt.Errorf("not support expression %T", node)
+}
+
+func evalBinary(n *ast.BinaryExpr) (constant.Value, error) {
+	x, err := evalNode(n.X)
+	if err != nil {
+		return nil, err
+	}
+	// && and || don't evaluate the right side if the left side decides
+	if n.Op == token.LAND || n.Op == token.LOR {
+		if x.Kind() != constant.Bool {
+			return nil, fmt.Errorf("operator %s not defined on %s", n.Op, x.String())
+		}
+		if constant.BoolVal(x) == (n.Op == token.LOR) {
+			return x, nil
+		}
+		y, err := evalNode(n.Y)
+		if err != nil {
+			return nil, err
+		}
+		if y.Kind() != constant.Bool {
+			return nil, fmt.Errorf("operator %s not defined on %s", n.Op, y.String())
+		}
+		return y, nil
+	}
+
+	y, err := evalNode(n.Y)
+	if err != nil {
+		return nil, err
+	}
+	mismatched := fmt.Errorf("mismatched types %s %s %s", x.String(), n.Op, y.String())
+	switch n.Op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if !(isNumber(x) && isNumber(y)) && x.Kind() != y.Kind() {
+			return nil, mismatched
+		}
+		if x.Kind() == constant.Bool && n.Op != token.EQL && n.Op != token.NEQ {
+			return nil, fmt.Errorf("operator %s not defined on %s", n.Op, x.String())
+		}
+		return constant.MakeBool(constant.Compare(x, n.Op, y)), nil
+	case token.ADD:
+		if x.Kind() == constant.String && y.Kind() == constant.String {
+			return constant.BinaryOp(x, n.Op, y), nil
+		}
+		fallthrough
+	case token.SUB, token.MUL, token.QUO:
+		if !isNumber(x) || !isNumber(y) {
+			return nil, mismatched
+		}
+		if n.Op == token.QUO {
+			if constant.Sign(y) == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			// integer division, see constant.BinaryOp
+			if x.Kind() == constant.Int && y.Kind() == constant.Int {
+				return constant.BinaryOp(x, token.QUO_ASSIGN, y), nil
+			}
+		}
+		return constant.BinaryOp(x, n.Op, y), nil
+	case token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+		if x.Kind() != constant.Int || y.Kind() != constant.Int {
+			return nil, mismatched
+		}
+		if n.Op == token.REM && constant.Sign(y) == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return constant.BinaryOp(x, n.Op, y), nil
+	case token.SHL, token.SHR:
+		s, ok := constant.Uint64Val(y)
+		if x.Kind() != constant.Int || y.Kind() != constant.Int || !ok {
+			return nil, fmt.Errorf("invalid shift %s %s %s", x.String(), n.Op, y.String())
+		}
+		return constant.Shift(x, n.Op, uint(s)), nil
+	}
+	return nil, fmt.Errorf("not support operator %s", n.Op)
+}
+
+func isNumber(v constant.Value) bool {
+	return v.Kind() == constant.Int || v.Kind() == constant.Float
+}
+
+// evalIndex evaluates `x[i]`, the byte of a string expression or the element of an array or a slice
+func evalIndex(n *ast.IndexExpr) (constant.Value, error) {
+	l, err := evalLvalue(n.X)
+	if err == nil {
+		if st, ok := resolveType(l.typ).(*dwarf.StructType); !ok || !isStringType(st) {
+			if l, err = evalLvalue(n); err != nil {
+				return nil, err
+			}
+			return l.value()
+		}
+	}
+	x, err := evalNode(n.X)
+	if err != nil {
+		return nil, err
+	}
+	if x.Kind() != constant.String {
+		return nil, fmt.Errorf("can't index %s", x.String())
+	}
+	idx, err := evalNode(n.Index)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := constant.Int64Val(idx)
+	if idx.Kind() != constant.Int || !ok {
+		return nil, fmt.Errorf("the index should be an integer, not %s", idx.String())
+	}
+	s := constant.StringVal(x)
+	if i < 0 || i >= int64(len(s)) {
+		return nil, fmt.Errorf("index out of range [%d] with length %d", i, len(s))
+	}
+	return constant.MakeUint64(uint64(s[i])), nil
+}
+
+// loadVariableValue loads the variable `name`, the one split in several registers is read by its pieces
+func loadVariableValue(name string) (constant.Value, error) {
+	l, err := evalLvalue(&ast.Ident{Name: name})
+	if err == nil {
+		return l.value()
+	}
+	if _, ok := err.(*UnsupportVariableErr); !ok {
+		return nil, err
+	}
+	entry, _, _ := findVariable(name)
+	frame, e := selectedFrame()
+	if entry == nil || e != nil {
+		return nil, err
+	}
+	typ, e := bi.variableType(entry)
+	if e != nil {
+		return nil, e
+	}
+	return loadVariable(entry, typ, frame)
+}
+
+// loadValue reads the value of type typ at addr of the debuggee
+func loadValue(typ dwarf.Type, addr uint64) (constant.Value, error) {
+	switch t := typ.(type) {
+	case *dwarf.TypedefType:
+		return loadValue(t.Type, addr)
+	case *dwarf.IntType, *dwarf.UintType, *dwarf.BoolType, *dwarf.FloatType:
+		mem := make([]byte, typ.Size())
+		if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+			return nil, err
+		}
+		if v, ok := decodeBasicValue(typ, mem); ok {
+			return v, nil
+		}
+	case *dwarf.StructType:
+		// string is struct { str *uint8; len int }, so are the named string types
+		if isStringType(t) {
+			header := make([]byte, 16)
+			if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), header); err != nil {
+				return nil, err
+			}
+			s, err := loadFullString(binary.LittleEndian.Uint64(header), int64(binary.LittleEndian.Uint64(header[8:])))
+			if err != nil {
+				return nil, err
+			}
+			return constant.MakeString(s), nil
+		}
+	}
+	return nil, fmt.Errorf("not support type %s", typ.String())
+}
+
+// decodeValue converts the memory of a number, bool or string read from the registers
+func decodeValue(typ dwarf.Type, mem []byte) (constant.Value, error) {
+	switch t := typ.(type) {
+	case *dwarf.TypedefType:
+		return decodeValue(t.Type, mem)
+	case *dwarf.IntType, *dwarf.UintType, *dwarf.BoolType, *dwarf.FloatType:
+		if v, ok := decodeBasicValue(typ, mem); ok {
+			return v, nil
+		}
+	case *dwarf.StructType:
+		if isStringType(t) && len(mem) == 16 {
+			s, err := loadFullString(binary.LittleEndian.Uint64(mem), int64(binary.LittleEndian.Uint64(mem[8:])))
+			if err != nil {
+				return nil, err
+			}
+			return constant.MakeString(s), nil
+		}
+	}
+	return nil, fmt.Errorf("not support type %s", typ.String())
+}
+
+// loadString reads the bytes of the string at data whose length is strlen, up to max.
+// The bytes not read are counted
+func loadString(data uint64, strlen int64, max int) (string, int64, error) {
+	if strlen < 0 {
+		return "", 0, fmt.Errorf("strlen %d shoulde be < 0", strlen)
+	}
+	more := int64(0)
+	if strlen > int64(max) {
+		strlen, more = int64(max), strlen - int64(max)
+	}
+	str := make([]byte, strlen)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(data), str); err != nil {
+		return "", 0, err
+	}
+	return string(str), more, nil
+}
+
+// loadStringAt reads the header of the string at addr and its bytes up to max
+func loadStringAt(addr uint64, max int) (string, int64, error) {
+	header := make([]byte, 16)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), header); err != nil {
+		return "", 0, err
+	}
+	return loadString(binary.LittleEndian.Uint64(header), int64(binary.LittleEndian.Uint64(header[8:])), max)
+}
+
+// loadFullString reads the whole string for the evaluator, which compares and concatenates the bytes which
+// are not shown. The length beyond maxMemoryLength is taken as garbage and rejected before reading
+func loadFullString(data uint64, strlen int64) (string, error) {
+	if strlen < 0 || strlen > maxMemoryLength {
+		return "", fmt.Errorf("the length %d of the string at %#x should be from 0 to %d bytes", strlen, data, maxMemoryLength)
+	}
+	s, _, err := loadString(data, strlen, int(strlen))
+	return s, err
+}
+
+// isSliceType tells whether the struct is the layout of a slice
+func isSliceType(t *dwarf.StructType) bool {
+	return len(t.Field) == 3 && t.Field[0].Name == "array" && t.Field[1].Name == "len" && t.Field[2].Name == "cap"
+}
+
+// isStringType tells whether the struct is the layout of string
+func isStringType(t *dwarf.StructType) bool {
+	return t.StructName == "string" || (len(t.Field) == 2 && t.Field[0].Name == "str" && t.Field[1].Name == "len")
+}
+
+// decodeBasicValue converts the memory of a number or bool
+func decodeBasicValue(typ dwarf.Type, mem []byte) (constant.Value, bool) {
+	size := len(mem)
+	switch typ.(type) {
+	case *dwarf.IntType:
+		switch size {
+		case 1:
+			return constant.MakeInt64(int64(int8(mem[0]))), true
+		case 2:
+			return constant.MakeInt64(int64(int16(binary.LittleEndian.Uint16(mem)))), true
+		case 4:
+			return constant.MakeInt64(int64(int32(binary.LittleEndian.Uint32(mem)))), true
+		case 8:
+			return constant.MakeInt64(int64(binary.LittleEndian.Uint64(mem))), true
+		}
+	case *dwarf.UintType:
+		switch size {
+		case 1:
+			return constant.MakeUint64(uint64(mem[0])), true
+		case 2:
+			return constant.MakeUint64(uint64(binary.LittleEndian.Uint16(mem))), true
+		case 4:
+			return constant.MakeUint64(uint64(binary.LittleEndian.Uint32(mem))), true
+		case 8:
+			return constant.MakeUint64(binary.LittleEndian.Uint64(mem)), true
+		}
+	case *dwarf.BoolType:
+		if size == 1 {
+			return constant.MakeBool(mem[0] != 0), true
+		}
+	case *dwarf.FloatType:
+		switch size {
+		case 4:
+			return constant.MakeFloat64(float64(math.Float32frombits(binary.LittleEndian.Uint32(mem)))), true
+		case 8:
+			return constant.MakeFloat64(math.Float64frombits(binary.LittleEndian.Uint64(mem))), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// PTRACE_EVENT_* of <sys/ptrace.h>
+const (
+	ptraceEventFork = 1
+	ptraceEventVfork = 2
+	ptraceEventClone = 3
+	ptraceEventExec = 4
+)
+
+var (
+	// followForkChild is `follow-fork-mode child`, the debugger goes on with the child after a fork
+	followForkChild bool
+	// detachOnFork lets the process not followed go, otherwise it keeps stopped in inferiors
+	detachOnFork = true
+	// inferiors are the traced processes which are not debugged now
+	inferiors []int
+)
+
+// ForkNote records a fork on the way of resuming
+type ForkNote struct {
+	parent int
+	child int
+	vfork bool
+	// detached is the process let go, it is 0 if the process is kept in inferiors
+	detached int
+}
+
+func (n *ForkNote) String() string {
+	kind := "fork"
+	if n.vfork {
+		kind = "vfork"
+	}
+	if n.detached != 0 {
+		return fmt.Sprintf("process %d %ss child %d, detach process %d", n.parent, kind, n.child, n.detached)
+	}
+	return fmt.Sprintf("process %d %ss child %d, keep both of them", n.parent, kind, n.child)
+}
+
+// pokeOriginals restores the original instructions of the breakpoints in the memory of pid
+func (bp *BP) pokeOriginals(pid int) error {
+	for _, info := range bp.infos {
+		if info.hardware {
+			continue
+		}
+		if _, err := writeMemory(pid, uintptr(info.pc), info.original); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleFork traces the child of parent, which stops at PTRACE_EVENT_FORK or PTRACE_EVENT_VFORK,
+// the debuggee becomes the child in `follow-fork-mode child`. The child of vfork shares the memory
+// with its parent, so the breakpoints can't be removed from only one of them
+func (bp *BP) handleFork(parent int, vfork bool) (*ForkNote, error) {
+	msg, err := ptraceGetEventMsg(parent)
+	if err != nil {
+		return nil, err
+	}
+	child := int(msg)
+	// the child begins with SIGSTOP
+	if err = waitNew(child); err != nil {
+		return nil, err
+	}
+	note := &ForkNote{parent: parent, child: child, vfork: vfork}
+
+	other := child
+	if followForkChild {
+		other = parent
+	}
+	if detachOnFork {
+		// the breakpoints of the child of vfork are set again after it executes another program
+		if !vfork || followForkChild {
+			if err = bp.pokeOriginals(other); err != nil {
+				return nil, err
+			}
+		}
+		if err = ptraceDetach(other, 0); err != nil {
+			return nil, err
+		}
+		note.detached = other
+	} else {
+		inferiors = append(inferiors, other)
+	}
+
+	if followForkChild {
+		p, err := os.FindProcess(child)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Process = p
+		threads = nil
+		curThread = 0
+		curGoroutine = nil
+		curFrame = 0
+		attached = false
+	}
+	return note, nil
+}
+
+// execEvent analyzes the program which the debuggee executes, and sets the breakpoints in it again
+func (bp *BP) execEvent(wpid int) (*StopEvent, error) {
+	threads = nil
+	curThread = 0
+	curGoroutine = nil
+	curFrame = 0
+	exefile, err := processExecutable(cmd.Process.Pid)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	ev := &StopEvent{reason: StopExec, pid: wpid, pc: pc, exefile: exefile}
+	newBi, err := analyze(exefile)
+	if err != nil {
+		// the pcs of the breakpoints are meaningless in the program
+		for _, info := range bp.infos {
+			if info.kind == USERBPTYPE && !info.disabled {
+				info.disabled = true
+				ev.unresolved = append(ev.unresolved, info)
+			}
+		}
+		return ev, fmt.Errorf("can't analyze %s: %v", exefile, err)
+	}
+	replaceBi(newBi)
+	// the checkpoints run the old program
+	clearCheckpoints()
+	if ev.unresolved, err = bp.SetBpWhenRestart(); err != nil {
+		return ev, err
+	}
+	return ev, nil
+}
+
+// SwitchInferior debugs the process pid in inferiors, the current one keeps stopped in inferiors
+func SwitchInferior(pid int) error {
+	for i, v := range inferiors {
+		if v != pid {
+			continue
+		}
+		p, err := os.FindProcess(pid)
+		if err != nil {
+			return err
+		}
+		inferiors = append(inferiors[:i], inferiors[i+1:]...)
+		if cmd.Process != nil {
+			inferiors = append(inferiors, cmd.Process.Pid)
+		}
+		cmd.Process = p
+		threads = nil
+		curThread = 0
+		curGoroutine = nil
+		curFrame = 0
+		attached = false
+		bp.pendingSignal = 0
+		return nil
+	}
+	return fmt.Errorf("process %d is not an inferior", pid)
+}
+
+// clearInferiors kills the processes kept stopped after forks
+func clearInferiors() {
+	for _, pid := range inferiors {
+		syscall.Kill(pid, syscall.SIGKILL)
+		var s syscall.WaitStatus
+		syscall.Wait4(pid, &s, waitOptions, nil)
+	}
+	inferiors = nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"go/constant"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// valueFormatter renders the value of typ at addr in place of the printer
+type valueFormatter func(p *printer, typ dwarf.Type, addr uint64) (string, error)
+
+// formatterKinds are the formatters which `config format` registers for the types by their names
+var formatterKinds = map[string]valueFormatter{
+	"string":  formatBytesString,
+	"hex":     formatHex,
+	"time":    formatTime,
+	"decimal": formatBigInt,
+}
+
+// registeredFormatter is a formatter of a type and the name it is listed with
+type registeredFormatter struct {
+	kind string
+	f valueFormatter
+}
+
+// formatters are the formatters of the types by the names, like time.Time or main.ID
+var formatters = defaultFormatters()
+
+func defaultFormatters() map[string]*registeredFormatter {
+	return map[string]*registeredFormatter{
+		"time.Time":    {"time", formatTime},
+		"math/big.Int": {"decimal", formatBigInt},
+	}
+}
+
+// RegisterFormatter renders the values of the type typeName by f, kind is shown by `config format`
+func RegisterFormatter(typeName string, kind string, f valueFormatter) {
+	formatters[typeName] = &registeredFormatter{kind, f}
+}
+
+// SetFormatter registers the formatter kind for typeName, `default` removes the formatter of it
+func SetFormatter(typeName string, kind string) error {
+	if kind == "default" {
+		delete(formatters, typeName)
+		return nil
+	}
+	f, ok := formatterKinds[kind]
+	if !ok {
+		return fmt.Errorf("unknown format `%s`, expect string, hex, time, decimal or default", kind)
+	}
+	RegisterFormatter(typeName, kind, f)
+	return nil
+}
+
+// Formatters shows the formatters registered like `type = kind`, sorted by the types
+func Formatters() []string {
+	lines := make([]string, 0, len(formatters))
+	for name, r := range formatters {
+		lines = append(lines, fmt.Sprintf("%s = %s", name, r.kind))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// findFormatter returns the formatter of typ, the names of the typedefs are matched before the types they name
+func findFormatter(typ dwarf.Type) (valueFormatter, bool) {
+	for {
+		name := dwarfTypeName(typ)
+		if t, ok := typ.(*dwarf.TypedefType); ok {
+			name = t.Name
+		}
+		if r, ok := formatters[name]; ok {
+			return r.f, true
+		}
+		t, ok := typ.(*dwarf.TypedefType)
+		if !ok {
+			return nil, false
+		}
+		typ = t.Type
+	}
+}
+
+// loadBytes reads the bytes of a byte array or a byte slice at addr
+func loadBytes(typ dwarf.Type, addr uint64) ([]byte, error) {
+	var (
+		elem dwarf.Type
+		n int64
+	)
+	switch t := resolveType(typ).(type) {
+	case *dwarf.ArrayType:
+		elem, n = t.Type, t.Count
+	case *dwarf.StructType:
+		array, ok := resolveType(t.Field[0].Type).(*dwarf.PtrType)
+		if !isSliceType(t) || !ok {
+			return nil, fmt.Errorf("%s is not bytes", dwarfTypeName(typ))
+		}
+		header := make([]byte, 16)
+		if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), header); err != nil {
+			return nil, err
+		}
+		elem, addr, n = array.Type, binary.LittleEndian.Uint64(header), int64(binary.LittleEndian.Uint64(header[8:]))
+	default:
+		return nil, fmt.Errorf("%s is not bytes", dwarfTypeName(typ))
+	}
+	if u, ok := resolveType(elem).(*dwarf.UintType); !ok || u.Size() != 1 {
+		return nil, fmt.Errorf("%s is not bytes", dwarfTypeName(typ))
+	}
+	if n > int64(loadConfig.maxStringLen) {
+		n = int64(loadConfig.maxStringLen)
+	}
+	mem := make([]byte, n)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+		return nil, err
+	}
+	return mem, nil
+}
+
+// formatBytesString renders the bytes like a string, like `"abcd"`
+func formatBytesString(p *printer, typ dwarf.Type, addr uint64) (string, error) {
+	mem, err := loadBytes(typ, addr)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Quote(string(mem)), nil
+}
+
+// formatHex renders an integer or the bytes in hex, like 0x1f or 0x61626364
+func formatHex(p *printer, typ dwarf.Type, addr uint64) (string, error) {
+	switch resolveType(typ).(type) {
+	case *dwarf.IntType, *dwarf.UintType:
+		v, err := loadValue(typ, addr)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%#x", constant.Val(v)), nil
+	}
+	mem, err := loadBytes(typ, addr)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%#x", mem), nil
+}
+
+// formatTime renders time.Time { wall; ext; loc } in RFC3339. The wall has the seconds since 1885 in the bits
+// 30 to 62 if its bit 63 is set, otherwise ext is the seconds since the year 1. The nanoseconds are in the bits
+// 0 to 29, the location of loc is found by the name, a nil loc is UTC
+func formatTime(p *printer, typ dwarf.Type, addr uint64) (string, error) {
+	t, ok := resolveType(typ).(*dwarf.StructType)
+	if !ok {
+		return "", fmt.Errorf("%s is not time.Time", dwarfTypeName(typ))
+	}
+	mem := make([]byte, t.Size())
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+		return "", err
+	}
+	var wall, ext, loc uint64
+	for _, f := range []struct {
+		path string
+		val *uint64
+	}{{"wall", &wall}, {"ext", &ext}, {"loc", &loc}} {
+		v, err := readField(t, mem, f.path)
+		if err != nil {
+			return "", err
+		}
+		*f.val = v
+	}
+	const (
+		wallToInternal int64 = (1884 * 365 + 1884 / 4 - 1884 / 100 + 1884 / 400) * 86400
+		unixToInternal int64 = (1969 * 365 + 1969 / 4 - 1969 / 100 + 1969 / 400) * 86400
+	)
+	sec := int64(ext)
+	if wall & (1 << 63) != 0 {
+		sec = wallToInternal + int64(wall << 1 >> 31)
+	}
+	at := time.Unix(sec - unixToInternal, int64(wall & (1 << 30 - 1))).UTC()
+	if loc != 0 {
+		if name, err := locationName(loc); err == nil {
+			if name == "Local" {
+				at = at.Local()
+			} else if l, err := time.LoadLocation(name); err == nil {
+				at = at.In(l)
+			}
+		}
+	}
+	return at.Format(time.RFC3339Nano), nil
+}
+
+// locationName reads the name of the time.Location at addr
+func locationName(addr uint64) (string, error) {
+	t, err := bi.structType("time.Location")
+	if err != nil {
+		return "", err
+	}
+	off, _, err := fieldOffset(t, "name")
+	if err != nil {
+		return "", err
+	}
+	return readString(addr + uint64(off))
+}
+
+// formatBigInt renders math/big.Int { neg; abs nat } in decimal, abs is the words of the magnitude from the lowest
+func formatBigInt(p *printer, typ dwarf.Type, addr uint64) (string, error) {
+	t, ok := resolveType(typ).(*dwarf.StructType)
+	if !ok {
+		return "", fmt.Errorf("%s is not math/big.Int", dwarfTypeName(typ))
+	}
+	mem := make([]byte, t.Size())
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+		return "", err
+	}
+	neg, err := readField(t, mem, "neg")
+	if err != nil {
+		return "", err
+	}
+	off, _, err := fieldOffset(t, "abs")
+	if err != nil {
+		return "", err
+	}
+	array, n := binary.LittleEndian.Uint64(mem[off:]), binary.LittleEndian.Uint64(mem[off + 8:])
+	// the decimal can't be cut, the magnitude beyond max-array-values words is rejected before reading
+	if n > uint64(loadConfig.maxArrayValues) || n > maxMemoryLength / 8 {
+		return "", fmt.Errorf("the magnitude of %d words is beyond max-array-values %d", n, loadConfig.maxArrayValues)
+	}
+	words := make([]byte, n * 8)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(array), words); err != nil {
+		return "", err
+	}
+	abs := make([]big.Word, n)
+	for i := range abs {
+		abs[i] = big.Word(binary.LittleEndian.Uint64(words[i * 8:]))
+	}
+	v := new(big.Int).SetBits(abs)
+	if neg != 0 {
+		v.Neg(v)
+	}
+	return v.String(), nil
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"github.com/chainhelen/godbg/log"
 	"go.uber.org/zap"
 	"io"
+	"strings"
 )
 
 // http://dwarfstd.org/doc/Dwarf3.pdf
@@ -18,6 +20,8 @@ type CommonInformationEntry struct {
 	data_alignment_factor int64
 	return_address_register uint64
 	initial_instructions []byte
+	// fdeEncoding is the DW_EH_PE encoding of the addresses of the FDEs in .eh_frame, by `R` of the augmentation
+	fdeEncoding byte
 	// `padding`, Enough DW_CFA_nop instructions to make the size of this entry match the length value above.
 }
 
@@ -66,6 +70,13 @@ type Frame struct {
 	regs []uint64
 	framebase uint64
 	loc uint64
+	// remembered are the rules pushed by DW_CFA_remember_state
+	remembered []frameState
+}
+
+type frameState struct {
+	cfa DWRule
+	regsRule map[uint64]DWRule
 }
 
 func parseFrameInformation(buffer *bytes.Buffer) (*VirtualUnwindFrameInformation, error) {
@@ -235,10 +246,143 @@ func parseFrameDescriptionEntryByte(len uint32, data []byte) (*FrameDescriptionE
 	fde.size = binary.LittleEndian.Uint64(data[8:16])
 	fde.instructions = data[16:]
 
-	logger.Debug("parseFrameDescriptionEntryByte",
+	log.Trace(dwarfLogger, "parseFrameDescriptionEntryByte",
 		zap.Uint32("len", len),
 		zap.Uint64("begin", fde.begin),
 		zap.Uint64("size", fde.size))
 
 	return fde, nil
-}
\ No newline at end of file
+}
+// the encodings of the pointers in .eh_frame, the low 4 bits are the format and the high ones are what it is
+// relative to
+const (
+	DW_EH_PE_absptr = 0x00
+	DW_EH_PE_udata4 = 0x03
+	DW_EH_PE_udata8 = 0x04
+	DW_EH_PE_sdata4 = 0x0b
+	DW_EH_PE_sdata8 = 0x0c
+	DW_EH_PE_pcrel  = 0x10
+)
+
+// parseEhFrame reads the CIEs and the FDEs in .eh_frame at addr. They are like .debug_frame, except the id of the
+// CIEs is 0, the FDEs point to their CIEs by the distance back and gcc encodes their addresses by the augmentation
+func parseEhFrame(data []byte, addr uint64) ([]*VirtualUnwindFrameInformation, error) {
+	var (
+		infos []*VirtualUnwindFrameInformation
+		cies  = make(map[uint64]*CommonInformationEntry)
+	)
+	for off := uint64(0); off+4 <= uint64(len(data)); {
+		length := uint64(binary.LittleEndian.Uint32(data[off:]))
+		// the terminator, the 64 bits length is not written by gcc on amd64
+		if length == 0 || length == 0xffffffff {
+			break
+		}
+		start, end := off+4, off+4+length
+		if end > uint64(len(data)) || length < 4 {
+			return nil, fmt.Errorf("the entry at %#x of .eh_frame is out of the section", off)
+		}
+		id := uint64(binary.LittleEndian.Uint32(data[start:]))
+		body := data[start+4 : end]
+		if id == 0 {
+			cie, err := parseEhCIE(uint32(length), body)
+			if err != nil {
+				return nil, fmt.Errorf("the cie at %#x of .eh_frame: %v", off, err)
+			}
+			cies[off] = cie
+			infos = append(infos, &VirtualUnwindFrameInformation{len: uint32(length), CIE: cie})
+		} else {
+			cie := cies[start-id]
+			if cie == nil {
+				return nil, fmt.Errorf("the fde at %#x of .eh_frame has no cie", off)
+			}
+			fde, err := parseEhFDE(uint32(length), body, addr+start+4, cie)
+			if err != nil {
+				return nil, fmt.Errorf("the fde at %#x of .eh_frame: %v", off, err)
+			}
+			infos = append(infos, &VirtualUnwindFrameInformation{len: uint32(length), FDE: fde})
+		}
+		off = end
+	}
+	return infos, nil
+}
+
+// parseEhCIE moves the augmentation data of `z` out of the initial instructions
+func parseEhCIE(length uint32, data []byte) (*CommonInformationEntry, error) {
+	cie, err := parseCommonInformationEntryByte(length, data)
+	if err != nil {
+		return nil, err
+	}
+	cie.cie_id, cie.fdeEncoding = 0, DW_EH_PE_absptr
+	if !strings.HasPrefix(cie.augmentation, "z") {
+		return cie, nil
+	}
+	buf := bytes.NewBuffer(cie.initial_instructions)
+	n, _, err := DecodeULEB128(buf)
+	if err != nil || n > uint64(buf.Len()) {
+		return nil, fmt.Errorf("invalid augmentation data")
+	}
+	augmentation := bytes.NewBuffer(buf.Next(int(n)))
+	for _, c := range cie.augmentation[1:] {
+		switch c {
+		case 'R':
+			if cie.fdeEncoding, err = augmentation.ReadByte(); err != nil {
+				return nil, err
+			}
+		case 'L':
+			augmentation.Next(1)
+		case 'P':
+			encoding, err := augmentation.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			augmentation.Next(pointerSize(encoding))
+		}
+	}
+	cie.initial_instructions = buf.Bytes()
+	return cie, nil
+}
+
+// parseEhFDE reads the fde whose pc begin is at addr
+func parseEhFDE(length uint32, data []byte, addr uint64, cie *CommonInformationEntry) (*FrameDescriptionEntry, error) {
+	size := pointerSize(cie.fdeEncoding)
+	if size == 0 || len(data) < 2*size {
+		return nil, fmt.Errorf("unsupported encoding %#x", cie.fdeEncoding)
+	}
+	fde := &FrameDescriptionEntry{length: length, CIE: cie}
+	fde.begin = readPointer(data, cie.fdeEncoding)
+	if cie.fdeEncoding&0x70 == DW_EH_PE_pcrel {
+		fde.begin += addr
+	}
+	// the range is the size, it is never relative
+	fde.size = readPointer(data[size:], cie.fdeEncoding&0x0f)
+	buf := bytes.NewBuffer(data[2*size:])
+	if strings.HasPrefix(cie.augmentation, "z") {
+		n, _, err := DecodeULEB128(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf.Next(int(n))
+	}
+	fde.instructions = buf.Bytes()
+	return fde, nil
+}
+
+func pointerSize(encoding byte) int {
+	switch encoding & 0x0f {
+	case DW_EH_PE_absptr, DW_EH_PE_udata8, DW_EH_PE_sdata8:
+		return 8
+	case DW_EH_PE_udata4, DW_EH_PE_sdata4:
+		return 4
+	}
+	return 0
+}
+
+func readPointer(data []byte, encoding byte) uint64 {
+	switch encoding & 0x0f {
+	case DW_EH_PE_udata4:
+		return uint64(binary.LittleEndian.Uint32(data))
+	case DW_EH_PE_sdata4:
+		return uint64(int64(int32(binary.LittleEndian.Uint32(data))))
+	}
+	return binary.LittleEndian.Uint64(data)
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var NotReplayingErr = errors.New("the debuggee is not replayed, start godbg by `godbg replay`")
+var ReplayReadOnlyErr = errors.New("the recording can't be changed while replaying")
+var RestartReplayErr = errors.New("can't restart while replaying, `rewind` to the beginning of the recording")
+var RemoteUnsupportedErr = errors.New("unsupported by the remote gdb server")
+
+// replay is not nil in the record/replay mode or the remote mode, the debuggee is driven by `rr replay`
+// or a remote gdb server like `qemu -g` through the gdb remote serial protocol instead of ptrace
+var replay *gdbConn
+
+// replaying is true in the record/replay mode, the recording can't be changed
+func replaying() bool {
+	return replay != nil && replay.rr != nil
+}
+
+// gdbConn is a client of the gdb remote serial protocol,
+// see https://sourceware.org/gdb/onlinedocs/gdb/Remote-Protocol.html
+type gdbConn struct {
+	conn net.Conn
+	rd *bufio.Reader
+	// the stop reply of the last resuming, it is consumed by wait
+	stop string
+	// thread is the thread of the last stop, the registers and the memory are read from it
+	thread string
+	// edge is `begin` or `end` if the last stop is at the edge of the recording
+	edge string
+
+	// rr is nil in the remote mode
+	rr *exec.Cmd
+	traceDir string
+	// server is debugserver started by godbg on darwin, it is killed with the debuggee
+	server *exec.Cmd
+	// layout is where the registers are in the `g` packet by qRegisterInfo of debugserver, nil is the layout of gdb
+	layout map[string]remoteRegister
+}
+
+// remoteRegister is the offset and the size in bytes of a register in the `g` packet
+type remoteRegister struct {
+	offset int
+	size int
+}
+
+// connectRemote connects to the gdb server at addr which runs execfile, like `qemu-x86_64 -g 1234`
+// or gdbserver. The returned cmd has no process of its own, its pid is the one of the remote thread
+func connectRemote(addr string, execfile string) (*exec.Cmd, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	g := &gdbConn{conn: conn, rd: bufio.NewReader(conn)}
+	if err = g.handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// the thread is like `p1a2b.1a2c` with multiprocess, or `1a2c`
+	thread := strings.TrimPrefix(g.thread, "p")
+	pid, err := strconv.ParseInt(strings.SplitN(thread, ".", 2)[0], 16, 64)
+	if err != nil || pid <= 0 {
+		pid = 1
+	}
+	replay = g
+	return &exec.Cmd{Path: execfile, Process: &os.Process{Pid: int(pid)}}, nil
+}
+
+// rrReplay records execfile with args by `rr record` until it exits, then replays the recording
+// with the gdb server of rr. The returned cmd is rr itself, quitting kills its process group
+func rrReplay(execfile string, args []string) (*exec.Cmd, error) {
+	traceDir, err := ioutil.TempDir("", "godbg-rr")
+	if err != nil {
+		return nil, err
+	}
+	trace := path.Join(traceDir, "trace")
+
+	record := exec.Command("rr", append([]string{"record", "--output-trace-dir", trace, execfile}, args...)...)
+	record.Stdin = os.Stdin
+	record.Stdout = os.Stdout
+	record.Stderr = os.Stderr
+	// rr exits with the status of the debuggee, only the missing recording is an error
+	if err = record.Run(); err != nil {
+		if _, statErr := os.Stat(trace); statErr != nil {
+			os.RemoveAll(traceDir)
+			return nil, fmt.Errorf("rr record: %v", err)
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.RemoveAll(traceDir)
+		return nil, err
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	rr := exec.Command("rr", "replay", "--dbgport", strconv.Itoa(port), trace)
+	rr.Stdout = os.Stdout
+	rr.Stderr = os.Stderr
+	rr.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = rr.Start(); err != nil {
+		os.RemoveAll(traceDir)
+		return nil, err
+	}
+
+	var conn net.Conn
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		syscall.Kill(-rr.Process.Pid, syscall.SIGKILL)
+		os.RemoveAll(traceDir)
+		return nil, err
+	}
+
+	g := &gdbConn{conn: conn, rd: bufio.NewReader(conn), rr: rr, traceDir: traceDir}
+	if err = g.handshake(); err != nil {
+		g.close()
+		return nil, err
+	}
+	replay = g
+	return rr, nil
+}
+
+func (g *gdbConn) handshake() error {
+	if _, err := g.exec("qSupported:multiprocess+;swbreak+;hwbreak+"); err != nil {
+		return err
+	}
+	// the debuggee stops at the first instruction, the reply tells the thread
+	reply, err := g.exec("?")
+	if err != nil {
+		return err
+	}
+	return g.parseThread(reply)
+}
+
+// close kills rr and removes the recording, the remote debuggee is killed without waiting for the reply
+func (g *gdbConn) close() {
+	if g.rr == nil {
+		g.conn.Write([]byte(fmt.Sprintf("$k#%02x", checksum("k"))))
+		g.conn.Close()
+		g.stopServer()
+		return
+	}
+	g.conn.Close()
+	if g.rr.Process != nil {
+		syscall.Kill(-g.rr.Process.Pid, syscall.SIGKILL)
+		g.rr.Wait()
+	}
+	os.RemoveAll(g.traceDir)
+}
+
+// detach lets the remote debuggee go by `D`, rr is killed since there is nothing to replay without godbg
+func (g *gdbConn) detach() error {
+	if g.rr != nil {
+		g.close()
+		return nil
+	}
+	_, err := g.exec("D")
+	g.conn.Close()
+	g.stopServer()
+	return err
+}
+
+// stopServer waits debugserver, which exits after the debuggee is killed or detached
+func (g *gdbConn) stopServer() {
+	if g.server == nil || g.server.Process == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		g.server.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		g.server.Process.Kill()
+		<-done
+	}
+	g.server = nil
+}
+
+func checksum(payload string) byte {
+	var sum byte
+	for i := 0; i < len(payload); i++ {
+		sum += payload[i]
+	}
+	return sum
+}
+
+// exec sends the packet and returns the payload of the reply, the `E NN` reply is an error
+func (g *gdbConn) exec(payload string) (string, error) {
+	if err := g.send(payload); err != nil {
+		return "", err
+	}
+	reply, err := g.recv()
+	if err != nil {
+		return "", err
+	}
+	if len(reply) == 3 && reply[0] == 'E' {
+		return "", fmt.Errorf("gdb server replies %s to %s", reply, payload)
+	}
+	return reply, nil
+}
+
+func (g *gdbConn) send(payload string) error {
+	packet := fmt.Sprintf("$%s#%02x", payload, checksum(payload))
+	for {
+		if _, err := g.conn.Write([]byte(packet)); err != nil {
+			return err
+		}
+		ack, err := g.rd.ReadByte()
+		if err != nil {
+			return err
+		}
+		// `-` asks for the retransmission
+		if ack == '+' {
+			return nil
+		}
+	}
+}
+
+// recv reads a packet like `$payload#checksum`, the escaped and run-length encoded bytes are decoded
+func (g *gdbConn) recv() (string, error) {
+	for {
+		c, err := g.rd.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == '$' {
+			break
+		}
+	}
+	raw, err := g.rd.ReadBytes('#')
+	if err != nil {
+		return "", err
+	}
+	raw = raw[:len(raw) - 1]
+	sum := make([]byte, 2)
+	if _, err = g.rd.Read(sum[:1]); err != nil {
+		return "", err
+	}
+	if _, err = g.rd.Read(sum[1:]); err != nil {
+		return "", err
+	}
+	if fmt.Sprintf("%02x", checksum(string(raw))) != string(sum) {
+		g.conn.Write([]byte("-"))
+		return g.recv()
+	}
+	if _, err = g.conn.Write([]byte("+")); err != nil {
+		return "", err
+	}
+
+	payload := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '}':
+			i++
+			if i < len(raw) {
+				payload = append(payload, raw[i] ^ 0x20)
+			}
+		case '*':
+			// the count of the repeats is the next byte - 29
+			i++
+			if i < len(raw) && len(payload) > 0 {
+				last := payload[len(payload) - 1]
+				for n := int(raw[i]) - 29; n > 0; n-- {
+					payload = append(payload, last)
+				}
+			}
+		default:
+			payload = append(payload, raw[i])
+		}
+	}
+	return string(payload), nil
+}
+
+func (g *gdbConn) readMemory(addr uintptr, out []byte) (int, error) {
+	for n := 0; n < len(out); {
+		size := len(out) - n
+		if size > 1024 {
+			size = 1024
+		}
+		reply, err := g.exec(fmt.Sprintf("m%x,%x", uint64(addr) + uint64(n), size))
+		if err != nil {
+			return n, err
+		}
+		data, err := hex.DecodeString(reply)
+		if err != nil {
+			return n, err
+		}
+		// the reply is shorter if the rest is not readable
+		if len(data) == 0 {
+			return n, syscall.EFAULT
+		}
+		n += copy(out[n:], data)
+	}
+	return len(out), nil
+}
+
+// writeMemory writes data at addr by the `M` packets
+func (g *gdbConn) writeMemory(addr uintptr, data []byte) (int, error) {
+	for n := 0; n < len(data); {
+		size := len(data) - n
+		if size > 1024 {
+			size = 1024
+		}
+		if _, err := g.exec(fmt.Sprintf("M%x,%x:%x", uint64(addr) + uint64(n), size, data[n:n + size])); err != nil {
+			return n, err
+		}
+		n += size
+	}
+	return len(data), nil
+}
+
+// registerBytes reads the `g` packet of the selected thread
+func (g *gdbConn) registerBytes() ([]byte, error) {
+	reply, err := g.exec("g")
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(reply)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 17 * 8 + 7 * 4 {
+		return nil, fmt.Errorf("the registers from the gdb server are too short: %d bytes", len(data))
+	}
+	return data, nil
+}
+
+// loadRegisterInfo reads the layout of the `g` packet by qRegisterInfo0, qRegisterInfo1 and so on, debugserver
+// replies `name:rax;bitsize:64;offset:0;...` for each register and an error after the last one
+func (g *gdbConn) loadRegisterInfo() error {
+	layout := make(map[string]remoteRegister)
+	for i := 0; ; i++ {
+		reply, err := g.exec(fmt.Sprintf("qRegisterInfo%x", i))
+		if err != nil || reply == "" {
+			break
+		}
+		var (
+			name string
+			r = remoteRegister{offset: -1}
+		)
+		for _, field := range strings.Split(reply, ";") {
+			kv := strings.SplitN(field, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "name":
+				name = kv[1]
+			case "bitsize":
+				bits, _ := strconv.Atoi(kv[1])
+				r.size = bits / 8
+			case "offset":
+				r.offset, _ = strconv.Atoi(kv[1])
+			}
+		}
+		if name != "" && r.offset >= 0 && r.size > 0 {
+			layout[name] = r
+		}
+	}
+	if _, ok := layout["rip"]; !ok {
+		return errors.New("the gdb server doesn't tell where rip is by qRegisterInfo")
+	}
+	g.layout = layout
+	return nil
+}
+
+// layoutBytes returns the bytes of the register name in data of the `g` packet by the layout, nil if there is no
+// such register
+func (g *gdbConn) layoutBytes(data []byte, name string) []byte {
+	r, ok := g.layout[name]
+	if !ok || r.offset + r.size > len(data) {
+		return nil
+	}
+	return data[r.offset : r.offset + r.size]
+}
+
+// layoutFxsave are the offsets in the fxsave area of the x87 and sse registers named by debugserver
+var layoutFxsave = map[string]int{"fctrl": 0, "fstat": 2, "ftag": 4, "fop": 6, "fioff": 8, "fiseg": 12,
+	"fooff": 16, "foseg": 20, "mxcsr": 24, "mxcsrmask": 28}
+
+// fxsaveOffset returns the offset of the x87 or sse register name in the fxsave area and the most bytes there, it
+// is false if the register is not in it. stmm0-stmm7 are from 32 and xmm0-xmm15 are from 160 by 16 bytes
+func fxsaveOffset(name string) (int, int, bool) {
+	if off, ok := layoutFxsave[name]; ok {
+		return off, 4, true
+	}
+	for _, r := range []struct {
+		prefix string
+		base, count int
+	}{{"stmm", 32, 8}, {"xmm", 160, 16}} {
+		if !strings.HasPrefix(name, r.prefix) {
+			continue
+		}
+		if i, err := strconv.Atoi(name[len(r.prefix):]); err == nil && i >= 0 && i < r.count {
+			return r.base + i*16, 16, true
+		}
+	}
+	return 0, 0, false
+}
+
+// readRegisters reads the registers of the selected thread by the `g` packet
+func (g *gdbConn) readRegisters(regs *PtraceRegs) error {
+	data, err := g.registerBytes()
+	if err != nil {
+		return err
+	}
+	if g.layout == nil {
+		gdbRegisters(data, regs)
+		return nil
+	}
+	*regs = PtraceRegs{}
+	for _, r := range registers {
+		if b := g.layoutBytes(data, r.name); len(b) >= 8 {
+			*r.field(regs) = binary.LittleEndian.Uint64(b)
+		}
+	}
+	return nil
+}
+
+// writeRegisters writes regs by the `G` packet, the registers which godbg doesn't know keep their values
+func (g *gdbConn) writeRegisters(regs *PtraceRegs) error {
+	data, err := g.registerBytes()
+	if err != nil {
+		return err
+	}
+	if g.layout != nil {
+		for _, r := range registers {
+			if b := g.layoutBytes(data, r.name); len(b) >= 8 {
+				binary.LittleEndian.PutUint64(b, *r.field(regs))
+			}
+		}
+		_, err = g.exec(fmt.Sprintf("G%x", data))
+		return err
+	}
+	fpregs := make([]byte, 512)
+	if len(data) > 164 {
+		setGdbFpRegisters(fpregs, data[164:])
+	}
+	all := gdbRegisterBytes(regs, fpregs)
+	if len(all) > len(data) {
+		all = all[:len(data)]
+	}
+	copy(data, all)
+	_, err = g.exec(fmt.Sprintf("G%x", data))
+	return err
+}
+
+// readFpRegisters converts the x87 and sse registers of the `g` packet to the fxsave area
+func (g *gdbConn) readFpRegisters() ([]byte, error) {
+	data, err := g.registerBytes()
+	if err != nil {
+		return nil, err
+	}
+	fpregs := make([]byte, 512)
+	if g.layout != nil {
+		for name := range g.layout {
+			if off, size, ok := fxsaveOffset(name); ok {
+				copy(fpregs[off:off+size], g.layoutBytes(data, name))
+			}
+		}
+		return fpregs, nil
+	}
+	if len(data) < 164 + 8*10 + 8*4 + 16*16 + 4 {
+		return nil, errors.New("the gdb server doesn't send the x87 and sse registers")
+	}
+	setGdbFpRegisters(fpregs, data[164:])
+	return fpregs, nil
+}
+
+func (g *gdbConn) writeFpRegisters(fpregs []byte) error {
+	data, err := g.registerBytes()
+	if err != nil {
+		return err
+	}
+	if g.layout != nil {
+		for name := range g.layout {
+			if off, size, ok := fxsaveOffset(name); ok && len(fpregs) >= off+size {
+				copy(g.layoutBytes(data, name), fpregs[off:off+size])
+			}
+		}
+		_, err = g.exec(fmt.Sprintf("G%x", data))
+		return err
+	}
+	if len(data) < 164 + 8*10 + 8*4 + 16*16 + 4 {
+		return errors.New("the gdb server doesn't send the x87 and sse registers")
+	}
+	copy(data[164:], gdbFpRegisters(fpregs))
+	_, err = g.exec(fmt.Sprintf("G%x", data))
+	return err
+}
+
+// unsupportedErr is the error of the things which ptrace can do but the gdb server can't
+func (g *gdbConn) unsupportedErr() error {
+	if g.rr != nil {
+		return ReplayReadOnlyErr
+	}
+	return RemoteUnsupportedErr
+}
+
+func (g *gdbConn) setBreakPoint(pc uint64) error {
+	_, err := g.exec(fmt.Sprintf("Z0,%x,1", pc))
+	return err
+}
+
+func (g *gdbConn) clearBreakPoint(pc uint64) error {
+	_, err := g.exec(fmt.Sprintf("z0,%x,1", pc))
+	return err
+}
+
+// resume sends c, s, bc, bs or C with the signal, the stop reply is returned by the next wait. The output of the debuggee
+// comes before it in the `O` packets
+func (g *gdbConn) resume(action string) error {
+	reply, err := g.exec(action)
+	for err == nil && len(reply) > 1 && reply[0] == 'O' && reply != "OK" {
+		if out, decodeErr := hex.DecodeString(reply[1:]); decodeErr == nil {
+			stdout.Write(out)
+		}
+		reply, err = g.recv()
+	}
+	if err != nil {
+		return err
+	}
+	g.stop = reply
+	return nil
+}
+
+// wait converts the last stop reply to the wait status of ptrace
+func (g *gdbConn) wait(s *syscall.WaitStatus) (int, error) {
+	reply := g.stop
+	g.stop = ""
+	g.edge = ""
+	if i := strings.Index(reply, "replaylog:"); i >= 0 {
+		g.edge = strings.SplitN(reply[i + len("replaylog:"):], ";", 2)[0]
+	}
+	if len(reply) < 3 {
+		return 0, fmt.Errorf("invalid stop reply `%s`", reply)
+	}
+	num, err := strconv.ParseUint(reply[1:3], 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stop reply `%s`", reply)
+	}
+	pid := cmd.Process.Pid
+	switch reply[0] {
+	case 'T', 'S':
+		if err = g.parseThread(reply); err != nil {
+			return 0, err
+		}
+		*s = syscall.WaitStatus(uint32(gdbSignal(num)) << 8 | 0x7f)
+	case 'W':
+		*s = syscall.WaitStatus(uint32(num) << 8)
+	case 'X':
+		*s = syscall.WaitStatus(uint32(gdbSignal(num)))
+	default:
+		return 0, fmt.Errorf("invalid stop reply `%s`", reply)
+	}
+	return pid, nil
+}
+
+// parseThread selects the thread of the stop reply like `T05thread:p1a2b.1a2c;` for reading
+func (g *gdbConn) parseThread(reply string) error {
+	for _, field := range strings.Split(reply, ";") {
+		i := strings.Index(field, "thread:")
+		if i < 0 {
+			continue
+		}
+		thread := field[i + len("thread:"):]
+		if thread == g.thread {
+			return nil
+		}
+		if _, err := g.exec("Hg" + thread); err != nil {
+			return err
+		}
+		g.thread = thread
+		return nil
+	}
+	return nil
+}
+
+// gdbSignals are the signal numbers of gdb which differ from linux, from SIGBUS
+var gdbSignals = map[uint64]syscall.Signal{
+	10: syscall.SIGBUS, 12: syscall.SIGSYS, 16: syscall.SIGURG, 17: syscall.SIGSTOP, 18: syscall.SIGTSTP,
+	19: syscall.SIGCONT, 20: syscall.SIGCHLD, 23: syscall.SIGIO, 30: syscall.SIGUSR1, 31: syscall.SIGUSR2,
+}
+
+// gdbSignal converts the signal number of gdb to the one of the host
+func gdbSignal(num uint64) syscall.Signal {
+	if sig, ok := gdbSignals[num]; ok {
+		return sig
+	}
+	return syscall.Signal(num)
+}
+
+// gdbSignalNumber converts the signal of the host to the number of gdb
+func gdbSignalNumber(sig syscall.Signal) uint64 {
+	for num, s := range gdbSignals {
+		if s == sig {
+			return num
+		}
+	}
+	return uint64(sig)
+}
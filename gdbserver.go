@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// gdbTargetXml describes the registers of the `g` packet, gdb takes the ones of amd64 and the osabi
+var gdbTargetXml = fmt.Sprintf(`<?xml version="1.0"?><!DOCTYPE target SYSTEM "gdb-target.dtd">`+
+	`<target><architecture>i386:x86-64</architecture><osabi>%s</osabi></target>`, gdbOsabi)
+
+// gdbServer serves the debuggee to a gdb client by the remote serial protocol like gdbserver does,
+// see https://sourceware.org/gdb/onlinedocs/gdb/Remote-Protocol.html. The packets are translated to
+// the breakpoints, the resuming and the registers of godbg
+type gdbServer struct {
+	client *gdbConn
+	// stop is the stop reply of the last stop, it is replied to `?`
+	stop string
+	// breakpoints are the ones set by Z0, a pc where godbg has a breakpoint already is not among them
+	breakpoints map[uint64]*BInfo
+}
+
+// serveGdb serves the first client connecting to l until it kills or detaches the debuggee, or it exits
+func serveGdb(l net.Listener) error {
+	conn, err := l.Accept()
+	l.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s := &gdbServer{
+		client:      &gdbConn{conn: conn, rd: bufio.NewReader(conn)},
+		stop:        fmt.Sprintf("T05thread:%x;", currentThread()),
+		breakpoints: map[uint64]*BInfo{},
+	}
+	for {
+		packet, err := s.client.recv()
+		if err == io.EOF {
+			return releaseDebuggee()
+		}
+		if err != nil {
+			return err
+		}
+		// gdb doesn't wait for the reply of kill
+		if packet == "k" {
+			return releaseDebuggee()
+		}
+		reply, done := s.handle(packet)
+		if err = s.client.send(reply); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// handle replies the packet, done is true if the session ends after the reply. The packets unsupported are
+// replied empty, the errors are `E NN`
+func (s *gdbServer) handle(packet string) (reply string, done bool) {
+	if packet == "" {
+		return "", false
+	}
+	switch packet[0] {
+	case '?':
+		return s.stop, false
+	case 'g':
+		return s.readRegisters(), false
+	case 'G':
+		return s.writeRegisters(packet[1:]), false
+	case 'm':
+		return s.readMemory(packet[1:]), false
+	case 'M':
+		return s.writeMemory(packet[1:]), false
+	case 'Z', 'z':
+		return s.breakpoint(packet), false
+	case 'H':
+		if len(packet) < 2 {
+			return "E01", false
+		}
+		return s.selectThread(packet[2:]), false
+	case 'T':
+		tid, err := strconv.ParseInt(packet[1:], 16, 64)
+		if err != nil || !isThread(int(tid)) {
+			return "E01", false
+		}
+		return "OK", false
+	case 'c', 's':
+		return s.resume(packet[0], 0, "")
+	case 'C', 'S':
+		num, err := strconv.ParseUint(strings.SplitN(packet[1:], ";", 2)[0], 16, 8)
+		if err != nil {
+			return "E01", false
+		}
+		return s.resume(packet[0] + 'a' - 'A', gdbSignal(num), "")
+	case 'v':
+		return s.vPacket(packet)
+	case 'q':
+		return s.query(packet), false
+	case 'D':
+		if _, err := detach(false); err != nil {
+			return "E01", false
+		}
+		return "OK", true
+	}
+	return "", false
+}
+
+func (s *gdbServer) query(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return "PacketSize=4000;qXfer:features:read+"
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		return s.targetXml(strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"))
+	case packet == "qAttached":
+		if attached {
+			return "1"
+		}
+		return "0"
+	case packet == "qC":
+		return fmt.Sprintf("QC%x", currentThread())
+	case packet == "qfThreadInfo":
+		tids := make([]string, 0)
+		for _, tid := range targetThreads() {
+			tids = append(tids, fmt.Sprintf("%x", tid))
+		}
+		return "m" + strings.Join(tids, ",")
+	case packet == "qsThreadInfo":
+		return "l"
+	case strings.HasPrefix(packet, "qSymbol"):
+		return "OK"
+	}
+	return ""
+}
+
+// targetXml replies the part `offset,length` of the target description, `l` marks the last part
+func (s *gdbServer) targetXml(args string) string {
+	var offset, length int
+	if _, err := fmt.Sscanf(args, "%x,%x", &offset, &length); err != nil || offset > len(gdbTargetXml) {
+		return "E01"
+	}
+	if offset + length >= len(gdbTargetXml) {
+		return "l" + gdbTargetXml[offset:]
+	}
+	return "m" + gdbTargetXml[offset : offset + length]
+}
+
+// vPacket handles `vCont?` and `vCont;action[:thread]...`, the action of the first one is taken.
+// The stepping runs on its thread, the others keep stopped
+func (s *gdbServer) vPacket(packet string) (string, bool) {
+	if packet == "vCont?" {
+		return "vCont;c;C;s;S", false
+	}
+	if strings.HasPrefix(packet, "vKill;") {
+		if err := releaseDebuggee(); err != nil {
+			return "E01", true
+		}
+		return "OK", true
+	}
+	if !strings.HasPrefix(packet, "vCont;") {
+		return "", false
+	}
+	action := strings.Split(packet[len("vCont;"):], ";")[0]
+	thread := ""
+	if i := strings.Index(action, ":"); i >= 0 {
+		action, thread = action[:i], action[i + 1:]
+	}
+	switch {
+	case action == "c" || action == "s":
+		return s.resume(action[0], 0, thread)
+	case len(action) == 3 && (action[0] == 'C' || action[0] == 'S'):
+		num, err := strconv.ParseUint(action[1:], 16, 8)
+		if err != nil {
+			return "E01", false
+		}
+		return s.resume(action[0] + 'a' - 'A', gdbSignal(num), thread)
+	}
+	return "", false
+}
+
+// resume continues the debuggee by `c` or steps an instruction by `s` with the signal sig, no signal is delivered
+// if sig is 0, and replies the stop. The session ends if the debuggee exits
+func (s *gdbServer) resume(action byte, sig syscall.Signal, thread string) (string, bool) {
+	if cmd == nil || cmd.Process == nil {
+		return "E01", false
+	}
+	if thread != "" && thread != "-1" && thread != "0" {
+		tid, err := strconv.ParseInt(thread, 16, 64)
+		if err != nil {
+			return "E01", false
+		}
+		if err = SwitchThread(int(tid)); err != nil {
+			return "E01", false
+		}
+	}
+	bp.pendingSignal, bp.signalThread = sig, currentThread()
+	resume := bp.Resume
+	if action == 's' {
+		resume = bp.StepInstruction
+	}
+	ev, err := resume()
+	if err != nil {
+		rpcLogger.Error(err.Error(), zap.String("stage", "gdbserver"), zap.String("action", string(action)))
+		return "E01", false
+	}
+	switch ev.reason {
+	case StopExited:
+		return fmt.Sprintf("W%02x", ev.status), true
+	case StopKilled:
+		return fmt.Sprintf("X%02x", gdbSignalNumber(ev.signal)), true
+	}
+	num := uint64(syscall.SIGTRAP)
+	if ev.reason == StopSignal {
+		num = gdbSignalNumber(ev.signal)
+		// gdb asks for the signal by C or S if it should be delivered
+		bp.pendingSignal = 0
+	}
+	s.stop = fmt.Sprintf("T%02xthread:%x;", num, currentThread())
+	return s.stop, false
+}
+
+// selectThread handles `Hg thread` and `Hc thread`, -1 and 0 is any thread which keeps the current one
+func (s *gdbServer) selectThread(thread string) string {
+	if thread == "-1" || thread == "0" {
+		return "OK"
+	}
+	tid, err := strconv.ParseInt(thread, 16, 64)
+	if err != nil {
+		return "E01"
+	}
+	if err = SwitchThread(int(tid)); err != nil {
+		return "E01"
+	}
+	return "OK"
+}
+
+func (s *gdbServer) readRegisters() string {
+	regs, err := getRegisters()
+	if err != nil {
+		return "E01"
+	}
+	// the x87 and sse registers are zero if they can't be read
+	fpregs, _ := ptraceGetFpRegs(currentThread())
+	return hex.EncodeToString(gdbRegisterBytes(&regs, fpregs))
+}
+
+// writeRegisters writes the `G` packet, the registers which are not in it are kept
+func (s *gdbServer) writeRegisters(packet string) string {
+	data, err := hex.DecodeString(packet)
+	if err != nil {
+		return "E01"
+	}
+	regs, err := getRegisters()
+	if err != nil {
+		return "E01"
+	}
+	fpregs, err := ptraceGetFpRegs(currentThread())
+	if err != nil {
+		return "E01"
+	}
+	all := gdbRegisterBytes(&regs, fpregs)
+	copy(all, data)
+	gdbRegisters(all, &regs)
+	setGdbFpRegisters(fpregs, all[164:])
+	if err = ptraceSetRegs(currentThread(), &regs); err != nil {
+		return "E01"
+	}
+	if err = ptraceSetFpRegs(currentThread(), fpregs); err != nil {
+		return "E01"
+	}
+	return "OK"
+}
+
+// readMemory replies `m addr,length` in hex, the breakpoints show the original bytes
+func (s *gdbServer) readMemory(args string) string {
+	var addr uint64
+	var length int
+	if _, err := fmt.Sscanf(args, "%x,%x", &addr, &length); err != nil {
+		return "E01"
+	}
+	mem, err := ReadMemory(addr, length)
+	if err != nil {
+		return "E14"
+	}
+	return hex.EncodeToString(mem)
+}
+
+// writeMemory writes `M addr,length:bytes`
+func (s *gdbServer) writeMemory(args string) string {
+	i := strings.Index(args, ":")
+	if i < 0 {
+		return "E01"
+	}
+	data, err := hex.DecodeString(args[i + 1:])
+	if err != nil {
+		return "E01"
+	}
+	var addr uint64
+	if _, err = fmt.Sscanf(args[:i], "%x,", &addr); err != nil {
+		return "E01"
+	}
+	if err = WriteMemory(addr, data); err != nil {
+		return "E14"
+	}
+	return "OK"
+}
+
+// breakpoint sets the software breakpoint by `Z0,addr,kind` and clears it by `z0,addr,kind`,
+// the other kinds are unsupported
+func (s *gdbServer) breakpoint(packet string) string {
+	var pc uint64
+	var kind int
+	if !strings.HasPrefix(packet[1:], "0,") {
+		return ""
+	}
+	if _, err := fmt.Sscanf(packet[3:], "%x,%x", &pc, &kind); err != nil {
+		return "E01"
+	}
+	if packet[0] == 'z' {
+		if info, ok := s.breakpoints[pc]; ok {
+			bp.removeInternalBreakPoint(info)
+			delete(s.breakpoints, pc)
+		}
+		return "OK"
+	}
+	if _, ok := s.breakpoints[pc]; ok {
+		return "OK"
+	}
+	info, err := bp.SetInternalBreakPoint(pc)
+	if err == HasExistedBreakPointErr {
+		return "OK"
+	}
+	if err != nil {
+		return "E01"
+	}
+	s.breakpoints[pc] = info
+	return "OK"
+}
+
+// gdbFpRegisters converts the fxsave area to the x87 and sse registers of the `g` packet of amd64, they are
+// st0-st7 of 10 bytes, fctrl, fstat, ftag, fiseg, fioff, foseg, fooff, fop of 4 bytes, xmm0-xmm15 and mxcsr.
+// The tags of fxsave are one bit each, a register is valid or empty
+func gdbFpRegisters(fpregs []byte) []byte {
+	data := make([]byte, 8*10 + 8*4 + 16*16 + 4)
+	if len(fpregs) < 512 {
+		return data
+	}
+	for i := 0; i < 8; i++ {
+		copy(data[i*10:i*10+10], fpregs[32+i*16:])
+	}
+	var ftag uint32
+	for i := uint(0); i < 8; i++ {
+		if fpregs[4] & (1 << i) == 0 {
+			ftag |= 3 << (i * 2)
+		}
+	}
+	u16 := func(off int) uint32 { return uint32(binary.LittleEndian.Uint16(fpregs[off:])) }
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(fpregs[off:]) }
+	for i, v := range []uint32{u16(0), u16(2), ftag, u16(12), u32(8), u16(20), u32(16), u16(6)} {
+		binary.LittleEndian.PutUint32(data[80+i*4:], v)
+	}
+	copy(data[112:368], fpregs[160:416])
+	copy(data[368:372], fpregs[24:28])
+	return data
+}
+
+// setGdbFpRegisters writes the x87 and sse registers of the `g` packet in data to the fxsave area
+func setGdbFpRegisters(fpregs []byte, data []byte) {
+	if len(fpregs) < 512 || len(data) < 372 {
+		return
+	}
+	for i := 0; i < 8; i++ {
+		copy(fpregs[32+i*16:32+i*16+10], data[i*10:])
+	}
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(data[off:]) }
+	binary.LittleEndian.PutUint16(fpregs[0:], uint16(u32(80)))
+	binary.LittleEndian.PutUint16(fpregs[2:], uint16(u32(84)))
+	var ftag byte
+	for i := uint(0); i < 8; i++ {
+		if (u32(88) >> (i * 2)) & 3 != 3 {
+			ftag |= 1 << i
+		}
+	}
+	fpregs[4] = ftag
+	binary.LittleEndian.PutUint16(fpregs[6:], uint16(u32(108)))
+	binary.LittleEndian.PutUint32(fpregs[8:], u32(96))
+	binary.LittleEndian.PutUint16(fpregs[12:], uint16(u32(92)))
+	binary.LittleEndian.PutUint32(fpregs[16:], u32(104))
+	binary.LittleEndian.PutUint16(fpregs[20:], uint16(u32(100)))
+	copy(fpregs[160:416], data[112:368])
+	copy(fpregs[24:28], data[368:372])
+}
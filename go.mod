@@ -12,8 +12,10 @@ require (
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/pkg/term v0.0.0-20190109203006-aa71e9d9e942 // indirect
 	github.com/stretchr/testify v1.3.0 // indirect
+	go.starlark.net v0.0.0-20190702223751-32f345186213
 	go.uber.org/atomic v1.4.0 // indirect
 	go.uber.org/multierr v1.1.0 // indirect
 	go.uber.org/zap v1.10.0
 	golang.org/x/arch v0.0.0-20190312162104-788fe5ffcd8c
+	gopkg.in/yaml.v2 v2.2.1
 )
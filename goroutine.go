@@ -0,0 +1,647 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the status of runtime.g, see runtime/runtime2.go
+const (
+	gIdle = 0
+	gRunnable = 1
+	gRunning = 2
+	gSyscall = 3
+	gWaiting = 4
+	gDead = 6
+	gCopystack = 8
+	gPreempted = 9
+	// gScan is set while the gc scans the stack of the goroutine
+	gScan = 0x1000
+)
+
+var gStatusNames = map[uint64]string{
+	gIdle: "idle", gRunnable: "runnable", gRunning: "running", gSyscall: "syscall",
+	gWaiting: "waiting", gDead: "dead", gCopystack: "copystack", gPreempted: "preempted",
+}
+
+// Goroutine is read from runtime.g of the debuggee
+type Goroutine struct {
+	id uint64
+	// addr is the address of runtime.g
+	addr uint64
+	status uint64
+	waitReason uint64
+	pc uint64
+	sp uint64
+	bp uint64
+	// sched is where the goroutine is saved when it is not running, it is not changed by the registers
+	sched gobuf
+	// stackLo and stackHi bound the stack of the goroutine, [stack.lo, stack.hi)
+	stackLo uint64
+	stackHi uint64
+	// gopc is the pc of the go statement which creates the goroutine, startpc is its function
+	gopc uint64
+	startpc uint64
+	// labels points to the pprof labels, 0 if there is none
+	labels uint64
+	// thread runs the goroutine, it is 0 if the goroutine is not on any thread
+	thread int
+}
+
+// gobuf is the registers of runtime.gobuf
+type gobuf struct {
+	pc uint64
+	sp uint64
+	bp uint64
+}
+
+// Status returns the status name, and the wait reason if the goroutine is waiting
+func (g *Goroutine) Status() string {
+	name, ok := gStatusNames[g.status]
+	if !ok {
+		name = fmt.Sprintf("status(%d)", g.status)
+	}
+	if g.status != gWaiting {
+		return name
+	}
+	if reason, err := waitReasonString(g.waitReason); err == nil && reason != "" {
+		return fmt.Sprintf("%s (%s)", name, reason)
+	}
+	return name
+}
+
+// structType returns the struct type named name in the debuggee
+func (bi *BI) structType(name string) (*dwarf.StructType, error) {
+	off, ok := bi.typeOffset(name)
+	if !ok {
+		return nil, fmt.Errorf("can't find type %s", name)
+	}
+	typ, err := bi.dwarfType(off)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := typ.(*dwarf.StructType)
+	if !ok {
+		return nil, fmt.Errorf("type %s is %s, not struct", name, typ.String())
+	}
+	return t, nil
+}
+
+// fieldOffset returns the offset and the type of the field at path like `sched.pc` in t
+func fieldOffset(t *dwarf.StructType, path string) (int64, dwarf.Type, error) {
+	var (
+		offset int64
+		typ dwarf.Type = t
+	)
+	for _, name := range strings.Split(path, ".") {
+		st, ok := typ.(*dwarf.StructType)
+		if !ok {
+			return 0, nil, fmt.Errorf("%s of %s is not struct", name, t.StructName)
+		}
+		var field *dwarf.StructField
+		for _, f := range st.Field {
+			if f.Name == name {
+				field = f
+				break
+			}
+		}
+		if field == nil {
+			return 0, nil, fmt.Errorf("can't find field %s of %s", path, t.StructName)
+		}
+		offset += field.ByteOffset
+		typ = field.Type
+		for {
+			if td, ok := typ.(*dwarf.TypedefType); ok {
+				typ = td.Type
+				continue
+			}
+			break
+		}
+	}
+	return offset, typ, nil
+}
+
+// readField reads the integer or pointer of path in the struct mem
+func readField(t *dwarf.StructType, mem []byte, path string) (uint64, error) {
+	off, typ, err := fieldOffset(t, path)
+	if err != nil {
+		return 0, err
+	}
+	size := typ.Size()
+	if off+size > int64(len(mem)) {
+		return 0, fmt.Errorf("field %s of %s is out of the struct", path, t.StructName)
+	}
+	switch size {
+	case 1:
+		return uint64(mem[off]), nil
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(mem[off:])), nil
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(mem[off:])), nil
+	case 8:
+		return binary.LittleEndian.Uint64(mem[off:]), nil
+	}
+	return 0, fmt.Errorf("field %s of %s is %d bytes", path, t.StructName, size)
+}
+
+func readWord(addr uint64) (uint64, error) {
+	mem := make([]byte, 8)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(mem), nil
+}
+
+// waitReasonString reads runtime.waitReasonStrings[reason] of the debuggee
+func waitReasonString(reason uint64) (string, error) {
+	v, ok := bi.packageVar("runtime.waitReasonStrings")
+	if !ok {
+		return "", fmt.Errorf("can't find runtime.waitReasonStrings")
+	}
+	typ, err := bi.variableType(v.entry)
+	if err != nil {
+		return "", err
+	}
+	if reason >= uint64(typ.Size() / 16) {
+		return "", fmt.Errorf("unknown wait reason %d", reason)
+	}
+	return readString(v.addr + reason * 16)
+}
+
+// Goroutines lists the goroutines in runtime.allgs which are not dead. The pc, sp and bp of a goroutine
+// running on a thread are its registers, the others are saved in g.sched
+func Goroutines() ([]*Goroutine, error) {
+	if cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	if err := bi.requireDwarf("the goroutines"); err != nil {
+		return nil, err
+	}
+	allgs, ok := bi.packageVar("runtime.allgs")
+	if !ok {
+		return nil, fmt.Errorf("can't find runtime.allgs")
+	}
+	gType, err := bi.structType("runtime.g")
+	if err != nil {
+		return nil, err
+	}
+	mType, err := bi.structType("runtime.m")
+	if err != nil {
+		return nil, err
+	}
+	// allgs is a slice of *g
+	header := make([]byte, 24)
+	if _, err = ptracePeekData(cmd.Process.Pid, uintptr(allgs.addr), header); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint64(header[8:])
+	ptrs := make([]byte, n * 8)
+	if _, err = ptracePeekData(cmd.Process.Pid, uintptr(binary.LittleEndian.Uint64(header)), ptrs); err != nil {
+		return nil, err
+	}
+
+	gs := make([]*Goroutine, 0, n)
+	for i := uint64(0); i < n; i++ {
+		g, err := loadGoroutine(binary.LittleEndian.Uint64(ptrs[i*8:]), gType, mType)
+		if err != nil {
+			return nil, err
+		}
+		if g.status != gDead {
+			gs = append(gs, g)
+		}
+	}
+	return gs, nil
+}
+
+func loadGoroutine(addr uint64, gType *dwarf.StructType, mType *dwarf.StructType) (*Goroutine, error) {
+	mem := make([]byte, gType.Size())
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+		return nil, err
+	}
+	g := &Goroutine{addr: addr}
+	// g.atomicstatus is atomic.Uint32 since go1.20
+	status := "atomicstatus.value"
+	if bi.goVersion.before(1, 20) {
+		status = "atomicstatus"
+	}
+	fields := []struct {
+		path string
+		val *uint64
+	}{
+		{"goid", &g.id}, {status, &g.status}, {"waitreason", &g.waitReason},
+		{"sched.pc", &g.sched.pc}, {"sched.sp", &g.sched.sp}, {"sched.bp", &g.sched.bp},
+		{"stack.lo", &g.stackLo}, {"stack.hi", &g.stackHi}, {"gopc", &g.gopc}, {"startpc", &g.startpc},
+	}
+	for _, f := range fields {
+		v, err := readField(gType, mem, f.path)
+		if err != nil {
+			return nil, err
+		}
+		*f.val = v
+	}
+	g.status &^= gScan
+	g.pc, g.sp, g.bp = g.sched.pc, g.sched.sp, g.sched.bp
+	// the programs built by old go have no labels
+	g.labels, _ = readField(gType, mem, "labels")
+
+	m, err := readField(gType, mem, "m")
+	if err != nil {
+		return nil, err
+	}
+	if m == 0 || (g.status != gRunning && g.status != gSyscall) {
+		return g, nil
+	}
+	off, _, err := fieldOffset(mType, "procid")
+	if err != nil {
+		return nil, err
+	}
+	procid, err := readWord(m + uint64(off))
+	if err != nil {
+		return nil, err
+	}
+	if !isThread(int(procid)) {
+		return g, nil
+	}
+	g.thread = int(procid)
+	var regs PtraceRegs
+	if err = ptraceGetRegs(g.thread, &regs); err != nil {
+		return nil, err
+	}
+	g.pc, g.sp, g.bp = regs.PC(), regs.Rsp, regs.Rbp
+	return g, nil
+}
+
+// threadGoroutine returns the address of the g running on tid, the go runtime keeps it in the TLS at gOffset from
+// fs_base. It is 0 if the thread is not running any goroutine, like in the scheduler
+func threadGoroutine(tid int) (uint64, error) {
+	base, err := ptraceGetFsBase(tid)
+	if err != nil {
+		return 0, err
+	}
+	if base == 0 {
+		return registerGoroutine(tid)
+	}
+	return readWord(base + uint64(bi.gOffset))
+}
+
+// registerGoroutine returns r14 of tid, which is the g register of ABIInternal in the go code. The thread without
+// the TLS runs no goroutine unless it is in the go code
+func registerGoroutine(tid int) (uint64, error) {
+	if bi.goVersion.abi0 {
+		return 0, nil
+	}
+	var regs PtraceRegs
+	if err := ptraceGetRegs(tid, &regs); err != nil {
+		return 0, err
+	}
+	if f, err := bi.findFunctionIncludePc(regs.PC()); err != nil || !f.cu.isGo() {
+		return 0, nil
+	}
+	return regs.R14, nil
+}
+
+// tlsGOffset is where the g is from fs_base. The go linker puts it at -8 without the TLS segment, the external
+// linker puts runtime.tlsg in the TLS block of the executable, which ends at fs_base and is aligned like lld does.
+// Mach-O has no fs_base, see ptraceGetFsBase
+func tlsGOffset(file *mappedFile, tlsg uint64, hasTlsg bool) int64 {
+	if file.elf == nil {
+		return -8
+	}
+	for _, prog := range file.elf.Progs {
+		if prog.Type != elf.PT_TLS || !hasTlsg {
+			continue
+		}
+		memsz := prog.Memsz
+		if prog.Align > 1 {
+			memsz += (-prog.Vaddr - prog.Memsz) & (prog.Align - 1)
+		}
+		return int64(tlsg) - int64(memsz)
+	}
+	return -8
+}
+
+// CurrentGoroutine reads the goroutine selected, or the one running on the current thread. It is nil if the
+// thread is not running any goroutine
+func CurrentGoroutine() (*Goroutine, error) {
+	if cmd == nil || cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	if err := bi.requireDwarf("the goroutines"); err != nil {
+		return nil, err
+	}
+	gType, err := bi.structType("runtime.g")
+	if err != nil {
+		return nil, err
+	}
+	mType, err := bi.structType("runtime.m")
+	if err != nil {
+		return nil, err
+	}
+	addr := uint64(0)
+	if curGoroutine != nil {
+		addr = curGoroutine.addr
+	} else if addr, err = threadGoroutine(currentThread()); err != nil {
+		return nil, err
+	}
+	if addr == 0 {
+		return nil, nil
+	}
+	return loadGoroutine(addr, gType, mType)
+}
+
+// currentGoroutineId returns the id of the goroutine selected or running on the current thread, 0 if it is unknown
+func currentGoroutineId() uint64 {
+	if curGoroutine != nil {
+		return curGoroutine.id
+	}
+	gType, err := bi.structType("runtime.g")
+	if err != nil {
+		return 0
+	}
+	off, _, err := fieldOffset(gType, "goid")
+	if err != nil {
+		return 0
+	}
+	addr, err := threadGoroutine(currentThread())
+	if err != nil || addr == 0 {
+		return 0
+	}
+	id, err := readWord(addr + uint64(off))
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// SwitchGoroutine selects the goroutine id for the stack traces, the variables and stepping. The thread running
+// it becomes the current thread, the goroutine not on any thread is inspected by its sched
+func SwitchGoroutine(id uint64) (*Goroutine, error) {
+	gs, err := Goroutines()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range gs {
+		if g.id != id {
+			continue
+		}
+		if g.thread != 0 {
+			if err = SwitchThread(g.thread); err != nil {
+				return nil, err
+			}
+			return g, nil
+		}
+		curGoroutine = g
+		curFrame = 0
+		return g, nil
+	}
+	return nil, fmt.Errorf("can't find goroutine %d", id)
+}
+
+// runToGoroutine runs the debuggee until the goroutine selected is scheduled on a thread, which becomes
+// the current one. The goroutine goes on at sched.pc, the other goroutines reaching it go on too
+func (bp *BP) runToGoroutine() (*StopEvent, error) {
+	g := curGoroutine
+	if g == nil {
+		return nil, nil
+	}
+	curGoroutine = nil
+	curFrame = 0
+	info, err := bp.SetInternalBreakPoint(g.pc)
+	if err != nil && err != HasExistedBreakPointErr {
+		curGoroutine = g
+		return nil, err
+	}
+	if info != nil {
+		defer bp.removeInternalBreakPoint(info)
+	}
+	for {
+		ev, err := bp.Resume()
+		if err != nil || ev.reason != StopBreakPoint || ev.pc != g.pc {
+			return ev, err
+		}
+		if currentGoroutineId() == g.id {
+			return nil, nil
+		}
+		if ev.info.kind == USERBPTYPE {
+			return ev, nil
+		}
+	}
+}
+
+// sameGoroutine tells whether the stop is on the goroutine id, it is true if any of the ids is unknown
+func sameGoroutine(id uint64) bool {
+	cur := currentGoroutineId()
+	return id == 0 || cur == 0 || cur == id
+}
+
+// isRuntimeFrame tells whether the function at pc belongs to the go runtime or the standard library
+func isRuntimeFrame(pc uint64) bool {
+	if f, err := bi.findFunctionIncludePc(pc); err == nil && strings.HasPrefix(f.name, "runtime.") {
+		return true
+	}
+	filename, _, err := bi.pcTofileLine(pc)
+	return err == nil && strings.HasPrefix(filename, runtime.GOROOT() + "/")
+}
+
+// UserLocation returns the pc of the topmost frame which is not in the go runtime or the standard library,
+// the frames are walked by rbp. The pc of the goroutine itself is returned if there is no such frame
+func (g *Goroutine) UserLocation() uint64 {
+	pc, rbp := g.pc, g.bp
+	for i := 0; i < 64 && rbp != 0; i++ {
+		if !isRuntimeFrame(pc) {
+			return pc
+		}
+		mem := make([]byte, 16)
+		if _, err := ptracePeekData(cmd.Process.Pid, uintptr(rbp), mem); err != nil {
+			break
+		}
+		rbp = binary.LittleEndian.Uint64(mem)
+		// the return address is the instruction after the call
+		pc = binary.LittleEndian.Uint64(mem[8:]) - 1
+	}
+	return g.pc
+}
+
+// Labels reads the pprof labels of the goroutine, runtime/pprof.labelMap keeps them in a slice of key and value,
+// which is the embedded label.Set in the newer go and LabelSet in the older
+func (g *Goroutine) Labels() (map[string]string, error) {
+	labels := map[string]string{}
+	if g.labels == 0 {
+		return labels, nil
+	}
+	t, err := bi.structType("runtime/pprof.labelMap")
+	if err != nil {
+		return nil, err
+	}
+	off, _, err := fieldOffset(t, "Set.List")
+	if err != nil {
+		if off, _, err = fieldOffset(t, "LabelSet.list"); err != nil {
+			return nil, err
+		}
+	}
+	header := make([]byte, 16)
+	if _, err = ptracePeekData(cmd.Process.Pid, uintptr(g.labels + uint64(off)), header); err != nil {
+		return nil, err
+	}
+	array, n := binary.LittleEndian.Uint64(header), binary.LittleEndian.Uint64(header[8:])
+	// each label is two strings
+	for i := uint64(0); i < n; i++ {
+		key, err := readString(array + i * 32)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readString(array + i * 32 + 16)
+		if err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// pcLocation returns `file:line function` of pc
+func pcLocation(pc uint64) string {
+	loc := ""
+	if filename, lineno, err := bi.pcTofileLine(pc); err == nil {
+		loc = fmt.Sprintf("%s:%d", filename, lineno)
+	}
+	if f, err := bi.findFunctionIncludePc(pc); err == nil {
+		loc = fmt.Sprintf("%s %s", loc, f.name)
+	}
+	return loc
+}
+
+// matchGoroutine tells whether g matches the filter `kind value`, the kinds are userloc, status, reason and label
+func matchGoroutine(g *Goroutine, kind string, value string) (bool, error) {
+	switch kind {
+	case "userloc":
+		return strings.Contains(pcLocation(g.UserLocation()), value), nil
+	case "status":
+		name, ok := gStatusNames[g.status]
+		return ok && name == value, nil
+	case "reason":
+		if g.status != gWaiting {
+			return false, nil
+		}
+		reason, err := waitReasonString(g.waitReason)
+		return err == nil && reason == value, nil
+	case "label":
+		labels, err := g.Labels()
+		if err != nil {
+			return false, err
+		}
+		// `key` matches any value
+		if i := strings.Index(value, "="); i >= 0 {
+			v, ok := labels[value[:i]]
+			return ok && v == value[i+1:], nil
+		}
+		_, ok := labels[value]
+		return ok, nil
+	}
+	return false, nil
+}
+
+// sortGoroutines sorts gs by the key id, status or userloc
+func sortGoroutines(gs []*Goroutine, key string) error {
+	var less func(a *Goroutine, b *Goroutine) bool
+	switch key {
+	case "id":
+		less = func(a *Goroutine, b *Goroutine) bool { return a.id < b.id }
+	case "status":
+		less = func(a *Goroutine, b *Goroutine) bool { return a.Status() < b.Status() }
+	case "userloc":
+		locs := map[*Goroutine]string{}
+		for _, g := range gs {
+			locs[g] = pcLocation(g.UserLocation())
+		}
+		less = func(a *Goroutine, b *Goroutine) bool { return locs[a] < locs[b] }
+	default:
+		return fmt.Errorf("unknown sort key `%s`, expect id, status or userloc", key)
+	}
+	sort.SliceStable(gs, func(i, j int) bool { return less(gs[i], gs[j]) })
+	return nil
+}
+
+// QueryGoroutines lists the goroutines by the arguments of `goroutines`: `-with kind value` keeps the ones
+// matching all filters, the value goes on until the next option, `-sort key` sorts them and `-limit n` keeps
+// the first n. The number of the goroutines matched before the limit is returned too
+func QueryGoroutines(args []string) ([]*Goroutine, int, error) {
+	type filter struct {
+		kind string
+		value string
+	}
+	var (
+		filters []filter
+		sortKey string
+		limit int
+	)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-with":
+			if i+2 >= len(args) {
+				return nil, 0, fmt.Errorf("-with expects a kind and a value")
+			}
+			f := filter{kind: args[i+1], value: args[i+2]}
+			if f.kind != "userloc" && f.kind != "status" && f.kind != "reason" && f.kind != "label" {
+				return nil, 0, fmt.Errorf("unknown filter `%s`, expect userloc, status, reason or label", f.kind)
+			}
+			for i += 2; i+1 < len(args) && !strings.HasPrefix(args[i+1], "-"); i++ {
+				f.value += " " + args[i+1]
+			}
+			filters = append(filters, f)
+		case "-sort":
+			if i+1 >= len(args) {
+				return nil, 0, fmt.Errorf("-sort expects a key")
+			}
+			i++
+			sortKey = args[i]
+		case "-limit":
+			if i+1 >= len(args) {
+				return nil, 0, fmt.Errorf("-limit expects a number")
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return nil, 0, fmt.Errorf("-limit expects a positive number, not %s", args[i])
+			}
+			limit = n
+		default:
+			return nil, 0, fmt.Errorf("unknown option `%s`, expect -with, -sort or -limit", args[i])
+		}
+	}
+
+	gs, err := Goroutines()
+	if err != nil {
+		return nil, 0, err
+	}
+	matched := make([]*Goroutine, 0, len(gs))
+	for _, g := range gs {
+		ok := true
+		for _, f := range filters {
+			if ok, err = matchGoroutine(g, f.kind, f.value); err != nil {
+				return nil, 0, err
+			} else if !ok {
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, g)
+		}
+	}
+	if sortKey != "" {
+		if err = sortGoroutines(matched, sortKey); err != nil {
+			return nil, 0, err
+		}
+	}
+	total := len(matched)
+	if limit > 0 && limit < total {
+		matched = matched[:limit]
+	}
+	return matched, total, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// goVersion is the version of the go building the binary, like go1.22.3. The zero one is unknown, like the
+// programs not written in go, which are read by the layouts of the newest go
+type goVersion struct {
+	major int
+	minor int
+	patch int
+	raw   string
+	// abi0 tells the functions get the arguments and return the results on the stack by ABI0, go1.17 passes them
+	// in the registers by ABIInternal. noSwissMap is GOEXPERIMENT=noswissmap, the maps are hmap
+	abi0       bool
+	noSwissMap bool
+}
+
+// minGoVersion is the oldest go whose debug info godbg reads
+var minGoVersion = goVersion{major: 1, minor: 12, raw: "go1.12"}
+
+// parseGoVersion reads the version in s like `go1.22.3`, `go1.21rc2` or `devel go1.23-abcdef`
+func parseGoVersion(s string) (goVersion, bool) {
+	i := strings.Index(s, "go1.")
+	if i < 0 {
+		return goVersion{}, false
+	}
+	raw := s[i:]
+	if end := strings.IndexAny(raw, " ;"); end >= 0 {
+		raw = raw[:end]
+	}
+	numbers := make([]int, 0, 3)
+	for _, part := range strings.SplitN(strings.TrimPrefix(raw, "go"), ".", 3) {
+		digits := part
+		if end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+			digits = part[:end]
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			break
+		}
+		numbers = append(numbers, n)
+		if digits != part {
+			// rc2 or -abcdef ends the version
+			break
+		}
+	}
+	if len(numbers) < 2 {
+		return goVersion{}, false
+	}
+	v := goVersion{major: numbers[0], minor: numbers[1], raw: raw}
+	if len(numbers) == 3 {
+		v.patch = numbers[2]
+	}
+	v.abi0 = v.before(1, 17)
+	return v, true
+}
+
+func (v goVersion) known() bool {
+	return v.major != 0
+}
+
+// before tells whether v is older than go major.minor, the unknown one is not
+func (v goVersion) before(major int, minor int) bool {
+	return v.known() && (v.major < major || (v.major == major && v.minor < minor))
+}
+
+// swissMap tells whether the maps are the swiss tables of go1.24
+func (v goVersion) swissMap() bool {
+	return !v.before(1, 24) && !v.noSwissMap
+}
+
+func (v goVersion) String() string {
+	if !v.known() {
+		return "unknown"
+	}
+	return v.raw
+}
+
+// detectGoVersion finds the version by runtime.buildVersion, or by the producers of the units like
+// `Go cmd/compile go1.22.3; regabi` without it. The experiments of the producer of runtime change the ABI and the
+// maps of the older go
+func (bi *BI) detectGoVersion() {
+	var producer string
+	for _, cu := range bi.CompileUnits {
+		// the unit of .gopclntab has no entry
+		if cu.entry == nil {
+			continue
+		}
+		p, _ := cu.entry.Val(dwarf.AttrProducer).(string)
+		if strings.HasPrefix(p, "Go cmd/compile ") && (producer == "" || cu.name == "runtime") {
+			producer = p
+		}
+	}
+	v, ok := parseGoVersion(bi.buildVersion)
+	if !ok {
+		v, _ = parseGoVersion(producer)
+	}
+	if i := strings.Index(producer, ";"); i >= 0 {
+		for _, experiment := range strings.Fields(producer[i+1:]) {
+			switch experiment {
+			case "regabi":
+				v.abi0 = false
+			case "noswissmap":
+				v.noSwissMap = true
+			}
+		}
+	}
+	bi.goVersion = v
+}
+
+// checkGoVersion refuses the binaries built by the go older than minGoVersion
+func (bi *BI) checkGoVersion() error {
+	if bi.goVersion.before(minGoVersion.major, minGoVersion.minor) {
+		return &UnsupportGoVersionErr{version: bi.goVersion}
+	}
+	return nil
+}
+
+// readBuildVersion reads the string runtime.buildVersion at addr in the data of the executable file, the linker
+// sets it to the version of go
+func readBuildVersion(file *mappedFile, addr uint64) string {
+	header := file.readAddr(addr, 16)
+	if header == nil {
+		return ""
+	}
+	data := file.readAddr(binary.LittleEndian.Uint64(header), binary.LittleEndian.Uint64(header[8:]))
+	return string(data)
+}
+
+// readAddr returns n bytes at the address addr of the PT_LOAD segments in the file, nil if they are not in it
+func (m *mappedFile) readAddr(addr uint64, n uint64) []byte {
+	for _, prog := range m.segments() {
+		if prog.Type != elf.PT_LOAD || addr < prog.Vaddr || addr+n > prog.Vaddr+prog.Filesz {
+			continue
+		}
+		off := prog.Offset + addr - prog.Vaddr
+		if off+n > uint64(len(m.data)) {
+			return nil
+		}
+		return m.data[off : off+n]
+	}
+	return nil
+}
+
+// printGoVersion prints the go of the binary for `info version`
+func printGoVersion() {
+	abi := "ABIInternal"
+	if bi.goVersion.abi0 {
+		abi = "ABI0"
+	}
+	maps := "swiss"
+	if !bi.goVersion.swissMap() {
+		maps = "hmap"
+	}
+	fmt.Fprintf(stdout, "%s, the arguments by %s, the maps are %s\n", bi.goVersion, abi, maps)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxHistory is how many commands the history file keeps, the older ones are dropped when it is loaded
+const maxHistory = 1000
+
+// historyFile is ~/.godbg_history, the commands input are appended to it and recalled by the up arrow
+// in the later sessions. It is empty without the home directory
+func historyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return path.Join(home, ".godbg_history")
+}
+
+// loadHistory returns the last maxHistory commands in filename, oldest first, the file is cut to them
+func loadHistory(filename string) []string {
+	if filename == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	history := make([]string, 0)
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) != "" {
+			history = append(history, line)
+		}
+	}
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+		ioutil.WriteFile(filename, []byte(strings.Join(history, "\n")+"\n"), 0600)
+	}
+	return history
+}
+
+// appendHistory appends input to filename like the prompt adds it to the history, the blank ones are skipped
+func appendHistory(filename string, input string) error {
+	if filename == "" || strings.TrimSpace(input) == "" {
+		return nil
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(input + "\n")
+	return err
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// indexCache is false by --no-index-cache, then the index is parsed on every analyze and never saved
+var indexCache = true
+
+// indexCacheVersion changes with cachedIndex, the files of the other versions are parsed and saved again
+const indexCacheVersion = 3
+
+// cachedIndex is what ParseLineAndInfoSection and indexSymbols find in a binary, it is saved in the cache
+// directory by the build ID. It is invalid if the mtime or the size of the binary changes
+type cachedIndex struct {
+	Version   int
+	BuildID   string
+	ModTime   int64
+	Size      int64
+	TypesAddr uint64
+	BuildVersion string
+	GOffset   int64
+	Units     []cachedUnit
+	// Functions are the indexes in Units of the functions in the symbol table
+	Functions map[string]int
+}
+
+type cachedUnit struct {
+	Offset dwarf.Offset
+	Ranges [][2]uint64
+	Files  []string
+}
+
+// indexCacheDir is $XDG_CACHE_HOME/godbg/index, ~/.cache/godbg/index without XDG_CACHE_HOME
+func indexCacheDir() (string, error) {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = path.Join(home, ".cache")
+	}
+	return path.Join(dir, "godbg", "index"), nil
+}
+
+// buildID returns the go build ID in .note.go.buildid, or the hex of .note.gnu.build-id. The go linker writes
+// the one of Mach-O at the beginning of __text
+func buildID(file *mappedFile) string {
+	if file.macho != nil {
+		_, id := machoBuildID(file)
+		return id
+	}
+	elffile := file.elf
+	if s := elffile.Section(".note.go.buildid"); s != nil {
+		if desc, err := noteDesc(elffile, s); err == nil {
+			return string(desc)
+		}
+	}
+	if s := elffile.Section(".note.gnu.build-id"); s != nil {
+		if desc, err := noteDesc(elffile, s); err == nil {
+			return hex.EncodeToString(desc)
+		}
+	}
+	return ""
+}
+
+// goBuildIDPrefix begins the build ID of go in the text, which is like `\xff Go build ID: "id"\n \xff`
+const goBuildIDPrefix = "\xff Go build ID: \""
+
+// machoBuildID returns the header of the go build ID in __text of Mach-O and the ID in it, they are empty if the
+// binary is not built by go
+func machoBuildID(file *mappedFile) ([]byte, string) {
+	text, err := file.section(".text")
+	if err != nil || !bytes.HasPrefix(text, []byte(goBuildIDPrefix)) {
+		return nil, ""
+	}
+	end := bytes.Index(text, []byte("\"\n \xff"))
+	if end < 0 {
+		return nil, ""
+	}
+	return text[:end+4], string(text[len(goBuildIDPrefix):end])
+}
+
+// buildIDBytes returns the address and the data of the build ID which the process maps too, the note of ELF or the
+// header of Mach-O in __text. The data is nil if there is no build ID
+func (m *mappedFile) buildIDBytes() (uint64, []byte, error) {
+	if m.macho != nil {
+		header, _ := machoBuildID(m)
+		if header == nil {
+			return 0, nil, nil
+		}
+		return m.lookupSection(".text").addr, header, nil
+	}
+	for _, name := range []string{".note.go.buildid", ".note.gnu.build-id"} {
+		section := m.elf.Section(name)
+		if section == nil || section.Addr == 0 {
+			continue
+		}
+		data, err := section.Data()
+		return section.Addr, data, err
+	}
+	return 0, nil, nil
+}
+
+// noteDesc returns the desc of the note in s, which follows the header of 12 bytes and the name aligned to 4
+func noteDesc(elffile *elf.File, s *elf.Section) ([]byte, error) {
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 {
+		return nil, errors.New("the note is too short")
+	}
+	namesz := uint64(elffile.ByteOrder.Uint32(data[0:4]))
+	descsz := uint64(elffile.ByteOrder.Uint32(data[4:8]))
+	off := 12 + (namesz+3)&^3
+	if uint64(len(data)) < off+descsz {
+		return nil, errors.New("the note is too short")
+	}
+	return data[off : off+descsz], nil
+}
+
+// indexCacheFile is named by the hash of the build ID, or of the absolute path of the binary without it
+func indexCacheFile(execfile string, id string) (string, error) {
+	dir, err := indexCacheDir()
+	if err != nil {
+		return "", err
+	}
+	key := id
+	if key == "" {
+		if key, err = filepath.Abs(execfile); err != nil {
+			return "", err
+		}
+	}
+	sum := sha256.Sum256([]byte(key))
+	return path.Join(dir, hex.EncodeToString(sum[:])), nil
+}
+
+// loadIndexCache restores the compile units, funcIndex and TypesAddr from the cache of execfile, bi is unchanged
+// if the cache is missing or invalid
+func (bi *BI) loadIndexCache(execfile string, file *mappedFile) bool {
+	info, err := os.Stat(execfile)
+	if err != nil {
+		return false
+	}
+	id := buildID(file)
+	filename, err := indexCacheFile(execfile, id)
+	if err != nil {
+		return false
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	var index cachedIndex
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&index); err != nil {
+		dwarfLogger.Debug("invalid index cache", zap.String("file", filename), zap.Error(err))
+		return false
+	}
+	if index.Version != indexCacheVersion || index.BuildID != id || index.ModTime != info.ModTime().UnixNano() ||
+		index.Size != info.Size() {
+		dwarfLogger.Debug("stale index cache", zap.String("file", filename))
+		return false
+	}
+
+	// the entries of the units are read again, they are where the children are parsed from
+	var (
+		r     = bi.DwarfData.Reader()
+		units = make([]*CompileUnit, 0, len(index.Units))
+		files = make([][]string, 0, len(index.Units))
+	)
+	for _, u := range index.Units {
+		r.Seek(u.Offset)
+		entry, err := r.Next()
+		if err != nil || entry == nil || entry.Tag != dwarf.TagCompileUnit || entry.Offset != u.Offset {
+			dwarfLogger.Debug("invalid index cache", zap.String("file", filename))
+			return false
+		}
+		cu := newCompileUnit(entry)
+		cu.ranges = u.Ranges
+		units = append(units, cu)
+		files = append(files, u.Files)
+	}
+	for _, i := range index.Functions {
+		if i < 0 || i >= len(units) {
+			return false
+		}
+	}
+
+	bi.CompileUnits = units
+	bi.indexUnits(files)
+	for name, i := range index.Functions {
+		name = bi.strings.intern(name)
+		bi.funcIndex[name] = units[i]
+		bi.funcNames = append(bi.funcNames, name)
+	}
+	sort.Strings(bi.funcNames)
+	bi.TypesAddr, bi.buildVersion, bi.gOffset = index.TypesAddr, index.BuildVersion, index.GOffset
+	return true
+}
+
+// saveIndexCache writes the index of bi to the cache of execfile, it is renamed at last so the readers never see
+// a part of it
+func (bi *BI) saveIndexCache(execfile string, file *mappedFile) error {
+	info, err := os.Stat(execfile)
+	if err != nil {
+		return err
+	}
+	id := buildID(file)
+	filename, err := indexCacheFile(execfile, id)
+	if err != nil {
+		return err
+	}
+	index := cachedIndex{Version: indexCacheVersion, BuildID: id, ModTime: info.ModTime().UnixNano(), Size: info.Size(),
+		TypesAddr: bi.TypesAddr, BuildVersion: bi.buildVersion, GOffset: bi.gOffset, Units: make([]cachedUnit, len(bi.CompileUnits)), Functions: make(map[string]int)}
+	unitIndex := make(map[*CompileUnit]int)
+	for i, cu := range bi.CompileUnits {
+		unitIndex[cu] = i
+		index.Units[i] = cachedUnit{Offset: cu.entry.Offset, Ranges: cu.ranges}
+	}
+	for _, file := range bi.files {
+		for _, cu := range bi.fileIndex[file] {
+			index.Units[unitIndex[cu]].Files = append(index.Units[unitIndex[cu]].Files, file)
+		}
+	}
+	for name, cu := range bi.funcIndex {
+		index.Functions[name] = unitIndex[cu]
+	}
+
+	if err = os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(path.Dir(filename), "index")
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(f).Encode(&index); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
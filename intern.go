@@ -0,0 +1,25 @@
+package main
+
+// stringTable keeps one copy of the names and the paths of a binary. The units repeat the same files in their line
+// tables and the symbol table repeats the names of the functions, each of them is read as a new string
+type stringTable struct {
+	strings map[string]string
+	// bytes is the length of the strings kept, saved is the length of the copies dropped
+	bytes int
+	saved int
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{strings: make(map[string]string)}
+}
+
+// intern returns the copy of s kept by the table, s becomes it if there is none
+func (t *stringTable) intern(s string) string {
+	if kept, ok := t.strings[s]; ok {
+		t.saved += len(s)
+		return kept
+	}
+	t.strings[s] = s
+	t.bytes += len(s)
+	return s
+}
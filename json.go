@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/chainhelen/godbg/api"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonOutput is set by --json or `output json`. The commands of the breakpoints, the resuming, the stack, the goroutines,
+// the locals and print emit the replies of the json-rpc api as lines of json then, the others print the text still
+var jsonOutput bool
+
+// jsonServer runs the methods of the api in place, the prompt is on the thread tracing the debuggee already
+var jsonServer = &RPCServer{}
+
+// runJSONCommand runs input in the json mode, it is false if input has no json output
+func runJSONCommand(input string) bool {
+	sps := strings.Split(input, " ")
+	var (
+		reply interface{}
+		err   error
+	)
+	switch {
+	case len(sps) == 2 && (sps[0] == "b" || sps[0] == "break"):
+		out := &api.CreateBreakpointOut{}
+		reply, err = out, jsonServer.CreateBreakpoint(api.CreateBreakpointIn{Loc: sps[1]}, out)
+	case len(sps) == 1 && sps[0] == "bl":
+		out := &api.ListBreakpointsOut{}
+		reply, err = out, jsonServer.ListBreakpoints(api.ListBreakpointsIn{}, out)
+	case len(sps) == 2 && (sps[0] == "bc" || sps[0] == "bclear"):
+		id, e := strconv.Atoi(sps[1])
+		if e != nil {
+			printJSON(nil, fmt.Errorf("wrong breakpoint id `%s`", sps[1]))
+			return true
+		}
+		out := &api.ClearBreakpointOut{}
+		reply, err = out, jsonServer.ClearBreakpoint(api.ClearBreakpointIn{Id: id}, out)
+	case len(sps) == 1 && jsonCommands[sps[0]] != "":
+		out := &api.CommandOut{}
+		reply, err = out, jsonServer.Command(api.CommandIn{Name: jsonCommands[sps[0]]}, out)
+	case len(sps) == 1 && sps[0] == "bt":
+		out := &api.StacktraceOut{}
+		reply, err = out, jsonServer.Stacktrace(api.StacktraceIn{}, out)
+	case len(sps) == 1 && sps[0] == "goroutines":
+		out := &api.ListGoroutinesOut{}
+		reply, err = out, jsonServer.ListGoroutines(api.ListGoroutinesIn{}, out)
+	case len(sps) == 1 && sps[0] == "locals":
+		out := &api.ListLocalsOut{}
+		reply, err = out, jsonServer.ListLocals(api.ListLocalsIn{Scope: api.Scope{Frame: curFrame}}, out)
+	case len(sps) >= 2 && (sps[0] == "p" || sps[0] == "print"):
+		out := &api.EvalOut{}
+		reply, err = out, jsonServer.Eval(api.EvalIn{Scope: api.Scope{Frame: curFrame}, Expr: strings.Join(sps[1:], " ")}, out)
+	default:
+		return false
+	}
+	printJSON(reply, err)
+	return true
+}
+
+// jsonCommands are the resuming commands of the prompt and their names in the api
+var jsonCommands = map[string]string{
+	"c": api.Continue, "continue": api.Continue, "n": api.Next, "next": api.Next,
+	"s": api.Step, "step": api.Step, "so": api.StepOut, "stepout": api.StepOut,
+}
+
+// printJSON prints the reply to stdout, or the error like `{"Error": "..."}` to stderr
+func printJSON(reply interface{}, err error) {
+	if err != nil {
+		data, _ := json.Marshal(struct{ Error string }{err.Error()})
+		fmt.Fprintf(stderr, "%s\n", data)
+		return
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		printJSON(nil, err)
+		return
+	}
+	fmt.Fprintf(stdout, "%s\n", data)
+}
+
+// runCommandLines runs the lines of r as the commands, it is the prompt when stdin is not a terminal
+func runCommandLines(r io.Reader, run func(string)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			run(line)
+		}
+	}
+	return scanner.Err()
+}
@@ -7,6 +7,8 @@ import (
 	"go.uber.org/zap"
 	"io"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 )
 
@@ -23,7 +25,108 @@ func listFileLineByPtracePc(rangeline int) error {
 	return listFileLine(filename, lineno, rangeline)
 }
 
+// listFileLine lists the lines around lineno, which is where the debuggee stops
 func listFileLine(filename string, lineno int, rangeline int) error{
+	return listSource(filename, lineno, rangeline, lineno)
+}
+
+// listLocation lists the lines around loc for `list`, the line of the frame selected is marked if it is in them
+func listLocation(loc string, rangeline int) error {
+	filename, lineno, err := parseListLoc(loc)
+	if err != nil {
+		return err
+	}
+	current := 0
+	if f, l := selectedFrameLine(); f == filename {
+		current = l
+	}
+	return listSource(filename, lineno, rangeline, current)
+}
+
+// parseListLoc returns where loc is, it is empty for the frame selected, or `file.go:line`, `line` in the file of the
+// frame selected, a function, `*addr`. The relative file is found in the sources of the binary
+func parseListLoc(loc string) (string, int, error) {
+	if loc == "" {
+		filename, lineno := selectedFrameLine()
+		if lineno == 0 {
+			return "", 0, NoProcessRuning
+		}
+		return filename, lineno, nil
+	}
+	if strings.HasPrefix(loc, "*") {
+		pc, err := strconv.ParseUint(loc[1:], 0, 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("wrong address `%s`", loc[1:])
+		}
+		return bi.pcTofileLine(pc)
+	}
+	if lineno, err := strconv.Atoi(loc); err == nil {
+		filename, current := selectedFrameLine()
+		if current == 0 {
+			return "", 0, NoProcessRuning
+		}
+		return filename, lineno, nil
+	}
+	if strings.Contains(loc, ":") {
+		filename, lineno, err := parseLoc(loc)
+		if err != nil {
+			return "", 0, err
+		}
+		return resolveSource(filename), lineno, nil
+	}
+	f, err := bi.findFunctionByName(loc)
+	if err != nil {
+		return "", 0, err
+	}
+	return bi.pcTofileLine(f.lowpc)
+}
+
+// resolveSource returns the source of the binary which filename is relative to the working directory or ends with,
+// filename itself if there is none or more than one
+func resolveSource(filename string) string {
+	if path.IsAbs(filename) {
+		return unsubstitutePath(filename)
+	}
+	curWd, _ := os.Getwd()
+	if full := unsubstitutePath(path.Join(curWd, filename)); bi.fileIndex[full] != nil {
+		return full
+	}
+	if found := bi.sourcesWithSuffix(path.Clean(filename)); len(found) == 1 {
+		return found[0]
+	}
+	return filename
+}
+
+// selectedFrameLine returns where the frame selected by up, down and frame is, the line is 0 without any process
+func selectedFrameLine() (string, int) {
+	if cmd == nil || cmd.Process == nil {
+		return "", 0
+	}
+	frames, err := Stacktrace()
+	if err != nil || curFrame >= len(frames) {
+		return "", 0
+	}
+	return frames[curFrame].filename, frames[curFrame].lineno
+}
+
+// breakpointLines returns the lines of filename where the user breakpoints are. The filename of a breakpoint
+// is the one input, which may be relative, so the lines are found by the pcs
+func breakpointLines(filename string) map[int]bool {
+	lines := make(map[int]bool)
+	for _, info := range bp.infos {
+		if info.kind == INTERNALBPTYPE {
+			continue
+		}
+		if f, l, err := bi.pcTofileLine(info.pc); err == nil && f == filename {
+			lines[l] = true
+		}
+	}
+	return lines
+}
+
+// listSource lists the lines around lineno, `==>` marks current and `*` marks the lines of the breakpoints. It warns
+// if the source is newer than the binary
+func listSource(filename string, lineno int, rangeline int, current int) error {
 	rangeMin := lineno - rangeline - 1
 	rangeMax := lineno + rangeline - 1
 
@@ -35,16 +138,20 @@ func listFileLine(filename string, lineno int, rangeline int) error{
 		return errors.New("not right linenoe or rangeline")
 	}
 
-	file, err := os.OpenFile(filename, os.O_RDONLY, 0755)
+	file, err := os.OpenFile(substitutePath(filename), os.O_RDONLY, 0755)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 	reader := bufio.NewReader(file)
 
+	if bi.staleSource(filename) {
+		printStaleSource(filename)
+	}
 	listFileLineBytesSlice := make([]string, 0, rangeMax - rangeMin + 2)
 
-	listFileLineBytesSlice = append(listFileLineBytesSlice, fmt.Sprintf("list %s:%d\n", filename, lineno))
+	listFileLineBytesSlice = append(listFileLineBytesSlice, colorize(fmt.Sprintf("list %s:%d", filename, lineno), colorHeadline) + "\n")
+	breaks := breakpointLines(filename)
 	var curLine int
 	for {
 		curLine++
@@ -60,12 +167,15 @@ func listFileLine(filename string, lineno int, rangeline int) error{
 			return err
 		}
 		if rangeMin <= curLine && curLine <= rangeMax {
-			if curLine == lineno {
-				lineBytes = append([]byte(fmt.Sprintf("==>%7d: ", curLine)), lineBytes...)
+			text := highlightSource(strings.TrimSuffix(string(lineBytes), "\n")) + "\n"
+			if curLine == current {
+				text = colorize(fmt.Sprintf("==>%7d:", curLine), colorCurrent) + " " + text
+			} else if breaks[curLine] {
+				text = colorize(fmt.Sprintf(" * %7d:", curLine), colorBreak) + " " + text
 			} else {
-				lineBytes = append([]byte(fmt.Sprintf("   %7d: ", curLine)), lineBytes...)
+				text = fmt.Sprintf("   %7d: ", curLine) + text
 			}
-			listFileLineBytesSlice = append(listFileLineBytesSlice, string(lineBytes))
+			listFileLineBytesSlice = append(listFileLineBytesSlice, text)
 		}
 	}
 
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+)
+
+// the kinds of the entries of .debug_loclists, see 7.7.3 of dwarf 5
+const (
+	DW_LLE_end_of_list = 0x00
+	DW_LLE_base_addressx = 0x01
+	DW_LLE_startx_endx = 0x02
+	DW_LLE_startx_length = 0x03
+	DW_LLE_offset_pair = 0x04
+	DW_LLE_default_location = 0x05
+	DW_LLE_base_address = 0x06
+	DW_LLE_start_end = 0x07
+	DW_LLE_start_length = 0x08
+)
+
+// dwarfRegisters are the names of the dwarf register numbers on amd64, see the System V ABI
+var dwarfRegisters = []string{"rax", "rdx", "rcx", "rbx", "rsi", "rdi", "rbp", "rsp",
+	"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15"}
+
+// piece is a part of the value of a variable, which is in the register reg or in the memory at addr
+type piece struct {
+	size int
+	inReg bool
+	reg int
+	addr uint64
+}
+
+// locationExpr returns the location expression of the variable at pc, the location list of an argument
+// tells it moves from the register to the stack after the prologue
+func locationExpr(fv *dwarf.Entry, fn *Function, pc uint64) ([]byte, error) {
+	switch loc := fv.Val(dwarf.AttrLocation).(type) {
+	case []byte:
+		return loc, nil
+	case int64:
+		var (
+			expr []byte
+			err error
+		)
+		if bi.LocListsV5 {
+			expr, err = bi.locListV5(uint64(loc), fn.cu, pc)
+		} else {
+			expr, err = bi.locList(uint64(loc), fn.cu, pc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if expr == nil {
+			name, _ := fv.Val(dwarf.AttrName).(string)
+			return nil, fmt.Errorf("%s is unavailable at %#x", name, pc)
+		}
+		return expr, nil
+	}
+	return nil, &UnsupportVariableErr{entry: fv}
+}
+
+// debugAddr reads the address of index in .debug_addr of cu
+func (bi *BI) debugAddr(cu *CompileUnit, index uint64) (uint64, error) {
+	off := cu.addrBase + index * 8
+	if off + 8 > uint64(len(bi.DebugAddr)) {
+		return 0, fmt.Errorf("the address %d is out of .debug_addr", index)
+	}
+	return binary.LittleEndian.Uint64(bi.DebugAddr[off:]), nil
+}
+
+// locListV5 finds the expression of the entry covering pc in the location list at off of .debug_loclists,
+// it is nil if none covers pc
+func (bi *BI) locListV5(off uint64, cu *CompileUnit, pc uint64) ([]byte, error) {
+	if off >= uint64(len(bi.locLists())) {
+		return nil, fmt.Errorf("the location list %d is out of .debug_loclists", off)
+	}
+	buf := bytes.NewBuffer(bi.locLists()[off:])
+	base := cu.lowpc
+	for {
+		kind, err := buf.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		var begin, end uint64
+		switch kind {
+		case DW_LLE_end_of_list:
+			return nil, nil
+		case DW_LLE_base_addressx:
+			index, _, _ := DecodeULEB128(buf)
+			if base, err = bi.debugAddr(cu, index); err != nil {
+				return nil, err
+			}
+			continue
+		case DW_LLE_base_address:
+			base = binary.LittleEndian.Uint64(buf.Next(8))
+			continue
+		case DW_LLE_startx_endx, DW_LLE_startx_length:
+			index, _, _ := DecodeULEB128(buf)
+			if begin, err = bi.debugAddr(cu, index); err != nil {
+				return nil, err
+			}
+			n, _, _ := DecodeULEB128(buf)
+			if kind == DW_LLE_startx_length {
+				end = begin + n
+			} else if end, err = bi.debugAddr(cu, n); err != nil {
+				return nil, err
+			}
+		case DW_LLE_offset_pair:
+			b, _, _ := DecodeULEB128(buf)
+			e, _, _ := DecodeULEB128(buf)
+			begin, end = base + b, base + e
+		case DW_LLE_default_location:
+			begin, end = 0, ^uint64(0)
+		case DW_LLE_start_end:
+			begin = binary.LittleEndian.Uint64(buf.Next(8))
+			end = binary.LittleEndian.Uint64(buf.Next(8))
+		case DW_LLE_start_length:
+			begin = binary.LittleEndian.Uint64(buf.Next(8))
+			n, _, _ := DecodeULEB128(buf)
+			end = begin + n
+		default:
+			return nil, fmt.Errorf("unknown location list entry %#x", kind)
+		}
+		n, _, _ := DecodeULEB128(buf)
+		expr := buf.Next(int(n))
+		if begin <= pc && pc < end {
+			return expr, nil
+		}
+	}
+}
+
+// locList finds the expression covering pc in the location list at off of .debug_loc, the addresses
+// are relative to the base address, which is selected by the entry beginning with the largest address
+func (bi *BI) locList(off uint64, cu *CompileUnit, pc uint64) ([]byte, error) {
+	if off >= uint64(len(bi.locLists())) {
+		return nil, fmt.Errorf("the location list %d is out of .debug_loc", off)
+	}
+	buf := bytes.NewBuffer(bi.locLists()[off:])
+	base := cu.lowpc
+	for buf.Len() >= 16 {
+		begin := binary.LittleEndian.Uint64(buf.Next(8))
+		end := binary.LittleEndian.Uint64(buf.Next(8))
+		if begin == 0 && end == 0 {
+			return nil, nil
+		}
+		if begin == ^uint64(0) {
+			base = end
+			continue
+		}
+		n := binary.LittleEndian.Uint16(buf.Next(2))
+		expr := buf.Next(int(n))
+		if base + begin <= pc && pc < base + end {
+			return expr, nil
+		}
+	}
+	return nil, nil
+}
+
+// evalLocation evaluates the location expression in frame, the value without DW_OP_piece is one piece of size.
+// Only the operations emitted by the go compiler are supported
+func evalLocation(expr []byte, frame *Stackframe, size int) ([]piece, error) {
+	buf := bytes.NewBuffer(expr)
+	pieces := make([]piece, 0)
+	var (
+		cur *piece
+		operand int64
+	)
+	for buf.Len() > 0 {
+		opcode, _ := buf.ReadByte()
+		switch {
+		case opcode == DW_OP_fbreg:
+			num, _, _ := DecodeSLEB128(buf)
+			cur = &piece{addr: uint64(int64(frame.cfa) + num)}
+		case opcode == DW_OP_call_frame_cfa:
+			cur = &piece{addr: frame.cfa}
+		case opcode == DW_OP_consts:
+			// the arguments on the stack of ABI0 are at `call_frame_cfa consts plus`
+			operand, _, _ = DecodeSLEB128(buf)
+		case opcode == DW_OP_plus:
+			if cur == nil || cur.inReg {
+				return nil, fmt.Errorf("not support adding to the location")
+			}
+			cur.addr = uint64(int64(cur.addr) + operand)
+		case opcode == DW_OP_addr:
+			cur = &piece{addr: binary.LittleEndian.Uint64(buf.Next(8))}
+		case opcode >= DW_OP_reg0 && opcode <= DW_OP_reg31:
+			cur = &piece{inReg: true, reg: int(opcode - DW_OP_reg0)}
+		case opcode == DW_OP_regx:
+			reg, _, _ := DecodeULEB128(buf)
+			cur = &piece{inReg: true, reg: int(reg)}
+		case opcode == DW_OP_piece:
+			n, _, _ := DecodeULEB128(buf)
+			if cur == nil {
+				return nil, fmt.Errorf("the piece %d bytes of the location is optimized out", n)
+			}
+			cur.size = int(n)
+			pieces = append(pieces, *cur)
+			cur = nil
+		default:
+			return nil, fmt.Errorf("not support the location operation %#x", opcode)
+		}
+	}
+	if cur != nil {
+		cur.size = size
+		pieces = append(pieces, *cur)
+	}
+	return pieces, nil
+}
+
+// variablePieces evaluates where the variable is in frame
+func variablePieces(fv *dwarf.Entry, frame *Stackframe, size int) ([]piece, error) {
+	pc := frame.pc
+	if frame.index > 0 {
+		pc--
+	}
+	expr, err := locationExpr(fv, frame.fn, pc)
+	if err != nil {
+		return nil, err
+	}
+	return evalLocation(expr, frame, size)
+}
+
+// readPieces reads the bytes of the pieces, the registers are known in the innermost frame of the thread only.
+// The dwarf registers 17-32 are xmm0-xmm15, whose low bytes are the floats
+func readPieces(pieces []piece, frame *Stackframe) ([]byte, error) {
+	var fpregs []byte
+	mem := make([]byte, 0)
+	for _, p := range pieces {
+		if !p.inReg {
+			part := make([]byte, p.size)
+			if _, err := ptracePeekData(cmd.Process.Pid, uintptr(p.addr), part); err != nil {
+				return nil, err
+			}
+			mem = append(mem, part...)
+			continue
+		}
+		if frame.index != 0 || curGoroutine != nil {
+			return nil, fmt.Errorf("the registers of frame %d are unknown", frame.index)
+		}
+		word := make([]byte, 16)
+		switch {
+		case p.reg < len(dwarfRegisters):
+			r, err := findRegister(dwarfRegisters[p.reg])
+			if err != nil {
+				return nil, err
+			}
+			binary.LittleEndian.PutUint64(word, *r.field(&frame.regs))
+		case p.reg >= 17 && p.reg <= 32:
+			if fpregs == nil {
+				var err error
+				if fpregs, err = ptraceGetFpRegs(currentThread()); err != nil {
+					return nil, err
+				}
+			}
+			copy(word, fpregs[160 + (p.reg - 17) * 16:])
+		default:
+			return nil, fmt.Errorf("not support the dwarf register %d", p.reg)
+		}
+		if p.size > len(word) {
+			return nil, fmt.Errorf("the piece of %d bytes is larger than the register", p.size)
+		}
+		mem = append(mem, word[:p.size]...)
+	}
+	return mem, nil
+}
@@ -0,0 +1,35 @@
+package log
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+// the fields of the events have the same keys in all the components, so the records of a session can be
+// correlated by them
+
+// Event names what happens, like `stop` or `breakpoint.set`, the records with it are logged at info
+func Event(name string) zap.Field {
+	return zap.String("event", name)
+}
+
+// Pid is the process or the thread of the event
+func Pid(pid int) zap.Field {
+	return zap.Int("pid", pid)
+}
+
+// PC is the address of the event in hex
+func PC(pc uint64) zap.Field {
+	return zap.String("pc", fmt.Sprintf("%#x", pc))
+}
+
+// BreakpointID is the user breakpoint of the event
+func BreakpointID(id int) zap.Field {
+	return zap.Int("bp", id)
+}
+
+// Duration is how long the event takes
+func Duration(d time.Duration) zap.Field {
+	return zap.Duration("duration", d)
+}
@@ -1,61 +1,341 @@
 package log
 
 import (
+	"encoding/json"
+	"fmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// TraceLevel is below debug, it is for the lines of each dwarf entry or instruction
+const TraceLevel = zapcore.DebugLevel - 1
+
+// Components are the parts of godbg logging by their own loggers, they are switched on and off one by one
+var Components = []string{"dwarf", "proc", "rpc"}
+
+// Log is the logger of proc
 var Log *zap.Logger
 
+var (
+	level   = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
+	out     = &output{w: os.Stderr, dest: "stderr"}
+	mu      sync.RWMutex
+	enabled = map[string]bool{}
+	loggers = map[string]*zap.Logger{}
+	// format is json or logfmt
+	format = "json"
+)
+
 func init() {
 	encoderCfg := zap.NewProductionEncoderConfig()
 	encoderCfg.TimeKey = ""
 	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
 	encoderCfg.LevelKey = "lv"
+	encoderCfg.NameKey = "component"
 	encoderCfg.CallerKey = "caller"
 	encoderCfg.EncodeCaller = zapcore.ShortCallerEncoder
+	encoderCfg.EncodeLevel = func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(levelName(l))
+	}
+
+	base := zapcore.NewCore(zapcore.NewJSONEncoder(encoderCfg), out, zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return level.Enabled(l)
+	}))
+	for _, c := range Components {
+		loggers[c] = zap.New(&componentCore{name: c, json: base, logfmt: &logfmtCore{}}).Named(c)
+	}
+	Log = loggers["proc"]
 
-	logLv := strings.ToLower(os.Getenv("DBGLOGLV"))
-	var level zapcore.Level
+	// DBGLOGLV logs all the components at the level like before --log
+	if lv := os.Getenv("DBGLOGLV"); lv != "" {
+		if err := SetLevel(lv); err == nil {
+			for _, c := range Components {
+				enabled[c] = true
+			}
+		}
+	}
+}
 
-	switch logLv {
+// For returns the logger of the component
+func For(component string) *zap.Logger {
+	if l, ok := loggers[component]; ok {
+		return l
+	}
+	return Log
+}
+
+// Trace logs msg at TraceLevel
+func Trace(l *zap.Logger, msg string, fields ...zap.Field) {
+	if ce := l.Check(TraceLevel, msg); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// Tracing tells whether l logs at TraceLevel, the loops over the entries check it once instead of building the
+// fields of every record
+func Tracing(l *zap.Logger) bool {
+	return l.Core().Enabled(TraceLevel)
+}
+
+// SetLevel changes the level of all the components, error, info, debug or trace
+func SetLevel(name string) error {
+	switch strings.ToLower(name) {
+	case "trace":
+		level.SetLevel(TraceLevel)
 	case "debug":
-		level = zapcore.DebugLevel
+		level.SetLevel(zapcore.DebugLevel)
 	case "info":
-		level = zapcore.InfoLevel
+		level.SetLevel(zapcore.InfoLevel)
 	case "warn":
-		level = zapcore.WarnLevel
+		level.SetLevel(zapcore.WarnLevel)
+	case "error":
+		level.SetLevel(zapcore.ErrorLevel)
 	case "panic":
-		level = zapcore.PanicLevel
+		level.SetLevel(zapcore.PanicLevel)
 	default:
-		level = zapcore.PanicLevel
+		return fmt.Errorf("unknown log level `%s`, expect error, info, debug or trace", name)
 	}
+	return nil
+}
+
+// Level returns the name of the level
+func Level() string {
+	return levelName(level.Level())
+}
 
+func levelName(l zapcore.Level) string {
+	if l == TraceLevel {
+		return "trace"
+	}
+	return l.String()
+}
 
-	/*http.HandleFunc("/debug", func(w http.ResponseWriter, r *http.Request) {
-		lv := r.PostFormValue("level")
-		if lv == "" {
-			fmt.Fprintf(w, "%s\n", level.String())
-			return
+// SetFormat writes the records as lines of `json` or of `key=value` pairs by `logfmt`
+func SetFormat(name string) error {
+	if name != "json" && name != "logfmt" {
+		return fmt.Errorf("unknown log format `%s`, expect json or logfmt", name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	format = name
+	return nil
+}
+
+// Format returns the format of the records
+func Format() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return format
+}
+
+// Enable switches the logging of the components on or off, they are separated by `,` and `all` is all of them
+func Enable(components string, on bool) error {
+	names := strings.Split(components, ",")
+	if components == "all" {
+		names = Components
+	}
+	for _, name := range names {
+		if _, ok := loggers[name]; !ok {
+			return fmt.Errorf("unknown log component `%s`, expect %s or all", name, strings.Join(Components, ", "))
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range names {
+		enabled[name] = on
+	}
+	return nil
+}
+
+// Enabled returns the components logging, sorted
+func Enabled() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0)
+	for name, on := range enabled {
+		if on {
+			names = append(names, name)
 		}
-		if err := level.Set(lv); err != nil {
-			fmt.Fprintf(w, "err:%s, keep level=%s\n", err, level.String())
-			return
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetOutput writes the logs to `stderr`, `stdout` or `file:/path`, the file is appended and rotated by the size
+func SetOutput(dest string) error {
+	var w io.Writer
+	switch {
+	case dest == "stderr":
+		w = os.Stderr
+	case dest == "stdout":
+		w = os.Stdout
+	case strings.HasPrefix(dest, "file:"):
+		f, err := openRotatingFile(strings.TrimPrefix(dest, "file:"))
+		if err != nil {
+			return err
+		}
+		w = f
+	default:
+		return fmt.Errorf("unknown log output `%s`, expect stderr, stdout or file:/path", dest)
+	}
+	out.set(w, dest)
+	return nil
+}
+
+// Output returns where the logs are written like SetOutput takes
+func Output() string {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	return out.dest
+}
+
+// componentCore logs the entries of its component only when it is enabled, by the core of the format
+type componentCore struct {
+	name   string
+	json   zapcore.Core
+	logfmt zapcore.Core
+}
+
+func (c *componentCore) Enabled(l zapcore.Level) bool {
+	mu.RLock()
+	on := enabled[c.name]
+	mu.RUnlock()
+	return on && level.Enabled(l)
+}
+
+func (c *componentCore) With(fields []zapcore.Field) zapcore.Core {
+	return &componentCore{name: c.name, json: c.json.With(fields), logfmt: c.logfmt.With(fields)}
+}
+
+func (c *componentCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *componentCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if Format() == "logfmt" {
+		return c.logfmt.Write(ent, fields)
+	}
+	return c.json.Write(ent, fields)
+}
+
+func (c *componentCore) Sync() error {
+	return out.Sync()
+}
+
+// logfmtCore writes a record as a line like `lv=info component=proc msg=stop event=stop pid=42`, the event is
+// the first one of the fields and the others are sorted by the keys
+type logfmtCore struct {
+	fields []zapcore.Field
+}
+
+func (c *logfmtCore) Enabled(l zapcore.Level) bool {
+	return level.Enabled(l)
+}
+
+func (c *logfmtCore) With(fields []zapcore.Field) zapcore.Core {
+	return &logfmtCore{fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *logfmtCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *logfmtCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range append(c.fields[:len(c.fields):len(c.fields)], fields...) {
+		f.AddTo(enc)
+	}
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		if k != "event" {
+			keys = append(keys, k)
 		}
-		fmt.Fprintf(w, "%s\n", level.String())
-	})
-	go func() {
-		if err := http.ListenAndServe(":9090", nil); err != nil {
-			panic(err)
+	}
+	sort.Strings(keys)
+	if _, ok := enc.Fields["event"]; ok {
+		keys = append([]string{"event"}, keys...)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("lv=" + levelName(ent.Level))
+	if ent.LoggerName != "" {
+		sb.WriteString(" component=" + logfmtValue(ent.LoggerName))
+	}
+	sb.WriteString(" msg=" + logfmtValue(ent.Message))
+	for _, k := range keys {
+		sb.WriteString(" " + k + "=" + logfmtValue(enc.Fields[k]))
+	}
+	sb.WriteString("\n")
+	_, err := out.Write([]byte(sb.String()))
+	return err
+}
+
+func (c *logfmtCore) Sync() error {
+	return out.Sync()
+}
+
+// logfmtValue formats v like json except the strings, it is quoted if it has the spaces, `=` or `"`.
+// The durations are in seconds like the json records
+func logfmtValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case time.Duration:
+		s = strconv.FormatFloat(v.Seconds(), 'f', -1, 64)
+	default:
+		if data, err := json.Marshal(v); err == nil {
+			s = string(data)
+		} else {
+			s = fmt.Sprint(v)
 		}
-	}()*/
-
-	core := zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderCfg),
-		zapcore.Lock(os.Stdout),
-		level,
-	)
-	Log = zap.New(core)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// output is the writer of the logs, it is changed by SetOutput while the components are logging
+type output struct {
+	mu   sync.Mutex
+	w    io.Writer
+	dest string
+}
+
+func (o *output) set(w io.Writer, dest string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if f, ok := o.w.(*rotatingFile); ok {
+		f.Close()
+	}
+	o.w, o.dest = w, dest
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.w.Write(p)
+}
+
+func (o *output) Sync() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if f, ok := o.w.(*rotatingFile); ok {
+		return f.Sync()
+	}
+	return nil
 }
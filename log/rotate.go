@@ -0,0 +1,123 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// the rotation of the log files, a file is renamed to `path.1` when it grows beyond maxSize, `path.1` to `path.2`
+// and so on, the ones beyond maxBackups are removed. maxSize 0 never rotates
+var (
+	maxSize    int64 = 10 << 20
+	maxBackups       = 3
+)
+
+// SetRotation changes the rotation of the files opened by SetOutput later, size is in bytes
+func SetRotation(size int64, backups int) error {
+	if size < 0 || backups < 0 {
+		return fmt.Errorf("invalid log rotation, size %d and backups %d", size, backups)
+	}
+	maxSize, maxBackups = size, backups
+	return nil
+}
+
+// Rotation returns the size and the backups of the rotation
+func Rotation() (int64, int) {
+	return maxSize, maxBackups
+}
+
+// ParseSize parses the sizes like `1048576`, `512K`, `10M` or `1G`
+func ParseSize(size string) (int64, error) {
+	s, unit := size, int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size `%s`, expect the bytes or like 512K, 10M or 1G", size)
+	}
+	return n * unit, nil
+}
+
+// rotatingFile is the log file which is rotated by the size
+type rotatingFile struct {
+	path    string
+	f       *os.File
+	size    int64
+	maxSize int64
+	backups int
+}
+
+func openRotatingFile(path string) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if r.backups == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+	os.Remove(r.path + "." + strconv.Itoa(r.backups))
+	for i := r.backups - 1; i > 0; i-- {
+		if err := os.Rename(r.path+"."+strconv.Itoa(i), r.path+"."+strconv.Itoa(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Write rotates the file before p if the file is not empty and p makes it too large, a record is never split
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Sync() error {
+	return r.f.Sync()
+}
+
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
@@ -7,16 +7,39 @@ import (
 	"github.com/chainhelen/godbg/log"
 	"go.uber.org/zap"
 	"io"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 )
 
 var (
 	bp = &BP{}
+	// logger is the one of proc, the dwarf and the rpc components have their own, `--log` switches them on
 	logger = log.Log
+	dwarfLogger = log.For("dwarf")
+	rpcLogger = log.For("rpc")
 	bi *BI
 	cmd *exec.Cmd
 	execfile string
+	// sourcefile is built into execfile, restarting builds it again
+	sourcefile string
+	// testpackage is the package whose test binary is execfile, restarting builds it again
+	testpackage string
+	execargs []string
+	// threads of the debuggee traced by godbg, all of them are stopped and resumed together.
+	// It is empty until the debuggee creates another thread, then the process is the first one
+	threads []int
+	// curThread is the thread whose registers are read and written, 0 is the process itself
+	curThread int
+	// curGoroutine is the goroutine selected which is not running on any thread, its registers are
+	// saved in g.sched. It is nil if the goroutine of the current thread is inspected
+	curGoroutine *Goroutine
+	// curFrame is the frame selected by up, down and frame, the variables are looked up in it
+	curFrame int
+	// the process is not started by godbg, quit detaches from it instead of killing it
+	attached bool
 
 	stdin  io.Reader
 	stdout io.Writer
@@ -33,52 +56,255 @@ func main() {
 	stdout = os.Stdout
 	stderr = os.Stderr
 
+	headless, listen := parseHeadless()
+	tui = parseFlag("--tui")
+	noColor := parseFlag("--no-color")
+	jsonOutput = parseFlag("--json")
+	indexCache = !parseFlag("--no-index-cache")
+	commandFiles := parseCommandFiles()
+	if err = parseLogFlags(); err != nil {
+		printErr(err)
+		return
+	}
+	if filename, ok := parseValueFlag("--profile", true); ok {
+		if err = startProfile(filename); err != nil {
+			printErr(err)
+			return
+		}
+		defer stopProfile()
+	}
+	// `godbg debug` builds the package of the current directory
+	if len(os.Args) == 2 && (os.Args[1] == "debug" || os.Args[1] == "replay") {
+		os.Args = append(os.Args, ".")
+	}
 	if err = checkArgs(); err != nil {
 		logger.Error(err.Error(), zap.String("stage","checkArgs"), zap.Strings("args", os.Args))
 		printHelper()
 		return
 	}
 
-	// step 1, get absolute filename
-	if filename, err = absoluteFilename(); err != nil {
-		logger.Error(err.Error(), zap.String("stage","absolute"), zap.String("filename", filename))
-		printHelper()
+	// the config file sets the defaults, the init files and the commands can change them later
+	if err = LoadConfigFile(); err != nil {
+		fmt.Fprintf(stderr, "warning: %v\n", err)
+	}
+	if noColor {
+		colorMode = "off"
+	}
+
+	if os.Args[1] == "dap" {
+		addr := ""
+		if len(os.Args) == 3 {
+			addr = os.Args[2]
+		}
+		if err = runDap(addr); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "dap"), zap.String("addr", addr))
+		}
+		removeBuilt()
 		return
 	}
 
-	// step 2, build the filename into executable file
-	if execfile, err = build(filename); err != nil {
-		logger.Error(err.Error(), zap.String("stage", "build"),zap.String("filename", filename))
-		printHelper()
+	if os.Args[1] == "trace" {
+		if err = traceMain(os.Args[2:]); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "trace"), zap.Strings("args", os.Args))
+			printErr(err)
+		}
 		return
 	}
-	defer os.Remove(execfile)
+
+	// the addr of the gdb server is taken out, the rest of args are like debug
+	gdbAddr := ""
+	if os.Args[1] == "gdbserver" {
+		gdbAddr = os.Args[2]
+		os.Args = append(os.Args[:2:2], os.Args[3:]...)
+	}
+
+	// the gdb server runs the executable file already, it is analyzed only
+	if os.Args[1] == "remote" {
+		execfile = os.Args[3]
+	} else if os.Args[1] == "core" {
+		execfile = os.Args[2]
+	} else if os.Args[1] == "test" {
+		pkg, _, _ := parseTestArgs()
+		if execfile, err = buildTest(pkg); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "build"), zap.String("package", pkg))
+			printErr(err)
+			return
+		}
+		defer removeBuilt()
+		testpackage = pkg
+	} else if os.Args[1] == "exec" {
+		if execfile, err = filepath.Abs(os.Args[2]); err != nil {
+			logger.Error(err.Error(), zap.String("stage","absolute"), zap.String("execfile", os.Args[2]))
+			printHelper()
+			return
+		}
+	} else if os.Args[1] == "attach" {
+		// the process is attached before analyzing, its binary is found by the pid
+		pid, _ := strconv.Atoi(os.Args[2])
+		if cmd, execfile, err = attach(pid); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "attach"), zap.Int("pid", pid))
+			printErr(err)
+			return
+		}
+		if len(os.Args) == 5 {
+			execfile = os.Args[4]
+		}
+		if err = checkBuildId(pid, execfile); err != nil {
+			fmt.Fprintf(stderr, "warning: %v\n", err)
+		}
+	} else {
+		// step 1, get absolute filename
+		if filename, err = absoluteFilename(); err != nil {
+			logger.Error(err.Error(), zap.String("stage","absolute"), zap.String("filename", filename))
+			printHelper()
+			return
+		}
+
+		// step 2, build the filename into executable file
+		if execfile, err = build(filename); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "build"),zap.String("filename", filename))
+			printHelper()
+			return
+		}
+		defer removeBuilt()
+		sourcefile = filename
+	}
 
 	// step 3, analyze executable file; The most import places are "_debug_info", "_debug_line"
-	if bi, err = analyze(execfile);err != nil {
+	if bi, err = analyzeInterruptibly(execfile);err != nil {
 		logger.Error(err.Error(), zap.String("stage", "analyze"),
 			zap.String("filename", filename), zap.String("execfile", execfile))
-		printHelper()
+		if err == AnalyzeCanceledErr {
+			printErr(err)
+		} else {
+			printHelper()
+		}
+		releaseDebuggee()
 		return
 	}
 
-	// step 4, run executable file
-	if cmd, err = runexec(execfile); err != nil {
+	// step 4, run executable file, the rest of args are passed to it
+	execargs = os.Args[3:]
+	if os.Args[1] == "exec" && len(execargs) > 0 {
+		execargs = execargs[1:]
+	}
+	if os.Args[1] == "test" {
+		_, execargs, _ = parseTestArgs()
+	}
+	if os.Args[1] == "attach" {
+		execargs = nil
+		fmt.Fprintf(stdout, "attach process pid %d %s\n", cmd.Process.Pid, execfile)
+	} else if os.Args[1] == "core" {
+		execargs = nil
+		if cmd, err = openCore(execfile, os.Args[3]); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "core"),
+				zap.String("execfile", execfile), zap.String("corefile", os.Args[3]))
+			printErr(err)
+			return
+		}
+		fmt.Fprintf(stdout, "core file of process %d killed by signal %s\n", cmd.Process.Pid, core.signal)
+		if err = listFileLineByPtracePc(sourceListSize); err != nil {
+			printErr(err)
+		}
+	} else if os.Args[1] == "remote" {
+		execargs = nil
+		if cmd, err = connectRemote(os.Args[2], execfile); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "remote"),
+				zap.String("addr", os.Args[2]), zap.String("execfile", execfile))
+			printHelper()
+			return
+		}
+		fmt.Fprintf(stdout, "connect to the gdb server at %s\n", os.Args[2])
+	} else if os.Args[1] == "replay" {
+		// the program runs to the end under `rr record`, then the recording is replayed
+		if cmd, err = rrReplay(execfile, execargs); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "replay"),
+				zap.String("filename", filename), zap.String("execfile", execfile))
+			printHelper()
+			return
+		}
+		fmt.Fprintf(stdout, "replay the recording by rr pid %d\n", cmd.Process.Pid)
+	} else if cmd, err = runexec(execfile, execargs); err != nil {
 		logger.Error(err.Error(), zap.String("stage", "runexec"),
 			zap.String("filename", filename), zap.String("execfile", execfile))
 		printHelper()
 		return
+	} else {
+		fmt.Fprintf(stdout, "trace cur process pid %d\n",cmd.Process.Pid)
+	}
+	// the debuggee stops when it panics, the core file never runs
+	if core == nil {
+		if err = bp.SetPanicBreakPoints(); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "SetPanicBreakPoints"), zap.String("execfile", execfile))
+		}
+	}
+
+	for _, f := range commandFiles {
+		if err = SourceCommands(f); err != nil {
+			printErr(err)
+		}
+	}
+
+	if gdbAddr != "" {
+		l, err := net.Listen("tcp", gdbAddr)
+		if err != nil {
+			logger.Error(err.Error(), zap.String("stage", "listen"), zap.String("addr", gdbAddr))
+			releaseDebuggee()
+			return
+		}
+		fmt.Fprintf(stdout, "gdb server listening at %s\n", l.Addr())
+		if err = serveGdb(l); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "gdbserver"), zap.String("addr", gdbAddr))
+		}
+		return
+	}
+
+	if headless {
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			logger.Error(err.Error(), zap.String("stage", "listen"), zap.String("addr", listen))
+			releaseDebuggee()
+			return
+		}
+		fmt.Fprintf(stdout, "api server listening at %s\n", l.Addr())
+		if err = serveHeadless(l); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "headless"), zap.String("addr", listen))
+		}
+		return
 	}
-	fmt.Fprintf(stdout, "trace cur process pid %d\n",cmd.Process.Pid)
 
-	// step 5, run prompt. `executor` handle all input
+	// step 5, run prompt. `executor` handle all input, the panes are drawn above it in the tui mode
+	run := executor
+	if tui {
+		run = tuiExecutor
+		drawTui("")
+	}
+	// the commands are read line by line without the prompt if stdin is not a terminal, like the pipe of an editor
+	if _, _, ok := windowSize(os.Stdin); !ok {
+		if err = runCommandLines(os.Stdin, run); err != nil {
+			printErr(err)
+		}
+		executor("q")
+		return
+	}
+	// the commands of the earlier sessions are recalled by the up arrow, the lines are edited by the emacs keys
+	history := historyFile()
 	p = prompt.New(
-		executor,
+		func(input string) {
+			if err := appendHistory(history, input); err != nil {
+				logger.Error(err.Error(), zap.String("stage", "history"), zap.String("file", history))
+			}
+			run(input)
+		},
 		complete,
 		prompt.OptionTitle("Simplified golang debugger"),
 		prompt.OptionPrefix("(godbg) "),
 		prompt.OptionInputTextColor(prompt.Yellow),
 		prompt.OptionCompletionWordSeparator(completer.FilePathCompletionSeparator),
+		prompt.OptionHistory(loadHistory(history)),
+		prompt.OptionSwitchKeyBindMode(prompt.EmacsKeyBind),
 	)
 	p.Run()
+	// Ctrl-D leaves the prompt, the session ends like quit
+	executor("q")
 }
@@ -1,12 +1,40 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"github.com/c-bata/go-prompt"
+	"github.com/chainhelen/godbg/api"
+	"github.com/chainhelen/godbg/client"
 	"github.com/chainhelen/godbg/log"
+	"go.starlark.net/starlark"
+	"go.uber.org/zap"
+	"golang.org/x/arch/x86/x86asm"
 	. "github.com/onsi/gomega"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func clear_variable() {
@@ -14,13 +42,50 @@ func clear_variable() {
 	logger = log.Log
 	bi = nil
 	cmd = nil
+	execfile = ""
+	execargs = nil
+	threads = nil
+	curThread = 0
+	curGoroutine = nil
+	curFrame = 0
+	earlyStops = map[int]syscall.WaitStatus{}
+	attached = false
+	replay = nil
+	core = nil
+	checkpoints = nil
+	sourcefile = ""
+	testpackage = ""
+	tui = false
+	lastTuiView = tuiView{}
+	aliases = map[string]string{}
+	signalTable = map[syscall.Signal]*SignalHandling{}
+	followForkChild = false
+	detachOnFork = true
+	inferiors = nil
+	targets = nil
+	currentTarget = nil
+	lastTargetId = 0
+	loadConfig = defaultLoadConfig()
+	formatters = defaultFormatters()
+	numberFormat = 'd'
+	sourceListSize = 6
+	dwarfBudget = 0
+	colorMode = "auto"
+	substitutePaths = nil
+	jsonOutput = false
+	transcript = nil
+	resetMetrics()
+	disassembleFlavor = "intel"
+	displays = nil
+	lastDisplayId = 0
+	scriptCommands = map[string]starlark.Callable{}
 
 	stdin = os.Stdin
 	stdout = os.Stdout
 	stderr = os.Stderr
 }
 
-func build_run_debug(filename string) (string, error) {
+func build_run_debug(filename string, args ...string) (string, error) {
 	var (
 		dir      string
 		execfile string
@@ -43,8 +108,13 @@ func build_run_debug(filename string) (string, error) {
 		return execfile, err
 	}
 
-	// step 4, run executable file
-	if cmd, err = runexec(execfile); err != nil {
+	// step 4, run executable file, the threads of the process left by a failed test are forgotten
+	execargs = args
+	threads, curThread = nil, 0
+	if cmd, err = runexec(execfile, execargs); err != nil {
+		return execfile, err
+	}
+	if err = bp.SetPanicBreakPoints(); err != nil {
 		return execfile, err
 	}
 
@@ -82,6 +152,156 @@ func TestBuild(t *testing.T) {
 	clear_variable()
 }
 
+func TestMachO(t *testing.T) {
+	var (
+		err error
+		g   = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	dir, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	execfile := path.Join(os.TempDir(), "__t1_darwin__")
+	build := exec.Command("go", "build", "-gcflags", "all=-N -l", "-o", execfile, path.Join(dir, "test_file/t1.go"))
+	build.Env = append(os.Environ(), "GOOS=darwin", "GOARCH=amd64", "CGO_ENABLED=0")
+	g.Expect(build.Run()).Should(BeNil())
+	defer os.Remove(execfile)
+
+	// the go linker compresses the DWARF of Mach-O in the __zdebug sections
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(bi.file.macho).ShouldNot(BeNil())
+	p, err := bi.findFunctionByName("main.p")
+	g.Expect(err).Should(BeNil())
+	filename, lineno, err := bi.pcTofileLine(p.lowpc)
+	g.Expect(err).Should(BeNil())
+	g.Expect(filename).Should(Equal(dir + "/test_file/t1.go"))
+	g.Expect(lineno).Should(Equal(5))
+	pc, err := bi.fileLineToPc(dir+"/test_file/t1.go", 7)
+	g.Expect(err).Should(BeNil())
+	g.Expect(pc).Should(BeNumerically(">", p.lowpc))
+	g.Expect(bi.FramesInformation).ShouldNot(BeEmpty())
+	// the symbols of Mach-O are read like the ones of ELF
+	g.Expect(bi.TypesAddr).ShouldNot(BeZero())
+
+	// the build ID is at the beginning of __text, the symbols and the data are read by the segments
+	id, err := exec.Command("go", "tool", "buildid", execfile).Output()
+	g.Expect(err).Should(BeNil())
+	g.Expect(bi.buildID).Should(Equal(strings.TrimSpace(string(id))))
+	g.Expect(bi.buildVersion).Should(Equal(runtime.Version()))
+
+	executor("info sections")
+	g.Expect(outw.String()).Should(MatchRegexp(`\n1 +__TEXT,__text +0x[0-9a-f]+ +0x[0-9a-f]+ +0x[0-9a-f]+ +AX\n`))
+	g.Expect(outw.String()).Should(MatchRegexp(`\n\d+ +__DWARF,__zdebug_info +0x[0-9a-f]+ +0x[0-9a-f]+ +0x[0-9a-f]+ +C\n`))
+	outw.Reset()
+	executor("info segments")
+	g.Expect(outw.String()).Should(MatchRegexp(`\n__TEXT +0x0 +0x[0-9a-f]+ +0x[0-9a-f]+ +0x[0-9a-f]+ +R E\n`))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	clear_variable()
+}
+
+func TestDebugserver(t *testing.T) {
+	var (
+		err error
+		g   = NewGomegaWithT(t)
+	)
+	outw, _ := make_out_err()
+	// the fake debugserver sends rdi before rsi and xmm0 after gs, unlike the `g` packet of gdb
+	layout := []string{"rax", "rbx", "rcx", "rdx", "rdi", "rsi", "rbp", "rsp", "r8", "r9", "r10", "r11", "r12",
+		"r13", "r14", "r15", "rip", "rflags", "cs", "fs", "gs"}
+	regs := make([]byte, len(layout)*8+16)
+	for i := range layout {
+		binary.LittleEndian.PutUint64(regs[i*8:], uint64(i+1))
+	}
+	copy(regs[len(layout)*8:], bytes.Repeat([]byte{0xaa}, 16))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).Should(BeNil())
+	defer l.Close()
+	written := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s := &gdbConn{conn: conn, rd: bufio.NewReader(conn)}
+		for {
+			packet, err := s.recv()
+			if err != nil || packet == "k" {
+				return
+			}
+			reply := ""
+			switch {
+			case packet == "?":
+				reply = "T11thread:1f03;"
+			case strings.HasPrefix(packet, "Hg"):
+				reply = "OK"
+			case packet == "qProcessInfo":
+				reply = "pid:4d2;parent-pid:1;"
+			case strings.HasPrefix(packet, "qRegisterInfo"):
+				n, _ := strconv.ParseInt(packet[len("qRegisterInfo"):], 16, 64)
+				switch {
+				case int(n) < len(layout):
+					reply = fmt.Sprintf("name:%s;bitsize:64;offset:%d;encoding:uint;format:hex;", layout[n], n*8)
+				case int(n) == len(layout):
+					reply = fmt.Sprintf("name:xmm0;bitsize:128;offset:%d;encoding:vector;", n*8)
+				default:
+					reply = "E45"
+				}
+			case packet == "g":
+				reply = hex.EncodeToString(regs)
+			case strings.HasPrefix(packet, "G"):
+				written <- packet[1:]
+				reply = "OK"
+			case packet == "c":
+				// the output of the debuggee comes before the stop reply
+				if s.send("O"+hex.EncodeToString([]byte("hello\n"))) != nil {
+					return
+				}
+				reply = "W00"
+			}
+			if s.send(reply) != nil {
+				return
+			}
+		}
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	g.Expect(err).Should(BeNil())
+	// the source is not Mach-O, so its address is not checked
+	cmd, err = connectDebugserver(conn, "./test_file/t1.go", nil)
+	g.Expect(err).Should(BeNil())
+	g.Expect(cmd.Process.Pid).Should(Equal(0x4d2))
+
+	// the registers are read by the offsets of qRegisterInfo
+	var r PtraceRegs
+	g.Expect(replay.readRegisters(&r)).Should(BeNil())
+	g.Expect(r.Rdi).Should(Equal(uint64(5)))
+	g.Expect(r.Rsi).Should(Equal(uint64(6)))
+	g.Expect(r.Rip).Should(Equal(uint64(17)))
+	g.Expect(*flagsRegister(&r)).Should(Equal(uint64(18)))
+
+	// the registers written keep the others of the `g` packet
+	r.Rip = 0x1234
+	g.Expect(replay.writeRegisters(&r)).Should(BeNil())
+	data, err := hex.DecodeString(<-written)
+	g.Expect(err).Should(BeNil())
+	g.Expect(binary.LittleEndian.Uint64(data[16*8:])).Should(Equal(uint64(0x1234)))
+	g.Expect(binary.LittleEndian.Uint64(data[4*8:])).Should(Equal(uint64(5)))
+	g.Expect(data[len(layout)*8:]).Should(Equal(bytes.Repeat([]byte{0xaa}, 16)))
+
+	// the exit is converted to the wait status of ptrace
+	g.Expect(replay.resume("c")).Should(BeNil())
+	var s syscall.WaitStatus
+	_, err = replay.wait(&s)
+	g.Expect(err).Should(BeNil())
+	g.Expect(s.Exited()).Should(Equal(true))
+	g.Expect(outw.String()).Should(Equal("hello\n"))
+
+	replay.close()
+	replay = nil
+	clear_variable()
+}
+
 func TestQuit(t *testing.T) {
 	var (
 		execfile string
@@ -324,7 +544,7 @@ func TestBreakClearContinue(t *testing.T) {
 	outw.Reset()
 
 	executor("bc 1")
-	g.Expect(outw.String()).Should(ContainSubstring("clear breakpoint 1 successfully, resort breakpoint again"))
+	g.Expect(outw.String()).Should(ContainSubstring("clear breakpoint 1 successfully"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
@@ -341,7 +561,7 @@ func TestBreakClearContinue(t *testing.T) {
 	clear_variable()
 }
 
-func TestNextAssignExpression(t *testing.T) {
+func TestBreakDisableEnableContinue(t *testing.T) {
 	var (
 		execfile string
 		err      error
@@ -349,45 +569,54 @@ func TestNextAssignExpression(t *testing.T) {
 	)
 	outw, errw := make_out_err()
 
-	execfile, err = build_run_debug("./test_file/t3.go")
+	execfile, err = build_run_debug("./test_file/t2.go")
 	g.Expect(err).Should(BeNil())
 	defer os.Remove(execfile)
 	pid := cmd.Process.Pid
 
-	executor("b ./test_file/t3.go:6")
-
-	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t3.go:6 breakpoint successfully"))
+	executor("b ./test_file/t2.go:7")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t2.go:7 breakpoint successfully"))
 	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
 
 	executor("c")
-	g.Expect(outw.String()).Should(ContainSubstring("==>      6: 	m := 0"))
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("n")
-	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 	n := 1"))
+	executor("bd 1")
+	g.Expect(outw.String()).Should(ContainSubstring("disable breakpoint 1 ./test_file/t2.go:7"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("n")
-	g.Expect(outw.String()).Should(ContainSubstring("==>      8: 	i := 10"))
+	executor("bl")
+	g.Expect(outw.String()).Should(MatchRegexp(`1 \. \./test_file/t2.go:7, pc \d+, disabled`))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("n")
-	g.Expect(outw.String()).Should(ContainSubstring("==>      9: 	j := 11"))
+	executor("be 1")
+	g.Expect(outw.String()).Should(ContainSubstring("enable breakpoint 1 ./test_file/t2.go:7"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
 	executor("c")
-	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bd 2")
+	g.Expect(errw.String()).Should(ContainSubstring("can't find breakpoint 2"))
+	errw.Reset()
+
+	executor("bd 1")
+	executor("c")
 	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
 
 	executor("q")
 	clear_variable()
 }
 
-func TestNextCallExpress(t *testing.T) {
+func TestHardwareBreakPointContinue(t *testing.T) {
 	var (
 		execfile string
 		err      error
@@ -395,40 +624,81 @@ func TestNextCallExpress(t *testing.T) {
 	)
 	outw, errw := make_out_err()
 
-	execfile, err = build_run_debug("./test_file/t3.go")
+	execfile, err = build_run_debug("./test_file/t2.go")
 	g.Expect(err).Should(BeNil())
 	defer os.Remove(execfile)
 	pid := cmd.Process.Pid
 
-	executor("b ./test_file/t3.go:10")
-
-	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t3.go:10 breakpoint successfully"))
+	executor("b -hw ./test_file/t2.go:7")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t2.go:7 hardware breakpoint successfully"))
 	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bl")
+	g.Expect(outw.String()).Should(MatchRegexp(`1 \. \./test_file/t2.go:7, pc \d+, hardware`))
+	outw.Reset()
+
+	for i := 0; i < 3; i++ {
+		executor("c")
+		g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
+		g.Expect(errw.String()).Should(Equal(""))
+		outw.Reset()
+	}
 
 	executor("c")
-	g.Expect(outw.String()).Should(ContainSubstring(`==>     10: 	fmt.Printf("%d %d %d %d\n", m, n, i, j)`))
+	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestWatchPointContinue(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t9.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t9.go:7")
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 	for i := 0; i < 3; i++ {"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("n")
-	g.Expect(outw.String()).Should(ContainSubstring(`==>     11: 	k := 20`))
+	executor("watch godbgvcount")
+	g.Expect(outw.String()).Should(MatchRegexp(`godbg add watchpoint 2 godbgvcount, addr 0x[0-9a-f]+, 8 bytes`))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("n")
-	g.Expect(outw.String()).Should(ContainSubstring(`==>     12: 	fmt.Printf("%d\n", k)`))
+	executor("bc 1")
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("watchpoint 2 godbgvcount old value: 0, new value: 1"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
 	executor("c")
-	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring("watchpoint 2 godbgvcount old value: 1, new value: 3"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bc 2")
+	executor("c")
 	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
 
 	executor("q")
 	clear_variable()
 }
 
-func TestCallStack(t *testing.T) {
+func TestConditionBreakPointContinue(t *testing.T) {
 	var (
 		execfile string
 		err      error
@@ -436,60 +706,105 @@ func TestCallStack(t *testing.T) {
 	)
 	outw, errw := make_out_err()
 
-	execfile, err = build_run_debug("./test_file/t4.go")
+	execfile, err = build_run_debug("./test_file/t2.go")
 	g.Expect(err).Should(BeNil())
 	defer os.Remove(execfile)
 	pid := cmd.Process.Pid
 
-	executor("b ./test_file/t4.go:6")
-
-	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t4.go:6 breakpoint successfully"))
+	executor("b ./test_file/t2.go:7")
+	executor("cond 1 i == 1")
+	g.Expect(outw.String()).Should(ContainSubstring("breakpoint 1 ./test_file/t2.go:7 stops when i == 1"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
+	executor("bl")
+	g.Expect(outw.String()).Should(ContainSubstring(", cond i == 1"))
+	outw.Reset()
+
 	executor("c")
-	g.Expect(outw.String()).Should(ContainSubstring(`==>      6: 	return fmt.Sprintf("m = %d", m)`))
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("bt")
-	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:6`))
-	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:11 main.pppp1`))
-	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:16 main.main`))
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestHitCountBreakPointContinue(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t2.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t2.go:7")
+	executor("cond -hitcount 1 % 2")
+	g.Expect(outw.String()).Should(ContainSubstring("breakpoint 1 ./test_file/t2.go:7 stops when hitcount % 2"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("n")
-	g.Expect(outw.String()).Should(ContainSubstring(`==>     11: 	mstr := pppp2(m)`))
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("bt")
-	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:11`))
-	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:16 main.main`))
-	g.Expect(errw.String()).Should(Equal(""))
+	executor("bl")
+	g.Expect(outw.String()).Should(ContainSubstring(", hitcount % 2, hits 2"))
 	outw.Reset()
 
-	executor("n")
-	g.Expect(outw.String()).Should(ContainSubstring(`==>     12: 	fmt.Println(mstr)`))
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestIgnoreBreakPointContinue(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t2.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t2.go:7")
+	executor("ignore 1 2")
+	g.Expect(outw.String()).Should(ContainSubstring("will ignore next 2 hits of breakpoint 1 ./test_file/t2.go:7"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("bt")
-	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:12`))
-	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:16 main.main`))
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
+	executor("bl")
+	g.Expect(outw.String()).Should(ContainSubstring(", hits 3"))
+	g.Expect(outw.String()).ShouldNot(ContainSubstring("ignore"))
+	outw.Reset()
+
 	executor("c")
-	g.Expect(outw.String()).Should(Equal(""))
 	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
 
 	executor("q")
 	clear_variable()
 }
 
-func TestPrintString(t *testing.T) {
+func TestTemporaryBreakPointContinue(t *testing.T) {
 	var (
 		execfile string
 		err      error
@@ -497,36 +812,33 @@ func TestPrintString(t *testing.T) {
 	)
 	outw, errw := make_out_err()
 
-	execfile, err = build_run_debug("./test_file/t5.go")
+	execfile, err = build_run_debug("./test_file/t2.go")
 	g.Expect(err).Should(BeNil())
 	defer os.Remove(execfile)
 	pid := cmd.Process.Pid
 
-	executor("b ./test_file/t5.go:11")
-
-	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t5.go:11 breakpoint successfully"))
+	executor("tbreak ./test_file/t2.go:7")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t2.go:7 temporary breakpoint 1 successfully"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
 	executor("c")
-	g.Expect(outw.String()).Should(ContainSubstring(`==>     11: 	godbgvint := uint64(100)`))
+	g.Expect(outw.String()).Should(ContainSubstring("temporary breakpoint 1 ./test_file/t2.go:7 is cleared"))
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("p godbgvstr")
-	g.Expect(outw.String()).Should(ContainSubstring(`hello world`))
-	outw.Reset()
+	executor("bl")
+	g.Expect(outw.String()).Should(ContainSubstring("there is no breakpoint"))
 
 	executor("c")
-	g.Expect(outw.String()).Should(Equal(""))
 	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
 
 	executor("q")
 	clear_variable()
 }
 
-// avoid endless loop
-func TestPrintString2(t *testing.T) {
+func TestUntil(t *testing.T) {
 	var (
 		execfile string
 		err      error
@@ -534,30 +846,5565 @@ func TestPrintString2(t *testing.T) {
 	)
 	outw, errw := make_out_err()
 
-	execfile, err = build_run_debug("./test_file/t6.go")
+	execfile, err = build_run_debug("./test_file/t2.go")
 	g.Expect(err).Should(BeNil())
 	defer os.Remove(execfile)
 	pid := cmd.Process.Pid
 
-	executor("b ./test_file/t6.go:7")
-
-	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t6.go:7 breakpoint successfully"))
+	executor("until ./test_file/t2.go:7")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
+	executor("bl")
+	g.Expect(outw.String()).Should(ContainSubstring("there is no breakpoint"))
+
 	executor("c")
-	g.Expect(outw.String()).Should(ContainSubstring(`==>      7: 	fmt.Printf("%s\n", godbgvstr)`))
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestFunctionBreakPointContinue(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t2.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b main.p")
+	g.Expect(outw.String()).Should(ContainSubstring("/test_file/t2.go:5 breakpoint successfully"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
-	executor("p godbgvstr")
-	g.Expect(outw.String()).Should(ContainSubstring(`hello world`))
+	// the breakpoint is after the stack check and the frame setup
+	f, err := bi.findFunctionByName("main.p")
+	g.Expect(err).Should(BeNil())
+	g.Expect(bp.List()[0].pc).Should(BeNumerically(">", f.lowpc))
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      5: func p() {"))
+	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
 	executor("c")
-	g.Expect(outw.String()).Should(Equal(""))
 	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
 
 	executor("q")
 	clear_variable()
 }
+
+func TestNextAssignExpression(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t3.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t3.go:6")
+
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t3.go:6 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      6: 	m := 0"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 	n := 1"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      8: 	i := 10"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      9: 	j := 11"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestNextCallExpress(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t3.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t3.go:10")
+
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t3.go:10 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>     10: 	fmt.Printf("%d %d %d %d\n", m, n, i, j)`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>     11: 	k := 20`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>     12: 	fmt.Printf("%d\n", k)`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestStepInto(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t4.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t4.go:11")
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>     11: 	mstr := pppp2(m)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("s")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      5: func pppp2(m int) string {"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("s")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      6: 	return fmt.Sprintf(\"m = %d\", m)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestNextRecursion(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t10.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t10.go:9")
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      9: 	r := n * fact(n-1)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the recursive calls pass line 10 before the current frame does
+	executor("bc 1")
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring("==>     10: 	return r"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring("==>     14: 	fmt.Println(fact(3))"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestStepOut(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t4.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t4.go:6")
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      6: 	return fmt.Sprintf(\"m = %d\", m)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("stepout")
+	g.Expect(outw.String()).Should(ContainSubstring(`main.pppp2 returns ~r0 = "m = 300"`))
+	g.Expect(outw.String()).Should(ContainSubstring("==>     11: 	mstr := pppp2(m)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestStepInstruction(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t2.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t2.go:7")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the breakpoint is stepped over and kept
+	executor("si")
+	g.Expect(outw.String()).Should(ContainSubstring("main.p at test_file/t2.go:7"))
+	g.Expect(outw.String()).Should(MatchRegexp(`===> \d+ +[0-9a-f]+ +\w+`))
+	g.Expect(outw.String()).ShouldNot(ContainSubstring("int3"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bc 1")
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestReverseWithoutReplay(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t2.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t2.go:7")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// only the recording of rr can run backwards
+	for _, input := range []string{"rewind", "rs", "reverse-next"} {
+		executor(input)
+		g.Expect(errw.String()).Should(ContainSubstring(NotReplayingErr.Error()))
+		g.Expect(outw.String()).Should(Equal(""))
+		errw.Reset()
+	}
+
+	executor("q")
+	clear_variable()
+}
+
+func TestCheckpointRestart(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t2.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t2.go:7")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("checkpoint")
+	g.Expect(outw.String()).Should(MatchRegexp(`checkpoint 1 test_file/t2.go:7 pid \d+`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// i is 0 again, the loop stops twice more at the breakpoint
+	executor("restart 1")
+	g.Expect(outw.String()).Should(MatchRegexp(`restart checkpoint 1 test_file/t2.go:7 new process pid \d+`))
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	pid := cmd.Process.Pid
+	for i := 0; i < 2; i++ {
+		outw.Reset()
+		executor("c")
+		g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
+		g.Expect(errw.String()).Should(Equal(""))
+	}
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+	errw.Reset()
+	outw.Reset()
+
+	// the checkpoint is kept after the process exits
+	executor("checkpoints")
+	g.Expect(outw.String()).Should(MatchRegexp(`checkpoint 1 test_file/t2.go:7 pid \d+`))
+	executor("restart 1")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestRestartRebuild(t *testing.T) {
+	var (
+		err error
+		g   = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	source := "./test_file/restart_rebuild.go"
+	code := "package main\n\nimport \"fmt\"\n\nfunc p() {\n\tfor i := 0; i < 3; i++ {\n\t\tfmt.Println(i)\n\t}\n}\n\nfunc main() {\n\tp()\n}\n"
+	g.Expect(ioutil.WriteFile(source, []byte(code), 0644)).Should(BeNil())
+	defer os.Remove(source)
+
+	execfile, err = build_run_debug(source)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	dir, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	sourcefile = path.Join(dir, source)
+
+	executor("b " + source + ":7")
+	executor("b main.main")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	mainLine := regexp.MustCompile(`==> +\d+: .*`).FindString(outw.String())
+	g.Expect(mainLine).ShouldNot(Equal(""))
+	oldPc := bp.List()[0].pc
+	outw.Reset()
+
+	// the code before line 7 grows, the breakpoints move with their lines
+	code = strings.Replace(code, "i < 3", "i < len(fmt.Sprint(300))", 1)
+	g.Expect(ioutil.WriteFile(source, []byte(code), 0644)).Should(BeNil())
+	executor("restart")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring("reload the changed executable file"))
+	g.Expect(outw.String()).Should(MatchRegexp(`restart new process pid \d+`))
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(bp.List()[0].pc).ShouldNot(Equal(oldPc))
+	pid := cmd.Process.Pid
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(mainLine))
+	g.Expect(errw.String()).Should(Equal(""))
+	for i := 0; i < 3; i++ {
+		outw.Reset()
+		executor("c")
+		g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
+		g.Expect(errw.String()).Should(Equal(""))
+	}
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	// the old binary is removed by restart, the rebuilt one by quit
+	executor("q")
+	built, err := filepath.Glob(path.Join(os.TempDir(), "__restart_rebuild.go__*"))
+	g.Expect(err).Should(BeNil())
+	g.Expect(built).Should(BeEmpty())
+	clear_variable()
+}
+
+func TestCallFunction(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t11.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t11.go:11")
+	executor("b ./test_file/t11.go:6")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the breakpoint in add doesn't stop the call
+	executor("call add(x, 5)")
+	g.Expect(outw.String()).Should(Equal("main.add returns ~r0 = 15\n"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("call main.add(x * 2, -3)")
+	g.Expect(outw.String()).Should(Equal("main.add returns ~r0 = 17\n"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("call add(1)")
+	g.Expect(errw.String()).Should(ContainSubstring("main.add needs 2 arguments, but 1 are given"))
+	errw.Reset()
+
+	// the debuggee goes on from where it stops
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      6: 	return a + b"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestSignalStop(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t12.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t12.go:21")
+	outw.Reset()
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("received signal user defined signal 1"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the signal is delivered, so the program receives it from the channel
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>     21: 	fmt.Println(s)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestHandleSignal(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t12.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("handle SIGUSR1 nostop")
+	g.Expect(outw.String()).Should(Equal("SIGUSR1    nostop print pass\n"))
+	outw.Reset()
+	executor("handle kill nostop")
+	g.Expect(errw.String()).Should(Equal("SIGKILL can't be handled\n"))
+	errw.Reset()
+	executor("handle 999 stop")
+	g.Expect(errw.String()).Should(Equal("unknown signal 999, the signals are numbered from 1 to 64\n"))
+	errw.Reset()
+	executor("handle 0 stop")
+	g.Expect(errw.String()).Should(Equal("unknown signal 0, the signals are numbered from 1 to 64\n"))
+	errw.Reset()
+	executor("handle 34 nostop")
+	g.Expect(outw.String()).Should(Equal("34         nostop print pass\n"))
+	outw.Reset()
+	executor("handle")
+	g.Expect(outw.String()).Should(ContainSubstring("SIGURG     nostop noprint pass\n"))
+	g.Expect(outw.String()).Should(ContainSubstring("SIGUSR1    nostop print pass\n"))
+	outw.Reset()
+
+	executor("b ./test_file/t12.go:21")
+	outw.Reset()
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("received signal user defined signal 1"))
+	g.Expect(outw.String()).Should(ContainSubstring("==>     21: 	fmt.Println(s)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestFollowForkParent(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t13.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t13.go:22")
+	outw.Reset()
+	executor("c")
+	g.Expect(outw.String()).Should(MatchRegexp(`process %d vforks child (\d+), detach process \d+`, pid))
+	g.Expect(outw.String()).Should(ContainSubstring("==>     22: 	fmt.Println(\"parent\", s.ExitStatus())"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestFollowForkChild(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t13.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("set follow-fork-mode child")
+	g.Expect(outw.String()).Should(Equal("follow-fork-mode is child\n"))
+	executor("b ./test_file/t13.go:16")
+	outw.Reset()
+
+	// the child executes the program again with the breakpoint
+	executor("c")
+	g.Expect(outw.String()).Should(MatchRegexp(`process %d vforks child \d+, detach process %d`, pid, pid))
+	g.Expect(outw.String()).Should(MatchRegexp(`process \d+ executes .*__t13.go__`))
+	g.Expect(errw.String()).Should(Equal(""))
+	child := cmd.Process.Pid
+	g.Expect(child).ShouldNot(Equal(pid))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>     16: 		fmt.Println(\"child\")"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", child))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestCallStack(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t4.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t4.go:6")
+
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t4.go:6 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>      6: 	return fmt.Sprintf("m = %d", m)`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bt")
+	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:6`))
+	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:11 main.pppp1`))
+	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:16 main.main`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>     11: 	mstr := pppp2(m)`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bt")
+	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:11`))
+	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:16 main.main`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>     12: 	fmt.Println(mstr)`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bt")
+	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:12`))
+	g.Expect(outw.String()).Should(ContainSubstring(`test_file/t4.go:16 main.main`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestPrintString(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t5.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t5.go:11")
+
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t5.go:11 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>     11: 	godbgvint := uint64(100)`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("p godbgvstr")
+	g.Expect(outw.String()).Should(ContainSubstring(`hello world`))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+// avoid endless loop
+func TestPrintString2(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t6.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t6.go:7")
+
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t6.go:7 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>      7: 	fmt.Printf("%s\n", godbgvstr)`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("p godbgvstr")
+	g.Expect(outw.String()).Should(ContainSubstring(`hello world`))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestLaunchWithArgs(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t7.go", "hello args")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t7.go:10")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t7.go:10 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>     10: 	fmt.Println(godbgvarg)`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("p godbgvarg")
+	g.Expect(outw.String()).Should(ContainSubstring(`hello args`))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestAttach(t *testing.T) {
+	var (
+		dir      string
+		execfile string
+		exefile  string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	_, errw := make_out_err()
+
+	dir, err = os.Getwd()
+	g.Expect(err).Should(BeNil())
+	execfile, err = build(path.Join(dir, "./test_file/t8.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	target := exec.Command(execfile)
+	g.Expect(target.Start()).Should(BeNil())
+	// the traced threads are reaped when the test exits, so only kill it
+	defer target.Process.Kill()
+	// let the goroutines start their threads
+	time.Sleep(200 * time.Millisecond)
+
+	cmd, exefile, err = attach(target.Process.Pid)
+	g.Expect(err).Should(BeNil())
+	g.Expect(exefile).Should(Equal(execfile))
+	g.Expect(len(threads)).Should(BeNumerically(">", 1))
+	g.Expect(threads).Should(ContainElement(target.Process.Pid))
+
+	bi, err = analyze(exefile)
+	g.Expect(err).Should(BeNil())
+	_, err = getPtracePc()
+	g.Expect(err).Should(BeNil())
+	g.Expect(errw.String()).Should(Equal(""))
+
+	clear_variable()
+}
+
+func TestAttachBuildId(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	execfile, err := build(path.Join(dir, "./test_file/t8.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	other, err := build(path.Join(dir, "./test_file/t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(other)
+
+	target := exec.Command(execfile)
+	g.Expect(target.Start()).Should(BeNil())
+	defer target.Process.Kill()
+	time.Sleep(200 * time.Millisecond)
+
+	g.Expect(checkBuildId(target.Process.Pid, execfile)).Should(BeNil())
+	g.Expect(checkBuildId(target.Process.Pid, other)).Should(MatchError(fmt.Sprintf(
+		"the build id of %s doesn't match the process %d, it may have been rebuilt since the process started", other, target.Process.Pid)))
+
+	// the binary removed is still mapped by the process
+	g.Expect(os.Remove(execfile)).Should(BeNil())
+	exefile, err := processExecutable(target.Process.Pid)
+	g.Expect(err).Should(BeNil())
+	g.Expect(exefile).Should(Equal(fmt.Sprintf("/proc/%d/exe", target.Process.Pid)))
+	g.Expect(checkBuildId(target.Process.Pid, exefile)).Should(BeNil())
+}
+
+func TestDetach(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t8.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	executor("b ./test_file/t8.go:9")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t8.go:9 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>      9: 	fmt.Println(i)`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("detach")
+	g.Expect(outw.String()).Should(ContainSubstring(fmt.Sprintf("detach process %d", pid)))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// an int3 left behind would kill it with SIGTRAP at the next tick
+	time.Sleep(300 * time.Millisecond)
+	g.Expect(syscall.Kill(pid, 0)).Should(BeNil())
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	g.Expect(err).Should(BeNil())
+	g.Expect(strings.Fields(string(status))[2]).Should(MatchRegexp("^[RS]$"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestTargets(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t1.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t1.go:7")
+	outw.Reset()
+
+	executor("target add ./test_file/t11.go")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`add target 2 pid (\d+) .*/test_file/t11.go`))
+	g.Expect(cmd.Process.Pid).ShouldNot(Equal(pid))
+	defer os.Remove(execfile)
+	outw.Reset()
+
+	// the breakpoints of the targets are numbered apart
+	executor("bl")
+	g.Expect(outw.String()).Should(Equal("there is no breakpoint\n"))
+	outw.Reset()
+	executor("b ./test_file/t11.go:6")
+	outw.Reset()
+	executor("bl")
+	g.Expect(outw.String()).Should(MatchRegexp(`^1 \. .*/test_file/t11.go:6, pc \d+\n$`))
+	outw.Reset()
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      6: 	return a + b"))
+	outw.Reset()
+
+	executor("target list")
+	g.Expect(outw.String()).Should(MatchRegexp(`^  target 1 pid %d .*t1.go__\d+\n\* target 2 pid \d+ .*/test_file/t11.go\n$`, pid))
+	outw.Reset()
+
+	executor("target switch 1")
+	g.Expect(outw.String()).Should(MatchRegexp(`switch to target 1 pid %d`, pid))
+	g.Expect(cmd.Process.Pid).Should(Equal(pid))
+	outw.Reset()
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 	i += 44"))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("target switch 3")
+	g.Expect(errw.String()).Should(ContainSubstring("can't find target 3"))
+
+	executor("q")
+	g.Expect(targets).Should(HaveLen(1))
+	clear_variable()
+}
+
+func TestThreads(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t14.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t14.go:23")
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(`==>     23: 	fmt.Println("workers")`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the workers lock their threads, so there are 4 threads at least
+	executor("threads")
+	lines := strings.Split(strings.TrimSpace(outw.String()), "\n")
+	g.Expect(len(lines)).Should(BeNumerically(">=", 4))
+	g.Expect(outw.String()).Should(MatchRegexp(`\* thread \d+ pc \d+ test_file/t14.go:23\n`))
+	g.Expect(outw.String()).Should(MatchRegexp(`[ *] thread %d pc \d+`, pid))
+	outw.Reset()
+
+	other := 0
+	for _, tid := range targetThreads() {
+		if tid != currentThread() {
+			other = tid
+		}
+	}
+	executor(fmt.Sprintf("thread %d", other))
+	g.Expect(outw.String()).Should(ContainSubstring(fmt.Sprintf("switch to thread %d", other)))
+	g.Expect(currentThread()).Should(Equal(other))
+	outw.Reset()
+
+	executor("thread 1")
+	g.Expect(errw.String()).Should(Equal("thread 1 is not traced\n"))
+	errw.Reset()
+
+	// the thread at the breakpoint steps over it though another thread is current
+	executor("c")
+	g.Expect(outw.String()).Should(Equal(""))
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestGoroutines(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t14.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t14.go:23")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("goroutines")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`\* goroutine 1 running pc \d+ test_file/t14.go:23 main.main`))
+	g.Expect(outw.String()).Should(MatchRegexp(`goroutine \d+ waiting \(chan receive\) pc \d+ .* runtime.gopark, go test_file/t14.go:20`))
+	g.Expect(strings.Count(outw.String(), ", go test_file/t14.go:20")).Should(Equal(3))
+
+	gs, err := Goroutines()
+	g.Expect(err).Should(BeNil())
+	g.Expect(len(gs)).Should(BeNumerically(">=", 4))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestSwitchGoroutine(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t15.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t15.go:18")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("goroutines")
+	m := regexp.MustCompile(`goroutine (\d+) waiting \(chan receive\)`).FindStringSubmatch(outw.String())
+	g.Expect(m).ShouldNot(BeNil())
+	outw.Reset()
+
+	executor("goroutine " + m[1])
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HavePrefix("switch to goroutine " + m[1] + "\n* goroutine " + m[1] + " waiting"))
+	outw.Reset()
+
+	// the stack of the goroutine is from its sched
+	executor("bt")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring("test_file/t15.go:9 main.worker"))
+	outw.Reset()
+
+	// the goroutine goes on after main sends 21
+	executor("next")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("goroutines")
+	g.Expect(outw.String()).Should(MatchRegexp(`\* goroutine ` + m[1] + ` running`))
+	outw.Reset()
+
+	executor("goroutine 1")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring("switch to goroutine 1\n* goroutine 1"))
+	outw.Reset()
+
+	executor("goroutine 10000")
+	g.Expect(errw.String()).Should(Equal("can't find goroutine 10000\n"))
+	errw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestQueryGoroutines(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t16.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t16.go:34")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("goroutines -with userloc t16.go:18")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(strings.Count(outw.String(), "\n")).Should(Equal(4))
+	g.Expect(strings.Count(outw.String(), "waiting (chan receive)")).Should(Equal(4))
+	outw.Reset()
+
+	executor("goroutines -with status waiting -with reason sleep")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^  goroutine \d+ waiting \(sleep\) .*, go test_file/t16.go:25\n$`))
+	outw.Reset()
+
+	executor("goroutines -with label worker=labeled")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^  goroutine \d+ waiting \(chan receive\) .*, go test_file/t16.go:30\n$`))
+	outw.Reset()
+
+	executor("goroutines -with status running")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^\* goroutine 1 running pc \d+ test_file/t16.go:34 main.main`))
+	outw.Reset()
+
+	executor("goroutines -with userloc t16.go -sort id -limit 2")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^\* goroutine 1 running .*\n  goroutine \d+ waiting \(sleep\) .*\nshowing 2 of 6 goroutines\n$`))
+	outw.Reset()
+
+	gs, total, err := QueryGoroutines([]string{"-with", "reason", "chan", "receive", "-limit", "1"})
+	g.Expect(err).Should(BeNil())
+	g.Expect(len(gs)).Should(Equal(1))
+	g.Expect(total).Should(Equal(4))
+
+	executor("goroutines -with color red")
+	g.Expect(errw.String()).Should(Equal("unknown filter `color`, expect userloc, status, reason or label\n"))
+	errw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestStacktrace(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t17.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t17.go:14")
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("received signal segmentation fault"))
+	outw.Reset()
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(`goroutine 1 panics: (runtime.errorString) "invalid memory address or nil pointer dereference"`))
+	outw.Reset()
+	// the panic of the nil dereference is recovered
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bt")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^#0  pc \d+ \S+test_file/t17.go:14 main.main.func1 bp \d+\n`))
+	// the frame below sigpanic is at the faulting instruction
+	g.Expect(outw.String()).Should(MatchRegexp(`runtime.sigpanic bp \d+\n#\d+ +pc \d+ \S+test_file/t17.go:8 main.deref bp \d+\n#\d+ +pc \d+ \S+test_file/t17.go:16 main.main bp`))
+	g.Expect(outw.String()).Should(MatchRegexp(`runtime.goexit bp \d+\n$`))
+
+	frames, err := Stacktrace()
+	g.Expect(err).Should(BeNil())
+	g.Expect(frames[0].fn.name).Should(Equal("main.main.func1"))
+	g.Expect(frames[0].cfa).Should(BeNumerically(">", frames[0].bp))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestSelectFrame(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t18.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t18.go:6")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("locals")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal(""))
+
+	executor("up")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^#1  pc \d+ \S+test_file/t18.go:12 main.middle bp \d+\n`))
+	g.Expect(outw.String()).Should(ContainSubstring(`==>     12: 	return leaf(fmt.Sprint(name, count))`))
+	outw.Reset()
+
+	executor("locals")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("name string = \"middle\"\ncount int = 42\n"))
+	outw.Reset()
+
+	executor("p name")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("middle\n"))
+	outw.Reset()
+
+	executor("args")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HavePrefix("n int = "))
+	outw.Reset()
+
+	executor("up 2")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^#3  pc \d+ \S+ runtime.main bp \d+\n`))
+	outw.Reset()
+
+	executor("down 4")
+	g.Expect(errw.String()).Should(Equal("can't find frame -1, the innermost one is 0\n"))
+	errw.Reset()
+
+	executor("frame 9")
+	g.Expect(errw.String()).Should(Equal("can't find frame 9, the outermost one is 4\n"))
+	errw.Reset()
+
+	executor("frame 2")
+	g.Expect(outw.String()).Should(MatchRegexp(`^#2  pc \d+ \S+test_file/t18.go:16 main.main bp \d+\n`))
+	outw.Reset()
+	executor("down")
+	g.Expect(outw.String()).Should(HavePrefix("#1 "))
+	outw.Reset()
+
+	// the frame is the innermost one after resuming
+	executor("n")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("frame")
+	g.Expect(outw.String()).Should(MatchRegexp(`^#0  pc \d+ \S+test_file/t18.go:12 main.middle`))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestDefers(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t19.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t19.go:16")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("defer")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^defer 0: main.work.func1\(\) at \S+test_file/t19.go:13\n` +
+		`defer 1: main.cleanup\(name = "second", n = 2\) at \S+test_file/t19.go:12\n` +
+		`defer 2: main.cleanup\(name = "first", n = 7\) at \S+test_file/t19.go:11\n$`))
+	outw.Reset()
+
+	executor("bt -defer")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`main.work bp \d+\n    defer 0: main.work.func1\(\)`))
+	g.Expect(outw.String()).Should(MatchRegexp(`main.main bp \d+\n    defer 0: fmt.Println\(.*\) at \S+test_file/t19.go:20\n`))
+	outw.Reset()
+
+	executor("up")
+	outw.Reset()
+	defers, err := FrameDefers()
+	g.Expect(err).Should(BeNil())
+	g.Expect(len(defers)).Should(Equal(1))
+	g.Expect(defers[0].fn.name).Should(Equal("fmt.Println"))
+
+	executor("up")
+	outw.Reset()
+	executor("defer")
+	g.Expect(outw.String()).Should(Equal("there is no deferred call\n"))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestStopOnPanic(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t20.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring(`goroutine 1 panics: (*main.E) &{code: 2, msg: "too big"}`))
+	outw.Reset()
+
+	executor("bt")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^#0  pc \d+ \S+runtime/panic.go:\d+ runtime.gopanic bp \d+\n` +
+		`#1  pc \d+ \S+test_file/t20.go:10 main.check bp \d+\n#2  pc \d+ \S+test_file/t20.go:16 main.main bp`))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring(`panic is not recovered: (*main.E) &{code: 2, msg: "too big"}`))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp(`Process \d+ has exited with status 2\n`))
+	outw.Reset()
+	errw.Reset()
+	clear_variable()
+
+	outw, errw = make_out_err()
+	execfile, err = build_run_debug("./test_file/t21.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	// the runtime throws the deadlock
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring("fatal error\n"))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestRegisters(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t18.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t18.go:11")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	pc, err := getPtracePc()
+	g.Expect(err).Should(BeNil())
+
+	executor("regs")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^rax     0x[0-9a-f]+ +\d+\n`))
+	g.Expect(outw.String()).Should(ContainSubstring(fmt.Sprintf("rip     %#-18x %d\n", pc, pc)))
+	g.Expect(outw.String()).Should(MatchRegexp(`\nrflags  0x[0-9a-f]+ +\[[A-Z ]*IF[A-Z ]*\]\n`))
+	g.Expect(outw.String()).ShouldNot(ContainSubstring("xmm0"))
+	outw.Reset()
+
+	executor("regs -sse")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`\nmxcsr   0x[0-9a-f]+\nxmm0    0x[0-9a-f]{32}\n`))
+	g.Expect(outw.String()).Should(MatchRegexp(`\nxmm15   0x[0-9a-f]{32}\n$`))
+	outw.Reset()
+
+	executor("set $r12 = 0x2a")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("r12 = 0x2a\n"))
+	outw.Reset()
+	executor("regs")
+	g.Expect(outw.String()).Should(ContainSubstring("\nr12     0x2a               42\n"))
+	outw.Reset()
+
+	executor("set $nope = 1")
+	g.Expect(errw.String()).Should(ContainSubstring("can't find register `nope`"))
+	errw.Reset()
+
+	// line 11 runs again after moving rip back
+	executor("n")
+	outw.Reset()
+	executor(fmt.Sprintf("set $rip = %#x", pc))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	newPc, err := getPtracePc()
+	g.Expect(err).Should(BeNil())
+	g.Expect(newPc).Should(Equal(pc))
+	executor("n")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring("==>     12: "))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestExamine(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t22.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t22.go:11")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("x -fmt hex -size 8 -len 8 &n")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^0x[0-9a-f]+: 0x1122334455667788\n$`))
+	outw.Reset()
+
+	executor("x -len 4 &n")
+	g.Expect(outw.String()).Should(MatchRegexp(`^0x[0-9a-f]+: 0x88 0x77 0x66 0x55\n$`))
+	outw.Reset()
+
+	executor("x -fmt dec -size 8 -len 8 &n")
+	g.Expect(outw.String()).Should(MatchRegexp(`^0x[0-9a-f]+: 1234605616436508552\n$`))
+	outw.Reset()
+
+	executor("x -fmt bin -len 2 &n")
+	g.Expect(outw.String()).Should(MatchRegexp(`^0x[0-9a-f]+: 10001000 01110111\n$`))
+	outw.Reset()
+
+	executor("x -fmt ascii -len 8 &buf")
+	g.Expect(outw.String()).Should(MatchRegexp(`^0x[0-9a-f]+: godbg\.\.\.\n$`))
+	outw.Reset()
+
+	// a pointer is examined where it points to
+	executor("x -size 4 -len 8 p")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^0x[0-9a-f]+: 0x00000102 0xffffffff\n$`))
+	outw.Reset()
+
+	// the lines are 16 bytes, each begins with its address
+	_, addr, err := findVariable("buf")
+	g.Expect(err).Should(BeNil())
+	executor(fmt.Sprintf("examine -size 8 -len 24 %d", addr))
+	g.Expect(outw.String()).Should(MatchRegexp(fmt.Sprintf(`^%#x: 0x[0-9a-f]{16} 0x[0-9a-f]{16}\n%#x: 0x[0-9a-f]{16}\n$`, addr, addr+16)))
+	outw.Reset()
+
+	executor("x -fmt oct &n")
+	g.Expect(errw.String()).Should(ContainSubstring("unknown format `oct`, expect hex, dec, bin or ascii"))
+	errw.Reset()
+	executor("x -size 3 -len 6 &n")
+	g.Expect(errw.String()).Should(ContainSubstring("the size of words should be 1, 2, 4 or 8, not 3"))
+	errw.Reset()
+	executor("x -len 16 0")
+	g.Expect(errw.String()).ShouldNot(Equal(""))
+	errw.Reset()
+	// the huge lengths are rejected before the buffer is allocated
+	executor("x -len 2147483647 &n")
+	g.Expect(errw.String()).Should(Equal("the length 2147483647 is beyond 1048576 bytes\n"))
+	errw.Reset()
+	_, err = ReadMemory(addr, 1<<40)
+	g.Expect(err).Should(MatchError("the length 1099511627776 should be from 0 to 1048576 bytes"))
+	_, err = ReadMemory(^uint64(0), 16)
+	g.Expect(err).ShouldNot(BeNil())
+
+	executor("q")
+	clear_variable()
+}
+
+func TestSetMemory(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t22.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t22.go:11")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	_, addr, err := findVariable("n")
+	g.Expect(err).Should(BeNil())
+	executor("set-mem &n 0x01 2 0xff")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal(fmt.Sprintf("write 3 bytes at %#x\n", addr)))
+	outw.Reset()
+	executor("x -len 4 &n")
+	g.Expect(outw.String()).Should(MatchRegexp(`^0x[0-9a-f]+: 0x01 0x02 0xff 0x55\n$`))
+	outw.Reset()
+
+	executor("set-mem &n 256")
+	g.Expect(errw.String()).Should(ContainSubstring("the bytes should be numbers between 0 and 255, not `256`"))
+	errw.Reset()
+
+	// the int3 of the breakpoint is kept, the byte written becomes its original instruction
+	pc := bp.List()[0].pc
+	original := bp.List()[0].original[0]
+	g.Expect(WriteMemory(pc, []byte{original})).Should(BeNil())
+	mem := make([]byte, 1)
+	_, err = ptracePeekData(cmd.Process.Pid, uintptr(pc), mem)
+	g.Expect(err).Should(BeNil())
+	g.Expect(mem[0]).Should(Equal(byte(0xCC)))
+	g.Expect(bp.List()[0].original[0]).Should(Equal(original))
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp(`Process \d+ has exited with status 0\n`))
+	errw.Reset()
+	outw.Reset()
+	clear_variable()
+}
+
+func TestAssign(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t23.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t23.go:18")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	value := func(expr string) string {
+		node, err := parser.ParseExpr(expr)
+		g.Expect(err).Should(BeNil())
+		l, err := evalLvalue(node)
+		g.Expect(err).Should(BeNil())
+		s, err := l.format()
+		g.Expect(err).Should(BeNil())
+		return s
+	}
+
+	executor("set total = 1 << 20")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("total = 1048576\n"))
+	outw.Reset()
+	executor("set total = 1 << 40")
+	g.Expect(errw.String()).Should(ContainSubstring("can't assign 1099511627776 to total int32: overflow"))
+	errw.Reset()
+
+	// the fields are assigned through the struct and the pointer to it
+	executor("set c.port = 8080")
+	g.Expect(outw.String()).Should(Equal("c.port = 8080\n"))
+	outw.Reset()
+	executor("set p.ratio = 0.25")
+	g.Expect(outw.String()).Should(Equal("p.ratio = 0.25\n"))
+	outw.Reset()
+	executor("set (*p).debug = true")
+	g.Expect(outw.String()).Should(Equal("(*p).debug = true\n"))
+	outw.Reset()
+	executor("set c.limit = 256")
+	g.Expect(errw.String()).Should(ContainSubstring("overflow"))
+	errw.Reset()
+	g.Expect(value("c.ratio")).Should(Equal("0.25"))
+	g.Expect(value("c.debug")).Should(Equal("true"))
+
+	executor(`set c.name = "production"`)
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("c.name = \"production\"\n"))
+	outw.Reset()
+	g.Expect(value("p.name")).Should(Equal(`"production"`))
+
+	executor("set other = &c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal(fmt.Sprintf("other = %s\n", value("p"))))
+	outw.Reset()
+	executor("set other.port = 9")
+	g.Expect(value("c.port")).Should(Equal("9"))
+	executor("set other = nil")
+	g.Expect(outw.String()).Should(ContainSubstring("other = 0x0\n"))
+	outw.Reset()
+	executor("set other.port = 1")
+	g.Expect(errw.String()).Should(ContainSubstring("nil pointer dereference"))
+	errw.Reset()
+	executor("set c.missing = 1")
+	g.Expect(errw.String()).Should(ContainSubstring("has no field missing"))
+	errw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp(`Process \d+ has exited with status 0\n`))
+	errw.Reset()
+	outw.Reset()
+	clear_variable()
+}
+
+func TestLocals(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t24.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t24.go:12")
+	executor("b ./test_file/t24.go:15")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the x of the loop shadows the one of main
+	executor("locals")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("total int = 10\nx int = 1 (shadowed)\ni int = 1\nx int = 100\nmsg string = \"inner\"\n"))
+	outw.Reset()
+	_, addr, err := findVariable("x")
+	g.Expect(err).Should(BeNil())
+	v, err := loadValue(&dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 8}}}, addr)
+	g.Expect(err).Should(BeNil())
+	g.Expect(v.String()).Should(Equal("100"))
+
+	executor("locals ^(x|msg)$")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("x int = 1 (shadowed)\nx int = 100\nmsg string = \"inner\"\n"))
+	outw.Reset()
+	executor("locals (")
+	g.Expect(errw.String()).Should(ContainSubstring("missing closing )"))
+	errw.Reset()
+
+	// the variables of the loop are out of scope
+	executor("c")
+	outw.Reset()
+	executor("locals")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("total int = 10\nx int = 1\n"))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestArgs(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t18.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	// the arguments are in the registers at the entry
+	leaf, err := bi.findFunctionByName("main.leaf")
+	g.Expect(err).Should(BeNil())
+	_, err = bp.SetInternalBreakPoint(leaf.lowpc)
+	g.Expect(err).Should(BeNil())
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("args")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("s string = \"middle42\"\n"))
+	outw.Reset()
+
+	// the arguments of the callers are on the stack
+	executor("up")
+	outw.Reset()
+	executor("args")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("n int = 21\n"))
+	outw.Reset()
+
+	var ret uint64
+	for pc := leaf.lowpc; pc < leaf.highpc; {
+		_, inst, err := disassembleInst(pc)
+		g.Expect(err).Should(BeNil())
+		if inst.Op == x86asm.RET {
+			ret = pc
+			break
+		}
+		pc += uint64(inst.Len)
+	}
+	g.Expect(ret).ShouldNot(BeZero())
+	_, err = bp.SetInternalBreakPoint(ret)
+	g.Expect(err).Should(BeNil())
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("args")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("s string = \"middle42\"\nreturns ~r0 = \"middle42!\"\n"))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestVars(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t25.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t25.go:14")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("vars ^main\\.")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("main.name string = \"dev\"\nmain.port int = 8080\nmain.ratio float64 = 0.5\nmain.verbose bool = true\n"))
+	outw.Reset()
+
+	executor("vars ^runtime\\.buildVersion$")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal(fmt.Sprintf("runtime.buildVersion string = %q\n", runtime.Version())))
+	outw.Reset()
+
+	executor("vars (")
+	g.Expect(errw.String()).Should(ContainSubstring("missing closing )"))
+	errw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestEvalExpr(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t26.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t26.go:21")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for expr, value := range map[string]string{
+		"n.next.val":                      "2",
+		"(*n).val + grid[2]":              "10",
+		"n.tags[1]":                       "bc",
+		"n.tags[1][0]":                    "98",
+		"head.val == limit-2":             "true",
+		"main.limit * 2":                  "6",
+		"n.next.next == nil":              "true",
+		"&grid != 0 && -n.next.val == -2": "true",
+	} {
+		executor("p " + expr)
+		g.Expect(errw.String()).Should(Equal(""), expr)
+		g.Expect(outw.String()).Should(Equal(value+"\n"), expr)
+		outw.Reset()
+	}
+
+	for expr, msg := range map[string]string{
+		"grid[3]":         "index out of range [3] with length 3",
+		"n.next.next.val": "nil pointer dereference",
+		"n.tags[-1]":      "index out of range [-1] with length 2",
+		"limit[0]":        "can't index int",
+		"main.nothing":    "can't find variable main",
+	} {
+		executor("p " + expr)
+		g.Expect(errw.String()).Should(ContainSubstring(msg), expr)
+		errw.Reset()
+	}
+
+	stop, err := evalCondition(`n.tags[0] == "a" && word[1] == 'o'`)
+	g.Expect(err).Should(BeNil())
+	g.Expect(stop).Should(BeTrue())
+
+	executor("q")
+	clear_variable()
+}
+
+func TestPrettyPrint(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t27.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t27.go:43")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for expr, value := range map[string]string{
+		"nums":    "[1, 2, 3]",
+		"ages":    `map["amy": 5, "tom": 3]`,
+		"ch":      "[5, 6, 7] (len 3, cap 3)",
+		"any":     "(main.rect) {w: 2, h: 3}",
+		"s":       "(main.rect) {w: 4, h: 5}",
+		"err":     `(*errors.errorString) &{s: "boom"}`,
+		"c":       "(1-2i)",
+		"nothing": "map[]",
+		"empty":   "map[]",
+		"area":    "main.rect.area",
+		"grid":    `[["a"], []]`,
+		"many":    "[" + strings.Repeat("0, ", 64) + "...+36 more]",
+	} {
+		executor("p " + expr)
+		g.Expect(errw.String()).Should(Equal(""), expr)
+		g.Expect(outw.String()).Should(Equal(value+"\n"), expr)
+		outw.Reset()
+	}
+
+	// the buckets of the map grown into several tables are iterated, the keys are sorted
+	entries := make([]string, 0)
+	for i := 0; i < 20; i++ {
+		entries = append(entries, fmt.Sprintf("%d: %v", i, i%2 == 0))
+	}
+	executor("p big")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("map[" + strings.Join(entries, ", ") + "]\n"))
+	outw.Reset()
+
+	// the cycle is shown by the address
+	executor("p r")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^&\{id: 1, next: \(\*main\.ring\)\(0x[0-9a-f]+\)\}\n$`))
+	outw.Reset()
+
+	executor("locals ^(any|ch|grid)$")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("any interface {} = (main.rect) {w: 2, h: 3}\nch chan int = [5, 6, 7] (len 3, cap 3)\n" +
+		"grid [2][]string = [[\"a\"], []]\n"))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestMapIndex(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t27.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t27.go:43")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for expr, value := range map[string]string{
+		`ages["amy"]`:     "5",
+		`ages["tom"] + 1`: "4",
+		"big[7]":          "false",
+		"big[18]":         "true",
+		`!big[3]`:         "true",
+	} {
+		executor("p " + expr)
+		g.Expect(errw.String()).Should(Equal(""), expr)
+		g.Expect(outw.String()).Should(Equal(value+"\n"), expr)
+		outw.Reset()
+	}
+
+	executor(`p ages["bob"]`)
+	g.Expect(errw.String()).Should(Equal("key \"bob\" is not in the map\n"))
+	errw.Reset()
+	executor("p big[20]")
+	g.Expect(errw.String()).Should(Equal("key 20 is not in the map\n"))
+	errw.Reset()
+	executor("p nothing[1]")
+	g.Expect(errw.String()).Should(Equal("key 1 is not in the nil map\n"))
+	errw.Reset()
+	executor(`p big["a"]`)
+	g.Expect(errw.String()).Should(Equal("mismatched types int and \"a\"\n"))
+	errw.Reset()
+
+	// the keys are compared in full whatever max-string-len is
+	executor("config max-string-len 1")
+	executor(`p ages["amy"]`)
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("max-string-len = 1\n5\n"))
+	outw.Reset()
+
+	// the walk stops at the key found, only the entries shown are formatted
+	node, err := parser.ParseExpr("big")
+	g.Expect(err).Should(BeNil())
+	l, err := evalLvalue(node)
+	g.Expect(err).Should(BeNil())
+	word, err := l.load()
+	g.Expect(err).Should(BeNil())
+	visited := 0
+	g.Expect(walkMap(l.typ.(*dwarf.TypedefType), word, func(*mapEntry) bool {
+		visited++
+		return false
+	})).Should(BeNil())
+	g.Expect(visited).Should(Equal(1))
+	formatted := 0
+	RegisterFormatter("bool", "count", func(*printer, dwarf.Type, uint64) (string, error) {
+		formatted++
+		return "b", nil
+	})
+	executor("config max-array-values 2")
+	outw.Reset()
+	executor("p big")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("map[0: b, 1: b, ...+18 more]\n"))
+	g.Expect(formatted).Should(Equal(2))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestInterfaceAssert(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t27.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t27.go:43")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for expr, value := range map[string]string{
+		"(main.rect)(any)":             "{w: 2, h: 3}",
+		"(rect)(s)":                    "{w: 4, h: 5}",
+		"(rect)(s).w * (rect)(s).h":    "20",
+		"(*errors.errorString)(err)":   `&{s: "boom"}`,
+		"(*errors.errorString)(err).s": "boom",
+	} {
+		executor("p " + expr)
+		g.Expect(errw.String()).Should(Equal(""), expr)
+		g.Expect(outw.String()).Should(Equal(value+"\n"), expr)
+		outw.Reset()
+	}
+
+	executor("p (int)(any)")
+	g.Expect(errw.String()).Should(Equal("interface conversion: interface is main.rect, not int\n"))
+	errw.Reset()
+	executor("p (main.rect)(c)")
+	g.Expect(errw.String()).Should(Equal("complex128 is not an interface\n"))
+	errw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestWhatIs(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t27.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t27.go:43")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for expr, value := range map[string]string{
+		"nums":             "[]int",
+		"ages":             "map[string]int",
+		"&nums[1]":         "*int",
+		"r":                "*main.ring",
+		"r.next.id":        "int",
+		"grid":             "[2][]string",
+		"any":              "interface {}\ndynamic type main.rect",
+		"s":                "main.shape\ndynamic type main.rect",
+		"err":              "error\ndynamic type *errors.errorString",
+		"(main.rect)(any)": "main.rect",
+	} {
+		executor("whatis " + expr)
+		g.Expect(errw.String()).Should(Equal(""), expr)
+		g.Expect(outw.String()).Should(Equal(value+"\n"), expr)
+		outw.Reset()
+	}
+
+	executor("whatis 1 + 2")
+	g.Expect(errw.String()).Should(Equal("not support the place *ast.BinaryExpr\n"))
+	errw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestLoadConfig(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t27.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t27.go:43")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("config")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("max-string-len = 256\nmax-array-values = 64\nmax-struct-depth = 10\nfollow-pointers = 10\nnumber-format = dec\nsource-list-size = 6\nmax-dwarf-memory = 0\ncolor = auto\n"))
+	outw.Reset()
+
+	executor("config max-array-values 2")
+	g.Expect(outw.String()).Should(Equal("max-array-values = 2\n"))
+	outw.Reset()
+	executor("p nums")
+	g.Expect(outw.String()).Should(Equal("[1, 2, ...+1 more]\n"))
+	outw.Reset()
+	executor("p big")
+	g.Expect(outw.String()).Should(Equal("map[0: true, 1: false, ...+18 more]\n"))
+	outw.Reset()
+
+	executor("config max-struct-depth 1")
+	outw.Reset()
+	executor("p grid")
+	g.Expect(outw.String()).Should(Equal("[[...], [...]]\n"))
+	outw.Reset()
+
+	executor("config follow-pointers 0")
+	outw.Reset()
+	executor("p r")
+	g.Expect(outw.String()).Should(MatchRegexp(`^\(\*main\.ring\)\(0x[0-9a-f]+\)\n$`))
+	outw.Reset()
+
+	// the strings are cut when they are shown, the evaluator loads them in full
+	executor("config max-string-len 2")
+	outw.Reset()
+	executor(`p ages`)
+	g.Expect(outw.String()).Should(Equal(`map["am"...+1 more: 5, "to"...+1 more: 3]` + "\n"))
+	outw.Reset()
+	executor("config max-string-len 0")
+	outw.Reset()
+	executor("p grid[0][0]")
+	g.Expect(outw.String()).Should(Equal("...+1 more\n"))
+	outw.Reset()
+	stop, err := evalCondition(`grid[0][0] == ""`)
+	g.Expect(err).Should(BeNil())
+	g.Expect(stop).Should(BeFalse())
+	stop, err = evalCondition(`grid[0][0] == "a"`)
+	g.Expect(err).Should(BeNil())
+	g.Expect(stop).Should(BeTrue())
+	executor(`p grid[0][0] + "b"`)
+	g.Expect(outw.String()).Should(Equal("...+2 more\n"))
+	outw.Reset()
+	g.Expect(errw.String()).Should(Equal(""))
+	// the garbage lengths are rejected before the bytes are read
+	_, err = loadFullString(0x1000, 1<<40)
+	g.Expect(err).Should(MatchError("the length 1099511627776 of the string at 0x1000 should be from 0 to 1048576 bytes"))
+	_, err = loadFullString(0x1000, -1)
+	g.Expect(err).Should(MatchError("the length -1 of the string at 0x1000 should be from 0 to 1048576 bytes"))
+	node, err := parser.ParseExpr("grid[0][0]")
+	g.Expect(err).Should(BeNil())
+	l, err := evalLvalue(node)
+	g.Expect(err).Should(BeNil())
+	_, err = readString(l.addr)
+	g.Expect(err).Should(MatchError(fmt.Sprintf("the length 1 of the string at %#x should be from 0 to max-string-len 0", l.addr)))
+
+	executor("config max-depth 1")
+	g.Expect(errw.String()).Should(ContainSubstring("unknown config `max-depth`"))
+	errw.Reset()
+	executor("config max-string-len -1")
+	g.Expect(errw.String()).Should(ContainSubstring("not less than 0, not `-1`"))
+	errw.Reset()
+	executor("config max-string-len 1048577")
+	g.Expect(errw.String()).Should(ContainSubstring("not more than 1048576, not `1048577`"))
+	errw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestPrintFlags(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t27.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t27.go:43")
+	executor("c")
+	executor("config max-array-values 2")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// -full overrides the config for the command only
+	executor("p -full many")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("[" + strings.TrimSuffix(strings.Repeat("0, ", 100), ", ") + "]\n"))
+	outw.Reset()
+	executor("p many")
+	g.Expect(outw.String()).Should(Equal("[0, 0, ...+98 more]\n"))
+	outw.Reset()
+
+	// complex(1, -2) is two float64 in little endian
+	executor("p -raw c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^0x[0-9a-f]+: ` + strings.Repeat("0x00 ", 6) + "0xf0 0x3f " +
+		strings.Repeat("0x00 ", 7) + "0xc0\n$"))
+	outw.Reset()
+
+	executor("p -raw -full nums[1]")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^0x[0-9a-f]+: 0x02( 0x00){7}\n$`))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestFormatter(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t31.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t31.go:25")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for expr, value := range map[string]string{
+		"at": "2024-05-06T07:08:09.0000005Z",
+		"*n": "-123456789012345678901234567890",
+		"id": "[97, 98, 99, 100]",
+		"f":  "29",
+		"e":  "{id: [97, 98, 99, 100], at: 2024-05-06T07:08:09.0000005Z}",
+	} {
+		executor("p " + expr)
+		g.Expect(errw.String()).Should(Equal(""), expr)
+		g.Expect(outw.String()).Should(Equal(value+"\n"), expr)
+		outw.Reset()
+	}
+
+	// the monotonic clock is skipped
+	executor("p now")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HavePrefix(time.Now().Format("2006-01-02T")))
+	outw.Reset()
+
+	executor("config format main.ID string")
+	executor("config format main.Flags hex")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("main.ID = string\nmain.Flags = hex\n"))
+	outw.Reset()
+	executor("config format")
+	g.Expect(outw.String()).Should(Equal("main.Flags = hex\nmain.ID = string\nmath/big.Int = decimal\ntime.Time = time\n"))
+	outw.Reset()
+	executor("p e")
+	g.Expect(outw.String()).Should(Equal("{id: \"abcd\", at: 2024-05-06T07:08:09.0000005Z}\n"))
+	outw.Reset()
+	executor("locals ^f$")
+	g.Expect(outw.String()).Should(Equal("f main.Flags = 0x1d\n"))
+	outw.Reset()
+	executor("p f")
+	g.Expect(outw.String()).Should(Equal("0x1d\n"))
+	outw.Reset()
+
+	// the decimal can't be cut, the magnitude beyond max-array-values words is rendered as the struct
+	executor("config max-array-values 1")
+	outw.Reset()
+	executor("p *n")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("{neg: true, abs: [14083847773837265618, ...+1 more]}\n"))
+	outw.Reset()
+	node, err := parser.ParseExpr("*n")
+	g.Expect(err).Should(BeNil())
+	l, err := evalLvalue(node)
+	g.Expect(err).Should(BeNil())
+	_, err = formatBigInt(newPrinter(), l.typ, l.addr)
+	g.Expect(err).Should(MatchError("the magnitude of 2 words is beyond max-array-values 1"))
+	executor("config max-array-values 64")
+	outw.Reset()
+
+	executor("config format time.Time default")
+	outw.Reset()
+	executor("p at")
+	g.Expect(outw.String()).Should(MatchRegexp(`^\{wall: 500, ext: \d+, loc: nil\}\n$`))
+	outw.Reset()
+	executor("config format main.ID octal")
+	g.Expect(errw.String()).Should(Equal("unknown format `octal`, expect string, hex, time, decimal or default\n"))
+	errw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestNumberFormat(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t31.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t31.go:25")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for expr, value := range map[string]string{
+		"-x f":       "0x1d",
+		"-b f":       "0b11101",
+		"-o f":       "0o35",
+		"-x -f":      "-0x1d",
+		"%x f + 1":   "0x1e",
+		"-c id":      "['a', 'b', 'c', 'd']",
+		"%c id[1]":   "'b'",
+		"-x -full e": "{id: [0x61, 0x62, 0x63, 0x64], at: 2024-05-06T07:08:09.0000005Z}",
+		"f":          "29",
+	} {
+		executor("p " + expr)
+		g.Expect(errw.String()).Should(Equal(""), expr)
+		g.Expect(outw.String()).Should(Equal(value+"\n"), expr)
+		outw.Reset()
+	}
+
+	executor("config number-format hex")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("number-format = hex\n"))
+	outw.Reset()
+	executor("p f")
+	g.Expect(outw.String()).Should(Equal("0x1d\n"))
+	outw.Reset()
+	executor("locals ^f$")
+	g.Expect(outw.String()).Should(Equal("f main.Flags = 0x1d\n"))
+	outw.Reset()
+	executor("p -d f")
+	g.Expect(outw.String()).Should(Equal("29\n"))
+	outw.Reset()
+
+	executor("config number-format octal")
+	g.Expect(errw.String()).Should(Equal("unknown number format `octal`, expect dec, hex, bin, oct or char\n"))
+	errw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestDisplay(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("display")
+	g.Expect(outw.String()).Should(Equal("there is no display\n"))
+	outw.Reset()
+	executor("b ./test_file/t28.go:9")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("display sum")
+	g.Expect(outw.String()).Should(Equal("1: sum = 0\n"))
+	outw.Reset()
+	executor("display i * 10")
+	executor("display nothing")
+	executor("display (")
+	g.Expect(errw.String()).Should(ContainSubstring("expected operand"))
+	errw.Reset()
+	outw.Reset()
+
+	// the displays are evaluated every time it stops
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HaveSuffix("1: sum = 1\n2: i * 10 = 10\n3: nothing = <can't find variable nothing>\n"))
+	outw.Reset()
+
+	executor("undisplay 3")
+	g.Expect(outw.String()).Should(Equal("remove display 3 nothing\n"))
+	outw.Reset()
+	executor("undisplay 3")
+	g.Expect(errw.String()).Should(ContainSubstring("can't find display 3"))
+	errw.Reset()
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HaveSuffix("1: sum = 3\n2: i * 10 = 20\n"))
+	outw.Reset()
+
+	executor("display")
+	g.Expect(outw.String()).Should(Equal("1: sum = 3\n2: i * 10 = 20\n"))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestTracePoint(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t29.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("trace -args main.add")
+	executor("trace ./test_file/t29.go:14")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("bl")
+	g.Expect(outw.String()).Should(MatchRegexp(`(?m)^1 \. .*t29\.go:5, pc \d+, trace with args\n2 \. .*t29\.go:14, pc \d+, trace\n$`))
+	outw.Reset()
+
+	// the tracepoints log the hits and it runs to the end
+	executor("c")
+	g.Expect(outw.String()).Should(Equal("trace 1 main.add(a int = 0, b int = 0) goroutine 1 at test_file/t29.go:5\n" +
+		"trace 1 main.add(a int = 0, b int = 1) goroutine 1 at test_file/t29.go:5\n" +
+		"trace 1 main.add(a int = 1, b int = 2) goroutine 1 at test_file/t29.go:5\n" +
+		"trace 2 main.main goroutine 1 at ./test_file/t29.go:14\n"))
+	g.Expect(errw.String()).Should(ContainSubstring("has exited with status 0"))
+
+	clear_variable()
+}
+
+func TestBreakPointCommands(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t28.go:9")
+	executor("on 1 p i")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HaveSuffix("breakpoint 1 ./test_file/t28.go:9 runs p i\n"))
+	outw.Reset()
+
+	// it stops since the commands don't resume it
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HaveSuffix("\n0\n"))
+	outw.Reset()
+
+	executor("on 1 p sum * 10;  ; p i; continue; p i")
+	g.Expect(outw.String()).Should(Equal("breakpoint 1 ./test_file/t28.go:9 runs p sum * 10; p i; continue; p i\n"))
+	outw.Reset()
+	executor("bl")
+	g.Expect(outw.String()).Should(ContainSubstring(", commands p sum * 10; p i; continue; p i, hits 1"))
+	outw.Reset()
+
+	// the commands after continue are dropped, the ones of the next hit run instead
+	executor("c")
+	g.Expect(errw.String()).Should(ContainSubstring("has exited with status 0"))
+	lines := regexp.MustCompile(`(?m)^\d+$`).FindAllString(outw.String(), -1)
+	g.Expect(lines).Should(Equal([]string{"10", "1", "30", "2"}))
+	outw.Reset()
+	errw.Reset()
+
+	executor("on 2 p i")
+	g.Expect(errw.String()).Should(ContainSubstring("can't find breakpoint 2"))
+
+	clear_variable()
+}
+
+func TestChannelState(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t30.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t30.go:15")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("chan full")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^chan int len 1, cap 1\nbuffer: \[5\]\n` +
+		`goroutine \d+ is blocked sending 9 at .*t30\.go:11 main\.main\.func1\n$`))
+	outw.Reset()
+
+	executor("chan empty")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^chan string len 0, cap 0\nbuffer: \[\]\n` +
+		`goroutine \d+ is blocked receiving at .*t30\.go:13 main\.main\.func2\n$`))
+	outw.Reset()
+
+	executor("chan 1")
+	g.Expect(errw.String()).Should(ContainSubstring("not support the place"))
+	errw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+// dapClient drives serveDap through the pipes, the messages are read by another goroutine
+type dapClient struct {
+	w        io.Writer
+	seq      int
+	messages chan map[string]interface{}
+	mu       sync.Mutex
+	output   strings.Builder
+}
+
+func newDapClient(w io.Writer, r io.Reader) *dapClient {
+	c := &dapClient{w: w, messages: make(chan map[string]interface{}, 100)}
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			var length int
+			if _, err := fmt.Fscanf(br, "Content-Length: %d\r\n\r\n", &length); err != nil {
+				return
+			}
+			body := make([]byte, length)
+			if _, err := io.ReadFull(br, body); err != nil {
+				return
+			}
+			msg := make(map[string]interface{})
+			json.Unmarshal(body, &msg)
+			if msg["event"] == "output" {
+				body := msg["body"].(map[string]interface{})
+				if body["category"] == "stdout" {
+					c.mu.Lock()
+					c.output.WriteString(body["output"].(string))
+					c.mu.Unlock()
+				}
+				continue
+			}
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+func (c *dapClient) request(command string, args interface{}) {
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// next returns the next message which is not an output event
+func (c *dapClient) next() map[string]interface{} {
+	select {
+	case msg := <-c.messages:
+		return msg
+	case <-time.After(10 * time.Second):
+		return nil
+	}
+}
+
+func (c *dapClient) stdout() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.output.String()
+}
+
+func TestDap(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- serveDap(reqR, respW)
+	}()
+	c := newDapClient(reqW, respR)
+	dir, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	source := path.Join(dir, "test_file/t28.go")
+
+	// the response of the request, the body is checked by the caller
+	response := func(command string) map[string]interface{} {
+		msg := c.next()
+		g.Expect(msg).ShouldNot(BeNil(), command)
+		g.Expect(msg["type"]).Should(Equal("response"), command)
+		g.Expect(msg["command"]).Should(Equal(command))
+		g.Expect(msg["success"]).Should(Equal(true), fmt.Sprintf("%s: %v", command, msg["message"]))
+		body, _ := msg["body"].(map[string]interface{})
+		return body
+	}
+	event := func(name string) map[string]interface{} {
+		msg := c.next()
+		g.Expect(msg).ShouldNot(BeNil(), name)
+		g.Expect(msg["event"]).Should(Equal(name))
+		body, _ := msg["body"].(map[string]interface{})
+		return body
+	}
+
+	c.request("initialize", map[string]interface{}{"adapterID": "godbg"})
+	g.Expect(response("initialize")["supportsConfigurationDoneRequest"]).Should(Equal(true))
+	event("initialized")
+	c.request("launch", map[string]interface{}{"program": "./test_file/t28.go"})
+	response("launch")
+	defer os.Remove(execfile)
+
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": source},
+		"breakpoints": []interface{}{map[string]interface{}{"line": 8}, map[string]interface{}{"line": 100}}})
+	bps := response("setBreakpoints")["breakpoints"].([]interface{})
+	g.Expect(bps).Should(HaveLen(2))
+	g.Expect(bps[0].(map[string]interface{})["verified"]).Should(Equal(true), fmt.Sprint(bps[0]))
+	g.Expect(bps[0].(map[string]interface{})["line"]).Should(BeNumerically("==", 8))
+	g.Expect(bps[1].(map[string]interface{})["verified"]).Should(Equal(false))
+
+	c.request("configurationDone", nil)
+	response("configurationDone")
+	stopped := event("stopped")
+	g.Expect(stopped["reason"]).Should(Equal("breakpoint"))
+	g.Expect(stopped["hitBreakpointIds"]).Should(Equal([]interface{}{float64(1)}))
+	goroutine := stopped["threadId"]
+
+	c.request("threads", nil)
+	ids := make([]interface{}, 0)
+	for _, th := range response("threads")["threads"].([]interface{}) {
+		ids = append(ids, th.(map[string]interface{})["id"])
+	}
+	g.Expect(ids).Should(ContainElement(goroutine))
+
+	c.request("stackTrace", map[string]interface{}{"threadId": goroutine, "levels": 1})
+	frames := response("stackTrace")["stackFrames"].([]interface{})
+	g.Expect(frames).Should(HaveLen(1))
+	frame := frames[0].(map[string]interface{})
+	g.Expect(frame["name"]).Should(Equal("main.main"))
+	g.Expect(frame["line"]).Should(BeNumerically("==", 8))
+	g.Expect(frame["source"].(map[string]interface{})["path"]).Should(Equal(source))
+
+	c.request("scopes", map[string]interface{}{"frameId": frame["id"]})
+	scopes := response("scopes")["scopes"].([]interface{})
+	g.Expect(scopes).Should(HaveLen(2))
+	locals := scopes[1].(map[string]interface{})
+	g.Expect(locals["name"]).Should(Equal("Locals"))
+	c.request("variables", map[string]interface{}{"variablesReference": locals["variablesReference"]})
+	values := make([]string, 0)
+	for _, v := range response("variables")["variables"].([]interface{}) {
+		v := v.(map[string]interface{})
+		values = append(values, fmt.Sprintf("%s %s = %s", v["name"], v["type"], v["value"]))
+	}
+	g.Expect(values).Should(Equal([]string{"sum int = 0", "i int = 0"}))
+
+	c.request("continue", map[string]interface{}{"threadId": goroutine})
+	g.Expect(response("continue")["allThreadsContinued"]).Should(Equal(true))
+	g.Expect(event("stopped")["reason"]).Should(Equal("breakpoint"))
+	c.request("stackTrace", map[string]interface{}{"threadId": goroutine})
+	frame = response("stackTrace")["stackFrames"].([]interface{})[0].(map[string]interface{})
+	c.request("evaluate", map[string]interface{}{"expression": "i * 10 + sum", "frameId": frame["id"]})
+	g.Expect(response("evaluate")["result"]).Should(Equal("10"))
+	c.request("evaluate", map[string]interface{}{"expression": "nothing"})
+	msg := c.next()
+	g.Expect(msg["success"]).Should(Equal(false))
+	g.Expect(msg["message"]).Should(Equal("can't find variable nothing"))
+
+	c.request("next", map[string]interface{}{"threadId": goroutine})
+	response("next")
+	g.Expect(event("stopped")["reason"]).Should(Equal("step"))
+
+	// the breakpoints of the source are cleared by an empty list
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": source}, "breakpoints": []interface{}{}})
+	g.Expect(response("setBreakpoints")["breakpoints"]).Should(BeEmpty())
+	g.Expect(bp.List()).Should(BeEmpty())
+	c.request("continue", map[string]interface{}{"threadId": goroutine})
+	response("continue")
+	g.Expect(event("exited")["exitCode"]).Should(BeNumerically("==", 0))
+	event("terminated")
+	g.Eventually(c.stdout).Should(Equal("0\n1\n3\n"))
+
+	c.request("disconnect", nil)
+	response("disconnect")
+	g.Expect(<-served).Should(BeNil())
+	clear_variable()
+}
+
+func TestDapProgress(t *testing.T) {
+	g := NewGomegaWithT(t)
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- serveDap(reqR, respW)
+	}()
+	c := newDapClient(reqW, respR)
+
+	c.request("initialize", map[string]interface{}{"adapterID": "godbg", "supportsProgressReporting": true})
+	g.Expect(c.next()["command"]).Should(Equal("initialize"))
+	g.Expect(c.next()["event"]).Should(Equal("initialized"))
+	c.request("launch", map[string]interface{}{"program": "./test_file/t28.go"})
+	// the percentages grow until the end before launch responds
+	msg := c.next()
+	g.Expect(msg["event"]).Should(Equal("progressStart"))
+	id := msg["body"].(map[string]interface{})["progressId"]
+	last := -1.0
+	for msg = c.next(); msg != nil && msg["event"] == "progressUpdate"; msg = c.next() {
+		body := msg["body"].(map[string]interface{})
+		g.Expect(body["progressId"]).Should(Equal(id))
+		g.Expect(body["percentage"]).Should(BeNumerically(">", last))
+		g.Expect(body["message"]).Should(MatchRegexp(`^\d+/\d+ compile units$`))
+		last = body["percentage"].(float64)
+	}
+	g.Expect(last).Should(Equal(100.0))
+	g.Expect(msg["event"]).Should(Equal("progressEnd"))
+	g.Expect(msg["body"].(map[string]interface{})["progressId"]).Should(Equal(id))
+	// the binary is built before it is analyzed
+	defer os.Remove(execfile)
+	msg = c.next()
+	g.Expect(msg["command"]).Should(Equal("launch"))
+	g.Expect(msg["success"]).Should(Equal(true))
+
+	c.request("disconnect", nil)
+	g.Expect(c.next()["command"]).Should(Equal("disconnect"))
+	g.Expect(<-served).Should(BeNil())
+	clear_variable()
+}
+
+func TestHeadless(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).Should(BeNil())
+
+	// the client runs on another goroutine, the results are checked after the server stops
+	type result struct {
+		bp      *api.Breakpoint
+		bps     []api.Breakpoint
+		states  []*api.State
+		frames  []api.Stackframe
+		locals  []api.Variable
+		value   string
+		evalErr error
+		out     string
+		unknown error
+		gs      []api.Goroutine
+		err     error
+	}
+	results := make(chan *result, 1)
+	go func() {
+		r := &result{}
+		defer func() { results <- r }()
+		c, err := client.New(l.Addr().String())
+		if err != nil {
+			r.err = err
+			return
+		}
+		defer c.Close()
+		if r.bp, err = c.CreateBreakpoint("./test_file/t28.go:9", "sum > 0"); err != nil {
+			r.err = err
+			return
+		}
+		if r.bps, err = c.ListBreakpoints(); err != nil {
+			r.err = err
+			return
+		}
+		state, err := c.Continue()
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.states = append(r.states, state)
+		r.frames, _ = c.Stacktrace(0, 0)
+		r.locals, _ = c.ListLocals(api.Scope{})
+		r.value, _ = c.Eval(api.Scope{}, "sum * 10 + i")
+		_, r.evalErr = c.Eval(api.Scope{Frame: 100}, "sum")
+		r.gs, _ = c.ListGoroutines()
+		r.out, _, _ = c.Exec("p sum")
+		_, r.unknown = c.Command("jump")
+		if _, err = c.ClearBreakpoint(r.bp.Id); err != nil {
+			r.err = err
+			return
+		}
+		if state, err = c.Continue(); err != nil {
+			r.err = err
+			return
+		}
+		r.states = append(r.states, state)
+		r.err = c.Detach(false)
+	}()
+	g.Expect(serveHeadless(l)).Should(BeNil())
+	r := <-results
+	g.Expect(r.err).Should(BeNil())
+
+	g.Expect(r.bp.Id).Should(Equal(1))
+	g.Expect(r.bp.Line).Should(Equal(9))
+	g.Expect(r.bp.Cond).Should(Equal("sum > 0"))
+	g.Expect(r.bps).Should(Equal([]api.Breakpoint{*r.bp}))
+	g.Expect(r.states).Should(HaveLen(2))
+	g.Expect(r.states[0].Reason).Should(Equal("breakpoint"))
+	g.Expect(r.states[0].Function).Should(Equal("main.main"))
+	g.Expect(r.states[0].Line).Should(Equal(9))
+	g.Expect(r.frames[0].Function).Should(Equal("main.main"))
+	g.Expect(r.locals).Should(Equal([]api.Variable{{Name: "sum", Type: "int", Value: "1"}, {Name: "i", Type: "int", Value: "1"}}))
+	g.Expect(r.value).Should(Equal("11"))
+	g.Expect(r.evalErr).ShouldNot(BeNil())
+	g.Expect(r.evalErr.Error()).Should(HavePrefix("can't find frame 100"))
+	g.Expect(r.gs).ShouldNot(BeEmpty())
+	g.Expect(r.out).Should(Equal("1\n"))
+	g.Expect(r.unknown.Error()).Should(Equal("unknown command `jump`, expect continue, next, step or stepout"))
+	g.Expect(r.states[1].Exited).Should(Equal(true))
+	g.Expect(r.states[1].ExitStatus).Should(Equal(0))
+
+	// the second Detach doesn't close the session again
+	s := &RPCServer{detached: make(chan struct{})}
+	g.Expect(s.Detach(api.DetachIn{}, &api.DetachOut{})).Should(BeNil())
+	err = s.Detach(api.DetachIn{}, &api.DetachOut{})
+	g.Expect(err).ShouldNot(BeNil())
+	g.Expect(err.Error()).Should(Equal("the session has ended"))
+	clear_variable()
+}
+
+func TestGdbServer(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	dir, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	pc, err := bi.fileLineToPcForBreakPoint(path.Join(dir, "test_file/t28.go"), 9)
+	g.Expect(err).Should(BeNil())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).Should(BeNil())
+
+	// the client runs on another goroutine, the replies are checked after the server stops
+	packets := []string{"qSupported:swbreak+", "vCont?", fmt.Sprintf("Z0,%x,1", pc), fmt.Sprintf("Z1,%x,1", pc),
+		"vCont;c", "g", fmt.Sprintf("m%x,1", pc), "vCont;s", fmt.Sprintf("z0,%x,1", pc), "qAttached", "c"}
+	results := make(chan []string, 1)
+	go func() {
+		replies := make([]string, 0)
+		defer func() { results <- replies }()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		c := &gdbConn{conn: conn, rd: bufio.NewReader(conn)}
+		for _, packet := range packets {
+			if err = c.send(packet); err != nil {
+				return
+			}
+			reply, err := c.recv()
+			if err != nil {
+				return
+			}
+			replies = append(replies, reply)
+		}
+	}()
+	pid := cmd.Process.Pid
+	g.Expect(serveGdb(l)).Should(BeNil())
+	replies := <-results
+	g.Expect(replies).Should(HaveLen(len(packets)))
+
+	g.Expect(replies[0]).Should(ContainSubstring("qXfer:features:read+"))
+	g.Expect(replies[1]).Should(Equal("vCont;c;C;s;S"))
+	g.Expect(replies[2]).Should(Equal("OK"))
+	g.Expect(replies[3]).Should(Equal(""))
+	g.Expect(replies[4]).Should(Equal(fmt.Sprintf("T05thread:%x;", pid)))
+	regs, err := hex.DecodeString(replies[5])
+	g.Expect(err).Should(BeNil())
+	g.Expect(binary.LittleEndian.Uint64(regs[128:])).Should(Equal(pc))
+	g.Expect(replies[6]).ShouldNot(Equal("cc"))
+	g.Expect(replies[7]).Should(HavePrefix("T05thread:"))
+	g.Expect(replies[8]).Should(Equal("OK"))
+	g.Expect(replies[9]).Should(Equal("0"))
+	g.Expect(replies[10]).Should(Equal("W00"))
+
+	clear_variable()
+}
+
+func TestRemote(t *testing.T) {
+	var (
+		err error
+		g   = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	g.Expect(os.Setenv("GODBG_TEST", "true")).Should(BeNil())
+
+	// godbg itself is the gdb server of t28, the debuggee of the test is driven through it
+	dir, err := ioutil.TempDir("", "godbg-remote")
+	g.Expect(err).Should(BeNil())
+	defer os.RemoveAll(dir)
+	godbg := path.Join(dir, "godbg")
+	g.Expect(exec.Command("go", "build", "-o", godbg, ".").Run()).Should(BeNil())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).Should(BeNil())
+	addr := l.Addr().String()
+	l.Close()
+	server := exec.Command(godbg, "gdbserver", addr, "./test_file/t28.go")
+	serverOut, err := server.StdoutPipe()
+	g.Expect(err).Should(BeNil())
+	g.Expect(server.Start()).Should(BeNil())
+	defer server.Process.Kill()
+	rd := bufio.NewReader(serverOut)
+	for {
+		line, err := rd.ReadString('\n')
+		g.Expect(err).Should(BeNil())
+		if strings.HasPrefix(line, "gdb server listening at") {
+			break
+		}
+	}
+
+	// the same source builds the same binary as the one of the server
+	wd, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	execfile, err = build(path.Join(wd, "test_file/t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	cmd, err = connectRemote(addr, execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(replaying()).Should(Equal(false))
+
+	executor("b ./test_file/t28.go:9")
+	executor("c")
+	executor("p sum")
+	executor("set sum = 5")
+	executor("p sum")
+	executor("checkpoint")
+	executor("bc 1")
+	executor("c")
+	executor("q")
+	g.Expect(errw.String()).Should(MatchRegexp(`^unsupported by the remote gdb server\nProcess \d+ has exited with status 0\n$`))
+	g.Expect(outw.String()).Should(ContainSubstring("t28.go:9"))
+	g.Expect(outw.String()).Should(ContainSubstring("0\nsum = 5\n5\n"))
+
+	// the debuggee prints the sum assigned
+	rest, _ := ioutil.ReadAll(rd)
+	g.Expect(string(rest)).Should(Equal("5\n6\n8\n"))
+	g.Expect(server.Wait()).Should(BeNil())
+
+	clear_variable()
+}
+
+func TestStarlark(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	script, err := ioutil.TempFile("", "godbg-*.star")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(script.Name())
+	_, err = script.WriteString(`b = breakpoint("./test_file/t28.go:9", "sum > 0")
+print(b["id"], b["line"], b["cond"])
+state = cont()
+print(state["reason"], state["function"], state["line"])
+print(eval("sum * 10 + i"))
+for v in locals():
+    print(v["name"], v["type"], v["value"])
+print(len(goroutines()) > 0, stacktrace()[0]["function"])
+print(command("p sum").strip())
+
+def command_sums(args):
+    for n in range(int(args)):
+        s = cont()
+        if s["exited"]:
+            print("exited", s["exit_status"])
+            return
+        print(eval("sum"))
+
+def command_show(args):
+    print(eval(args))
+`)
+	g.Expect(err).Should(BeNil())
+	g.Expect(script.Close()).Should(BeNil())
+
+	executor("source " + script.Name())
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("1 9 sum > 0\nbreakpoint main.main 9\n11\nsum int 1\ni int 1\nTrue main.main\n1\n"))
+	outw.Reset()
+	executor("show nosuch")
+	g.Expect(errw.String()).Should(ContainSubstring("eval: "))
+	errw.Reset()
+	executor("sums 3")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("3\nexited 0\n"))
+	executor("source ./test_file/nosuch.star")
+	g.Expect(errw.String()).ShouldNot(Equal(""))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestDebugPackage(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	args := os.Args
+	os.Args = []string{"godbg", "debug", "./test_file/t35", "arg"}
+	g.Expect(checkArgs()).Should(BeNil())
+	os.Args = []string{"godbg", "debug", "./test_file/nosuch"}
+	g.Expect(checkArgs()).Should(MatchError("please input .go file or the directory of the package"))
+	os.Args = args
+
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t35")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	g.Expect(path.Base(execfile)).Should(HavePrefix("__t35__"))
+
+	executor("b ./test_file/t35/greet.go:5")
+	executor("c")
+	executor("p msg")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HaveSuffix("\nhello godbg\n"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestTui(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	args := os.Args
+	os.Args = []string{"godbg", "debug", "--tui", "main.go", "--", "--tui"}
+	g.Expect(parseFlag("--tui")).Should(Equal(true))
+	g.Expect(os.Args).Should(Equal([]string{"godbg", "debug", "main.go", "--", "--tui"}))
+	os.Args = args
+
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	tui = true
+
+	tuiExecutor("b ./test_file/t28.go:9")
+	tuiExecutor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	screen := outw.String()[strings.LastIndex(outw.String(), tuiClear):]
+	g.Expect(screen).Should(ContainSubstring(tuiTitle + " test_file/t28.go:9 "))
+	g.Expect(screen).Should(ContainSubstring(tuiTitle + " disassembly main.main "))
+	g.Expect(screen).Should(MatchRegexp(`\n\x1b\[1;33m=> +9  +fmt\.Println\(sum\)`))
+	g.Expect(screen).Should(MatchRegexp(`\x1b\[1;33m=> +0x[0-9a-f]+  +[0-9a-f]+ +\S`))
+	g.Expect(screen).Should(MatchRegexp(`\n\x1b\[1;33m\* 1 running test_file/t28\.go:9 main\.main *\x1b\[0m \| \x1b\[1;33m=> #0  main\.main t28\.go:9`))
+	g.Expect(screen).Should(ContainSubstring("\n==>      9: \t\tfmt.Println(sum)\n"))
+
+	// the output is printed as it is if the view doesn't change
+	outw.Reset()
+	tuiExecutor("p sum")
+	g.Expect(outw.String()).Should(Equal("0\n"))
+	tuiExecutor("b ./test_file/t28.go:8")
+	g.Expect(outw.String()).Should(MatchRegexp(`\n\x1b\[31m \* +8  +sum \+= i`))
+	tuiExecutor("up")
+	g.Expect(outw.String()).Should(ContainSubstring(tuiClear))
+	g.Expect(outw.String()).Should(MatchRegexp(`=> #1  runtime\.main proc\.go:\d+`))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestHistory(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, err := ioutil.TempDir("", "godbg")
+	g.Expect(err).Should(BeNil())
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, ".godbg_history")
+
+	g.Expect(loadHistory(filename)).Should(BeEmpty())
+	g.Expect(appendHistory(filename, "b main.main")).Should(BeNil())
+	g.Expect(appendHistory(filename, "  ")).Should(BeNil())
+	g.Expect(appendHistory(filename, "c")).Should(BeNil())
+	g.Expect(loadHistory(filename)).Should(Equal([]string{"b main.main", "c"}))
+
+	// the history file keeps the last maxHistory commands
+	for i := 0; i < maxHistory; i++ {
+		g.Expect(appendHistory(filename, fmt.Sprintf("p %d", i))).Should(BeNil())
+	}
+	history := loadHistory(filename)
+	g.Expect(history).Should(HaveLen(maxHistory))
+	g.Expect(history[0]).Should(Equal("p 0"))
+	g.Expect(history[maxHistory-1]).Should(Equal(fmt.Sprintf("p %d", maxHistory-1)))
+	content, err := ioutil.ReadFile(filename)
+	g.Expect(err).Should(BeNil())
+	g.Expect(strings.Count(string(content), "\n")).Should(Equal(maxHistory))
+}
+
+func TestComplete(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	texts := func(input string) []string {
+		b := prompt.NewBuffer()
+		b.InsertText(input, false, true)
+		ts := make([]string, 0)
+		for _, s := range complete(*b.Document()) {
+			ts = append(ts, s.Text)
+		}
+		return ts
+	}
+	g.Expect(texts("thr")).Should(Equal([]string{"thread", "threads"}))
+	g.Expect(texts("b main.ma")).Should(Equal([]string{"main.main"}))
+	g.Expect(texts("tb runtime.gopani")).Should(Equal([]string{"runtime.gopanic"}))
+	// the word after the last `/` is replaced by the suggestion
+	g.Expect(texts("b ./test_file/t28")).Should(Equal([]string{"t28.go"}))
+	g.Expect(texts("b -hw test_file/t2")).Should(Equal([]string{"t28.go"}))
+	g.Expect(texts("l ./test_")).Should(Equal([]string{"test_file/t28.go"}))
+	g.Expect(texts("p main.ma")).Should(BeEmpty())
+
+	executor("q")
+	clear_variable()
+}
+
+func TestAlias(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("alias")
+	g.Expect(outw.String()).Should(Equal("there is no alias\n"))
+	outw.Reset()
+	executor("alias bm b ./test_file/t28.go:9; bl")
+	g.Expect(outw.String()).Should(Equal("alias bm = b ./test_file/t28.go:9; bl\n"))
+	outw.Reset()
+	executor("bm")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("godbg add ./test_file/t28.go:9 breakpoint successfully\n1 . ./test_file/t28.go:9, pc 4940610\n"))
+
+	// the builtin short forms can be defined again, and the args are appended to the last command
+	executor("alias n c")
+	executor("alias pp p")
+	outw.Reset()
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      9: \t\tfmt.Println(sum)\n"))
+	outw.Reset()
+	executor("pp sum")
+	g.Expect(outw.String()).Should(Equal("0\n"))
+	outw.Reset()
+	executor("alias")
+	g.Expect(outw.String()).Should(Equal("bm = b ./test_file/t28.go:9; bl\nn = c\npp = p\n"))
+
+	executor("alias x y")
+	executor("alias y x")
+	executor("x")
+	g.Expect(errw.String()).Should(Equal("alias `x` is expanded recursively\n"))
+	errw.Reset()
+	executor("alias alias bl")
+	g.Expect(errw.String()).Should(Equal("`alias` can't be an alias\n"))
+	errw.Reset()
+
+	outw.Reset()
+	executor("unalias n")
+	g.Expect(outw.String()).Should(Equal("remove alias n\n"))
+	executor("unalias n")
+	g.Expect(errw.String()).Should(Equal("can't find alias `n`\n"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestConfigFile(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, err := ioutil.TempDir("", "godbg")
+	g.Expect(err).Should(BeNil())
+	defer os.RemoveAll(dir)
+	g.Expect(os.Setenv("XDG_CONFIG_HOME", dir)).Should(BeNil())
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+	filename := path.Join(dir, "godbg", "config.yml")
+
+	outw, errw := make_out_err()
+	g.Expect(LoadConfigFile()).Should(BeNil())
+	executor("config max-string-len 10")
+	executor("config number-format hex")
+	executor("config source-list-size 3")
+	executor("alias bm b main.main; c")
+	executor("config substitute-path /build/src /home/me/src")
+	outw.Reset()
+	executor("config")
+	g.Expect(outw.String()).Should(HaveSuffix("number-format = hex\nsource-list-size = 3\nmax-dwarf-memory = 0\ncolor = auto\nsubstitute-path = /build/src => /home/me/src\n"))
+	outw.Reset()
+	executor("config -save")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("save the config to " + filename + "\n"))
+	content, err := ioutil.ReadFile(filename)
+	g.Expect(err).Should(BeNil())
+	g.Expect(string(content)).Should(ContainSubstring("max-string-len: 10\n"))
+	g.Expect(string(content)).Should(ContainSubstring("aliases:\n  bm: b main.main; c\n"))
+	g.Expect(string(content)).Should(ContainSubstring("substitute-path:\n- from: /build/src\n  to: /home/me/src\n"))
+
+	// what is saved is loaded in the next session
+	clear_variable()
+	g.Expect(LoadConfigFile()).Should(BeNil())
+	g.Expect(loadConfig.maxStringLen).Should(Equal(10))
+	g.Expect(loadConfig.maxArrayValues).Should(Equal(defaultLoadConfig().maxArrayValues))
+	g.Expect(numberFormat).Should(Equal(byte('x')))
+	g.Expect(sourceListSize).Should(Equal(3))
+	g.Expect(aliases).Should(Equal(map[string]string{"bm": "b main.main; c"}))
+	g.Expect(substitutePaths).Should(Equal([]substitutePathRule{{From: "/build/src", To: "/home/me/src"}}))
+
+	// the keys missing keep the defaults, the wrong ones are errors
+	clear_variable()
+	g.Expect(ioutil.WriteFile(filename, []byte("source-list-size: 4\n"), 0644)).Should(BeNil())
+	g.Expect(LoadConfigFile()).Should(BeNil())
+	g.Expect(sourceListSize).Should(Equal(4))
+	g.Expect(loadConfig).Should(Equal(defaultLoadConfig()))
+	g.Expect(ioutil.WriteFile(filename, []byte("max-dwarf-memory: 512M\n"), 0644)).Should(BeNil())
+	g.Expect(LoadConfigFile()).Should(BeNil())
+	g.Expect(dwarfBudget).Should(Equal(int64(512 << 20)))
+	g.Expect(currentFileConfig().MaxDwarfMemory).Should(Equal("512M"))
+	g.Expect(ioutil.WriteFile(filename, []byte("max-string-len: -1\n"), 0644)).Should(BeNil())
+	g.Expect(LoadConfigFile()).Should(MatchError(filename + ": the value of max-string-len should be a number not less than 0, not `-1`"))
+	g.Expect(ioutil.WriteFile(filename, []byte("max-string-length: 1\n"), 0644)).Should(BeNil())
+	g.Expect(LoadConfigFile().Error()).Should(ContainSubstring("field max-string-length not found"))
+	clear_variable()
+}
+
+func TestList(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t28.go:9")
+	executor("b ./test_file/t28.go:7")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	wd, _ := os.Getwd()
+	filename := path.Join(wd, "test_file/t28.go")
+	body := "==>      7: \tfor i := 0; i < 3; i++ {\n         8: \t\tsum += i\n *       9: \t\tfmt.Println(sum)\n"
+
+	// the line of the frame selected is marked by `==>` and the breakpoints by `*`
+	outw.Reset()
+	executor("l")
+	g.Expect(outw.String()).Should(HavePrefix("list " + filename + ":7\n         1: package main\n"))
+	g.Expect(outw.String()).Should(ContainSubstring(body))
+	outw.Reset()
+	executor("l 8 2")
+	g.Expect(outw.String()).Should(Equal("list " + filename + ":8\n         5: func main() {\n         6: \tsum := 0\n" + body + "\n"))
+	outw.Reset()
+	executor("l test_file/t28.go:8 2")
+	g.Expect(outw.String()).Should(Equal("list " + filename + ":8\n         5: func main() {\n         6: \tsum := 0\n" + body + "\n"))
+	outw.Reset()
+	executor("l main.main 2")
+	g.Expect(outw.String()).Should(Equal("list " + filename + ":5\n         2: \n         3: import \"fmt\"\n         4: \n         5: func main() {\n         6: \tsum := 0\n\n"))
+	pc, err := bi.fileLineToPc(filename, 9)
+	g.Expect(err).Should(BeNil())
+	outw.Reset()
+	executor(fmt.Sprintf("l *%#x 1", pc))
+	g.Expect(outw.String()).Should(Equal("list " + filename + ":9\n" + body + "\n"))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("l main.nosuch")
+	g.Expect(errw.String()).Should(ContainSubstring("main.nosuch"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestCgoUnits(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t36.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	// the declarations and the prototypes of the C units are not functions
+	g.Expect(bi.loadAll()).Should(BeNil())
+	for _, f := range bi.Functions {
+		g.Expect(f.name).ShouldNot(Equal(""))
+		g.Expect(f.lowpc < f.highpc).Should(Equal(true))
+	}
+	add, err := bi.findFunctionByName("add")
+	g.Expect(err).Should(BeNil())
+	g.Expect(add.cu.isGo()).Should(Equal(false))
+	filename, lineno, err := bi.pcTofileLine(add.lowpc)
+	g.Expect(err).Should(BeNil())
+	g.Expect(filename).Should(HaveSuffix("test_file/t36.go"))
+	g.Expect(lineno).Should(Equal(6))
+	// gcc writes the rows of the views at the same pc, the line of the pc is the one of the first statement
+	first := make(map[uint64]*dwarf.LineEntry)
+	views := 0
+	for i, row := range add.cu.lines {
+		if i > 0 && add.cu.lines[i-1].Address == row.Address && add.cu.lines[i-1].Line != row.Line {
+			views++
+		}
+		if _, ok := first[row.Address]; row.IsStmt && !ok {
+			first[row.Address] = row
+		}
+	}
+	g.Expect(views).Should(BeNumerically(">", 0))
+	for pc, row := range first {
+		_, lineno, err = bi.pcTofileLine(pc)
+		g.Expect(err).Should(BeNil())
+		g.Expect(lineno).Should(Equal(row.Line), fmt.Sprintf("%#x", pc))
+	}
+	mainFunc, err := bi.findFunctionByName("main.main")
+	g.Expect(err).Should(BeNil())
+	g.Expect(mainFunc.cu.isGo()).Should(Equal(true))
+	// the static variable of the unit is a package variable, the one in add is not
+	_, ok := bi.packageVar("calls")
+	g.Expect(ok).Should(Equal(true))
+	_, ok = bi.packageVar("last")
+	g.Expect(ok).Should(Equal(false))
+
+	// the C frames are unwound by .eh_frame
+	executor("b add")
+	executor("c")
+	outw.Reset()
+	executor("bt")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^#0  pc \d+ \S+test_file/t36.go:\d+ add bp \d+ \(C code\)\n#1  pc \d+ \S+ _cgo_\w+_Cfunc_add bp \d+ \(C code\)\n`))
+	g.Expect(outw.String()).Should(MatchRegexp(`runtime.asmcgocall bp \d+\n`))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestNoDwarf(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	execfile := path.Join(os.TempDir(), "__t28_stripped__")
+	g.Expect(exec.Command("go", "build", "-ldflags=-s -w", "-gcflags", "all=-N -l", "-o", execfile,
+		path.Join(dir, "test_file/t28.go")).Run()).Should(BeNil())
+	defer os.Remove(execfile)
+	outw, errw := make_out_err()
+	var err error
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(bi.DwarfData).Should(BeNil())
+	g.Expect(errw.String()).Should(Equal("warning: " + execfile + " has no DWARF, the functions, the lines and the frames are read from .gopclntab and the frame pointers. `locals`, `args`, `vars`, `p`, `whatis`, `display`, `watch`, `rwatch`, `call`, `chan`, `defer`, `goroutines`, `dump-dwarf` are unavailable, rebuild it without -ldflags=-w or -s\n"))
+	errw.Reset()
+	cmd, err = runexec(execfile, nil)
+	g.Expect(err).Should(BeNil())
+	g.Expect(os.Setenv("GODBG_TEST", "true")).Should(BeNil())
+
+	// the breakpoints and the frames are found by .gopclntab
+	executor("b main.main")
+	g.Expect(outw.String()).Should(Equal("godbg add " + dir + "/test_file/t28.go:6 breakpoint successfully\n"))
+	executor("b ./test_file/t28.go:9")
+	executor("c")
+	executor("n")
+	executor("n")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      9: \t\tfmt.Println(sum)"))
+	outw.Reset()
+	executor("bt")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^#0  pc \d+ \S+test_file/t28.go:9 main.main bp \d+\n#1  pc \d+ \S+/runtime/proc.go:\d+ runtime.main bp \d+\n#2  pc \d+ \S+ runtime.goexit bp 0\n$`))
+
+	// the variables tell why they are unavailable
+	executor("locals")
+	g.Expect(errw.String()).Should(Equal("the variables are unavailable, the binary has no DWARF, rebuild it without -ldflags=-w or -s\n"))
+	errw.Reset()
+	executor("p sum")
+	g.Expect(errw.String()).Should(Equal("the variables are unavailable, the binary has no DWARF, rebuild it without -ldflags=-w or -s\n"))
+	errw.Reset()
+	executor("goroutines")
+	g.Expect(errw.String()).Should(Equal("the goroutines are unavailable, the binary has no DWARF, rebuild it without -ldflags=-w or -s\n"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestOptimized(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	execfile := path.Join(os.TempDir(), "__t28_optimized__")
+	g.Expect(exec.Command("go", "build", "-o", execfile, path.Join(dir, "test_file/t28.go")).Run()).Should(BeNil())
+	defer os.Remove(execfile)
+	outw, errw := make_out_err()
+	var err error
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	cmd, err = runexec(execfile, nil)
+	g.Expect(err).Should(BeNil())
+	g.Expect(os.Setenv("GODBG_TEST", "true")).Should(BeNil())
+
+	warning := "warning: main.main is optimized, the value may be inaccurate, compile with -gcflags=all='-N -l'\n"
+	executor("funcs -optimized ^main\\.main$")
+	g.Expect(outw.String()).Should(Equal("main.main\n"))
+	executor("b main.main")
+	g.Expect(errw.String()).Should(Equal(warning))
+	errw.Reset()
+	executor("c")
+	executor("locals")
+	g.Expect(errw.String()).Should(Equal(warning))
+	executor("q")
+	clear_variable()
+
+	// the code built by godbg is not optimized, but the runtime is always
+	outw, errw = make_out_err()
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	executor("b main.main")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("funcs -optimized ^main\\.")
+	g.Expect(outw.String()).Should(Equal(""))
+	executor("funcs ^main\\.main$")
+	g.Expect(outw.String()).Should(Equal("main.main\n"))
+	outw.Reset()
+	executor("funcs -optimized ^runtime\\.main$")
+	g.Expect(outw.String()).Should(Equal("runtime.main\n"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestGoroutineInfo(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	executor("info goroutine")
+	g.Expect(errw.String()).Should(Equal("there is no process running\n"))
+	errw.Reset()
+
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	// the go linker keeps the g at fs_base-8
+	g.Expect(bi.gOffset).Should(Equal(int64(-8)))
+
+	executor("b main.main")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("info goroutine")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`^goroutine 1 running, g 0x[0-9a-f]+, stack \[0x[0-9a-f]+, 0x[0-9a-f]+\), sched pc 0x[0-9a-f]+ sp 0x[0-9a-f]+ bp 0x[0-9a-f]+, thread \d+\n$`))
+	outw.Reset()
+
+	// the stack pointer of the running goroutine is in its stack
+	cur, err := CurrentGoroutine()
+	g.Expect(err).Should(BeNil())
+	g.Expect(cur.id).Should(Equal(uint64(1)))
+	var regs PtraceRegs
+	g.Expect(ptraceGetRegs(currentThread(), &regs)).Should(BeNil())
+	g.Expect(cur.stackLo).Should(BeNumerically("<=", regs.Rsp))
+	g.Expect(cur.stackHi).Should(BeNumerically(">", regs.Rsp))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestLoadCompileUnitError(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	execfile, err := build(path.Join(dir, "test_file/t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	var mainUnit *CompileUnit
+	for _, cu := range parsed.CompileUnits {
+		if cu.name == "main" {
+			mainUnit = cu
+		}
+	}
+	g.Expect(mainUnit).ShouldNot(BeNil())
+
+	// the unit failing to parse is not taken as loaded, the next lookup parses it again
+	entry := mainUnit.entry
+	broken := *entry
+	broken.Offset = 1 << 30
+	broken.Field = make([]dwarf.Field, len(entry.Field))
+	copy(broken.Field, entry.Field)
+	for i := range broken.Field {
+		if broken.Field[i].Attr == dwarf.AttrStmtList {
+			broken.Field[i].Val = int64(1 << 30)
+		}
+	}
+	mainUnit.entry = &broken
+	g.Expect(parsed.loadCompileUnit(mainUnit)).ShouldNot(BeNil())
+	g.Expect(mainUnit.loaded).Should(Equal(false))
+	g.Expect(parsed.loadLineTable(mainUnit)).ShouldNot(BeNil())
+	g.Expect(mainUnit.linesLoaded).Should(Equal(false))
+
+	mainUnit.entry = entry
+	g.Expect(parsed.loadCompileUnit(mainUnit)).Should(BeNil())
+	g.Expect(mainUnit.loaded).Should(Equal(true))
+	g.Expect(parsed.functionsByName).Should(HaveKey("main.main"))
+	g.Expect(parsed.loadLineTable(mainUnit)).Should(BeNil())
+	g.Expect(mainUnit.linesLoaded).Should(Equal(true))
+	g.Expect(parsed.Sources[path.Join(dir, "test_file/t28.go")]).ShouldNot(BeEmpty())
+}
+
+func TestEhFrameRanges(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	// the ranges are half-open, the functions next to each other don't overlap
+	covered := [][2]uint64{{0x10, 0x20}, {0x30, 0x40}}
+	g.Expect(overlapsRanges(covered, 0x8, 0x10)).Should(Equal(false))
+	g.Expect(overlapsRanges(covered, 0x20, 0x30)).Should(Equal(false))
+	g.Expect(overlapsRanges(covered, 0x40, 0x50)).Should(Equal(false))
+	g.Expect(overlapsRanges(covered, 0x8, 0x11)).Should(Equal(true))
+	g.Expect(overlapsRanges(covered, 0x1f, 0x30)).Should(Equal(true))
+	g.Expect(overlapsRanges(covered, 0x20, 0x31)).Should(Equal(true))
+	g.Expect(overlapsRanges(covered, 0x18, 0x1c)).Should(Equal(true))
+	g.Expect(overlapsRanges(nil, 0x10, 0x20)).Should(Equal(false))
+
+	// the C functions of cgo are unwound by their FDEs in .eh_frame
+	dir, _ := os.Getwd()
+	execfile, err := build(path.Join(dir, "test_file/t36.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(parsed.loadAll()).Should(BeNil())
+	for _, f := range parsed.Functions {
+		if f.cu.isGo() {
+			continue
+		}
+		found := false
+		for _, frameInfo := range parsed.FramesInformation {
+			if frameInfo.FDE != nil && frameInfo.FDE.begin <= f.lowpc && f.lowpc < frameInfo.FDE.begin+frameInfo.FDE.size {
+				found = true
+			}
+		}
+		g.Expect(found).Should(Equal(true), f.name)
+	}
+}
+
+func TestGoroutineInfoExternalLink(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	_, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t36.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	// cgo links t36 by the external linker, runtime.tlsg is in the TLS block with the thread variable of C
+	g.Expect(bi.file.elf.Section(".tbss")).ShouldNot(BeNil())
+	g.Expect(bi.gOffset).ShouldNot(Equal(int64(-8)))
+
+	executor("b main.main")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+
+	// the g read at gOffset from fs_base is the one in r14 of the go code
+	base, err := ptraceGetFsBase(currentThread())
+	g.Expect(err).Should(BeNil())
+	g.Expect(base).ShouldNot(BeZero())
+	addr, err := threadGoroutine(currentThread())
+	g.Expect(err).Should(BeNil())
+	var regs PtraceRegs
+	g.Expect(ptraceGetRegs(currentThread(), &regs)).Should(BeNil())
+	g.Expect(addr).Should(Equal(regs.R14))
+	cur, err := CurrentGoroutine()
+	g.Expect(err).Should(BeNil())
+	g.Expect(cur.id).Should(Equal(uint64(1)))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestProcInfo(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	executor("info auxv")
+	g.Expect(errw.String()).Should(Equal("there is no process running\n"))
+	errw.Reset()
+
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	executor("b main.main")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// AT_ENTRY is the entry of the ELF header, the binary of go is not PIE
+	file, err := elf.Open(execfile)
+	g.Expect(err).Should(BeNil())
+	defer file.Close()
+	auxv, err := processAuxv(cmd.Process.Pid)
+	g.Expect(err).Should(BeNil())
+	g.Expect(entryPointFromAuxvAMD64(auxv)).Should(Equal(file.Entry))
+	executor("info auxv")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring(fmt.Sprintf("\n9    AT_ENTRY   %#x\n", file.Entry)))
+	outw.Reset()
+
+	// the text of the binary is mapped read only and executable
+	executor("info proc mappings")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(MatchRegexp(`(?m)^Start +End +Size +Offset +Perms +Path$`))
+	g.Expect(outw.String()).Should(MatchRegexp(`(?m)^0x[0-9a-f]+ +0x[0-9a-f]+ +0x[0-9a-f]+ +0x0 +r-xp +` + regexp.QuoteMeta(execfile) + `$`))
+	outw.Reset()
+
+	executor("q")
+	clear_variable()
+}
+
+func TestDetachSignal(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t12.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("received signal user defined signal 1"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the program waits for SIGUSR1 from the channel, it exits only if the signal is delivered on detaching
+	executor("detach")
+	g.Expect(outw.String()).Should(ContainSubstring(fmt.Sprintf("detach process %d", pid)))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	var s syscall.WaitStatus
+	wpid := 0
+	for i := 0; i < 50 && wpid == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		wpid, err = syscall.Wait4(pid, &s, syscall.WNOHANG, nil)
+		g.Expect(err).Should(BeNil())
+	}
+	g.Expect(wpid).Should(Equal(pid))
+	g.Expect(s.Exited()).Should(Equal(true))
+	g.Expect(s.ExitStatus()).Should(Equal(0))
+
+	// detach -kill reaps the process and forgets its threads
+	execfile, err = build_run_debug("./test_file/t12.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid = cmd.Process.Pid
+	executor("c")
+	outw.Reset()
+	executor("detach -kill")
+	g.Expect(outw.String()).Should(ContainSubstring(fmt.Sprintf("kill process %d", pid)))
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(syscall.Kill(pid, 0)).Should(Equal(syscall.ESRCH))
+	g.Expect(threads).Should(BeEmpty())
+	g.Expect(attached).Should(Equal(false))
+	g.Expect(bp.pendingSignal).Should(BeZero())
+
+	executor("q")
+	clear_variable()
+}
+
+func TestNextConditionBreakPoint(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t3.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := cmd.Process.Pid
+
+	executor("b ./test_file/t3.go:6")
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      6: 	m := 0"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the condition of the breakpoint on the next line is false, next stops there all the same
+	executor("b ./test_file/t3.go:7")
+	executor("cond 2 m == 100")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 	n := 1"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("n")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      8: 	i := 10"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestRestartAbsolutePath(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t2.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	dir, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	sourcefile = path.Join(dir, "test_file/t2.go")
+
+	// the breakpoint of the absolute path is resolved again as it is, not under the working directory
+	executor("b " + sourcefile + ":7")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("restart")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).ShouldNot(ContainSubstring("is disabled"))
+	g.Expect(outw.String()).Should(MatchRegexp(`restart new process pid \d+`))
+	pid := cmd.Process.Pid
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 		fmt.Println(i)"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bc 1")
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestAllPCsBetween(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	execfile, err := build(path.Join(dir, "test_file/t3.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(parsed.loadAll()).Should(BeNil())
+
+	// the pcs found in the rows of the unit are the statements of the function in order, like the ones of
+	// all the units
+	checked := 0
+	for _, f := range parsed.Functions {
+		if !strings.HasPrefix(f.name, "main.") && !strings.HasPrefix(f.name, "fmt.") {
+			continue
+		}
+		filename, lineno, err := parsed.pcTofileLine(f.lowpc)
+		g.Expect(err).Should(BeNil())
+		expected := make([]uint64, 0)
+		for pc, lineEntry := range parsed.Statements {
+			if pc >= f.lowpc && pc < f.highpc && (lineEntry.File.Name != filename || lineEntry.Line != lineno) {
+				expected = append(expected, pc)
+			}
+		}
+		sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+		g.Expect(parsed.allPCsBetween(f.lowpc, f.highpc, filename, lineno)).Should(Equal(expected), f.name)
+		checked++
+	}
+	g.Expect(checked).ShouldNot(BeZero())
+}
+
+func TestStaleSource(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	wd, _ := os.Getwd()
+	filename := path.Join(wd, "test_file/t28.go")
+	warning := "warning: " + filename + " is modified after the binary is built, the lines may not match\n"
+
+	// the source built is not warned
+	executor("b ./test_file/t28.go:9")
+	executor("l main.main 1")
+	g.Expect(errw.String()).Should(Equal(""))
+
+	info, err := os.Stat(filename)
+	g.Expect(err).Should(BeNil())
+	defer os.Chtimes(filename, info.ModTime(), info.ModTime())
+	later := time.Now().Add(time.Hour)
+	g.Expect(os.Chtimes(filename, later, later)).Should(BeNil())
+	executor("b ./test_file/t28.go:7")
+	g.Expect(errw.String()).Should(Equal(warning))
+	errw.Reset()
+	executor("b main.main")
+	g.Expect(errw.String()).Should(Equal(warning))
+	errw.Reset()
+	outw.Reset()
+	executor("l main.main 1")
+	g.Expect(errw.String()).Should(Equal(warning))
+	g.Expect(outw.String()).Should(HavePrefix("list " + filename + ":5\n"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestColor(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	// the output isn't colored if it is not a terminal
+	g.Expect(highlightValue(`"a"`)).Should(Equal(`"a"`))
+	executor("config color always")
+	g.Expect(errw.String()).Should(Equal("unknown color mode `always`, expect auto, on or off\n"))
+	errw.Reset()
+	executor("config color on")
+	g.Expect(outw.String()).Should(Equal("color = on\n"))
+
+	g.Expect(highlightValue(`{name: "a", n: 3, p: *main.point, f: 1.5}`)).Should(Equal(`{name: ` + colorString + `"a"` + colorReset +
+		`, n: ` + colorNumber + `3` + colorReset + `, p: *` + colorType + `main.point` + colorReset + `, f: ` + colorNumber + `1.5` + colorReset + `}`))
+	g.Expect(highlightSource("\tfor i := 0; i < n; i++ { // int")).Should(Equal("\t" + colorKeyword + "for" + colorReset + " i := " +
+		colorNumber + "0" + colorReset + "; i < n; i++ { " + colorComment + "// int" + colorReset))
+	g.Expect(highlightSource("\tfmt.Println(sum)")).Should(Equal("\tfmt.Println(sum)"))
+
+	executor("b ./test_file/t28.go:9")
+	outw.Reset()
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring(colorHeadline + "current process pc = "))
+	g.Expect(outw.String()).Should(ContainSubstring("\n" + colorCurrent + "==>      9:" + colorReset + " \t\tfmt.Println(sum)\n"))
+	g.Expect(outw.String()).Should(ContainSubstring("\n         6: \tsum := " + colorNumber + "0" + colorReset + "\n"))
+	outw.Reset()
+	executor("p sum")
+	g.Expect(outw.String()).Should(Equal(colorNumber + "0" + colorReset + "\n"))
+	outw.Reset()
+	executor("locals")
+	g.Expect(outw.String()).Should(ContainSubstring("sum " + colorType + "int" + colorReset + " = " + colorNumber + "0" + colorReset + "\n"))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	args := os.Args
+	os.Args = []string{"godbg", "debug", "--no-color", "main.go"}
+	g.Expect(parseFlag("--no-color")).Should(Equal(true))
+	g.Expect(os.Args).Should(Equal([]string{"godbg", "debug", "main.go"}))
+	os.Args = args
+
+	executor("q")
+	clear_variable()
+}
+
+func TestSubstitutePath(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	// the program is built in build, then the sources are moved to src
+	dir, err := ioutil.TempDir("", "godbg")
+	g.Expect(err).Should(BeNil())
+	defer os.RemoveAll(dir)
+	buildDir, srcDir := path.Join(dir, "build"), path.Join(dir, "src")
+	g.Expect(os.Mkdir(buildDir, 0755)).Should(BeNil())
+	content, err := ioutil.ReadFile("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	g.Expect(ioutil.WriteFile(path.Join(buildDir, "t28.go"), content, 0644)).Should(BeNil())
+	execfile, err := build(path.Join(buildDir, "t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	g.Expect(os.Rename(buildDir, srcDir)).Should(BeNil())
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	cmd, err = runexec(execfile, nil)
+	g.Expect(err).Should(BeNil())
+	g.Expect(os.Setenv("GODBG_TEST", "true")).Should(BeNil())
+
+	outw, errw := make_out_err()
+	executor("b " + srcDir + "/t28.go:9")
+	g.Expect(errw.String()).Should(Equal("can't find this source line " + srcDir + "/t28.go:9\n"))
+	errw.Reset()
+	executor("l main.main")
+	g.Expect(errw.String()).Should(ContainSubstring("no such file or directory"))
+	errw.Reset()
+
+	executor("config substitute-path " + buildDir + "/ " + srcDir)
+	g.Expect(outw.String()).Should(Equal("substitute-path = " + buildDir + " => " + srcDir + "\n"))
+	outw.Reset()
+	executor("config")
+	g.Expect(outw.String()).Should(HaveSuffix("\nsubstitute-path = " + buildDir + " => " + srcDir + "\n"))
+	g.Expect(substitutePath(buildDir + "/t28.go")).Should(Equal(srcDir + "/t28.go"))
+	g.Expect(substitutePath(buildDir + "x/t28.go")).Should(Equal(buildDir + "x/t28.go"))
+	g.Expect(unsubstitutePath(srcDir + "/t28.go")).Should(Equal(buildDir + "/t28.go"))
+
+	// the file locations input are the ones on this machine, the sources are listed from them
+	outw.Reset()
+	executor("b " + srcDir + "/t28.go:9")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("godbg add " + srcDir + "/t28.go:9 breakpoint successfully\n"))
+	outw.Reset()
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring("list " + buildDir + "/t28.go:9\n"))
+	g.Expect(outw.String()).Should(ContainSubstring("==>      9: \t\tfmt.Println(sum)\n"))
+	outw.Reset()
+	executor("l " + srcDir + "/t28.go:5 1")
+	g.Expect(outw.String()).Should(Equal("list " + buildDir + "/t28.go:5\n         3: import \"fmt\"\n         4: \n         5: func main() {\n\n"))
+
+	executor("config substitute-path " + buildDir)
+	g.Expect(substitutePaths).Should(BeEmpty())
+	executor("config substitute-path " + buildDir)
+	g.Expect(errw.String()).Should(Equal("can't find substitute-path " + "`" + buildDir + "`\n"))
+	errw.Reset()
+	executor("config substitute-path build src")
+	g.Expect(errw.String()).Should(Equal("the paths of substitute-path should be absolute, not `build` and `src`\n"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestJSONOutput(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("output yaml")
+	g.Expect(errw.String()).Should(Equal("unknown output `yaml`, expect json or text\n"))
+	errw.Reset()
+	executor("output json")
+	g.Expect(outw.String()).Should(Equal("output = json\n"))
+
+	// each command prints a line of json, which is the reply of the api
+	decode := func(reply interface{}) {
+		g.Expect(errw.String()).Should(Equal(""))
+		g.Expect(outw.String()).Should(HaveSuffix("\n"))
+		g.Expect(strings.Count(outw.String(), "\n")).Should(Equal(1))
+		g.Expect(json.Unmarshal([]byte(outw.String()), reply)).Should(BeNil())
+		outw.Reset()
+	}
+	outw.Reset()
+	executor("b ./test_file/t28.go:9")
+	var created api.CreateBreakpointOut
+	decode(&created)
+	g.Expect(created.Breakpoint.Id).Should(Equal(1))
+	g.Expect(created.Breakpoint.File).Should(Equal("./test_file/t28.go"))
+	g.Expect(created.Breakpoint.Line).Should(Equal(9))
+
+	executor("c")
+	var state api.CommandOut
+	decode(&state)
+	g.Expect(state.State.Reason).Should(Equal(StopBreakPoint.String()))
+	g.Expect(state.State.Line).Should(Equal(9))
+	g.Expect(state.State.Function).Should(Equal("main.main"))
+
+	executor("bt")
+	var stack api.StacktraceOut
+	decode(&stack)
+	g.Expect(stack.Frames[0].Function).Should(Equal("main.main"))
+	g.Expect(stack.Frames[1].Function).Should(Equal("runtime.main"))
+
+	executor("locals")
+	var locals api.ListLocalsOut
+	decode(&locals)
+	g.Expect(locals.Variables).Should(ContainElement(api.Variable{Name: "sum", Type: "int", Value: "0"}))
+
+	executor("p sum + 1")
+	var eval api.EvalOut
+	decode(&eval)
+	g.Expect(eval.Value).Should(Equal("1"))
+
+	executor("goroutines")
+	var goroutines api.ListGoroutinesOut
+	decode(&goroutines)
+	g.Expect(goroutines.Goroutines[0].Id).Should(Equal(uint64(1)))
+
+	executor("bl")
+	var list api.ListBreakpointsOut
+	decode(&list)
+	g.Expect(list.Breakpoints).Should(Equal([]api.Breakpoint{created.Breakpoint}))
+	executor("bc 1")
+	var cleared api.ClearBreakpointOut
+	decode(&cleared)
+	g.Expect(cleared.Breakpoint.Id).Should(Equal(1))
+
+	// the errors are printed to stderr as json too
+	executor("bc 1")
+	g.Expect(outw.String()).Should(Equal(""))
+	var failed struct{ Error string }
+	g.Expect(json.Unmarshal([]byte(errw.String()), &failed)).Should(BeNil())
+	g.Expect(failed.Error).ShouldNot(BeEmpty())
+	errw.Reset()
+
+	// the commands without json output print the text
+	executor("output text")
+	outw.Reset()
+	executor("p sum")
+	g.Expect(outw.String()).Should(Equal("0\n"))
+
+	lines := make([]string, 0)
+	g.Expect(runCommandLines(strings.NewReader("p sum\n\n  bl \n"), func(line string) { lines = append(lines, line) })).Should(BeNil())
+	g.Expect(lines).Should(Equal([]string{"p sum", "bl"}))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestLog(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	logfile, err := ioutil.TempFile("", "godbg_log")
+	g.Expect(err).Should(BeNil())
+	logfile.Close()
+	defer os.Remove(logfile.Name())
+	defer func() {
+		log.Enable("all", false)
+		log.SetLevel("error")
+		log.SetOutput("stderr")
+	}()
+
+	executor("log")
+	g.Expect(outw.String()).Should(Equal("level = error\ncomponents = \nformat = json\noutput = stderr\n"))
+	outw.Reset()
+	executor("log level verbose")
+	g.Expect(errw.String()).Should(Equal("unknown log level `verbose`, expect error, info, debug or trace\n"))
+	errw.Reset()
+	executor("log enable gc")
+	g.Expect(errw.String()).Should(Equal("unknown log component `gc`, expect dwarf, proc, rpc or all\n"))
+	errw.Reset()
+
+	executor("log level debug")
+	executor("log enable proc,rpc")
+	executor("log output file:" + logfile.Name())
+	executor("log")
+	g.Expect(outw.String()).Should(Equal("level = debug\ncomponents = proc,rpc\nformat = json\noutput = file:" + logfile.Name() + "\n"))
+	outw.Reset()
+
+	// the records of proc are in the file, the dwarf ones at trace are not
+	executor("b ./test_file/t28.go:9")
+	executor("log disable proc")
+	executor("b ./test_file/t28.go:8")
+	log.SetOutput("stderr")
+	content, err := ioutil.ReadFile(logfile.Name())
+	g.Expect(err).Should(BeNil())
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	g.Expect(len(lines)).Should(BeNumerically(">", 0))
+	sets := 0
+	for _, line := range lines {
+		var record map[string]interface{}
+		g.Expect(json.Unmarshal([]byte(line), &record)).Should(BeNil())
+		g.Expect(record["component"]).Should(Equal("proc"))
+		g.Expect(record["lv"]).Should(Or(Equal("debug"), Equal("info")))
+		if record["msg"] == "SetFileLineBreakPoint" {
+			g.Expect(record["lineno"]).Should(Equal(float64(9)))
+			sets++
+		}
+	}
+	g.Expect(sets).Should(Equal(1))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestTraceEntries(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	execfile, err := build(path.Join(dir, "test_file/t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	logfile, err := ioutil.TempFile("", "godbg_log")
+	g.Expect(err).Should(BeNil())
+	logfile.Close()
+	defer os.Remove(logfile.Name())
+	defer func() {
+		log.Enable("all", false)
+		log.SetLevel("error")
+		log.SetOutput("stderr")
+	}()
+
+	// the entries are not logged at debug
+	g.Expect(log.Enable("dwarf", true)).Should(BeNil())
+	g.Expect(log.SetLevel("debug")).Should(BeNil())
+	g.Expect(log.SetOutput("file:" + logfile.Name())).Should(BeNil())
+	logger := log.For("dwarf")
+	g.Expect(log.Tracing(logger)).Should(Equal(false))
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	_, err = parsed.findFunctionByName("main.main")
+	g.Expect(err).Should(BeNil())
+	content, err := ioutil.ReadFile(logfile.Name())
+	g.Expect(err).Should(BeNil())
+	g.Expect(string(content)).ShouldNot(ContainSubstring("TagSubprogram"))
+
+	g.Expect(log.SetLevel("trace")).Should(BeNil())
+	g.Expect(log.Tracing(logger)).Should(Equal(true))
+	parsed, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	_, err = parsed.findFunctionByName("main.main")
+	g.Expect(err).Should(BeNil())
+	log.SetOutput("stderr")
+	content, err = ioutil.ReadFile(logfile.Name())
+	g.Expect(err).Should(BeNil())
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var record map[string]interface{}
+		g.Expect(json.Unmarshal([]byte(line), &record)).Should(BeNil())
+		if record["msg"] == "TagSubprogram" && record["Attr"] == "Name" && record["Val"] == "main.main" {
+			g.Expect(record["Class"]).Should(Equal("ClassString"))
+			found = true
+		}
+	}
+	g.Expect(found).Should(Equal(true))
+}
+
+func TestLogEvents(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	_, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	logfile, err := ioutil.TempFile("", "godbg_log")
+	g.Expect(err).Should(BeNil())
+	logfile.Close()
+	defer os.Remove(logfile.Name())
+	defer func() {
+		log.Enable("all", false)
+		log.SetLevel("error")
+		log.SetFormat("json")
+		log.SetOutput("stderr")
+	}()
+
+	executor("log format yaml")
+	g.Expect(errw.String()).Should(Equal("unknown log format `yaml`, expect json or logfmt\n"))
+	errw.Reset()
+
+	// the events are at info, the other records at debug are not logged
+	executor("log level info")
+	executor("log enable proc")
+	executor("log format logfmt")
+	executor("log output file:" + logfile.Name())
+	executor("b ./test_file/t28.go:9")
+	executor("c")
+	executor("bc 1")
+	executor("c")
+	log.SetOutput("stderr")
+	content, err := ioutil.ReadFile(logfile.Name())
+	g.Expect(err).Should(BeNil())
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	g.Expect(len(lines)).Should(Equal(5))
+	g.Expect(lines[0]).Should(MatchRegexp(`^lv=info component=proc msg=breakpoint.set event=breakpoint.set bp=1 filename=./test_file/t28.go hardware=false lineno=9 pc=0x[0-9a-f]+$`))
+	g.Expect(lines[1]).Should(MatchRegexp(`^lv=info component=proc msg=stop event=stop bp=1 duration=[0-9.e-]+ pc=0x[0-9a-f]+ pid=[0-9]+ reason=breakpoint$`))
+	g.Expect(lines[2]).Should(MatchRegexp(`^lv=info component=proc msg=breakpoint.clear event=breakpoint.clear bp=1 `))
+	g.Expect(lines[3]).Should(MatchRegexp(`^lv=info component=proc msg=exit event=process.exit pid=[0-9]+ reason=exited status=0$`))
+	g.Expect(lines[4]).Should(MatchRegexp(`^lv=info component=proc msg=stop event=stop duration=[0-9.e-]+ pid=[0-9]+ reason=exited status=0$`))
+	g.Expect(errw.String()).Should(MatchRegexp("^Process [0-9]+ has exited with status 0\n$"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestLogRotation(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, err := ioutil.TempDir("", "godbg_log")
+	g.Expect(err).Should(BeNil())
+	defer os.RemoveAll(dir)
+	defer func() {
+		log.Enable("all", false)
+		log.SetLevel("error")
+		log.SetRotation(10<<20, 3)
+		log.SetOutput("stderr")
+	}()
+
+	_, err = log.ParseSize("10X")
+	g.Expect(err).Should(MatchError("invalid size `10X`, expect the bytes or like 512K, 10M or 1G"))
+	size, err := log.ParseSize("512K")
+	g.Expect(err).Should(BeNil())
+	g.Expect(size).Should(Equal(int64(512 << 10)))
+
+	// each record is about 60 bytes, a file keeps 3 of them at most
+	logfile := path.Join(dir, "godbg.log")
+	g.Expect(log.SetRotation(200, 2)).Should(BeNil())
+	g.Expect(log.SetOutput("file:" + logfile)).Should(BeNil())
+	g.Expect(log.Enable("proc", true)).Should(BeNil())
+	g.Expect(log.SetLevel("info")).Should(BeNil())
+	for i := 0; i < 20; i++ {
+		log.Log.Info("rotate", log.Event("rotate"), zap.Int("i", i))
+	}
+	log.SetOutput("stderr")
+
+	files, err := ioutil.ReadDir(dir)
+	g.Expect(err).Should(BeNil())
+	names := make([]string, 0)
+	for _, f := range files {
+		names = append(names, f.Name())
+		g.Expect(f.Size()).Should(BeNumerically("<=", 200))
+	}
+	g.Expect(names).Should(Equal([]string{"godbg.log", "godbg.log.1", "godbg.log.2"}))
+	content, err := ioutil.ReadFile(logfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(string(content)).Should(HaveSuffix(`"i":19}` + "\n"))
+	content, err = ioutil.ReadFile(logfile + ".1")
+	g.Expect(err).Should(BeNil())
+	g.Expect(string(content)).Should(ContainSubstring(`"event":"rotate"`))
+}
+
+func TestTranscript(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	filename := path.Join(os.TempDir(), "godbg_transcript")
+	os.Remove(filename)
+	defer os.Remove(filename)
+
+	executor("transcript")
+	g.Expect(outw.String()).Should(Equal("there is no transcript\n"))
+	outw.Reset()
+	executor("transcript off")
+	g.Expect(errw.String()).Should(Equal("there is no transcript\n"))
+	errw.Reset()
+
+	executor("transcript on " + filename)
+	executor("transcript on " + filename)
+	g.Expect(errw.String()).Should(Equal("the transcript is recorded to " + filename + " already\n"))
+	errw.Reset()
+	executor("transcript")
+	executor("b ./test_file/t28.go:9")
+	executor("c")
+	executor("p sum")
+	executor("p nosuch")
+	executor("transcript off")
+	// the output is printed as before too
+	g.Expect(outw.String()).Should(HavePrefix("transcript = " + filename + "\n"))
+	g.Expect(outw.String()).Should(HaveSuffix("0\n"))
+	executor("p sum")
+
+	content, err := ioutil.ReadFile(filename)
+	g.Expect(err).Should(BeNil())
+	g.Expect(string(content)).Should(HavePrefix("(godbg) transcript on " + filename +
+		"\nthe transcript is recorded to " + filename + " already\n(godbg) transcript\ntranscript = " + filename +
+		"\n(godbg) b ./test_file/t28.go:9\n"))
+	g.Expect(string(content)).Should(ContainSubstring("(godbg) c\n"))
+	g.Expect(string(content)).Should(HaveSuffix("(godbg) p sum\n0\n(godbg) p nosuch\n" + errw.String() +
+		"(godbg) transcript off\n"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestMetrics(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, _ := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("metrics")
+	g.Expect(outw.String()).Should(MatchRegexp(`^operation +count +total +avg +max\nanalyze +1 +\S+ +\S+ +\S+\n` +
+		`strings [1-9][0-9]* interned, [1-9][0-9]* bytes kept, [0-9]+ bytes saved\n` +
+		`units [1-9][0-9]* loaded, [1-9][0-9]* bytes resident, 0 evicted\n$`))
+	outw.Reset()
+	executor("metrics reset")
+	executor("metrics")
+	g.Expect(outw.String()).Should(MatchRegexp(`^there is no metric\nstrings `))
+
+	executor("b ./test_file/t28.go:9")
+	executor("c")
+	executor("bt")
+	executor("p sum")
+	executor("p sum + 1")
+	outw.Reset()
+	executor("metrics")
+	lines := strings.Split(strings.TrimSuffix(outw.String(), "\n"), "\n")
+	g.Expect(len(lines)).Should(Equal(7))
+	g.Expect(lines[1]).Should(MatchRegexp(`^breakpoint +1 `))
+	g.Expect(lines[2]).Should(MatchRegexp(`^eval +2 `))
+	g.Expect(lines[3]).Should(MatchRegexp(`^resume +1 `))
+	g.Expect(lines[4]).Should(MatchRegexp(`^unwind +[1-9][0-9]* `))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestDumpDwarf(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("dump-dwarf info main.main")
+	g.Expect(outw.String()).Should(MatchRegexp(`^<0x[0-9a-f]+> (Tag)?Subprogram\n    (Attr)?Name main.main\n    (Attr)?Lowpc 0x[0-9a-f]+\n`))
+	g.Expect(outw.String()).Should(MatchRegexp(`\n  <0x[0-9a-f]+> (Tag)?Variable\n      (Attr)?Name sum\n`))
+	g.Expect(outw.String()).Should(MatchRegexp(`\n    <0x[0-9a-f]+> (Tag)?Variable\n        (Attr)?Name i\n`))
+	g.Expect(outw.String()).ShouldNot(ContainSubstring("runtime"))
+	outw.Reset()
+
+	f, err := bi.findFunctionByName("main.main")
+	g.Expect(err).Should(BeNil())
+	dir, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	executor("dump-dwarf line main.main")
+	lines := strings.Split(strings.TrimSuffix(outw.String(), "\n"), "\n")
+	g.Expect(lines[0]).Should(Equal("main"))
+	g.Expect(lines[1]).Should(Equal(fmt.Sprintf("    %#x %s:5 stmt", f.lowpc, filepath.Join(dir, "test_file/t28.go"))))
+	g.Expect(lines).Should(ContainElement(MatchRegexp(`^    0x[0-9a-f]+ \S+/test_file/t28.go:9 stmt$`)))
+	for _, line := range lines[1:] {
+		var pc uint64
+		_, err = fmt.Sscanf(line, "    %v", &pc)
+		g.Expect(err).Should(BeNil())
+		g.Expect(pc >= f.lowpc && pc < f.highpc).Should(BeTrue())
+	}
+	outw.Reset()
+
+	executor("dump-dwarf frame main.main")
+	lines = strings.Split(strings.TrimSuffix(outw.String(), "\n"), "\n")
+	g.Expect(lines[0]).Should(MatchRegexp(fmt.Sprintf(`^FDE %#x-0x[0-9a-f]+ main.main length [0-9]+$`, f.lowpc)))
+	g.Expect(lines[1]).Should(Equal("    CIE version 3 code_alignment_factor 1 data_alignment_factor -4 return_address_register 16"))
+	g.Expect(lines[2]).Should(Equal("    DW_CFA_def_cfa_offset_sf 8"))
+	g.Expect(lines).Should(ContainElement(MatchRegexp(`^    DW_CFA_advance_loc1? [0-9]+ to 0x[0-9a-f]+$`)))
+	outw.Reset()
+
+	executor("dump-dwarf line main")
+	g.Expect(outw.String()).Should(HavePrefix("main\n"))
+	g.Expect(outw.String()).Should(ContainSubstring("end_sequence\n"))
+	executor("dump-dwarf info nosuch")
+	g.Expect(errw.String()).Should(Equal("can't find the function or the compile unit `nosuch`\n"))
+	errw.Reset()
+	executor("dump-dwarf foo")
+	g.Expect(errw.String()).Should(Equal("unknown dump-dwarf `foo`, expect info, line or frame\n"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestDisassemble(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t28.go:9")
+	executor("c")
+	outw.Reset()
+	f, err := bi.findFunctionByName("main.main")
+	g.Expect(err).Should(BeNil())
+	pc, err := getPtracePc()
+	g.Expect(err).Should(BeNil())
+
+	executor("disassemble")
+	g.Expect(errw.String()).Should(Equal(""))
+	lines := strings.Split(strings.TrimSuffix(outw.String(), "\n"), "\n")
+	g.Expect(lines[0]).Should(Equal("main.main:"))
+	g.Expect(lines[1]).Should(Equal("test_file/t28.go:5\tfunc main() {"))
+	g.Expect(lines[2]).Should(MatchRegexp(fmt.Sprintf(`^    %#x <\+0> +[0-9a-f]+ +\w+`, f.lowpc)))
+	// the stop is at the breakpoint, the line of the source is before it
+	g.Expect(lines).Should(ContainElement(MatchRegexp(fmt.Sprintf(`^=>\* %#x <\+%d> +[0-9a-f]+ +\w+`, pc, pc-f.lowpc))))
+	g.Expect(outw.String()).Should(ContainSubstring("\ntest_file/t28.go:9\tfmt.Println(sum)\n=>* "))
+	g.Expect(lines).Should(ContainElement(MatchRegexp(`^    0x[0-9a-f]+ <\+\d+> +[0-9a-f]+ +call fmt.Println$`)))
+	g.Expect(lines).Should(ContainElement(MatchRegexp(`^    0x[0-9a-f]+ <\+\d+> +[0-9a-f]+ +j\w+ 0x[0-9a-f]+  ; main.main\+0x[0-9a-f]+$`)))
+	g.Expect(outw.String()).ShouldNot(ContainSubstring("int3"))
+	all := outw.String()
+	outw.Reset()
+
+	executor("disassemble main.main")
+	g.Expect(outw.String()).Should(Equal(all))
+	outw.Reset()
+	executor("disassemble ./test_file/t28.go:8")
+	g.Expect(outw.String()).Should(Equal(all))
+	outw.Reset()
+	executor(fmt.Sprintf("disassemble *%#x", f.lowpc+4))
+	g.Expect(outw.String()).Should(Equal(all))
+	outw.Reset()
+
+	executor(fmt.Sprintf("disassemble -range %#x,%#x", pc, pc+1))
+	g.Expect(outw.String()).Should(MatchRegexp(fmt.Sprintf("^main.main:\ntest_file/t28.go:9\tfmt.Println\\(sum\\)\n=>\\* %#x <\\+%d> ", pc, pc-f.lowpc)))
+	g.Expect(strings.Count(outw.String(), "\n")).Should(Equal(3))
+	executor("disassemble -range 5")
+	g.Expect(errw.String()).Should(Equal("wrong range `5`, expect like 0x4b6300,0x4b6340\n"))
+	errw.Reset()
+	executor("disassemble nosuch")
+	g.Expect(errw.String()).ShouldNot(Equal(""))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestStepInstructionWindow(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t28.go:9")
+	executor("c")
+	outw.Reset()
+
+	// the pc is the first instruction of line 9, the ones of line 8 are before it
+	executor("si")
+	g.Expect(errw.String()).Should(Equal(""))
+	pc, err := getPtracePc()
+	g.Expect(err).Should(BeNil())
+	lines := strings.Split(strings.TrimSuffix(outw.String(), "\n"), "\n")
+	g.Expect(lines[:3]).Should(Equal([]string{fmt.Sprintf("current process pc = %d", pc),
+		"main.main at test_file/t28.go:9", "9:\tfmt.Println(sum)"}))
+	g.Expect(len(lines)).Should(Equal(3 + 2*stepiWindow + 1))
+	g.Expect(lines[3+stepiWindow]).Should(MatchRegexp(fmt.Sprintf(`^===> %d +[0-9a-f]+ +[a-z]+ [^%%]+$`, pc)))
+	for i, line := range lines[3:] {
+		if i != stepiWindow {
+			g.Expect(line).Should(MatchRegexp(`^     \d+ +[0-9a-f]+ +\w+`))
+		}
+	}
+	g.Expect(outw.String()).ShouldNot(ContainSubstring("int3"))
+	outw.Reset()
+
+	executor("set disassemble-flavor att")
+	g.Expect(errw.String()).Should(Equal("disassemble-flavor should be intel or gnu, not att\n"))
+	errw.Reset()
+	executor("set disassemble-flavor gnu")
+	g.Expect(outw.String()).Should(Equal("disassemble-flavor is gnu\n"))
+	outw.Reset()
+	executor("si")
+	lines = strings.Split(strings.TrimSuffix(outw.String(), "\n"), "\n")
+	g.Expect(lines[3+stepiWindow]).Should(MatchRegexp(`^===> \d+ +[0-9a-f]+ +[a-z]+ .*%r[a-z0-9]+`))
+	outw.Reset()
+	executor("disassemble")
+	g.Expect(outw.String()).Should(MatchRegexp(`\n    0x[0-9a-f]+ <\+\d+> +[0-9a-f]+ +callq fmt.Println\n`))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestSections(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, _ := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	elffile, err := elf.Open(execfile)
+	g.Expect(err).Should(BeNil())
+	defer elffile.Close()
+	text := elffile.Section(".text")
+	g.Expect(text).ShouldNot(BeNil())
+
+	sections := bi.Sections()
+	g.Expect(len(sections)).Should(Equal(len(elffile.Sections) - 1))
+	var textSection, infoSection *Section
+	for i := range sections {
+		switch sections[i].Name {
+		case ".text":
+			textSection = &sections[i]
+		case ".debug_info", ".zdebug_info":
+			infoSection = &sections[i]
+		}
+	}
+	g.Expect(textSection).ShouldNot(BeNil())
+	g.Expect(*textSection).Should(Equal(Section{Name: ".text", Addr: text.Addr, Size: text.Size, FileSize: text.FileSize,
+		Flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR}))
+	g.Expect(infoSection).ShouldNot(BeNil())
+	g.Expect(infoSection.Compressed).Should(Equal(infoSection.Flags&elf.SHF_COMPRESSED != 0 || infoSection.Name == ".zdebug_info"))
+	g.Expect(len(bi.Segments())).Should(Equal(len(elffile.Progs)))
+
+	executor("info sections")
+	g.Expect(outw.String()).Should(HavePrefix("Nr   Name                     Address            Size       FileSize   Flags\n1    "))
+	g.Expect(outw.String()).Should(MatchRegexp(fmt.Sprintf(`\n\d+ +\.text +%#x +%#x +%#x +AX\n`, text.Addr, text.Size, text.FileSize)))
+	outw.Reset()
+
+	// the text segment is the loadable one which is executable
+	executor("info segments")
+	g.Expect(outw.String()).Should(HavePrefix("Type           Offset     VirtAddr           MemSize    FileSize   Flags\n"))
+	for _, p := range elffile.Progs {
+		if p.Type == elf.PT_LOAD && p.Flags&elf.PF_X != 0 {
+			g.Expect(outw.String()).Should(MatchRegexp(fmt.Sprintf(`\nLOAD +%#x +%#x +%#x +%#x +R E\n`, p.Off, p.Vaddr, p.Memsz, p.Filesz)))
+		}
+	}
+
+	executor("q")
+	clear_variable()
+}
+
+func TestLazyCompileUnits(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, _ := make_out_err()
+	execfile, err := build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	// the compile unit of main is parsed by the first breakpoint in it
+	mainUnit := findCompileUnitByName("main")
+	g.Expect(mainUnit).ShouldNot(BeNil())
+	g.Expect(mainUnit.loaded).Should(Equal(false))
+	g.Expect(mainUnit.linesLoaded).Should(Equal(false))
+	g.Expect(bi.funcIndex["main.main"]).Should(Equal(mainUnit))
+	dir, _ := os.Getwd()
+	g.Expect(bi.fileIndex[path.Join(dir, "test_file/t28.go")]).Should(Equal([]*CompileUnit{mainUnit}))
+
+	executor("b ./test_file/t28.go:9")
+	g.Expect(mainUnit.linesLoaded).Should(Equal(true))
+	executor("c")
+	executor("p sum")
+	g.Expect(mainUnit.loaded).Should(Equal(true))
+	g.Expect(outw.String()).Should(ContainSubstring("t28.go:9"))
+	g.Expect(outw.String()).Should(HaveSuffix("0\n"))
+
+	unloaded := 0
+	for _, cu := range bi.CompileUnits {
+		if !cu.loaded {
+			unloaded++
+		}
+	}
+	g.Expect(unloaded).Should(BeNumerically(">", 0))
+
+	// the named types are found in whichever unit has them
+	_, ok := bi.typeOffset("runtime.g")
+	g.Expect(ok).Should(Equal(true))
+	executor("q")
+	clear_variable()
+}
+
+func TestParallelCompileUnits(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	execfile, err := build(path.Join(dir, "test_file/t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	// the units merged after the parallel parsing are the same as the ones loaded one by one
+	parallel, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(parallel.loadAll()).Should(BeNil())
+	sequential, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	for _, cu := range sequential.CompileUnits {
+		g.Expect(sequential.loadCompileUnit(cu)).Should(BeNil())
+		g.Expect(sequential.loadLineTable(cu)).Should(BeNil())
+	}
+
+	names := func(b *BI) []string {
+		functions := make([]string, 0, len(b.Functions))
+		for _, f := range b.Functions {
+			functions = append(functions, fmt.Sprintf("%s %#x %s", f.name, f.lowpc, f.cu.name))
+		}
+		return functions
+	}
+	g.Expect(names(parallel)).Should(Equal(names(sequential)))
+	g.Expect(len(parallel.Functions)).Should(BeNumerically(">", 0))
+	g.Expect(parallel.Types).Should(Equal(sequential.Types))
+	g.Expect(parallel.RuntimeTypes).Should(Equal(sequential.RuntimeTypes))
+	g.Expect(len(parallel.PackageVars)).Should(Equal(len(sequential.PackageVars)))
+	g.Expect(len(parallel.Statements)).Should(Equal(len(sequential.Statements)))
+	g.Expect(parallel.Sources).Should(Equal(sequential.Sources))
+	g.Expect(parallel.fileIndex).Should(HaveLen(len(sequential.fileIndex)))
+	f, err := parallel.findFunctionByName("main.main")
+	g.Expect(err).Should(BeNil())
+	g.Expect(f.cu.name).Should(Equal("main"))
+}
+
+func TestFunctionIndex(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	execfile, err := build(path.Join(dir, "test_file/t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(bi.loadAll()).Should(BeNil())
+
+	g.Expect(sort.SliceIsSorted(bi.Functions, func(i, j int) bool { return bi.Functions[i].lowpc < bi.Functions[j].lowpc })).Should(Equal(true))
+	// the binary searches find the functions the scans do
+	for _, f := range bi.Functions {
+		if f.lowpc >= f.highpc {
+			continue
+		}
+		for _, pc := range []uint64{f.lowpc, f.highpc - 1} {
+			found, err := bi.findFunctionIncludePc(pc)
+			g.Expect(err).Should(BeNil())
+			g.Expect(found).Should(Equal(f))
+		}
+		byName, err := bi.findFunctionByName(f.name)
+		g.Expect(err).Should(BeNil())
+		g.Expect(byName.name).Should(Equal(f.name))
+	}
+	_, err = bi.findFunctionIncludePc(0)
+	g.Expect(err).ShouldNot(BeNil())
+	_, err = bi.findFunctionByName("main.nothing")
+	g.Expect(err).ShouldNot(BeNil())
+
+	full := path.Join(dir, "test_file/t28.go")
+	g.Expect(bi.sourcesWithSuffix("t28.go")).Should(Equal([]string{full}))
+	g.Expect(bi.sourcesWithSuffix("test_file/t28.go")).Should(Equal([]string{full}))
+	g.Expect(bi.sourcesWithSuffix("est_file/t28.go")).Should(BeEmpty())
+	g.Expect(resolveSource("test_file/../t28.go")).Should(Equal(full))
+	g.Expect(sort.StringsAreSorted(bi.sourceFiles())).Should(Equal(true))
+	g.Expect(sort.StringsAreSorted(bi.functionNames())).Should(Equal(true))
+	clear_variable()
+}
+
+func TestIndexCache(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	execfile, err := build(path.Join(dir, "test_file/t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	// the go build cache is in XDG_CACHE_HOME too, so it is set after the build
+	cacheDir, err := ioutil.TempDir("", "godbg-cache")
+	g.Expect(err).Should(BeNil())
+	defer os.RemoveAll(cacheDir)
+	g.Expect(os.Setenv("XDG_CACHE_HOME", cacheDir)).Should(BeNil())
+	defer os.Unsetenv("XDG_CACHE_HOME")
+
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	files, err := ioutil.ReadDir(path.Join(cacheDir, "godbg", "index"))
+	g.Expect(err).Should(BeNil())
+	g.Expect(files).Should(HaveLen(1))
+
+	// the same binary is analyzed by the index cached
+	cached, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	mapped, err := mapFile(execfile)
+	g.Expect(err).Should(BeNil())
+	defer mapped.close()
+	fresh := &BI{DwarfData: cached.DwarfData, strings: newStringTable(), funcIndex: make(map[string]*CompileUnit),
+		fileIndex: make(map[string][]*CompileUnit), suffixIndex: make(map[string][]string)}
+	g.Expect(fresh.loadIndexCache(execfile, mapped)).Should(Equal(true))
+	g.Expect(len(cached.CompileUnits)).Should(Equal(len(parsed.CompileUnits)))
+	for i, cu := range cached.CompileUnits {
+		g.Expect(cu.name).Should(Equal(parsed.CompileUnits[i].name))
+		g.Expect(cu.ranges).Should(Equal(parsed.CompileUnits[i].ranges))
+		g.Expect(cu.entry.Offset).Should(Equal(parsed.CompileUnits[i].entry.Offset))
+	}
+	g.Expect(cached.files).Should(Equal(parsed.files))
+	g.Expect(cached.funcNames).Should(Equal(parsed.funcNames))
+	g.Expect(cached.TypesAddr).Should(Equal(parsed.TypesAddr))
+	f, err := cached.findFunctionByName("main.main")
+	g.Expect(err).Should(BeNil())
+	g.Expect(f.cu.name).Should(Equal("main"))
+	pc, err := cached.fileLineToPc(path.Join(dir, "test_file/t28.go"), 9)
+	g.Expect(err).Should(BeNil())
+	parsedPc, _ := parsed.fileLineToPc(path.Join(dir, "test_file/t28.go"), 9)
+	g.Expect(pc).Should(Equal(parsedPc))
+
+	// the binary touched is parsed and cached again
+	later := time.Now().Add(time.Minute)
+	g.Expect(os.Chtimes(execfile, later, later)).Should(BeNil())
+	g.Expect(fresh.loadIndexCache(execfile, mapped)).Should(Equal(false))
+	_, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(fresh.loadIndexCache(execfile, mapped)).Should(Equal(true))
+
+	// the broken cache is ignored
+	cacheFile := path.Join(cacheDir, "godbg", "index", files[0].Name())
+	g.Expect(ioutil.WriteFile(cacheFile, []byte("broken"), 0644)).Should(BeNil())
+	g.Expect(fresh.loadIndexCache(execfile, mapped)).Should(Equal(false))
+	indexCache = false
+	defer func() { indexCache = true }()
+	_, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	data, err := ioutil.ReadFile(cacheFile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(string(data)).Should(Equal("broken"))
+}
+
+func TestMappedSections(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	execfile, err := build(path.Join(dir, "test_file/t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	m, err := mapFile(execfile)
+	g.Expect(err).Should(BeNil())
+	elffile, err := elf.Open(execfile)
+	g.Expect(err).Should(BeNil())
+	defer elffile.Close()
+	// the compressed sections are inflated like Data does, the others are the slices of the mapping
+	for _, name := range []string{".debug_info", ".debug_line", ".debug_frame", ".debug_loclists", ".text"} {
+		s := elffile.Section(name)
+		g.Expect(s).ShouldNot(BeNil())
+		want, err := s.Data()
+		g.Expect(err).Should(BeNil())
+		data, err := m.section(name)
+		g.Expect(err).Should(BeNil())
+		g.Expect(bytes.Equal(data, want)).Should(Equal(true), name)
+	}
+	data, err := m.section(".debug_nothing")
+	g.Expect(err).Should(BeNil())
+	g.Expect(data).Should(BeNil())
+
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(parsed.LocLists).Should(BeNil())
+	want, _ := elffile.Section(".debug_loclists").Data()
+	g.Expect(bytes.Equal(parsed.locLists(), want)).Should(Equal(true))
+	sum, err := fileChecksum(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(parsed.Checksum).Should(Equal(sum))
+}
+
+func TestInternStrings(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	table := newStringTable()
+	a := table.intern("/usr/lib/go/src/runtime/proc.go")
+	b := table.intern(string([]byte("/usr/lib/go/src/runtime/proc.go")))
+	g.Expect(b).Should(Equal(a))
+	table.intern("main.main")
+	g.Expect(len(table.strings)).Should(Equal(2))
+	g.Expect(table.bytes).Should(Equal(len(a) + len("main.main")))
+	g.Expect(table.saved).Should(Equal(len(a)))
+
+	dir, _ := os.Getwd()
+	execfile, err := build(path.Join(dir, "test_file/t28.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(parsed.loadAll()).Should(BeNil())
+	// the files of the line tables and the names of the functions are the same ones kept by the table
+	g.Expect(parsed.strings.saved).Should(BeNumerically(">", 0))
+	for _, file := range parsed.files {
+		g.Expect(parsed.strings.strings).Should(HaveKey(file))
+	}
+	for file := range parsed.Sources {
+		g.Expect(parsed.strings.strings).Should(HaveKey(file))
+	}
+	for _, f := range parsed.Functions {
+		g.Expect(parsed.strings.strings).Should(HaveKey(f.name))
+	}
+}
+
+func TestBinaryChanged(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	source := "./test_file/changed_rebuild.go"
+	code := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n}\n"
+	g.Expect(ioutil.WriteFile(source, []byte(code), 0644)).Should(BeNil())
+	defer os.Remove(source)
+	execfile, err := build(source)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(parsed.buildID).ShouldNot(Equal(""))
+	changed, err := parsed.changed(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(changed).Should(Equal(false))
+
+	// the file touched has the same build ID
+	later := time.Now().Add(time.Minute)
+	g.Expect(os.Chtimes(execfile, later, later)).Should(BeNil())
+	changed, err = parsed.changed(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(changed).Should(Equal(false))
+
+	code = strings.Replace(code, "Println(1)", "Println(2)", 1)
+	g.Expect(ioutil.WriteFile(source, []byte(code), 0644)).Should(BeNil())
+	// each build has a binary of its own
+	rebuilt, err := build(source)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(rebuilt)
+	g.Expect(rebuilt).ShouldNot(Equal(execfile))
+	changed, err = parsed.changed(rebuilt)
+	g.Expect(err).Should(BeNil())
+	g.Expect(changed).Should(Equal(true))
+
+	// without the build ID the checksum tells it
+	parsed.buildID = ""
+	changed, err = parsed.changed(rebuilt)
+	g.Expect(err).Should(BeNil())
+	g.Expect(changed).Should(Equal(true))
+	reloaded, err := analyze(rebuilt)
+	g.Expect(err).Should(BeNil())
+	reloaded.buildID = ""
+	g.Expect(os.Chtimes(rebuilt, later, later)).Should(BeNil())
+	changed, err = reloaded.changed(rebuilt)
+	g.Expect(err).Should(BeNil())
+	g.Expect(changed).Should(Equal(false))
+}
+
+func TestProfile(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	profile, err := ioutil.TempFile("", "godbg_cpu")
+	g.Expect(err).Should(BeNil())
+	profile.Close()
+	defer os.Remove(profile.Name())
+
+	g.Expect(startProfile(profile.Name())).Should(BeNil())
+	// the cpu is profiled once at a time
+	g.Expect(startProfile(profile.Name() + ".2")).ShouldNot(BeNil())
+	os.Remove(profile.Name() + ".2")
+	execfile, err := build("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	_, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	stopProfile()
+	stopProfile()
+	content, err := ioutil.ReadFile(profile.Name())
+	g.Expect(err).Should(BeNil())
+	// the profile is a gzipped protobuf
+	g.Expect(len(content)).Should(BeNumerically(">", 2))
+	g.Expect(content[:2]).Should(Equal([]byte{0x1f, 0x8b}))
+}
+
+// benchBinary builds godbg itself, which is the large binary of the benchmarks, the caller removes it
+func benchBinary(b *testing.B) string {
+	dir, _ := os.Getwd()
+	execfile, err := build(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return execfile
+}
+
+func BenchmarkAnalyze(b *testing.B) {
+	execfile := benchBinary(b)
+	defer os.Remove(execfile)
+	indexCache = false
+	defer func() { indexCache = true }()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := analyze(execfile); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAnalyzeCached(b *testing.B) {
+	execfile := benchBinary(b)
+	defer os.Remove(execfile)
+	cacheDir, err := ioutil.TempDir("", "godbg-cache")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	os.Setenv("XDG_CACHE_HOME", cacheDir)
+	defer os.Unsetenv("XDG_CACHE_HOME")
+	// the first one saves the index
+	if _, err = analyze(execfile); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = analyze(execfile); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadAll(b *testing.B) {
+	execfile := benchBinary(b)
+	defer os.Remove(execfile)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		parsed, err := analyze(execfile)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		if err = parsed.loadAll(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFindLocation resolves the locations of the breakpoints in a binary analyzed, so the compile units
+// are loaded on the first lookup only
+func BenchmarkFindLocation(b *testing.B) {
+	execfile := benchBinary(b)
+	defer os.Remove(execfile)
+	parsed, err := analyze(execfile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	f, err := parsed.findFunctionByName("main.analyze")
+	if err != nil {
+		b.Fatal(err)
+	}
+	pc := parsed.firstPcAfterPrologue(f)
+	filename, lineno, err := parsed.pcTofileLine(pc)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("function", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := parsed.findFunctionByName("main.analyze"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("fileline", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := parsed.fileLineToPcForBreakPoint(filename, lineno); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("pc", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := parsed.pcTofileLine(pc); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDwarfBudget(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	source := path.Join(dir, "test_file/t28.go")
+	execfile, err := build(source)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	full, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	wantPc, err := full.fileLineToPc(source, 9)
+	g.Expect(err).Should(BeNil())
+	// the functions in assembly have no entries in .debug_info
+	names := make([]string, 0)
+	for i, name := range full.funcNames {
+		if _, err = full.findFunctionByName(name); err == nil && i%20 == 0 {
+			names = append(names, name)
+		}
+	}
+	defer func() { dwarfBudget = 0 }()
+
+	n, err := SetDwarfBudget("256K")
+	g.Expect(err).Should(BeNil())
+	g.Expect(n).Should(Equal(int64(256 << 10)))
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	_, err = parsed.findFunctionByName("main.main")
+	g.Expect(err).Should(BeNil())
+	main := parsed.funcIndex["main.main"]
+	// the units looked up after main push it out
+	for _, name := range names {
+		f, err := parsed.findFunctionByName(name)
+		g.Expect(err).Should(BeNil())
+		g.Expect(f.name).Should(Equal(name))
+		loaded := 0
+		for _, cu := range parsed.CompileUnits {
+			if cu.loaded || cu.linesLoaded {
+				loaded++
+			}
+		}
+		// the unit just loaded is kept even if it is larger than the budget alone
+		g.Expect(parsed.resident <= dwarfBudget || loaded == 1).Should(Equal(true))
+	}
+	g.Expect(parsed.evictions).Should(BeNumerically(">", 0))
+	g.Expect(main.loaded).Should(Equal(false))
+	for _, f := range parsed.Functions {
+		g.Expect(f.cu.loaded).Should(Equal(true))
+	}
+	g.Expect(sort.SliceIsSorted(parsed.Functions, func(i, j int) bool {
+		return parsed.Functions[i].lowpc < parsed.Functions[j].lowpc
+	})).Should(Equal(true))
+
+	// the unit dropped is parsed again on demand
+	pc, err := parsed.fileLineToPc(source, 9)
+	g.Expect(err).Should(BeNil())
+	g.Expect(pc).Should(Equal(wantPc))
+	g.Expect(main.linesLoaded).Should(Equal(true))
+	f, err := parsed.findFunctionIncludePc(pc)
+	g.Expect(err).Should(BeNil())
+	g.Expect(f.name).Should(Equal("main.main"))
+
+	// no budget keeps all of them
+	_, err = SetDwarfBudget("0")
+	g.Expect(err).Should(BeNil())
+	evictions := parsed.evictions
+	for _, name := range names {
+		_, err = parsed.findFunctionByName(name)
+		g.Expect(err).Should(BeNil())
+	}
+	g.Expect(parsed.evictions).Should(Equal(evictions))
+	_, err = SetDwarfBudget("12X")
+	g.Expect(err).Should(MatchError("the value of max-dwarf-memory should be a size like 512M or 0, not `12X`"))
+
+	outw, errw := make_out_err()
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	executor("config max-dwarf-memory 1M")
+	g.Expect(outw.String()).Should(Equal("max-dwarf-memory = 1M\n"))
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("b ./test_file/t28.go:9")
+	executor("c")
+	outw.Reset()
+	executor("p sum")
+	g.Expect(outw.String()).Should(Equal("0\n"))
+	executor("bt")
+	g.Expect(outw.String()).Should(ContainSubstring("main.main"))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("q")
+	clear_variable()
+}
+
+// partialUnitsDwarf builds the debug info of a partial unit with the function p.f, which is imported by the
+// compile unit main with main.main, and by a broken import at importOffset
+func partialUnitsDwarf(importOffset uint32) (*dwarf.Data, error) {
+	abbrev := []byte{
+		1, 0x3c, 1, 0, 0, // DW_TAG_partial_unit with children
+		2, 0x2e, 0, 0x03, 0x08, 0x11, 0x01, 0x12, 0x06, 0, 0, // DW_TAG_subprogram name, low_pc and high_pc
+		3, 0x11, 1, 0x03, 0x08, 0, 0, // DW_TAG_compile_unit with children and name
+		4, 0x3d, 0, 0x18, 0x10, 0, 0, // DW_TAG_imported_unit import by ref_addr
+		0,
+	}
+	function := func(name string, lowpc uint64, size uint32) []byte {
+		die := append([]byte{2}, append([]byte(name), 0)...)
+		die = append(die, make([]byte, 12)...)
+		binary.LittleEndian.PutUint64(die[len(die)-12:], lowpc)
+		binary.LittleEndian.PutUint32(die[len(die)-4:], size)
+		return die
+	}
+	imported := func(off uint32) []byte {
+		die := []byte{4, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(die[1:], off)
+		return die
+	}
+	unit := func(dies []byte) []byte {
+		header := make([]byte, 11)
+		binary.LittleEndian.PutUint32(header, uint32(7+len(dies)))
+		binary.LittleEndian.PutUint16(header[4:], 4)
+		header[10] = 8
+		return append(header, dies...)
+	}
+	// the entry of the partial unit is at 11, after the header of its unit
+	partial := unit(append(append([]byte{1}, function("p.f", 0x1000, 0x10)...), 0))
+	main := append([]byte{3}, append([]byte("main"), 0)...)
+	main = append(main, imported(11)...)
+	main = append(main, imported(11)...)
+	main = append(main, imported(importOffset)...)
+	main = append(main, function("main.main", 0x2000, 0x20)...)
+	info := append(partial, unit(append(main, 0))...)
+	return dwarf.New(abbrev, nil, nil, info, nil, nil, nil, nil)
+}
+
+func TestPartialUnits(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	// the broken import refers to the compile unit itself
+	dwarfData, err := partialUnitsDwarf(41)
+	g.Expect(err).Should(BeNil())
+	parsed := &BI{DwarfData: dwarfData, funcIndex: make(map[string]*CompileUnit),
+		fileIndex: make(map[string][]*CompileUnit), suffixIndex: make(map[string][]string),
+		functionsByName: make(map[string]*Function), PackageVars: make(map[string]*PackageVar),
+		Types: make(map[string]dwarf.Offset), RuntimeTypes: make(map[uint64]dwarf.Offset), strings: newStringTable()}
+	g.Expect(parsed.ParseLineAndInfoSection(context.Background(), dwarfData, nil)).Should(BeNil())
+	// the partial unit is not a compile unit on its own
+	g.Expect(parsed.CompileUnits).Should(HaveLen(1))
+	cu := parsed.CompileUnits[0]
+	g.Expect(cu.name).Should(Equal("main"))
+	g.Expect(cu.entry.Offset).Should(Equal(dwarf.Offset(41)))
+
+	g.Expect(parsed.loadCompileUnit(cu)).Should(BeNil())
+	names := make([]string, 0)
+	for _, f := range cu.functions {
+		names = append(names, f.name)
+		g.Expect(f.cu).Should(Equal(cu))
+	}
+	// the partial unit imported twice is parsed once
+	g.Expect(names).Should(Equal([]string{"p.f", "main.main"}))
+	f, err := parsed.findFunctionByName("p.f")
+	g.Expect(err).Should(BeNil())
+	g.Expect(f.highpc).Should(Equal(uint64(0x1010)))
+
+	// the import out of the units is skipped too
+	dwarfData, err = partialUnitsDwarf(0x7ffff)
+	g.Expect(err).Should(BeNil())
+	r := dwarfData.Reader()
+	r.Seek(41)
+	entry, err := r.Next()
+	g.Expect(err).Should(BeNil())
+	unit, err := parseCompileUnit(dwarfData, newCompileUnit(entry))
+	g.Expect(err).Should(BeNil())
+	g.Expect(unit.functions).Should(HaveLen(2))
+}
+
+func TestAnalyzeContext(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	execfile, err := build("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	indexCache = false
+	defer func() { indexCache = true }()
+
+	// progress is told every unit in order
+	dones := make([]int, 0)
+	parsed, err := analyzeContext(context.Background(), execfile, func(done int, total int) {
+		g.Expect(total).Should(BeNumerically(">", 0))
+		dones = append(dones, done)
+	})
+	g.Expect(err).Should(BeNil())
+	g.Expect(len(dones)).Should(Equal(len(parsed.CompileUnits)))
+	for i, done := range dones {
+		g.Expect(done).Should(Equal(i + 1))
+	}
+	percents := make([]int, 0)
+	progress := everyPercent(func(done int, total int, percent int) { percents = append(percents, percent) })
+	for i := 0; i <= 1000; i++ {
+		progress(i, 1000)
+	}
+	g.Expect(percents).Should(HaveLen(101))
+	g.Expect(percents[100]).Should(Equal(100))
+
+	// canceling stops parsing the units
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err = analyzeContext(ctx, execfile, func(done int, total int) {
+		calls++
+		if done == 3 {
+			cancel()
+		}
+	})
+	g.Expect(err).Should(Equal(context.Canceled))
+	g.Expect(calls).Should(BeNumerically("<", len(parsed.CompileUnits)))
+	_, err = analyzeContext(ctx, execfile, nil)
+	g.Expect(err).Should(Equal(context.Canceled))
+}
+
+func TestBinInfoClose(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	execfile, err := build("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	full, _ := filepath.Abs(execfile)
+	mapped := func() bool {
+		maps, err := ioutil.ReadFile("/proc/self/maps")
+		g.Expect(err).Should(BeNil())
+		return strings.Contains(string(maps), full+"\n")
+	}
+
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(mapped()).Should(BeTrue())
+	g.Expect(parsed.Close()).Should(BeNil())
+	g.Expect(mapped()).Should(BeFalse())
+	g.Expect(parsed.Close()).Should(BeNil())
+
+	// the mapping is released if analyzing fails
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = analyzeContext(ctx, execfile, nil)
+	g.Expect(err).Should(Equal(context.Canceled))
+	g.Expect(mapped()).Should(BeFalse())
+
+	// replacing the binary closes the old one, ending the session closes the last one
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	old := bi
+	parsed, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	replaceBi(parsed)
+	g.Expect(old.file).Should(BeNil())
+	g.Expect(mapped()).Should(BeTrue())
+	g.Expect(releaseDebuggee()).Should(BeNil())
+	g.Expect(bi).Should(BeNil())
+	g.Expect(mapped()).Should(BeFalse())
+	clear_variable()
+}
+
+func TestConcurrentLookups(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, _ := os.Getwd()
+	source := path.Join(dir, "test_file/t28.go")
+	execfile, err := build(source)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	full, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	wantPc, err := full.fileLineToPc(source, 9)
+	g.Expect(err).Should(BeNil())
+	names := make([]string, 0)
+	for i, name := range full.funcNames {
+		if _, err = full.findFunctionByName(name); err == nil && i%50 == 0 {
+			names = append(names, name)
+		}
+	}
+
+	// the lookups load and drop the units at the same time within the budget, they find what one goroutine finds
+	defer func() { dwarfBudget = 0 }()
+	_, err = SetDwarfBudget("256K")
+	g.Expect(err).Should(BeNil())
+	parsed, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(names); i += 4 {
+				f, err := parsed.findFunctionByName(names[i])
+				if err == nil && f.name != names[i] {
+					err = fmt.Errorf("find %s by %s", f.name, names[i])
+				}
+				if err == nil {
+					_, _, err = parsed.pcTofileLine(f.lowpc)
+				}
+				if err == nil {
+					var pc uint64
+					if pc, err = parsed.fileLineToPc(source, 9); err == nil && pc != wantPc {
+						err = fmt.Errorf("find %#x by %s:9", pc, source)
+					}
+				}
+				if err == nil {
+					_, err = parsed.structType("runtime.g")
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		g.Expect(err).Should(BeNil())
+	}
+	g.Expect(parsed.evictions).Should(BeNumerically(">", 0))
+	clear_variable()
+}
+
+func TestGoVersion(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	for _, c := range []struct {
+		s     string
+		raw   string
+		minor int
+		patch int
+		abi0  bool
+	}{
+		{"go1.22.3", "go1.22.3", 22, 3, false},
+		{"go1.16.15", "go1.16.15", 16, 15, true},
+		{"go1.21rc2", "go1.21rc2", 21, 0, false},
+		{"devel go1.23-abcdef Mon Jan 1 00:00:00 2024", "go1.23-abcdef", 23, 0, false},
+		{"Go cmd/compile go1.27.1; -l regabi", "go1.27.1", 27, 1, false},
+	} {
+		v, ok := parseGoVersion(c.s)
+		g.Expect(ok).Should(BeTrue())
+		g.Expect(v).Should(Equal(goVersion{major: 1, minor: c.minor, patch: c.patch, raw: c.raw, abi0: c.abi0}))
+	}
+	_, ok := parseGoVersion("gccgo")
+	g.Expect(ok).Should(BeFalse())
+	// the unknown version takes the layouts of the newest go
+	g.Expect(goVersion{}.before(1, 20)).Should(BeFalse())
+	g.Expect(goVersion{}.swissMap()).Should(BeTrue())
+	old, _ := parseGoVersion("go1.10.8")
+	g.Expect(old.before(1, 12)).Should(BeTrue())
+	g.Expect(old.swissMap()).Should(BeFalse())
+	g.Expect((&BI{goVersion: old}).checkGoVersion()).Should(MatchError("the binary is built by go1.10.8, godbg supports go1.12 and newer"))
+
+	// the arguments of ABI0 are above the cfa
+	pieces, err := evalLocation([]byte{DW_OP_call_frame_cfa, DW_OP_consts, 0x10, DW_OP_plus}, &Stackframe{cfa: 0x1000}, 8)
+	g.Expect(err).Should(BeNil())
+	g.Expect(pieces).Should(Equal([]piece{{addr: 0x1010, size: 8}}))
+
+	// runtime.buildVersion is saved in the index cache, the producers tell it without the symbol
+	execfile, err := build("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	cacheDir, err := ioutil.TempDir("", "godbg-cache")
+	g.Expect(err).Should(BeNil())
+	defer os.RemoveAll(cacheDir)
+	g.Expect(os.Setenv("XDG_CACHE_HOME", cacheDir)).Should(BeNil())
+	defer os.Unsetenv("XDG_CACHE_HOME")
+	want, _ := parseGoVersion(runtime.Version())
+	for i := 0; i < 2; i++ {
+		parsed, err := analyze(execfile)
+		g.Expect(err).Should(BeNil())
+		g.Expect(parsed.buildVersion).Should(Equal(runtime.Version()))
+		g.Expect(parsed.goVersion).Should(Equal(want))
+		parsed.buildVersion = ""
+		parsed.detectGoVersion()
+		g.Expect(parsed.goVersion).Should(Equal(want))
+	}
+	os.Unsetenv("XDG_CACHE_HOME")
+
+	outw, errw := make_out_err()
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	outw.Reset()
+	executor("info version")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal(runtime.Version() + ", the arguments by ABIInternal, the maps are swiss\n"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestBuildTest(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	args := os.Args
+	os.Args = []string{"godbg", "test", "./test_file/t34", "--", "-test.run", "TestSum"}
+	pkg, testArgs, err := parseTestArgs()
+	g.Expect(err).Should(BeNil())
+	g.Expect(pkg).Should(Equal("./test_file/t34"))
+	g.Expect(testArgs).Should(Equal([]string{"-test.run", "TestSum"}))
+	os.Args = []string{"godbg", "test"}
+	pkg, testArgs, err = parseTestArgs()
+	g.Expect(err).Should(BeNil())
+	g.Expect(pkg).Should(Equal("."))
+	g.Expect(testArgs).Should(BeNil())
+	os.Args = args
+
+	_, err = buildTest("./api")
+	g.Expect(err).Should(MatchError("no test files in ./api"))
+
+	g.Expect(os.Setenv("GODBG_TEST", "true")).Should(BeNil())
+	outw, errw := make_out_err()
+	execfile, err := buildTest("./test_file/t34")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	cmd, err = runexec(execfile, []string{"-test.run", "TestSum"})
+	g.Expect(err).Should(BeNil())
+
+	executor("b ./test_file/t34/sum_test.go:7")
+	executor("c")
+	executor("p got")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HaveSuffix("\n6\n"))
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp(`Process \d+ has exited with status 0\n$`))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestExecArgs(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	args := os.Args
+	defer func() { os.Args = args }()
+	// the flags after `--` are of the program
+	os.Args = []string{"godbg", "exec", "./go.mod", "--headless", "-x", "a", "--", "-x", "b", "--headless", "c"}
+	headless, _ := parseHeadless()
+	g.Expect(headless).Should(Equal(true))
+	g.Expect(parseCommandFiles()).Should(Equal([]string{"a"}))
+	g.Expect(os.Args).Should(Equal([]string{"godbg", "exec", "./go.mod", "--", "-x", "b", "--headless", "c"}))
+	g.Expect(checkArgs()).Should(BeNil())
+
+	os.Args = []string{"godbg", "exec", "./go.mod", "-flag1"}
+	g.Expect(checkArgs()).Should(MatchError("please input the args of the program after `--`"))
+	os.Args = []string{"godbg", "exec", "./nosuch"}
+	g.Expect(checkArgs()).ShouldNot(BeNil())
+}
+
+func TestCommandFiles(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	args := os.Args
+	os.Args = []string{"godbg", "--init", "a", "debug", "-x", "b", "--init=c", "main.go", "-x", "d"}
+	files := parseCommandFiles()
+	g.Expect(files).Should(Equal([]string{"c", "b"}))
+	g.Expect(os.Args).Should(Equal([]string{"godbg", "debug", "main.go", "-x", "d"}))
+	os.Args = args
+
+	outw, errw := make_out_err()
+	execfile, err = build_run_debug("./test_file/t28.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	commands, err := ioutil.TempFile("", "godbg-*.txt")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(commands.Name())
+	_, err = commands.WriteString("# stop at the second sum\nb ./test_file/t28.go:9\n\n  cond 1 sum > 0\nc\np sum\n")
+	g.Expect(err).Should(BeNil())
+	g.Expect(commands.Close()).Should(BeNil())
+
+	g.Expect(SourceCommands(commands.Name())).Should(BeNil())
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HavePrefix("godbg add ./test_file/t28.go:9 breakpoint successfully\n"))
+	g.Expect(outw.String()).Should(HaveSuffix("\n1\n"))
+	executor("source ./test_file/nosuch.txt")
+	g.Expect(errw.String()).Should(ContainSubstring("no such file or directory"))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestTrace(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	outw, errw := make_out_err()
+	g.Expect(traceMain([]string{"./test_file/t32.go", "^main\\.nosuch$"})).Should(MatchError("no function matches ^main\\.nosuch$"))
+	clear_variable()
+
+	outw, errw = make_out_err()
+	g.Expect(traceMain([]string{"--exit", "./test_file/t32.go", "^main\\.(add|fib)$"})).Should(BeNil())
+	lines := strings.Split(strings.TrimSuffix(outw.String(), "\n"), "\n")
+	g.Expect(lines[0]).Should(Equal("trace 2 functions matching ^main\\.(add|fib)$"))
+	g.Expect(lines[1]).Should(MatchRegexp(`^trace \d main\.fib\(n int = 3\) goroutine 1 at test_file/t32\.go:9$`))
+	g.Expect(lines[2]).Should(MatchRegexp(`^trace \d main\.fib\(n int = 2\) goroutine 1 at test_file/t32\.go:9$`))
+	g.Expect(lines[3]).Should(MatchRegexp(`^trace \d main\.fib\(n int = 1\) goroutine 1 at test_file/t32\.go:9$`))
+	g.Expect(lines[4]).Should(MatchRegexp(`^trace \d main\.fib returns goroutine 1 after \S+$`))
+	calls, returns := 0, 0
+	for _, line := range lines[1:] {
+		if strings.Contains(line, " returns ") {
+			returns++
+		} else {
+			calls++
+		}
+	}
+	// fib is called 5 times and add twice
+	g.Expect(calls).Should(Equal(7))
+	g.Expect(returns).Should(Equal(7))
+	g.Expect(lines[len(lines)-1]).Should(MatchRegexp(`^trace \d main\.fib returns goroutine 1 after \S+$`))
+	g.Expect(errw.String()).Should(MatchRegexp(`Process \d+ has exited with status 0\n$`))
+	clear_variable()
+}
+
+func TestCore(t *testing.T) {
+	var (
+		g = NewGomegaWithT(t)
+	)
+	dir, err := ioutil.TempDir("", "godbg-core")
+	g.Expect(err).Should(BeNil())
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	execfile, err := build(path.Join(wd, "test_file/t33.go"))
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	// the kernel dumps the core into the working directory of the crashing process by the default core_pattern
+	var limit syscall.Rlimit
+	g.Expect(syscall.Getrlimit(syscall.RLIMIT_CORE, &limit)).Should(BeNil())
+	g.Expect(syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: limit.Max, Max: limit.Max})).Should(BeNil())
+	crash := exec.Command(execfile)
+	crash.Dir, crash.Env = dir, append(os.Environ(), "GOTRACEBACK=crash")
+	crash.Run()
+	g.Expect(syscall.Setrlimit(syscall.RLIMIT_CORE, &limit)).Should(BeNil())
+	cores, _ := filepath.Glob(path.Join(dir, "core*"))
+	if len(cores) == 0 {
+		t.Skip("no core file is dumped, see /proc/sys/kernel/core_pattern")
+	}
+
+	g.Expect(os.Setenv("GODBG_TEST", "true")).Should(BeNil())
+	outw, errw := make_out_err()
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	cmd, err = openCore(execfile, cores[0])
+	g.Expect(err).Should(BeNil())
+	g.Expect(core.signal).Should(Equal(syscall.SIGABRT))
+
+	executor("goroutine 1")
+	outw.Reset()
+	executor("bt")
+	g.Expect(errw.String()).Should(Equal(""))
+	// the signal frame is unwound to the goroutine panicking
+	g.Expect(outw.String()).Should(MatchRegexp(`runtime\.sigtramp bp \d+\n(.*\n)*#\d+\s+pc \d+ \S+/test_file/t33\.go:12 main\.crash bp \d+\n#\d+\s+pc \d+ \S+/test_file/t33\.go:16 main\.main `))
+	crashFrame := regexp.MustCompile(`#(\d+)\s+pc \d+ \S+/test_file/t33\.go:12 main\.crash`).FindStringSubmatch(outw.String())
+	executor("frame " + crashFrame[1])
+	outw.Reset()
+	executor("p p")
+	executor("p names")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("{x: 3, y: 4}\n[\"a\", \"b\"]\n"))
+
+	executor("set p.x = 1")
+	executor("c")
+	executor("b ./test_file/t33.go:16")
+	g.Expect(errw.String()).Should(Equal(strings.Repeat(CoreReadOnlyErr.Error()+"\n", 3)))
+
+	executor("q")
+	g.Expect(core).Should(BeNil())
+	clear_variable()
+}
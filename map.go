@@ -0,0 +1,311 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"strings"
+)
+
+// mapEntry is the places of a key and its element in a map
+type mapEntry struct {
+	key uint64
+	keyType dwarf.Type
+	elem uint64
+	elemType dwarf.Type
+}
+
+// walkMap visits the entries of a swiss map of the type td at word until visit returns false, the maps of the older go are walked by walkHmap. The map is *map<K,V> { used; seed; dirPtr; dirLen;
+// ... }, dirPtr is a group if dirLen is 0, otherwise dirLen pointers to the tables, whose groups are at
+// groups.data. A group is { ctrl; slots [8]struct { key; elem } }, the slot i is full if the bit 7 of the
+// byte i of ctrl is clear
+func walkMap(td *dwarf.TypedefType, word uint64, visit func(*mapEntry) bool) error {
+	if !bi.goVersion.swissMap() {
+		return walkHmap(td, word, visit)
+	}
+	m, ok := derefStructType(td.Type, 1)
+	if !ok {
+		return fmt.Errorf("not support the map layout %s", td.Type.String())
+	}
+	mem := make([]byte, m.Size())
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(word), mem); err != nil {
+		return err
+	}
+	dirPtr, err := readField(m, mem, "dirPtr")
+	if err != nil {
+		return err
+	}
+	dirLen, err := readField(m, mem, "dirLen")
+	if err != nil {
+		return err
+	}
+	// the small map made empty has no group until the first entry is put
+	if dirPtr == 0 {
+		return nil
+	}
+	// **table<K,V>, the groups of a table are *group<K,V>
+	_, dirType, _ := fieldOffset(m, "dirPtr")
+	table, ok := derefStructType(dirType, 2)
+	if !ok {
+		return fmt.Errorf("not support the map layout %s", m.StructName)
+	}
+	groupsOff, groupsType, err := fieldOffset(table, "groups")
+	if err != nil {
+		return err
+	}
+	groups, ok := resolveType(groupsType).(*dwarf.StructType)
+	if !ok {
+		return fmt.Errorf("not support the map layout %s", table.StructName)
+	}
+	_, dataType, err := fieldOffset(groups, "data")
+	if err != nil {
+		return err
+	}
+	group, ok := derefStructType(dataType, 1)
+	if !ok {
+		return fmt.Errorf("not support the map layout %s", groups.StructName)
+	}
+	slotsOff, slotsType, err := fieldOffset(group, "slots")
+	if err != nil {
+		return err
+	}
+	slots, ok := resolveType(slotsType).(*dwarf.ArrayType)
+	if !ok {
+		return fmt.Errorf("not support the map layout %s", group.StructName)
+	}
+	slot, ok := resolveType(slots.Type).(*dwarf.StructType)
+	if !ok || len(slot.Field) != 2 {
+		return fmt.Errorf("not support the map layout %s", group.StructName)
+	}
+
+	// the addresses and the numbers of the groups
+	type groupArray struct {
+		addr uint64
+		n uint64
+	}
+	arrays := []groupArray{{dirPtr, 1}}
+	if dirLen > 0 {
+		arrays = arrays[:0]
+		seen := make(map[uint64]bool)
+		for i := uint64(0); i < dirLen; i++ {
+			t, err := readWord(dirPtr + i * 8)
+			if err != nil {
+				return err
+			}
+			// the directory repeats the tables whose local depths are less than the global one
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			ref := make([]byte, 16)
+			if _, err = ptracePeekData(cmd.Process.Pid, uintptr(t + uint64(groupsOff)), ref); err != nil {
+				return err
+			}
+			arrays = append(arrays, groupArray{binary.LittleEndian.Uint64(ref), binary.LittleEndian.Uint64(ref[8:]) + 1})
+		}
+	}
+
+	k, v := slot.Field[0], slot.Field[1]
+	for _, a := range arrays {
+		for g := uint64(0); g < a.n; g++ {
+			addr := a.addr + g * uint64(group.Size())
+			ctrl, err := readWord(addr)
+			if err != nil {
+				return err
+			}
+			for i := int64(0); i < slots.Count; i++ {
+				if ctrl >> uint(i * 8) & 0x80 != 0 {
+					continue
+				}
+				s := addr + uint64(slotsOff) + uint64(i * slot.Size())
+				if !visit(&mapEntry{key: s + uint64(k.ByteOffset), keyType: k.Type,
+					elem: s + uint64(v.ByteOffset), elemType: v.Type}) {
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	// the tophash of the slots below minTopHash are empty or evacuated to the new buckets
+	minTopHash = 5
+	// sameSizeGrow of hmap.flags tells oldbuckets are as many as buckets
+	sameSizeGrow = 8
+)
+
+// walkHmap visits the entries of a map of the go before the swiss tables. The map is *hash<K,V> { count; flags; B; ...;
+// buckets; oldbuckets; ... }, there are 1<<B buckets, and half of them in oldbuckets while growing. A bucket is
+// { tophash [8]uint8; keys [8]K; values [8]V; overflow *bucket<K,V> }, the slot i is full if tophash[i] is
+// minTopHash or more
+func walkHmap(td *dwarf.TypedefType, word uint64, visit func(*mapEntry) bool) error {
+	h, ok := derefStructType(td.Type, 1)
+	if !ok {
+		return fmt.Errorf("not support the map layout %s", td.Type.String())
+	}
+	mem := make([]byte, h.Size())
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(word), mem); err != nil {
+		return err
+	}
+	header := make(map[string]uint64)
+	for _, name := range []string{"flags", "B", "buckets", "oldbuckets"} {
+		v, err := readField(h, mem, name)
+		if err != nil {
+			return err
+		}
+		header[name] = v
+	}
+	_, bucketsType, _ := fieldOffset(h, "buckets")
+	bucket, ok := derefStructType(bucketsType, 1)
+	if !ok {
+		return fmt.Errorf("not support the map layout %s", h.StructName)
+	}
+	keysOff, keysType, err := fieldOffset(bucket, "keys")
+	if err != nil {
+		return err
+	}
+	valuesOff, valuesType, err := fieldOffset(bucket, "values")
+	if err != nil {
+		return err
+	}
+	overflowOff, _, err := fieldOffset(bucket, "overflow")
+	if err != nil {
+		return err
+	}
+	keys, ok := resolveType(keysType).(*dwarf.ArrayType)
+	if !ok {
+		return fmt.Errorf("not support the map layout %s", bucket.StructName)
+	}
+	values, ok := resolveType(valuesType).(*dwarf.ArrayType)
+	if !ok {
+		return fmt.Errorf("not support the map layout %s", bucket.StructName)
+	}
+
+	type bucketArray struct {
+		addr uint64
+		n uint64
+	}
+	n := uint64(1) << header["B"]
+	arrays := []bucketArray{{header["buckets"], n}}
+	if header["oldbuckets"] != 0 {
+		if header["flags"] & sameSizeGrow == 0 {
+			n >>= 1
+		}
+		arrays = append(arrays, bucketArray{header["oldbuckets"], n})
+	}
+	tophash := make([]byte, keys.Count)
+	for _, a := range arrays {
+		for i := uint64(0); i < a.n; i++ {
+			// the overflow buckets follow the bucket
+			for b := a.addr + i * uint64(bucket.Size()); b != 0; {
+				if _, err = ptracePeekData(cmd.Process.Pid, uintptr(b), tophash); err != nil {
+					return err
+				}
+				for j := int64(0); j < keys.Count; j++ {
+					if tophash[j] < minTopHash {
+						continue
+					}
+					if !visit(&mapEntry{key: b + uint64(keysOff + j * keys.Type.Size()), keyType: keys.Type,
+						elem: b + uint64(valuesOff + j * values.Type.Size()), elemType: values.Type}) {
+						return nil
+					}
+				}
+				if b, err = readWord(b + uint64(overflowOff)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mapEntries collects the entries of the map walked by walkMap
+func mapEntries(td *dwarf.TypedefType, word uint64) ([]*mapEntry, error) {
+	entries := make([]*mapEntry, 0)
+	err := walkMap(td, word, func(e *mapEntry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	return entries, err
+}
+
+// mapType returns the typedef `map[K]V` of typ
+func mapType(typ dwarf.Type) (*dwarf.TypedefType, bool) {
+	td, ok := typ.(*dwarf.TypedefType)
+	return td, ok && strings.HasPrefix(td.Name, "map[")
+}
+
+// indexMap returns the element of the key in the map x, only the keys of numbers, bools and strings are
+// compared. The strings are compared in full whatever loadConfig is
+func indexMap(x *lvalue, key constant.Value) (*lvalue, error) {
+	word, err := x.load()
+	if err != nil {
+		return nil, err
+	}
+	if word == 0 {
+		return nil, fmt.Errorf("key %s is not in the nil map", formatValue(key))
+	}
+	td, _ := mapType(x.typ)
+	// the walk stops at the key found or the first error
+	var (
+		found  *lvalue
+		cmpErr error
+	)
+	err = walkMap(td, word, func(e *mapEntry) bool {
+		ok, err := keyEquals(e.keyType, e.key, key)
+		if err != nil {
+			cmpErr = err
+			return false
+		}
+		if ok {
+			found = &lvalue{typ: e.elemType, addr: e.elem}
+		}
+		return !ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cmpErr != nil {
+		return nil, cmpErr
+	}
+	if found != nil {
+		return found, nil
+	}
+	return nil, fmt.Errorf("key %s is not in the map", formatValue(key))
+}
+
+// keyEquals compares the key of typ at addr with v
+func keyEquals(typ dwarf.Type, addr uint64, v constant.Value) (bool, error) {
+	if !isBasicType(typ) {
+		return false, fmt.Errorf("not support the key type %s", dwarfTypeName(typ))
+	}
+	if v.Kind() == constant.String {
+		if _, ok := resolveType(typ).(*dwarf.StructType); !ok {
+			return false, fmt.Errorf("mismatched types %s and %s", dwarfTypeName(typ), v.String())
+		}
+		header := make([]byte, 16)
+		if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), header); err != nil {
+			return false, err
+		}
+		s := constant.StringVal(v)
+		if binary.LittleEndian.Uint64(header[8:]) != uint64(len(s)) {
+			return false, nil
+		}
+		str := make([]byte, len(s))
+		if _, err := ptracePeekData(cmd.Process.Pid, uintptr(binary.LittleEndian.Uint64(header)), str); err != nil {
+			return false, err
+		}
+		return string(str) == s, nil
+	}
+	k, err := loadValue(typ, addr)
+	if err != nil {
+		return false, err
+	}
+	if k.Kind() == constant.String || (k.Kind() == constant.Bool) != (v.Kind() == constant.Bool) {
+		return false, fmt.Errorf("mismatched types %s and %s", dwarfTypeName(typ), v.String())
+	}
+	return constant.Compare(k, token.EQL, v), nil
+}
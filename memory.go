@@ -0,0 +1,194 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"go/constant"
+	"go/parser"
+	"strings"
+)
+
+// maxMemoryLength bounds the bytes that examine, the raw dumps and the `m` packets read at once, so a typo of
+// -len or a broken size doesn't allocate gigabytes
+const maxMemoryLength = 1 << 20
+
+// examineFormats are the layouts of examine, the bytes of a line and how a word is rendered
+var examineFormats = map[string]struct {
+	lineBytes int
+	word func(v uint64, size int) string
+}{
+	"hex": {16, func(v uint64, size int) string { return fmt.Sprintf("0x%0*x", size * 2, v) }},
+	"dec": {16, func(v uint64, size int) string { return fmt.Sprintf("%d", v) }},
+	"bin": {8, func(v uint64, size int) string { return fmt.Sprintf("%0*b", size * 8, v) }},
+}
+
+// Examine renders length bytes at addr in fmtName, which is hex, dec, bin or ascii. The words are size bytes
+// in little endian, each line begins with its address. The int3 of breakpoints show the original bytes
+func Examine(addr uint64, length int, size int, fmtName string) ([]string, error) {
+	if cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("the size of words should be 1, 2, 4 or 8, not %d", size)
+	}
+	if length <= 0 || length % size != 0 {
+		return nil, fmt.Errorf("the length %d should be a positive multiple of the size %d", length, size)
+	}
+	if length > maxMemoryLength {
+		return nil, fmt.Errorf("the length %d is beyond %d bytes", length, maxMemoryLength)
+	}
+	layout, ok := examineFormats[fmtName]
+	if !ok && fmtName != "ascii" {
+		return nil, fmt.Errorf("unknown format `%s`, expect hex, dec, bin or ascii", fmtName)
+	}
+	mem, err := ReadMemory(addr, length)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0)
+	if fmtName == "ascii" {
+		for off := 0; off < length; off += 16 {
+			end := off + 16
+			if end > length {
+				end = length
+			}
+			chars := make([]byte, 0, 16)
+			for _, c := range mem[off:end] {
+				if c < 0x20 || c > 0x7e {
+					c = '.'
+				}
+				chars = append(chars, c)
+			}
+			lines = append(lines, fmt.Sprintf("%#x: %s", addr + uint64(off), chars))
+		}
+		return lines, nil
+	}
+	lineBytes := layout.lineBytes
+	if lineBytes < size {
+		lineBytes = size
+	}
+	for off := 0; off < length; off += lineBytes {
+		words := make([]string, 0)
+		for w := off; w < off + lineBytes && w < length; w += size {
+			var v uint64
+			for i := size - 1; i >= 0; i-- {
+				v = v << 8 | uint64(mem[w + i])
+			}
+			words = append(words, layout.word(v, size))
+		}
+		lines = append(lines, fmt.Sprintf("%#x: %s", addr + uint64(off), strings.Join(words, " ")))
+	}
+	return lines, nil
+}
+
+// ReadMemory reads length bytes at addr of the debuggee, the int3 of breakpoints are the original bytes
+func ReadMemory(addr uint64, length int) ([]byte, error) {
+	if cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	if length < 0 || length > maxMemoryLength {
+		return nil, fmt.Errorf("the length %d should be from 0 to %d bytes", length, maxMemoryLength)
+	}
+	if addr + uint64(length) < addr {
+		return nil, fmt.Errorf("can't read %d bytes at %#x beyond the address space", length, addr)
+	}
+	mem := make([]byte, length)
+	n, err := readMemory(cmd.Process.Pid, uintptr(addr), mem)
+	if err != nil {
+		return nil, err
+	}
+	if n < length {
+		return nil, fmt.Errorf("can't read memory at %#x", addr + uint64(n))
+	}
+	for _, info := range bp.infos {
+		if info.original != nil && addr <= info.pc && info.pc < addr + uint64(length) {
+			mem[info.pc - addr] = info.original[0]
+		}
+	}
+	return mem, nil
+}
+
+// RawValue dumps the bytes of the place of expr in hex, like examine does with the size of its type
+func RawValue(expr string) ([]string, error) {
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	l, err := evalLvalue(node)
+	if err != nil {
+		return nil, err
+	}
+	if l.reg != "" {
+		return nil, fmt.Errorf("%s is in the register %s, not in the memory", expr, l.reg)
+	}
+	if l.typ.Size() <= 0 {
+		return nil, fmt.Errorf("%s has no bytes", expr)
+	}
+	return Examine(l.addr, int(l.typ.Size()), 1, "hex")
+}
+
+// examineAddress evaluates where examine reads and set-mem writes, `&name` is the address of the variable,
+// a pointer variable is the address it points to, and the other expressions should be integers
+func examineAddress(expr string) (uint64, error) {
+	if strings.HasPrefix(expr, "&") {
+		_, addr, err := findVariable(expr[1:])
+		return addr, err
+	}
+	if entry, addr, err := findVariable(expr); err == nil {
+		typ, err := bi.variableType(entry)
+		if err != nil {
+			return 0, err
+		}
+		for {
+			if t, ok := typ.(*dwarf.TypedefType); ok {
+				typ = t.Type
+				continue
+			}
+			break
+		}
+		if _, ok := typ.(*dwarf.PtrType); ok {
+			return readWord(addr)
+		}
+	}
+	v, err := evalExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+	addr, ok := constant.Uint64Val(v)
+	if v.Kind() != constant.Int || !ok {
+		return 0, fmt.Errorf("the address should be an integer, not %s", v.String())
+	}
+	return addr, nil
+}
+
+// WriteMemory writes data at addr of the debuggee. The int3 of the breakpoints in it are kept, the bytes
+// written there become their original instructions
+func WriteMemory(addr uint64, data []byte) error {
+	if cmd.Process == nil {
+		return NoProcessRuning
+	}
+	mem := make([]byte, len(data))
+	copy(mem, data)
+	covered := make([]*BInfo, 0)
+	for _, info := range bp.infos {
+		if info.original == nil || info.pc < addr || info.pc >= addr + uint64(len(mem)) {
+			continue
+		}
+		covered = append(covered, info)
+		if !info.disabled {
+			mem[info.pc - addr] = 0xCC
+		}
+	}
+	n, err := writeMemory(cmd.Process.Pid, uintptr(addr), mem)
+	if err != nil {
+		return err
+	}
+	if n < len(mem) {
+		return fmt.Errorf("can't write memory at %#x", addr + uint64(n))
+	}
+	for _, info := range covered {
+		info.original[0] = data[info.pc - addr]
+	}
+	return nil
+}
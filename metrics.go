@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// metric times an operation of the debugger, like loading the binary info or unwinding the stack
+type metric struct {
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+// metrics are the timings of the operations in the session, `metrics` prints them and `metrics reset` clears them
+var metrics = map[string]*metric{}
+
+// observe adds the time since start to the metric name, it is deferred at the beginning of the operation like
+// `defer observe("eval", time.Now())`
+func observe(name string, start time.Time) {
+	d := time.Since(start)
+	m, ok := metrics[name]
+	if !ok {
+		m = &metric{}
+		metrics[name] = m
+	}
+	m.count++
+	m.total += d
+	if d > m.max {
+		m.max = d
+	}
+}
+
+func resetMetrics() {
+	metrics = map[string]*metric{}
+}
+
+func printMetrics() {
+	defer printMemory()
+	if len(metrics) == 0 {
+		fmt.Fprintf(stdout, "%s\n", "there is no metric")
+		return
+	}
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(stdout, "%-12s %8s %12s %12s %12s\n", "operation", "count", "total", "avg", "max")
+	for _, name := range names {
+		m := metrics[name]
+		avg := m.total / time.Duration(m.count)
+		fmt.Fprintf(stdout, "%-12s %8d %12s %12s %12s\n", name, m.count,
+			m.total.Round(time.Microsecond), avg.Round(time.Microsecond), m.max.Round(time.Microsecond))
+	}
+}
+
+// printMemory prints what the string table of the binary keeps and saves, and the compile units loaded within
+// max-dwarf-memory. They are not reset with the timings
+func printMemory() {
+	if bi == nil || bi.strings == nil {
+		return
+	}
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	t := bi.strings
+	fmt.Fprintf(stdout, "strings %d interned, %d bytes kept, %d bytes saved\n", len(t.strings), t.bytes, t.saved)
+	loaded := 0
+	for _, cu := range bi.CompileUnits {
+		if cu.loaded || cu.linesLoaded {
+			loaded++
+		}
+	}
+	fmt.Fprintf(stdout, "units %d loaded, %d bytes resident, %d evicted\n", loaded, bi.resident, bi.evictions)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/dwarf"
+	"debug/elf"
+	"debug/macho"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// mappedFile is the executable mapped read only. The sections are the slices of the mapping, the compressed
+// ones are inflated on the first use and kept. The entries of the dwarf data refer to the mapping, so it is unmapped
+// only when the binary is not used any more. modTime is the mtime of the file when it is mapped
+type mappedFile struct {
+	data []byte
+	elf  *elf.File
+	// macho is the executable of darwin, elf is nil then
+	macho    *macho.File
+	inflated map[string][]byte
+	modTime  int64
+}
+
+// fileSection is a section of the ELF or the Mach-O file, offset is where its data is in the file
+type fileSection struct {
+	name   string
+	addr   uint64
+	offset uint64
+	size   uint64
+	// nobits is SHT_NOBITS of ELF or the zerofill of Mach-O, the section has no data in the file
+	nobits bool
+	// compressed is SHF_COMPRESSED, the data begins with the Chdr
+	compressed bool
+}
+
+// copy from <mach-o/loader.h>
+const (
+	machoSectionType = 0xff
+	machoZerofill    = 0x1
+	machoGbZerofill  = 0xc
+	machoTlsZerofill = 0x12
+	machoPureCode    = 0x80000000
+	machoSomeCode    = 0x400
+	machoProtRead    = 0x1
+	machoProtWrite   = 0x2
+	machoProtExecute = 0x4
+	machoNameSize    = 16
+	machoStabMask    = 0xe0
+)
+
+func mapFile(filename string) (*mappedFile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, fmt.Errorf("%s is empty", filename)
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	m := &mappedFile{data: data, inflated: make(map[string][]byte), modTime: info.ModTime().UnixNano()}
+	// the binaries of darwin are Mach-O, the error of ELF is told if it is neither
+	if m.elf, err = elf.NewFile(bytes.NewReader(data)); err != nil {
+		var machoErr error
+		if m.macho, machoErr = macho.NewFile(bytes.NewReader(data)); machoErr != nil {
+			syscall.Munmap(data)
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// close unmaps the file, closing it again does nothing
+func (m *mappedFile) close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data, m.elf, m.macho, m.inflated = nil, nil, nil, nil
+	return err
+}
+
+// lookupSection finds the section name of ELF like `.debug_info`, the one of Mach-O is `__debug_info`
+func (m *mappedFile) lookupSection(name string) *fileSection {
+	if m.elf != nil {
+		s := m.elf.Section(name)
+		if s == nil {
+			return nil
+		}
+		return &fileSection{name: s.Name, addr: s.Addr, offset: s.Offset, size: s.FileSize,
+			nobits: s.Type == elf.SHT_NOBITS, compressed: s.Flags&elf.SHF_COMPRESSED != 0}
+	}
+	if m.macho != nil {
+		s := m.macho.Section(machoSectionName(name))
+		if s == nil {
+			return nil
+		}
+		typ := s.Flags & machoSectionType
+		return &fileSection{name: s.Name, addr: s.Addr, offset: uint64(s.Offset), size: s.Size,
+			nobits: typ == machoZerofill || typ == machoGbZerofill || typ == machoTlsZerofill}
+	}
+	return nil
+}
+
+// machoSectionName is the name of ELF with `__` for the dot, which is cut at 16 bytes in the section header
+func machoSectionName(name string) string {
+	name = "__" + strings.TrimPrefix(name, ".")
+	if len(name) > machoNameSize {
+		name = name[:machoNameSize]
+	}
+	return name
+}
+
+// hasSection tells whether there is the section name, the data is not read
+func (m *mappedFile) hasSection(name string) bool {
+	return m.lookupSection(name) != nil
+}
+
+// segments are the program headers of ELF, or the segments of Mach-O whose loaded ones are PT_LOAD
+func (m *mappedFile) segments() []Segment {
+	var segments []Segment
+	if m.elf != nil {
+		for _, p := range m.elf.Progs {
+			segments = append(segments, Segment{Type: p.Type, Offset: p.Off, Vaddr: p.Vaddr, Memsz: p.Memsz,
+				Filesz: p.Filesz, Flags: p.Flags})
+		}
+		return segments
+	}
+	for _, l := range m.macho.Loads {
+		seg, ok := l.(*macho.Segment)
+		if !ok {
+			continue
+		}
+		p := Segment{Name: seg.Name, Type: elf.PT_NULL, Offset: seg.Offset, Vaddr: seg.Addr, Memsz: seg.Memsz,
+			Filesz: seg.Filesz, Flags: machoProtFlags(seg.Prot)}
+		if seg.Memsz > 0 {
+			p.Type = elf.PT_LOAD
+		}
+		segments = append(segments, p)
+	}
+	return segments
+}
+
+// machoProtFlags converts VM_PROT_READ, VM_PROT_WRITE and VM_PROT_EXECUTE, which are the bits of PF_R, PF_W
+// and PF_X in the other order
+func machoProtFlags(prot uint32) elf.ProgFlag {
+	var flags elf.ProgFlag
+	if prot&machoProtRead != 0 {
+		flags |= elf.PF_R
+	}
+	if prot&machoProtWrite != 0 {
+		flags |= elf.PF_W
+	}
+	if prot&machoProtExecute != 0 {
+		flags |= elf.PF_X
+	}
+	return flags
+}
+
+// symbols returns the symbol table, the ones of Mach-O are converted to ELF and the ones in __text are STT_FUNC
+func (m *mappedFile) symbols() ([]elf.Symbol, error) {
+	if m.elf != nil {
+		return m.elf.Symbols()
+	}
+	if m.macho.Symtab == nil {
+		return nil, errors.New("no symbol section")
+	}
+	text := 0
+	for i, s := range m.macho.Sections {
+		if s.Seg == "__TEXT" && s.Name == "__text" {
+			// the sections of nlist are numbered from 1
+			text = i + 1
+		}
+	}
+	symbols := make([]elf.Symbol, 0, len(m.macho.Symtab.Syms))
+	for _, sym := range m.macho.Symtab.Syms {
+		if sym.Type&machoStabMask != 0 {
+			continue
+		}
+		typ := elf.STT_OBJECT
+		if text != 0 && int(sym.Sect) == text {
+			typ = elf.STT_FUNC
+		}
+		symbols = append(symbols, elf.Symbol{Name: sym.Name, Info: elf.ST_INFO(elf.STB_GLOBAL, typ),
+			Value: sym.Value})
+	}
+	return symbols, nil
+}
+
+// section returns the data of the section name, or of `.zdebug_` of the old go for `.debug_`. It is nil if there
+// is no such section
+func (m *mappedFile) section(name string) ([]byte, error) {
+	if data, ok := m.inflated[name]; ok {
+		return data, nil
+	}
+	s := m.lookupSection(name)
+	zdebug := false
+	if s == nil && strings.HasPrefix(name, ".debug_") {
+		s = m.lookupSection(".zdebug_" + strings.TrimPrefix(name, ".debug_"))
+		zdebug = s != nil
+	}
+	if s == nil || s.nobits {
+		return nil, nil
+	}
+	if s.offset+s.size > uint64(len(m.data)) {
+		return nil, fmt.Errorf("the section %s is out of the file", s.name)
+	}
+	raw := m.data[s.offset : s.offset+s.size]
+	var (
+		data []byte
+		err  error
+	)
+	switch {
+	case s.compressed:
+		data, err = inflateSection(m.elf, raw)
+	case zdebug:
+		data, err = inflateZdebug(raw)
+	default:
+		return raw, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("inflate %s: %v", s.name, err)
+	}
+	m.inflated[name] = data
+	return data, nil
+}
+
+// inflateSection inflates the section of SHF_COMPRESSED, which begins with the Chdr of the class of the file
+func inflateSection(elffile *elf.File, raw []byte) ([]byte, error) {
+	var (
+		typ  elf.CompressionType
+		size uint64
+		hdr  int
+	)
+	order := elffile.ByteOrder
+	if elffile.Class == elf.ELFCLASS64 {
+		if len(raw) < 24 {
+			return nil, errors.New("the compression header is too short")
+		}
+		typ, size, hdr = elf.CompressionType(order.Uint32(raw)), order.Uint64(raw[8:]), 24
+	} else {
+		if len(raw) < 12 {
+			return nil, errors.New("the compression header is too short")
+		}
+		typ, size, hdr = elf.CompressionType(order.Uint32(raw)), uint64(order.Uint32(raw[4:])), 12
+	}
+	if typ != elf.COMPRESS_ZLIB {
+		return nil, fmt.Errorf("unsupported compression %v", typ)
+	}
+	return inflate(raw[hdr:], size)
+}
+
+// inflateZdebug inflates the section of `.zdebug_`, which begins with `ZLIB` and the size in big endian
+func inflateZdebug(raw []byte) ([]byte, error) {
+	if len(raw) < 12 || string(raw[:4]) != "ZLIB" {
+		return raw, nil
+	}
+	return inflate(raw[12:], binary.BigEndian.Uint64(raw[4:12]))
+}
+
+func inflate(compressed []byte, size uint64) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, r.Close()
+}
+
+// dwarf is like (*elf.File).DWARF with the sections of the mapping, which copies all of them. The frame is parsed
+// by ParseFrameSection and the location lists by the variables, so they are not read here
+func (m *mappedFile) dwarf() (*dwarf.Data, error) {
+	sections := make(map[string][]byte)
+	for _, name := range []string{"abbrev", "aranges", "info", "line", "pubnames", "ranges", "str"} {
+		data, err := m.section(".debug_" + name)
+		if err != nil {
+			return nil, err
+		}
+		sections[name] = data
+	}
+	d, err := dwarf.New(sections["abbrev"], sections["aranges"], nil, sections["info"], sections["line"],
+		sections["pubnames"], sections["ranges"], sections["str"])
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{".debug_addr", ".debug_line_str", ".debug_rnglists", ".debug_str_offsets"} {
+		data, err := m.section(name)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			if err = d.AddSection(name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/gosym"
+	"errors"
+	"golang.org/x/arch/x86/x86asm"
+	"sort"
+)
+
+// noDwarfCommands are what can't work without DWARF, they are told when the binary built by -ldflags=-w or -s is
+// analyzed: the variables, the types and the expressions are read from .debug_info
+var noDwarfCommands = []string{"locals", "args", "vars", "p", "whatis", "display", "watch", "rwatch", "call", "chan",
+	"defer", "goroutines", "dump-dwarf"}
+
+// symbolTableUnit is the compile unit of the functions read from .gopclntab, it has nothing to be parsed
+const symbolTableUnit = ".gopclntab"
+
+// loadSymbolTable reads the functions and the lines in .gopclntab, which the runtime keeps for the tracebacks
+// after the debug sections are stripped. The functions are in one unit which is loaded already
+func (bi *BI) loadSymbolTable(file *mappedFile) error {
+	text := file.lookupSection(".text")
+	pclntab, err := file.section(".gopclntab")
+	if err != nil {
+		return err
+	}
+	if text == nil || pclntab == nil {
+		return errors.New("the binary has neither DWARF nor .gopclntab, it can't be debugged")
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(pclntab, text.addr))
+	if err != nil {
+		return err
+	}
+	if len(table.Funcs) == 0 {
+		return errors.New("there is no function in .gopclntab")
+	}
+	bi.symTable, bi.symbolLines = table, make(map[*Function][]*dwarf.LineEntry)
+
+	cu := &CompileUnit{name: symbolTableUnit, language: DW_LANG_Go, loaded: true, linesLoaded: true}
+	cu.functions = make([]*Function, 0, len(table.Funcs))
+	for i := range table.Funcs {
+		fn := &table.Funcs[i]
+		f := &Function{name: bi.strings.intern(fn.Name), lowpc: fn.Entry, highpc: fn.End, cu: cu}
+		cu.functions = append(cu.functions, f)
+		if _, ok := bi.functionsByName[f.name]; !ok {
+			bi.functionsByName[f.name] = f
+		}
+	}
+	sort.SliceStable(cu.functions, func(i, j int) bool { return cu.functions[i].lowpc < cu.functions[j].lowpc })
+	cu.ranges = [][2]uint64{{cu.functions[0].lowpc, cu.functions[len(cu.functions)-1].highpc}}
+	bi.Functions = cu.functions
+	bi.CompileUnits = []*CompileUnit{cu}
+	files := make([]string, 0, len(table.Files))
+	for file := range table.Files {
+		files = append(files, file)
+	}
+	bi.indexUnits([][]string{files})
+	return nil
+}
+
+// symbolLinesOf returns the rows of the lines of f like the ones of a line table, each begins where the line
+// changes. They are found by the instructions of f and kept, mu is held
+func (bi *BI) symbolLinesOf(f *Function) []*dwarf.LineEntry {
+	if lines, ok := bi.symbolLines[f]; ok {
+		return lines
+	}
+	var (
+		lines []*dwarf.LineEntry
+		last  *dwarf.LineEntry
+	)
+	for pc := f.lowpc; pc < f.highpc && bi.file != nil; {
+		filename, lineno, _ := bi.symTable.PCToLine(pc)
+		if last == nil || last.File.Name != filename || last.Line != lineno {
+			last = &dwarf.LineEntry{Address: pc, File: &dwarf.LineFile{Name: filename}, Line: lineno, IsStmt: true}
+			lines = append(lines, last)
+		}
+		size := 1
+		n := f.highpc - pc
+		if n > 15 {
+			n = 15
+		}
+		if inst, err := x86asm.Decode(bi.file.readAddr(pc, n), 64); err == nil {
+			size = inst.Len
+		}
+		pc += uint64(size)
+	}
+	bi.symbolLines[f] = lines
+	return lines
+}
+
+// symbolStatement is statement of the binary without DWARF, mu is held
+func (bi *BI) symbolStatement(pc uint64) (*dwarf.LineEntry, bool) {
+	f, ok := bi.functionIncludePcLocked(pc)
+	if !ok {
+		return nil, false
+	}
+	for _, lineEntry := range bi.symbolLinesOf(f) {
+		if lineEntry.Address == pc {
+			return lineEntry, true
+		}
+	}
+	return nil, false
+}
+
+// symbolLineToPc is fileLineToPc of the binary without DWARF, the first pc of the line is the breakpoint
+func (bi *BI) symbolLineToPc(filename string, lineno int) (uint64, error) {
+	pc, _, err := bi.symTable.LineToPC(filename, lineno)
+	if err != nil {
+		return 0, NotFoundSourceLineErr
+	}
+	return pc, nil
+}
+
+// functionIncludePcLocked finds the function of pc among the ones of .gopclntab, mu is held
+func (bi *BI) functionIncludePcLocked(pc uint64) (*Function, bool) {
+	functions := bi.Functions
+	i := sort.Search(len(functions), func(i int) bool { return functions[i].lowpc > pc }) - 1
+	if i >= 0 && pc < functions[i].highpc {
+		return functions[i], true
+	}
+	return nil, false
+}
+
+// framePointerFrame unwinds the function at pc by the frame pointer, there is no .debug_frame without DWARF. The
+// go functions push rbp below the return address after the entry, so the cfa is rbp+16, or rsp+8 at the entry.
+// The leaf functions without any frame are skipped over
+func (bi *BI) framePointerFrame(pc uint64, rsp uint64, rbp uint64) (*Frame, error) {
+	f, err := bi.findFunctionIncludePc(pc)
+	if err != nil {
+		return nil, err
+	}
+	frame := &Frame{address: pc, framebase: rbp + 16}
+	if pc == f.lowpc {
+		frame.framebase = rsp + 8
+	}
+	return frame, nil
+}
+
+// requireDwarf fails with NoDwarfErr for what of the binary without DWARF
+func (bi *BI) requireDwarf(what string) error {
+	if bi.symTable != nil {
+		return &NoDwarfErr{what: what}
+	}
+	return nil
+}
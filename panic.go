@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// panicFunctions are where the debuggee stops when it panics or the runtime throws a fatal error.
+// gopanic is called by every panic, fatalpanic only by the panics which are not recovered
+var panicFunctions = []string{"runtime.gopanic", "runtime.fatalpanic", "runtime.fatalthrow"}
+
+// SetPanicBreakPoints sets the breakpoints at the entries of panicFunctions, where the arguments are still
+// in the registers. The functions can't be found in the programs which are not written in go
+func (bp *BP) SetPanicBreakPoints() error {
+	for _, name := range panicFunctions {
+		f, err := bi.findFunctionByName(name)
+		if err != nil {
+			continue
+		}
+		info, err := bp.SetInternalBreakPoint(f.lowpc)
+		if err == HasExistedBreakPointErr {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		info.kind = PANICBPTYPE
+		info.fn = name
+	}
+	return nil
+}
+
+// panicEvent turns the stop at the breakpoint of panicFunctions into StopPanic with the panic value,
+// gopanic gets `e any` in RAX and RBX, fatalpanic gets `*_panic` in RAX. By ABI0 they are above the return
+// address on the stack
+func panicEvent(ev *StopEvent) *StopEvent {
+	ev.reason = StopPanic
+	regs, err := getRegisters()
+	if err != nil {
+		ev.panic = fmt.Sprintf("<%v>", err)
+		return ev
+	}
+	args := []uint64{regs.Rax, regs.Rbx}
+	if bi.goVersion.abi0 {
+		mem := make([]byte, 16)
+		if _, err = ptracePeekData(cmd.Process.Pid, uintptr(regs.Rsp + 8), mem); err != nil {
+			ev.panic = fmt.Sprintf("<%v>", err)
+			return ev
+		}
+		args = []uint64{binary.LittleEndian.Uint64(mem), binary.LittleEndian.Uint64(mem[8:])}
+	}
+	switch ev.info.fn {
+	case "runtime.gopanic":
+		ev.panic = newPrinter().formatDynamic(args[0], args[1])
+	case "runtime.fatalpanic":
+		ev.panic = "<unknown>"
+		if t, err := bi.structType("runtime._panic"); err == nil && args[0] != 0 {
+			if off, _, err := fieldOffset(t, "arg"); err == nil {
+				mem := make([]byte, 16)
+				if _, err = ptracePeekData(cmd.Process.Pid, uintptr(args[0] + uint64(off)), mem); err == nil {
+					ev.panic = newPrinter().formatDynamic(binary.LittleEndian.Uint64(mem), binary.LittleEndian.Uint64(mem[8:]))
+				}
+			}
+		}
+	case "runtime.fatalthrow":
+		// runtime.throw has printed the message
+		ev.panic = "fatal error"
+	}
+	return ev
+}
+
+// clearPanicBreakPoints forgets the breakpoints of panicFunctions, which have been disabled
+func (bp *BP) clearPanicBreakPoints() {
+	infos := make([]*BInfo, 0, len(bp.infos))
+	for _, v := range bp.infos {
+		if v.kind != PANICBPTYPE {
+			infos = append(infos, v)
+		}
+	}
+	bp.infos = infos
+}
@@ -1,32 +1,271 @@
 package main
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"github.com/chainhelen/godbg/log"
 	"go.uber.org/zap"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
+// parseHeadless takes `--headless` and `--listen=addr` out of the args, the debugger serves the json-rpc
+// api at addr instead of running the prompt
+func parseHeadless() (bool, string) {
+	headless, addr := false, "127.0.0.1:2345"
+	args := os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch {
+		// the args after `--` are of the program
+		case arg == "--":
+			args = append(args, os.Args[i:]...)
+			i = len(os.Args)
+		case arg == "--headless":
+			headless = true
+		case strings.HasPrefix(arg, "--listen="):
+			addr = strings.TrimPrefix(arg, "--listen=")
+		default:
+			args = append(args, arg)
+		}
+	}
+	os.Args = args
+	return headless, addr
+}
+
+// parseValueFlag takes `flag` or `flag=value` out of the args, it is false if there is neither. The value is the
+// next arg like `flag value` too if separate is true. The args after `--` are of the program
+func parseValueFlag(flag string, separate bool) (string, bool) {
+	value, found := "", false
+	args := os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		if os.Args[i] == "--" {
+			args = append(args, os.Args[i:]...)
+			break
+		}
+		if separate && os.Args[i] == flag && i+1 < len(os.Args) && os.Args[i+1] != "--" {
+			value, found = os.Args[i+1], true
+			i++
+			continue
+		}
+		if os.Args[i] == flag || strings.HasPrefix(os.Args[i], flag+"=") {
+			value, found = strings.TrimPrefix(strings.TrimPrefix(os.Args[i], flag), "="), true
+			continue
+		}
+		args = append(args, os.Args[i])
+	}
+	os.Args = args
+	return value, found
+}
+
+// parseLogFlags takes `--log[=dwarf,proc,rpc]`, `--log-level=lv`, `--log-format=json|logfmt`, `--log-output=dest`,
+// `--log-max-size=10M` and `--log-backups=3` out of the args and sets up the logging by them. --log logs all the
+// components without the value, at the level debug by default
+func parseLogFlags() error {
+	components, on := parseValueFlag("--log", false)
+	lv, hasLevel := parseValueFlag("--log-level", true)
+	dest, hasOutput := parseValueFlag("--log-output", true)
+	if format, ok := parseValueFlag("--log-format", true); ok {
+		if err := log.SetFormat(format); err != nil {
+			return err
+		}
+	}
+	size, backups := log.Rotation()
+	if s, ok := parseValueFlag("--log-max-size", true); ok {
+		var err error
+		if size, err = log.ParseSize(s); err != nil {
+			return err
+		}
+	}
+	if s, ok := parseValueFlag("--log-backups", true); ok {
+		var err error
+		if backups, err = strconv.Atoi(s); err != nil {
+			return fmt.Errorf("invalid log backups `%s`", s)
+		}
+	}
+	if err := log.SetRotation(size, backups); err != nil {
+		return err
+	}
+	if on {
+		if components == "" {
+			components = "all"
+		}
+		if err := log.Enable(components, true); err != nil {
+			return err
+		}
+		if !hasLevel {
+			lv, hasLevel = "debug", true
+		}
+	}
+	if hasLevel {
+		if err := log.SetLevel(lv); err != nil {
+			return err
+		}
+	}
+	if hasOutput {
+		return log.SetOutput(dest)
+	}
+	return nil
+}
+
+// parseFlag takes the flag like --tui out of the args, the args after `--` are of the program
+func parseFlag(flag string) bool {
+	enabled := false
+	args := os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		if os.Args[i] == "--" {
+			args = append(args, os.Args[i:]...)
+			break
+		}
+		if os.Args[i] == flag {
+			enabled = true
+			continue
+		}
+		args = append(args, os.Args[i])
+	}
+	os.Args = args
+	return enabled
+}
+
+// parseCommandFiles takes `--init file` and `-x file` out of the args, the commands in the files run in order
+// before the prompt, the init file first. The args after the go file or `--` are passed to the program as they are
+func parseCommandFiles() []string {
+	var initFile string
+	files := make([]string, 0)
+	args := os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch {
+		case path.Ext(arg) == ".go" || arg == "--":
+			args = append(args, os.Args[i:]...)
+			i = len(os.Args)
+		case strings.HasPrefix(arg, "--init="):
+			initFile = strings.TrimPrefix(arg, "--init=")
+		case (arg == "--init" || arg == "-x") && i + 1 < len(os.Args):
+			if arg == "--init" {
+				initFile = os.Args[i + 1]
+			} else {
+				files = append(files, os.Args[i + 1])
+			}
+			i++
+		default:
+			args = append(args, arg)
+		}
+	}
+	os.Args = args
+	if initFile != "" {
+		files = append([]string{initFile}, files...)
+	}
+	return files
+}
+
+// parseTestArgs returns the package of `godbg test [pkg] [-- args]`, which is the current directory by default,
+// and the args of the test binary
+func parseTestArgs() (string, []string, error) {
+	pkg, args := ".", os.Args[2:]
+	if len(args) > 0 && args[0] != "--" {
+		pkg, args = args[0], args[1:]
+	}
+	if len(args) == 0 {
+		return pkg, nil, nil
+	}
+	if args[0] != "--" {
+		return "", nil, errors.New("please input the args of the test binary after `--`")
+	}
+	return pkg, args[1:], nil
+}
+
 func checkArgs() error {
 	logger.Debug("[checkArgs]", zap.Strings("args", os.Args))
-	if len(os.Args) != 3 {
-		return errors.New("len(args) != 3")
+	// `godbg dap [addr]` gets the program from the client
+	if len(os.Args) >= 2 && len(os.Args) <= 3 && os.Args[1] == "dap" {
+		return nil
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "test" {
+		_, _, err := parseTestArgs()
+		return err
+	}
+	if len(os.Args) < 3 {
+		return errors.New("len(args) < 3")
 	}
 	debug := os.Args[1]
 
-	if debug != "debug" {
-		return errors.New("only support `debug`")
+	// `godbg remote addr prog`, prog is the executable file run by the gdb server
+	if debug == "remote" {
+		if len(os.Args) != 4 {
+			return errors.New("please input the addr and the executable file")
+		}
+		_, err := os.Stat(os.Args[3])
+		return err
+	}
+	// `godbg attach pid [--exe path]`, the binary is /proc/<pid>/exe by default
+	if debug == "attach" {
+		if len(os.Args) != 3 && (len(os.Args) != 5 || os.Args[3] != "--exe") {
+			return errors.New("please input the pid and `--exe path` optionally")
+		}
+		if pid, err := strconv.Atoi(os.Args[2]); err != nil || pid <= 0 {
+			return fmt.Errorf("invalid pid %s", os.Args[2])
+		}
+		return nil
+	}
+	// `godbg exec prog [-- args]`, prog is built already
+	if debug == "exec" {
+		if len(os.Args) > 3 && os.Args[3] != "--" {
+			return errors.New("please input the args of the program after `--`")
+		}
+		_, err := os.Stat(os.Args[2])
+		return err
+	}
+	// `godbg core prog corefile`, prog is the executable file dumping corefile
+	if debug == "core" {
+		if len(os.Args) != 4 {
+			return errors.New("please input the executable file and the core file")
+		}
+		for _, f := range os.Args[2:] {
+			if _, err := os.Stat(f); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	if  path.Ext(os.Args[2]) != ".go" {
-		return errors.New("please input .go file")
+	// `godbg trace [--exit] [--pid N | main.go] regexp [args]` is checked by traceMain
+	if debug == "trace" {
+		if len(os.Args) < 4 {
+			return errors.New("please input the program or the pid and the regexp of functions")
+		}
+		return nil
+	}
+	if debug != "debug" && debug != "replay" && debug != "gdbserver" {
+		return errors.New("only support `debug`, `replay`, `dap`, `gdbserver`, `remote`, `trace`, `core`, `attach`, `exec` and `test`")
+	}
+	// `godbg gdbserver addr main.go [args]`
+	if debug == "gdbserver" && (len(os.Args) < 4 || path.Ext(os.Args[3]) != ".go") {
+		return errors.New("please input the addr and .go file")
+	}
+	if debug != "gdbserver" && !isProgram(os.Args[2]) {
+		return errors.New("please input .go file or the directory of the package")
 	}
 	return nil
 }
 
+// isProgram is true if arg is a go file or the directory of a package, which is built into the debuggee
+func isProgram(arg string) bool {
+	if path.Ext(arg) == ".go" {
+		return true
+	}
+	info, err := os.Stat(arg)
+	return err == nil && info.IsDir()
+}
+
 func absoluteFilename() (string, error) {
 	filename := os.Args[2]
 	if path.IsAbs(filename) {
@@ -46,19 +285,71 @@ func absoluteFilename() (string, error) {
 	return filename, nil
 }
 
+// build builds filename without the optimizations into a binary of its own in the temporary directory, so the
+// sessions building the same file don't overwrite each other. The binary is removed by removeBuilt
 func build (filename string) (string, error) {
-	base := filepath.Base(filename)
-	execfile := path.Join(os.TempDir(), "__" + base+"__")
+	execfile, err := tempBinary("__" + filepath.Base(filename) + "__")
+	if err != nil {
+		return "", err
+	}
 
 	args := []string{"build", "-gcflags", "all=-N -l", "-o", execfile, filename}
 
 	cmd := exec.Command("go", args...)
-	return execfile, cmd.Run()
+	if err = cmd.Run(); err != nil {
+		os.Remove(execfile)
+		return "", err
+	}
+	return execfile, nil
+}
+
+// buildTest builds the test binary of pkg like build, the package without any test file is an error
+func buildTest(pkg string) (string, error) {
+	dir, err := filepath.Abs(pkg)
+	if err != nil {
+		return "", err
+	}
+	execfile, err := tempBinary("__" + filepath.Base(dir) + ".test__")
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command("go", "test", "-c", "-gcflags", "all=-N -l", "-o", execfile, pkg).CombinedOutput()
+	if err != nil {
+		os.Remove(execfile)
+		return "", fmt.Errorf("%v\n%s", err, bytes.TrimSpace(out))
+	}
+	// `go test -c` writes nothing without any test file, the file created stays empty
+	if info, err := os.Stat(execfile); err != nil || info.Size() == 0 {
+		os.Remove(execfile)
+		return "", fmt.Errorf("no test files in %s", pkg)
+	}
+	return execfile, nil
 }
 
-// not supoort arguments of cmds
-func runexec(execfile string) (*exec.Cmd, error){
-	cmd := exec.Command(execfile)
+// tempBinary creates the empty file named by prefix and a random suffix for the go command to write the binary,
+// which overwrites the empty files only
+func tempBinary(prefix string) (string, error) {
+	f, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// removeBuilt removes the binary of the current target if godbg built it from the source file or the test package
+func removeBuilt() {
+	if sourcefile != "" || testpackage != "" {
+		os.Remove(execfile)
+	}
+}
+
+// runexec starts execfile with args under ptrace and returns once it stops at the first instruction
+func runexec(execfile string, args []string) (*exec.Cmd, error){
+	if useDebugserver {
+		return launchDebugserver(execfile, args)
+	}
+	cmd := exec.Command(execfile, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true, Setpgid: true, Foreground: false}
@@ -75,6 +366,207 @@ func runexec(execfile string) (*exec.Cmd, error){
 		logger.Error("runexec:cmd.Wait()", zap.Error(err))
 		return nil, err
 	}
+	if err := ptraceSetTraceOptions(cmd.Process.Pid); err != nil {
+		logger.Error("runexec:ptraceSetTraceOptions", zap.Error(err))
+		return nil, err
+	}
+	logger.Info("start", log.Event("process.start"), log.Pid(cmd.Process.Pid), zap.String("execfile", execfile))
 	return cmd, nil
 }
 
+
+// attach stops every thread of the running process pid, returns it as the cmd and the binary it runs
+func attach(pid int) (*exec.Cmd, string, error) {
+	defer observe("attach", time.Now())
+	var (
+		exefile string
+		tids []int
+		p *os.Process
+		err error
+	)
+	if useDebugserver {
+		return attachDebugserver(pid)
+	}
+	if exefile, err = processExecutable(pid); err != nil {
+		return nil, "", err
+	}
+	if p, err = os.FindProcess(pid); err != nil {
+		return nil, "", err
+	}
+
+	// all ptrace requests must come from the thread which attached
+	runtime.LockOSThread()
+
+	seen := make(map[int]bool)
+	threads = threads[:0]
+	// PT_ATTACH stops every thread of the process, which are listed after it stops
+	if stopsProcess {
+		var s syscall.WaitStatus
+		if err = ptraceAttach(pid); err != nil {
+			logger.Error("attach:ptraceAttach", zap.Error(err), zap.Int("pid", pid))
+			return nil, "", err
+		}
+		if _, err = syscall.Wait4(pid, &s, waitOptions, nil); err != nil {
+			logger.Error("attach:Wait4", zap.Error(err), zap.Int("pid", pid))
+			return nil, "", err
+		}
+		if threads, err = processThreads(pid); err != nil {
+			return nil, "", err
+		}
+	}
+	// the goroutines keep running while attaching, new threads are picked up by the next round
+	for !stopsProcess {
+		if tids, err = processThreads(pid); err != nil {
+			return nil, "", err
+		}
+		found := false
+		for _, tid := range tids {
+			if seen[tid] {
+				continue
+			}
+			found = true
+			if err = ptraceAttach(tid); err != nil {
+				// the thread has exited
+				if err == syscall.ESRCH {
+					seen[tid] = true
+					continue
+				}
+				logger.Error("attach:ptraceAttach", zap.Error(err), zap.Int("pid", pid), zap.Int("tid", tid))
+				return nil, "", err
+			}
+			var s syscall.WaitStatus
+			if _, err = syscall.Wait4(tid, &s, waitOptions, nil); err != nil {
+				logger.Error("attach:Wait4", zap.Error(err), zap.Int("pid", pid), zap.Int("tid", tid))
+				return nil, "", err
+			}
+			seen[tid] = true
+			threads = append(threads, tid)
+		}
+		if !found {
+			break
+		}
+	}
+	logger.Info("attach", log.Event("process.attach"), log.Pid(pid), zap.String("exefile", exefile), zap.Ints("threads", threads))
+	attached = true
+	for _, tid := range threads {
+		if err = ptraceSetTraceOptions(tid); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return &exec.Cmd{Path: exefile, Process: p}, exefile, nil
+}
+
+// checkBuildId returns the error if the build id of exefile is not the one mapped by the process pid,
+// like the binary rebuilt after the process started. The binary without any build id is not checked
+func checkBuildId(pid int, exefile string) error {
+	file, err := mapFile(exefile)
+	if err != nil {
+		return err
+	}
+	defer file.close()
+	addr, id, err := file.buildIDBytes()
+	if err != nil || id == nil {
+		return err
+	}
+	mapped := make([]byte, len(id))
+	if _, err = readMemory(pid, uintptr(addr), mapped); err != nil {
+		return err
+	}
+	if !bytes.Equal(id, mapped) {
+		return fmt.Errorf("the build id of %s doesn't match the process %d, it may have been rebuilt since the process started", exefile, pid)
+	}
+	return nil
+}
+
+// targetThreads returns every thread of the debuggee that godbg traces
+func targetThreads() []int {
+	if len(threads) == 0 {
+		return []int{cmd.Process.Pid}
+	}
+	return threads
+}
+
+// detach restores the original instructions of every breakpoint and lets the debuggee go,
+// it is killed instead of being resumed if kill is true
+func detach(kill bool) (int, error) {
+	var (
+		pid int
+		err error
+	)
+	if cmd == nil || cmd.Process == nil {
+		return 0, NoProcessRuning
+	}
+	pid = cmd.Process.Pid
+	// the process of the core file has gone already
+	if core != nil {
+		closeCore()
+		return pid, nil
+	}
+
+	if kill {
+		if replay != nil {
+			replay.close()
+			replay = nil
+		} else {
+			killProcess()
+		}
+		threads, curThread, curGoroutine, curFrame = nil, 0, nil, 0
+		bp.pendingSignal = 0
+		attached = false
+		cmd.Process = nil
+		return pid, nil
+	}
+
+	for _, info := range bp.infos {
+		if err = bp.disableBreakPoint(info); err != nil {
+			logger.Error("detach:disableBreakPoint", zap.Error(err), zap.Uint64("pc", info.pc))
+			return pid, err
+		}
+	}
+	for _, info := range bp.infos {
+		if info.kind == INTERNALBPTYPE {
+			bp.clearInternalBreakPoint(info.pc)
+		}
+	}
+	bp.clearPanicBreakPoints()
+
+	if replay != nil {
+		err = replay.detach()
+		replay = nil
+		threads, curThread, curGoroutine, curFrame = nil, 0, nil, 0
+		attached = false
+		cmd.Process = nil
+		return pid, err
+	}
+	tids := targetThreads()
+	// the threads are detached with the process
+	if stopsProcess {
+		tids = []int{pid}
+	}
+	// the signal stopping the debuggee is delivered on detaching like on continuing, it is not lost
+	sig := bp.pendingSignal
+	bp.pendingSignal = 0
+	for _, tid := range tids {
+		s := 0
+		if tid == bp.signalThread || stopsProcess {
+			s = int(sig)
+		}
+		if err = ptraceDetach(tid, s); err != nil && err != syscall.ESRCH {
+			logger.Error("detach:ptraceDetach", zap.Error(err), zap.Int("pid", pid), zap.Int("tid", tid))
+			return pid, err
+		}
+	}
+	// a process stopped by SIGSTOP before attaching keeps stopped after PTRACE_DETACH
+	if err = syscall.Kill(pid, syscall.SIGCONT); err != nil {
+		return pid, err
+	}
+
+	threads = nil
+	curThread = 0
+	curGoroutine = nil
+	curFrame = 0
+	attached = false
+	cmd.Process = nil
+	return pid, nil
+}
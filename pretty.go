@@ -0,0 +1,499 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// printer renders the values in the memory of the debuggee by the layouts of the runtime of go,
+// bounded by loadConfig
+type printer struct {
+	// visited are the addresses of the pointers being followed, a pointer back to one of them is a cycle
+	visited map[uint64]bool
+	// depth is the composite values nesting the one rendered, pointers is the pointers followed to it
+	depth int
+	pointers int
+}
+
+func newPrinter() *printer {
+	return &printer{visited: make(map[uint64]bool)}
+}
+
+// formatExpr evaluates expr and renders its value. The composite values are rendered from the places
+// where they are, the strings are shown as they are like print always does, with the bytes cut counted
+func formatExpr(expr string) (string, error) {
+	defer observe("eval", time.Now())
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return "", err
+	}
+	switch node.(type) {
+	case *ast.Ident, *ast.SelectorExpr, *ast.StarExpr, *ast.IndexExpr, *ast.ParenExpr, *ast.CallExpr:
+		if l, err := evalLvalue(node); err == nil && (!isBasicType(l.typ) || hasFormatter(l)) {
+			if l.reg == "" {
+				return newPrinter().format(l.typ, l.addr)
+			}
+			word, err := l.load()
+			if err != nil {
+				return "", err
+			}
+			return newPrinter().formatWord(l.typ, word)
+		} else if err == nil && l.reg == "" && isString(l.typ) {
+			// the string in the memory is read up to loadConfig.maxStringLen, not loaded in full and cut
+			s, more, err := loadStringAt(l.addr, loadConfig.maxStringLen)
+			if err != nil {
+				return "", err
+			}
+			if more > 0 {
+				return fmt.Sprintf("%s...+%d more", s, more), nil
+			}
+			return s, nil
+		}
+	}
+	v, err := evalNode(node)
+	if err != nil {
+		return "", err
+	}
+	if v.Kind() == constant.String {
+		if s, more := truncateString(constant.StringVal(v)); more > 0 {
+			return fmt.Sprintf("%s...+%d more", s, more), nil
+		}
+		return constant.StringVal(v), nil
+	}
+	return formatNumber(v), nil
+}
+
+// formatNumber renders the integers in numberFormat, like 0x1f, 0b101, 0o17 or 'a', the others as formatValue does.
+// The chars which are not valid are shown in decimal
+func formatNumber(v constant.Value) string {
+	if v.Kind() != constant.Int {
+		return formatValue(v)
+	}
+	switch numberFormat {
+	case 'x':
+		return fmt.Sprintf("%#x", constant.Val(v))
+	case 'b':
+		return fmt.Sprintf("%#b", constant.Val(v))
+	case 'o':
+		return fmt.Sprintf("%O", constant.Val(v))
+	case 'c':
+		if r, ok := constant.Int64Val(v); ok && r >= 0 && r <= unicode.MaxRune {
+			return strconv.QuoteRune(rune(r))
+		}
+	}
+	return formatValue(v)
+}
+
+// hasFormatter tells whether the value in the memory at l is rendered by a formatter registered
+func hasFormatter(l *lvalue) bool {
+	_, ok := findFormatter(l.typ)
+	return ok && l.reg == ""
+}
+
+// truncateString cuts the string computed by the evaluator, like a concatenation, to loadConfig.maxStringLen when
+// it is shown. The bytes cut are counted
+func truncateString(s string) (string, int64) {
+	if len(s) <= loadConfig.maxStringLen {
+		return s, 0
+	}
+	return s[:loadConfig.maxStringLen], int64(len(s) - loadConfig.maxStringLen)
+}
+
+// isString tells whether typ is string or a named string type
+func isString(typ dwarf.Type) bool {
+	t, ok := resolveType(typ).(*dwarf.StructType)
+	return ok && isStringType(t)
+}
+
+// isBasicType tells whether typ is a number, a bool or a string, which evalNode loads
+func isBasicType(typ dwarf.Type) bool {
+	switch t := resolveType(typ).(type) {
+	case *dwarf.IntType, *dwarf.UintType, *dwarf.BoolType, *dwarf.FloatType:
+		return true
+	case *dwarf.StructType:
+		return isStringType(t)
+	}
+	return false
+}
+
+// isPointerShaped tells whether the value of typ is a pointer, which an interface keeps in its data word
+func isPointerShaped(typ dwarf.Type) bool {
+	if td, ok := typ.(*dwarf.TypedefType); ok && (strings.HasPrefix(td.Name, "chan ") || strings.HasPrefix(td.Name, "map[")) {
+		return true
+	}
+	switch resolveType(typ).(type) {
+	case *dwarf.PtrType, *dwarf.FuncType:
+		return true
+	}
+	return false
+}
+
+// format renders the value of typ at addr, the types with the formatters registered are rendered by them
+func (p *printer) format(typ dwarf.Type, addr uint64) (string, error) {
+	if f, ok := findFormatter(typ); ok {
+		if s, err := f(p, typ, addr); err == nil {
+			return s, nil
+		}
+	}
+	if isPointerShaped(typ) {
+		word, err := readWord(addr)
+		if err != nil {
+			return "", err
+		}
+		return p.formatWord(typ, word)
+	}
+	switch t := resolveType(typ).(type) {
+	case *dwarf.IntType, *dwarf.UintType, *dwarf.BoolType, *dwarf.FloatType:
+		v, err := loadValue(t, addr)
+		if err != nil {
+			return "", err
+		}
+		return formatNumber(v), nil
+	case *dwarf.ComplexType:
+		return formatComplex(t, addr)
+	case *dwarf.ArrayType:
+		if p.tooDeep() {
+			return "[...]", nil
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+		return p.formatElements(t.Type, addr, t.Count)
+	case *dwarf.StructType:
+		if isStringType(t) {
+			s, more, err := loadStringAt(addr, loadConfig.maxStringLen)
+			if err != nil {
+				return "", err
+			}
+			if more > 0 {
+				return fmt.Sprintf("%q...+%d more", s, more), nil
+			}
+			return strconv.Quote(s), nil
+		}
+		if p.tooDeep() {
+			if isSliceType(t) {
+				return "[...]", nil
+			}
+			return "{...}", nil
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+		switch {
+		case isSliceType(t):
+			array, ok := resolveType(t.Field[0].Type).(*dwarf.PtrType)
+			if !ok {
+				break
+			}
+			mem := make([]byte, 16)
+			if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+				return "", err
+			}
+			return p.formatElements(array.Type, binary.LittleEndian.Uint64(mem), int64(binary.LittleEndian.Uint64(mem[8:])))
+		case t.StructName == "runtime.eface" || t.StructName == "runtime.iface":
+			return p.formatInterface(t, addr)
+		}
+		return p.formatStruct(t, addr)
+	}
+	return "", fmt.Errorf("not support type %s", typ.String())
+}
+
+// tooDeep tells whether the composite value rendered is nested more than loadConfig.maxStructDepth
+func (p *printer) tooDeep() bool {
+	return p.depth >= loadConfig.maxStructDepth
+}
+
+// formatWord renders a pointer, a map, a channel or a function whose value is word
+func (p *printer) formatWord(typ dwarf.Type, word uint64) (string, error) {
+	if td, ok := typ.(*dwarf.TypedefType); ok && (strings.HasPrefix(td.Name, "map[") || strings.HasPrefix(td.Name, "chan ")) {
+		if p.tooDeep() && word != 0 {
+			return "[...]", nil
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+		switch {
+		case strings.HasPrefix(td.Name, "map["):
+			return p.formatMap(td, word)
+		case strings.HasPrefix(td.Name, "chan "):
+			return p.formatChan(td, word)
+		}
+	}
+	switch t := resolveType(typ).(type) {
+	case *dwarf.FuncType:
+		if word == 0 {
+			return "nil", nil
+		}
+		// a func value points to the closure, whose first word is the code
+		code, err := readWord(word)
+		if err != nil {
+			return "", err
+		}
+		f, err := bi.findFunctionIncludePc(code)
+		if err != nil {
+			return fmt.Sprintf("%#x", code), nil
+		}
+		return f.name, nil
+	case *dwarf.PtrType:
+		if word == 0 {
+			return "nil", nil
+		}
+		if t.Type == nil {
+			return fmt.Sprintf("%#x", word), nil
+		}
+		switch resolveType(t.Type).(type) {
+		case *dwarf.StructType, *dwarf.ArrayType:
+		default:
+			return fmt.Sprintf("%#x", word), nil
+		}
+		if p.visited[word] || p.pointers >= loadConfig.followPointers {
+			return fmt.Sprintf("(%s)(%#x)", dwarfTypeName(typ), word), nil
+		}
+		p.visited[word] = true
+		p.pointers++
+		defer func() {
+			delete(p.visited, word)
+			p.pointers--
+		}()
+		s, err := p.format(t.Type, word)
+		if err != nil {
+			return "", err
+		}
+		return "&" + s, nil
+	}
+	return "", fmt.Errorf("not support type %s", typ.String())
+}
+
+// formatValueOrErr renders the nested values, the ones which can't be read show why
+func (p *printer) formatValueOrErr(typ dwarf.Type, addr uint64) string {
+	s, err := p.format(typ, addr)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return s
+}
+
+// formatElements renders n elements of elem from addr, the ones after loadConfig.maxArrayValues are counted only
+func (p *printer) formatElements(elem dwarf.Type, addr uint64, n int64) (string, error) {
+	max := int64(loadConfig.maxArrayValues)
+	values := make([]string, 0)
+	for i := int64(0); i < n && i < max; i++ {
+		values = append(values, p.formatValueOrErr(elem, addr + uint64(i * elem.Size())))
+	}
+	if n > max {
+		values = append(values, fmt.Sprintf("...+%d more", n - max))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(values, ", ")), nil
+}
+
+// formatStruct renders the fields of the struct at addr like `{x: 1, y: 2}`
+func (p *printer) formatStruct(t *dwarf.StructType, addr uint64) (string, error) {
+	fields := make([]string, 0, len(t.Field))
+	for _, f := range t.Field {
+		fields = append(fields, fmt.Sprintf("%s: %s", f.Name, p.formatValueOrErr(f.Type, addr + uint64(f.ByteOffset))))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(fields, ", ")), nil
+}
+
+// formatInterface renders runtime.eface { _type; data } or runtime.iface { tab; data } like `(main.T) {x: 1}`
+func (p *printer) formatInterface(t *dwarf.StructType, addr uint64) (string, error) {
+	typ, data, err := interfaceWords(t, addr)
+	if err != nil {
+		return "", err
+	}
+	return p.formatDynamic(typ, data), nil
+}
+
+// interfaceWords reads the runtime._type and the data of the interface at addr, the dynamic type of an
+// iface is tab.Type, or tab._type of runtime.itab before go1.22
+func interfaceWords(t *dwarf.StructType, addr uint64) (uint64, uint64, error) {
+	mem := make([]byte, 16)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+		return 0, 0, err
+	}
+	typ, data := binary.LittleEndian.Uint64(mem), binary.LittleEndian.Uint64(mem[8:])
+	if t.StructName == "runtime.iface" && typ != 0 {
+		itab, field := "internal/abi.ITab", "Type"
+		if bi.goVersion.before(1, 22) {
+			itab, field = "runtime.itab", "_type"
+		}
+		tab, err := bi.structType(itab)
+		if err != nil {
+			return 0, 0, err
+		}
+		off, _, err := fieldOffset(tab, field)
+		if err != nil {
+			return 0, 0, err
+		}
+		if typ, err = readWord(typ + uint64(off)); err != nil {
+			return 0, 0, err
+		}
+	}
+	return typ, data, nil
+}
+
+// dynamicType finds the dwarf type of the runtime._type at typ by DW_AT_go_runtime_type
+func (bi *BI) dynamicType(typ uint64) (dwarf.Type, error) {
+	off, ok := bi.runtimeTypeOffset(typ - bi.TypesAddr)
+	if !ok {
+		return nil, fmt.Errorf("unknown type %#x", typ)
+	}
+	return bi.dwarfType(off)
+}
+
+// formatDynamic renders the value of an interface whose runtime._type is at typ, data points to the value
+// unless the value is pointer shaped
+func (p *printer) formatDynamic(typ uint64, data uint64) string {
+	if typ == 0 {
+		return "nil"
+	}
+	t, err := bi.dynamicType(typ)
+	if err != nil {
+		return fmt.Sprintf("(unknown type %#x) %#x", typ, data)
+	}
+	var s string
+	if isPointerShaped(t) {
+		s, err = p.formatWord(t, data)
+	} else {
+		s, err = p.format(t, data)
+	}
+	if err != nil {
+		s = fmt.Sprintf("%#x", data)
+	}
+	return fmt.Sprintf("(%s) %s", dwarfTypeName(t), s)
+}
+
+// formatMap renders the entries of a map sorted by the keys, like `map[k: v]`
+func (p *printer) formatMap(td *dwarf.TypedefType, word uint64) (string, error) {
+	if word == 0 {
+		return "map[]", nil
+	}
+	entries, err := mapEntries(td, word)
+	if err != nil {
+		return "", err
+	}
+	// the keys are loaded to sort the entries, the bools and the ones which are not numbers or strings are
+	// sorted by their texts. Only the entries shown are formatted
+	type sortKey struct {
+		entry *mapEntry
+		key constant.Value
+		text string
+	}
+	keys := make([]sortKey, 0, len(entries))
+	for _, e := range entries {
+		k := sortKey{entry: e}
+		if k.key, _ = loadValue(e.keyType, e.key); k.key == nil {
+			k.text = p.formatValueOrErr(e.keyType, e.key)
+		} else if k.key.Kind() == constant.Bool {
+			k.text = k.key.String()
+		}
+		keys = append(keys, k)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		x, y := keys[i].key, keys[j].key
+		if x != nil && y != nil && x.Kind() == y.Kind() && x.Kind() != constant.Bool {
+			return constant.Compare(x, token.LSS, y)
+		}
+		return keys[i].text < keys[j].text
+	})
+	shown := make([]string, 0, len(keys))
+	for i, k := range keys {
+		if i == loadConfig.maxArrayValues {
+			shown = append(shown, fmt.Sprintf("...+%d more", len(keys) - loadConfig.maxArrayValues))
+			break
+		}
+		e := k.entry
+		shown = append(shown, fmt.Sprintf("%s: %s", p.formatValueOrErr(e.keyType, e.key), p.formatValueOrErr(e.elemType, e.elem)))
+	}
+	return fmt.Sprintf("map[%s]", strings.Join(shown, ", ")), nil
+}
+
+// derefStructType returns the struct which typ points to through n pointers
+func derefStructType(typ dwarf.Type, n int) (*dwarf.StructType, bool) {
+	for i := 0; i < n; i++ {
+		pt, ok := resolveType(typ).(*dwarf.PtrType)
+		if !ok {
+			return nil, false
+		}
+		typ = pt.Type
+	}
+	st, ok := resolveType(typ).(*dwarf.StructType)
+	return st, ok
+}
+
+// formatChan renders the elements buffered in a channel like `[1, 2] (len 2, cap 3)`
+func (p *printer) formatChan(td *dwarf.TypedefType, word uint64) (string, error) {
+	if word == 0 {
+		return "nil", nil
+	}
+	c, err := loadChannel(td, word)
+	if err != nil {
+		return "", err
+	}
+	state := ""
+	if c.closed {
+		state = ", closed"
+	}
+	return fmt.Sprintf("%s (len %d, cap %d%s)", p.formatBuffer(c), c.qcount, c.dataqsiz, state), nil
+}
+
+// formatBuffer renders the elements buffered in the channel c, the ones after loadConfig.maxArrayValues
+// are counted only
+func (p *printer) formatBuffer(c *Channel) string {
+	max := uint64(loadConfig.maxArrayValues)
+	values := make([]string, 0)
+	for i := uint64(0); i < c.qcount && i < max && c.dataqsiz > 0; i++ {
+		values = append(values, p.formatValueOrErr(c.elem, c.element(i)))
+	}
+	if c.qcount > max {
+		values = append(values, fmt.Sprintf("...+%d more", c.qcount - max))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(values, ", "))
+}
+
+// elemType returns DW_AT_go_elem of the named type like `chan int`
+func (bi *BI) elemType(name string) (dwarf.Type, error) {
+	off, ok := bi.typeOffset(name)
+	if !ok {
+		return nil, fmt.Errorf("can't find type %s", name)
+	}
+	r := bi.DwarfData.Reader()
+	r.Seek(off)
+	entry, err := r.Next()
+	if err != nil {
+		return nil, err
+	}
+	elem, ok := entry.Val(AttrGoElem).(dwarf.Offset)
+	if !ok {
+		return nil, fmt.Errorf("type %s has no element type", name)
+	}
+	return bi.dwarfType(elem)
+}
+
+// formatComplex renders complex64 and complex128 like `(1-2i)`
+func formatComplex(t *dwarf.ComplexType, addr uint64) (string, error) {
+	mem := make([]byte, t.Size())
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(addr), mem); err != nil {
+		return "", err
+	}
+	var re, im float64
+	switch t.Size() {
+	case 8:
+		re = float64(math.Float32frombits(binary.LittleEndian.Uint32(mem)))
+		im = float64(math.Float32frombits(binary.LittleEndian.Uint32(mem[4:])))
+	case 16:
+		re = math.Float64frombits(binary.LittleEndian.Uint64(mem))
+		im = math.Float64frombits(binary.LittleEndian.Uint64(mem[8:]))
+	default:
+		return "", fmt.Errorf("not support type %s", t.String())
+	}
+	return fmt.Sprintf("(%g%+gi)", re, im), nil
+}
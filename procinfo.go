@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var NoProcInfoErr = errors.New("the auxv and the memory maps are only read from the processes traced by godbg")
+
+// MemoryMap is a mapping of the address space of the debuggee, Perms is like `r-xp` of /proc/<pid>/maps and
+// Path is empty for the anonymous ones
+type MemoryMap struct {
+	Start  uint64
+	End    uint64
+	Offset uint64
+	Perms  string
+	Path   string
+}
+
+// copy from <elf.h>, the entries of the auxv are the same on linux and freebsd
+var auxvNames = map[uint64]string{
+	0: "AT_NULL", 3: "AT_PHDR", 4: "AT_PHENT", 5: "AT_PHNUM", 6: "AT_PAGESZ", 7: "AT_BASE", 8: "AT_FLAGS",
+	9: "AT_ENTRY", 11: "AT_UID", 12: "AT_EUID", 13: "AT_GID", 14: "AT_EGID",
+}
+
+// checkProcInfo returns the error if the auxv and the maps of the debuggee can't be read, the process run by
+// rr, the remote gdb server or debugserver is not the child of godbg and the core file is no process
+func checkProcInfo() error {
+	if cmd == nil || cmd.Process == nil {
+		return NoProcessRuning
+	}
+	if core != nil || replay != nil {
+		return NoProcInfoErr
+	}
+	return nil
+}
+
+// printAuxv prints the tags and the values of the auxv until AT_NULL, the unknown tags by their numbers
+func printAuxv() {
+	if err := checkProcInfo(); err != nil {
+		printErr(err)
+		return
+	}
+	auxv, err := processAuxv(cmd.Process.Pid)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	for off := 0; off+16 <= len(auxv); off += 16 {
+		tag := binary.LittleEndian.Uint64(auxv[off:])
+		val := binary.LittleEndian.Uint64(auxv[off+8:])
+		if tag == _AT_NULL_AMD64 {
+			break
+		}
+		name, ok := auxvNames[tag]
+		if !ok {
+			name = fmt.Sprintf("AT_%d", tag)
+		}
+		fmt.Fprintf(stdout, "%-4d %-10s %#x\n", tag, name, val)
+	}
+}
+
+// printMappings prints the maps of the debuggee like `info proc mappings` of gdb
+func printMappings() {
+	if err := checkProcInfo(); err != nil {
+		printErr(err)
+		return
+	}
+	maps, err := processMaps(cmd.Process.Pid)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	fmt.Fprintf(stdout, "%-18s %-18s %-10s %-10s %-5s %s\n", "Start", "End", "Size", "Offset", "Perms", "Path")
+	for _, m := range maps {
+		line := fmt.Sprintf("%#-18x %#-18x %#-10x %#-10x %-5s %s", m.Start, m.End, m.End-m.Start, m.Offset, m.Perms, m.Path)
+		fmt.Fprintf(stdout, "%s\n", strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"runtime/pprof"
+)
+
+// profileFile is where `--profile cpu.out` writes the cpu profile of the session, it is nil without the flag
+var profileFile *os.File
+
+// startProfile profiles the cpu into filename until stopProfile, `go tool pprof godbg cpu.out` reads it
+func startProfile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	profileFile = f
+	return nil
+}
+
+// stopProfile flushes the profile, it is called on quit too since os.Exit skips the deferred calls of main
+func stopProfile() {
+	if profileFile == nil {
+		return
+	}
+	pprof.StopCPUProfile()
+	profileFile.Close()
+	profileFile = nil
+}
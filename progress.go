@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+// AnalyzeCanceledErr is returned when analyzing is interrupted by Ctrl-C
+var AnalyzeCanceledErr = errors.New("analyzing the binary is canceled")
+
+// everyPercent calls f only when the percentage of the units parsed changes, so a binary of many units is not
+// drawn unit by unit
+func everyPercent(f func(done int, total int, percent int)) loadProgress {
+	last := -1
+	return func(done int, total int) {
+		percent := 100
+		if total > 0 {
+			percent = done * 100 / total
+		}
+		if percent != last {
+			last = percent
+			f(done, total, percent)
+		}
+	}
+}
+
+// analyzeInterruptibly analyzes execfile before the prompt, Ctrl-C cancels it. The progress is drawn on stderr if
+// it is a terminal
+func analyzeInterruptibly(execfile string) (*BI, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var (
+		progress loadProgress
+		drawn    bool
+	)
+	if _, _, ok := windowSize(os.Stderr); ok && stderr == io.Writer(os.Stderr) {
+		progress = everyPercent(func(done int, total int, percent int) {
+			drawn = true
+			fmt.Fprintf(stderr, "\rload the debug info %d/%d compile units %3d%%", done, total, percent)
+		})
+	}
+	bi, err := analyzeContext(ctx, execfile, progress)
+	if drawn {
+		fmt.Fprintf(stderr, "\n")
+	}
+	if err == context.Canceled {
+		return nil, AnalyzeCanceledErr
+	}
+	return bi, err
+}
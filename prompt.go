@@ -2,21 +2,40 @@ package main
 
 import (
 	"bytes"
-	"debug/dwarf"
 	"encoding/binary"
 	"fmt"
 	"github.com/c-bata/go-prompt"
+	"github.com/chainhelen/godbg/log"
 	"go.uber.org/zap"
-	"golang.org/x/arch/x86/x86asm"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
-	"unsafe"
 )
 
+// executor runs the input, the aliases are expanded to the commands first
 func executor(input string) {
+	recordCommand(input)
+	commands, err := expandAlias(input)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	for _, command := range commands {
+		if jsonOutput && runJSONCommand(command) {
+			continue
+		}
+		runCommand(command)
+	}
+}
+
+// runCommand runs a builtin command or a command defined by a script
+func runCommand(input string) {
 	logger.Debug("executor", zap.String("input", input))
 	if len(input) == 0 {
 		return
@@ -26,665 +45,1889 @@ func executor(input string) {
 	switch fs {
 	case 'q':
 		if input == "q" || input == "quit"{
-			if cmd.Process != nil {
-				if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
-					// printErr(err)
-				}
+			if err := clearTargets(); err != nil {
+				printErr(err)
+			}
+			if err := releaseProcess(); err != nil {
+				printErr(err)
 			}
+			// the binary built by godbg is removed, the deferred removing in main doesn't run after os.Exit
+			removeBuilt()
 			if os.Getenv("GODBG_TEST") != "" {
 				return
 			}
+			stopProfile()
 			os.Exit(0)
 		}
 	case 'b':
 		sps := strings.Split(input, " ")
-		if len(sps) == 2 && (sps[0] == "b" || sps[0] == "break") {
-			filename, line, err := parseLoc(sps[1])
+		if (len(sps) == 2 || (len(sps) == 3 && sps[1] == "-hw")) && (sps[0] == "b" || sps[0] == "break") {
+			loc := sps[len(sps) - 1]
+			bInfo, err := setLocBreakPoint(loc, len(sps) == 3)
 			if err != nil {
-				printUnsupportCmd(input)
-				return
-			}
-			if bInfo, err := bp.SetFileLineBreakPoint(filename, line); err != nil {
 				if err == HasExistedBreakPointErr {
-					printHasExistedBreakPoint(sps[1])
+					printHasExistedBreakPoint(loc)
 					return
 				}
 				if err == NotFoundSourceLineErr {
-					printNotFoundSourceLineErr(sps[1])
+					printNotFoundSourceLineErr(loc)
 					return
 				}
 				printErr(err)
 				return
+			} else if bInfo.hardware {
+				fmt.Fprintf(stdout,"godbg add %s:%d hardware breakpoint successfully\n",bInfo.filename, bInfo.lineno)
 			} else {
 				fmt.Fprintf(stdout,"godbg add %s:%d breakpoint successfully\n",bInfo.filename, bInfo.lineno)
 			}
 			return
 		}
 		if len(sps) == 2 && (sps[0] == "bc" || sps[0] == "bclear") {
-
 			if sps[1] == "all" {
-				tmp := make([]*BInfo, 0, len(bp.infos))
-				for _, v := range bp.infos {
-					if v.kind == USERBPTYPE {
-						bp.disableBreakPoint(v)
-					} else {
-						tmp = append(tmp, v)
-					}
+				if err := bp.ClearAll(); err != nil {
+					printErr(err)
 				}
-				bp.infos = tmp
 				return
 			}
 
-			if needClearIndex, err := strconv.Atoi(sps[1]); err == nil {
-				if needClearIndex > len(bp.infos) {
-					printErr(fmt.Errorf("can't find breakpoint index %d", needClearIndex))
+			if id, err := strconv.Atoi(sps[1]); err == nil {
+				if _, err = bp.Clear(id); err != nil {
+					printErr(err)
+					return
 				}
-				count := 0
-				for i, v := range bp.infos {
-					if v.kind == USERBPTYPE {
-						count++
-						if count == needClearIndex {
-							bp.disableBreakPoint(v)
-							bp.infos = append(bp.infos[:i], bp.infos[(i + 1):len(bp.infos)]...)
-							fmt.Fprintf(stdout, "clear breakpoint %d successfully, resort breakpoint again\n", needClearIndex)
-							return
-						}
-					}
+				fmt.Fprintf(stdout, "clear breakpoint %d successfully\n", id)
+				return
+			}
+		}
+		if len(sps) == 2 && (sps[0] == "bd" || sps[0] == "bdisable" || sps[0] == "be" || sps[0] == "benable") {
+			if id, err := strconv.Atoi(sps[1]); err == nil {
+				var info *BInfo
+				if sps[0] == "bd" || sps[0] == "bdisable" {
+					info, err = bp.Disable(id)
+				} else {
+					info, err = bp.Enable(id)
+				}
+				if err != nil {
+					printErr(err)
+					return
+				}
+				if info.disabled {
+					fmt.Fprintf(stdout, "disable breakpoint %d %s:%d\n", id, info.filename, info.lineno)
+				} else {
+					fmt.Fprintf(stdout, "enable breakpoint %d %s:%d\n", id, info.filename, info.lineno)
 				}
-				printErr(fmt.Errorf("can't find breakpoint index %d", needClearIndex))
 				return
 			}
 		}
 		if len(sps) == 1 && (sps[0] == "bl") {
-			count := 0
-			for _, v := range bp.infos {
-				if v.kind == USERBPTYPE {
-					count++
-					fmt.Fprintf(stdout,"%-2d. %s:%d, pc %d\n", count, v.filename, v.lineno, v.pc)
+			infos := bp.List()
+			for _, v := range infos {
+				if v.watch != nil {
+					fmt.Fprintf(stdout,"%-2d. watch %s, addr 0x%x, %d bytes%s\n", v.id, v.watch.name, v.watch.addr, v.watch.size, breakPointFlags(v))
+					continue
 				}
+				fmt.Fprintf(stdout,"%-2d. %s:%d, pc %d%s\n", v.id, v.filename, v.lineno, v.pc, breakPointFlags(v))
 			}
-			if count == 0 {
+			if len(infos) == 0 {
 				fmt.Fprintf(stdout,"there is no breakpoint\n")
 			}
 			return
 		}
 		if len(sps) == 2 && (sps[0] == "bl" && sps[1] == "all") {
-			count := 0
 			for _, v := range bp.infos {
-				count++
-				fmt.Fprintf(stdout,"%-2d. %s:%d, pc %d, type %s\n", count, v.filename, v.lineno, v.pc, v.kind.String())
+				fmt.Fprintf(stdout,"%-2d. %s:%d, pc %d, type %s%s\n", v.id, v.filename, v.lineno, v.pc, v.kind.String(), breakPointFlags(v))
 			}
-			if count == 0 {
+			if len(bp.infos) == 0 {
 				fmt.Fprintf(stdout,"there is no breakpoint\n")
 			}
 			return
 		}
-		if len(sps) == 1 && sps[0] == "bt" {
-			var (
-				rbp uint64
-				err error
-				filename string
-				line int
-				pc uint64
-				f *Function
-				ok bool
-			)
-			if rbp, err = getPtraceBp();err != nil {
-				printErr(err)
-				return
-			}
-			if pc, err = getPtracePc(); err!= nil {
-				printErr(err)
+		if (len(sps) == 1 || (len(sps) == 2 && sps[1] == "-defer")) && sps[0] == "bt" {
+			if cmd.Process == nil {
+				printNoProcessErr()
 				return
 			}
-
-			if _, ok = bp.findBreakPoint(pc - 1); ok {
-				pc = pc - 1
-			}
-			if filename, line, err = bi.pcTofileLine(pc); err != nil {
+			frames, err := Stacktrace()
+			if err != nil {
 				printErr(err)
 				return
 			}
-			fmt.Fprintf(stdout, "%s:%d\n", filename, line)
-
-			ret := uint64(0)
-			for {
-				original := make([]byte, 16)
-				_, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(rbp), original)
-				if err != nil {
-					printErr(err)
-					return
-				}
-				reader := bytes.NewBuffer(original)
-
-				//fmt.Fprintf(stdout, "rbp %d\n", rbp)
-				if err = binary.Read(reader, binary.LittleEndian, &rbp); err != nil {
-					printErr(err)
-					return
-				}
-				if err = binary.Read(reader, binary.LittleEndian, &ret); err != nil {
+			var defers []*DeferredCall
+			if len(sps) == 2 {
+				if defers, err = Defers(); err != nil {
 					printErr(err)
 					return
 				}
-				//fmt.Fprintf(stdout, "ret = %d\n", ret)
-				if filename, line, err = bi.pcTofileLine(ret - 1); err != nil {
-					printErr(err)
-					return
-				}
-				if f, err = bi.findFunctionIncludePc(ret - 1); err != nil {
-					// printErr(err)
-					return
-				}
-				fmt.Fprintf(stdout, "%s:%d %s\n", filename, line, f.name)
 			}
-
-			/*
-			reader = bytes.NewBuffer(original[32:])
-			if err = binary.Read(reader, binary.LittleEndian, &tmp); err != nil {
-				printErr(err)
-				return
+			for _, f := range frames {
+				printStackframe(f)
+				for i, d := range deferredBy(defers, f) {
+					fmt.Fprintf(stdout, "    defer %d: %s\n", i, d)
+				}
 			}
-			fmt.Fprintf(stdout, "%d\n", tmp)
-*/
-			// strings.NewReader(original[:16])
-
 			return
 		}
 	case 'c':
 		sps := strings.Split(input, " ")
-		if len(sps) == 1 && (sps[0] == "c" || sps[0] == "continue") {
+		if len(sps) >= 2 && sps[0] == "call" {
 			if cmd.Process == nil {
 				printNoProcessErr()
 				return
 			}
-
-			/*
-			version 1
-			if ok, err := bp.singleStepInstructionWithBreakpointCheck(); err != nil {
-				printErr(err)
-				return
-			} else if ok {
-				if err := bp.Continue(); err != nil {
-					printErr(err)
-					return
-				}
-				var s syscall.WaitStatus
-				wpid, err := syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil)
-				if err != nil {
-					printErr(err)
-					return
-				}
-				status := (syscall.WaitStatus)(s)
-				if status.Exited() {
-					// TODO
-					if cmd.Process != nil && wpid == cmd.Process.Pid {
-						printExit0(wpid)
-					} else {
-						printExit0(wpid)
-					}
-					cmd.Process = nil
-					return
-				}
-			}*/
-
-			/* version 2 */
-			if err := bp.singleStepInstructionWithBreakpointCheck_v2(); err != nil {
+			f, values, err := bp.CallFunction(strings.Join(sps[1:], " "))
+			if err != nil {
 				printErr(err)
 				return
 			}
-			if err := bp.Continue(); err != nil {
-				printErr(err)
-				return
+			if len(values) == 0 {
+				fmt.Fprintf(stdout, "%s returns\n", f.name)
+			} else {
+				fmt.Fprintf(stdout, "%s returns %s\n", f.name, strings.Join(values, ", "))
+			}
+			return
+		}
+		if len(sps) >= 2 && sps[0] == "chan" {
+			printFrameVariables(func() ([]string, error) { return ChannelState(strings.Join(sps[1:], " ")) })
+			return
+		}
+		if len(sps) == 1 && sps[0] == "config" {
+			for _, c := range LoadConfigs() {
+				fmt.Fprintf(stdout, "%s\n", c)
 			}
-			var (
-				s syscall.WaitStatus
-				pc uint64
-			)
-			wpid, err := syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil)
+			return
+		}
+		if len(sps) == 2 && sps[0] == "config" && sps[1] == "-save" {
+			filename, err := SaveConfigFile()
 			if err != nil {
 				printErr(err)
 				return
 			}
-
-			if s.Exited() {
-				printExit0(wpid)
-				cmd.Process = nil
-				return
+			fmt.Fprintf(stdout, "save the config to %s\n", filename)
+			return
+		}
+		if len(sps) == 2 && sps[0] == "config" && sps[1] == "format" {
+			lines := Formatters()
+			if len(lines) == 0 {
+				fmt.Fprintf(stdout, "%s\n", "there is no format")
 			}
-
-			if n := s.StopSignal(); n != syscall.SIGTRAP && n != syscall.SIGURG {
-				cmd.Process = nil
-				fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal())
-				return
+			for _, line := range lines {
+				fmt.Fprintf(stdout, "%s\n", line)
 			}
-
-			if pc, err = getPtracePc(); err != nil {
+			return
+		}
+		if len(sps) == 4 && sps[0] == "config" && sps[1] == "format" {
+			if err := SetFormatter(sps[2], sps[3]); err != nil {
 				printErr(err)
 				return
 			}
-			fmt.Fprintf(stdout,"current process pc = %d\n", pc)
-			if err = listFileLineByPtracePc(6); err != nil {
+			fmt.Fprintf(stdout, "%s = %s\n", sps[2], sps[3])
+			return
+		}
+		if len(sps) == 3 && sps[0] == "config" && sps[1] == "number-format" {
+			if err := SetNumberFormat(sps[2]); err != nil {
 				printErr(err)
 				return
 			}
+			fmt.Fprintf(stdout, "%s = %s\n", sps[1], sps[2])
 			return
 		}
-	case 's':
-		sps := strings.Split(input, " ")
-		if len(sps) == 1 && (sps[0] == "s" || sps[0] == "step") {
-			var (
-				err error
-				filename string
-				lineno int
-				oldfilename string
-				oldlineno int
-				pc uint64
-				info *BInfo
-				ok bool
-			)
-			if oldfilename, oldlineno, err = bi.getCurFileLineByPtracePc(); err != nil {
-				printErr(err)
-				return
-			}
-			for {
-				if pc, err = getPtracePc(); err != nil {
-					printErr(err)
-					return
-				}
-				if filename, lineno, err = bi.pcTofileLine(pc); err != nil {
-					printErr(err)
-					return
-				}
-
-				if !(filename == oldfilename && lineno == oldlineno) {
-					fmt.Fprintf(stdout,"current process pc = %d\n", pc)
-					if err = listFileLineByPtracePc(6); err != nil {
-						printErr(err)
-						return
-					}
-					return
-				}
-				if info, ok = bp.findBreakPoint(pc - 1); ok {
-					if err = bp.disableBreakPoint(info); err !=nil {
-						printErr(err)
-						return
-					}
-					defer bp.enableBreakPoint(info)
-					if err = setPcRegister(pc - 1); err != nil {
-						printErr(err)
-						return
-					}
-				}
-				if err = syscall.PtraceSingleStep(cmd.Process.Pid); err != nil {
-					printErr(err)
-					return
-				}
-				var s syscall.WaitStatus
-				if _, err = syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil); err != nil {
-					printErr(err)
-					return
-				}
-				if s.Exited() {
-					printExit0(cmd.Process.Pid)
-					cmd.Process = nil
-					return
-				}
-				if n := s.StopSignal(); n != syscall.SIGTRAP && n != syscall.SIGURG {
-					printErr(fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal()))
-					return
-				}
+		if len(sps) == 4 && sps[0] == "config" && sps[1] == "substitute-path" {
+			if err := AddSubstitutePath(sps[2], sps[3]); err != nil {
+				printErr(err)
+				return
 			}
+			fmt.Fprintf(stdout, "%s = %s => %s\n", sps[1], path.Clean(sps[2]), path.Clean(sps[3]))
 			return
 		}
-	case 'n':
-		sps := strings.Split(input, " ")
-		if len(sps) == 1 && (sps[0] == "n" || sps[0] == "next") {
-			var (
-				err error
-				pc uint64
-				info *BInfo
-				ok bool
-				filename string
-				lineno int
-				oldfilename string
-				oldlineno int
-
-				//f *Function
-				inst x86asm.Inst
-			)
-
-			if pc, err = getPtracePc(); err != nil {
+		if len(sps) == 3 && sps[0] == "config" && sps[1] == "substitute-path" {
+			if err := RemoveSubstitutePath(sps[2]); err != nil {
 				printErr(err)
 				return
 			}
-			if info, ok = bp.findBreakPoint(pc - 1); ok {
-				pc = pc - 1
-				if err = setPcRegister(pc); err != nil {
-					printErr(err)
-					return
-				}
-				if err = bp.disableBreakPoint(info); err != nil {
-					printErr(err)
-					return
-				}
-				defer bp.enableBreakPoint(info)
-			}
-			if oldfilename, oldlineno , err = bi.pcTofileLine(pc); err != nil{
+			fmt.Fprintf(stdout, "remove substitute-path %s\n", path.Clean(sps[2]))
+			return
+		}
+		if len(sps) == 3 && sps[0] == "config" && sps[1] == "color" {
+			if err := SetColorMode(sps[2]); err != nil {
 				printErr(err)
 				return
 			}
-			/*if f, err = bi.findFunctionIncludePc(pc); err != nil {
+			fmt.Fprintf(stdout, "%s = %s\n", sps[1], sps[2])
+			return
+		}
+		if len(sps) == 3 && sps[0] == "config" && sps[1] == "max-dwarf-memory" {
+			n, err := SetDwarfBudget(sps[2])
+			if err != nil {
 				printErr(err)
 				return
-			}*/
-
-			calling := false
-			callingfpc := uint64(0)
-
-			for {
-				if pc, err = getPtracePc(); err != nil {
-					printErr(err)
-					return
-				}
-				if info, ok = bp.findBreakPoint(pc - 1); ok {
-					if err := listFileLineByPtracePc(6); err != nil {
-						printErr(err)
-						return
-					}
-					return
-				}
-
-				if calling == true && pc != callingfpc {
-					if err = syscall.PtraceSingleStep(cmd.Process.Pid); err != nil {
-						printErr(err)
-						return
-					}
-					var s syscall.WaitStatus
-					if _, err = syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil); err != nil {
-						printErr(err)
-						return
-					}
-					if s.Exited() {
-						printExit0(cmd.Process.Pid)
-						cmd.Process = nil
-						return
-					}
-					if n := s.StopSignal(); n != syscall.SIGTRAP && n != syscall.SIGURG {
-						printErr(fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal()))
-						return
-					}
-				} else if calling == true && pc == callingfpc {
-					calling = false
-					if filename, lineno, err = bi.pcTofileLine(pc); err != nil {
-						printErr(err)
-						return
-					}
-					if !(filename == oldfilename && lineno == oldlineno) {
-						if err := listFileLineByPtracePc(6); err != nil {
-							printErr(err)
-							return
-						}
-						return
-					}
-				} else {
-					if inst, err = bi.getSingleMemInst(pc); err != nil {
-						printErr(err)
-						return
-					}
-					if inst.Op == x86asm.CALL || inst.Op == x86asm.LCALL {
-						calling = true
-						callingfpc = pc + uint64(inst.Len)
-						continue
-					}
-
-					if err = syscall.PtraceSingleStep(cmd.Process.Pid); err != nil {
-						printErr(err)
-						return
-					}
-					var s syscall.WaitStatus
-					if _, err = syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil); err != nil {
-						printErr(err)
-						return
-					}
-					if s.Exited() {
-						printExit0(cmd.Process.Pid)
-						cmd.Process = nil
-						return
-					}
-					if n := s.StopSignal(); n != syscall.SIGTRAP && n != syscall.SIGURG {
-						printErr(fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal()))
-						return
-					}
-					/*fpc := pc + uint64(inst.Len)
-					if !(f.lowpc <= fpc && fpc < f.highpc) {
-						if err := listFileLineByPtracePc(6); err != nil {
-							printErr(err)
-							return
-						}
-						return
-					}*/
-					if filename, lineno , err = bi.pcTofileLine(pc + uint64(inst.Len)); err != nil{
-						printErr(err)
-						return
-					}
-					if !(filename == oldfilename && lineno == oldlineno) {
-						if err := listFileLineByPtracePc(6); err != nil {
-							printErr(err)
-							return
-						}
-						return
-					}
-				}
 			}
+			fmt.Fprintf(stdout, "%s = %s\n", sps[1], formatSize(n))
+			return
 		}
-	case 'l':
-		sps := strings.Split(input, " ")
-		if len(sps) == 1 && (sps[0] == "l" || sps[0] == "list") {
-			if err := listFileLineByPtracePc(6); err != nil {
+		if len(sps) == 3 && sps[0] == "config" && sps[1] == "source-list-size" {
+			n, err := SetSourceListSize(sps[2])
+			if err != nil {
 				printErr(err)
 				return
 			}
+			fmt.Fprintf(stdout, "%s = %d\n", sps[1], n)
 			return
 		}
-
-		if len(sps) == 2 && (sps[0] == "l" || sps[0] == "list") {
-			filename, line, err := parseLoc(sps[1])
+		if len(sps) == 3 && sps[0] == "config" {
+			n, err := SetLoadConfig(sps[1], sps[2])
 			if err != nil {
-				printUnsupportCmd(input)
-				return
-			}
-			if err = listFileLine(filename, line, 6); err != nil {
 				printErr(err)
 				return
 			}
+			fmt.Fprintf(stdout, "%s = %d\n", sps[1], n)
 			return
 		}
-
-		if len(sps) == 3 && (sps[0] == "l" || sps[0] == "list") {
-			filename, line, err := parseLoc(sps[1])
-			if err != nil {
-				printUnsupportCmd(input)
+		if len(sps) == 1 && sps[0] == "checkpoint" {
+			if cmd.Process == nil {
+				printNoProcessErr()
 				return
 			}
-			rangeline, err := strconv.Atoi(sps[2])
+			c, err := bp.NewCheckpoint()
 			if err != nil {
-				printUnsupportCmd(input)
-				return
-			}
-			if err = listFileLine(filename, line, rangeline); err != nil {
 				printErr(err)
 				return
 			}
+			fmt.Fprintf(stdout, "checkpoint %d %s:%d pid %d\n", c.id, tryCuttingFilename(c.filename), c.lineno, c.pid)
 			return
 		}
-	case 'r':
-		sps := strings.Split(input, " ")
-		if len(sps) == 1 && (sps[0] == "r" || sps[0] == "restart") {
-			pid := 0
-			if cmd.Process != nil {
-				pid = cmd.Process.Pid
-				if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGSTOP); err != nil {
-					err = nil
-					//printErr(err)
-					//return
-				}
-			}
-			if pid != 0 {
-				fmt.Fprintf(stdout, "  stop  old process pid %d\n", pid)
-			}
-			var err error
-			if cmd, err = runexec(execfile); err != nil {
-				printErr(err)
-				logger.Error(err.Error(), zap.String("stage", "restart:runexec"), zap.String("execfile", execfile))
+		if len(sps) == 1 && sps[0] == "checkpoints" {
+			if len(checkpoints) == 0 {
+				fmt.Fprintf(stdout, "%s\n", "there is no checkpoint")
 				return
 			}
-			if err = bp.SetBpWhenRestart(); err != nil {
-				printErr(err)
-				logger.Error(err.Error(), zap.String("stage", "restart:setbp"), zap.String("execfile", execfile))
-				return
+			for _, c := range checkpoints {
+				fmt.Fprintf(stdout, "checkpoint %d %s:%d pid %d\n", c.id, tryCuttingFilename(c.filename), c.lineno, c.pid)
 			}
-			fmt.Fprintf(stdout, "restart new process pid %d \n", cmd.Process.Pid)
 			return
 		}
-	case 'd':
-		sps := strings.Split(input, " ")
-		if len(sps) == 1 && (sps[0] == "disass" || sps[0] == "disassemble") {
-			if err := listDisassembleByPtracePc(); err != nil {
+		if len(sps) >= 3 && (sps[0] == "cond" || sps[0] == "condition") && sps[1] == "-hitcount" {
+			id, err := strconv.Atoi(sps[2])
+			if err != nil {
 				printErr(err)
 				return
 			}
-			return
-		}
-	case 'p':
-		sps := strings.Split(input, " ")
-		if len(sps) == 2 && (sps[0] == "p" || sps[0] == "print") {
-			var (
-				v string
-				pc uint64
-				err error
-				ok bool
-				f *Function
-				frame *Frame
-			)
-			v = sps[1]
-			if pc, err = getPtracePc(); err != nil {
+			info, err := bp.HitCondition(id, strings.Join(sps[3:], " "))
+			if err != nil {
 				printErr(err)
 				return
 			}
-			if _, ok = bp.findBreakPoint(pc - 1); ok {
-				pc--
+			if info.hitCond == nil {
+				fmt.Fprintf(stdout, "remove hitcount condition of breakpoint %d %s:%d\n", id, info.filename, info.lineno)
+			} else {
+				fmt.Fprintf(stdout, "breakpoint %d %s:%d stops when hitcount %s\n", id, info.filename, info.lineno, info.hitCond)
 			}
-			if frame, err = bi.findFrameInformation(pc); err != nil {
+			return
+		}
+		if len(sps) >= 2 && (sps[0] == "cond" || sps[0] == "condition") {
+			id, err := strconv.Atoi(sps[1])
+			if err != nil {
 				printErr(err)
 				return
 			}
-			if f, err = bi.findFunctionIncludePc(pc); err != nil {
+			cond := strings.TrimSpace(strings.Join(sps[2:], " "))
+			info, err := bp.Condition(id, cond)
+			if err != nil {
 				printErr(err)
 				return
 			}
-			for _, fv := range f.variables {
-				isFound := false
-				if field := fv.AttrField(dwarf.AttrName);field != nil {
-					if fieldstr, ok := field.Val.(string); ok && fieldstr == v {
-						isFound = true
-					}
-				}
-				if isFound {
-					var (
-						opcode byte
-					)
-					field := fv.AttrField(dwarf.AttrLocation)
-					buf := bytes.NewBuffer(field.Val.([]byte))
-					if opcode, err = buf.ReadByte(); err != nil {
-						printErr(err)
-						return
-					}
-					switch opcode {
-					case DW_OP_fbreg:
-						num, _,_ := DecodeSLEB128(buf)
-						address := int64(frame.framebase) + num
-						// if the type is `string`
-						val := make([]byte, 8)
-						if _, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(address) + uintptr(8), val); err != nil {
-							printErr(err)
-							return
-						}
-						strlen := int64(binary.LittleEndian.Uint64(val))
-						if strlen < 0 {
-							printErr(fmt.Errorf("strlen %d shoulde be < 0", strlen))
-							return
-						}
-						// read addr
-						if _, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(address), val); err != nil {
-							printErr(err)
-							return
-						}
-						addr := uintptr(binary.LittleEndian.Uint64(val))
-						if addr == 0 {
-							printErr(fmt.Errorf("pointer addr %d shoulde be == 0", addr))
-							return
-						}
-						logger.Debug(fmt.Sprintf("address = %d,  len = %d, addr = %d,, num = %d\n", address, strlen, addr, num))
-
-						strpointer := make([]byte, strlen)
-						if _, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(addr), strpointer); err != nil {
-							printErr(err)
-							return
-						}
-						fmt.Fprintf(stdout, "%v\n", *(*string)(unsafe.Pointer(&strpointer)))
-						return
-					}
-					fmt.Fprintf(stderr, "not support dwarf variable %#v", fv)
-				}
+			if cond == "" {
+				fmt.Fprintf(stdout, "remove condition of breakpoint %d %s:%d\n", id, info.filename, info.lineno)
+			} else {
+				fmt.Fprintf(stdout, "breakpoint %d %s:%d stops when %s\n", id, info.filename, info.lineno, cond)
 			}
 			return
 		}
-	}
-	printUnsupportCmd(input)
-}
+		if len(sps) == 1 && (sps[0] == "c" || sps[0] == "continue") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
 
+			/*
+			version 1
+			if ok, err := bp.singleStepInstructionWithBreakpointCheck(); err != nil {
+				printErr(err)
+				return
+			} else if ok {
+				if err := bp.Continue(); err != nil {
+					printErr(err)
+					return
+				}
+				var s syscall.WaitStatus
+				wpid, err := syscall.Wait4(cmd.Process.Pid, &s, waitOptions, nil)
+				if err != nil {
+					printErr(err)
+					return
+				}
+				status := (syscall.WaitStatus)(s)
+				if status.Exited() {
+					// TODO
+					if cmd.Process != nil && wpid == cmd.Process.Pid {
+						printExit0(wpid)
+					} else {
+						printExit0(wpid)
+					}
+					cmd.Process = nil
+					return
+				}
+			}*/
+
+			continueProcess()
+			return
+		}
+	case 't':
+		sps := strings.Split(input, " ")
+		if sps[0] == "transcript" {
+			var err error
+			switch {
+			case len(sps) == 1 && transcript == nil:
+				fmt.Fprintf(stdout, "%s\n", "there is no transcript")
+			case len(sps) == 1:
+				fmt.Fprintf(stdout, "transcript = %s\n", transcript.filename)
+			case len(sps) == 3 && sps[1] == "on":
+				err = StartTranscript(sps[2])
+			case len(sps) == 2 && sps[1] == "off":
+				err = StopTranscript()
+			default:
+				printUnsupportCmd(input)
+				return
+			}
+			if err != nil {
+				printErr(err)
+			}
+			return
+		}
+		if (len(sps) == 2 || (len(sps) == 3 && sps[1] == "-args")) && sps[0] == "trace" {
+			loc := sps[len(sps) - 1]
+			bInfo, err := setLocBreakPoint(loc, false)
+			if err != nil {
+				if err == HasExistedBreakPointErr {
+					printHasExistedBreakPoint(loc)
+					return
+				}
+				if err == NotFoundSourceLineErr {
+					printNotFoundSourceLineErr(loc)
+					return
+				}
+				printErr(err)
+				return
+			}
+			bInfo.trace, bInfo.traceArgs = true, len(sps) == 3
+			fmt.Fprintf(stdout, "godbg add %s:%d tracepoint successfully\n", bInfo.filename, bInfo.lineno)
+			return
+		}
+		if len(sps) == 1 && sps[0] == "threads" {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			for _, tid := range targetThreads() {
+				mark := " "
+				if tid == currentThread() {
+					mark = "*"
+				}
+				var regs PtraceRegs
+				if err := ptraceGetRegs(tid, &regs); err != nil {
+					printErr(err)
+					return
+				}
+				filename, lineno, err := bi.pcTofileLine(regs.PC())
+				if err != nil {
+					fmt.Fprintf(stdout, "%s thread %d pc %d\n", mark, tid, regs.PC())
+					continue
+				}
+				fmt.Fprintf(stdout, "%s thread %d pc %d %s:%d\n", mark, tid, regs.PC(), tryCuttingFilename(filename), lineno)
+			}
+			return
+		}
+		if len(sps) == 2 && sps[0] == "thread" {
+			tid, err := strconv.Atoi(sps[1])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			if err = SwitchThread(tid); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "switch to thread %d\n", tid)
+			if err = listFileLineByPtracePc(sourceListSize); err != nil {
+				printErr(err)
+			}
+			return
+		}
+		if len(sps) == 2 && sps[0] == "target" && sps[1] == "list" {
+			for _, t := range Targets() {
+				if t == currentTarget {
+					fmt.Fprintf(stdout, "* %s\n", t)
+				} else {
+					fmt.Fprintf(stdout, "  %s\n", t)
+				}
+			}
+			return
+		}
+		if len(sps) == 3 && sps[0] == "target" && sps[1] == "switch" {
+			id, err := strconv.Atoi(sps[2])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			t, err := SwitchTarget(id)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "switch to %s\n", t)
+			if t.Pid() == 0 {
+				return
+			}
+			if err = listFileLineByPtracePc(sourceListSize); err != nil {
+				printErr(err)
+			}
+			return
+		}
+		if len(sps) >= 3 && sps[0] == "target" && sps[1] == "add" {
+			filename, err := filepath.Abs(sps[2])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			t, err := AddTarget(filename, sps[3:])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "add %s\n", t)
+			return
+		}
+		if len(sps) == 3 && sps[0] == "target" && sps[1] == "attach" {
+			pid, err := strconv.Atoi(sps[2])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			t, err := AttachTarget(pid)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "add %s\n", t)
+			return
+		}
+		if len(sps) == 2 && (sps[0] == "tb" || sps[0] == "tbreak") {
+			bInfo, err := setLocBreakPoint(sps[1], false)
+			if err == nil {
+				bInfo.temporary = true
+			}
+			if err != nil {
+				if err == HasExistedBreakPointErr {
+					printHasExistedBreakPoint(sps[1])
+					return
+				}
+				if err == NotFoundSourceLineErr {
+					printNotFoundSourceLineErr(sps[1])
+					return
+				}
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout,"godbg add %s:%d temporary breakpoint %d successfully\n",bInfo.filename, bInfo.lineno, bInfo.id)
+			return
+		}
+	case 'u':
+		sps := strings.Split(input, " ")
+		if len(sps) == 2 && sps[0] == "unalias" {
+			if err := RemoveAlias(sps[1]); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "remove alias %s\n", sps[1])
+			return
+		}
+		if len(sps) == 2 && sps[0] == "undisplay" {
+			id, err := strconv.Atoi(sps[1])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			d, err := RemoveDisplay(id)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "remove display %d %s\n", d.id, d.expr)
+			return
+		}
+		if sps[0] == "up" && len(sps) <= 2 {
+			moveFrame(sps[1:], 1)
+			return
+		}
+		if len(sps) == 2 && (sps[0] == "u" || sps[0] == "until") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			// run to the location with a temporary breakpoint, an existing breakpoint there is enough
+			bInfo, err := setLocBreakPoint(sps[1], false)
+			if err == nil {
+				bInfo.temporary = true
+			}
+			if err != nil && err != HasExistedBreakPointErr {
+				if err == NotFoundSourceLineErr {
+					printNotFoundSourceLineErr(sps[1])
+					return
+				}
+				printErr(err)
+				return
+			}
+			continueProcess()
+			// the debuggee stops somewhere else, don't leave the breakpoint behind
+			if bInfo != nil {
+				if _, _, err = bp.findUserBreakPoint(bInfo.id); err == nil {
+					if _, err = bp.Clear(bInfo.id); err != nil {
+						printErr(err)
+					}
+				}
+			}
+			return
+		}
+	case 'h':
+		sps := strings.Split(input, " ")
+		if len(sps) == 1 && sps[0] == "handle" {
+			sigs := make([]syscall.Signal, 0, len(signalNames))
+			for _, sig := range signalNames {
+				sigs = append(sigs, sig)
+			}
+			sort.Slice(sigs, func(i, j int) bool { return sigs[i] < sigs[j] })
+			for _, sig := range sigs {
+				fmt.Fprintf(stdout, "%-10s %s\n", signalName(sig), signalHandling(sig))
+			}
+			return
+		}
+		if len(sps) >= 2 && sps[0] == "handle" {
+			sig, err := parseSignal(sps[1])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			h, err := HandleSignal(sig, sps[2:])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "%-10s %s\n", signalName(sig), h)
+			return
+		}
+	case 'i':
+		sps := strings.Split(input, " ")
+		if len(sps) == 2 && sps[0] == "info" && sps[1] == "goroutine" {
+			printGoroutineInfo()
+			return
+		}
+		if len(sps) == 2 && sps[0] == "info" && sps[1] == "auxv" {
+			printAuxv()
+			return
+		}
+		if len(sps) == 3 && sps[0] == "info" && sps[1] == "proc" && sps[2] == "mappings" {
+			printMappings()
+			return
+		}
+		if len(sps) == 2 && sps[0] == "info" && (sps[1] == "sections" || sps[1] == "segments" || sps[1] == "version") {
+			if bi == nil {
+				printNoProcessErr()
+				return
+			}
+			switch sps[1] {
+			case "sections":
+				printSections()
+			case "segments":
+				printSegments()
+			default:
+				printGoVersion()
+			}
+			return
+		}
+		if len(sps) == 1 && sps[0] == "inferiors" {
+			if cmd.Process != nil {
+				fmt.Fprintf(stdout, "* process %d\n", cmd.Process.Pid)
+			}
+			for _, pid := range inferiors {
+				fmt.Fprintf(stdout, "  process %d\n", pid)
+			}
+			return
+		}
+		if len(sps) == 2 && sps[0] == "inferior" {
+			pid, err := strconv.Atoi(sps[1])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			if err = SwitchInferior(pid); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "switch to process %d\n", pid)
+			if err = listFileLineByPtracePc(sourceListSize); err != nil {
+				printErr(err)
+			}
+			return
+		}
+		if len(sps) == 3 && sps[0] == "ignore" {
+			id, err := strconv.Atoi(sps[1])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			count, err := strconv.Atoi(sps[2])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			info, err := bp.Ignore(id, count)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "will ignore next %d hits of breakpoint %d %s:%d\n", count, id, info.filename, info.lineno)
+			return
+		}
+	case 's':
+		sps := strings.Split(input, " ")
+		if len(sps) == 2 && sps[0] == "source" {
+			source := SourceCommands
+			if path.Ext(sps[1]) == ".star" {
+				source = SourceScript
+			}
+			if err := source(sps[1]); err != nil {
+				printErr(err)
+			}
+			return
+		}
+		if len(sps) >= 3 && sps[0] == "set-mem" {
+			setMemory(sps[1], sps[2:])
+			return
+		}
+		if len(sps) == 4 && sps[0] == "set" && strings.HasPrefix(sps[1], "$") && sps[2] == "=" {
+			value, err := parseRegisterValue(sps[3])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			name := sps[1][1:]
+			if err = SetRegister(name, value); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "%s = %#x\n", name, value)
+			return
+		}
+		if len(sps) >= 4 && sps[0] == "set" && strings.Contains(input, "=") {
+			expr := strings.TrimPrefix(input, "set ")
+			value, err := bp.Assign(expr)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "%s = %s\n", strings.TrimSpace(expr[:strings.Index(expr, "=")]), value)
+			return
+		}
+		if len(sps) == 3 && sps[0] == "set" && sps[1] == "follow-fork-mode" {
+			switch sps[2] {
+			case "parent":
+				followForkChild = false
+			case "child":
+				followForkChild = true
+			default:
+				printErr(fmt.Errorf("follow-fork-mode should be parent or child, not %s", sps[2]))
+				return
+			}
+			fmt.Fprintf(stdout, "follow-fork-mode is %s\n", sps[2])
+			return
+		}
+		if len(sps) == 3 && sps[0] == "set" && sps[1] == "disassemble-flavor" {
+			if err := SetDisassembleFlavor(sps[2]); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "disassemble-flavor is %s\n", sps[2])
+			return
+		}
+		if len(sps) == 3 && sps[0] == "set" && sps[1] == "detach-on-fork" {
+			switch sps[2] {
+			case "on":
+				detachOnFork = true
+			case "off":
+				detachOnFork = false
+			default:
+				printErr(fmt.Errorf("detach-on-fork should be on or off, not %s", sps[2]))
+				return
+			}
+			fmt.Fprintf(stdout, "detach-on-fork is %s\n", sps[2])
+			return
+		}
+		if len(sps) == 1 && (sps[0] == "s" || sps[0] == "step") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			ev, err := bp.Step()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			printStopEvent(ev)
+			return
+		}
+		if len(sps) == 1 && (sps[0] == "si" || sps[0] == "stepi") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			ev, err := bp.StepInstruction()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			if ev.reason != StopStep {
+				printStopEvent(ev)
+				return
+			}
+			if err = listInstructionByPtracePc(); err != nil {
+				printErr(err)
+			}
+			return
+		}
+		if len(sps) == 1 && (sps[0] == "so" || sps[0] == "stepout") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			pc, err := getPtracePc()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			f, err := bi.findFunctionIncludePc(pc)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			ev, err := bp.StepOut()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			if ev.reason == StopStep {
+				if values, err := returnValues(f); err != nil {
+					fmt.Fprintf(stdout, "%s returns, the values are unavailable: %v\n", f.name, err)
+				} else if len(values) > 0 {
+					fmt.Fprintf(stdout, "%s returns %s\n", f.name, strings.Join(values, ", "))
+				}
+			}
+			printStopEvent(ev)
+			return
+		}
+	case 'n':
+		sps := strings.Split(input, " ")
+		if len(sps) == 1 && (sps[0] == "n" || sps[0] == "next") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			ev, err := bp.Next()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			printStopEvent(ev)
+			return
+		}
+	case 'l':
+		sps := strings.Split(input, " ")
+		if len(sps) <= 2 && sps[0] == "locals" {
+			filter := ""
+			if len(sps) == 2 {
+				filter = sps[1]
+			}
+			warnOptimizedFrame()
+			printFrameVariables(func() ([]string, error) { return Locals(filter) })
+			return
+		}
+		if len(sps) <= 3 && (sps[0] == "l" || sps[0] == "list") {
+			loc, rangeline := "", sourceListSize
+			if len(sps) >= 2 {
+				loc = sps[1]
+			}
+			if len(sps) == 3 {
+				var err error
+				if rangeline, err = strconv.Atoi(sps[2]); err != nil {
+					printUnsupportCmd(input)
+					return
+				}
+			}
+			if err := listLocation(loc, rangeline); err != nil {
+				printErr(err)
+				return
+			}
+			return
+		}
+		// `log` shows the logging, `log level lv`, `log enable|disable dwarf,proc`, `log format json|logfmt`
+		// and `log output dest` change it
+		if sps[0] == "log" {
+			var err error
+			switch {
+			case len(sps) == 1:
+				fmt.Fprintf(stdout, "level = %s\ncomponents = %s\nformat = %s\noutput = %s\n", log.Level(), strings.Join(log.Enabled(), ","), log.Format(), log.Output())
+			case len(sps) == 3 && sps[1] == "level":
+				err = log.SetLevel(sps[2])
+			case len(sps) == 3 && (sps[1] == "enable" || sps[1] == "disable"):
+				err = log.Enable(sps[2], sps[1] == "enable")
+			case len(sps) == 3 && sps[1] == "format":
+				err = log.SetFormat(sps[2])
+			case len(sps) == 3 && sps[1] == "output":
+				err = log.SetOutput(sps[2])
+			default:
+				printUnsupportCmd(input)
+				return
+			}
+			if err != nil {
+				printErr(err)
+			}
+			return
+		}
+	case 'r':
+		sps := strings.Split(input, " ")
+		if sps[0] == "regs" && (len(sps) == 1 || (len(sps) == 2 && sps[1] == "-sse")) {
+			lines, err := Registers(len(sps) == 2)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			for _, line := range lines {
+				fmt.Fprintf(stdout, "%s\n", line)
+			}
+			return
+		}
+		if len(sps) == 2 && sps[0] == "rwatch" {
+			setWatchPoint(sps[1], true)
+			return
+		}
+		if len(sps) == 1 && (sps[0] == "rc" || sps[0] == "rewind") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			ev, err := bp.ReverseContinue()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			printStopEvent(ev)
+			return
+		}
+		if len(sps) == 1 && (sps[0] == "rs" || sps[0] == "reverse-step") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			ev, err := bp.ReverseStep()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			printStopEvent(ev)
+			return
+		}
+		if len(sps) == 1 && (sps[0] == "rn" || sps[0] == "reverse-next") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			ev, err := bp.ReverseNext()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			printStopEvent(ev)
+			return
+		}
+		if len(sps) == 2 && (sps[0] == "r" || sps[0] == "restart") {
+			id, err := strconv.Atoi(sps[1])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			c, err := bp.RestartCheckpoint(id)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "restart checkpoint %d %s:%d new process pid %d\n", c.id, tryCuttingFilename(c.filename), c.lineno, cmd.Process.Pid)
+			if err = listFileLineByPtracePc(sourceListSize); err != nil {
+				printErr(err)
+			}
+			return
+		}
+		if len(sps) == 1 && (sps[0] == "r" || sps[0] == "restart") {
+			if core != nil {
+				printErr(CoreReadOnlyErr)
+				return
+			}
+			if replaying() {
+				printErr(RestartReplayErr)
+				return
+			}
+			// debugserver started by godbg launches the program again, the remote gdb server can't
+			if replay != nil && replay.server == nil {
+				printErr(RemoteUnsupportedErr)
+				return
+			}
+			restartProcess()
+			return
+		}
+	case 'd':
+		sps := strings.Split(input, " ")
+		if sps[0] == "dump-dwarf" && (len(sps) == 2 || len(sps) == 3) {
+			filter := ""
+			if len(sps) == 3 {
+				filter = sps[2]
+			}
+			if err := dumpDwarf(sps[1], filter); err != nil {
+				printErr(err)
+			}
+			return
+		}
+		if sps[0] == "display" {
+			if len(sps) == 1 {
+				if len(displays) == 0 {
+					fmt.Fprintf(stdout, "%s\n", "there is no display")
+				}
+				printDisplays()
+				return
+			}
+			d, err := AddDisplay(strings.Join(sps[1:], " "))
+			if err != nil {
+				printErr(err)
+				return
+			}
+			if cmd.Process != nil {
+				fmt.Fprintf(stdout, "%s\n", d)
+			}
+			return
+		}
+		if len(sps) == 1 && sps[0] == "defer" {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			defers, err := FrameDefers()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			for i, d := range defers {
+				fmt.Fprintf(stdout, "defer %d: %s\n", i, d)
+			}
+			if len(defers) == 0 {
+				fmt.Fprintf(stdout, "there is no deferred call\n")
+			}
+			return
+		}
+		if sps[0] == "down" && len(sps) <= 2 {
+			moveFrame(sps[1:], -1)
+			return
+		}
+		if sps[0] == "disass" || sps[0] == "disassemble" {
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			lowpc, highpc, err := disassembleRange(sps[1:])
+			if err == nil {
+				err = listDisassemble(lowpc, highpc)
+			}
+			if err != nil {
+				printErr(err)
+			}
+			return
+		}
+		if (len(sps) == 1 || (len(sps) == 2 && sps[1] == "-kill")) && sps[0] == "detach" {
+			pid, err := detach(len(sps) == 2)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			if len(sps) == 2 {
+				fmt.Fprintf(stdout, "kill process %d\n", pid)
+			} else {
+				fmt.Fprintf(stdout, "detach process %d\n", pid)
+			}
+			return
+		}
+	case 'a':
+		sps := strings.Split(input, " ")
+		if len(sps) == 1 && sps[0] == "args" {
+			warnOptimizedFrame()
+			printFrameVariables(Args)
+			return
+		}
+		if len(sps) == 1 && sps[0] == "alias" {
+			printAliases()
+			return
+		}
+		if len(sps) >= 3 && sps[0] == "alias" {
+			if err := AddAlias(sps[1], strings.Join(sps[2:], " ")); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "alias %s = %s\n", sps[1], aliases[sps[1]])
+			return
+		}
+	case 'f':
+		sps := strings.Split(input, " ")
+		if len(sps) <= 2 && sps[0] == "frame" {
+			n := curFrame
+			if len(sps) == 2 {
+				var err error
+				if n, err = strconv.Atoi(sps[1]); err != nil {
+					printErr(err)
+					return
+				}
+			}
+			selectFrame(n)
+			return
+		}
+		if len(sps) <= 3 && sps[0] == "funcs" {
+			args := sps[1:]
+			optimized := len(args) > 0 && args[0] == "-optimized"
+			if optimized {
+				args = args[1:]
+			}
+			if len(args) <= 1 {
+				filter := ""
+				if len(args) == 1 {
+					filter = args[0]
+				}
+				printFunctions(filter, optimized)
+				return
+			}
+		}
+	case 'g':
+		sps := strings.Split(input, " ")
+		if sps[0] == "goroutines" {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			gs, total, err := QueryGoroutines(sps[1:])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			for _, g := range gs {
+				printGoroutine(g)
+			}
+			if len(gs) < total {
+				fmt.Fprintf(stdout, "showing %d of %d goroutines\n", len(gs), total)
+			}
+			return
+		}
+		if len(sps) == 2 && sps[0] == "goroutine" {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			id, err := strconv.ParseUint(sps[1], 10, 64)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			g, err := SwitchGoroutine(id)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "switch to goroutine %d\n", id)
+			printGoroutine(g)
+			if err = listFileLineByPtracePc(sourceListSize); err != nil {
+				printErr(err)
+			}
+			return
+		}
+	case 'v':
+		sps := strings.Split(input, " ")
+		if len(sps) <= 2 && sps[0] == "vars" {
+			filter := ""
+			if len(sps) == 2 {
+				filter = sps[1]
+			}
+			printFrameVariables(func() ([]string, error) { return PackageVariables(filter) })
+			return
+		}
+	case 'w':
+		sps := strings.Split(input, " ")
+		if len(sps) == 2 && sps[0] == "watch" {
+			setWatchPoint(sps[1], false)
+			return
+		}
+		if len(sps) >= 2 && sps[0] == "whatis" {
+			printFrameVariables(func() ([]string, error) { return WhatIs(strings.Join(sps[1:], " ")) })
+			return
+		}
+	case 'x', 'e':
+		sps := strings.Split(input, " ")
+		if len(sps) >= 2 && (sps[0] == "x" || sps[0] == "examine") {
+			examine(sps[1:])
+			return
+		}
+	case 'm':
+		// `metrics` prints the timings of the operations and the strings interned, `metrics reset` clears the timings
+		if input == "metrics" {
+			printMetrics()
+			return
+		}
+		if input == "metrics reset" {
+			resetMetrics()
+			return
+		}
+	case 'o':
+		sps := strings.Split(input, " ")
+		if len(sps) == 2 && sps[0] == "output" {
+			switch sps[1] {
+			case "json":
+				jsonOutput = true
+			case "text":
+				jsonOutput = false
+			default:
+				printErr(fmt.Errorf("unknown output `%s`, expect json or text", sps[1]))
+				return
+			}
+			fmt.Fprintf(stdout, "output = %s\n", sps[1])
+			return
+		}
+		if len(sps) >= 2 && sps[0] == "on" {
+			id, err := strconv.Atoi(sps[1])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			info, err := bp.Commands(id, strings.Join(sps[2:], " "))
+			if err != nil {
+				printErr(err)
+				return
+			}
+			if len(info.commands) == 0 {
+				fmt.Fprintf(stdout, "remove commands of breakpoint %d %s:%d\n", id, info.filename, info.lineno)
+			} else {
+				fmt.Fprintf(stdout, "breakpoint %d %s:%d runs %s\n", id, info.filename, info.lineno, strings.Join(info.commands, "; "))
+			}
+			return
+		}
+	case 'p':
+		sps := strings.SplitN(input, " ", 2)
+		if len(sps) == 2 && (sps[0] == "p" || sps[0] == "print") {
+			printExpr(sps[1])
+			return
+		}
+	}
+	if runScriptCommand(input) {
+		return
+	}
+	printUnsupportCmd(input)
+}
+
+// SourceCommands runs the commands in filename line by line like they are input, the empty lines
+// and the lines beginning with `#` are skipped. A leading `~/` is the home directory
+func SourceCommands(filename string) error {
+	if strings.HasPrefix(filename, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		filename = path.Join(home, filename[2:])
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		executor(line)
+	}
+	return nil
+}
+
+// continueProcess resumes the debuggee and shows where it stops
+func continueProcess() {
+	ev, err := bp.Resume()
+	if err != nil {
+		printErr(err)
+		if ev == nil {
+			return
+		}
+	}
+	printStopEvent(ev)
+}
+
+// restartProcess kills the debuggee and runs the executable file again with the same args,
+// which is rebuilt from the source first. The breakpoints are resolved again in the new process
+func restartProcess() {
+	var (
+		rebuilt string
+		err error
+	)
+	if testpackage != "" {
+		if rebuilt, err = buildTest(testpackage); err != nil {
+			printErr(err)
+			logger.Error(err.Error(), zap.String("stage", "restart:build"), zap.String("package", testpackage))
+			return
+		}
+	} else if sourcefile != "" {
+		if rebuilt, err = build(sourcefile); err != nil {
+			printErr(err)
+			logger.Error(err.Error(), zap.String("stage", "restart:build"), zap.String("filename", sourcefile))
+			return
+		}
+	}
+	if cmd.Process != nil {
+		pid := cmd.Process.Pid
+		if attached {
+			if _, err = detach(false); err != nil {
+				printErr(err)
+				if rebuilt != "" {
+					os.Remove(rebuilt)
+				}
+				return
+			}
+			fmt.Fprintf(stdout, "  detach old process pid %d\n", pid)
+		} else if replay != nil {
+			// debugserver serves one process, the old one is killed with it
+			replay.close()
+			replay = nil
+			fmt.Fprintf(stdout, "  kill  old process pid %d\n", pid)
+		} else {
+			killProcess()
+			fmt.Fprintf(stdout, "  kill  old process pid %d\n", pid)
+		}
+		cmd.Process = nil
+		threads = nil
+		curThread = 0
+		curGoroutine = nil
+		curFrame = 0
+		attached = false
+		bp.pendingSignal = 0
+	}
+	// the binary rebuilt has a new name, the old one is removed, its mapping is kept by bi until it is replaced
+	if rebuilt != "" {
+		os.Remove(execfile)
+		execfile = rebuilt
+	}
+
+	changed, err := bi.changed(execfile)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	if changed {
+		newBi, err := analyze(execfile)
+		if err != nil {
+			printErr(err)
+			logger.Error(err.Error(), zap.String("stage", "restart:analyze"), zap.String("execfile", execfile))
+			return
+		}
+		replaceBi(newBi)
+		// the checkpoints run the old executable file
+		clearCheckpoints()
+		fmt.Fprintf(stdout, "reload the changed executable file %s\n", execfile)
+	}
+
+	if cmd, err = runexec(execfile, execargs); err != nil {
+		printErr(err)
+		logger.Error(err.Error(), zap.String("stage", "restart:runexec"), zap.String("execfile", execfile))
+		return
+	}
+	unresolved, err := bp.SetBpWhenRestart()
+	for _, info := range unresolved {
+		fmt.Fprintf(stdout, "breakpoint %d %s:%d is disabled, its location can't be found\n", info.id, info.filename, info.lineno)
+	}
+	if err != nil {
+		printErr(err)
+		logger.Error(err.Error(), zap.String("stage", "restart:setbp"), zap.String("execfile", execfile))
+		return
+	}
+	fmt.Fprintf(stdout, "restart new process pid %d \n", cmd.Process.Pid)
+}
+
+func printStopEvent(ev *StopEvent) {
+	stops++
+	for _, trace := range ev.traces {
+		printHeadline("%s", trace)
+	}
+	for _, sig := range ev.received {
+		printHeadline("thread %d received signal %s", ev.pid, sig)
+	}
+	for _, note := range ev.forks {
+		printHeadline("%s", note)
+	}
+	switch ev.reason {
+	case StopExited, StopKilled:
+		printExitEvent(ev)
+		return
+	case StopSignal:
+		printHeadline("thread %d received signal %s", ev.pid, ev.signal)
+	case StopExec:
+		printHeadline("process %d executes %s", ev.pid, ev.exefile)
+		for _, info := range ev.unresolved {
+			printHeadline("breakpoint %d %s:%d is disabled, its location can't be found", info.id, info.filename, info.lineno)
+		}
+	case StopRecordingBegin:
+		printHeadline("%s", "reach the beginning of the recording")
+	case StopPanic:
+		switch ev.info.fn {
+		case "runtime.gopanic":
+			printHeadline("goroutine %d panics: %s", currentGoroutineId(), ev.panic)
+		case "runtime.fatalpanic":
+			printHeadline("panic is not recovered: %s", ev.panic)
+		default:
+			printHeadline("%s", ev.panic)
+		}
+	case StopWatchPoint:
+		printHeadline("watchpoint %d %s old value: %s, new value: %s", ev.info.id, ev.info.watch.name,
+			formatBasicValue(ev.info.watch.typ, ev.old), formatBasicValue(ev.info.watch.typ, ev.info.watch.old))
+	case StopBreakPoint:
+		if ev.info.kind == USERBPTYPE && ev.info.temporary {
+			if _, err := bp.Clear(ev.info.id); err != nil {
+				printErr(err)
+				return
+			}
+			printHeadline("temporary breakpoint %d %s:%d is cleared", ev.info.id, ev.info.filename, ev.info.lineno)
+		}
+	}
+	printHeadline("current process pc = %d", ev.pc)
+	if err := listFileLineByPtracePc(sourceListSize); err != nil {
+		printErr(err)
+		return
+	}
+	printDisplays()
+	if ev.reason == StopBreakPoint && ev.info != nil && len(ev.info.commands) > 0 {
+		runBreakPointCommands(ev.info)
+	}
+}
+
+// stops counts the stops printed, the commands of a breakpoint know whether one of them resumes the debuggee
+var stops int
+
+// runBreakPointCommands runs the commands of the breakpoint where the debuggee stops, the ones after
+// resuming the debuggee are dropped since it stops somewhere else
+func runBreakPointCommands(info *BInfo) {
+	n := stops
+	for _, c := range info.commands {
+		executor(c)
+		if stops != n || cmd.Process == nil {
+			return
+		}
+	}
+}
+
+// printDisplays evaluates the displays where the debuggee stops
+func printDisplays() {
+	if cmd.Process == nil {
+		return
+	}
+	for _, d := range displays {
+		fmt.Fprintf(stdout, "%s\n", d)
+	}
+}
+
+// setLocBreakPoint sets the breakpoint at loc, which is filename:lineno or a function name
+func setLocBreakPoint(loc string, hardware bool) (*BInfo, error) {
+	if !strings.Contains(loc, ":") {
+		return bp.SetFunctionBreakPoint(loc, hardware)
+	}
+	filename, line, err := parseLoc(loc)
+	if err != nil {
+		return nil, err
+	}
+	if hardware {
+		return bp.SetFileLineHardwareBreakPoint(filename, line)
+	}
+	return bp.SetFileLineBreakPoint(filename, line)
+}
+
+// examine shows the memory by `x [-fmt hex|dec|bin|ascii] [-len n] [-size 1|2|4|8] <addr|expr>`,
+// 16 bytes in hex by default
+func examine(args []string) {
+	var (
+		fmtName = "hex"
+		length = 16
+		size = 1
+		err error
+	)
+	for len(args) >= 2 && (args[0] == "-fmt" || args[0] == "-len" || args[0] == "-size") {
+		switch args[0] {
+		case "-fmt":
+			fmtName = args[1]
+		case "-len":
+			length, err = strconv.Atoi(args[1])
+		case "-size":
+			size, err = strconv.Atoi(args[1])
+		}
+		if err != nil {
+			printErr(err)
+			return
+		}
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		printErr(fmt.Errorf("x needs the address or the expression"))
+		return
+	}
+	if cmd.Process == nil {
+		printNoProcessErr()
+		return
+	}
+	addr, err := examineAddress(strings.Join(args, " "))
+	if err != nil {
+		printErr(err)
+		return
+	}
+	lines, err := Examine(addr, length, size, fmtName)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	for _, line := range lines {
+		fmt.Fprintf(stdout, "%s\n", line)
+	}
+}
+
+// printVerbs are the flags of print which show the integers in the number formats
+var printVerbs = map[string]byte{"-d": 'd', "-x": 'x', "-b": 'b', "-o": 'o', "-c": 'c'}
+
+// printExpr shows the value by `p [-full|-raw] [-x|-b|-o|-c|-d] <expr>`, -full loads the whole value whatever
+// the config is and -raw dumps the bytes of its place. The number format is also given like `p %x expr`
+func printExpr(args string) {
+	var full, raw bool
+	verb := numberFormat
+	for {
+		sps := strings.SplitN(args, " ", 2)
+		if len(sps) < 2 {
+			break
+		}
+		if v, ok := printVerbs[sps[0]]; ok {
+			verb = v
+		} else if len(sps[0]) == 2 && sps[0][0] == '%' && strings.IndexByte("dxboc", sps[0][1]) >= 0 {
+			verb = sps[0][1]
+		} else if sps[0] == "-full" || sps[0] == "-raw" {
+			full, raw = full || sps[0] == "-full", raw || sps[0] == "-raw"
+		} else {
+			break
+		}
+		args = strings.TrimSpace(sps[1])
+	}
+	if cmd.Process == nil {
+		printNoProcessErr()
+		return
+	}
+	if raw {
+		lines, err := RawValue(args)
+		if err != nil {
+			printErr(err)
+			return
+		}
+		for _, line := range lines {
+			fmt.Fprintf(stdout, "%s\n", line)
+		}
+		return
+	}
+	if full {
+		saved := loadConfig
+		loadConfig = fullLoadConfig()
+		defer func() { loadConfig = saved }()
+	}
+	saved := numberFormat
+	numberFormat = verb
+	defer func() { numberFormat = saved }()
+	value, err := formatExpr(args)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	warnOptimizedFrame()
+	fmt.Fprintf(stdout, "%s\n", highlightValue(value))
+}
+
+// setMemory writes the bytes by `set-mem <addr|expr> <byte>...`, each byte is a number like 0x90 or 255
+func setMemory(expr string, values []string) {
+	if cmd.Process == nil {
+		printNoProcessErr()
+		return
+	}
+	data := make([]byte, 0, len(values))
+	for _, v := range values {
+		b, err := strconv.ParseUint(v, 0, 8)
+		if err != nil {
+			printErr(fmt.Errorf("the bytes should be numbers between 0 and 255, not `%s`", v))
+			return
+		}
+		data = append(data, byte(b))
+	}
+	addr, err := examineAddress(expr)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	if err = WriteMemory(addr, data); err != nil {
+		printErr(err)
+		return
+	}
+	fmt.Fprintf(stdout, "write %d bytes at %#x\n", len(data), addr)
+}
+
+// parseRegisterValue parses the value written to a register, like 0x4a0000, 42 or -1
+func parseRegisterValue(s string) (uint64, error) {
+	if v, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return v, nil
+	}
+	v, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("the value of the register should be a number, not `%s`", s)
+	}
+	return uint64(v), nil
+}
+
+// printStackframe tags the frames of the functions of cgo or libgcc by `C code`
+func printStackframe(f *Stackframe) {
+	tag := ""
+	if !f.fn.cu.isGo() {
+		tag = " (C code)"
+	}
+	fmt.Fprintf(stdout, "#%-2d pc %d %s:%d %s bp %d%s\n", f.index, f.pc, f.filename, f.lineno, f.fn.name, f.bp, tag)
+}
+
+// selectFrame selects the frame n and lists the source around it
+func selectFrame(n int) {
+	f, err := SelectFrame(n)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	printStackframe(f)
+	if err = listFileLine(f.filename, f.lineno, sourceListSize); err != nil {
+		printErr(err)
+	}
+}
+
+// moveFrame selects the frame `args[0]` levels away in the direction, 1 level by default
+func moveFrame(args []string, direction int) {
+	n := 1
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil {
+			printErr(err)
+			return
+		}
+	}
+	selectFrame(curFrame + n * direction)
+}
+
+// warnOptimizedFrame warns the variables of the frame selected if its function is optimized
+func warnOptimizedFrame() {
+	if cmd.Process == nil {
+		return
+	}
+	if frame, err := selectedFrame(); err == nil && frame.fn.optimized {
+		printOptimized(frame.fn.name)
+	}
+}
+
+func printFrameVariables(load func() ([]string, error)) {
+	if cmd.Process == nil {
+		printNoProcessErr()
+		return
+	}
+	values, err := load()
+	if err != nil {
+		printErr(err)
+		return
+	}
+	for _, v := range values {
+		fmt.Fprintf(stdout, "%s\n", highlightValue(v))
+	}
+}
+
+// printGoroutine prints the id, status, location and the go statement of g, the one selected is marked
+func printGoroutine(g *Goroutine) {
+	mark := " "
+	if curGoroutine != nil && curGoroutine.id == g.id {
+		mark = "*"
+	} else if curGoroutine == nil && g.thread != 0 && g.thread == currentThread() {
+		mark = "*"
+	}
+	loc := fmt.Sprintf("pc %d", g.pc)
+	if filename, lineno, err := bi.pcTofileLine(g.pc); err == nil {
+		loc = fmt.Sprintf("%s %s:%d", loc, tryCuttingFilename(filename), lineno)
+	}
+	if f, err := bi.findFunctionIncludePc(g.pc); err == nil {
+		loc = fmt.Sprintf("%s %s", loc, f.name)
+	}
+	created := ""
+	// gopc is the return address of the call to runtime.newproc
+	if filename, lineno, err := bi.pcTofileLine(g.gopc - 1); err == nil && g.gopc != 0 {
+		created = fmt.Sprintf(", go %s:%d", tryCuttingFilename(filename), lineno)
+	}
+	fmt.Fprintf(stdout, "%s goroutine %d %s %s%s\n", mark, g.id, g.Status(), loc, created)
+}
+
+// printGoroutineInfo prints runtime.g of the current goroutine for `info goroutine`, its stack and where it is saved
+func printGoroutineInfo() {
+	if cmd == nil || cmd.Process == nil {
+		printNoProcessErr()
+		return
+	}
+	g, err := CurrentGoroutine()
+	if err != nil {
+		printErr(err)
+		return
+	}
+	if g == nil {
+		fmt.Fprintf(stdout, "thread %d is not running any goroutine\n", currentThread())
+		return
+	}
+	thread := ""
+	if g.thread != 0 {
+		thread = fmt.Sprintf(", thread %d", g.thread)
+	}
+	fmt.Fprintf(stdout, "goroutine %d %s, g %#x, stack [%#x, %#x), sched pc %#x sp %#x bp %#x%s\n", g.id, g.Status(),
+		g.addr, g.stackLo, g.stackHi, g.sched.pc, g.sched.sp, g.sched.bp, thread)
+}
+
+func printExitEvent(ev *StopEvent) {
+	if ev.reason == StopKilled {
+		printKilled(ev.pid, ev.signal)
+		return
+	}
+	printExit(ev.pid, ev.status)
+}
+
+func setWatchPoint(name string, readable bool) {
+	info, err := bp.SetWatchPoint(name, readable)
+	if err == HasExistedBreakPointErr {
+		printHasExistedBreakPoint(name)
+		return
+	}
+	if err != nil {
+		printErr(err)
+		return
+	}
+	fmt.Fprintf(stdout, "godbg add watchpoint %d %s, addr 0x%x, %d bytes\n", info.id, name, info.watch.addr, info.watch.size)
+}
+
+func breakPointFlags(info *BInfo) string {
+	flag := ""
+	if info.watch != nil && info.watch.readable {
+		flag += ", read"
+	} else if info.hardware && info.watch == nil {
+		flag += ", hardware"
+	}
+	if info.cond != "" {
+		flag += ", cond " + info.cond
+	}
+	if len(info.commands) > 0 {
+		flag += ", commands " + strings.Join(info.commands, "; ")
+	}
+	if info.hitCond != nil {
+		flag += ", hitcount " + info.hitCond.String()
+	}
+	if info.ignore > 0 {
+		flag += fmt.Sprintf(", ignore next %d hits", info.ignore)
+	}
+	if info.temporary {
+		flag += ", temporary"
+	}
+	if info.traceArgs {
+		flag += ", trace with args"
+	} else if info.trace {
+		flag += ", trace"
+	}
+	if info.disabled {
+		flag += ", disabled"
+	}
+	if info.hits > 0 {
+		flag += fmt.Sprintf(", hits %d", info.hits)
+	}
+	return flag
+}
+
+// commandSuggests are completed at the beginning of the line
+var commandSuggests = []prompt.Suggest{
+	{Text: "args", Description: "print the arguments of the frame"},
+	{Text: "alias", Description: "define a command of the commands separated by `;`"},
+	{Text: "b", Description: "set a breakpoint at file.go:line or a function"},
+	{Text: "bc", Description: "clear a breakpoint"},
+	{Text: "bd", Description: "disable a breakpoint"},
+	{Text: "be", Description: "enable a breakpoint"},
+	{Text: "bl", Description: "list the breakpoints"},
+	{Text: "bt", Description: "print the stack of the goroutine"},
+	{Text: "c", Description: "continue to the next stop"},
+	{Text: "call", Description: "call a function of the debuggee"},
+	{Text: "chan", Description: "print the waiting goroutines of a channel"},
+	{Text: "checkpoint", Description: "fork a checkpoint of the debuggee"},
+	{Text: "checkpoints", Description: "list the checkpoints"},
+	{Text: "cond", Description: "set the condition of a breakpoint"},
+	{Text: "config", Description: "show, change or save the config"},
+	{Text: "defer", Description: "list the deferred calls of the frame"},
+	{Text: "detach", Description: "detach from the debuggee"},
+	{Text: "disass", Description: "disassemble the function of the frame, a location or -range a,b"},
+	{Text: "display", Description: "print an expression on every stop"},
+	{Text: "down", Description: "select the frame called by the current one"},
+	{Text: "dump-dwarf", Description: "print the DIEs, the line table or the FDEs of a function or a compile unit"},
+	{Text: "frame", Description: "select a frame"},
+	{Text: "funcs", Description: "list the functions matching a regexp, the optimized ones by -optimized"},
+	{Text: "goroutine", Description: "switch to a goroutine"},
+	{Text: "goroutines", Description: "list the goroutines"},
+	{Text: "handle", Description: "show or change how the signals are handled"},
+	{Text: "ignore", Description: "ignore the next hits of a breakpoint"},
+	{Text: "inferior", Description: "switch to a forked process"},
+	{Text: "info", Description: "print the sections or the segments of the executable file, the go building it, the current goroutine, the auxv or the memory maps of the process"},
+	{Text: "inferiors", Description: "list the forked processes"},
+	{Text: "l", Description: "list the source around the stop or a location"},
+	{Text: "locals", Description: "print the local variables"},
+	{Text: "log", Description: "show or change the level, the components and the output of the logs"},
+	{Text: "metrics", Description: "print the timings of loading, the breakpoints, unwinding and eval, and the strings interned"},
+	{Text: "n", Description: "step over to the next line"},
+	{Text: "on", Description: "run a command when a breakpoint is hit"},
+	{Text: "output", Description: "print json or text"},
+	{Text: "p", Description: "print an expression"},
+	{Text: "q", Description: "quit"},
+	{Text: "r", Description: "restart the debuggee"},
+	{Text: "rc", Description: "continue backwards"},
+	{Text: "regs", Description: "print the registers"},
+	{Text: "rn", Description: "step over backwards"},
+	{Text: "rs", Description: "step into backwards"},
+	{Text: "rwatch", Description: "stop when an expression is read"},
+	{Text: "s", Description: "step into the next line"},
+	{Text: "set", Description: "assign a variable or a register"},
+	{Text: "set-mem", Description: "write the memory"},
+	{Text: "si", Description: "step an instruction"},
+	{Text: "so", Description: "step out of the function"},
+	{Text: "source", Description: "run the commands or the starlark script in a file"},
+	{Text: "target", Description: "list, switch, add or attach the targets"},
+	{Text: "tb", Description: "set a temporary breakpoint"},
+	{Text: "thread", Description: "switch to a thread"},
+	{Text: "threads", Description: "list the threads"},
+	{Text: "trace", Description: "set a tracepoint"},
+	{Text: "transcript", Description: "record the commands and their output to a file"},
+	{Text: "u", Description: "continue to a location"},
+	{Text: "unalias", Description: "remove an alias"},
+	{Text: "undisplay", Description: "remove a display"},
+	{Text: "up", Description: "select the frame calling the current one"},
+	{Text: "vars", Description: "print the package variables"},
+	{Text: "watch", Description: "stop when an expression is written"},
+	{Text: "whatis", Description: "print the type of an expression"},
+	{Text: "x", Description: "examine the memory"},
+}
+
+// locationCommands complete their last argument by the sources and the functions, a flag may come before it
+var locationCommands = map[string]bool{
+	"b": true, "break": true, "tb": true, "tbreak": true, "u": true, "until": true, "l": true, "list": true, "trace": true,
+}
+
+// maxSuggests is how many suggestions are shown at most
+const maxSuggests = 30
+
+// complete suggests the commands for the first word, the sources and the functions for the locations
 func complete(docs prompt.Document) []prompt.Suggest {
-	sps := strings.Split(docs.Text, " ")
+	sps := strings.Split(docs.TextBeforeCursor(), " ")
+	word := sps[len(sps)-1]
 
 	s := make([]prompt.Suggest, 0)
+	if len(sps) == 1 {
+		s = append(s, prompt.FilterHasPrefix(commandSuggests, word, false)...)
+		for name, commands := range aliases {
+			if strings.HasPrefix(name, word) {
+				s = append(s, prompt.Suggest{Text: name, Description: commands})
+			}
+		}
+		for name := range scriptCommands {
+			if strings.HasPrefix(name, word) {
+				s = append(s, prompt.Suggest{Text: name, Description: "defined by a script"})
+			}
+		}
+		return s
+	}
+	if bi == nil || !locationCommands[sps[0]] || len(sps) > 3 || (len(sps) == 3 && !strings.HasPrefix(sps[1], "-")) {
+		return s
+	}
+
+	candidates := append(completeSources(word), completeFunctions(word)...)
+	// the prompt replaces the word after the last separator, so the suggestions start there too
+	cut := strings.LastIndex(word, "/") + 1
+	for _, c := range candidates {
+		if len(s) == maxSuggests {
+			break
+		}
+		s = append(s, prompt.Suggest{Text: c[cut:]})
+	}
+	return s
+}
 
+// completeSources returns the sources beginning with prefix, which is either absolute or relative to the working directory
+func completeSources(prefix string) []string {
 	curWd, _ := os.Getwd()
+	sources := make([]string, 0)
+	// path.Join drops `./` and the trailing `/` of prefix, what follows it in filename is appended to prefix as it is
+	base := path.Join(curWd, prefix)
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		base += "/"
+	}
+	for _, source := range bi.sourceFiles() {
+		// the sources are completed where they are on this machine
+		filename := substitutePath(source)
+		if path.IsAbs(prefix) {
+			if strings.HasPrefix(filename, prefix) {
+				sources = append(sources, filename)
+			}
+		} else if strings.HasPrefix(filename, base) {
+			sources = append(sources, prefix+filename[len(base):])
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
 
-	if len(sps) == 2 {
-		if sps[0] == "b" || sps[0] == "break" || sps[0] == "l" || sps[0] == "list" {
-			for filename := range bi.Sources {
-				if strings.HasPrefix(filename, sps[1]) {
-					if filename[0] == '/' {
-						filename = filename[1:]
-					}
-					s = append(s, prompt.Suggest{Text: filename, Description:""})
-				} else {
+// printFunctions lists the functions matching the regexp filter by `funcs [-optimized] [regexp]`, only the
+// optimized ones if optimized is true
+func printFunctions(filter string, optimized bool) {
+	re, err := regexp.Compile(filter)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	for _, name := range bi.functionNames() {
+		if re.MatchString(name) && (!optimized || bi.optimizedFunction(name)) {
+			fmt.Fprintf(stdout, "%s\n", name)
+		}
+	}
+}
 
-					inputPrefix := sps[1]
-					if inputPrefixFilename := path.Join(curWd, inputPrefix); strings.HasPrefix(filename, inputPrefixFilename) {
-						needComplete := ""
-						if inputPrefix == "./" {
-							inputPrefix = ""
-							needComplete = filename[len(inputPrefixFilename):]
-							if len(needComplete) > 0 && needComplete[0] == '/' {
-								needComplete = needComplete[1:]
-							}
-						} else {
-							if len(inputPrefix) > 2 && inputPrefix[:2] == "./" {
-								inputPrefix = inputPrefix[2:]
-							}
-							needComplete = filename[len(inputPrefixFilename):]
-						}
-						s = append(s, prompt.Suggest{Text: inputPrefix + needComplete, Description: ""})
-					}
-				}
-				if len(s) >= 30 {
-					return s
-				}
-			}
+// completeFunctions returns the names of the functions beginning with prefix
+func completeFunctions(prefix string) []string {
+	functions := make([]string, 0)
+	for _, name := range bi.functionNames() {
+		if strings.HasPrefix(name, prefix) {
+			functions = append(functions, name)
 		}
 	}
-	return s
+	return functions
 }
 
 const (
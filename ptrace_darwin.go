@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// darwin reads the registers of a thread by thread_get_state of its mach task port, which needs the entitlement
+// com.apple.security.cs.debugger. godbg doesn't have it, so the debuggee is driven by debugserver of lldb, which
+// has it, through the gdb remote serial protocol. Every request goes to replay, see launchDebugserver
+const useDebugserver = true
+
+// maxSignal is NSIG-1 of <sys/signal.h>, darwin has no real time signals
+const maxSignal = 31
+
+// debugserver stops and resumes every thread of the process together
+const stopsProcess = true
+
+var NoDebugserverErr = errors.New("the debuggee is driven by debugserver on darwin, it is not connected")
+
+// copy from <sys/sysctl.h>
+const (
+	_CTL_KERN       = 1
+	_KERN_PROCARGS2 = 49
+)
+
+// PtraceRegs is `x86_thread_state64_t` of <mach/i386/_structs.h>, which debugserver sends, field names follow
+// syscall.PtraceRegs of linux.
+type PtraceRegs struct {
+	Rax    uint64
+	Rbx    uint64
+	Rcx    uint64
+	Rdx    uint64
+	Rdi    uint64
+	Rsi    uint64
+	Rbp    uint64
+	Rsp    uint64
+	R8     uint64
+	R9     uint64
+	R10    uint64
+	R11    uint64
+	R12    uint64
+	R13    uint64
+	R14    uint64
+	R15    uint64
+	Rip    uint64
+	Rflags uint64
+	Cs     uint64
+	Fs     uint64
+	Gs     uint64
+	// Ss is not in the thread state, it is always 0 in the 64-bit mode
+	Ss uint64
+}
+
+func (r *PtraceRegs) PC() uint64 { return r.Rip }
+
+func (r *PtraceRegs) SetPC(pc uint64) { r.Rip = pc }
+
+// the stops come from debugserver, the options of wait4 are never used
+const waitOptions = 0
+
+func ptracePeekData(pid int, addr uintptr, out []byte) (int, error) {
+	if replay == nil {
+		return 0, NoDebugserverErr
+	}
+	return replay.readMemory(addr, out)
+}
+
+// readMemory reads out by the `m` packets like ptracePeekData
+func readMemory(pid int, addr uintptr, out []byte) (int, error) {
+	return ptracePeekData(pid, addr, out)
+}
+
+// writeMemory writes data by the `M` packets, debugserver makes the text writable for the breakpoints
+func writeMemory(pid int, addr uintptr, data []byte) (int, error) {
+	if replay == nil {
+		return 0, NoDebugserverErr
+	}
+	return replay.writeMemory(addr, data)
+}
+
+func ptracePokeData(pid int, addr uintptr, data []byte) (int, error) {
+	return writeMemory(pid, addr, data)
+}
+
+func ptraceCont(pid int, signal int) error {
+	if replay == nil {
+		return NoDebugserverErr
+	}
+	if signal != 0 {
+		return replay.resume(fmt.Sprintf("C%02x", gdbSignalNumber(syscall.Signal(signal))))
+	}
+	return replay.resume("c")
+}
+
+func ptraceSingleStep(pid int) error {
+	if replay == nil {
+		return NoDebugserverErr
+	}
+	return replay.resume("s")
+}
+
+func ptraceGetRegs(pid int, regs *PtraceRegs) error {
+	if replay == nil {
+		return NoDebugserverErr
+	}
+	return replay.readRegisters(regs)
+}
+
+func ptraceSetRegs(pid int, regs *PtraceRegs) error {
+	if replay == nil {
+		return NoDebugserverErr
+	}
+	return replay.writeRegisters(regs)
+}
+
+// ptraceGetFsBase is 0, the go runtime of darwin keeps the g in the TLS of gs, whose base debugserver doesn't
+// send. threadGoroutine reads r14 then
+func ptraceGetFsBase(tid int) (uint64, error) {
+	return 0, nil
+}
+
+// the forks, execs and new threads are reported by debugserver itself
+func ptraceSetTraceOptions(pid int) error {
+	return nil
+}
+
+func ptraceEvent(s syscall.WaitStatus) int {
+	return 0
+}
+
+func ptraceGetEventMsg(pid int) (uint, error) {
+	return 0, errors.New("ptrace events are unsupported on darwin")
+}
+
+// ptraceAttach is never called, attachDebugserver attaches by debugserver
+func ptraceAttach(pid int) error {
+	return NoDebugserverErr
+}
+
+func ptraceDetach(pid int, signal int) error {
+	return NoDebugserverErr
+}
+
+// processExecutable returns the path of the binary that pid is running by sysctl kern.procargs2.<pid>, which
+// is argc followed by the path
+func processExecutable(pid int) (string, error) {
+	mib := [3]int32{_CTL_KERN, _KERN_PROCARGS2, int32(pid)}
+	buf := make([]byte, 4096)
+	n := uintptr(len(buf))
+	if _, _, e := syscall.Syscall6(syscall.SYS___SYSCTL, uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&n)), 0, 0); e != 0 {
+		return "", e
+	}
+	if n <= 4 {
+		return "", fmt.Errorf("can't read the arguments of process %d", pid)
+	}
+	path := buf[4:n]
+	if i := bytes.IndexByte(path, 0); i >= 0 {
+		path = path[:i]
+	}
+	return string(path), nil
+}
+
+// processThreads is never called, debugserver stops every thread
+func processThreads(pid int) ([]int, error) {
+	return []int{pid}, nil
+}
+
+func processOfThread(tid int) int {
+	return tid
+}
+
+func stopThread(pid int, tid int) error {
+	return NoDebugserverErr
+}
+
+// processAuxv and processMaps are never called, checkProcInfo rejects the debuggee of debugserver
+func processAuxv(pid int) ([]byte, error) {
+	return nil, NoProcInfoErr
+}
+
+func processMaps(pid int) ([]MemoryMap, error) {
+	return nil, NoProcInfoErr
+}
+
+// the hardware watchpoints are unsupported, debugserver sets them by the `Z2` packets which godbg doesn't send
+func ptraceGetDebugReg(tid int, index int) (uint64, error) {
+	if replay == nil {
+		return 0, NoDebugserverErr
+	}
+	return 0, replay.unsupportedErr()
+}
+
+func ptraceSetDebugReg(tid int, index int, value uint64) error {
+	if replay == nil {
+		return NoDebugserverErr
+	}
+	return replay.unsupportedErr()
+}
+
+// wait4 converts the stop reply of debugserver, the debuggee is its child, not the one of godbg
+func wait4(pid int, s *syscall.WaitStatus) (int, error) {
+	if replay == nil {
+		return 0, NoDebugserverErr
+	}
+	return replay.wait(s)
+}
+
+// gdbRegisters converts the `g` packet of amd64 in the layout of gdb, the registers are rax, rbx, rcx, rdx, rsi,
+// rdi, rbp, rsp, r8-r15, rip of 8 bytes, then eflags, cs, ss, ds, es, fs, gs of 4 bytes. debugserver sends its
+// own layout, which is read by the names of qRegisterInfo
+func gdbRegisters(data []byte, regs *PtraceRegs) {
+	u64 := func(off int) uint64 { return binary.LittleEndian.Uint64(data[off:]) }
+	u32 := func(off int) uint64 { return uint64(binary.LittleEndian.Uint32(data[off:])) }
+	*regs = PtraceRegs{
+		Rax: u64(0), Rbx: u64(8), Rcx: u64(16), Rdx: u64(24),
+		Rsi: u64(32), Rdi: u64(40), Rbp: u64(48), Rsp: u64(56),
+		R8: u64(64), R9: u64(72), R10: u64(80), R11: u64(88),
+		R12: u64(96), R13: u64(104), R14: u64(112), R15: u64(120),
+		Rip:    u64(128),
+		Rflags: u32(136), Cs: u32(140), Ss: u32(144), Fs: u32(156), Gs: u32(160),
+	}
+}
+
+// gdbRegisterBytes converts regs to the `g` packet of amd64 like gdbRegisters reads, fpregs is the fxsave area
+// of the x87 and sse registers. ds and es are 0 in the 64-bit mode of darwin
+func gdbRegisterBytes(regs *PtraceRegs, fpregs []byte) []byte {
+	data := make([]byte, 164, 164+8*10+8*4+16*16+4)
+	for i, v := range []uint64{regs.Rax, regs.Rbx, regs.Rcx, regs.Rdx, regs.Rsi, regs.Rdi, regs.Rbp, regs.Rsp,
+		regs.R8, regs.R9, regs.R10, regs.R11, regs.R12, regs.R13, regs.R14, regs.R15, regs.Rip} {
+		binary.LittleEndian.PutUint64(data[i*8:], v)
+	}
+	for i, v := range []uint64{regs.Rflags, regs.Cs, regs.Ss, 0, 0, regs.Fs, regs.Gs} {
+		binary.LittleEndian.PutUint32(data[136+i*4:], uint32(v))
+	}
+	return append(data, gdbFpRegisters(fpregs)...)
+}
+
+const gdbOsabi = "Darwin"
+
+func ptraceFork(pid int) (int, error) {
+	return 0, errors.New("checkpoints are unsupported on darwin")
+}
+
+// flagsRegister returns rflags
+func flagsRegister(r *PtraceRegs) *uint64 { return &r.Rflags }
+
+func ptraceGetFpRegs(pid int) ([]byte, error) {
+	if replay == nil {
+		return nil, NoDebugserverErr
+	}
+	return replay.readFpRegisters()
+}
+
+func ptraceSetFpRegs(pid int, fpregs []byte) error {
+	if replay == nil {
+		return NoDebugserverErr
+	}
+	return replay.writeFpRegisters(fpregs)
+}
+
+// readNote is unsupported, the core files of darwin are Mach-O
+func (c *coreFile) readNote(name string, typ uint32, desc []byte) error {
+	return errors.New("the core files are only supported on linux")
+}
+
+// signalFrameCaller is unsupported, the signal frames of darwin are not unwound yet
+func signalFrameCaller(cfa uint64) (uint64, uint64, uint64, error) {
+	return 0, 0, 0, errors.New("the signal frames are only unwound on linux")
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// copy from <sys/ptrace.h>
+const (
+	_PT_CONTINUE   = 7
+	_PT_STEP       = 9
+	_PT_ATTACH     = 10
+	_PT_DETACH     = 11
+	_PT_IO         = 12
+	_PT_LWPINFO    = 13
+	_PT_GETNUMLWPS = 14
+	_PT_GETLWPLIST = 15
+	_PT_GETREGS    = 33
+	_PT_SETREGS    = 34
+	_PT_GETFPREGS  = 35
+	_PT_SETFPREGS  = 36
+	_PT_GETDBREGS  = 37
+	_PT_SETDBREGS  = 38
+	_PT_GETFSBASE  = 47
+
+	_PIOD_READ_D  = 1
+	_PIOD_WRITE_D = 2
+)
+
+// copy from <sys/sysctl.h>
+const (
+	_CTL_KERN           = 1
+	_KERN_PROC          = 14
+	_KERN_PROC_PATHNAME = 12
+	_KERN_PROC_VMMAP    = 32
+	_KERN_PROC_AUXV     = 36
+)
+
+// copy from <sys/user.h> and <sys/proc.h>
+const (
+	_PID_MAX = 99999
+	// offsetof(struct kinfo_vmentry, kve_path) on amd64
+	_KVE_PATH_OFFSET = 136
+	_KVME_PROT_READ  = 0x1
+	_KVME_PROT_WRITE = 0x2
+	_KVME_PROT_EXEC  = 0x4
+	_KVME_FLAG_COW   = 0x1
+)
+
+// PtraceRegs is `struct reg` of <machine/reg.h> on amd64, field names follow syscall.PtraceRegs of linux.
+type PtraceRegs struct {
+	R15    uint64
+	R14    uint64
+	R13    uint64
+	R12    uint64
+	R11    uint64
+	R10    uint64
+	R9     uint64
+	R8     uint64
+	Rdi    uint64
+	Rsi    uint64
+	Rbp    uint64
+	Rbx    uint64
+	Rdx    uint64
+	Rcx    uint64
+	Rax    uint64
+	Trapno uint32
+	Fs     uint16
+	Gs     uint16
+	Err    uint32
+	Es     uint16
+	Ds     uint16
+	Rip    uint64
+	Cs     uint64
+	Rflags uint64
+	Rsp    uint64
+	Ss     uint64
+}
+
+func (r *PtraceRegs) PC() uint64 { return r.Rip }
+
+func (r *PtraceRegs) SetPC(pc uint64) { r.Rip = pc }
+
+// `struct dbreg` of <machine/reg.h> on amd64
+type dbreg struct {
+	dr [16]uint64
+}
+
+// `struct ptrace_io_desc` of <sys/ptrace.h>
+type ptraceIoDesc struct {
+	op   int32
+	offs uintptr
+	addr uintptr
+	len  uint64
+}
+
+// the head of `struct ptrace_lwpinfo` of <sys/ptrace.h>, PT_LWPINFO copies as much as it is given
+type ptraceLwpInfo struct {
+	lwpid int32
+	event int32
+	flags int32
+}
+
+// freebsd reports traced children without any extra option
+const waitOptions = 0
+
+const useDebugserver = false
+
+// maxSignal is _SIG_MAXSIG of <sys/signal.h>, the real time signals of freebsd are numbered up to it
+const maxSignal = 128
+
+// the LWPs of freebsd stop and resume with the process, ptrace attaches, continues and detaches the process
+// as a whole and wait4 waits for it
+const stopsProcess = true
+
+func ptrace(request int, pid int, addr uintptr, data int) error {
+	if _, _, e := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(request), uintptr(pid), addr, uintptr(data), 0, 0); e != 0 {
+		return e
+	}
+	return nil
+}
+
+func ptraceIo(op int32, pid int, addr uintptr, buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	desc := &ptraceIoDesc{op: op, offs: addr, addr: uintptr(unsafe.Pointer(&buf[0])), len: uint64(len(buf))}
+	if err := ptrace(_PT_IO, pid, uintptr(unsafe.Pointer(desc)), 0); err != nil {
+		return 0, err
+	}
+	return int(desc.len), nil
+}
+
+func ptracePeekData(pid int, addr uintptr, out []byte) (int, error) {
+	return ptraceIo(_PIOD_READ_D, pid, addr, out)
+}
+
+// readMemory reads out from addr of pid by PT_IO, which reads all of it in one call like process_vm_readv
+func readMemory(pid int, addr uintptr, out []byte) (int, error) {
+	return ptraceIo(_PIOD_READ_D, pid, addr, out)
+}
+
+// writeMemory writes data at addr of pid by PT_IO, which writes the read-only text too
+func writeMemory(pid int, addr uintptr, data []byte) (int, error) {
+	return ptraceIo(_PIOD_WRITE_D, pid, addr, data)
+}
+
+func ptracePokeData(pid int, addr uintptr, data []byte) (int, error) {
+	return ptraceIo(_PIOD_WRITE_D, pid, addr, data)
+}
+
+// addr == 1 means resume where the process stopped
+func ptraceCont(pid int, signal int) error {
+	return ptrace(_PT_CONTINUE, pid, 1, signal)
+}
+
+func ptraceSingleStep(pid int) error {
+	return ptrace(_PT_STEP, pid, 1, 0)
+}
+
+func ptraceGetRegs(pid int, regs *PtraceRegs) error {
+	return ptrace(_PT_GETREGS, pid, uintptr(unsafe.Pointer(regs)), 0)
+}
+
+func ptraceSetRegs(pid int, regs *PtraceRegs) error {
+	return ptrace(_PT_SETREGS, pid, uintptr(unsafe.Pointer(regs)), 0)
+}
+
+func ptraceGetFsBase(tid int) (uint64, error) {
+	var base uint64
+	err := ptrace(_PT_GETFSBASE, tid, uintptr(unsafe.Pointer(&base)), 0)
+	return base, err
+}
+
+// the forks and execs are not followed on freebsd, PT_FOLLOW_FORK reports them in a different way
+func ptraceSetTraceOptions(pid int) error {
+	return nil
+}
+
+func ptraceEvent(s syscall.WaitStatus) int {
+	return 0
+}
+
+func ptraceGetEventMsg(pid int) (uint, error) {
+	return 0, errors.New("ptrace events are unsupported on freebsd")
+}
+
+func ptraceAttach(pid int) error {
+	return ptrace(_PT_ATTACH, pid, 0, 0)
+}
+
+func ptraceDetach(pid int, signal int) error {
+	return ptrace(_PT_DETACH, pid, 1, signal)
+}
+
+// processExecutable returns the path of the binary that pid is running, by sysctl kern.proc.pathname.<pid>
+func processExecutable(pid int) (string, error) {
+	mib := [4]int32{_CTL_KERN, _KERN_PROC, _KERN_PROC_PATHNAME, int32(pid)}
+	buf := make([]byte, 1024) // PATH_MAX
+	n := uintptr(len(buf))
+	if _, _, e := syscall.Syscall6(syscall.SYS___SYSCTL, uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&n)), 0, 0); e != 0 {
+		return "", e
+	}
+	if n > 0 && buf[n-1] == 0 {
+		n--
+	}
+	return string(buf[:n]), nil
+}
+
+// processThreads returns the LWPs of pid by PT_GETNUMLWPS and PT_GETLWPLIST, pid must be traced and stopped.
+// The requests on an LWP like PT_GETREGS take its id for pid
+func processThreads(pid int) ([]int, error) {
+	n, _, e := syscall.Syscall6(syscall.SYS_PTRACE, _PT_GETNUMLWPS, uintptr(pid), 0, 0, 0, 0)
+	if e != 0 {
+		return nil, e
+	}
+	if n == 0 {
+		return []int{pid}, nil
+	}
+	lwps := make([]int32, n)
+	n, _, e = syscall.Syscall6(syscall.SYS_PTRACE, _PT_GETLWPLIST, uintptr(pid), uintptr(unsafe.Pointer(&lwps[0])),
+		uintptr(len(lwps)), 0, 0)
+	if e != 0 {
+		return nil, e
+	}
+	tids := make([]int, 0, n)
+	for _, lwp := range lwps[:n] {
+		tids = append(tids, int(lwp))
+	}
+	return tids, nil
+}
+
+// processOfThread returns the process of the LWPs, whose ids are beyond PID_MAX
+func processOfThread(tid int) int {
+	if tid > _PID_MAX && cmd != nil && cmd.Process != nil {
+		return cmd.Process.Pid
+	}
+	return tid
+}
+
+// stopThread is never called, the LWPs stop with the process
+func stopThread(pid int, tid int) error {
+	return syscall.Kill(pid, syscall.SIGSTOP)
+}
+
+// sysctl returns the value of mib, which is read again if it grows between asking the size and reading it
+func sysctl(mib []int32) ([]byte, error) {
+	for {
+		n := uintptr(0)
+		if _, _, e := syscall.Syscall6(syscall.SYS___SYSCTL, uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)), 0,
+			uintptr(unsafe.Pointer(&n)), 0, 0); e != 0 {
+			return nil, e
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		// the maps of a running process may grow meanwhile
+		buf := make([]byte, n+n/4)
+		n = uintptr(len(buf))
+		_, _, e := syscall.Syscall6(syscall.SYS___SYSCTL, uintptr(unsafe.Pointer(&mib[0])), uintptr(len(mib)),
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&n)), 0, 0)
+		if e == syscall.ENOMEM {
+			continue
+		}
+		if e != 0 {
+			return nil, e
+		}
+		return buf[:n], nil
+	}
+}
+
+// processAuxv reads the auxv of pid by sysctl kern.proc.auxv.<pid> like `procstat -x`, the entries are
+// `Elf64_Auxinfo` of the tag and the value of 8 bytes as on linux
+func processAuxv(pid int) ([]byte, error) {
+	return sysctl([]int32{_CTL_KERN, _KERN_PROC, _KERN_PROC_AUXV, int32(pid)})
+}
+
+// processMaps reads the maps of pid by sysctl kern.proc.vmmap.<pid> like `procstat -v`. The records are
+// `struct kinfo_vmentry` of <sys/user.h>, each one is kve_structsize long with kve_path cut after its nul
+func processMaps(pid int) ([]MemoryMap, error) {
+	data, err := sysctl([]int32{_CTL_KERN, _KERN_PROC, _KERN_PROC_VMMAP, int32(pid)})
+	if err != nil {
+		return nil, err
+	}
+	maps := make([]MemoryMap, 0)
+	for len(data) >= _KVE_PATH_OFFSET {
+		size := int(binary.LittleEndian.Uint32(data))
+		if size < _KVE_PATH_OFFSET || size > len(data) {
+			return nil, fmt.Errorf("invalid kinfo_vmentry of %d bytes", size)
+		}
+		entry := data[:size]
+		data = data[size:]
+		prot := binary.LittleEndian.Uint32(entry[56:])
+		flags := binary.LittleEndian.Uint32(entry[44:])
+		perms := []byte("---s")
+		if prot&_KVME_PROT_READ != 0 {
+			perms[0] = 'r'
+		}
+		if prot&_KVME_PROT_WRITE != 0 {
+			perms[1] = 'w'
+		}
+		if prot&_KVME_PROT_EXEC != 0 {
+			perms[2] = 'x'
+		}
+		if flags&_KVME_FLAG_COW != 0 {
+			perms[3] = 'p'
+		}
+		path := entry[_KVE_PATH_OFFSET:]
+		if i := bytes.IndexByte(path, 0); i >= 0 {
+			path = path[:i]
+		}
+		maps = append(maps, MemoryMap{
+			Start:  binary.LittleEndian.Uint64(entry[8:]),
+			End:    binary.LittleEndian.Uint64(entry[16:]),
+			Offset: binary.LittleEndian.Uint64(entry[24:]),
+			Perms:  string(perms),
+			Path:   string(path),
+		})
+	}
+	return maps, nil
+}
+
+func ptraceGetDebugReg(tid int, index int) (uint64, error) {
+	var regs dbreg
+	if err := ptrace(_PT_GETDBREGS, tid, uintptr(unsafe.Pointer(&regs)), 0); err != nil {
+		return 0, err
+	}
+	return regs.dr[index], nil
+}
+
+func ptraceSetDebugReg(tid int, index int, value uint64) error {
+	var regs dbreg
+	if err := ptrace(_PT_GETDBREGS, tid, uintptr(unsafe.Pointer(&regs)), 0); err != nil {
+		return err
+	}
+	regs.dr[index] = value
+	return ptrace(_PT_SETDBREGS, tid, uintptr(unsafe.Pointer(&regs)), 0)
+}
+
+// wait4 waits for the process of the LWP pid, freebsd reports the stops of the process only. The LWP which
+// stops it is returned by PT_LWPINFO, like wait4 of linux returns the thread
+func wait4(pid int, s *syscall.WaitStatus) (int, error) {
+	if replay != nil {
+		return replay.wait(s)
+	}
+	wpid, err := syscall.Wait4(processOfThread(pid), s, waitOptions, nil)
+	if err != nil || !s.Stopped() {
+		return wpid, err
+	}
+	var info ptraceLwpInfo
+	if ptrace(_PT_LWPINFO, wpid, uintptr(unsafe.Pointer(&info)), int(unsafe.Sizeof(info))) != nil {
+		return wpid, nil
+	}
+	return int(info.lwpid), nil
+}
+
+// gdbRegisters converts the `g` packet of amd64, the registers are rax, rbx, rcx, rdx, rsi, rdi, rbp, rsp,
+// r8-r15, rip of 8 bytes, then eflags, cs, ss, ds, es, fs, gs of 4 bytes
+func gdbRegisters(data []byte, regs *PtraceRegs) {
+	u64 := func(off int) uint64 { return binary.LittleEndian.Uint64(data[off:]) }
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(data[off:]) }
+	*regs = PtraceRegs{
+		Rax: u64(0), Rbx: u64(8), Rcx: u64(16), Rdx: u64(24),
+		Rsi: u64(32), Rdi: u64(40), Rbp: u64(48), Rsp: u64(56),
+		R8: u64(64), R9: u64(72), R10: u64(80), R11: u64(88),
+		R12: u64(96), R13: u64(104), R14: u64(112), R15: u64(120),
+		Rip:    u64(128),
+		Rflags: uint64(u32(136)), Cs: uint64(u32(140)), Ss: uint64(u32(144)),
+		Ds: uint16(u32(148)), Es: uint16(u32(152)), Fs: uint16(u32(156)), Gs: uint16(u32(160)),
+	}
+}
+
+// gdbRegisterBytes converts regs to the `g` packet of amd64 like gdbRegisters reads, fpregs is the fxsave area
+// of the x87 and sse registers
+func gdbRegisterBytes(regs *PtraceRegs, fpregs []byte) []byte {
+	data := make([]byte, 164, 164 + 8*10 + 8*4 + 16*16 + 4)
+	for i, v := range []uint64{regs.Rax, regs.Rbx, regs.Rcx, regs.Rdx, regs.Rsi, regs.Rdi, regs.Rbp, regs.Rsp,
+		regs.R8, regs.R9, regs.R10, regs.R11, regs.R12, regs.R13, regs.R14, regs.R15, regs.Rip} {
+		binary.LittleEndian.PutUint64(data[i*8:], v)
+	}
+	for i, v := range []uint64{regs.Rflags, regs.Cs, regs.Ss, uint64(regs.Ds), uint64(regs.Es), uint64(regs.Fs), uint64(regs.Gs)} {
+		binary.LittleEndian.PutUint32(data[136+i*4:], uint32(v))
+	}
+	return append(data, gdbFpRegisters(fpregs)...)
+}
+
+const gdbOsabi = "FreeBSD"
+
+func ptraceFork(pid int) (int, error) {
+	return 0, errors.New("checkpoints are unsupported on freebsd")
+}
+
+// flagsRegister returns rflags
+func flagsRegister(r *PtraceRegs) *uint64 { return &r.Rflags }
+
+// ptraceGetFpRegs reads `struct fpreg` of <machine/reg.h>, which is 512 bytes like fxsave
+func ptraceGetFpRegs(pid int) ([]byte, error) {
+	fpregs := make([]byte, 512)
+	if err := ptrace(_PT_GETFPREGS, pid, uintptr(unsafe.Pointer(&fpregs[0])), 0); err != nil {
+		return nil, err
+	}
+	return fpregs, nil
+}
+
+func ptraceSetFpRegs(pid int, fpregs []byte) error {
+	return ptrace(_PT_SETFPREGS, pid, uintptr(unsafe.Pointer(&fpregs[0])), 0)
+}
+
+// readNote is unsupported, the core files of freebsd keep the base of fs, where the go runtime keeps
+// the current g, in NT_X86_SEGBASES which godbg doesn't read yet
+func (c *coreFile) readNote(name string, typ uint32, desc []byte) error {
+	return errors.New("the core files are only supported on linux")
+}
+
+// signalFrameCaller is unsupported, the signal frames of freebsd are not unwound yet
+func signalFrameCaller(cfa uint64) (uint64, uint64, uint64, error) {
+	return 0, 0, 0, errors.New("the signal frames are only unwound on linux")
+}
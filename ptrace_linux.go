@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// PtraceRegs is the register set read and written by PTRACE_GETREGS/PTRACE_SETREGS.
+type PtraceRegs = syscall.PtraceRegs
+
+// copy from <sys/user.h>, offsetof(struct user, u_debugreg) on amd64
+const debugRegOffset = 848
+
+// waitOptions is passed to every wait4 on the debuggee, __WALL also reports its non-leader threads.
+const waitOptions = syscall.WALL
+
+// useDebugserver is false, the debuggee is traced by ptrace itself
+const useDebugserver = false
+
+// maxSignal is SIGRTMAX of linux, the real time signals are numbered up to it
+const maxSignal = 64
+
+// stopsProcess is false, ptrace of linux attaches, resumes and detaches the threads one by one
+const stopsProcess = false
+
+// traceOptions reports the forks, execs and new threads of the debuggee, the children and the threads
+// are traced from the beginning
+const traceOptions = syscall.PTRACE_O_TRACEFORK | syscall.PTRACE_O_TRACEVFORK | syscall.PTRACE_O_TRACEEXEC |
+	syscall.PTRACE_O_TRACECLONE
+
+// copy from <asm/unistd_64.h>, the syscall package doesn't have process_vm_readv and process_vm_writev
+const (
+	sysProcessVmReadv  = 310
+	sysProcessVmWritev = 311
+)
+
+func ptracePeekData(pid int, addr uintptr, out []byte) (int, error) {
+	if core != nil {
+		return core.readMemory(addr, out)
+	}
+	if replay != nil {
+		return replay.readMemory(addr, out)
+	}
+	return syscall.PtracePeekData(pid, addr, out)
+}
+
+// readMemory reads out from addr of pid by process_vm_readv in one call, it stops at the first unmapped page
+func readMemory(pid int, addr uintptr, out []byte) (int, error) {
+	if core != nil {
+		return core.readMemory(addr, out)
+	}
+	if replay != nil {
+		return replay.readMemory(addr, out)
+	}
+	if len(out) == 0 {
+		return 0, nil
+	}
+	local := syscall.Iovec{Base: &out[0], Len: uint64(len(out))}
+	// the base of the remote iovec is an address of pid, not a pointer
+	remote := struct {
+		base   uintptr
+		length uint64
+	}{addr, uint64(len(out))}
+	n, _, e := syscall.Syscall6(sysProcessVmReadv, uintptr(pid), uintptr(unsafe.Pointer(&local)), 1,
+		uintptr(unsafe.Pointer(&remote)), 1, 0)
+	if e != 0 {
+		return 0, e
+	}
+	return int(n), nil
+}
+
+// writeMemory writes data at addr of pid by process_vm_writev, the rest which it can't write, like the
+// read-only text where the breakpoints are, is written by PTRACE_POKEDATA
+func writeMemory(pid int, addr uintptr, data []byte) (int, error) {
+	if core != nil {
+		return 0, CoreReadOnlyErr
+	}
+	if replaying() {
+		return 0, ReplayReadOnlyErr
+	}
+	if replay != nil {
+		return replay.writeMemory(addr, data)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	local := syscall.Iovec{Base: &data[0], Len: uint64(len(data))}
+	remote := struct {
+		base   uintptr
+		length uint64
+	}{addr, uint64(len(data))}
+	n, _, e := syscall.Syscall6(sysProcessVmWritev, uintptr(pid), uintptr(unsafe.Pointer(&local)), 1,
+		uintptr(unsafe.Pointer(&remote)), 1, 0)
+	if e != 0 {
+		n = 0
+	}
+	if int(n) == len(data) {
+		return int(n), nil
+	}
+	m, err := syscall.PtracePokeData(pid, addr+n, data[n:])
+	return int(n) + m, err
+}
+
+func ptracePokeData(pid int, addr uintptr, data []byte) (int, error) {
+	if core != nil {
+		return 0, CoreReadOnlyErr
+	}
+	if replaying() {
+		return 0, ReplayReadOnlyErr
+	}
+	if replay != nil {
+		return replay.writeMemory(addr, data)
+	}
+	return syscall.PtracePokeData(pid, addr, data)
+}
+
+func ptraceCont(pid int, signal int) error {
+	if core != nil {
+		return CoreReadOnlyErr
+	}
+	if replay != nil && signal != 0 {
+		return replay.resume(fmt.Sprintf("C%02x", gdbSignalNumber(syscall.Signal(signal))))
+	}
+	if replay != nil {
+		return replay.resume("c")
+	}
+	return syscall.PtraceCont(pid, signal)
+}
+
+func ptraceSingleStep(pid int) error {
+	if core != nil {
+		return CoreReadOnlyErr
+	}
+	if replay != nil {
+		return replay.resume("s")
+	}
+	return syscall.PtraceSingleStep(pid)
+}
+
+func ptraceGetRegs(pid int, regs *PtraceRegs) error {
+	if core != nil {
+		return core.readRegisters(pid, regs)
+	}
+	if replay != nil {
+		return replay.readRegisters(regs)
+	}
+	return syscall.PtraceGetRegs(pid, regs)
+}
+
+func ptraceSetRegs(pid int, regs *PtraceRegs) error {
+	if core != nil {
+		return CoreReadOnlyErr
+	}
+	if replaying() {
+		return ReplayReadOnlyErr
+	}
+	if replay != nil {
+		return replay.writeRegisters(regs)
+	}
+	return syscall.PtraceSetRegs(pid, regs)
+}
+
+func ptraceSetTraceOptions(pid int) error {
+	if replay != nil {
+		return nil
+	}
+	return syscall.PtraceSetOptions(pid, traceOptions)
+}
+
+// ptraceEvent returns PTRACE_EVENT_* of the stop by SIGTRAP, it is 0 if the stop is not an event
+func ptraceEvent(s syscall.WaitStatus) int {
+	return s.TrapCause()
+}
+
+func ptraceGetEventMsg(pid int) (uint, error) {
+	return syscall.PtraceGetEventMsg(pid)
+}
+
+func ptraceAttach(pid int) error {
+	return syscall.PtraceAttach(pid)
+}
+
+// ptraceDetach detaches pid and delivers signal to it, syscall.PtraceDetach always passes 0
+func ptraceDetach(pid int, signal int) error {
+	if _, _, e := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_DETACH, uintptr(pid), 0, uintptr(signal), 0, 0); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// processExecutable returns the path of the binary that pid is running. The binary removed or replaced
+// since the process started is still read by /proc/<pid>/exe
+func processExecutable(pid int) (string, error) {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err == nil && strings.HasSuffix(exe, " (deleted)") {
+		return fmt.Sprintf("/proc/%d/exe", pid), nil
+	}
+	return exe, err
+}
+
+// processThreads returns the tid of every thread in pid
+func processThreads(pid int) ([]int, error) {
+	names, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(names))
+	for _, name := range names {
+		tid, err := strconv.Atoi(name.Name())
+		if err != nil {
+			continue
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
+
+// processOfThread returns the Tgid in /proc/<tid>/status, it is 0 if tid has gone
+func processOfThread(tid int) int {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "Tgid:") {
+			pid, _ := strconv.Atoi(strings.TrimSpace(line[len("Tgid:"):]))
+			return pid
+		}
+	}
+	return 0
+}
+
+// stopThread sends SIGSTOP to the thread tid only
+func stopThread(pid int, tid int) error {
+	return syscall.Tgkill(pid, tid, syscall.SIGSTOP)
+}
+
+// processAuxv reads /proc/<pid>/auxv, the pairs of the tag and the value of 8 bytes
+func processAuxv(pid int) ([]byte, error) {
+	return ioutil.ReadFile(fmt.Sprintf("/proc/%d/auxv", pid))
+}
+
+// processMaps parses /proc/<pid>/maps, whose lines are like `start-end perms offset dev inode path`
+func processMaps(pid int) ([]MemoryMap, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	maps := make([]MemoryMap, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if len(bounds) != 2 {
+			continue
+		}
+		m := MemoryMap{Perms: fields[1]}
+		m.Start, _ = strconv.ParseUint(bounds[0], 16, 64)
+		m.End, _ = strconv.ParseUint(bounds[1], 16, 64)
+		m.Offset, _ = strconv.ParseUint(fields[2], 16, 64)
+		if len(fields) > 5 {
+			m.Path = strings.Join(fields[5:], " ")
+		}
+		maps = append(maps, m)
+	}
+	return maps, nil
+}
+
+// ptraceGetDebugReg reads DR0-DR7 by PTRACE_PEEKUSER, the raw syscall stores the word at data
+func ptraceGetDebugReg(tid int, index int) (uint64, error) {
+	if core != nil {
+		return 0, CoreReadOnlyErr
+	}
+	if replay != nil {
+		return 0, replay.unsupportedErr()
+	}
+	var val uint64
+	if _, _, e := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_PEEKUSR, uintptr(tid),
+		uintptr(debugRegOffset+index*8), uintptr(unsafe.Pointer(&val)), 0, 0); e != 0 {
+		return 0, e
+	}
+	return val, nil
+}
+
+func ptraceSetDebugReg(tid int, index int, value uint64) error {
+	if core != nil {
+		return CoreReadOnlyErr
+	}
+	if replay != nil {
+		return replay.unsupportedErr()
+	}
+	if _, _, e := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_POKEUSR, uintptr(tid),
+		uintptr(debugRegOffset+index*8), uintptr(value), 0, 0); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// ptraceGetFsBase returns the base of fs of tid, the go runtime keeps the current g in the TLS below it
+func ptraceGetFsBase(tid int) (uint64, error) {
+	var regs PtraceRegs
+	if err := ptraceGetRegs(tid, &regs); err != nil {
+		return 0, err
+	}
+	return regs.Fs_base, nil
+}
+
+// wait4 waits the debuggee, the stop replies of the gdb server are converted in the replay and remote modes.
+// The core file never runs
+func wait4(pid int, s *syscall.WaitStatus) (int, error) {
+	if core != nil {
+		return 0, CoreReadOnlyErr
+	}
+	if replay != nil {
+		return replay.wait(s)
+	}
+	return syscall.Wait4(pid, s, waitOptions, nil)
+}
+
+// gdbRegisters converts the `g` packet of amd64, the registers are rax, rbx, rcx, rdx, rsi, rdi, rbp, rsp,
+// r8-r15, rip of 8 bytes, then eflags, cs, ss, ds, es, fs, gs of 4 bytes, the x87 and sse registers,
+// and orig_rax, fs_base, gs_base
+func gdbRegisters(data []byte, regs *PtraceRegs) {
+	u64 := func(off int) uint64 { return binary.LittleEndian.Uint64(data[off:]) }
+	u32 := func(off int) uint64 { return uint64(binary.LittleEndian.Uint32(data[off:])) }
+	*regs = PtraceRegs{
+		Rax: u64(0), Rbx: u64(8), Rcx: u64(16), Rdx: u64(24),
+		Rsi: u64(32), Rdi: u64(40), Rbp: u64(48), Rsp: u64(56),
+		R8: u64(64), R9: u64(72), R10: u64(80), R11: u64(88),
+		R12: u64(96), R13: u64(104), R14: u64(112), R15: u64(120),
+		Rip:    u64(128),
+		Eflags: u32(136), Cs: u32(140), Ss: u32(144), Ds: u32(148), Es: u32(152), Fs: u32(156), Gs: u32(160),
+	}
+	// 8 x87 registers of 10 bytes, 8 x87 control registers, 16 xmm registers and mxcsr
+	if off := 164 + 8*10 + 8*4 + 16*16 + 4; len(data) >= off+24 {
+		regs.Orig_rax = u64(off)
+		regs.Fs_base = u64(off + 8)
+		regs.Gs_base = u64(off + 16)
+	}
+}
+
+// gdbRegisterBytes converts regs to the `g` packet of amd64 like gdbRegisters reads, fpregs is the fxsave area
+// of the x87 and sse registers
+func gdbRegisterBytes(regs *PtraceRegs, fpregs []byte) []byte {
+	data := make([]byte, 164, 164 + 8*10 + 8*4 + 16*16 + 4 + 24)
+	for i, v := range []uint64{regs.Rax, regs.Rbx, regs.Rcx, regs.Rdx, regs.Rsi, regs.Rdi, regs.Rbp, regs.Rsp,
+		regs.R8, regs.R9, regs.R10, regs.R11, regs.R12, regs.R13, regs.R14, regs.R15, regs.Rip} {
+		binary.LittleEndian.PutUint64(data[i*8:], v)
+	}
+	for i, v := range []uint64{regs.Eflags, regs.Cs, regs.Ss, regs.Ds, regs.Es, regs.Fs, regs.Gs} {
+		binary.LittleEndian.PutUint32(data[136+i*4:], uint32(v))
+	}
+	data = append(data, gdbFpRegisters(fpregs)...)
+	for _, v := range []uint64{regs.Orig_rax, regs.Fs_base, regs.Gs_base} {
+		word := make([]byte, 8)
+		binary.LittleEndian.PutUint64(word, v)
+		data = append(data, word...)
+	}
+	return data
+}
+
+// gdbOsabi is the osabi of the target description, gdb knows the registers after the sse ones by it
+const gdbOsabi = "GNU/Linux"
+
+// ptraceFork runs fork(2) in the stopped process pid by the syscall instruction written at pc,
+// the child is traced by PTRACE_O_TRACEFORK. Both of them get back the memory and the registers,
+// the child keeps stopped. Only the thread calling fork exists in the child
+func ptraceFork(pid int) (int, error) {
+	var regs PtraceRegs
+	if err := syscall.PtraceGetRegs(pid, &regs); err != nil {
+		return 0, err
+	}
+	original := make([]byte, 2)
+	if _, err := syscall.PtracePeekData(pid, uintptr(regs.Rip), original); err != nil {
+		return 0, err
+	}
+	restore := func(tid int) error {
+		if _, err := syscall.PtracePokeData(tid, uintptr(regs.Rip), original); err != nil {
+			return err
+		}
+		return syscall.PtraceSetRegs(tid, &regs)
+	}
+
+	if _, err := syscall.PtracePokeData(pid, uintptr(regs.Rip), []byte{0x0f, 0x05}); err != nil {
+		return 0, err
+	}
+	call := regs
+	call.Rax = syscall.SYS_FORK
+	call.Orig_rax = ^uint64(0)
+	err := syscall.PtraceSetRegs(pid, &call)
+	if err == nil {
+		err = ptraceSetTraceOptions(pid)
+	}
+	child := 0
+	if err == nil {
+		child, err = stepSyscallFork(pid)
+	}
+	if restoreErr := restore(pid); err == nil {
+		err = restoreErr
+	}
+	if err != nil || child == 0 {
+		return 0, err
+	}
+
+	// the child begins with SIGSTOP
+	var s syscall.WaitStatus
+	if _, err = syscall.Wait4(child, &s, waitOptions, nil); err != nil {
+		return 0, err
+	}
+	if err = restore(child); err != nil {
+		syscall.Kill(child, syscall.SIGKILL)
+		return 0, err
+	}
+	return child, nil
+}
+
+// stepSyscallFork executes the fork written at pc, the result is known at PTRACE_EVENT_FORK,
+// then the syscall instruction is finished. The signals meanwhile are kept for the next resuming
+func stepSyscallFork(pid int) (int, error) {
+	child := 0
+	for {
+		if err := syscall.PtraceSingleStep(pid); err != nil {
+			return child, err
+		}
+		var s syscall.WaitStatus
+		if _, err := syscall.Wait4(pid, &s, waitOptions, nil); err != nil {
+			return child, err
+		}
+		if !s.Stopped() {
+			return child, fmt.Errorf("unknown waitstatus %v", s)
+		}
+		if s.StopSignal() != syscall.SIGTRAP {
+			// the checkpoints never run, their signals are dropped
+			if cmd.Process != nil && pid == cmd.Process.Pid {
+				bp.keepThreadSignal(pid, s.StopSignal())
+			}
+			continue
+		}
+		if s.TrapCause() != syscall.PTRACE_EVENT_FORK {
+			return child, nil
+		}
+		msg, err := syscall.PtraceGetEventMsg(pid)
+		if err != nil {
+			return child, err
+		}
+		child = int(msg)
+	}
+}
+
+// flagsRegister returns rflags, which is named eflags by linux
+func flagsRegister(r *PtraceRegs) *uint64 { return &r.Eflags }
+
+// ptraceGetFpRegs reads the x87 and sse registers, `struct user_fpregs_struct` of <sys/user.h> is 512 bytes
+func ptraceGetFpRegs(pid int) ([]byte, error) {
+	if core != nil {
+		return core.readFpRegisters(pid)
+	}
+	if replay != nil {
+		return replay.readFpRegisters()
+	}
+	fpregs := make([]byte, 512)
+	if _, _, e := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_GETFPREGS, uintptr(pid),
+		0, uintptr(unsafe.Pointer(&fpregs[0])), 0, 0); e != 0 {
+		return nil, e
+	}
+	return fpregs, nil
+}
+
+func ptraceSetFpRegs(pid int, fpregs []byte) error {
+	if core != nil {
+		return CoreReadOnlyErr
+	}
+	if replaying() {
+		return ReplayReadOnlyErr
+	}
+	if replay != nil {
+		return replay.writeFpRegisters(fpregs)
+	}
+	if _, _, e := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_SETFPREGS, uintptr(pid),
+		0, uintptr(unsafe.Pointer(&fpregs[0])), 0, 0); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// copy from <elf.h>, the notes of the core files
+const (
+	_NT_PRSTATUS = 1
+	_NT_FPREGSET = 2
+	_NT_PRPSINFO = 3
+)
+
+// readNote reads a note of the core file. `struct elf_prstatus` of <linux/elfcore.h> has the signal
+// at 12, the tid at 32 and `struct user_regs_struct` at 112, `struct elf_prpsinfo` has the pid at 24.
+// NT_FPREGSET is the fxsave area of the thread of the NT_PRSTATUS before it. The notes named LINUX,
+// like the xsave area, are skipped
+func (c *coreFile) readNote(name string, typ uint32, desc []byte) error {
+	if name != "CORE" {
+		return nil
+	}
+	switch typ {
+	case _NT_PRSTATUS:
+		if len(desc) < 112+int(unsafe.Sizeof(PtraceRegs{})) {
+			return errors.New("NT_PRSTATUS of the core file is truncated")
+		}
+		t := &coreThread{tid: int(binary.LittleEndian.Uint32(desc[32:]))}
+		if err := binary.Read(bytes.NewReader(desc[112:]), binary.LittleEndian, &t.regs); err != nil {
+			return err
+		}
+		if len(c.threads) == 0 {
+			c.signal = syscall.Signal(binary.LittleEndian.Uint16(desc[12:]))
+		}
+		c.threads = append(c.threads, t)
+	case _NT_FPREGSET:
+		if len(c.threads) > 0 && len(desc) >= 512 {
+			c.threads[len(c.threads)-1].fpregs = append([]byte(nil), desc[:512]...)
+		}
+	case _NT_PRPSINFO:
+		if len(desc) >= 28 {
+			c.pid = int(binary.LittleEndian.Uint32(desc[24:]))
+		}
+	}
+	return nil
+}
+
+// signalFrameCaller returns the registers of the function interrupted by the signal, the kernel pushes
+// `struct rt_sigframe` of <asm/sigframe.h> for the handler, which is the return address and then `struct ucontext`
+// at the cfa of runtime.sigtramp. The sigcontext is at 40 of ucontext, rbp, rsp and rip are at 80, 120 and 128 of it
+func signalFrameCaller(cfa uint64) (uint64, uint64, uint64, error) {
+	mem := make([]byte, 17*8)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(cfa + 40), mem); err != nil {
+		return 0, 0, 0, err
+	}
+	return binary.LittleEndian.Uint64(mem[128:]), binary.LittleEndian.Uint64(mem[120:]), binary.LittleEndian.Uint64(mem[80:]), nil
+}
@@ -1,19 +1,137 @@
 package main
 
-import "syscall"
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
 
-func getRegisters() (syscall.PtraceRegs, error){
-	var prs syscall.PtraceRegs
+// register names a field of PtraceRegs like the assembly does
+type register struct {
+	name string
+	field func(r *PtraceRegs) *uint64
+}
+
+// registers are the general-purpose registers, the flags and the segments shown by `regs` in order
+var registers = []register{
+	{"rax", func(r *PtraceRegs) *uint64 { return &r.Rax }},
+	{"rbx", func(r *PtraceRegs) *uint64 { return &r.Rbx }},
+	{"rcx", func(r *PtraceRegs) *uint64 { return &r.Rcx }},
+	{"rdx", func(r *PtraceRegs) *uint64 { return &r.Rdx }},
+	{"rsi", func(r *PtraceRegs) *uint64 { return &r.Rsi }},
+	{"rdi", func(r *PtraceRegs) *uint64 { return &r.Rdi }},
+	{"rbp", func(r *PtraceRegs) *uint64 { return &r.Rbp }},
+	{"rsp", func(r *PtraceRegs) *uint64 { return &r.Rsp }},
+	{"r8", func(r *PtraceRegs) *uint64 { return &r.R8 }},
+	{"r9", func(r *PtraceRegs) *uint64 { return &r.R9 }},
+	{"r10", func(r *PtraceRegs) *uint64 { return &r.R10 }},
+	{"r11", func(r *PtraceRegs) *uint64 { return &r.R11 }},
+	{"r12", func(r *PtraceRegs) *uint64 { return &r.R12 }},
+	{"r13", func(r *PtraceRegs) *uint64 { return &r.R13 }},
+	{"r14", func(r *PtraceRegs) *uint64 { return &r.R14 }},
+	{"r15", func(r *PtraceRegs) *uint64 { return &r.R15 }},
+	{"rip", func(r *PtraceRegs) *uint64 { return &r.Rip }},
+	{"rflags", flagsRegister},
+	{"cs", func(r *PtraceRegs) *uint64 { return &r.Cs }},
+	{"ss", func(r *PtraceRegs) *uint64 { return &r.Ss }},
+}
+
+// rflagsBits are the bits of rflags which are shown by their names
+var rflagsBits = []struct {
+	bit uint
+	name string
+}{{0, "CF"}, {2, "PF"}, {4, "AF"}, {6, "ZF"}, {7, "SF"}, {8, "TF"}, {9, "IF"}, {10, "DF"}, {11, "OF"}}
+
+func findRegister(name string) (register, error) {
+	for _, r := range registers {
+		if r.name == name {
+			return r, nil
+		}
+	}
+	return register{}, fmt.Errorf("can't find register `%s`", name)
+}
+
+// formatFlags renders the bits set in rflags like [ZF PF IF]
+func formatFlags(flags uint64) string {
+	names := make([]string, 0)
+	for i := len(rflagsBits) - 1; i >= 0; i-- {
+		if flags & (1 << rflagsBits[i].bit) != 0 {
+			names = append(names, rflagsBits[i].name)
+		}
+	}
+	return fmt.Sprintf("[%s]", strings.Join(names, " "))
+}
+
+// Registers shows the registers of the current goroutine or thread, the sse registers xmm0-xmm15
+// and mxcsr of fxsave are appended if sse is true
+func Registers(sse bool) ([]string, error) {
+	regs, err := getRegisters()
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0, len(registers))
+	for _, r := range registers {
+		v := *r.field(&regs)
+		line := fmt.Sprintf("%-7s %#-18x %d", r.name, v, v)
+		if r.name == "rflags" {
+			line = fmt.Sprintf("%-7s %#-18x %s", r.name, v, formatFlags(v))
+		}
+		lines = append(lines, line)
+	}
+	if !sse {
+		return lines, nil
+	}
+	fpregs, err := ptraceGetFpRegs(currentThread())
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, fmt.Sprintf("%-7s %#x", "mxcsr", binary.LittleEndian.Uint32(fpregs[24:])))
+	// xmm0 is at 160 of fxsave, each register is 16 bytes in little endian
+	for i := 0; i < 16; i++ {
+		xmm := fpregs[160 + i * 16 : 176 + i * 16]
+		lines = append(lines, fmt.Sprintf("%-7s 0x%016x%016x", fmt.Sprintf("xmm%d", i),
+			binary.LittleEndian.Uint64(xmm[8:]), binary.LittleEndian.Uint64(xmm)))
+	}
+	return lines, nil
+}
+
+// SetRegister writes the register name of the current thread, the goroutines which are not running
+// keep their registers in runtime.g
+func SetRegister(name string, value uint64) error {
+	r, err := findRegister(name)
+	if err != nil {
+		return err
+	}
+	if cmd.Process == nil {
+		return NoProcessRuning
+	}
+	if curGoroutine != nil {
+		return &NotRunningGoroutineErr{id: curGoroutine.id}
+	}
+	regs, err := getRegisters()
+	if err != nil {
+		return err
+	}
+	*r.field(&regs) = value
+	return ptraceSetRegs(currentThread(), &regs)
+}
+
+func getRegisters() (PtraceRegs, error){
+	var prs PtraceRegs
 	if cmd.Process == nil {
 		return prs, NoProcessRuning
 	}
-	err := syscall.PtraceGetRegs(cmd.Process.Pid, &prs)
+	err := ptraceGetRegs(currentThread(), &prs)
+	if err == nil && curGoroutine != nil {
+		prs.SetPC(curGoroutine.pc)
+		prs.Rsp, prs.Rbp = curGoroutine.sp, curGoroutine.bp
+	}
 	return prs, err
 }
 
 func getPtracePc() (uint64, error) {
 	var (
-		prs syscall.PtraceRegs
+		prs PtraceRegs
 		err error
 	)
 	if prs, err = getRegisters(); err != nil {
@@ -24,19 +142,22 @@ func getPtracePc() (uint64, error) {
 
 func setPcRegister(pc uint64) error {
 	var (
-		prs syscall.PtraceRegs
+		prs PtraceRegs
 		err error
 	)
+	if curGoroutine != nil {
+		return &NotRunningGoroutineErr{id: curGoroutine.id}
+	}
 	if prs, err = getRegisters(); err != nil {
 		return err
 	}
 	prs.SetPC(pc)
-	return syscall.PtraceSetRegs(cmd.Process.Pid, &prs)
+	return ptraceSetRegs(currentThread(), &prs)
 }
 
 func getPtraceBp() (uint64, error){
 	var (
-		prs syscall.PtraceRegs
+		prs PtraceRegs
 		err error
 	)
 	if prs, err = getRegisters(); err != nil {
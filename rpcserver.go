@@ -0,0 +1,282 @@
+package main
+
+import (
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"github.com/chainhelen/godbg/api"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RPCServer serves the json-rpc api of `godbg --headless`. net/rpc calls the methods on its goroutines,
+// so they are sent as jobs to the thread tracing the debuggee, which runs them one by one
+type RPCServer struct {
+	jobs chan func()
+	// detached is closed when the client detaches, the server stops
+	detached chan struct{}
+}
+
+// serveHeadless serves the clients connecting to l until one of them detaches
+func serveHeadless(l net.Listener) error {
+	s := &RPCServer{jobs: make(chan func()), detached: make(chan struct{})}
+	server := rpc.NewServer()
+	if err := server.RegisterName(api.ServiceName, s); err != nil {
+		return err
+	}
+	var conns sync.WaitGroup
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conns.Done()
+				server.ServeCodec(jsonrpc.NewServerCodec(conn))
+			}()
+		}
+	}()
+	for {
+		select {
+		case job := <-s.jobs:
+			job()
+		case <-s.detached:
+			l.Close()
+			// the reply of Detach is sent after it returns, the clients have a while to get it
+			done := make(chan struct{})
+			go func() {
+				conns.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+			}
+			return nil
+		}
+	}
+}
+
+// run runs f on the thread tracing the debuggee and waits for it, the server without jobs is on that thread already
+func (s *RPCServer) run(f func() error) error {
+	if s.jobs == nil {
+		return f()
+	}
+	done := make(chan error, 1)
+	select {
+	case s.jobs <- func() { done <- f() }:
+	case <-s.detached:
+		return errors.New("the session has ended")
+	}
+	return <-done
+}
+
+func (s *RPCServer) GetVersion(in api.GetVersionIn, out *api.GetVersionOut) error {
+	out.APIVersion = api.Version
+	return nil
+}
+
+func apiBreakpoint(info *BInfo) api.Breakpoint {
+	return api.Breakpoint{Id: info.id, File: info.filename, Line: info.lineno, Pc: info.pc, Cond: info.cond, Disabled: info.disabled}
+}
+
+func (s *RPCServer) CreateBreakpoint(in api.CreateBreakpointIn, out *api.CreateBreakpointOut) error {
+	return s.run(func() error {
+		info, err := setLocBreakPoint(in.Loc, false)
+		if err != nil {
+			return err
+		}
+		if in.Cond != "" {
+			if _, err = bp.Condition(info.id, in.Cond); err != nil {
+				bp.Clear(info.id)
+				return err
+			}
+		}
+		out.Breakpoint = apiBreakpoint(info)
+		return nil
+	})
+}
+
+func (s *RPCServer) ListBreakpoints(in api.ListBreakpointsIn, out *api.ListBreakpointsOut) error {
+	return s.run(func() error {
+		out.Breakpoints = make([]api.Breakpoint, 0)
+		for _, info := range bp.List() {
+			out.Breakpoints = append(out.Breakpoints, apiBreakpoint(info))
+		}
+		return nil
+	})
+}
+
+func (s *RPCServer) ClearBreakpoint(in api.ClearBreakpointIn, out *api.ClearBreakpointOut) error {
+	return s.run(func() error {
+		info, err := bp.Clear(in.Id)
+		if err != nil {
+			return err
+		}
+		out.Breakpoint = apiBreakpoint(info)
+		return nil
+	})
+}
+
+// Command resumes the debuggee by continue, next, step or stepout and replies where it stops
+func (s *RPCServer) Command(in api.CommandIn, out *api.CommandOut) error {
+	return s.run(func() error {
+		resume, ok := map[string]func() (*StopEvent, error){
+			api.Continue: bp.Resume,
+			api.Next: bp.Next,
+			api.Step: bp.Step,
+			api.StepOut: bp.StepOut,
+		}[in.Name]
+		if !ok {
+			return fmt.Errorf("unknown command `%s`, expect continue, next, step or stepout", in.Name)
+		}
+		if cmd == nil || cmd.Process == nil {
+			return NoProcessRuning
+		}
+		ev, err := resume()
+		if err != nil {
+			return err
+		}
+		out.State = apiState(ev)
+		return nil
+	})
+}
+
+func apiState(ev *StopEvent) api.State {
+	state := api.State{Reason: ev.reason.String(), Traces: ev.traces}
+	switch ev.reason {
+	case StopExited, StopKilled:
+		state.Exited, state.ExitStatus = true, ev.status
+		return state
+	}
+	state.Pc, state.GoroutineId = ev.pc, currentGoroutineId()
+	state.File, state.Line, _ = bi.pcTofileLine(ev.pc)
+	if f, err := bi.findFunctionIncludePc(ev.pc); err == nil {
+		state.Function = f.name
+	}
+	return state
+}
+
+func (s *RPCServer) ListGoroutines(in api.ListGoroutinesIn, out *api.ListGoroutinesOut) error {
+	return s.run(func() error {
+		gs, err := Goroutines()
+		if err != nil {
+			return err
+		}
+		out.Goroutines = make([]api.Goroutine, 0, len(gs))
+		for _, g := range gs {
+			out.Goroutines = append(out.Goroutines, api.Goroutine{Id: g.id, Status: g.Status(), Location: pcLocation(g.UserLocation()), Thread: g.thread})
+		}
+		return nil
+	})
+}
+
+func (s *RPCServer) Stacktrace(in api.StacktraceIn, out *api.StacktraceOut) error {
+	return s.run(func() error {
+		if cmd == nil || cmd.Process == nil {
+			return NoProcessRuning
+		}
+		if err := switchGoroutine(in.GoroutineId); err != nil {
+			return err
+		}
+		depth := in.Depth
+		if depth <= 0 || depth > maxStackDepth {
+			depth = maxStackDepth
+		}
+		frames, err := stacktrace(depth)
+		if err != nil {
+			return err
+		}
+		out.Frames = make([]api.Stackframe, 0, len(frames))
+		for _, f := range frames {
+			out.Frames = append(out.Frames, api.Stackframe{Function: f.fn.name, File: f.filename, Line: f.lineno, Pc: f.pc})
+		}
+		return nil
+	})
+}
+
+// selectScope selects the frame of the goroutine of the scope
+func selectScope(scope api.Scope) error {
+	if cmd == nil || cmd.Process == nil {
+		return NoProcessRuning
+	}
+	if err := switchGoroutine(scope.GoroutineId); err != nil {
+		return err
+	}
+	_, err := SelectFrame(scope.Frame)
+	return err
+}
+
+func (s *RPCServer) Eval(in api.EvalIn, out *api.EvalOut) error {
+	return s.run(func() error {
+		if err := selectScope(in.Scope); err != nil {
+			return err
+		}
+		value, err := formatExpr(in.Expr)
+		if err != nil {
+			return err
+		}
+		out.Value = value
+		return nil
+	})
+}
+
+func (s *RPCServer) ListLocals(in api.ListLocalsIn, out *api.ListLocalsOut) error {
+	return s.run(func() error {
+		if err := selectScope(in.Scope); err != nil {
+			return err
+		}
+		vars, err := FrameVariables(dwarf.TagVariable, nil)
+		if err != nil {
+			return err
+		}
+		out.Variables = make([]api.Variable, 0, len(vars))
+		for _, v := range vars {
+			out.Variables = append(out.Variables, api.Variable{Name: v.name, Type: v.typeName, Value: v.value, Shadowed: v.shadowed})
+		}
+		return nil
+	})
+}
+
+// Exec runs a command of the prompt and replies what it prints, quit is replaced by Detach
+func (s *RPCServer) Exec(in api.ExecIn, out *api.ExecOut) error {
+	return s.run(func() error {
+		line := strings.TrimSpace(in.Line)
+		if line == "q" || line == "quit" {
+			return errors.New("use Detach to end the session")
+		}
+		savedOut, savedErr := stdout, stderr
+		outw, errw := &strings.Builder{}, &strings.Builder{}
+		stdout, stderr = outw, errw
+		executor(line)
+		stdout, stderr = savedOut, savedErr
+		out.Stdout, out.Stderr = outw.String(), errw.String()
+		return nil
+	})
+}
+
+// Detach kills the debuggee started by godbg, or detaches from the attached one unless Kill is set.
+// The server stops after replying, the Detach queued behind it is rejected
+func (s *RPCServer) Detach(in api.DetachIn, out *api.DetachOut) error {
+	return s.run(func() error {
+		select {
+		case <-s.detached:
+			return errors.New("the session has ended")
+		default:
+		}
+		var err error
+		if attached && in.Kill && cmd != nil && cmd.Process != nil {
+			_, err = detach(true)
+		} else {
+			err = releaseDebuggee()
+		}
+		close(s.detached)
+		return err
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SignalHandling tells what the debugger does when the debuggee receives the signal,
+// stop implies print, and the signal is delivered when the debuggee continues only if pass is true
+type SignalHandling struct {
+	stop bool
+	print bool
+	pass bool
+}
+
+func (h *SignalHandling) String() string {
+	flags := []string{"nostop", "noprint", "nopass"}
+	if h.stop {
+		flags[0] = "stop"
+	}
+	if h.print {
+		flags[1] = "print"
+	}
+	if h.pass {
+		flags[2] = "pass"
+	}
+	return strings.Join(flags, " ")
+}
+
+var signalNames = map[string]syscall.Signal{
+	"SIGHUP": syscall.SIGHUP, "SIGINT": syscall.SIGINT, "SIGQUIT": syscall.SIGQUIT, "SIGILL": syscall.SIGILL,
+	"SIGTRAP": syscall.SIGTRAP, "SIGABRT": syscall.SIGABRT, "SIGBUS": syscall.SIGBUS, "SIGFPE": syscall.SIGFPE,
+	"SIGKILL": syscall.SIGKILL, "SIGUSR1": syscall.SIGUSR1, "SIGSEGV": syscall.SIGSEGV, "SIGUSR2": syscall.SIGUSR2,
+	"SIGPIPE": syscall.SIGPIPE, "SIGALRM": syscall.SIGALRM, "SIGTERM": syscall.SIGTERM, "SIGCHLD": syscall.SIGCHLD,
+	"SIGCONT": syscall.SIGCONT, "SIGSTOP": syscall.SIGSTOP, "SIGTSTP": syscall.SIGTSTP, "SIGTTIN": syscall.SIGTTIN,
+	"SIGTTOU": syscall.SIGTTOU, "SIGURG": syscall.SIGURG, "SIGXCPU": syscall.SIGXCPU, "SIGXFSZ": syscall.SIGXFSZ,
+	"SIGVTALRM": syscall.SIGVTALRM, "SIGPROF": syscall.SIGPROF, "SIGWINCH": syscall.SIGWINCH, "SIGIO": syscall.SIGIO,
+	"SIGSYS": syscall.SIGSYS,
+}
+
+// signalTable keeps the handlings changed by `handle`, the others are defaultSignalHandling
+var signalTable = map[syscall.Signal]*SignalHandling{}
+
+// defaultSignalHandling stops at every signal and delivers it. SIGURG preempts goroutines in the go runtime,
+// it and the signals of the children, timers and window changes are not interesting.
+// SIGINT and SIGTRAP are sent to the debugger rather than the debuggee
+func defaultSignalHandling(sig syscall.Signal) *SignalHandling {
+	switch sig {
+	case syscall.SIGURG, syscall.SIGCHLD, syscall.SIGALRM, syscall.SIGVTALRM, syscall.SIGPROF, syscall.SIGWINCH:
+		return &SignalHandling{stop: false, print: false, pass: true}
+	case syscall.SIGINT, syscall.SIGTRAP:
+		return &SignalHandling{stop: true, print: true, pass: false}
+	}
+	return &SignalHandling{stop: true, print: true, pass: true}
+}
+
+func signalHandling(sig syscall.Signal) *SignalHandling {
+	if h, ok := signalTable[sig]; ok {
+		return h
+	}
+	return defaultSignalHandling(sig)
+}
+
+// parseSignal accepts the name like SIGPIPE or PIPE, and the number
+func parseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		if n <= 0 || n > maxSignal {
+			return 0, fmt.Errorf("unknown signal %d, the signals are numbered from 1 to %d", n, maxSignal)
+		}
+		return syscall.Signal(n), nil
+	}
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if sig, ok := signalNames[name]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unknown signal %s", name)
+}
+
+func signalName(sig syscall.Signal) string {
+	for name, v := range signalNames {
+		if v == sig {
+			return name
+		}
+	}
+	return strconv.Itoa(int(sig))
+}
+
+// HandleSignal changes the handling of sig by the keywords stop, nostop, print, noprint, pass and nopass
+func HandleSignal(sig syscall.Signal, keywords []string) (*SignalHandling, error) {
+	h := *signalHandling(sig)
+	for _, k := range keywords {
+		switch k {
+		case "stop":
+			h.stop = true
+			h.print = true
+		case "nostop":
+			h.stop = false
+		case "print":
+			h.print = true
+		case "noprint":
+			h.print = false
+			h.stop = false
+		case "pass":
+			h.pass = true
+		case "nopass":
+			h.pass = false
+		default:
+			return nil, fmt.Errorf("unknown keyword `%s`, expect stop, nostop, print, noprint, pass or nopass", k)
+		}
+	}
+	if sig == syscall.SIGKILL || sig == syscall.SIGSTOP {
+		return nil, fmt.Errorf("%s can't be handled", signalName(sig))
+	}
+	signalTable[sig] = &h
+	return &h, nil
+}
+
+// HandledSignals returns the signals whose handlings are changed, in order
+func HandledSignals() []syscall.Signal {
+	sigs := make([]syscall.Signal, 0, len(signalTable))
+	for sig := range signalTable {
+		sigs = append(sigs, sig)
+	}
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i] < sigs[j] })
+	return sigs
+}
+
+// keepSignal keeps the signal stopping the current thread for the next resuming if it should be delivered
+func (bp *BP) keepSignal(sig syscall.Signal) {
+	bp.keepThreadSignal(currentThread(), sig)
+}
+
+func (bp *BP) keepThreadSignal(tid int, sig syscall.Signal) {
+	if signalHandling(sig).pass {
+		bp.pendingSignal = sig
+		bp.signalThread = tid
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// maxStackDepth bounds the frames unwound when the stack is broken
+const maxStackDepth = 100
+
+// Stackframe is a function call on the stack, frame 0 is the innermost one
+type Stackframe struct {
+	index int
+	pc uint64
+	// cfa is the rsp before the call instruction, bp is the frame pointer of the function
+	cfa uint64
+	bp uint64
+	fn *Function
+	filename string
+	lineno int
+	// regs are the registers of the function, only pc, rsp and rbp of the callers are restored
+	regs PtraceRegs
+}
+
+// Stacktrace unwinds the stack of the current goroutine or thread by the cfa rules in .debug_frame and .eh_frame.
+// The saved rbp of a function is at cfa-16 if it has set up its frame pointer, otherwise rbp is unchanged.
+// The unwinding stops at runtime.goexit or the frame which can't be found
+func Stacktrace() ([]*Stackframe, error) {
+	return stacktrace(maxStackDepth)
+}
+
+// stacktrace unwinds depth frames at most
+func stacktrace(depth int) ([]*Stackframe, error) {
+	defer observe("unwind", time.Now())
+	regs, err := getRegisters()
+	if err != nil {
+		return nil, err
+	}
+	pc, sp, rbp := regs.PC(), regs.Rsp, regs.Rbp
+	frames := make([]*Stackframe, 0)
+	// the pc of the callers is the return address, the line is of the call instruction before it
+	lookup := pc
+	for len(frames) < depth {
+		fn, err := bi.findFunctionIncludePc(lookup)
+		if err != nil {
+			if len(frames) == 0 {
+				return nil, err
+			}
+			break
+		}
+		filename, lineno, err := bi.pcTofileLine(lookup)
+		if err != nil {
+			return nil, err
+		}
+		frame, err := bi.unwindFrame(pc, sp, rbp)
+		if err != nil {
+			if len(frames) == 0 {
+				return nil, err
+			}
+			break
+		}
+		regs.SetPC(pc)
+		regs.Rsp, regs.Rbp = sp, rbp
+		frames = append(frames, &Stackframe{index: len(frames), pc: pc, cfa: frame.framebase, bp: rbp, fn: fn,
+			filename: filename, lineno: lineno, regs: regs})
+		if fn.name == "runtime.goexit" {
+			break
+		}
+		// morestack has switched to the stack of g0, the goroutine stops at the prologue calling it
+		if fn.name == "runtime.morestack" {
+			if cpc, csp, cbp, err := morestackCaller(); err == nil {
+				pc, sp, rbp, lookup = cpc, csp, cbp, cpc - 1
+				continue
+			}
+		}
+
+		// the kernel interrupts the function at pc for the signal handler, its registers are saved in the signal frame
+		if fn.name == "runtime.sigtramp" {
+			if ipc, isp, ibp, err := signalFrameCaller(frame.framebase); err == nil {
+				pc, sp, rbp, lookup = ipc, isp, ibp, ipc
+				continue
+			}
+		}
+
+		mem := make([]byte, 16)
+		if _, err = ptracePeekData(cmd.Process.Pid, uintptr(frame.framebase - 16), mem); err != nil {
+			break
+		}
+		if rbp == frame.framebase - 16 {
+			rbp = binary.LittleEndian.Uint64(mem)
+		}
+		pc, sp = binary.LittleEndian.Uint64(mem[8:]), frame.framebase
+		if pc == 0 {
+			break
+		}
+		lookup = pc - 1
+		// sigpanic is injected as if the faulting instruction called it, so the return address is that instruction
+		if fn.name == "runtime.sigpanic" {
+			lookup = pc
+		}
+	}
+	return frames, nil
+}
+
+// morestackCaller returns the registers saved in m.curg.sched by runtime.morestack before switching to g0.
+// It fails if the thread is still on the stack of the goroutine
+func morestackCaller() (uint64, uint64, uint64, error) {
+	gType, err := bi.structType("runtime.g")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	mType, err := bi.structType("runtime.m")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	g, err := threadGoroutine(currentThread())
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	mOff, _, err := fieldOffset(gType, "m")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	m, err := readWord(g + uint64(mOff))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	curgOff, _, err := fieldOffset(mType, "curg")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	curg, err := readWord(m + uint64(curgOff))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if curg == 0 || curg == g {
+		return 0, 0, 0, fmt.Errorf("runtime.morestack is on the stack of the goroutine")
+	}
+	mem := make([]byte, gType.Size())
+	if _, err = ptracePeekData(cmd.Process.Pid, uintptr(curg), mem); err != nil {
+		return 0, 0, 0, err
+	}
+	var regs [3]uint64
+	for i, path := range []string{"sched.pc", "sched.sp", "sched.bp"} {
+		if regs[i], err = readField(gType, mem, path); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return regs[0], regs[1], regs[2], nil
+}
+
+// selectedFrame returns the frame selected by up, down and frame
+func selectedFrame() (*Stackframe, error) {
+	frames, err := stacktrace(curFrame + 1)
+	if err != nil {
+		return nil, err
+	}
+	if curFrame >= len(frames) {
+		return nil, fmt.Errorf("can't find frame %d", curFrame)
+	}
+	return frames[curFrame], nil
+}
+
+// SelectFrame selects the frame n of the current goroutine or thread, the variables are looked up in it
+// until the debuggee is resumed. The innermost frame is 0
+func SelectFrame(n int) (*Stackframe, error) {
+	if cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("can't find frame %d, the innermost one is 0", n)
+	}
+	frames, err := stacktrace(n + 1)
+	if err != nil {
+		return nil, err
+	}
+	if n >= len(frames) {
+		return nil, fmt.Errorf("can't find frame %d, the outermost one is %d", n, len(frames) - 1)
+	}
+	curFrame = n
+	return frames[n], nil
+}
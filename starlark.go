@@ -0,0 +1,258 @@
+package main
+
+import (
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"github.com/chainhelen/godbg/api"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// scriptCommands are the commands defined by the scripts, the function `command_name` of a script
+// becomes the command `name`, which gets the rest of the line as its argument
+var scriptCommands = map[string]starlark.Callable{}
+
+func scriptThread() *starlark.Thread {
+	return &starlark.Thread{Name: "godbg", Print: func(_ *starlark.Thread, msg string) { fmt.Fprintln(stdout, msg) }}
+}
+
+// SourceScript runs the starlark script filename with the builtins of the debugger
+func SourceScript(filename string) error {
+	// the scripts are programs rather than configurations, like while loops at the top level
+	resolve.AllowNestedDef, resolve.AllowLambda, resolve.AllowFloat, resolve.AllowSet = true, true, true, true
+	resolve.AllowGlobalReassign, resolve.AllowRecursion = true, true
+	globals, err := starlark.ExecFile(scriptThread(), filename, nil, scriptBuiltins())
+	if err != nil {
+		return err
+	}
+	for name, v := range globals {
+		if fn, ok := v.(starlark.Callable); ok && strings.HasPrefix(name, "command_") {
+			scriptCommands[strings.TrimPrefix(name, "command_")] = fn
+		}
+	}
+	return nil
+}
+
+// runScriptCommand runs the command defined by a script, it is false if there is no such command
+func runScriptCommand(input string) bool {
+	sps := strings.SplitN(input, " ", 2)
+	fn, ok := scriptCommands[sps[0]]
+	if !ok {
+		return false
+	}
+	args := ""
+	if len(sps) == 2 {
+		args = sps[1]
+	}
+	if _, err := starlark.Call(scriptThread(), fn, starlark.Tuple{starlark.String(args)}, nil); err != nil {
+		printErr(err)
+	}
+	return true
+}
+
+// scriptBuiltins are the functions of the debugger in the scripts, the breakpoints, the states, the goroutines,
+// the frames and the variables are dicts with the fields of the api in snake case, like `goroutine_id`
+func scriptBuiltins() starlark.StringDict {
+	builtins := starlark.StringDict{}
+	add := func(name string, fn func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error)) {
+		builtins[name] = starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			v, err := fn(args, kwargs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			return scriptValue(reflect.ValueOf(v)), nil
+		})
+	}
+
+	// breakpoint(loc, cond="") sets a breakpoint at `file.go:line` or a function
+	add("breakpoint", func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error) {
+		var loc, cond string
+		if err := starlark.UnpackArgs("breakpoint", args, kwargs, "loc", &loc, "cond?", &cond); err != nil {
+			return nil, err
+		}
+		info, err := setLocBreakPoint(loc, false)
+		if err != nil {
+			return nil, err
+		}
+		if cond != "" {
+			if _, err = bp.Condition(info.id, cond); err != nil {
+				bp.Clear(info.id)
+				return nil, err
+			}
+		}
+		return apiBreakpoint(info), nil
+	})
+	add("clear", func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error) {
+		var id int
+		if err := starlark.UnpackArgs("clear", args, kwargs, "id", &id); err != nil {
+			return nil, err
+		}
+		info, err := bp.Clear(id)
+		if err != nil {
+			return nil, err
+		}
+		return apiBreakpoint(info), nil
+	})
+	add("breakpoints", func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error) {
+		if err := starlark.UnpackArgs("breakpoints", args, kwargs); err != nil {
+			return nil, err
+		}
+		bps := make([]api.Breakpoint, 0)
+		for _, info := range bp.List() {
+			bps = append(bps, apiBreakpoint(info))
+		}
+		return bps, nil
+	})
+
+	// cont(), next(), step() and stepout() return the state where the debuggee stops
+	for name, resume := range map[string]func(*BP) (*StopEvent, error){
+		"cont": (*BP).Resume, "next": (*BP).Next, "step": (*BP).Step, "stepout": (*BP).StepOut,
+	} {
+		name, resume := name, resume
+		add(name, func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error) {
+			if err := starlark.UnpackArgs(name, args, kwargs); err != nil {
+				return nil, err
+			}
+			if cmd == nil || cmd.Process == nil {
+				return nil, NoProcessRuning
+			}
+			ev, err := resume(bp)
+			if err != nil {
+				return nil, err
+			}
+			return apiState(ev), nil
+		})
+	}
+
+	add("goroutines", func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error) {
+		if err := starlark.UnpackArgs("goroutines", args, kwargs); err != nil {
+			return nil, err
+		}
+		gs, err := Goroutines()
+		if err != nil {
+			return nil, err
+		}
+		goroutines := make([]api.Goroutine, 0, len(gs))
+		for _, g := range gs {
+			goroutines = append(goroutines, api.Goroutine{Id: g.id, Status: g.Status(), Location: pcLocation(g.UserLocation()), Thread: g.thread})
+		}
+		return goroutines, nil
+	})
+	// stacktrace(goroutine=0, depth=0) returns the frames of the goroutine, 0 is the current one
+	add("stacktrace", func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error) {
+		var gid, depth int
+		if err := starlark.UnpackArgs("stacktrace", args, kwargs, "goroutine?", &gid, "depth?", &depth); err != nil {
+			return nil, err
+		}
+		if cmd == nil || cmd.Process == nil {
+			return nil, NoProcessRuning
+		}
+		if err := switchGoroutine(uint64(gid)); err != nil {
+			return nil, err
+		}
+		if depth <= 0 || depth > maxStackDepth {
+			depth = maxStackDepth
+		}
+		frames, err := stacktrace(depth)
+		if err != nil {
+			return nil, err
+		}
+		stackframes := make([]api.Stackframe, 0, len(frames))
+		for _, f := range frames {
+			stackframes = append(stackframes, api.Stackframe{Function: f.fn.name, File: f.filename, Line: f.lineno, Pc: f.pc})
+		}
+		return stackframes, nil
+	})
+
+	// eval(expr) returns the value of expr rendered like print does
+	add("eval", func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error) {
+		var expr string
+		if err := starlark.UnpackArgs("eval", args, kwargs, "expr", &expr); err != nil {
+			return nil, err
+		}
+		return formatExpr(expr)
+	})
+	add("locals", func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error) {
+		if err := starlark.UnpackArgs("locals", args, kwargs); err != nil {
+			return nil, err
+		}
+		if cmd == nil || cmd.Process == nil {
+			return nil, NoProcessRuning
+		}
+		vars, err := FrameVariables(dwarf.TagVariable, nil)
+		if err != nil {
+			return nil, err
+		}
+		variables := make([]api.Variable, 0, len(vars))
+		for _, v := range vars {
+			variables = append(variables, api.Variable{Name: v.name, Type: v.typeName, Value: v.value, Shadowed: v.shadowed})
+		}
+		return variables, nil
+	})
+
+	// command(line) runs a command of the prompt and returns what it prints, what it prints to stderr is an error
+	add("command", func(args starlark.Tuple, kwargs []starlark.Tuple) (interface{}, error) {
+		var line string
+		if err := starlark.UnpackArgs("command", args, kwargs, "line", &line); err != nil {
+			return nil, err
+		}
+		savedOut, savedErr := stdout, stderr
+		outw, errw := &strings.Builder{}, &strings.Builder{}
+		stdout, stderr = outw, errw
+		executor(strings.TrimSpace(line))
+		stdout, stderr = savedOut, savedErr
+		if errw.Len() > 0 {
+			return nil, errors.New(strings.TrimSuffix(errw.String(), "\n"))
+		}
+		return outw.String(), nil
+	})
+	return builtins
+}
+
+// scriptValue converts the values of the builtins to starlark, the structs become dicts
+func scriptValue(v reflect.Value) starlark.Value {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return starlark.None
+	case reflect.Bool:
+		return starlark.Bool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return starlark.MakeInt64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return starlark.MakeUint64(v.Uint())
+	case reflect.String:
+		return starlark.String(v.String())
+	case reflect.Slice:
+		elems := make([]starlark.Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, scriptValue(v.Index(i)))
+		}
+		return starlark.NewList(elems)
+	case reflect.Struct:
+		d := starlark.NewDict(v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			d.SetKey(starlark.String(snakeCase(v.Type().Field(i).Name)), scriptValue(v.Field(i)))
+		}
+		return d
+	}
+	return starlark.String(fmt.Sprint(v.Interface()))
+}
+
+// snakeCase converts a name like GoroutineId to goroutine_id
+func snakeCase(name string) string {
+	var sb strings.Builder
+	for i, c := range name {
+		if unicode.IsUpper(c) {
+			if i > 0 {
+				sb.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,667 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/chainhelen/godbg/log"
+	"go.uber.org/zap"
+	"syscall"
+	"time"
+)
+
+type StopReason int
+
+const (
+	StopBreakPoint StopReason = iota
+	StopWatchPoint
+	StopSignal
+	StopExited
+	StopKilled
+	StopStep
+	// the replay reaches the beginning of the recording
+	StopRecordingBegin
+	// the debuggee executes another program
+	StopExec
+	// the debuggee panics or throws a fatal error
+	StopPanic
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopBreakPoint:
+		return "breakpoint"
+	case StopWatchPoint:
+		return "watchpoint"
+	case StopSignal:
+		return "signal"
+	case StopExited:
+		return "exited"
+	case StopKilled:
+		return "killed"
+	case StopStep:
+		return "step"
+	case StopRecordingBegin:
+		return "recording begin"
+	case StopExec:
+		return "exec"
+	case StopPanic:
+		return "panic"
+	}
+	return fmt.Sprintf("StopReason(%d)", int(r))
+}
+
+// StopEvent describes why the debuggee stops after it is resumed
+type StopEvent struct {
+	reason StopReason
+	// pid is the thread which stops, or the process which exits
+	pid int
+	pc uint64
+	// info is the breakpoint or watchpoint hit, old is the value of the watched variable before
+	info *BInfo
+	old []byte
+	// signal stops the thread or kills the process
+	signal syscall.Signal
+	status int
+	// received are the signals on the way which don't stop the debuggee but are printed
+	received []syscall.Signal
+	// traces are the logs of the tracepoints hit on the way
+	traces []string
+	forks []*ForkNote
+	// exefile is the program executed, the breakpoints which can't be found in it are unresolved
+	exefile string
+	unresolved []*BInfo
+	// panic is the value of the panic, or the message of the fatal error
+	panic string
+}
+
+// exitEvent returns the event if the process has gone, the debugger forgets it
+func exitEvent(wpid int, s syscall.WaitStatus) *StopEvent {
+	var ev *StopEvent
+	if s.Exited() {
+		ev = &StopEvent{reason: StopExited, pid: wpid, status: s.ExitStatus()}
+	} else if s.Signaled() {
+		ev = &StopEvent{reason: StopKilled, pid: wpid, signal: s.Signal()}
+	} else {
+		return nil
+	}
+	logger.Info("exit", append([]zap.Field{log.Event("process.exit")}, ev.logFields()...)...)
+	// the end of the recording, rr goes on replaying backwards
+	if replaying() {
+		return ev
+	}
+	cmd.Process = nil
+	threads = nil
+	curThread = 0
+	curGoroutine = nil
+	curFrame = 0
+	attached = false
+	bp.pendingSignal = 0
+	return ev
+}
+
+// logFields are the fields of the event in the logs
+func (ev *StopEvent) logFields() []zap.Field {
+	fields := []zap.Field{zap.String("reason", ev.reason.String()), log.Pid(ev.pid)}
+	if ev.reason != StopExited && ev.reason != StopKilled {
+		fields = append(fields, log.PC(ev.pc))
+	}
+	if ev.info != nil && ev.info.id != 0 {
+		fields = append(fields, log.BreakpointID(ev.info.id))
+	}
+	if ev.reason == StopExited {
+		fields = append(fields, zap.Int("status", ev.status))
+	}
+	if ev.signal != 0 {
+		fields = append(fields, zap.String("signal", signalName(ev.signal)))
+	}
+	return fields
+}
+
+// logStopEvent logs the stop after resuming, d is how long the debuggee runs
+func logStopEvent(ev *StopEvent, err error, d time.Duration) {
+	if err != nil {
+		logger.Info("stop", log.Event("stop"), zap.Error(err), log.Duration(d))
+		return
+	}
+	if ev != nil {
+		logger.Info("stop", append([]zap.Field{log.Event("stop")}, append(ev.logFields(), log.Duration(d))...)...)
+	}
+}
+
+// singleStep executes one instruction of the current thread, the signals arriving before it is executed are kept
+// for the next resuming. The event is not nil only if the process exits meanwhile
+func (bp *BP) singleStep() (*StopEvent, error) {
+	curFrame = 0
+	for {
+		tid := currentThread()
+		if err := ptraceSingleStep(tid); err != nil {
+			return nil, err
+		}
+		var s syscall.WaitStatus
+		wpid, err := wait4(tid, &s)
+		if err != nil {
+			return nil, err
+		}
+		if wpid != cmd.Process.Pid && (s.Exited() || s.Signaled()) {
+			removeThread(wpid)
+			return nil, fmt.Errorf("thread %d has exited", wpid)
+		}
+		if ev := exitEvent(wpid, s); ev != nil {
+			return ev, nil
+		}
+		if s.StopSignal() == syscall.SIGTRAP {
+			switch ptraceEvent(s) {
+			case ptraceEventClone:
+				// the new thread keeps stopped with the others
+				if err = traceClone(wpid, false); err != nil {
+					return nil, err
+				}
+				continue
+			case ptraceEventFork, ptraceEventVfork:
+				// the syscall is not finished yet
+				if _, err = bp.handleFork(wpid, ptraceEvent(s) == ptraceEventVfork); err != nil {
+					return nil, err
+				}
+				continue
+			case ptraceEventExec:
+				return bp.execEvent(wpid)
+			}
+			return nil, nil
+		}
+		bp.keepSignal(s.StopSignal())
+	}
+}
+
+// Resume continues the debuggee until it stops at a breakpoint whose conditions are true,
+// a watchpoint, a signal, or exits. The pc of a stop at int3 is rewound to the breakpoint,
+// so it always points at the next instruction to execute. The signals are handled by the signal table
+func (bp *BP) Resume() (ev *StopEvent, err error) {
+	received := make([]syscall.Signal, 0)
+	forks := make([]*ForkNote, 0)
+	traces := make([]string, 0)
+	start := time.Now()
+	defer observe("resume", start)
+	defer func() {
+		if ev != nil {
+			ev.received = received
+			ev.traces = traces
+			ev.forks = append(forks, ev.forks...)
+		}
+		logStopEvent(ev, err, time.Since(start))
+	}()
+	// the goroutine selected goes on wherever it is scheduled
+	curGoroutine = nil
+	curFrame = 0
+	// the thread stopped by a signal right at an int3 has not hit it yet, so it is not stepped over then
+	stepOver := true
+	for {
+		if stepOver {
+			if ev, err := bp.stepOverEventThread(); err != nil || ev != nil {
+				return ev, err
+			}
+		}
+		stepOver = true
+		if err := bp.Continue(); err != nil {
+			return nil, err
+		}
+		var s syscall.WaitStatus
+		wpid, err := bp.waitThread(&s)
+		if err != nil {
+			return nil, err
+		}
+		if ev := exitEvent(wpid, s); ev != nil {
+			return ev, nil
+		}
+		if !s.Stopped() {
+			return nil, fmt.Errorf("unknown waitstatus %v", s)
+		}
+		// the other threads have gone with the old program after exec
+		if s.StopSignal() != syscall.SIGTRAP || ptraceEvent(s) != ptraceEventExec {
+			if err = bp.stopThreads(wpid); err != nil {
+				return nil, err
+			}
+		}
+
+		pc, err := getPtracePc()
+		if err != nil {
+			return nil, err
+		}
+		if sig := s.StopSignal(); sig != syscall.SIGTRAP {
+			// the signal is delivered when the debuggee is resumed next time
+			bp.keepSignal(sig)
+			if h := signalHandling(sig); !h.stop {
+				if h.print {
+					received = append(received, sig)
+				}
+				stepOver = false
+				continue
+			}
+			return &StopEvent{reason: StopSignal, pid: wpid, pc: pc, signal: sig}, nil
+		}
+
+		switch ptraceEvent(s) {
+		case ptraceEventFork, ptraceEventVfork:
+			note, err := bp.handleFork(wpid, ptraceEvent(s) == ptraceEventVfork)
+			if err != nil {
+				return nil, err
+			}
+			forks = append(forks, note)
+			continue
+		case ptraceEventExec:
+			return bp.execEvent(wpid)
+		}
+
+		if info, old, err := bp.hitWatchPoint(); err != nil {
+			return nil, err
+		} else if info != nil {
+			return &StopEvent{reason: StopWatchPoint, pid: wpid, pc: pc, info: info, old: old}, nil
+		}
+
+		// the gdb server reports the pc of the breakpoint itself
+		info, ok := bp.findBreakPoint(pc)
+		if replay == nil {
+			info, ok = bp.findBreakPoint(pc - 1)
+		}
+		if !ok {
+			info, ok = bp.findHardwareBreakPoint(pc)
+		} else if replay == nil {
+			pc--
+			if err = setPcRegister(pc); err != nil {
+				return nil, err
+			}
+		}
+		if !ok {
+			// int3 in the program itself, like runtime.Breakpoint
+			bp.keepSignal(syscall.SIGTRAP)
+			return &StopEvent{reason: StopSignal, pid: wpid, pc: pc, signal: syscall.SIGTRAP}, nil
+		}
+		ev := &StopEvent{reason: StopBreakPoint, pid: wpid, pc: pc, info: info}
+		if info.kind == PANICBPTYPE {
+			return panicEvent(ev), nil
+		}
+		if info.kind != USERBPTYPE {
+			return ev, nil
+		}
+		// go on silently while the conditions of the breakpoint are false
+		if stop, err := bp.shouldStop(info); err != nil {
+			return ev, err
+		} else if stop && info.trace {
+			traces = append(traces, traceMessage(info))
+		} else if stop {
+			return ev, nil
+		}
+		// next stops here as if its internal breakpoint were hit, the event has no breakpoint then
+		if bp.stepStops[pc] {
+			ev.info = nil
+			return ev, nil
+		}
+	}
+}
+
+// stepInstruction executes the instruction at pc, even if there is a breakpoint
+func (bp *BP) stepInstruction() (*StopEvent, error) {
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := bp.findHardwareBreakPoint(pc); ok {
+		return bp.singleStepInstructionWithBreakpointCheck_v2()
+	}
+	if _, ok := bp.findBreakPoint(pc); ok {
+		return bp.singleStepInstructionWithBreakpointCheck_v2()
+	}
+	return bp.singleStep()
+}
+
+// StepInstruction executes one instruction, the breakpoint at pc is stepped over
+func (bp *BP) StepInstruction() (*StopEvent, error) {
+	if ev, err := bp.runToGoroutine(); err != nil || ev != nil {
+		return ev, err
+	}
+	if ev, err := bp.stepInstruction(); err != nil || ev != nil {
+		return ev, err
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	return &StopEvent{reason: StopStep, pid: cmd.Process.Pid, pc: pc}, nil
+}
+
+// Step executes the debuggee until it reaches the beginning of a statement on another line,
+// it goes into the functions called and stops after their prologue
+func (bp *BP) Step() (*StopEvent, error) {
+	if ev, err := bp.runToGoroutine(); err != nil || ev != nil {
+		return ev, err
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	startFilename, startLineno, err := bi.pcTofileLine(pc)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if ev, err := bp.stepInstruction(); err != nil || ev != nil {
+			return ev, err
+		}
+		if pc, err = getPtracePc(); err != nil {
+			return nil, err
+		}
+		lineEntry, ok := bi.statement(pc)
+		if !ok || (lineEntry.File.Name == startFilename && lineEntry.Line == startLineno) {
+			continue
+		}
+		if f, err := bi.findFunctionIncludePc(pc); err == nil && f.lowpc == pc {
+			return bp.runToPrologueEnd(f)
+		}
+		return &StopEvent{reason: StopStep, pid: cmd.Process.Pid, pc: pc}, nil
+	}
+}
+
+// runToPrologueEnd runs the function just entered over the prologue, which may call runtime.morestack
+func (bp *BP) runToPrologueEnd(f *Function) (*StopEvent, error) {
+	target := bi.firstPcAfterPrologue(f)
+	if target == f.lowpc {
+		return &StopEvent{reason: StopStep, pid: cmd.Process.Pid, pc: target}, nil
+	}
+	info, err := bp.SetInternalBreakPoint(target)
+	if err != nil && err != HasExistedBreakPointErr {
+		return nil, err
+	}
+	ev, err := bp.Resume()
+	if info != nil {
+		bp.removeInternalBreakPoint(info)
+	}
+	if err != nil || ev.reason != StopBreakPoint || ev.pc != target {
+		return ev, err
+	}
+	ev.reason = StopStep
+	ev.info = nil
+	return ev, nil
+}
+
+// returnAddress reads the return address of the frame, the call instruction pushes it right below the cfa
+func returnAddress(frame *Frame) (uint64, error) {
+	mem := make([]byte, 8)
+	if _, err := ptracePeekData(cmd.Process.Pid, uintptr(frame.framebase - 8), mem); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(mem), nil
+}
+
+// Next executes the debuggee until it reaches another line of the current function or returns to the caller,
+// the functions called on the way run as a whole. There is an internal breakpoint on each statement
+// of the function and the return address, the recursive calls are told apart by the cfa
+func (bp *BP) Next() (*StopEvent, error) {
+	if ev, err := bp.runToGoroutine(); err != nil || ev != nil {
+		return ev, err
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	f, err := bi.findFunctionIncludePc(pc)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := bi.findFrameInformation(pc)
+	if err != nil {
+		return nil, err
+	}
+	filename, lineno, err := bi.pcTofileLine(pc)
+	if err != nil {
+		return nil, err
+	}
+	retaddr, err := returnAddress(frame)
+	if err != nil {
+		return nil, err
+	}
+	goid := currentGoroutineId()
+
+	infos := make([]*BInfo, 0)
+	bp.stepStops = make(map[uint64]bool)
+	defer func() {
+		for _, info := range infos {
+			bp.removeInternalBreakPoint(info)
+		}
+		bp.stepStops = nil
+	}()
+	for _, addr := range append(bi.allPCsBetween(f.lowpc, f.highpc, filename, lineno), retaddr) {
+		info, err := bp.SetInternalBreakPoint(addr)
+		// the user breakpoint whose condition is false doesn't stop, next stops at it anyway
+		if err == HasExistedBreakPointErr {
+			bp.stepStops[addr] = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	for {
+		ev, err := bp.Resume()
+		if err != nil || ev.reason != StopBreakPoint || (ev.info != nil && ev.info.kind == USERBPTYPE) {
+			return ev, err
+		}
+		// the other goroutines run the same function
+		if !sameGoroutine(goid) {
+			continue
+		}
+		cur, err := bi.findFrameInformation(ev.pc)
+		if err != nil {
+			return nil, err
+		}
+		// a deeper recursive call of the function doesn't stop
+		if (ev.pc == retaddr && cur.framebase > frame.framebase) || (ev.pc != retaddr && cur.framebase >= frame.framebase) {
+			ev.reason = StopStep
+			ev.info = nil
+			return ev, nil
+		}
+	}
+}
+
+// StepOut runs the debuggee until the current function returns to the caller
+func (bp *BP) StepOut() (*StopEvent, error) {
+	if ev, err := bp.runToGoroutine(); err != nil || ev != nil {
+		return ev, err
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	frame, err := bi.findFrameInformation(pc)
+	if err != nil {
+		return nil, err
+	}
+	retaddr, err := returnAddress(frame)
+	if err != nil {
+		return nil, err
+	}
+	goid := currentGoroutineId()
+	info, err := bp.SetInternalBreakPoint(retaddr)
+	if err != nil && err != HasExistedBreakPointErr {
+		return nil, err
+	}
+	if info != nil {
+		defer bp.removeInternalBreakPoint(info)
+	}
+
+	for {
+		ev, err := bp.Resume()
+		if err != nil || ev.reason != StopBreakPoint || ev.pc != retaddr {
+			return ev, err
+		}
+		if !sameGoroutine(goid) {
+			continue
+		}
+		cur, err := bi.findFrameInformation(ev.pc)
+		if err != nil {
+			return nil, err
+		}
+		// the recursive calls return to the same address from a deeper frame
+		if cur.framebase > frame.framebase {
+			ev.reason = StopStep
+			ev.info = nil
+			return ev, nil
+		}
+	}
+}
+
+// reverseResume runs the recording backwards by `bc` or `bs` of the gdb server,
+// only `bc` stops at the breakpoints
+func (bp *BP) reverseResume(action string) (*StopEvent, error) {
+	if err := replay.resume(action); err != nil {
+		return nil, err
+	}
+	var s syscall.WaitStatus
+	wpid, err := wait4(cmd.Process.Pid, &s)
+	if err != nil {
+		return nil, err
+	}
+	if ev := exitEvent(wpid, s); ev != nil {
+		return ev, nil
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	if replay.edge == "begin" {
+		return &StopEvent{reason: StopRecordingBegin, pid: wpid, pc: pc}, nil
+	}
+	if sig := s.StopSignal(); sig != syscall.SIGTRAP {
+		return &StopEvent{reason: StopSignal, pid: wpid, pc: pc, signal: sig}, nil
+	}
+	if info, ok := bp.findBreakPoint(pc); ok && action == "bc" {
+		return &StopEvent{reason: StopBreakPoint, pid: wpid, pc: pc, info: info}, nil
+	}
+	return &StopEvent{reason: StopStep, pid: wpid, pc: pc}, nil
+}
+
+// reverseStepInstruction goes back one instruction, the breakpoint at pc doesn't stop it
+func (bp *BP) reverseStepInstruction() (*StopEvent, error) {
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := bp.findBreakPoint(pc); ok {
+		if err = bp.disableBreakPoint(info); err != nil {
+			return nil, err
+		}
+		defer bp.enableBreakPoint(info)
+	}
+	return bp.reverseResume("bs")
+}
+
+// ReverseContinue runs the recording backwards until a breakpoint whose condition is true,
+// or the beginning of the recording. The hits of the breakpoints are not counted backwards
+func (bp *BP) ReverseContinue() (*StopEvent, error) {
+	if !replaying() {
+		return nil, NotReplayingErr
+	}
+	if ev, err := bp.reverseStepInstruction(); err != nil || ev.reason != StopStep {
+		return ev, err
+	}
+	for {
+		ev, err := bp.reverseResume("bc")
+		if err != nil || ev.reason != StopBreakPoint || ev.info.kind != USERBPTYPE || ev.info.cond == "" {
+			return ev, err
+		}
+		if stop, err := evalCondition(ev.info.cond); err != nil {
+			return ev, fmt.Errorf("breakpoint %d condition `%s`: %v", ev.info.id, ev.info.cond, err)
+		} else if stop {
+			return ev, nil
+		}
+	}
+}
+
+// ReverseStep runs the recording backwards until the beginning of a statement on another line,
+// it goes into the functions called by the previous line
+func (bp *BP) ReverseStep() (*StopEvent, error) {
+	if !replaying() {
+		return nil, NotReplayingErr
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	startFilename, startLineno, err := bi.pcTofileLine(pc)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		ev, err := bp.reverseStepInstruction()
+		if err != nil || ev.reason != StopStep {
+			return ev, err
+		}
+		lineEntry, ok := bi.statement(ev.pc)
+		if ok && (lineEntry.File.Name != startFilename || lineEntry.Line != startLineno) {
+			return ev, nil
+		}
+	}
+}
+
+// ReverseNext runs the recording backwards until the previous line of the current function,
+// the functions called run backwards as a whole. Reaching the entry of the function goes back
+// to the call instruction of the caller
+func (bp *BP) ReverseNext() (*StopEvent, error) {
+	if !replaying() {
+		return nil, NotReplayingErr
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, err
+	}
+	f, err := bi.findFunctionIncludePc(pc)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := bi.findFrameInformation(pc)
+	if err != nil {
+		return nil, err
+	}
+	filename, lineno, err := bi.pcTofileLine(pc)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*BInfo, 0)
+	defer func() {
+		for _, info := range infos {
+			bp.removeInternalBreakPoint(info)
+		}
+	}()
+	for _, addr := range append(bi.allPCsBetween(f.lowpc, f.highpc, filename, lineno), f.lowpc) {
+		info, err := bp.SetInternalBreakPoint(addr)
+		if err == HasExistedBreakPointErr {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	for {
+		ev, err := bp.ReverseContinue()
+		if err != nil || ev.reason != StopBreakPoint || ev.info.kind == USERBPTYPE {
+			return ev, err
+		}
+		cur, err := bi.findFrameInformation(ev.pc)
+		if err != nil {
+			return nil, err
+		}
+		// a deeper recursive call of the function doesn't stop
+		if cur.framebase < frame.framebase {
+			continue
+		}
+		if ev.pc == f.lowpc {
+			return bp.reverseStepInstruction()
+		}
+		ev.reason = StopStep
+		ev.info = nil
+		return ev, nil
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Target is a process debugged in the session with its own program, breakpoints, checkpoints and inferiors.
+// The globals are the current target, the others keep their states here until switching to them
+type Target struct {
+	id int
+	bp *BP
+	bi *BI
+	cmd *exec.Cmd
+	execfile string
+	sourcefile string
+	testpackage string
+	execargs []string
+	threads []int
+	curThread int
+	curGoroutine *Goroutine
+	curFrame int
+	attached bool
+	replay *gdbConn
+	checkpoints []*Checkpoint
+	inferiors []int
+}
+
+var (
+	targets []*Target
+	currentTarget *Target
+	lastTargetId int
+)
+
+func (t *Target) Pid() int {
+	if t.cmd == nil || t.cmd.Process == nil {
+		return 0
+	}
+	return t.cmd.Process.Pid
+}
+
+func (t *Target) String() string {
+	program := t.sourcefile
+	if program == "" {
+		program = t.execfile
+	}
+	if program == "" && t.cmd != nil {
+		program = t.cmd.Path
+	}
+	if pid := t.Pid(); pid != 0 {
+		return fmt.Sprintf("target %d pid %d %s", t.id, pid, program)
+	}
+	return fmt.Sprintf("target %d has exited %s", t.id, program)
+}
+
+// saveTarget keeps the globals in the current target, which is the first one if there is no target yet
+func saveTarget() *Target {
+	if currentTarget == nil {
+		lastTargetId++
+		currentTarget = &Target{id: lastTargetId}
+		targets = append(targets, currentTarget)
+	}
+	t := currentTarget
+	t.bp, t.bi, t.cmd = bp, bi, cmd
+	t.execfile, t.sourcefile, t.testpackage, t.execargs = execfile, sourcefile, testpackage, execargs
+	t.threads, t.curThread, t.curGoroutine, t.curFrame = threads, curThread, curGoroutine, curFrame
+	t.attached, t.replay = attached, replay
+	t.checkpoints, t.inferiors = checkpoints, inferiors
+	return t
+}
+
+// loadTarget makes t the current target
+func loadTarget(t *Target) {
+	bp, bi, cmd = t.bp, t.bi, t.cmd
+	execfile, sourcefile, testpackage, execargs = t.execfile, t.sourcefile, t.testpackage, t.execargs
+	threads, curThread, curGoroutine, curFrame = t.threads, t.curThread, t.curGoroutine, t.curFrame
+	attached, replay = t.attached, t.replay
+	checkpoints, inferiors = t.checkpoints, t.inferiors
+	currentTarget = t
+}
+
+// Targets returns all targets, the current one is saved first
+func Targets() []*Target {
+	saveTarget()
+	return targets
+}
+
+// AddTarget builds the source file and runs it with args as a new target, which becomes the current one.
+// The breakpoints of the other targets are not set in it
+func AddTarget(filename string, args []string) (*Target, error) {
+	if core != nil {
+		return nil, CoreReadOnlyErr
+	}
+	if replaying() {
+		return nil, ReplayReadOnlyErr
+	}
+	exe, err := build(filename)
+	if err != nil {
+		return nil, err
+	}
+	newBi, err := analyze(exe)
+	if err != nil {
+		os.Remove(exe)
+		return nil, err
+	}
+	// debugserver serves one process, runexec connects to another one
+	saveTarget()
+	newCmd, err := runexec(exe, args)
+	if err != nil {
+		newBi.Close()
+		loadTarget(currentTarget)
+		os.Remove(exe)
+		return nil, err
+	}
+	t := &Target{bp: &BP{}, bi: newBi, cmd: newCmd, execfile: exe, sourcefile: filename, execargs: args}
+	newTarget(t)
+	return t, bp.SetPanicBreakPoints()
+}
+
+// AttachTarget attaches to the running process pid as a new target, which becomes the current one
+func AttachTarget(pid int) (*Target, error) {
+	if core != nil {
+		return nil, CoreReadOnlyErr
+	}
+	if replaying() {
+		return nil, ReplayReadOnlyErr
+	}
+	for _, t := range Targets() {
+		if t.Pid() == pid {
+			return nil, fmt.Errorf("process %d is target %d already", pid, t.id)
+		}
+	}
+	exefile, err := processExecutable(pid)
+	if err != nil {
+		return nil, err
+	}
+	newBi, err := analyze(exefile)
+	if err != nil {
+		return nil, err
+	}
+	// attach works on the globals of threads
+	saveTarget()
+	threads, curThread, curGoroutine, curFrame = nil, 0, nil, 0
+	newCmd, exefile, err := attach(pid)
+	if err != nil {
+		loadTarget(currentTarget)
+		newBi.Close()
+		return nil, err
+	}
+	t := &Target{bp: &BP{}, bi: newBi, cmd: newCmd, execfile: exefile, threads: threads, attached: true}
+	newTarget(t)
+	return t, bp.SetPanicBreakPoints()
+}
+
+// newTarget adds t as the current target, the globals of the old one are saved before starting t
+func newTarget(t *Target) {
+	lastTargetId++
+	t.id = lastTargetId
+	targets = append(targets, t)
+	loadTarget(t)
+}
+
+// SwitchTarget makes the target id the current one, the current one keeps stopped
+func SwitchTarget(id int) (*Target, error) {
+	for _, t := range Targets() {
+		if t.id == id {
+			loadTarget(t)
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("can't find target %d", id)
+}
+
+// releaseProcess kills the current process with its checkpoints and inferiors, the attached one is detached
+func releaseProcess() error {
+	clearCheckpoints()
+	clearInferiors()
+	// the attached process of debugserver is detached below
+	if replay != nil && !attached {
+		replay.close()
+		replay = nil
+		cmd.Process = nil
+	}
+	if core != nil {
+		closeCore()
+	}
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	if attached {
+		_, err := detach(false)
+		return err
+	}
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	return nil
+}
+
+// releaseDebuggee kills the debuggee, or detaches from it if it is attached, when the client disconnects. The
+// binary is closed then, the next session analyzes its own
+func releaseDebuggee() error {
+	if err := clearTargets(); err != nil {
+		return err
+	}
+	if err := releaseProcess(); err != nil {
+		return err
+	}
+	replaceBi(nil)
+	return nil
+}
+
+// clearTargets releases the processes of the targets which are not current, then removes them
+func clearTargets() error {
+	if currentTarget == nil {
+		return nil
+	}
+	cur := saveTarget()
+	var err error
+	for _, t := range targets {
+		if t == cur {
+			continue
+		}
+		loadTarget(t)
+		if e := releaseProcess(); e != nil && err == nil {
+			err = e
+		}
+		if t.execfile != cur.execfile && !t.attached {
+			os.Remove(t.execfile)
+		}
+		if t.bi != nil && t.bi != cur.bi {
+			t.bi.Close()
+		}
+	}
+	loadTarget(cur)
+	targets = []*Target{cur}
+	return err
+}
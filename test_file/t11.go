@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func add(a, b int) int {
+	return a + b
+}
+
+func main() {
+	x := 10
+	fmt.Println(add(x, 2))
+}
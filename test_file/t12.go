@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+)
+
+func init() {
+	// the signal is sent to the main thread, which is traced
+	runtime.LockOSThread()
+}
+
+func main() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	syscall.Tgkill(os.Getpid(), syscall.Gettid(), syscall.SIGUSR1)
+	s := <-c
+	fmt.Println(s)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+func init() {
+	runtime.LockOSThread()
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		fmt.Println("child")
+		return
+	}
+	pid, _ := syscall.ForkExec(os.Args[0], []string{os.Args[0], "child"}, &syscall.ProcAttr{Files: []uintptr{0, 1, 2}})
+	var s syscall.WaitStatus
+	syscall.Wait4(pid, &s, 0, nil)
+	fmt.Println("parent", s.ExitStatus())
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+func worker(wg *sync.WaitGroup, done chan bool) {
+	runtime.LockOSThread()
+	wg.Done()
+	<-done
+}
+
+func main() {
+	var wg sync.WaitGroup
+	done := make(chan bool)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go worker(&wg, done)
+	}
+	wg.Wait()
+	fmt.Println("workers")
+	close(done)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func worker(in chan int, out chan int) {
+	v := <-in
+	out <- v * 2
+}
+
+func main() {
+	in := make(chan int)
+	out := make(chan int)
+	go worker(in, out)
+	time.Sleep(100 * time.Millisecond)
+	in <- 21
+	fmt.Println(<-out)
+}
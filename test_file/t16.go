@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+func sleeper(wg *sync.WaitGroup) {
+	wg.Done()
+	time.Sleep(time.Hour)
+}
+
+func receiver(wg *sync.WaitGroup, ch chan int) {
+	wg.Done()
+	<-ch
+}
+
+func main() {
+	var wg sync.WaitGroup
+	ch := make(chan int)
+	wg.Add(5)
+	go sleeper(&wg)
+	for i := 0; i < 3; i++ {
+		go receiver(&wg, ch)
+	}
+	pprof.Do(context.Background(), pprof.Labels("worker", "labeled"), func(context.Context) {
+		go receiver(&wg, ch)
+	})
+	wg.Wait()
+	time.Sleep(100 * time.Millisecond)
+	fmt.Println("ready")
+}
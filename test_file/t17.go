@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+type T struct{ v int }
+
+func deref(t *T) int {
+	return t.v
+}
+
+func main() {
+	defer func() {
+		r := recover()
+		fmt.Println("recovered", r)
+	}()
+	fmt.Println(deref(nil))
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+func leaf(s string) string {
+	return s + "!"
+}
+
+func middle(n int) string {
+	name := "middle"
+	count := n * 2
+	return leaf(fmt.Sprint(name, count))
+}
+
+func main() {
+	fmt.Println(middle(21))
+}
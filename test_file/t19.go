@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+func cleanup(name string, n int) {
+	fmt.Println("cleanup", name, n)
+}
+
+func work(n int) {
+	s := "first"
+	defer cleanup(s, n)
+	defer cleanup("second", 2)
+	defer func() {
+		fmt.Println("closure", n)
+	}()
+	fmt.Println("work", n)
+}
+
+func main() {
+	defer fmt.Println("main")
+	work(7)
+}
@@ -0,0 +1,17 @@
+package main
+
+type E struct {
+	code int
+	msg  string
+}
+
+func check(n int) {
+	if n > 1 {
+		panic(&E{code: n, msg: "too big"})
+	}
+}
+
+func main() {
+	check(1)
+	check(2)
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+type point struct{ x, y int32 }
+
+func main() {
+	buf := [8]byte{'g', 'o', 'd', 'b', 'g', '\n'}
+	p := &point{x: 258, y: -1}
+	n := 0x1122334455667788
+	fmt.Println(buf, p, n)
+}
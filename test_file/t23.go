@@ -0,0 +1,19 @@
+package main
+
+import "fmt"
+
+type config struct {
+	name  string
+	port  int
+	ratio float64
+	debug bool
+	limit uint8
+}
+
+func main() {
+	c := config{name: "dev", port: 80, ratio: 0.5}
+	p := &c
+	var other *config
+	total := int32(7)
+	fmt.Println(c, p, other, total)
+}
@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := 1
+	total := 10
+	for i := 0; i < 2; i++ {
+		x := i * 100
+		if i == 1 {
+			msg := "inner"
+			fmt.Println(x, msg, total)
+		}
+	}
+	fmt.Println(x)
+}
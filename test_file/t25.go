@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+var (
+	name    = "dev"
+	port    = 8080
+	ratio   = 0.5
+	verbose bool
+)
+
+func main() {
+	verbose = true
+	fmt.Println(name, port, ratio, verbose)
+}
@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+type node struct {
+	val  int
+	next *node
+	tags []string
+}
+
+var (
+	limit = 3
+	head  *node
+)
+
+func main() {
+	grid := [3]int{7, 8, 9}
+	n := &node{val: 1, next: &node{val: 2}, tags: []string{"a", "bc"}}
+	head = n
+	word := "go"
+	fmt.Println(grid, n, word, limit)
+}
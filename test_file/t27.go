@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+type shape interface{ area() int }
+
+type rect struct{ w, h int }
+
+func (r rect) area() int { return r.w * r.h }
+
+type ring struct {
+	id   int
+	next *ring
+}
+
+func main() {
+	nums := []int{1, 2, 3}
+	ages := map[string]int{"tom": 3, "amy": 5}
+	big := map[int]bool{}
+	for i := 0; i < 20; i++ {
+		big[i] = i%2 == 0
+	}
+	ch := make(chan int, 3)
+	ch <- 4
+	ch <- 5
+	<-ch
+	ch <- 6
+	ch <- 7
+	var any interface{} = rect{2, 3}
+	var s shape = rect{4, 5}
+	var err error = errors.New("boom")
+	r := &ring{id: 1}
+	r.next = r
+	c := complex(1, -2)
+	many := make([]int, 100)
+	var nothing map[int]int
+	empty := map[string]int{}
+	area := rect.area
+	grid := [2][]string{{"a"}, nil}
+	fmt.Println(nums, ages, big, len(ch), any, s, err, r, c, len(many), nothing, empty, area, grid)
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	sum := 0
+	for i := 0; i < 3; i++ {
+		sum += i
+		fmt.Println(sum)
+	}
+}
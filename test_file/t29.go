@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+func add(a, b int) int {
+	return a + b
+}
+
+func main() {
+	total := 0
+	for i := 0; i < 3; i++ {
+		total = add(total, i)
+	}
+	fmt.Println(total)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func main() {
+	full := make(chan int, 1)
+	full <- 5
+	go func() { full <- 9 }()
+	empty := make(chan string)
+	go func() { fmt.Println(<-empty) }()
+	time.Sleep(100 * time.Millisecond)
+	fmt.Println(len(full))
+	<-full
+	<-full
+	empty <- "done"
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+type ID [4]byte
+
+type Flags uint8
+
+type event struct {
+	id ID
+	at time.Time
+}
+
+func main() {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 500, time.UTC)
+	now := time.Now()
+	n, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	id := ID{'a', 'b', 'c', 'd'}
+	f := Flags(29)
+	e := event{id, at}
+	fmt.Println(at, now, n, id, f, e)
+}
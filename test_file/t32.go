@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+func add(a, b int) int {
+	return a + b
+}
+
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return add(fib(n-1), fib(n-2))
+}
+
+func main() {
+	fmt.Println(fib(3))
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+type point struct {
+	x, y int
+}
+
+func crash(p point, names []string) {
+	var counts map[string]int
+	fmt.Println(p, names)
+	counts[names[0]] = p.x + p.y
+}
+
+func main() {
+	crash(point{3, 4}, []string{"a", "b"})
+}
@@ -0,0 +1,9 @@
+package t34
+
+func Sum(nums ...int) int {
+	total := 0
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
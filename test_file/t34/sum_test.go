@@ -0,0 +1,16 @@
+package t34
+
+import "testing"
+
+func TestSum(t *testing.T) {
+	got := Sum(1, 2, 3)
+	if got != 6 {
+		t.Fatalf("Sum(1, 2, 3) = %d", got)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	if got := Sum(); got != 0 {
+		t.Fatalf("Sum() = %d", got)
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+func greet(name string) string {
+	msg := "hello " + name
+	return msg
+}
@@ -0,0 +1,22 @@
+package main
+
+/*
+static int calls;
+
+int add(int a, int b) {
+	static int last;
+	calls++;
+	last = a + b;
+	return last;
+}
+
+__thread long depth[4];
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	sum := C.add(1, 2)
+	fmt.Println(sum)
+}
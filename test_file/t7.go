@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	godbgvarg := os.Args[1]
+	fmt.Println(godbgvarg)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func tick(i int) {
+	fmt.Println(i)
+}
+
+func main() {
+	for i := 0; ; i++ {
+		tick(i)
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	godbgvcount := 0
+	for i := 0; i < 3; i++ {
+		godbgvcount += i + 1
+	}
+	fmt.Println(godbgvcount)
+}
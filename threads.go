@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// earlyStops keeps the stops of the processes reaped by waiting any thread before their parents report
+// PTRACE_EVENT_FORK, and the stops of the processes which are not the debuggee
+var earlyStops = map[int]syscall.WaitStatus{}
+
+// currentThread returns the thread whose registers are read and written, the main thread by default
+func currentThread() int {
+	if curThread != 0 {
+		return curThread
+	}
+	return cmd.Process.Pid
+}
+
+func isThread(tid int) bool {
+	for _, v := range targetThreads() {
+		if v == tid {
+			return true
+		}
+	}
+	return false
+}
+
+func addThread(tid int) {
+	if len(threads) == 0 {
+		threads = []int{cmd.Process.Pid}
+	}
+	if !isThread(tid) {
+		threads = append(threads, tid)
+	}
+}
+
+func removeThread(tid int) {
+	for i, v := range threads {
+		if v == tid {
+			threads = append(threads[:i:i], threads[i+1:]...)
+			break
+		}
+	}
+	if curThread == tid {
+		curThread = 0
+		curGoroutine = nil
+		curFrame = 0
+	}
+}
+
+// waitNew waits the first stop of the new thread or process pid, which may have been reaped already
+func waitNew(pid int) error {
+	if _, ok := earlyStops[pid]; ok {
+		delete(earlyStops, pid)
+		return nil
+	}
+	var s syscall.WaitStatus
+	_, err := syscall.Wait4(pid, &s, waitOptions, nil)
+	return err
+}
+
+// traceClone adds the thread created by tid, which stops at PTRACE_EVENT_CLONE. The new thread
+// begins with SIGSTOP, it goes on if run is true, otherwise it keeps stopped with the others
+func traceClone(tid int, run bool) error {
+	msg, err := ptraceGetEventMsg(tid)
+	if err != nil {
+		return err
+	}
+	child := int(msg)
+	if isThread(child) {
+		// its SIGSTOP is reported before the event, it is running already
+		return nil
+	}
+	if err = waitNew(child); err != nil {
+		return err
+	}
+	addThread(child)
+	if run {
+		return ptraceCont(child, 0)
+	}
+	return nil
+}
+
+// waitThread waits until any thread of the debuggee stops or the process exits. The new threads are traced
+// and the exited ones are forgotten silently, so wpid is the process itself if it is an exit
+func (bp *BP) waitThread(s *syscall.WaitStatus) (int, error) {
+	if replay != nil || stopsProcess {
+		return wait4(cmd.Process.Pid, s)
+	}
+	for {
+		wpid, err := wait4(-1, s)
+		if err != nil {
+			return 0, err
+		}
+		if !isThread(wpid) {
+			// the new thread stops before its creator reports PTRACE_EVENT_CLONE
+			if s.Stopped() && processOfThread(wpid) == cmd.Process.Pid {
+				addThread(wpid)
+				if err = ptraceCont(wpid, 0); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			earlyStops[wpid] = *s
+			continue
+		}
+		if wpid != cmd.Process.Pid && (s.Exited() || s.Signaled()) {
+			removeThread(wpid)
+			continue
+		}
+		if s.Stopped() && s.StopSignal() == syscall.SIGTRAP && ptraceEvent(*s) == ptraceEventClone {
+			if err = traceClone(wpid, true); err != nil {
+				return 0, err
+			}
+			if err = ptraceCont(wpid, 0); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		return wpid, nil
+	}
+}
+
+// stopThreads stops the other threads after the thread wpid stops, so the debuggee keeps still while
+// it is inspected, and wpid becomes the current thread. The threads hitting the breakpoints meanwhile
+// are rewound, they hit them again after resuming. The other signals are delivered before stopping
+func (bp *BP) stopThreads(wpid int) error {
+	bp.eventThread = wpid
+	curThread = wpid
+	curGoroutine = nil
+	curFrame = 0
+	if wpid == cmd.Process.Pid {
+		curThread = 0
+	}
+	if replay != nil {
+		return nil
+	}
+	// the threads stop with the process, the ones created or exited since the last stop are listed again
+	if stopsProcess {
+		tids, err := processThreads(cmd.Process.Pid)
+		if err != nil {
+			return err
+		}
+		threads = tids
+		return nil
+	}
+	for _, tid := range targetThreads() {
+		if tid == wpid {
+			continue
+		}
+		if err := stopThread(cmd.Process.Pid, tid); err != nil {
+			if err == syscall.ESRCH {
+				removeThread(tid)
+				continue
+			}
+			return err
+		}
+		for {
+			var s syscall.WaitStatus
+			if _, err := syscall.Wait4(tid, &s, waitOptions, nil); err != nil {
+				if err == syscall.ECHILD {
+					removeThread(tid)
+					break
+				}
+				return err
+			}
+			if s.Exited() || s.Signaled() {
+				removeThread(tid)
+				break
+			}
+			sig := s.StopSignal()
+			if sig == syscall.SIGSTOP {
+				break
+			}
+			if sig == syscall.SIGTRAP {
+				sig = 0
+				switch ptraceEvent(s) {
+				case ptraceEventClone:
+					if err := traceClone(tid, false); err != nil {
+						return err
+					}
+				case ptraceEventFork, ptraceEventVfork:
+					if _, err := bp.handleFork(tid, ptraceEvent(s) == ptraceEventVfork); err != nil {
+						return err
+					}
+				case 0:
+					if err := bp.rewindThread(tid); err != nil {
+						return err
+					}
+				}
+			} else if !signalHandling(sig).pass {
+				sig = 0
+			}
+			if err := ptraceCont(tid, int(sig)); err != nil && err != syscall.ESRCH {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stepOverEventThread executes the original instruction of the breakpoint where the last stop is reported
+func (bp *BP) stepOverEventThread() (*StopEvent, error) {
+	if bp.eventThread == 0 || bp.eventThread == currentThread() || !isThread(bp.eventThread) {
+		return bp.singleStepInstructionWithBreakpointCheck_v2()
+	}
+	cur := curThread
+	curThread = bp.eventThread
+	defer func() {
+		if cmd.Process != nil && (cur == 0 || isThread(cur)) {
+			curThread = cur
+		}
+	}()
+	return bp.singleStepInstructionWithBreakpointCheck_v2()
+}
+
+// rewindThread moves the pc of tid back to the int3 breakpoint which it has just hit
+func (bp *BP) rewindThread(tid int) error {
+	var regs PtraceRegs
+	if err := ptraceGetRegs(tid, &regs); err != nil {
+		return err
+	}
+	if _, ok := bp.findBreakPoint(regs.PC() - 1); !ok {
+		return nil
+	}
+	regs.SetPC(regs.PC() - 1)
+	return ptraceSetRegs(tid, &regs)
+}
+
+// killProcess kills the debuggee and reaps its threads, the process itself is reported after the others
+func killProcess() {
+	pid := cmd.Process.Pid
+	syscall.Kill(pid, syscall.SIGKILL)
+	var s syscall.WaitStatus
+	for _, tid := range targetThreads() {
+		if tid != pid {
+			syscall.Wait4(tid, &s, waitOptions, nil)
+		}
+	}
+	syscall.Wait4(pid, &s, waitOptions, nil)
+}
+
+// SwitchThread makes tid the current thread, whose registers are used by the inspecting commands
+func SwitchThread(tid int) error {
+	if cmd.Process == nil {
+		return NoProcessRuning
+	}
+	if !isThread(tid) {
+		return fmt.Errorf("thread %d is not traced", tid)
+	}
+	curThread = tid
+	curGoroutine = nil
+	curFrame = 0
+	if tid == cmd.Process.Pid {
+		curThread = 0
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// traceMessage logs the hit of the tracepoint like `trace 1 main.add(a int = 1) goroutine 1 at t.go:5`,
+// the arguments are shown if traceArgs is set
+func traceMessage(info *BInfo) string {
+	name := "?"
+	if f, err := bi.findFunctionIncludePc(info.pc); err == nil {
+		name = f.name
+	}
+	if info.traceArgs {
+		args, err := frameVariables(dwarf.TagFormalParameter, nil)
+		if err != nil {
+			args = []string{fmt.Sprintf("<%v>", err)}
+		}
+		name = fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("trace %d %s goroutine %d at %s:%d", info.id, name, currentGoroutineId(), tryCuttingFilename(info.filename), info.lineno)
+}
+
+// traceFrame is a call of a traced function, the goroutine returns from it with the cfa as the sp
+type traceFrame struct {
+	goid uint64
+	cfa uint64
+}
+
+// traceCall is the call of the tracepoint info which has not returned yet
+type traceCall struct {
+	info *BInfo
+	name string
+	start time.Time
+}
+
+// traceMain runs `godbg trace [--exit] [--pid N | main.go] regexp [args...]`, the program is built and run with args,
+// or the process N is attached
+func traceMain(args []string) error {
+	var (
+		exits bool
+		pid int
+		program, pattern string
+		err error
+	)
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		switch {
+		case args[0] == "--exit":
+			exits = true
+		case args[0] == "--pid" && len(args) > 1:
+			if pid, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("invalid pid %s", args[1])
+			}
+			args = args[1:]
+		default:
+			return fmt.Errorf("unknown flag %s", args[0])
+		}
+		args = args[1:]
+	}
+	if pid == 0 && len(args) > 0 {
+		program, args = args[0], args[1:]
+	}
+	if len(args) == 0 || (pid == 0 && path.Ext(program) != ".go") {
+		return errors.New("usage: godbg trace [--exit] [--pid N | main.go] regexp [args...]")
+	}
+	pattern, args = args[0], args[1:]
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	if pid != 0 {
+		var exefile string
+		if cmd, exefile, err = attach(pid); err != nil {
+			return err
+		}
+		attached = true
+		if bi, err = analyze(exefile); err != nil {
+			releaseDebuggee()
+			return err
+		}
+		return Trace(re, exits)
+	}
+	if sourcefile, err = filepath.Abs(program); err != nil {
+		return err
+	}
+	if execfile, err = build(sourcefile); err != nil {
+		return err
+	}
+	defer os.Remove(execfile)
+	if bi, err = analyze(execfile); err != nil {
+		return err
+	}
+	execargs = args
+	if cmd, err = runexec(execfile, execargs); err != nil {
+		return err
+	}
+	return Trace(re, exits)
+}
+
+// Trace sets the tracepoints on the functions matching re and logs their calls until the debuggee exits,
+// the returns are logged with the durations of the calls if exits is true. Interrupting the debugger
+// by SIGINT detaches from the attached debuggee or kills the one started
+func Trace(re *regexp.Regexp, exits bool) error {
+	entries := make(map[*BInfo]bool)
+	for _, name := range bi.functionNames() {
+		if !re.MatchString(name) {
+			continue
+		}
+		// the functions of the assembly have no line after the prologue
+		info, err := bp.SetFunctionBreakPoint(name, false)
+		if err != nil {
+			continue
+		}
+		info.traceArgs = true
+		entries[info] = true
+	}
+	if len(entries) == 0 {
+		releaseDebuggee()
+		return fmt.Errorf("no function matches %s", re)
+	}
+	fmt.Fprintf(stdout, "trace %d functions matching %s\n", len(entries), re)
+
+	var interrupted int32
+	pid := cmd.Process.Pid
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+	go func() {
+		for range sigs {
+			atomic.StoreInt32(&interrupted, 1)
+			// the debuggee stops by SIGINT, which is not delivered to it
+			syscall.Kill(pid, syscall.SIGINT)
+		}
+	}()
+
+	calls := make(map[traceFrame]*traceCall)
+	// returns are the internal breakpoints at the return addresses with the calls returning to them
+	returns := make(map[uint64]int)
+	for {
+		ev, err := bp.Resume()
+		if err != nil {
+			releaseDebuggee()
+			return err
+		}
+		if atomic.LoadInt32(&interrupted) != 0 {
+			fmt.Fprintf(stdout, "%s\n", "trace is interrupted")
+			return releaseDebuggee()
+		}
+		switch ev.reason {
+		case StopExited, StopKilled:
+			printExitEvent(ev)
+			return nil
+		case StopSignal:
+			fmt.Fprintf(stdout, "thread %d received signal %s\n", ev.pid, ev.signal)
+			continue
+		case StopBreakPoint:
+		default:
+			continue
+		}
+		if entries[ev.info] {
+			fmt.Fprintf(stdout, "%s\n", traceMessage(ev.info))
+			if exits {
+				if err = traceReturn(ev.info, calls, returns); err != nil {
+					fmt.Fprintf(stdout, "trace %d can't find the return: %v\n", ev.info.id, err)
+				}
+			}
+			continue
+		}
+		if _, ok := returns[ev.pc]; !ok {
+			continue
+		}
+		regs, err := getRegisters()
+		if err != nil {
+			releaseDebuggee()
+			return err
+		}
+		frame := traceFrame{currentGoroutineId(), regs.Rsp}
+		call, ok := calls[frame]
+		if !ok {
+			continue
+		}
+		delete(calls, frame)
+		fmt.Fprintf(stdout, "trace %d %s returns goroutine %d after %s\n", call.info.id, call.name, frame.goid, time.Since(call.start))
+		if returns[ev.pc]--; returns[ev.pc] == 0 {
+			delete(returns, ev.pc)
+			bp.removeInternalBreakPoint(ev.info)
+		}
+	}
+}
+
+// traceReturn sets the internal breakpoint at the return address of the call stopping at info
+func traceReturn(info *BInfo, calls map[traceFrame]*traceCall, returns map[uint64]int) error {
+	frame, err := bi.findFrameInformation(info.pc)
+	if err != nil {
+		return err
+	}
+	retaddr, err := returnAddress(frame)
+	if err != nil {
+		return err
+	}
+	if returns[retaddr] == 0 {
+		if _, err = bp.SetInternalBreakPoint(retaddr); err != nil {
+			return err
+		}
+	}
+	returns[retaddr]++
+	name := "?"
+	if f, err := bi.findFunctionIncludePc(info.pc); err == nil {
+		name = f.name
+	}
+	calls[traceFrame{currentGoroutineId(), frame.framebase}] = &traceCall{info: info, name: name, start: time.Now()}
+	return nil
+}
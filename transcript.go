@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// transcript records the commands and their output to a file by `transcript on <file>`, the session can be
+// reviewed later. It is nil when there is no transcript
+var transcript *transcriptFile
+
+// ansiColor matches the colors, which are not written to the transcript
+var ansiColor = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+type transcriptFile struct {
+	filename string
+	f        *os.File
+	// stdout and stderr are the ones before the transcript, they are restored by `transcript off`
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// transcriptWriter writes to w and the transcript both
+type transcriptWriter struct {
+	w io.Writer
+	f *os.File
+}
+
+func (t *transcriptWriter) Write(p []byte) (int, error) {
+	if _, err := t.f.Write(ansiColor.ReplaceAll(p, nil)); err != nil {
+		return 0, err
+	}
+	return t.w.Write(p)
+}
+
+// StartTranscript appends the commands and the output to filename
+func StartTranscript(filename string) error {
+	if transcript != nil {
+		return fmt.Errorf("the transcript is recorded to %s already", transcript.filename)
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	transcript = &transcriptFile{filename: filename, f: f, stdout: stdout, stderr: stderr}
+	stdout, stderr = &transcriptWriter{stdout, f}, &transcriptWriter{stderr, f}
+	return nil
+}
+
+// StopTranscript closes the transcript
+func StopTranscript() error {
+	if transcript == nil {
+		return errors.New("there is no transcript")
+	}
+	stdout, stderr = transcript.stdout, transcript.stderr
+	err := transcript.f.Close()
+	transcript = nil
+	return err
+}
+
+// recordCommand writes the command input to the transcript like it is on the prompt
+func recordCommand(input string) {
+	if transcript != nil {
+		fmt.Fprintf(transcript.f, "(godbg) %s\n", input)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// tui is set by --tui, the panes of the source, the disassembly, the goroutines and the stack are drawn
+// above the prompt whenever the debuggee stops or another frame is selected
+var tui bool
+
+// the escapes of the panes, the titles are reversed, the current line is bold yellow and the breakpoints are red
+const (
+	tuiClear   = "\x1b[H\x1b[2J"
+	tuiReset   = "\x1b[0m"
+	tuiTitle   = "\x1b[7m"
+	tuiCurrent = "\x1b[1;33m"
+	tuiBreak   = "\x1b[31m"
+)
+
+// tuiLine is a line of a pane, the style is applied to the whole line after it is cut to the width
+type tuiLine struct {
+	text  string
+	style string
+}
+
+type tuiPane struct {
+	title string
+	lines []tuiLine
+}
+
+// tuiView is what the panes show, the screen is drawn again once it changes
+type tuiView struct {
+	stops       int
+	pid         int
+	thread      int
+	goroutine   uint64
+	frame       int
+	breakpoints int
+}
+
+var lastTuiView tuiView
+
+func currentTuiView() tuiView {
+	v := tuiView{stops: stops, frame: curFrame, breakpoints: len(bp.infos)}
+	if cmd != nil && cmd.Process != nil {
+		v.pid, v.thread, v.goroutine = cmd.Process.Pid, currentThread(), currentGoroutineId()
+	}
+	return v
+}
+
+// tuiExecutor runs the command, the screen is drawn again with its output below the panes if the view changes,
+// what it prints to stderr follows what it prints to stdout then
+func tuiExecutor(input string) {
+	out, errOut := &strings.Builder{}, &strings.Builder{}
+	savedOut, savedErr := stdout, stderr
+	stdout, stderr = out, errOut
+	executor(input)
+	stdout, stderr = savedOut, savedErr
+	if v := currentTuiView(); v != lastTuiView {
+		drawTui(out.String() + errOut.String())
+		return
+	}
+	fmt.Fprint(stdout, out.String())
+	fmt.Fprint(stderr, errOut.String())
+}
+
+// drawTui clears the screen and draws the source and the disassembly on the top, the goroutines and the stack
+// in the middle, then the tail of output which fits the rest above the prompt
+func drawTui(output string) {
+	lastTuiView = currentTuiView()
+	rows, cols := terminalSize()
+	top := (rows - 2) / 2
+	middle := (rows - 2) / 4
+	frames := tuiFrames()
+
+	var sb strings.Builder
+	sb.WriteString(tuiClear)
+	sb.WriteString(joinTuiPanes(tuiSourcePane(frames, top-1), tuiDisassemblePane(frames, top-1), top, cols))
+	sb.WriteString(joinTuiPanes(tuiGoroutinesPane(middle-1), tuiStackPane(frames, middle-1), middle, cols))
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if rest := rows - top - middle - 1; len(lines) > rest && rest > 0 {
+		lines = lines[len(lines)-rest:]
+	}
+	if output != "" {
+		sb.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+	fmt.Fprint(stdout, sb.String())
+}
+
+// joinTuiPanes draws left and right side by side in height lines of the width cols, the titles are the first line
+func joinTuiPanes(left tuiPane, right tuiPane, height int, cols int) string {
+	width := (cols - 3) / 2
+	cell := func(p tuiPane, i int, w int) string {
+		if i == 0 {
+			return tuiTitle + fitTui(" "+p.title, w) + tuiReset
+		}
+		if i-1 >= len(p.lines) {
+			return strings.Repeat(" ", w)
+		}
+		l := p.lines[i-1]
+		if l.style == "" {
+			return fitTui(l.text, w)
+		}
+		return l.style + fitTui(l.text, w) + tuiReset
+	}
+	var sb strings.Builder
+	for i := 0; i < height; i++ {
+		sb.WriteString(cell(left, i, width) + " | " + strings.TrimRight(cell(right, i, cols-3-width), " ") + "\n")
+	}
+	return sb.String()
+}
+
+// fitTui cuts or pads s to w columns, the tabs are 4 spaces
+func fitTui(s string, w int) string {
+	r := []rune(strings.Replace(s, "\t", "    ", -1))
+	if len(r) > w {
+		return string(r[:w])
+	}
+	return string(r) + strings.Repeat(" ", w-len(r))
+}
+
+// tuiFrames are the frames of the goroutine selected, nil without any process
+func tuiFrames() []*Stackframe {
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	frames, _ := Stacktrace()
+	return frames
+}
+
+// tuiSelected returns the frame selected by up, down and frame
+func tuiSelected(frames []*Stackframe) *Stackframe {
+	if curFrame < len(frames) {
+		return frames[curFrame]
+	}
+	return nil
+}
+
+// tuiSourcePane shows the lines around the line of the frame selected, the lines with the breakpoints are marked by `*`
+func tuiSourcePane(frames []*Stackframe, height int) tuiPane {
+	f := tuiSelected(frames)
+	if f == nil {
+		return tuiPane{title: "source", lines: []tuiLine{{text: NoProcessRuning.Error()}}}
+	}
+	pane := tuiPane{title: fmt.Sprintf("%s:%d", tryCuttingFilename(f.filename), f.lineno)}
+	data, err := ioutil.ReadFile(substitutePath(f.filename))
+	if err != nil {
+		pane.lines = append(pane.lines, tuiLine{text: err.Error()})
+		return pane
+	}
+	breaks := breakpointLines(f.filename)
+	src := strings.Split(string(data), "\n")
+	first := f.lineno - height/2
+	if first < 1 {
+		first = 1
+	}
+	for n := first; n < first+height && n <= len(src); n++ {
+		l := tuiLine{text: fmt.Sprintf("   %4d  %s", n, src[n-1])}
+		if breaks[n] {
+			l.text, l.style = " * "+l.text[3:], tuiBreak
+		}
+		if n == f.lineno {
+			l.text, l.style = "=>"+l.text[2:], tuiCurrent
+		}
+		pane.lines = append(pane.lines, l)
+	}
+	return pane
+}
+
+// tuiDisassemblePane shows the instructions of the function around the pc of the frame selected
+func tuiDisassemblePane(frames []*Stackframe, height int) tuiPane {
+	f := tuiSelected(frames)
+	if f == nil {
+		return tuiPane{title: "disassembly"}
+	}
+	pane := tuiPane{title: "disassembly " + f.fn.name}
+	breaks, mems, pcs, insts, err := disassemble(f.fn.lowpc, f.fn.highpc)
+	if err != nil {
+		pane.lines = append(pane.lines, tuiLine{text: err.Error()})
+		return pane
+	}
+	cur := 0
+	for i, pc := range pcs {
+		if pc <= f.pc {
+			cur = i
+		}
+	}
+	first := cur - height/2
+	if first < 0 {
+		first = 0
+	}
+	for i := first; i < first+height && i < len(insts); i++ {
+		l := tuiLine{text: fmt.Sprintf("   %#x  %-20x %s", pcs[i], mems[i], instSyntax(insts[i], pcs[i]))}
+		if breaks[pcs[i]] {
+			l.text, l.style = " * "+l.text[3:], tuiBreak
+		}
+		if i == cur {
+			l.text, l.style = "=>"+l.text[2:], tuiCurrent
+		}
+		pane.lines = append(pane.lines, l)
+	}
+	return pane
+}
+
+// tuiGoroutinesPane shows the goroutines at their user locations, the current one is marked by `*`
+func tuiGoroutinesPane(height int) tuiPane {
+	pane := tuiPane{title: "goroutines"}
+	if cmd == nil || cmd.Process == nil {
+		return pane
+	}
+	gs, err := Goroutines()
+	if err != nil {
+		pane.lines = append(pane.lines, tuiLine{text: err.Error()})
+		return pane
+	}
+	pane.title = fmt.Sprintf("goroutines (%d)", len(gs))
+	cur := currentGoroutineId()
+	for _, g := range gs {
+		if len(pane.lines) == height {
+			break
+		}
+		l := tuiLine{text: fmt.Sprintf("  %d %s %s", g.id, g.Status(), tryCuttingFilename(pcLocation(g.UserLocation())))}
+		if g.id == cur {
+			l.text, l.style = "*"+l.text[1:], tuiCurrent
+		}
+		pane.lines = append(pane.lines, l)
+	}
+	return pane
+}
+
+// tuiStackPane shows the frames of the goroutine selected, the one selected is marked by `=>`
+func tuiStackPane(frames []*Stackframe, height int) tuiPane {
+	pane := tuiPane{title: "stack"}
+	for _, f := range frames {
+		if len(pane.lines) == height {
+			break
+		}
+		l := tuiLine{text: fmt.Sprintf("   #%-2d %s %s:%d", f.index, f.fn.name, path.Base(f.filename), f.lineno)}
+		if f.index == curFrame {
+			l.text, l.style = "=>"+l.text[2:], tuiCurrent
+		}
+		pane.lines = append(pane.lines, l)
+	}
+	return pane
+}
+
+// terminalSize returns the rows and the columns of the terminal of stdout, 40x160 if it is not a terminal
+func terminalSize() (int, int) {
+	rows, cols, ok := windowSize(os.Stdout)
+	if !ok || rows == 0 {
+		return 40, 160
+	}
+	return rows, cols
+}
+
+// windowSize returns the rows and the columns of the terminal f, it is not ok if f is not a terminal
+func windowSize(f *os.File) (int, int, bool) {
+	var ws struct {
+		rows, cols, x, y uint16
+	}
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); e != 0 {
+		return 0, 0, false
+	}
+	return int(ws.rows), int(ws.cols), true
+}
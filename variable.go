@@ -0,0 +1,476 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"golang.org/x/arch/x86/x86asm"
+	"regexp"
+	"strconv"
+)
+
+// findVariable returns the dwarf entry of the variable `name` visible in the frame selected,
+// and the address where it lives. The one in the innermost block wins if the name is shadowed
+func findVariable(name string) (*dwarf.Entry, uint64, error) {
+	if err := bi.requireDwarf("the variables"); err != nil {
+		return nil, 0, err
+	}
+	frame, err := selectedFrame()
+	if err != nil {
+		return nil, 0, err
+	}
+	vars, shadowed := visibleVariables(frame)
+	for _, fv := range vars {
+		if fvname, _ := fv.Val(dwarf.AttrName).(string); fvname != name || shadowed[fv] {
+			continue
+		}
+		addr, err := variableAddress(fv, frame)
+		return fv, addr, err
+	}
+	return nil, 0, &NotFoundVariableErr{name: name}
+}
+
+// visibleVariables returns the variables and arguments of frame in the scope of its pc, the variables
+// declared after the line are not set yet. The ones shadowed by the same names in inner blocks are marked
+func visibleVariables(frame *Stackframe) ([]*dwarf.Entry, map[*dwarf.Entry]bool) {
+	pc := frame.pc
+	// the callers are at the call instructions before the return addresses
+	if frame.index > 0 {
+		pc--
+	}
+	vars := make([]*dwarf.Entry, 0)
+	depths := make(map[*dwarf.Entry]int)
+	for _, fv := range frame.fn.variables {
+		depth := 0
+		if scope, ok := frame.fn.scopes[fv.Offset]; ok {
+			in := false
+			for _, r := range scope.ranges {
+				if r[0] <= pc && pc < r[1] {
+					in = true
+					break
+				}
+			}
+			if !in {
+				continue
+			}
+			depth = scope.depth
+		}
+		if line, ok := fv.Val(dwarf.AttrDeclLine).(int64); ok && fv.Tag == dwarf.TagVariable && int(line) > frame.lineno {
+			continue
+		}
+		vars = append(vars, fv)
+		depths[fv] = depth
+	}
+	shadowed := make(map[*dwarf.Entry]bool)
+	for _, fv := range vars {
+		name, _ := fv.Val(dwarf.AttrName).(string)
+		for _, other := range vars {
+			if oname, _ := other.Val(dwarf.AttrName).(string); oname == name && depths[other] > depths[fv] {
+				shadowed[fv] = true
+			}
+		}
+	}
+	return vars, shadowed
+}
+
+// variableAddress evaluates the location of the variable in frame, the frame base of go functions is the cfa.
+// The variables in the registers have no address
+func variableAddress(fv *dwarf.Entry, frame *Stackframe) (uint64, error) {
+	pieces, err := variablePieces(fv, frame, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(pieces) == 1 && !pieces[0].inReg {
+		return pieces[0].addr, nil
+	}
+	return 0, &UnsupportVariableErr{entry: fv}
+}
+
+func (bi *BI) variableType(entry *dwarf.Entry) (dwarf.Type, error) {
+	off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+	if !ok {
+		return nil, fmt.Errorf("variable %v has no type", entry.Val(dwarf.AttrName))
+	}
+	return bi.dwarfType(off)
+}
+
+// formatBasicValue renders the memory of a number or bool, the other types are shown as bytes
+func formatBasicValue(typ dwarf.Type, mem []byte) string {
+	v, ok := decodeBasicValue(typ, mem)
+	if !ok {
+		return fmt.Sprintf("%#x", mem)
+	}
+	if v.Kind() == constant.Float {
+		f, _ := constant.Float64Val(v)
+		return fmt.Sprintf("%g", f)
+	}
+	return v.String()
+}
+
+// returnValues shows the results of f right after it returns. The register ABI of go passes them
+// in RAX, RBX, RCX, RDI, RSI, R8, R9, R10, R11, only integers, bools, pointers and strings are supported
+// since the others use the float registers or the stack. The results of ABI0 are read by stackReturnValues
+func returnValues(f *Function) ([]string, error) {
+	regs, err := getRegisters()
+	if err != nil {
+		return nil, err
+	}
+	if bi.goVersion.abi0 {
+		return stackReturnValues(f, regs.Rsp)
+	}
+	intRegs := []uint64{regs.Rax, regs.Rbx, regs.Rcx, regs.Rdi, regs.Rsi, regs.R8, regs.R9, regs.R10, regs.R11}
+	values := make([]string, 0)
+	for _, fv := range f.variables {
+		if fv.Tag != dwarf.TagFormalParameter {
+			continue
+		}
+		if isResult, _ := fv.Val(dwarf.AttrVarParam).(bool); !isResult {
+			continue
+		}
+		name, _ := fv.Val(dwarf.AttrName).(string)
+		typ, err := bi.variableType(fv)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			if t, ok := typ.(*dwarf.TypedefType); ok {
+				typ = t.Type
+				continue
+			}
+			break
+		}
+
+		var value string
+		switch t := typ.(type) {
+		case *dwarf.IntType, *dwarf.UintType, *dwarf.BoolType, *dwarf.PtrType:
+			if len(intRegs) < 1 {
+				return nil, fmt.Errorf("the result %s of %s is not in the registers", name, f.name)
+			}
+			reg := intRegs[0]
+			intRegs = intRegs[1:]
+			mem := make([]byte, 8)
+			binary.LittleEndian.PutUint64(mem, reg)
+			if _, ok := t.(*dwarf.PtrType); ok {
+				value = fmt.Sprintf("%#x", reg)
+			} else {
+				value = formatBasicValue(typ, mem[:typ.Size()])
+			}
+		case *dwarf.StructType:
+			if t.StructName != "string" || len(intRegs) < 2 {
+				return nil, fmt.Errorf("not support the result %s %s of %s", name, typ.String(), f.name)
+			}
+			str := make([]byte, int64(intRegs[1]))
+			if _, err = ptracePeekData(cmd.Process.Pid, uintptr(intRegs[0]), str); err != nil {
+				return nil, err
+			}
+			intRegs = intRegs[2:]
+			value = strconv.Quote(string(str))
+		default:
+			return nil, fmt.Errorf("not support the result %s %s of %s", name, typ.String(), f.name)
+		}
+		values = append(values, fmt.Sprintf("%s = %s", name, value))
+	}
+	return values, nil
+}
+
+// stackReturnValues shows the results of f passed on the stack by ABI0 after the arguments, where their locations
+// are from the cfa of f. The frame of f has gone, its cfa is rsp right after it returns
+func stackReturnValues(f *Function, rsp uint64) ([]string, error) {
+	frame := &Stackframe{pc: f.lowpc, cfa: rsp, fn: f}
+	values := make([]string, 0)
+	for _, fv := range f.variables {
+		if fv.Tag != dwarf.TagFormalParameter {
+			continue
+		}
+		if isResult, _ := fv.Val(dwarf.AttrVarParam).(bool); !isResult {
+			continue
+		}
+		name, _ := fv.Val(dwarf.AttrName).(string)
+		typ, err := bi.variableType(fv)
+		if err != nil {
+			return nil, err
+		}
+		pieces, err := variablePieces(fv, frame, int(typ.Size()))
+		if err != nil {
+			return nil, err
+		}
+		if len(pieces) != 1 || pieces[0].inReg {
+			return nil, fmt.Errorf("the result %s of %s is not on the stack", name, f.name)
+		}
+		value, err := newPrinter().format(typ, pieces[0].addr)
+		if err != nil {
+			value = fmt.Sprintf("<%v>", err)
+		}
+		values = append(values, fmt.Sprintf("%s = %s", name, value))
+	}
+	return values, nil
+}
+
+// formatValue renders the value loaded from the debuggee, strings are quoted and cut like the printer does
+func formatValue(v constant.Value) string {
+	switch v.Kind() {
+	case constant.String:
+		if s, more := truncateString(constant.StringVal(v)); more > 0 {
+			return fmt.Sprintf("%q...+%d more", s, more)
+		}
+		return strconv.Quote(constant.StringVal(v))
+	case constant.Float:
+		f, _ := constant.Float64Val(v)
+		return fmt.Sprintf("%g", f)
+	}
+	return v.String()
+}
+
+// frameVariables shows the variables with the tag visible in the frame selected whose names match filter,
+// like `name type = value`. The ones which can't be loaded show why
+func frameVariables(tag dwarf.Tag, filter *regexp.Regexp) ([]string, error) {
+	vars, err := FrameVariables(tag, filter)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(vars))
+	for _, v := range vars {
+		values = append(values, v.String())
+	}
+	return values, nil
+}
+
+// Variable is a variable of the frame selected rendered
+type Variable struct {
+	name string
+	typeName string
+	value string
+	// shadowed is hidden by another one with the same name in an inner block
+	shadowed bool
+}
+
+func (v *Variable) String() string {
+	line := fmt.Sprintf("%s %s = %s", v.name, v.typeName, v.value)
+	if v.shadowed {
+		line += " (shadowed)"
+	}
+	return line
+}
+
+// FrameVariables renders the variables with the tag visible in the frame selected whose names match filter
+func FrameVariables(tag dwarf.Tag, filter *regexp.Regexp) ([]*Variable, error) {
+	if err := bi.requireDwarf("the variables"); err != nil {
+		return nil, err
+	}
+	frame, err := selectedFrame()
+	if err != nil {
+		return nil, err
+	}
+	vars, shadowed := visibleVariables(frame)
+	values := make([]*Variable, 0)
+	for _, fv := range vars {
+		if fv.Tag != tag {
+			continue
+		}
+		name, _ := fv.Val(dwarf.AttrName).(string)
+		// the results are not set until returning
+		if isResult, _ := fv.Val(dwarf.AttrVarParam).(bool); isResult {
+			continue
+		}
+		if filter != nil && !filter.MatchString(name) {
+			continue
+		}
+		value, typeName := "", "?"
+		typ, err := bi.variableType(fv)
+		if err == nil {
+			typeName = dwarfTypeName(typ)
+			value, err = formatVariable(fv, typ, frame)
+		}
+		if _, ok := err.(*UnsupportVariableErr); ok {
+			value = "<not support the location>"
+		} else if err != nil {
+			value = fmt.Sprintf("<%v>", err)
+		}
+		values = append(values, &Variable{name: name, typeName: typeName, value: value, shadowed: shadowed[fv]})
+	}
+	return values, nil
+}
+
+// loadVariable reads the value of the variable in frame, which may be in the registers
+func loadVariable(fv *dwarf.Entry, typ dwarf.Type, frame *Stackframe) (constant.Value, error) {
+	pieces, err := variablePieces(fv, frame, int(typ.Size()))
+	if err != nil {
+		return nil, err
+	}
+	if len(pieces) == 1 && !pieces[0].inReg {
+		return loadValue(typ, pieces[0].addr)
+	}
+	mem, err := readPieces(pieces, frame)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(typ, mem)
+}
+
+// formatVariable renders the variable in frame, the one in the memory is rendered by the printer
+func formatVariable(fv *dwarf.Entry, typ dwarf.Type, frame *Stackframe) (string, error) {
+	pieces, err := variablePieces(fv, frame, int(typ.Size()))
+	if err != nil {
+		return "", err
+	}
+	if len(pieces) == 1 && !pieces[0].inReg {
+		return newPrinter().format(typ, pieces[0].addr)
+	}
+	mem, err := readPieces(pieces, frame)
+	if err != nil {
+		return "", err
+	}
+	if isPointerShaped(typ) && len(mem) == 8 {
+		return newPrinter().formatWord(typ, binary.LittleEndian.Uint64(mem))
+	}
+	if isString(typ) && len(mem) == 16 {
+		s, more, err := loadString(binary.LittleEndian.Uint64(mem), int64(binary.LittleEndian.Uint64(mem[8:])), loadConfig.maxStringLen)
+		if err != nil {
+			return "", err
+		}
+		if more > 0 {
+			return fmt.Sprintf("%q...+%d more", s, more), nil
+		}
+		return strconv.Quote(s), nil
+	}
+	v, err := decodeValue(typ, mem)
+	if err != nil {
+		return "", err
+	}
+	return formatNumber(v), nil
+}
+
+// WhatIs shows the type of the place expr like `main.T`, or `*main.T` of `&x`, the value is not loaded. The
+// dynamic type of an interface is shown too, like `dynamic type main.T`
+func WhatIs(expr string) ([]string, error) {
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	pointers := ""
+	for {
+		u, ok := node.(*ast.UnaryExpr)
+		if !ok || u.Op != token.AND {
+			break
+		}
+		pointers, node = pointers + "*", u.X
+	}
+	l, err := evalLvalue(node)
+	if err != nil {
+		return nil, err
+	}
+	types := []string{pointers + dwarfTypeName(l.typ)}
+	t, ok := resolveType(l.typ).(*dwarf.StructType)
+	if pointers != "" || !ok || (t.StructName != "runtime.eface" && t.StructName != "runtime.iface") {
+		return types, nil
+	}
+	if l.reg != "" {
+		return append(types, "dynamic type ?"), nil
+	}
+	typ, _, err := interfaceWords(t, l.addr)
+	if err != nil {
+		return nil, err
+	}
+	if typ == 0 {
+		return append(types, "dynamic type nil"), nil
+	}
+	dynamic, err := bi.dynamicType(typ)
+	if err != nil {
+		return nil, err
+	}
+	return append(types, "dynamic type " + dwarfTypeName(dynamic)), nil
+}
+
+// PackageVariables shows the package variables whose names match the regexp filter like `name type = value`,
+// sorted by the names. All of them are shown if filter is empty
+func PackageVariables(filter string) ([]string, error) {
+	if cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	if err := bi.requireDwarf("the package variables"); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(filter)
+	if err != nil {
+		return nil, err
+	}
+	all, err := bi.packageVarNames()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, name := range all {
+		if re.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		pv, _ := bi.packageVar(name)
+		value, typeName := "", "?"
+		typ, err := bi.variableType(pv.entry)
+		if err == nil {
+			typeName = dwarfTypeName(typ)
+			value, err = newPrinter().format(typ, pv.addr)
+		}
+		if err != nil {
+			value = fmt.Sprintf("<%v>", err)
+		}
+		values = append(values, fmt.Sprintf("%s %s = %s", name, typeName, value))
+	}
+	return values, nil
+}
+
+// dwarfTypeName is the name of typ in go, dwarf calls the structs like `struct main.T`
+func dwarfTypeName(typ dwarf.Type) string {
+	switch t := typ.(type) {
+	case *dwarf.StructType:
+		if t.StructName != "" {
+			return t.StructName
+		}
+	case *dwarf.ArrayType:
+		return fmt.Sprintf("[%d]%s", t.Count, dwarfTypeName(t.Type))
+	}
+	return typ.String()
+}
+
+// Locals shows the local variables of the frame selected, only the names matching the regexp filter
+// are shown unless it is empty
+func Locals(filter string) ([]string, error) {
+	var re *regexp.Regexp
+	if filter != "" {
+		var err error
+		if re, err = regexp.Compile(filter); err != nil {
+			return nil, err
+		}
+	}
+	return frameVariables(dwarf.TagVariable, re)
+}
+
+// Args shows the arguments of the frame selected. At the RET of the innermost frame the results have been
+// set in the registers by the go register ABI, so they are shown like `returns ~r0 = 1` too
+func Args() ([]string, error) {
+	values, err := frameVariables(dwarf.TagFormalParameter, nil)
+	if err != nil || curFrame != 0 {
+		return values, err
+	}
+	frame, err := selectedFrame()
+	if err != nil {
+		return nil, err
+	}
+	if _, inst, err := disassembleInst(frame.pc); err != nil || inst.Op != x86asm.RET {
+		return values, nil
+	}
+	results, err := returnValues(frame.fn)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range results {
+		values = append(values, "returns " + v)
+	}
+	return values, nil
+}